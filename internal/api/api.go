@@ -10,6 +10,7 @@ import (
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +22,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
 	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
 	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
@@ -62,6 +64,11 @@ type PathManager interface {
 	APIPathsGet(string) (*defs.APIPath, error)
 }
 
+// PlaybackServer contains methods used by the Metrics server.
+type PlaybackServer interface {
+	APIStats() (*defs.APIPlaybackStats, error)
+}
+
 // HLSServer contains methods used by the API and Metrics server.
 type HLSServer interface {
 	APIMuxersList() (*defs.APIHLSMuxerList, error)
@@ -126,6 +133,8 @@ type API struct {
 	HLSServer      HLSServer
 	WebRTCServer   WebRTCServer
 	SRTServer      SRTServer
+	Registry       *record.Registry
+	Notifier       *notify.Notifier
 	Parent         apiParent
 
 	httpServer *httpp.WrappedServer
@@ -204,6 +213,12 @@ func (a *API) Initialize() error {
 	group.GET("/v3/recordings/list", a.onRecordingsList)
 	group.GET("/v3/recordings/get/*name", a.onRecordingsGet)
 	group.DELETE("/v3/recordings/deletesegment", a.onRecordingDeleteSegment)
+	group.POST("/v3/recordings/cleanup", a.onRecordingsCleanup)
+	group.GET("/v3/recordings/duplicates", a.onRecordingsDuplicates)
+	group.POST("/v3/recordings/repair", a.onRecordingsRepair)
+	group.GET("/v3/recordings/index/changes", a.onRecordingsIndexChanges)
+	group.GET("/v3/recordings/segments/list", a.onSegmentsList)
+	group.GET("/v3/recordings/segments/get/:id", a.onSegmentsGet)
 
 	network, address := restrictnetwork.Restrict("tcp", a.Address)
 
@@ -592,6 +607,11 @@ func (a *API) onPathsGet(ctx *gin.Context) {
 		return
 	}
 
+	// allow players to draw the seekable range without parsing the body
+	if data.RecordingsStart != nil {
+		ctx.Header("X-Recordings-Start", data.RecordingsStart.Format(time.RFC3339Nano))
+	}
+
 	ctx.JSON(http.StatusOK, data)
 }
 
@@ -1078,7 +1098,7 @@ func (a *API) onRecordingsList(ctx *gin.Context) {
 
 	for i, pathName := range pathNames {
 		_, pathConf, _, _ := conf.FindPathConf(c.Paths, pathName)
-		data.Items[i] = recordingEntry(pathConf, pathName)
+		data.Items[i] = recordingEntry(pathConf, pathName, a.Registry)
 	}
 
 	ctx.JSON(http.StatusOK, data)
@@ -1101,7 +1121,7 @@ func (a *API) onRecordingsGet(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, recordingEntry(pathConf, pathName))
+	ctx.JSON(http.StatusOK, recordingEntry(pathConf, pathName, a.Registry))
 }
 
 func (a *API) onRecordingDeleteSegment(ctx *gin.Context) {
@@ -1141,6 +1161,290 @@ func (a *API) onRecordingDeleteSegment(ctx *gin.Context) {
 	ctx.Status(http.StatusOK)
 }
 
+func (a *API) onRecordingsCleanup(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	var dryRun bool
+	if v := ctx.Query("dryRun"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid 'dryRun' parameter: %w", err))
+			return
+		}
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	if c.MaintenanceMode && !dryRun {
+		a.writeError(ctx, http.StatusServiceUnavailable, fmt.Errorf("maintenance mode is enabled"))
+		return
+	}
+
+	_, pathConf, _, err := conf.FindPathConf(c.Paths, pathName)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	entry, ok := record.NewCleanerEntry(pathConf, c.PlaybackAnnotationsFile)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest,
+			fmt.Errorf("path has no 'recordDeleteAfter' or 'recordDeleteQuietAfter'"))
+		return
+	}
+
+	segments, err := record.Cleanup(entry, pathName, dryRun, a.Registry, a.Notifier, a)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := defs.APIRecordingCleanup{
+		DryRun:   dryRun,
+		Segments: make([]*defs.APIRecordingCleanupSegment, len(segments)),
+	}
+
+	for i, seg := range segments {
+		data.Segments[i] = &defs.APIRecordingCleanupSegment{
+			Start: seg.Start,
+			File:  seg.File,
+		}
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onRecordingsRepair(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	var dryRun bool
+	if v := ctx.Query("dryRun"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid 'dryRun' parameter: %w", err))
+			return
+		}
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	if c.MaintenanceMode && !dryRun {
+		a.writeError(ctx, http.StatusServiceUnavailable, fmt.Errorf("maintenance mode is enabled"))
+		return
+	}
+
+	_, pathConf, _, err := conf.FindPathConf(c.Paths, pathName)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("only fMP4 segments can be repaired"))
+		return
+	}
+
+	segments, err := record.Repair(record.RepairerEntry{
+		Path:       pathConf.RecordPath,
+		IndexPath:  pathConf.RecordIndexPath,
+		MaxReaders: pathConf.PlaybackMaxReaders,
+	}, pathName, dryRun, a.Registry, a.Notifier, a)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := defs.APIRecordingRepair{
+		DryRun:   dryRun,
+		Segments: make([]*defs.APIRecordingRepairSegment, len(segments)),
+	}
+
+	for i, seg := range segments {
+		data.Segments[i] = &defs.APIRecordingRepairSegment{
+			Start:        seg.Start,
+			File:         seg.File,
+			Size:         seg.Size,
+			RepairedSize: seg.RepairedSize,
+			Duration:     seg.Duration.Seconds(),
+			Removed:      seg.Removed,
+		}
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onRecordingsDuplicates(ctx *gin.Context) {
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	items := findDuplicates(c.Paths, ctx.Query("path"))
+
+	data := defs.APIRecordingDuplicateList{}
+
+	data.ItemCount = len(items)
+	pageCount, err := paginate(&items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	data.Items = items
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onRecordingsIndexChanges(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	var since int64
+	if v := ctx.Query("since"); v != "" {
+		var err error
+		since, err = parseIndexSeq(v)
+		if err != nil {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid 'since' parameter: %w", err))
+			return
+		}
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	_, pathConf, _, err := conf.FindPathConf(c.Paths, pathName)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if pathConf.RecordIndexPath == "" {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("recording index is disabled"))
+		return
+	}
+
+	entries, err := record.IndexSince(pathConf.RecordIndexPath, pathName, since)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, indexChanges(pathName, since, entries))
+}
+
+func (a *API) onSegmentsList(ctx *gin.Context) {
+	var start, end time.Time
+
+	if v := ctx.Query("start"); v != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid 'start' parameter: %w", err))
+			return
+		}
+	}
+
+	if v := ctx.Query("end"); v != "" {
+		var err error
+		end, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid 'end' parameter: %w", err))
+			return
+		}
+	}
+
+	order := ctx.Query("order")
+	if order != "" && order != "asc" && order != "desc" {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid 'order' parameter: %s", order))
+		return
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	refs, err := findAllSegments(c.Paths, ctx.Query("path"), a.Registry)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	filtered := refs[:0]
+	for _, ref := range refs {
+		if (start.IsZero() || !ref.segment.Start.Before(start)) &&
+			(end.IsZero() || ref.segment.Start.Before(end)) {
+			filtered = append(filtered, ref)
+		}
+	}
+	refs = filtered
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		if !refs[i].segment.Start.Equal(refs[j].segment.Start) {
+			if order == "desc" {
+				return refs[i].segment.Start.After(refs[j].segment.Start)
+			}
+			return refs[i].segment.Start.Before(refs[j].segment.Start)
+		}
+		return refs[i].pathName < refs[j].pathName
+	})
+
+	data := defs.APISegmentList{}
+
+	data.ItemCount = len(refs)
+	pageCount, err := paginate(&refs, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	// details are read for the current page only
+	data.Items = make([]*defs.APISegment, len(refs))
+	indexed := make(map[string]map[string]struct{})
+
+	for i, ref := range refs {
+		if _, ok := indexed[ref.pathName]; !ok {
+			indexed[ref.pathName] = indexedSegments(ref.pathConf, ref.pathName)
+		}
+		data.Items[i] = segmentEntry(ref, indexed[ref.pathName])
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onSegmentsGet(ctx *gin.Context) {
+	pathName, start, err := parseSegmentID(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	refs, err := findAllSegments(c.Paths, pathName, a.Registry)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, ref := range refs {
+		if ref.segment.Start.Equal(start) {
+			ctx.JSON(http.StatusOK, segmentEntry(ref, indexedSegments(ref.pathConf, ref.pathName)))
+			return
+		}
+	}
+
+	a.writeError(ctx, http.StatusNotFound, fmt.Errorf("segment not found"))
+}
+
 // ReloadConf is called by core.
 func (a *API) ReloadConf(conf *conf.Conf) {
 	a.mutex.Lock()
@@ -8,12 +8,15 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/auth"
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/test"
 	"github.com/stretchr/testify/require"
 )
@@ -752,3 +755,141 @@ func TestRecordingsDeleteSegment(t *testing.T) {
 	defer res.Body.Close()
 	require.Equal(t, http.StatusOK, res.StatusCode)
 }
+
+func TestRecordingsSegments(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cnf := tempConf(t, "pathDefaults:\n"+
+		"  recordPath: "+filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")+"\n"+
+		"  recordIndexPath: "+filepath.Join(dir, "index")+"\n"+
+		"paths:\n"+
+		"  all_others:\n")
+
+	api := API{
+		Address:     "localhost:9997",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		Conf:        cnf,
+		AuthManager: test.NilAuthManager,
+		Parent:      &testParent{},
+	}
+	err = api.Initialize()
+	require.NoError(t, err)
+	defer api.Close()
+
+	err = os.Mkdir(filepath.Join(dir, "mypath1"), 0o755)
+	require.NoError(t, err)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath2"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath1", "2008-11-07_11-22-00-500000.mp4"), []byte("abc"), 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath1", "2009-11-07_11-22-00-900000.mp4"), []byte(""), 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath2", "2010-11-07_11-22-00-900000.mp4"), []byte(""), 0o644)
+	require.NoError(t, err)
+
+	err = record.IndexAdd(filepath.Join(dir, "index"), "mypath1", record.IndexEntry{
+		Start: time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local),
+		Path:  filepath.Join(dir, "mypath1", "2008-11-07_11-22-00-500000.mp4"),
+	})
+	require.NoError(t, err)
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	var out defs.APISegmentList
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/segments/list?order=desc&itemsPerPage=2", nil, &out)
+	require.Equal(t, 3, out.ItemCount)
+	require.Equal(t, 2, out.PageCount)
+	require.Len(t, out.Items, 2)
+	require.Equal(t, "mypath2", out.Items[0].Path)
+	require.Equal(t, "mypath1", out.Items[1].Path)
+
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/segments/list?path=mypath1&end="+
+		url.QueryEscape(time.Date(2009, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)), nil, &out)
+	require.Equal(t, 1, out.ItemCount)
+	require.Equal(t, int64(3), out.Items[0].Size)
+	require.True(t, out.Items[0].Indexed)
+	require.True(t, out.Items[0].Start.Equal(time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local)))
+
+	var seg defs.APISegment
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/segments/get/"+out.Items[0].ID, nil, &seg)
+	require.Equal(t, out.Items[0], &seg)
+
+	res, err := hc.Get("http://localhost:9997/v3/recordings/segments/get/" + segmentID("mypath1", time.Now()))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestRecordingsIndexChanges(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cnf := tempConf(t, "pathDefaults:\n"+
+		"  recordPath: "+filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")+"\n"+
+		"  recordIndexPath: "+filepath.Join(dir, "index")+"\n"+
+		"paths:\n"+
+		"  all_others:\n")
+
+	api := API{
+		Address:     "localhost:9997",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		Conf:        cnf,
+		AuthManager: test.NilAuthManager,
+		Parent:      &testParent{},
+	}
+	err = api.Initialize()
+	require.NoError(t, err)
+	defer api.Close()
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	var out defs.APIRecordingIndexChanges
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/index/changes?path=mypath1", nil, &out)
+	require.Equal(t, int64(0), out.Seq)
+	require.Empty(t, out.Entries)
+
+	for i := 0; i < 2; i++ {
+		err = record.IndexAdd(filepath.Join(dir, "index"), "mypath1", record.IndexEntry{
+			Start:    time.Date(2008, 11, 0o7, 11, 22+i, 0, 0, time.Local),
+			Duration: 60 * time.Second,
+			Path:     filepath.Join(dir, "mypath1", "segment"+strconv.Itoa(i)+".mp4"),
+			Codecs:   []string{"H264"},
+		})
+		require.NoError(t, err)
+	}
+
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/index/changes?path=mypath1", nil, &out)
+	require.Len(t, out.Entries, 2)
+	require.Equal(t, out.Entries[1].Seq, out.Seq)
+	require.Equal(t, segmentID("mypath1", time.Date(2008, 11, 0o7, 11, 22, 0, 0, time.Local)), out.Entries[0].ID)
+	require.Equal(t, float64(60), out.Entries[0].Duration)
+	require.Equal(t, []string{"H264"}, out.Entries[0].Codecs)
+
+	seq := out.Entries[0].Seq
+
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/index/changes?path=mypath1&since="+
+		strconv.FormatInt(seq, 10), nil, &out)
+	require.Len(t, out.Entries, 1)
+	require.Equal(t, filepath.Join(dir, "mypath1", "segment1.mp4"), out.Entries[0].File)
+
+	// dates are accepted too
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/index/changes?path=mypath1&since="+
+		url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)), nil, &out)
+	require.Empty(t, out.Entries)
+
+	res, err := hc.Get("http://localhost:9997/v3/recordings/index/changes?path=mypath1&since=abc")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -1,11 +1,16 @@
 package api
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
@@ -118,12 +123,13 @@ func getAllPathsWithRecordings(paths map[string]*conf.Path) []string {
 func recordingEntry(
 	pathConf *conf.Path,
 	pathName string,
+	registry *record.Registry,
 ) *defs.APIRecording {
 	ret := &defs.APIRecording{
 		Name: pathName,
 	}
 
-	segments, _ := playback.FindSegments(pathConf, pathName)
+	segments, _ := playback.FindSegments(pathConf, pathName, registry)
 
 	ret.Segments = make([]*defs.APIRecordingSegment, len(segments))
 
@@ -135,3 +141,202 @@ func recordingEntry(
 
 	return ret
 }
+
+// segmentID returns the ID of a segment, that is made of its path name and start date.
+func segmentID(pathName string, start time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(pathName + "|" + start.Format(time.RFC3339Nano)))
+}
+
+func parseSegmentID(id string) (string, time.Time, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid ID")
+	}
+
+	i := strings.LastIndexByte(string(buf), '|')
+	if i < 0 {
+		return "", time.Time{}, fmt.Errorf("invalid ID")
+	}
+
+	start, err := time.Parse(time.RFC3339Nano, string(buf[i+1:]))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid ID")
+	}
+
+	return string(buf[:i]), start, nil
+}
+
+type segmentRef struct {
+	pathName string
+	pathConf *conf.Path
+	segment  *playback.Segment
+}
+
+// findAllSegments returns the segments of a path,
+// or the segments of all paths with recordings when pathName is empty.
+func findAllSegments(
+	paths map[string]*conf.Path,
+	pathName string,
+	registry *record.Registry,
+) ([]segmentRef, error) {
+	var pathNames []string
+
+	if pathName != "" {
+		pathNames = []string{pathName}
+	} else {
+		pathNames = getAllPathsWithRecordings(paths)
+	}
+
+	out := []segmentRef{}
+
+	for _, name := range pathNames {
+		_, pathConf, _, err := conf.FindPathConf(paths, name)
+		if err != nil {
+			return nil, err
+		}
+
+		// segments are read from disk, in order to report whether they are indexed
+		segments, _ := playback.FindSegmentFiles(pathConf, name, registry)
+
+		for _, seg := range segments {
+			out = append(out, segmentRef{
+				pathName: name,
+				pathConf: pathConf,
+				segment:  seg,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+// indexedSegments returns the absolute paths of segments in the index of a path.
+func indexedSegments(pathConf *conf.Path, pathName string) map[string]struct{} {
+	out := make(map[string]struct{})
+
+	if pathConf.RecordIndexPath == "" {
+		return out
+	}
+
+	entries, _ := record.IndexRead(pathConf.RecordIndexPath, pathName)
+	for _, entry := range entries {
+		out[entry.Path] = struct{}{}
+	}
+
+	return out
+}
+
+func segmentEntry(ref segmentRef, indexed map[string]struct{}) *defs.APISegment {
+	ret := &defs.APISegment{
+		ID:     segmentID(ref.pathName, ref.segment.Start),
+		Path:   ref.pathName,
+		Start:  ref.segment.Start,
+		Codecs: []string{},
+	}
+
+	if fi, err := ref.segment.Stat(); err == nil {
+		ret.Size = fi.Size()
+	}
+
+	// segments that are being written or are corrupted are listed without details
+	if details, err := playback.ReadSegmentDetails(ref.pathConf.RecordFormat, ref.segment); err == nil {
+		ret.Duration = details.Duration.Seconds()
+		ret.Codecs = details.Codecs
+	}
+
+	fpath, _ := filepath.Abs(ref.segment.Fpath)
+	_, ret.Indexed = indexed[fpath]
+
+	return ret
+}
+
+// findDuplicates compares the fingerprints in the indexes of all paths with recordings,
+// and returns the segments that have been recorded into another path too.
+// When pathName is not empty, only segments of this path are returned.
+func findDuplicates(paths map[string]*conf.Path, pathName string) []*defs.APIRecordingDuplicate {
+	entries := make(map[string][]record.IndexEntry)
+
+	for _, name := range getAllPathsWithRecordings(paths) {
+		_, pathConf, _, err := conf.FindPathConf(paths, name)
+		if err != nil || pathConf.RecordIndexPath == "" {
+			continue
+		}
+
+		entries[name], _ = record.IndexRead(pathConf.RecordIndexPath, name)
+	}
+
+	out := []*defs.APIRecordingDuplicate{}
+
+	for _, dup := range record.FindDuplicates(entries) {
+		if pathName != "" && dup.Path != pathName {
+			continue
+		}
+
+		item := &defs.APIRecordingDuplicate{
+			Path:        dup.Path,
+			Start:       dup.Entry.Start,
+			Duration:    dup.Entry.Duration.Seconds(),
+			DuplicateOf: dup.DuplicateOf,
+			Similarity:  dup.Similarity,
+		}
+
+		if fi, err := os.Stat(dup.Entry.Path); err == nil {
+			item.Size = fi.Size()
+		}
+
+		out = append(out, item)
+	}
+
+	return out
+}
+
+// parseIndexSeq parses a sequence number of an index.
+// Since sequence numbers are derived from the time entries were added, a date is accepted too.
+func parseIndexSeq(v string) (int64, error) {
+	if seq, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if seq < 0 {
+			return 0, fmt.Errorf("negative sequence number")
+		}
+		return seq, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, fmt.Errorf("not a sequence number or a date")
+	}
+
+	return t.UnixMicro(), nil
+}
+
+// indexChanges returns the entries that have been added to the index of a path after since,
+// together with the sequence number that allows to read the following ones.
+func indexChanges(pathName string, since int64, entries []record.IndexEntry) *defs.APIRecordingIndexChanges {
+	out := &defs.APIRecordingIndexChanges{
+		Path:    pathName,
+		Seq:     since,
+		Entries: make([]*defs.APIRecordingIndexEntry, len(entries)),
+	}
+
+	for i, entry := range entries {
+		codecs := entry.Codecs
+		if codecs == nil {
+			codecs = []string{}
+		}
+
+		out.Entries[i] = &defs.APIRecordingIndexEntry{
+			Seq:           entry.Seq,
+			ID:            segmentID(pathName, entry.Start),
+			Start:         entry.Start,
+			Duration:      entry.Duration.Seconds(),
+			File:          entry.Path,
+			Codecs:        codecs,
+			Thinned:       entry.Thinned,
+			Discontinuity: string(entry.Discontinuity),
+			Removed:       entry.Removed,
+		}
+
+		out.Seq = max(out.Seq, entry.Seq)
+	}
+
+	return out
+}
@@ -4,6 +4,7 @@ package auth
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -57,8 +58,14 @@ type Request struct {
 	Query       string
 	RTSPRequest *base.Request
 	RTSPNonce   string
+
+	// filled by Authenticate with the maximum age of recordings
+	// that can be accessed with ActionPlayback. Zero means no limit.
+	MaxLookback time.Duration
 }
 
+var errInvalidCredentials = errors.New("invalid credentials")
+
 // Error is a authentication error.
 type Error struct {
 	Message string
@@ -75,17 +82,26 @@ func matchesPermission(perms []conf.AuthInternalUserPermission, req *Request) bo
 			if perm.Action == conf.AuthActionPublish ||
 				perm.Action == conf.AuthActionRead ||
 				perm.Action == conf.AuthActionPlayback {
+				matches := false
+
 				switch {
 				case perm.Path == "":
-					return true
+					matches = true
 
 				case strings.HasPrefix(perm.Path, "~"):
 					regexp, err := regexp.Compile(perm.Path[1:])
 					if err == nil && regexp.MatchString(req.Path) {
-						return true
+						matches = true
 					}
 
 				case perm.Path == req.Path:
+					matches = true
+				}
+
+				if matches {
+					if perm.Action == conf.AuthActionPlayback {
+						req.MaxLookback = time.Duration(perm.MaxLookback)
+					}
 					return true
 				}
 			} else {
@@ -166,10 +182,35 @@ func (m *Manager) authenticateInternal(req *Request, rtspAuthHeader *headers.Aut
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
+	// users with a name are checked first, in order not to grant the permissions
+	// of the "any" user to requests that contain wrong credentials of another user.
+	wrongCredentials := false
+
 	for _, u := range m.InternalUsers {
-		if err := m.authenticateWithUser(req, rtspAuthHeader, &u); err == nil {
+		if u.User == "any" {
+			continue
+		}
+
+		err := m.authenticateWithUser(req, rtspAuthHeader, &u)
+		if err == nil {
 			return nil
 		}
+
+		if errors.Is(err, errInvalidCredentials) {
+			wrongCredentials = true
+		}
+	}
+
+	if wrongCredentials {
+		return errInvalidCredentials
+	}
+
+	for _, u := range m.InternalUsers {
+		if u.User == "any" {
+			if err := m.authenticateWithUser(req, rtspAuthHeader, &u); err == nil {
+				return nil
+			}
+		}
 	}
 
 	return fmt.Errorf("authentication failed")
@@ -202,10 +243,10 @@ func (m *Manager) authenticateWithUser(
 				rtspAuthRealm,
 				req.RTSPNonce)
 			if err != nil {
-				return err
+				return errInvalidCredentials
 			}
 		} else if !u.Pass.Check(req.Pass) {
-			return fmt.Errorf("invalid credentials")
+			return errInvalidCredentials
 		}
 	}
 
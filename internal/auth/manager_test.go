@@ -186,6 +186,51 @@ func TestAuthInternalRTSPDigest(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestAuthInternalMaxLookback(t *testing.T) {
+	m := Manager{
+		Method: conf.AuthMethodInternal,
+		InternalUsers: []conf.AuthInternalUser{
+			{
+				User: "limiteduser",
+				Pass: "testpass",
+				Permissions: []conf.AuthInternalUserPermission{{
+					Action:      conf.AuthActionPlayback,
+					Path:        "mypath",
+					MaxLookback: conf.StringDuration(24 * time.Hour),
+				}},
+			},
+			{
+				User: "any",
+				Permissions: []conf.AuthInternalUserPermission{{
+					Action: conf.AuthActionPlayback,
+				}},
+			},
+		},
+	}
+
+	req := &Request{
+		User:   "limiteduser",
+		Pass:   "testpass",
+		IP:     net.ParseIP("127.0.0.1"),
+		Action: conf.AuthActionPlayback,
+		Path:   "mypath",
+	}
+	err := m.Authenticate(req)
+	require.NoError(t, err)
+	require.Equal(t, 24*time.Hour, req.MaxLookback)
+
+	// wrong credentials must not fall back to the unrestricted permissions of "any"
+	req = &Request{
+		User:   "limiteduser",
+		Pass:   "wrongpass",
+		IP:     net.ParseIP("127.0.0.1"),
+		Action: conf.AuthActionPlayback,
+		Path:   "mypath",
+	}
+	err = m.Authenticate(req)
+	require.Error(t, err)
+}
+
 func TestAuthHTTP(t *testing.T) {
 	for _, outcome := range []string{"ok", "fail"} {
 		t.Run(outcome, func(t *testing.T) {
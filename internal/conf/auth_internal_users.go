@@ -8,6 +8,9 @@ import (
 type AuthInternalUserPermission struct {
 	Action AuthAction `json:"action"`
 	Path   string     `json:"path"`
+
+	// only for AuthActionPlayback
+	MaxLookback StringDuration `json:"maxLookback,omitempty"`
 }
 
 // AuthInternalUser is an user.
@@ -158,17 +158,19 @@ var defaultAuthInternalUsers = AuthInternalUsers{
 // WARNING: Avoid using slices directly due to https://github.com/golang/go/issues/21092
 type Conf struct {
 	// General
-	LogLevel            LogLevel        `json:"logLevel"`
-	LogDestinations     LogDestinations `json:"logDestinations"`
-	LogFile             string          `json:"logFile"`
-	ReadTimeout         StringDuration  `json:"readTimeout"`
-	WriteTimeout        StringDuration  `json:"writeTimeout"`
-	ReadBufferCount     *int            `json:"readBufferCount,omitempty"` // deprecated
-	WriteQueueSize      int             `json:"writeQueueSize"`
-	UDPMaxPayloadSize   int             `json:"udpMaxPayloadSize"`
-	RunOnConnect        string          `json:"runOnConnect"`
-	RunOnConnectRestart bool            `json:"runOnConnectRestart"`
-	RunOnDisconnect     string          `json:"runOnDisconnect"`
+	LogLevel             LogLevel             `json:"logLevel"`
+	LogDestinations      LogDestinations      `json:"logDestinations"`
+	LogFile              string               `json:"logFile"`
+	ReadTimeout          StringDuration       `json:"readTimeout"`
+	WriteTimeout         StringDuration       `json:"writeTimeout"`
+	ReadBufferCount      *int                 `json:"readBufferCount,omitempty"` // deprecated
+	WriteQueueSize       int                  `json:"writeQueueSize"`
+	UDPMaxPayloadSize    int                  `json:"udpMaxPayloadSize"`
+	RunOnConnect         string               `json:"runOnConnect"`
+	RunOnConnectRestart  bool                 `json:"runOnConnectRestart"`
+	RunOnDisconnect      string               `json:"runOnDisconnect"`
+	NotificationChannels NotificationChannels `json:"notificationChannels"`
+	MaintenanceMode      bool                 `json:"maintenanceMode"`
 
 	// Authentication
 	AuthMethod                AuthMethod                  `json:"authMethod"`
@@ -206,13 +208,34 @@ type Conf struct {
 	PPROFTrustedProxies IPNetworks `json:"pprofTrustedProxies"`
 
 	// Playback
-	Playback               bool       `json:"playback"`
-	PlaybackAddress        string     `json:"playbackAddress"`
-	PlaybackEncryption     bool       `json:"playbackEncryption"`
-	PlaybackServerKey      string     `json:"playbackServerKey"`
-	PlaybackServerCert     string     `json:"playbackServerCert"`
-	PlaybackAllowOrigin    string     `json:"playbackAllowOrigin"`
-	PlaybackTrustedProxies IPNetworks `json:"playbackTrustedProxies"`
+	Playback                       bool                    `json:"playback"`
+	PlaybackAddress                string                  `json:"playbackAddress"`
+	PlaybackEncryption             bool                    `json:"playbackEncryption"`
+	PlaybackServerKey              string                  `json:"playbackServerKey"`
+	PlaybackServerCert             string                  `json:"playbackServerCert"`
+	PlaybackAllowOrigin            string                  `json:"playbackAllowOrigin"`
+	PlaybackTrustedProxies         IPNetworks              `json:"playbackTrustedProxies"`
+	PlaybackPeers                  []string                `json:"playbackPeers"`
+	PlaybackExportPath             string                  `json:"playbackExportPath"`
+	PlaybackExportSigningKey       string                  `json:"playbackExportSigningKey"`
+	PlaybackShareLinksFile         string                  `json:"playbackShareLinksFile"`
+	PlaybackPrivacyFile            string                  `json:"playbackPrivacyFile"`
+	PlaybackAnnotationsFile        string                  `json:"playbackAnnotationsFile"`
+	PlaybackDailyQuota             StringSize              `json:"playbackDailyQuota"`
+	PlaybackMonthlyQuota           StringSize              `json:"playbackMonthlyQuota"`
+	PlaybackHLSEncryption          bool                    `json:"playbackHLSEncryption"`
+	PlaybackHeaders                HTTPHeaders             `json:"playbackHeaders"`
+	PlaybackTempDir                string                  `json:"playbackTempDir"`
+	PlaybackMemoryLimit            StringSize              `json:"playbackMemoryLimit"`
+	PlaybackMaxImportSize          StringSize              `json:"playbackMaxImportSize"`
+	PlaybackMaxConcurrentDownloads int                     `json:"playbackMaxConcurrentDownloads"`
+	PlaybackMaxConcurrentMuxers    int                     `json:"playbackMaxConcurrentMuxers"`
+	PlaybackMaxBoxDepth            int                     `json:"playbackMaxBoxDepth"`
+	PlaybackMaxBoxCount            int                     `json:"playbackMaxBoxCount"`
+	PlaybackMaxBoxSize             StringSize              `json:"playbackMaxBoxSize"`
+	PlaybackPriorities             PlaybackPriorities      `json:"playbackPriorities"`
+	PlaybackExportSchedules        PlaybackExportSchedules `json:"playbackExportSchedules"`
+	PlaybackAccessLogLevel         LogLevel                `json:"playbackAccessLogLevel"`
 
 	// RTSP server
 	RTSP              bool             `json:"rtsp"`
@@ -309,6 +332,7 @@ func (conf *Conf) setDefaults() {
 	conf.WriteTimeout = 10 * StringDuration(time.Second)
 	conf.WriteQueueSize = 512
 	conf.UDPMaxPayloadSize = 1472
+	conf.NotificationChannels = NotificationChannels{}
 
 	// Authentication
 	conf.AuthInternalUsers = defaultAuthInternalUsers
@@ -347,6 +371,16 @@ func (conf *Conf) setDefaults() {
 	conf.PlaybackServerKey = "server.key"
 	conf.PlaybackServerCert = "server.crt"
 	conf.PlaybackAllowOrigin = "*"
+	conf.PlaybackPeers = []string{}
+	conf.PlaybackHeaders = HTTPHeaders{}
+	conf.PlaybackMemoryLimit = 64 * 1024 * 1024
+	conf.PlaybackMaxImportSize = 8 * 1024 * 1024 * 1024
+	conf.PlaybackMaxBoxDepth = 16
+	conf.PlaybackMaxBoxCount = 1000000
+	conf.PlaybackMaxBoxSize = 16 * 1024 * 1024
+	conf.PlaybackPriorities = PlaybackPriorities{}
+	conf.PlaybackExportSchedules = PlaybackExportSchedules{}
+	conf.PlaybackAccessLogLevel = LogLevel(logger.Debug)
 
 	// RTSP server
 	conf.RTSP = true
@@ -502,6 +536,12 @@ func (conf *Conf) Validate() error {
 	if conf.UDPMaxPayloadSize > 1472 {
 		return fmt.Errorf("'udpMaxPayloadSize' must be less than 1472")
 	}
+	for i, channel := range conf.NotificationChannels {
+		err := channel.validate()
+		if err != nil {
+			return fmt.Errorf("invalid notification channel %d: %w", i, err)
+		}
+	}
 
 	// Authentication
 	if conf.ExternalAuthenticationURL != nil {
@@ -652,6 +692,27 @@ func (conf *Conf) Validate() error {
 		}
 	}
 
+	// Playback
+
+	if conf.PlaybackMaxConcurrentMuxers < 0 {
+		return fmt.Errorf("'playbackMaxConcurrentMuxers' must be zero or greater")
+	}
+	if conf.PlaybackExportSigningKey != "" && conf.PlaybackExportPath == "" {
+		return fmt.Errorf("'playbackExportSigningKey' requires 'playbackExportPath'")
+	}
+	if len(conf.PlaybackExportSchedules) != 0 && conf.PlaybackExportPath == "" {
+		return fmt.Errorf("'playbackExportSchedules' requires 'playbackExportPath'")
+	}
+	for i, schedule := range conf.PlaybackExportSchedules {
+		err := schedule.validate()
+		if err != nil {
+			return fmt.Errorf("invalid export schedule %d: %w", i, err)
+		}
+		if schedule.Event != "" && conf.PlaybackAnnotationsFile == "" {
+			return fmt.Errorf("invalid export schedule %d: event requires 'playbackAnnotationsFile'", i)
+		}
+	}
+
 	// Record (deprecated)
 	if conf.Record != nil {
 		conf.PathDefaults.Record = *conf.Record
@@ -57,6 +57,10 @@ func TestConfFromFile(t *testing.T) {
 			RecordPartDuration:         StringDuration(1 * time.Second),
 			RecordSegmentDuration:      3600000000000,
 			RecordDeleteAfter:          86400000000000,
+			RecordOnvifPostDuration:    10000000000,
+			PlaybackEnable:             true,
+			PlaybackHeaders:            HTTPHeaders{},
+			PlaybackRecentHeaders:      HTTPHeaders{},
 			OverridePublisher:          true,
 			RPICameraWidth:             1920,
 			RPICameraHeight:            1080,
@@ -290,6 +294,12 @@ func TestConfErrors(t *testing.T) {
 			"webrtcICEServers: [testing]\n",
 			"invalid ICE server: 'testing'",
 		},
+		{
+			"invalid playback header",
+			"playbackHeaders:\n" +
+				"  'Cache Control': no-store\n",
+			"invalid header name 'Cache Control'",
+		},
 		{
 			"non existent parameter 2",
 			"paths:\n" +
@@ -0,0 +1,192 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type cronField struct {
+	min int
+	max int
+}
+
+var cronFields = []cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week, where both 0 and 7 are sunday
+}
+
+func parseCronField(v string, f cronField) (uint64, error) {
+	var out uint64
+
+	for _, part := range strings.Split(v, ",") {
+		step := 1
+
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", part[i+1:])
+			}
+			part = part[:i]
+		}
+
+		lo, hi := f.min, f.max
+
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", bounds[0])
+			}
+
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value '%s'", bounds[1])
+				}
+			} else if step != 1 {
+				hi = f.max
+			}
+
+			if lo < f.min || hi > f.max || lo > hi {
+				return 0, fmt.Errorf("value '%s' out of range %d-%d", part, f.min, f.max)
+			}
+		}
+
+		for i := lo; i <= hi; i += step {
+			out |= 1 << uint(i)
+		}
+	}
+
+	return out, nil
+}
+
+// CronSchedule is a schedule in the cron format,
+// that is made of minute, hour, day of month, month and day of week.
+type CronSchedule struct {
+	raw      string
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+
+	// whether day of month and day of week are restricted
+	daysSet     bool
+	weekdaysSet bool
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s CronSchedule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.raw)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *CronSchedule) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	if in == "" {
+		*s = CronSchedule{}
+		return nil
+	}
+
+	parts := strings.Fields(in)
+	if len(parts) != len(cronFields) {
+		return fmt.Errorf("invalid schedule '%s': it must contain %d fields", in, len(cronFields))
+	}
+
+	var masks [5]uint64
+
+	for i, part := range parts {
+		var err error
+		masks[i], err = parseCronField(part, cronFields[i])
+		if err != nil {
+			return fmt.Errorf("invalid schedule '%s': %w", in, err)
+		}
+	}
+
+	// sunday can be expressed as 7
+	if masks[4]&(1<<7) != 0 {
+		masks[4] |= 1
+	}
+
+	*s = CronSchedule{
+		raw:      in,
+		minutes:  masks[0],
+		hours:    masks[1],
+		days:     masks[2],
+		months:   masks[3],
+		weekdays: masks[4],
+
+		daysSet:     !strings.HasPrefix(parts[2], "*"),
+		weekdaysSet: !strings.HasPrefix(parts[4], "*"),
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (s *CronSchedule) UnmarshalEnv(_ string, v string) error {
+	return s.UnmarshalJSON([]byte(`"` + v + `"`))
+}
+
+func (s CronSchedule) matchesDay(t time.Time) bool {
+	dayMatches := s.days&(1<<uint(t.Day())) != 0
+	weekdayMatches := s.weekdays&(1<<uint(t.Weekday())) != 0
+
+	// when both fields are restricted, a day matches if any of them matches
+	if s.daysSet && s.weekdaysSet {
+		return dayMatches || weekdayMatches
+	}
+
+	return dayMatches && weekdayMatches
+}
+
+// Next returns the first time after t that matches the schedule.
+// It returns the zero time if there's no such time in the next five years.
+func (s CronSchedule) Next(t time.Time) time.Time {
+	if s.raw == "" {
+		return time.Time{}
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
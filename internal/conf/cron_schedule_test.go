@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronSchedule(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 30, 20, 0, time.UTC) // wednesday
+
+	for _, ca := range []struct {
+		name     string
+		schedule string
+		next     time.Time
+	}{
+		{
+			"daily",
+			"0 6 * * *",
+			time.Date(2024, 5, 16, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			"step",
+			"*/15 * * * *",
+			time.Date(2024, 5, 15, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			"range and list",
+			"0 8-9,18 * * *",
+			time.Date(2024, 5, 15, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			"weekday",
+			"30 2 * * 0",
+			time.Date(2024, 5, 19, 2, 30, 0, 0, time.UTC),
+		},
+		{
+			"day of month or weekday",
+			"0 0 1 * 4",
+			time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"month",
+			"0 0 1 1 *",
+			time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var s CronSchedule
+			err := json.Unmarshal([]byte(`"`+ca.schedule+`"`), &s)
+			require.NoError(t, err)
+			require.Equal(t, ca.next, s.Next(now))
+
+			buf, err := json.Marshal(s)
+			require.NoError(t, err)
+			require.Equal(t, `"`+ca.schedule+`"`, string(buf))
+		})
+	}
+
+	for _, schedule := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *"} {
+		var s CronSchedule
+		err := json.Unmarshal([]byte(`"`+schedule+`"`), &s)
+		require.Error(t, err, schedule)
+	}
+}
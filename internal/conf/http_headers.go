@@ -0,0 +1,51 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// HTTPHeaders is a parameter that contains additional HTTP response headers.
+type HTTPHeaders map[string]string
+
+func isHTTPToken(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c <= ' ' || c >= 0x7F || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *HTTPHeaders) UnmarshalJSON(b []byte) error {
+	var in map[string]string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	for k, v := range in {
+		if !isHTTPToken(k) {
+			return fmt.Errorf("invalid header name '%s'", k)
+		}
+
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid value of header '%s'", k)
+		}
+	}
+
+	*d = in
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (d *HTTPHeaders) UnmarshalEnv(_ string, v string) error {
+	return d.UnmarshalJSON([]byte(v))
+}
@@ -0,0 +1,55 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// NotificationChannel is a destination of notifications.
+type NotificationChannel struct {
+	URL    string   `json:"url"`
+	Topic  string   `json:"topic"`
+	Events []string `json:"events"`
+	Paths  []string `json:"paths"`
+}
+
+func (c NotificationChannel) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "http", "https", "mqtt":
+
+	case "smtp":
+		if u.Query().Get("from") == "" || u.Query().Get("to") == "" {
+			return fmt.Errorf("SMTP URLs must contain 'from' and 'to'")
+		}
+
+	default:
+		return fmt.Errorf("unsupported scheme: '%s'", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("host is empty")
+	}
+
+	if c.Topic != "" && u.Scheme != "mqtt" {
+		return fmt.Errorf("topic can be used with MQTT only")
+	}
+
+	return nil
+}
+
+// NotificationChannels is a list of NotificationChannel.
+type NotificationChannels []NotificationChannel
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *NotificationChannels) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*s = nil
+	return json.Unmarshal(b, (*[]NotificationChannel)(s))
+}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
+
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
 )
 
 var rePathName = regexp.MustCompile(`^[0-9a-zA-Z_\-/\.~]+$`)
@@ -95,15 +97,41 @@ type Path struct {
 	MaxReaders                 int            `json:"maxReaders"`
 	SRTReadPassphrase          string         `json:"srtReadPassphrase"`
 	Fallback                   string         `json:"fallback"`
+	UseAbsoluteTimestamp       bool           `json:"useAbsoluteTimestamp"`
 
 	// Record
-	Record                bool           `json:"record"`
-	Playback              *bool          `json:"playback,omitempty"` // deprecated
-	RecordPath            string         `json:"recordPath"`
-	RecordFormat          RecordFormat   `json:"recordFormat"`
-	RecordPartDuration    StringDuration `json:"recordPartDuration"`
-	RecordSegmentDuration StringDuration `json:"recordSegmentDuration"`
-	RecordDeleteAfter     StringDuration `json:"recordDeleteAfter"`
+	Record                      bool            `json:"record"`
+	Playback                    *bool           `json:"playback,omitempty"` // deprecated
+	RecordPath                  string          `json:"recordPath"`
+	RecordFormat                RecordFormat    `json:"recordFormat"`
+	RecordPartDuration          StringDuration  `json:"recordPartDuration"`
+	RecordSegmentDuration       StringDuration  `json:"recordSegmentDuration"`
+	RecordDeleteAfter           StringDuration  `json:"recordDeleteAfter"`
+	RecordDeleteQuietAfter      StringDuration  `json:"recordDeleteQuietAfter"`
+	RecordDeleteSchedule        CronSchedule    `json:"recordDeleteSchedule"`
+	RecordIndexPath             string          `json:"recordIndexPath"`
+	RecordConvertMPEGTS         bool            `json:"recordConvertMPEGTS"`
+	RecordThinAfter             StringDuration  `json:"recordThinAfter"`
+	RecordMigrateFrom           string          `json:"recordMigrateFrom"`
+	RecordRepair                bool            `json:"recordRepair"`
+	RecordChecksum              bool            `json:"recordChecksum"`
+	RecordMinBitrate            int             `json:"recordMinBitrate"`
+	RecordMaxBitrate            int             `json:"recordMaxBitrate"`
+	RecordMirrorPath            string          `json:"recordMirrorPath"`
+	RecordArchiveTo             string          `json:"recordArchiveTo"`
+	RecordOnvifEvents           string          `json:"recordOnvifEvents"`
+	RecordOnvifMode             RecordOnvifMode `json:"recordOnvifMode"`
+	RecordOnvifPostDuration     StringDuration  `json:"recordOnvifPostDuration"`
+	PlaybackEnable              bool            `json:"playbackEnable"`
+	PlaybackFormats             PlaybackFormats `json:"playbackFormats"`
+	PlaybackMaxDuration         StringDuration  `json:"playbackMaxDuration"`
+	PlaybackMaxConcurrentMuxers int             `json:"playbackMaxConcurrentMuxers"`
+	PlaybackMaxReaders          int             `json:"playbackMaxReaders"`
+	PlaybackFilter              string          `json:"playbackFilter"`
+	PlaybackFiller              string          `json:"playbackFiller"`
+	PlaybackServeSegments       bool            `json:"playbackServeSegments"`
+	PlaybackHeaders             HTTPHeaders     `json:"playbackHeaders"`
+	PlaybackRecentHeaders       HTTPHeaders     `json:"playbackRecentHeaders"`
 
 	// Authentication (deprecated)
 	PublishUser *Credential `json:"publishUser,omitempty"` // deprecated
@@ -194,6 +222,13 @@ func (pconf *Path) setDefaults() {
 	pconf.RecordPartDuration = StringDuration(1 * time.Second)
 	pconf.RecordSegmentDuration = 3600 * StringDuration(time.Second)
 	pconf.RecordDeleteAfter = 24 * 3600 * StringDuration(time.Second)
+	pconf.RecordOnvifMode = RecordOnvifModeTag
+	pconf.RecordOnvifPostDuration = 10 * StringDuration(time.Second)
+
+	// Playback
+	pconf.PlaybackEnable = true
+	pconf.PlaybackHeaders = HTTPHeaders{}
+	pconf.PlaybackRecentHeaders = HTTPHeaders{}
 
 	// Publisher source
 	pconf.OverridePublisher = true
@@ -346,6 +381,12 @@ func (pconf *Path) validate(
 			return fmt.Errorf("'%s' is not a valid URL", pconf.Source)
 		}
 
+	case strings.HasPrefix(pconf.Source, "playback://"):
+		pathName, _, _ := strings.Cut(pconf.Source[len("playback://"):], "?")
+		if pathName == "" {
+			return fmt.Errorf("'%s' does not contain a path name", pconf.Source)
+		}
+
 	case pconf.Source == "redirect":
 
 	case pconf.Source == "rpiCamera":
@@ -380,6 +421,76 @@ func (pconf *Path) validate(
 
 	// Record
 
+	if pconf.RecordConvertMPEGTS && pconf.RecordFormat != RecordFormatFMP4 {
+		return fmt.Errorf("'recordConvertMPEGTS' requires 'recordFormat' to be 'fmp4'")
+	}
+
+	if pconf.RecordThinAfter != 0 && pconf.RecordFormat != RecordFormatFMP4 {
+		return fmt.Errorf("'recordThinAfter' requires 'recordFormat' to be 'fmp4'")
+	}
+
+	if pconf.RecordRepair && pconf.RecordFormat != RecordFormatFMP4 {
+		return fmt.Errorf("'recordRepair' requires 'recordFormat' to be 'fmp4'")
+	}
+
+	if pconf.RecordDeleteQuietAfter != 0 && pconf.RecordDeleteAfter != 0 &&
+		pconf.RecordDeleteQuietAfter >= pconf.RecordDeleteAfter {
+		return fmt.Errorf("'recordDeleteQuietAfter' must be less than 'recordDeleteAfter'")
+	}
+
+	if pconf.RecordDeleteSchedule.raw != "" &&
+		pconf.RecordDeleteAfter == 0 && pconf.RecordDeleteQuietAfter == 0 {
+		return fmt.Errorf("'recordDeleteSchedule' requires 'recordDeleteAfter' or 'recordDeleteQuietAfter'")
+	}
+
+	if pconf.RecordArchiveTo != "" {
+		if pconf.RecordDeleteAfter == 0 && pconf.RecordDeleteQuietAfter == 0 {
+			return fmt.Errorf("'recordArchiveTo' requires 'recordDeleteAfter' or 'recordDeleteQuietAfter'")
+		}
+
+		if s3.IsURL(pconf.RecordArchiveTo) {
+			_, err := s3.ParseURL(pconf.RecordArchiveTo)
+			if err != nil {
+				return fmt.Errorf("invalid 'recordArchiveTo': %w", err)
+			}
+		}
+	}
+
+	if pconf.RecordMigrateFrom != "" && pconf.RecordMigrateFrom == pconf.RecordPath {
+		return fmt.Errorf("'recordMigrateFrom' must be different from 'recordPath'")
+	}
+
+	if pconf.RecordMinBitrate < 0 || pconf.RecordMaxBitrate < 0 {
+		return fmt.Errorf("'recordMinBitrate' and 'recordMaxBitrate' must be zero or greater")
+	}
+
+	if pconf.RecordMinBitrate != 0 && pconf.RecordMaxBitrate != 0 && pconf.RecordMinBitrate > pconf.RecordMaxBitrate {
+		return fmt.Errorf("'recordMinBitrate' must not be greater than 'recordMaxBitrate'")
+	}
+
+	if pconf.RecordOnvifEvents != "" {
+		u, err := gourl.Parse(pconf.RecordOnvifEvents)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("'%s' is not a valid ONVIF event service URL", pconf.RecordOnvifEvents)
+		}
+
+		if pconf.RecordOnvifMode == RecordOnvifModeTag && pconf.RecordIndexPath == "" {
+			return fmt.Errorf("'recordOnvifMode' = 'tag' requires 'recordIndexPath'")
+		}
+	}
+
+	if pconf.PlaybackMaxDuration < 0 {
+		return fmt.Errorf("'playbackMaxDuration' must be zero or greater")
+	}
+
+	if pconf.PlaybackMaxConcurrentMuxers < 0 {
+		return fmt.Errorf("'playbackMaxConcurrentMuxers' must be zero or greater")
+	}
+
+	if pconf.PlaybackMaxReaders < 0 {
+		return fmt.Errorf("'playbackMaxReaders' must be zero or greater")
+	}
+
 	if conf.Playback {
 		if !strings.Contains(pconf.RecordPath, "%Y") ||
 			!strings.Contains(pconf.RecordPath, "%m") ||
@@ -580,6 +691,7 @@ func (pconf Path) HasStaticSource() bool {
 		strings.HasPrefix(pconf.Source, "srt://") ||
 		strings.HasPrefix(pconf.Source, "whep://") ||
 		strings.HasPrefix(pconf.Source, "wheps://") ||
+		strings.HasPrefix(pconf.Source, "playback://") ||
 		pconf.Source == "rpiCamera"
 }
 
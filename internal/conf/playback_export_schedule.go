@@ -0,0 +1,81 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PlaybackExportSchedule is a rule that creates exports periodically,
+// or when an event with a given label is added.
+type PlaybackExportSchedule struct {
+	Schedule CronSchedule `json:"schedule"`
+	Event    string       `json:"event"`
+	Path     string       `json:"path"`
+	// time between the beginning of the exported timespan and the scheduled time or the start of the event
+	Start    StringDuration `json:"start"`
+	Duration StringDuration `json:"duration"`
+	// time between the end of the event and the end of the exported timespan
+	End       StringDuration `json:"end"`
+	Format    string         `json:"format"`
+	Directory string         `json:"directory"`
+	Retries   int            `json:"retries"`
+}
+
+func (s PlaybackExportSchedule) validate() error {
+	// path of event rules is optional, since events of all paths can trigger an export
+	if s.Event != "" {
+		if s.Schedule.raw != "" {
+			return fmt.Errorf("schedule and event cannot be used together")
+		}
+
+		if s.Duration != 0 {
+			return fmt.Errorf("duration cannot be used with event, use end instead")
+		}
+
+		if s.Start < 0 || s.End < 0 {
+			return fmt.Errorf("start and end must be zero or greater")
+		}
+	} else {
+		if s.Schedule.raw == "" {
+			return fmt.Errorf("schedule and event are empty")
+		}
+
+		if s.Path == "" {
+			return fmt.Errorf("path is empty")
+		}
+
+		if s.Duration <= 0 {
+			return fmt.Errorf("duration must be greater than zero")
+		}
+
+		if s.End != 0 {
+			return fmt.Errorf("end can only be used with event")
+		}
+	}
+
+	if s.Format != "" && s.Format != "fmp4" && s.Format != "mp4" && s.Format != "clone" &&
+		s.Format != "static" {
+		return fmt.Errorf("invalid format: %s", s.Format)
+	}
+
+	if s.Directory == "" {
+		return fmt.Errorf("directory is empty")
+	}
+
+	if s.Retries < 0 {
+		return fmt.Errorf("retries must be zero or greater")
+	}
+
+	return nil
+}
+
+// PlaybackExportSchedules is a list of PlaybackExportSchedule.
+type PlaybackExportSchedules []PlaybackExportSchedule
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *PlaybackExportSchedules) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*s = nil
+	return json.Unmarshal(b, (*[]PlaybackExportSchedule)(s))
+}
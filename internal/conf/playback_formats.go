@@ -0,0 +1,60 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PlaybackFormats is the playbackFormats parameter.
+type PlaybackFormats []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *PlaybackFormats) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*d = nil
+
+	for _, v := range in {
+		switch v {
+		case "fmp4", "mp4", "ts", "mkv", "hls", "archive", "clone", "static", "replay":
+			*d = append(*d, v)
+
+		default:
+			return fmt.Errorf("invalid playback format: '%s'", v)
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (d *PlaybackFormats) UnmarshalEnv(_ string, v string) error {
+	if v == "" {
+		*d = nil
+		return nil
+	}
+
+	byts, _ := json.Marshal(strings.Split(v, ","))
+	return d.UnmarshalJSON(byts)
+}
+
+// Contains checks whether a format is allowed. An empty list allows all formats.
+func (d PlaybackFormats) Contains(format string) bool {
+	if len(d) == 0 {
+		return true
+	}
+
+	for _, v := range d {
+		if v == format {
+			return true
+		}
+	}
+
+	return false
+}
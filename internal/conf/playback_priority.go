@@ -0,0 +1,81 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PlaybackPriority is the priority class of a playback request.
+// Lower values have higher priority.
+type PlaybackPriority int
+
+// supported values.
+const (
+	PlaybackPriorityInteractive PlaybackPriority = iota
+	PlaybackPriorityBulk
+	PlaybackPriorityBackup
+)
+
+// String implements fmt.Stringer.
+func (d PlaybackPriority) String() string {
+	switch d {
+	case PlaybackPriorityBulk:
+		return "bulk"
+
+	case PlaybackPriorityBackup:
+		return "backup"
+
+	default:
+		return "interactive"
+	}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d PlaybackPriority) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *PlaybackPriority) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "interactive":
+		*d = PlaybackPriorityInteractive
+
+	case "bulk":
+		*d = PlaybackPriorityBulk
+
+	case "backup":
+		*d = PlaybackPriorityBackup
+
+	default:
+		return fmt.Errorf("invalid playback priority '%s'", in)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (d *PlaybackPriority) UnmarshalEnv(_ string, v string) error {
+	return d.UnmarshalJSON([]byte(`"` + v + `"`))
+}
+
+// PlaybackPriorities is the playbackPriorities parameter.
+// It maps users to the highest priority class they can use.
+type PlaybackPriorities map[string]PlaybackPriority
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (d *PlaybackPriorities) UnmarshalEnv(_ string, v string) error {
+	var in map[string]PlaybackPriority
+	if err := json.Unmarshal([]byte(v), &in); err != nil {
+		return err
+	}
+
+	*d = in
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RecordOnvifMode is the recordOnvifMode parameter.
+type RecordOnvifMode int
+
+// supported values.
+const (
+	RecordOnvifModeTag RecordOnvifMode = iota
+	RecordOnvifModeTrigger
+)
+
+// MarshalJSON implements json.Marshaler.
+func (d RecordOnvifMode) MarshalJSON() ([]byte, error) {
+	var out string
+
+	switch d {
+	case RecordOnvifModeTrigger:
+		out = "trigger"
+
+	default:
+		out = "tag"
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *RecordOnvifMode) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "trigger":
+		*d = RecordOnvifModeTrigger
+
+	case "tag":
+		*d = RecordOnvifModeTag
+
+	default:
+		return fmt.Errorf("invalid record ONVIF mode '%s'", in)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (d *RecordOnvifMode) UnmarshalEnv(_ string, v string) error {
+	return d.UnmarshalJSON([]byte(`"` + v + `"`))
+}
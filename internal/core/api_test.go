@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -1145,3 +1146,69 @@ func TestAPIProtocolKickNotFound(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIPathsGetRecordingsStart(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordings-start")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
+	p, ok := newInstance("api: yes\n" +
+		"paths:\n" +
+		"  all_others:\n" +
+		"    record: yes\n" +
+		"    recordPath: " + filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f") + "\n" +
+		"    recordDeleteAfter: 0s\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	source := gortsplib.Client{}
+	err = source.StartRecording("rtsp://localhost:8554/mypath",
+		&description.Session{Medias: []*description.Media{test.UniqueMediaH264()}})
+	require.NoError(t, err)
+	defer source.Close()
+
+	res, err := hc.Get("http://localhost:9997/v3/paths/get/mypath")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out struct {
+		RecordingsStart *time.Time `json:"recordingsStart"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	require.NoError(t, err)
+
+	expected := time.Date(2008, 11, 7, 11, 22, 0, 500000000, time.Local)
+	require.NotNil(t, out.RecordingsStart)
+	require.True(t, expected.Equal(*out.RecordingsStart))
+	require.Equal(t, expected.Format(time.RFC3339Nano), res.Header.Get("X-Recordings-Start"))
+
+	// segments are not searched when listing paths
+	res2, err := hc.Get("http://localhost:9997/v3/paths/list")
+	require.NoError(t, err)
+	defer res2.Body.Close()
+
+	require.Equal(t, http.StatusOK, res2.StatusCode)
+
+	var list struct {
+		Items []struct {
+			Name            string     `json:"name"`
+			RecordingsStart *time.Time `json:"recordingsStart"`
+		} `json:"items"`
+	}
+	err = json.NewDecoder(res2.Body).Decode(&list)
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	require.Nil(t, list.Items[0].RecordingsStart)
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/metrics"
+	"github.com/bluenviron/mediamtx/internal/notify"
 	"github.com/bluenviron/mediamtx/internal/playback"
 	"github.com/bluenviron/mediamtx/internal/pprof"
 	"github.com/bluenviron/mediamtx/internal/record"
@@ -44,16 +45,11 @@ var defaultConfPaths = []string{
 	"/etc/mediamtx/mediamtx.yml",
 }
 
-func gatherCleanerEntries(paths map[string]*conf.Path) []record.CleanerEntry {
+func gatherCleanerEntries(paths map[string]*conf.Path, annotationsFile string) []record.CleanerEntry {
 	out := make(map[record.CleanerEntry]struct{})
 
 	for _, pa := range paths {
-		if pa.Record && pa.RecordDeleteAfter != 0 {
-			entry := record.CleanerEntry{
-				Path:        pa.RecordPath,
-				Format:      pa.RecordFormat,
-				DeleteAfter: time.Duration(pa.RecordDeleteAfter),
-			}
+		if entry, ok := record.NewCleanerEntry(pa, annotationsFile); ok {
 			out[entry] = struct{}{}
 		}
 	}
@@ -70,12 +66,175 @@ func gatherCleanerEntries(paths map[string]*conf.Path) []record.CleanerEntry {
 		if out2[i].Path != out2[j].Path {
 			return out2[i].Path < out2[j].Path
 		}
-		return out2[i].DeleteAfter < out2[j].DeleteAfter
+		if out2[i].DeleteAfter != out2[j].DeleteAfter {
+			return out2[i].DeleteAfter < out2[j].DeleteAfter
+		}
+		return out2[i].DeleteQuietAfter < out2[j].DeleteQuietAfter
+	})
+
+	return out2
+}
+
+func gatherConverterEntries(paths map[string]*conf.Path) []record.ConverterEntry {
+	out := make(map[record.ConverterEntry]struct{})
+
+	for _, pa := range paths {
+		if pa.RecordConvertMPEGTS {
+			entry := record.ConverterEntry{
+				Path:       pa.RecordPath,
+				IndexPath:  pa.RecordIndexPath,
+				MaxReaders: pa.PlaybackMaxReaders,
+			}
+			out[entry] = struct{}{}
+		}
+	}
+
+	out2 := make([]record.ConverterEntry, len(out))
+	i := 0
+
+	for v := range out {
+		out2[i] = v
+		i++
+	}
+
+	sort.Slice(out2, func(i, j int) bool {
+		if out2[i].Path != out2[j].Path {
+			return out2[i].Path < out2[j].Path
+		}
+		if out2[i].IndexPath != out2[j].IndexPath {
+			return out2[i].IndexPath < out2[j].IndexPath
+		}
+		return out2[i].MaxReaders < out2[j].MaxReaders
+	})
+
+	return out2
+}
+
+func gatherThinnerEntries(paths map[string]*conf.Path) []record.ThinnerEntry {
+	out := make(map[record.ThinnerEntry]struct{})
+
+	for _, pa := range paths {
+		if pa.Record && pa.RecordThinAfter != 0 {
+			entry := record.ThinnerEntry{
+				Path:       pa.RecordPath,
+				ThinAfter:  time.Duration(pa.RecordThinAfter),
+				IndexPath:  pa.RecordIndexPath,
+				MaxReaders: pa.PlaybackMaxReaders,
+			}
+			out[entry] = struct{}{}
+		}
+	}
+
+	out2 := make([]record.ThinnerEntry, len(out))
+	i := 0
+
+	for v := range out {
+		out2[i] = v
+		i++
+	}
+
+	sort.Slice(out2, func(i, j int) bool {
+		if out2[i].Path != out2[j].Path {
+			return out2[i].Path < out2[j].Path
+		}
+		if out2[i].ThinAfter != out2[j].ThinAfter {
+			return out2[i].ThinAfter < out2[j].ThinAfter
+		}
+		if out2[i].IndexPath != out2[j].IndexPath {
+			return out2[i].IndexPath < out2[j].IndexPath
+		}
+		return out2[i].MaxReaders < out2[j].MaxReaders
+	})
+
+	return out2
+}
+
+func gatherMigratorEntries(paths map[string]*conf.Path) []record.MigratorEntry {
+	out := make(map[record.MigratorEntry]struct{})
+
+	for _, pa := range paths {
+		if pa.RecordMigrateFrom != "" {
+			entry := record.MigratorEntry{
+				From:       pa.RecordMigrateFrom,
+				To:         pa.RecordPath,
+				Format:     pa.RecordFormat,
+				IndexPath:  pa.RecordIndexPath,
+				MaxReaders: pa.PlaybackMaxReaders,
+			}
+			out[entry] = struct{}{}
+		}
+	}
+
+	out2 := make([]record.MigratorEntry, len(out))
+	i := 0
+
+	for v := range out {
+		out2[i] = v
+		i++
+	}
+
+	sort.Slice(out2, func(i, j int) bool {
+		if out2[i].From != out2[j].From {
+			return out2[i].From < out2[j].From
+		}
+		if out2[i].To != out2[j].To {
+			return out2[i].To < out2[j].To
+		}
+		if out2[i].Format != out2[j].Format {
+			return out2[i].Format < out2[j].Format
+		}
+		if out2[i].IndexPath != out2[j].IndexPath {
+			return out2[i].IndexPath < out2[j].IndexPath
+		}
+		return out2[i].MaxReaders < out2[j].MaxReaders
 	})
 
 	return out2
 }
 
+func gatherRepairerEntries(paths map[string]*conf.Path) []record.RepairerEntry {
+	out := make(map[record.RepairerEntry]struct{})
+
+	for _, pa := range paths {
+		if pa.Record && pa.RecordRepair {
+			entry := record.RepairerEntry{
+				Path:       pa.RecordPath,
+				IndexPath:  pa.RecordIndexPath,
+				MaxReaders: pa.PlaybackMaxReaders,
+			}
+			out[entry] = struct{}{}
+		}
+	}
+
+	out2 := make([]record.RepairerEntry, len(out))
+	i := 0
+
+	for v := range out {
+		out2[i] = v
+		i++
+	}
+
+	sort.Slice(out2, func(i, j int) bool {
+		if out2[i].Path != out2[j].Path {
+			return out2[i].Path < out2[j].Path
+		}
+		if out2[i].IndexPath != out2[j].IndexPath {
+			return out2[i].IndexPath < out2[j].IndexPath
+		}
+		return out2[i].MaxReaders < out2[j].MaxReaders
+	})
+
+	return out2
+}
+
+func playbackBoxLimits(c *conf.Conf) playback.BoxLimits {
+	return playback.BoxLimits{
+		MaxDepth: c.PlaybackMaxBoxDepth,
+		MaxCount: c.PlaybackMaxBoxCount,
+		MaxSize:  c.PlaybackMaxBoxSize,
+	}
+}
+
 var cli struct {
 	Version  bool   `help:"print version"`
 	Confpath string `arg:"" default:""`
@@ -89,10 +248,16 @@ type Core struct {
 	conf            *conf.Conf
 	logger          *logger.Logger
 	externalCmdPool *externalcmd.Pool
+	notifier        *notify.Notifier
+	recordRegistry  *record.Registry
 	authManager     *auth.Manager
 	metrics         *metrics.Metrics
 	pprof           *pprof.PPROF
 	recordCleaner   *record.Cleaner
+	recordConverter *record.Converter
+	recordMigrator  *record.Migrator
+	recordThinner   *record.Thinner
+	recordRepairer  *record.Repairer
 	playbackServer  *playback.Server
 	pathManager     *pathManager
 	rtspServer      *rtsp.Server
@@ -278,6 +443,15 @@ func (p *Core) createResources(initial bool) error {
 		gin.SetMode(gin.ReleaseMode)
 
 		p.externalCmdPool = externalcmd.NewPool()
+
+		p.notifier = &notify.Notifier{
+			Channels: p.conf.NotificationChannels,
+			Parent:   p,
+		}
+		p.notifier.Initialize()
+
+		p.recordRegistry = &record.Registry{}
+		p.recordRegistry.Initialize()
 	}
 
 	if p.authManager == nil {
@@ -332,35 +506,118 @@ func (p *Core) createResources(initial bool) error {
 		p.pprof = i
 	}
 
-	cleanerEntries := gatherCleanerEntries(p.conf.Paths)
+	// in maintenance mode, files are not deleted or converted, while recording continues.
+	cleanerEntries := gatherCleanerEntries(p.conf.Paths, p.conf.PlaybackAnnotationsFile)
 	if len(cleanerEntries) != 0 &&
+		!p.conf.MaintenanceMode &&
 		p.recordCleaner == nil {
 		p.recordCleaner = &record.Cleaner{
-			Entries: cleanerEntries,
-			Parent:  p,
+			Entries:  cleanerEntries,
+			Registry: p.recordRegistry,
+			Notifier: p.notifier,
+			Parent:   p,
 		}
 		p.recordCleaner.Initialize()
 	}
 
+	converterEntries := gatherConverterEntries(p.conf.Paths)
+	if len(converterEntries) != 0 &&
+		!p.conf.MaintenanceMode &&
+		p.recordConverter == nil {
+		p.recordConverter = &record.Converter{
+			Entries:  converterEntries,
+			Registry: p.recordRegistry,
+			Notifier: p.notifier,
+			Parent:   p,
+		}
+		p.recordConverter.Initialize()
+	}
+
+	migratorEntries := gatherMigratorEntries(p.conf.Paths)
+	if len(migratorEntries) != 0 &&
+		!p.conf.MaintenanceMode &&
+		p.recordMigrator == nil {
+		p.recordMigrator = &record.Migrator{
+			Entries:  migratorEntries,
+			Registry: p.recordRegistry,
+			Parent:   p,
+		}
+		p.recordMigrator.Initialize()
+	}
+
+	thinnerEntries := gatherThinnerEntries(p.conf.Paths)
+	if len(thinnerEntries) != 0 &&
+		!p.conf.MaintenanceMode &&
+		p.recordThinner == nil {
+		p.recordThinner = &record.Thinner{
+			Entries:  thinnerEntries,
+			Registry: p.recordRegistry,
+			Notifier: p.notifier,
+			Parent:   p,
+		}
+		p.recordThinner.Initialize()
+	}
+
+	repairerEntries := gatherRepairerEntries(p.conf.Paths)
+	if len(repairerEntries) != 0 &&
+		!p.conf.MaintenanceMode &&
+		p.recordRepairer == nil {
+		p.recordRepairer = &record.Repairer{
+			Entries:  repairerEntries,
+			Registry: p.recordRegistry,
+			Notifier: p.notifier,
+			Parent:   p,
+		}
+		p.recordRepairer.Initialize()
+	}
+
 	if p.conf.Playback &&
 		p.playbackServer == nil {
 		i := &playback.Server{
-			Address:        p.conf.PlaybackAddress,
-			Encryption:     p.conf.PlaybackEncryption,
-			ServerKey:      p.conf.PlaybackServerKey,
-			ServerCert:     p.conf.PlaybackServerCert,
-			AllowOrigin:    p.conf.PlaybackAllowOrigin,
-			TrustedProxies: p.conf.PlaybackTrustedProxies,
-			ReadTimeout:    p.conf.ReadTimeout,
-			PathConfs:      p.conf.Paths,
-			AuthManager:    p.authManager,
-			Parent:         p,
+			Address:                p.conf.PlaybackAddress,
+			Encryption:             p.conf.PlaybackEncryption,
+			ServerKey:              p.conf.PlaybackServerKey,
+			ServerCert:             p.conf.PlaybackServerCert,
+			AllowOrigin:            p.conf.PlaybackAllowOrigin,
+			TrustedProxies:         p.conf.PlaybackTrustedProxies,
+			Peers:                  p.conf.PlaybackPeers,
+			ExportPath:             p.conf.PlaybackExportPath,
+			ExportSigningKey:       p.conf.PlaybackExportSigningKey,
+			ShareLinksFile:         p.conf.PlaybackShareLinksFile,
+			PrivacyFile:            p.conf.PlaybackPrivacyFile,
+			AnnotationsFile:        p.conf.PlaybackAnnotationsFile,
+			DailyQuota:             p.conf.PlaybackDailyQuota,
+			MonthlyQuota:           p.conf.PlaybackMonthlyQuota,
+			HLSEncryption:          p.conf.PlaybackHLSEncryption,
+			Headers:                p.conf.PlaybackHeaders,
+			TempDir:                p.conf.PlaybackTempDir,
+			MemoryLimit:            p.conf.PlaybackMemoryLimit,
+			MaxImportSize:          p.conf.PlaybackMaxImportSize,
+			MaxConcurrentDownloads: p.conf.PlaybackMaxConcurrentDownloads,
+			MaxConcurrentMuxers:    p.conf.PlaybackMaxConcurrentMuxers,
+			MaxBoxDepth:            p.conf.PlaybackMaxBoxDepth,
+			MaxBoxCount:            p.conf.PlaybackMaxBoxCount,
+			MaxBoxSize:             p.conf.PlaybackMaxBoxSize,
+			Priorities:             p.conf.PlaybackPriorities,
+			ExportSchedules:        p.conf.PlaybackExportSchedules,
+			AccessLogLevel:         p.conf.PlaybackAccessLogLevel,
+			ReadTimeout:            p.conf.ReadTimeout,
+			MaintenanceMode:        p.conf.MaintenanceMode,
+			PathConfs:              p.conf.Paths,
+			AuthManager:            p.authManager,
+			Registry:               p.recordRegistry,
+			Notifier:               p.notifier,
+			Parent:                 p,
 		}
 		err = i.Initialize()
 		if err != nil {
 			return err
 		}
 		p.playbackServer = i
+
+		if p.metrics != nil {
+			p.metrics.SetPlaybackServer(p.playbackServer)
+		}
 	}
 
 	if p.pathManager == nil {
@@ -374,6 +631,9 @@ func (p *Core) createResources(initial bool) error {
 			udpMaxPayloadSize: p.conf.UDPMaxPayloadSize,
 			pathConfs:         p.conf.Paths,
 			externalCmdPool:   p.externalCmdPool,
+			recordRegistry:    p.recordRegistry,
+			playbackBoxLimits: playbackBoxLimits(p.conf),
+			notifier:          p.notifier,
 			parent:            p,
 		}
 		p.pathManager.initialize()
@@ -396,6 +656,7 @@ func (p *Core) createResources(initial bool) error {
 			ReadTimeout:         p.conf.ReadTimeout,
 			WriteTimeout:        p.conf.WriteTimeout,
 			WriteQueueSize:      p.conf.WriteQueueSize,
+			UDPMaxPayloadSize:   p.conf.UDPMaxPayloadSize,
 			UseUDP:              useUDP,
 			UseMulticast:        useMulticast,
 			RTPAddress:          p.conf.RTPAddress,
@@ -412,6 +673,8 @@ func (p *Core) createResources(initial bool) error {
 			RunOnConnectRestart: p.conf.RunOnConnectRestart,
 			RunOnDisconnect:     p.conf.RunOnDisconnect,
 			ExternalCmdPool:     p.externalCmdPool,
+			RecordRegistry:      p.recordRegistry,
+			PlaybackBoxLimits:   playbackBoxLimits(p.conf),
 			PathManager:         p.pathManager,
 			Parent:              p,
 		}
@@ -436,6 +699,7 @@ func (p *Core) createResources(initial bool) error {
 			ReadTimeout:         p.conf.ReadTimeout,
 			WriteTimeout:        p.conf.WriteTimeout,
 			WriteQueueSize:      p.conf.WriteQueueSize,
+			UDPMaxPayloadSize:   p.conf.UDPMaxPayloadSize,
 			UseUDP:              false,
 			UseMulticast:        false,
 			RTPAddress:          "",
@@ -452,6 +716,8 @@ func (p *Core) createResources(initial bool) error {
 			RunOnConnectRestart: p.conf.RunOnConnectRestart,
 			RunOnDisconnect:     p.conf.RunOnDisconnect,
 			ExternalCmdPool:     p.externalCmdPool,
+			RecordRegistry:      p.recordRegistry,
+			PlaybackBoxLimits:   playbackBoxLimits(p.conf),
 			PathManager:         p.pathManager,
 			Parent:              p,
 		}
@@ -610,6 +876,8 @@ func (p *Core) createResources(initial bool) error {
 			RunOnConnectRestart: p.conf.RunOnConnectRestart,
 			RunOnDisconnect:     p.conf.RunOnDisconnect,
 			ExternalCmdPool:     p.externalCmdPool,
+			RecordRegistry:      p.recordRegistry,
+			PlaybackBoxLimits:   playbackBoxLimits(p.conf),
 			PathManager:         p.pathManager,
 			Parent:              p,
 		}
@@ -644,6 +912,8 @@ func (p *Core) createResources(initial bool) error {
 			HLSServer:      p.hlsServer,
 			WebRTCServer:   p.webRTCServer,
 			SRTServer:      p.srtServer,
+			Registry:       p.recordRegistry,
+			Notifier:       p.notifier,
 			Parent:         p,
 		}
 		err = i.Initialize()
@@ -705,7 +975,28 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		closeLogger
 
 	closeRecorderCleaner := newConf == nil ||
-		!reflect.DeepEqual(gatherCleanerEntries(newConf.Paths), gatherCleanerEntries(p.conf.Paths)) ||
+		!reflect.DeepEqual(gatherCleanerEntries(newConf.Paths, newConf.PlaybackAnnotationsFile), gatherCleanerEntries(p.conf.Paths, p.conf.PlaybackAnnotationsFile)) ||
+		newConf.MaintenanceMode != p.conf.MaintenanceMode ||
+		closeLogger
+
+	closeRecordConverter := newConf == nil ||
+		!reflect.DeepEqual(gatherConverterEntries(newConf.Paths), gatherConverterEntries(p.conf.Paths)) ||
+		newConf.MaintenanceMode != p.conf.MaintenanceMode ||
+		closeLogger
+
+	closeRecordMigrator := newConf == nil ||
+		!reflect.DeepEqual(gatherMigratorEntries(newConf.Paths), gatherMigratorEntries(p.conf.Paths)) ||
+		newConf.MaintenanceMode != p.conf.MaintenanceMode ||
+		closeLogger
+
+	closeRecordThinner := newConf == nil ||
+		!reflect.DeepEqual(gatherThinnerEntries(newConf.Paths), gatherThinnerEntries(p.conf.Paths)) ||
+		newConf.MaintenanceMode != p.conf.MaintenanceMode ||
+		closeLogger
+
+	closeRecordRepairer := newConf == nil ||
+		!reflect.DeepEqual(gatherRepairerEntries(newConf.Paths), gatherRepairerEntries(p.conf.Paths)) ||
+		newConf.MaintenanceMode != p.conf.MaintenanceMode ||
 		closeLogger
 
 	closePlaybackServer := newConf == nil ||
@@ -716,12 +1007,37 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.PlaybackServerCert != p.conf.PlaybackServerCert ||
 		newConf.PlaybackAllowOrigin != p.conf.PlaybackAllowOrigin ||
 		!reflect.DeepEqual(newConf.PlaybackTrustedProxies, p.conf.PlaybackTrustedProxies) ||
+		!reflect.DeepEqual(newConf.PlaybackPeers, p.conf.PlaybackPeers) ||
+		newConf.PlaybackExportPath != p.conf.PlaybackExportPath ||
+		newConf.PlaybackExportSigningKey != p.conf.PlaybackExportSigningKey ||
+		newConf.PlaybackShareLinksFile != p.conf.PlaybackShareLinksFile ||
+		newConf.PlaybackPrivacyFile != p.conf.PlaybackPrivacyFile ||
+		newConf.PlaybackAnnotationsFile != p.conf.PlaybackAnnotationsFile ||
+		newConf.PlaybackDailyQuota != p.conf.PlaybackDailyQuota ||
+		newConf.PlaybackMonthlyQuota != p.conf.PlaybackMonthlyQuota ||
+		newConf.PlaybackHLSEncryption != p.conf.PlaybackHLSEncryption ||
+		!reflect.DeepEqual(newConf.PlaybackHeaders, p.conf.PlaybackHeaders) ||
+		newConf.PlaybackTempDir != p.conf.PlaybackTempDir ||
+		newConf.PlaybackMemoryLimit != p.conf.PlaybackMemoryLimit ||
+		newConf.PlaybackMaxImportSize != p.conf.PlaybackMaxImportSize ||
+		newConf.PlaybackMaxConcurrentDownloads != p.conf.PlaybackMaxConcurrentDownloads ||
+		newConf.PlaybackMaxConcurrentMuxers != p.conf.PlaybackMaxConcurrentMuxers ||
+		newConf.PlaybackMaxBoxDepth != p.conf.PlaybackMaxBoxDepth ||
+		newConf.PlaybackMaxBoxCount != p.conf.PlaybackMaxBoxCount ||
+		newConf.PlaybackMaxBoxSize != p.conf.PlaybackMaxBoxSize ||
+		!reflect.DeepEqual(newConf.PlaybackPriorities, p.conf.PlaybackPriorities) ||
+		!reflect.DeepEqual(newConf.PlaybackExportSchedules, p.conf.PlaybackExportSchedules) ||
+		newConf.PlaybackAccessLogLevel != p.conf.PlaybackAccessLogLevel ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		closeMetrics ||
 		closeAuthManager ||
 		closeLogger
 	if !closePlaybackServer && p.playbackServer != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
 		p.playbackServer.ReloadPathConfs(newConf.Paths)
 	}
+	if !closePlaybackServer && p.playbackServer != nil && newConf.MaintenanceMode != p.conf.MaintenanceMode {
+		p.playbackServer.ReloadMaintenanceMode(newConf.MaintenanceMode)
+	}
 
 	closePathManager := newConf == nil ||
 		newConf.LogLevel != p.conf.LogLevel ||
@@ -731,6 +1047,9 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
 		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
+		newConf.PlaybackMaxBoxDepth != p.conf.PlaybackMaxBoxDepth ||
+		newConf.PlaybackMaxBoxCount != p.conf.PlaybackMaxBoxCount ||
+		newConf.PlaybackMaxBoxSize != p.conf.PlaybackMaxBoxSize ||
 		closeMetrics ||
 		closeAuthManager ||
 		closeLogger
@@ -746,6 +1065,10 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
+		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
+		newConf.PlaybackMaxBoxDepth != p.conf.PlaybackMaxBoxDepth ||
+		newConf.PlaybackMaxBoxCount != p.conf.PlaybackMaxBoxCount ||
+		newConf.PlaybackMaxBoxSize != p.conf.PlaybackMaxBoxSize ||
 		!reflect.DeepEqual(newConf.Protocols, p.conf.Protocols) ||
 		newConf.RTPAddress != p.conf.RTPAddress ||
 		newConf.RTCPAddress != p.conf.RTCPAddress ||
@@ -769,6 +1092,10 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
+		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
+		newConf.PlaybackMaxBoxDepth != p.conf.PlaybackMaxBoxDepth ||
+		newConf.PlaybackMaxBoxCount != p.conf.PlaybackMaxBoxCount ||
+		newConf.PlaybackMaxBoxSize != p.conf.PlaybackMaxBoxSize ||
 		newConf.ServerCert != p.conf.ServerCert ||
 		newConf.ServerKey != p.conf.ServerKey ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
@@ -864,6 +1191,9 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
 		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
+		newConf.PlaybackMaxBoxDepth != p.conf.PlaybackMaxBoxDepth ||
+		newConf.PlaybackMaxBoxCount != p.conf.PlaybackMaxBoxCount ||
+		newConf.PlaybackMaxBoxSize != p.conf.PlaybackMaxBoxSize ||
 		newConf.RunOnConnect != p.conf.RunOnConnect ||
 		newConf.RunOnConnectRestart != p.conf.RunOnConnectRestart ||
 		newConf.RunOnDisconnect != p.conf.RunOnDisconnect ||
@@ -978,6 +1308,10 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 	}
 
 	if closePlaybackServer && p.playbackServer != nil {
+		if p.metrics != nil {
+			p.metrics.SetPlaybackServer(nil)
+		}
+
 		p.playbackServer.Close()
 		p.playbackServer = nil
 	}
@@ -987,6 +1321,26 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.recordCleaner = nil
 	}
 
+	if closeRecordConverter && p.recordConverter != nil {
+		p.recordConverter.Close()
+		p.recordConverter = nil
+	}
+
+	if closeRecordMigrator && p.recordMigrator != nil {
+		p.recordMigrator.Close()
+		p.recordMigrator = nil
+	}
+
+	if closeRecordThinner && p.recordThinner != nil {
+		p.recordThinner.Close()
+		p.recordThinner = nil
+	}
+
+	if closeRecordRepairer && p.recordRepairer != nil {
+		p.recordRepairer.Close()
+		p.recordRepairer = nil
+	}
+
 	if closePPROF && p.pprof != nil {
 		p.pprof.Close()
 		p.pprof = nil
@@ -1006,6 +1360,14 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.externalCmdPool.Close()
 	}
 
+	if p.notifier != nil {
+		if newConf == nil {
+			p.notifier.Close()
+		} else if !reflect.DeepEqual(newConf.NotificationChannels, p.conf.NotificationChannels) {
+			p.notifier.ReloadChannels(newConf.NotificationChannels)
+		}
+	}
+
 	if closeLogger && p.logger != nil {
 		p.logger.Close()
 		p.logger = nil
@@ -17,6 +17,9 @@ import (
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/hooks"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
+	"github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/protocols/onvif"
 	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
@@ -32,6 +35,7 @@ type pathParent interface {
 	pathReady(*path)
 	pathNotReady(*path)
 	closePath(*path)
+	FindPathConf(req defs.PathFindPathConfReq) (*conf.Path, error)
 }
 
 type pathOnDemandState int
@@ -54,13 +58,20 @@ type pathAPIPathsListReq struct {
 
 type pathAPIPathsGetRes struct {
 	path *path
+	conf *conf.Path
 	data *defs.APIPath
 	err  error
 }
 
 type pathAPIPathsGetReq struct {
 	name string
-	res  chan pathAPIPathsGetRes
+
+	// whether to fill the start of recordings, that requires searching segments.
+	// It is filled by /v3/paths/get only, in order not to search the segments of all paths
+	// on every list request and metrics scrape.
+	withRecordingsStart bool
+
+	res chan pathAPIPathsGetRes
 }
 
 type path struct {
@@ -77,6 +88,9 @@ type path struct {
 	matches           []string
 	wg                *sync.WaitGroup
 	externalCmdPool   *externalcmd.Pool
+	recordRegistry    *record.Registry
+	playbackBoxLimits playback.BoxLimits
+	notifier          *notify.Notifier
 	parent            pathParent
 
 	ctx                            context.Context
@@ -98,6 +112,11 @@ type path struct {
 	onDemandPublisherState         pathOnDemandState
 	onDemandPublisherReadyTimer    *time.Timer
 	onDemandPublisherCloseTimer    *time.Timer
+	onvifEvents                    *onvif.EventClient
+	motionActive                   bool
+	motionStart                    time.Time
+	motionRecording                bool
+	motionStopTimer                *time.Timer
 
 	// in
 	chReloadConf              chan *conf.Path
@@ -111,6 +130,7 @@ type path struct {
 	chAddReader               chan defs.PathAddReaderReq
 	chRemoveReader            chan defs.PathRemoveReaderReq
 	chAPIPathsGet             chan pathAPIPathsGetReq
+	chMotion                  chan bool
 
 	// out
 	done chan struct{}
@@ -126,6 +146,7 @@ func (pa *path) initialize() {
 	pa.onDemandStaticSourceCloseTimer = emptyTimer()
 	pa.onDemandPublisherReadyTimer = emptyTimer()
 	pa.onDemandPublisherCloseTimer = emptyTimer()
+	pa.motionStopTimer = emptyTimer()
 	pa.chReloadConf = make(chan *conf.Path)
 	pa.chStaticSourceSetReady = make(chan defs.PathSourceStaticSetReadyReq)
 	pa.chStaticSourceSetNotReady = make(chan defs.PathSourceStaticSetNotReadyReq)
@@ -137,6 +158,7 @@ func (pa *path) initialize() {
 	pa.chAddReader = make(chan defs.PathAddReaderReq)
 	pa.chRemoveReader = make(chan defs.PathRemoveReaderReq)
 	pa.chAPIPathsGet = make(chan pathAPIPathsGetReq)
+	pa.chMotion = make(chan bool)
 	pa.done = make(chan struct{})
 
 	pa.Log(logger.Debug, "created")
@@ -170,13 +192,16 @@ func (pa *path) run() {
 		pa.source = &sourceRedirect{}
 	} else if pa.conf.HasStaticSource() {
 		pa.source = &staticSourceHandler{
-			conf:           pa.conf,
-			logLevel:       pa.logLevel,
-			readTimeout:    pa.readTimeout,
-			writeTimeout:   pa.writeTimeout,
-			writeQueueSize: pa.writeQueueSize,
-			matches:        pa.matches,
-			parent:         pa,
+			conf:              pa.conf,
+			logLevel:          pa.logLevel,
+			readTimeout:       pa.readTimeout,
+			writeTimeout:      pa.writeTimeout,
+			writeQueueSize:    pa.writeQueueSize,
+			matches:           pa.matches,
+			pathManager:       pa.parent,
+			recordRegistry:    pa.recordRegistry,
+			playbackBoxLimits: pa.playbackBoxLimits,
+			parent:            pa,
 		}
 		pa.source.(*staticSourceHandler).initialize()
 
@@ -185,6 +210,24 @@ func (pa *path) run() {
 		}
 	}
 
+	if pa.conf.RecordOnvifEvents != "" {
+		pa.onvifEvents = &onvif.EventClient{
+			URL: pa.conf.RecordOnvifEvents,
+			OnMotion: func(active bool) {
+				select {
+				case pa.chMotion <- active:
+				case <-pa.ctx.Done():
+				}
+			},
+			Parent: pa,
+		}
+		err := pa.onvifEvents.Initialize()
+		if err != nil {
+			pa.Log(logger.Error, "unable to subscribe to ONVIF events: %v", err)
+			pa.onvifEvents = nil
+		}
+	}
+
 	onUnInitHook := hooks.OnInit(hooks.OnInitParams{
 		Logger:          pa,
 		ExternalCmdPool: pa.externalCmdPool,
@@ -203,6 +246,15 @@ func (pa *path) run() {
 	pa.onDemandStaticSourceCloseTimer.Stop()
 	pa.onDemandPublisherReadyTimer.Stop()
 	pa.onDemandPublisherCloseTimer.Stop()
+	pa.motionStopTimer.Stop()
+
+	if pa.onvifEvents != nil {
+		pa.onvifEvents.Close()
+	}
+
+	if pa.motionActive {
+		pa.writeMotion()
+	}
 
 	onUnInitHook()
 
@@ -262,6 +314,12 @@ func (pa *path) runInner() error {
 		case <-pa.onDemandPublisherCloseTimer.C:
 			pa.doOnDemandPublisherCloseTimer()
 
+		case active := <-pa.chMotion:
+			pa.doMotion(active)
+
+		case <-pa.motionStopTimer.C:
+			pa.doMotionStopTimer()
+
 		case newConf := <-pa.chReloadConf:
 			pa.doReloadConf(newConf)
 
@@ -358,6 +416,70 @@ func (pa *path) doOnDemandPublisherCloseTimer() {
 	pa.onDemandPublisherStop("not needed by anyone")
 }
 
+func (pa *path) doMotion(active bool) {
+	if active == pa.motionActive {
+		return
+	}
+	pa.motionActive = active
+
+	if active {
+		pa.Log(logger.Debug, "motion started")
+		pa.motionStart = time.Now()
+	} else {
+		pa.Log(logger.Debug, "motion stopped")
+		pa.writeMotion()
+	}
+
+	if pa.conf.RecordOnvifMode != conf.RecordOnvifModeTrigger {
+		return
+	}
+
+	if active {
+		pa.motionStopTimer.Stop()
+		pa.motionStopTimer = emptyTimer()
+		pa.motionRecording = true
+
+		if pa.conf.Record && pa.stream != nil && pa.recordAgent == nil {
+			pa.startRecording()
+		}
+	} else {
+		pa.motionStopTimer.Stop()
+		pa.motionStopTimer = time.NewTimer(time.Duration(pa.conf.RecordOnvifPostDuration))
+	}
+}
+
+func (pa *path) doMotionStopTimer() {
+	pa.motionRecording = false
+
+	if pa.recordAgent != nil {
+		pa.recordAgent.Close()
+		pa.recordAgent = nil
+	}
+}
+
+// writeMotion stores the motion interval that has just ended into the index directory.
+func (pa *path) writeMotion() {
+	if pa.conf.RecordIndexPath == "" {
+		return
+	}
+
+	err := record.MotionAdd(pa.conf.RecordIndexPath, pa.name, []record.MotionEntry{{
+		Start:    pa.motionStart,
+		Duration: time.Since(pa.motionStart),
+		Score:    1,
+	}})
+	if err != nil {
+		pa.Log(logger.Warn, "unable to write motion: %v", err)
+	}
+}
+
+// shouldRecord returns whether the stream has to be recorded.
+func (pa *path) shouldRecord() bool {
+	return pa.conf.Record &&
+		(pa.conf.RecordOnvifMode != conf.RecordOnvifModeTrigger || pa.conf.RecordOnvifEvents == "" ||
+			pa.motionRecording)
+}
+
 func (pa *path) doReloadConf(newConf *conf.Path) {
 	pa.confMutex.Lock()
 	pa.conf = newConf
@@ -367,7 +489,7 @@ func (pa *path) doReloadConf(newConf *conf.Path) {
 		pa.source.(*staticSourceHandler).reloadConf(newConf)
 	}
 
-	if pa.conf.Record {
+	if pa.shouldRecord() {
 		if pa.stream != nil && pa.recordAgent == nil {
 			pa.startRecording()
 		}
@@ -570,6 +692,7 @@ func (pa *path) doRemoveReader(req defs.PathRemoveReaderReq) {
 
 func (pa *path) doAPIPathsGet(req pathAPIPathsGetReq) {
 	req.res <- pathAPIPathsGetRes{
+		conf: pa.conf,
 		data: &defs.APIPath{
 			Name:     pa.name,
 			ConfName: pa.confName,
@@ -721,7 +844,7 @@ func (pa *path) setReady(desc *description.Session, allocateEncoder bool) error
 		return err
 	}
 
-	if pa.conf.Record {
+	if pa.shouldRecord() {
 		pa.startRecording()
 	}
 
@@ -784,7 +907,15 @@ func (pa *path) startRecording() {
 		PartDuration:    time.Duration(pa.conf.RecordPartDuration),
 		SegmentDuration: time.Duration(pa.conf.RecordSegmentDuration),
 		PathName:        pa.name,
+		IndexPath:       pa.conf.RecordIndexPath,
+		Checksum:        pa.conf.RecordChecksum,
+		MinBitrate:      pa.conf.RecordMinBitrate,
+		MaxBitrate:      pa.conf.RecordMaxBitrate,
+		MirrorPath:      pa.conf.RecordMirrorPath,
+		MaxReaders:      pa.conf.PlaybackMaxReaders,
 		Stream:          pa.stream,
+		Registry:        pa.recordRegistry,
+		Notifier:        pa.notifier,
 		OnSegmentCreate: func(segmentPath string) {
 			if pa.conf.RunOnRecordSegmentCreate != "" {
 				env := pa.ExternalCmdEnv()
@@ -799,11 +930,18 @@ func (pa *path) startRecording() {
 					nil)
 			}
 		},
-		OnSegmentComplete: func(segmentPath string, segmentDuration time.Duration) {
+		OnSegmentComplete: func(segmentPath string, info record.SegmentInfo) {
 			if pa.conf.RunOnRecordSegmentComplete != "" {
 				env := pa.ExternalCmdEnv()
 				env["MTX_SEGMENT_PATH"] = segmentPath
-				env["MTX_SEGMENT_DURATION"] = strconv.FormatFloat(segmentDuration.Seconds(), 'f', -1, 64)
+				env["MTX_SEGMENT_DURATION"] = strconv.FormatFloat(info.Duration.Seconds(), 'f', -1, 64)
+				env["MTX_SEGMENT_SIZE"] = strconv.FormatInt(info.Size, 10)
+				env["MTX_SEGMENT_KEYFRAME_COUNT"] = strconv.FormatInt(int64(info.KeyframeCount), 10)
+				env["MTX_SEGMENT_CODECS"] = strings.Join(info.Codecs, ",")
+				if info.KeyframeCount != 0 {
+					env["MTX_SEGMENT_FIRST_KEYFRAME"] = info.FirstKeyframe.Format(time.RFC3339Nano)
+					env["MTX_SEGMENT_LAST_KEYFRAME"] = info.LastKeyframe.Format(time.RFC3339Nano)
+				}
 
 				pa.Log(logger.Info, "runOnRecordSegmentComplete command launched")
 				externalcmd.NewCmd(
@@ -991,9 +1129,29 @@ func (pa *path) APIPathsGet(req pathAPIPathsGetReq) (*defs.APIPath, error) {
 	select {
 	case pa.chAPIPathsGet <- req:
 		res := <-req.res
-		return res.data, res.err
+		if res.err != nil {
+			return nil, res.err
+		}
+
+		// segments are searched outside of the path loop, since it involves disk access
+		if req.withRecordingsStart && res.conf.Record {
+			res.data.RecordingsStart = recordingsStart(res.conf, pa.name, pa.recordRegistry)
+		}
+
+		return res.data, nil
 
 	case <-pa.ctx.Done():
 		return nil, fmt.Errorf("terminated")
 	}
 }
+
+// recordingsStart returns the start of the oldest recording of a path, if any.
+func recordingsStart(pathConf *conf.Path, pathName string, registry *record.Registry) *time.Time {
+	segments, err := playback.FindSegments(pathConf, pathName, registry)
+	if err != nil || len(segments) == 0 {
+		return nil
+	}
+
+	v := segments[0].Start
+	return &v
+}
@@ -11,6 +11,9 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
+	"github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
@@ -57,6 +60,9 @@ type pathManager struct {
 	udpMaxPayloadSize int
 	pathConfs         map[string]*conf.Path
 	externalCmdPool   *externalcmd.Pool
+	recordRegistry    *record.Registry
+	playbackBoxLimits playback.BoxLimits
+	notifier          *notify.Notifier
 	parent            pathManagerParent
 
 	ctx         context.Context
@@ -236,10 +242,23 @@ func (pm *pathManager) doFindPathConf(req defs.PathFindPathConfReq) {
 		return
 	}
 
-	err = pm.authManager.Authenticate(req.AccessRequest.ToAuthRequest())
-	if err != nil {
-		req.Res <- defs.PathFindPathConfRes{Err: err}
-		return
+	if !req.AccessRequest.SkipAuth {
+		authReq := req.AccessRequest.ToAuthRequest()
+		err = pm.authManager.Authenticate(authReq)
+		if err != nil {
+			req.Res <- defs.PathFindPathConfRes{Err: err}
+			return
+		}
+
+		if req.MaxLookback != nil {
+			*req.MaxLookback = authReq.MaxLookback
+		}
+
+		if req.Privileged != nil {
+			privReq := *authReq
+			privReq.Action = conf.AuthActionAPI
+			*req.Privileged = pm.authManager.Authenticate(&privReq) == nil
+		}
 	}
 
 	req.Res <- defs.PathFindPathConfRes{Conf: pathConf}
@@ -352,6 +371,9 @@ func (pm *pathManager) createPath(
 		matches:           matches,
 		wg:                &pm.wg,
 		externalCmdPool:   pm.externalCmdPool,
+		recordRegistry:    pm.recordRegistry,
+		playbackBoxLimits: pm.playbackBoxLimits,
+		notifier:          pm.notifier,
 		parent:            pm,
 	}
 	pa.initialize()
@@ -520,8 +542,9 @@ func (pm *pathManager) APIPathsList() (*defs.APIPathList, error) {
 // APIPathsGet is called by api.
 func (pm *pathManager) APIPathsGet(name string) (*defs.APIPath, error) {
 	req := pathAPIPathsGetReq{
-		name: name,
-		res:  make(chan pathAPIPathsGetRes),
+		name:                name,
+		withRecordingsStart: true,
+		res:                 make(chan pathAPIPathsGetRes),
 	}
 
 	select {
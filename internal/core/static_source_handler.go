@@ -10,7 +10,10 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/record"
 	hlssource "github.com/bluenviron/mediamtx/internal/staticsources/hls"
+	playbacksource "github.com/bluenviron/mediamtx/internal/staticsources/playback"
 	rpicamerasource "github.com/bluenviron/mediamtx/internal/staticsources/rpicamera"
 	rtmpsource "github.com/bluenviron/mediamtx/internal/staticsources/rtmp"
 	rtspsource "github.com/bluenviron/mediamtx/internal/staticsources/rtsp"
@@ -41,15 +44,22 @@ type staticSourceHandlerParent interface {
 	staticSourceHandlerSetNotReady(context.Context, defs.PathSourceStaticSetNotReadyReq)
 }
 
+type staticSourceHandlerPathManager interface {
+	FindPathConf(req defs.PathFindPathConfReq) (*conf.Path, error)
+}
+
 // staticSourceHandler is a static source handler.
 type staticSourceHandler struct {
-	conf           *conf.Path
-	logLevel       conf.LogLevel
-	readTimeout    conf.StringDuration
-	writeTimeout   conf.StringDuration
-	writeQueueSize int
-	matches        []string
-	parent         staticSourceHandlerParent
+	conf              *conf.Path
+	logLevel          conf.LogLevel
+	readTimeout       conf.StringDuration
+	writeTimeout      conf.StringDuration
+	writeQueueSize    int
+	matches           []string
+	pathManager       staticSourceHandlerPathManager
+	recordRegistry    *record.Registry
+	playbackBoxLimits playback.BoxLimits
+	parent            staticSourceHandlerParent
 
 	ctx       context.Context
 	ctxCancel func()
@@ -115,6 +125,14 @@ func (s *staticSourceHandler) initialize() {
 			Parent:      s,
 		}
 
+	case strings.HasPrefix(s.conf.Source, "playback://"):
+		s.instance = &playbacksource.Source{
+			PathManager: s.pathManager,
+			Registry:    s.recordRegistry,
+			BoxLimits:   s.playbackBoxLimits,
+			Parent:      s,
+		}
+
 	case s.conf.Source == "rpiCamera":
 		s.instance = &rpicamerasource.Source{
 			LogLevel: s.logLevel,
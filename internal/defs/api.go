@@ -37,6 +37,9 @@ type APIPath struct {
 	BytesReceived uint64                  `json:"bytesReceived"`
 	BytesSent     uint64                  `json:"bytesSent"`
 	Readers       []APIPathSourceOrReader `json:"readers"`
+
+	// start of the oldest recording, that is the beginning of the seekable range
+	RecordingsStart *time.Time `json:"recordingsStart"`
 }
 
 // APIPathList is a list of paths.
@@ -332,3 +335,113 @@ type APIRecordingList struct {
 	PageCount int             `json:"pageCount"`
 	Items     []*APIRecording `json:"items"`
 }
+
+// APIRecordingCleanupSegment is a segment removed by a cleanup.
+type APIRecordingCleanupSegment struct {
+	Start time.Time `json:"start"`
+	File  string    `json:"file"`
+}
+
+// APIRecordingCleanup is the result of a cleanup.
+type APIRecordingCleanup struct {
+	DryRun   bool                          `json:"dryRun"`
+	Segments []*APIRecordingCleanupSegment `json:"segments"`
+}
+
+// APIRecordingRepairSegment is a truncated segment found by a repair.
+type APIRecordingRepairSegment struct {
+	Start        time.Time `json:"start"`
+	File         string    `json:"file"`
+	Size         int64     `json:"size"`
+	RepairedSize int64     `json:"repairedSize"`
+	Duration     float64   `json:"duration"`
+	Removed      bool      `json:"removed"`
+}
+
+// APIRecordingRepair is the result of a repair.
+type APIRecordingRepair struct {
+	DryRun   bool                         `json:"dryRun"`
+	Segments []*APIRecordingRepairSegment `json:"segments"`
+}
+
+// APIRecordingDuplicate is a segment whose content has been recorded into another path too.
+type APIRecordingDuplicate struct {
+	Path        string    `json:"path"`
+	Start       time.Time `json:"start"`
+	Duration    float64   `json:"duration"`
+	Size        int64     `json:"size"`
+	DuplicateOf string    `json:"duplicateOf"`
+	Similarity  float64   `json:"similarity"`
+}
+
+// APIRecordingDuplicateList is a list of duplicated segments.
+type APIRecordingDuplicateList struct {
+	ItemCount int                      `json:"itemCount"`
+	PageCount int                      `json:"pageCount"`
+	Items     []*APIRecordingDuplicate `json:"items"`
+}
+
+// APIRecordingIndexEntry is an entry of the index of a path.
+type APIRecordingIndexEntry struct {
+	Seq           int64     `json:"seq"`
+	ID            string    `json:"id"`
+	Start         time.Time `json:"start"`
+	Duration      float64   `json:"duration"`
+	File          string    `json:"file"`
+	Codecs        []string  `json:"codecs"`
+	Thinned       bool      `json:"thinned"`
+	Discontinuity string    `json:"discontinuity"`
+	Removed       bool      `json:"removed"`
+}
+
+// APIRecordingIndexChanges is a list of entries that have been added to the index of a path
+// after a certain sequence number.
+type APIRecordingIndexChanges struct {
+	Path string `json:"path"`
+	// sequence number to use in the next request
+	Seq     int64                     `json:"seq"`
+	Entries []*APIRecordingIndexEntry `json:"entries"`
+}
+
+// APISegment is a recording segment, with details read from its content.
+type APISegment struct {
+	ID       string    `json:"id"`
+	Path     string    `json:"path"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+	Size     int64     `json:"size"`
+	Codecs   []string  `json:"codecs"`
+	Indexed  bool      `json:"indexed"`
+}
+
+// APIPlaybackRequests is the number of requests received by the playback server
+// with the same route, format and status code.
+type APIPlaybackRequests struct {
+	Route  string `json:"route"`
+	Format string `json:"format"`
+	Status int    `json:"status"`
+	Count  uint64 `json:"count"`
+}
+
+// APIPlaybackIndex contains statistics about the index of a path.
+type APIPlaybackIndex struct {
+	Path    string `json:"path"`
+	Entries int    `json:"entries"`
+}
+
+// APIPlaybackStats contains statistics about the playback server.
+type APIPlaybackStats struct {
+	Requests []*APIPlaybackRequests `json:"requests"`
+	// bytes sent to clients
+	BytesSent uint64 `json:"bytesSent"`
+	// time spent serving requests, in seconds
+	RequestDuration float64             `json:"requestDuration"`
+	Indexes         []*APIPlaybackIndex `json:"indexes"`
+}
+
+// APISegmentList is a list of recording segments.
+type APISegmentList struct {
+	ItemCount int           `json:"itemCount"`
+	PageCount int           `json:"pageCount"`
+	Items     []*APISegment `json:"items"`
+}
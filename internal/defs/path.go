@@ -3,6 +3,7 @@ package defs
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
@@ -40,6 +41,7 @@ type PathAccessRequest struct {
 	Name     string
 	Query    string
 	Publish  bool
+	Playback bool
 	SkipAuth bool
 
 	// only if skipAuth = false
@@ -62,6 +64,9 @@ func (r *PathAccessRequest) ToAuthRequest() *auth.Request {
 			if r.Publish {
 				return conf.AuthActionPublish
 			}
+			if r.Playback {
+				return conf.AuthActionPlayback
+			}
 			return conf.AuthActionRead
 		}(),
 		Path:        r.Name,
@@ -82,7 +87,13 @@ type PathFindPathConfRes struct {
 // PathFindPathConfReq contains arguments of FindPathConf().
 type PathFindPathConfReq struct {
 	AccessRequest PathAccessRequest
-	Res           chan PathFindPathConfRes
+	// if not nil, it is filled with the maximum age of recordings
+	// that can be played back. Zero means no limit.
+	MaxLookback *time.Duration
+	// if not nil, it is filled with whether the user is allowed to see recordings
+	// that are hidden by privacy intervals, that is, whether it can perform the api action on the path.
+	Privileged *bool
+	Res        chan PathFindPathConfRes
 }
 
 // PathDescribeRes contains the response of Describe().
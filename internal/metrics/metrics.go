@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,6 +25,13 @@ func interfaceIsEmpty(i interface{}) bool {
 	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
 }
 
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue escapes a label value as required by the Prometheus text format.
+func labelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
+
 func metric(key string, tags string, value int64) string {
 	return key + tags + " " + strconv.FormatInt(value, 10) + "\n"
 }
@@ -52,16 +60,17 @@ type Metrics struct {
 	AuthManager    metricsAuthManager
 	Parent         metricsParent
 
-	httpServer   *httpp.WrappedServer
-	mutex        sync.Mutex
-	pathManager  api.PathManager
-	rtspServer   api.RTSPServer
-	rtspsServer  api.RTSPServer
-	rtmpServer   api.RTMPServer
-	rtmpsServer  api.RTMPServer
-	srtServer    api.SRTServer
-	hlsManager   api.HLSServer
-	webRTCServer api.WebRTCServer
+	httpServer     *httpp.WrappedServer
+	mutex          sync.Mutex
+	pathManager    api.PathManager
+	rtspServer     api.RTSPServer
+	rtspsServer    api.RTSPServer
+	rtmpServer     api.RTMPServer
+	rtmpsServer    api.RTMPServer
+	srtServer      api.SRTServer
+	hlsManager     api.HLSServer
+	webRTCServer   api.WebRTCServer
+	playbackServer api.PlaybackServer
 }
 
 // Initialize initializes metrics.
@@ -359,6 +368,24 @@ func (m *Metrics) onRequest(ctx *gin.Context) {
 		}
 	}
 
+	if !interfaceIsEmpty(m.playbackServer) {
+		data, err := m.playbackServer.APIStats()
+		if err == nil {
+			for _, i := range data.Requests {
+				tags := "{route=\"" + labelValue(i.Route) + "\",format=\"" + labelValue(i.Format) +
+					"\",status=\"" + strconv.Itoa(i.Status) + "\"}"
+				out += metric("playback_requests", tags, int64(i.Count))
+			}
+			out += metric("playback_bytes_sent", "", int64(data.BytesSent))
+			out += metricFloat("playback_request_duration_seconds", "", data.RequestDuration)
+
+			for _, i := range data.Indexes {
+				tags := "{path=\"" + labelValue(i.Path) + "\"}"
+				out += metric("index_entries", tags, int64(i.Entries))
+			}
+		}
+	}
+
 	ctx.Writer.WriteHeader(http.StatusOK)
 	io.WriteString(ctx.Writer, out) //nolint:errcheck
 }
@@ -412,6 +439,13 @@ func (m *Metrics) SetSRTServer(s api.SRTServer) {
 	m.srtServer = s
 }
 
+// SetPlaybackServer is called by core.
+func (m *Metrics) SetPlaybackServer(s api.PlaybackServer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.playbackServer = s
+}
+
 // SetWebRTCServer is called by core.
 func (m *Metrics) SetWebRTCServer(s api.WebRTCServer) {
 	m.mutex.Lock()
@@ -47,3 +47,7 @@ func TestPreflightRequest(t *testing.T) {
 	require.Equal(t, "Authorization", res.Header.Get("Access-Control-Allow-Headers"))
 	require.Equal(t, byts, []byte{})
 }
+
+func TestLabelValue(t *testing.T) {
+	require.Equal(t, `x\"} 1\nfoo{a=\"\\`, labelValue("x\"} 1\nfoo{a=\"\\"))
+}
@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	channelQueueSize = 256
+	channelTimeout   = 10 * time.Second
+)
+
+type sender interface {
+	send(ctx context.Context, event Event) error
+}
+
+type channel struct {
+	conf   conf.NotificationChannel
+	parent logger.Writer
+
+	sender    sender
+	ctx       context.Context
+	ctxCancel func()
+	queue     chan Event
+	done      chan struct{}
+}
+
+func (c *channel) initialize() {
+	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
+	c.queue = make(chan Event, channelQueueSize)
+	c.done = make(chan struct{})
+
+	// URL has already been validated by conf
+	u, _ := url.Parse(c.conf.URL)
+
+	switch u.Scheme {
+	case "mqtt":
+		c.sender = &senderMQTT{u: u, topic: c.conf.Topic}
+
+	case "smtp":
+		c.sender = &senderSMTP{u: u}
+
+	default:
+		c.sender = &senderWebhook{u: u}
+	}
+
+	go c.run()
+}
+
+func (c *channel) close() {
+	c.ctxCancel()
+	<-c.done
+}
+
+func (c *channel) accepts(event Event) bool {
+	if len(c.conf.Events) != 0 && !contains(c.conf.Events, string(event.Type)) {
+		return false
+	}
+
+	if len(c.conf.Paths) != 0 && !contains(c.conf.Paths, event.Path) {
+		return false
+	}
+
+	return true
+}
+
+func (c *channel) push(event Event) {
+	if !c.accepts(event) {
+		return
+	}
+
+	select {
+	case c.queue <- event:
+	default:
+		c.parent.Log(logger.Warn, "notification queue of %s is full, discarding event", c.redactedURL())
+	}
+}
+
+func (c *channel) redactedURL() string {
+	u, _ := url.Parse(c.conf.URL)
+	return u.Redacted()
+}
+
+func (c *channel) run() {
+	defer close(c.done)
+
+	for {
+		select {
+		case event := <-c.queue:
+			ctx, ctxCancel := context.WithTimeout(c.ctx, channelTimeout)
+			err := c.sender.send(ctx, event)
+			ctxCancel()
+
+			if err != nil {
+				c.parent.Log(logger.Warn, "unable to send notification to %s: %v", c.redactedURL(), err)
+			}
+
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func eventSummary(event Event) string {
+	if event.Path != "" {
+		return fmt.Sprintf("%s (path '%s')", event.Type, event.Path)
+	}
+	return string(event.Type)
+}
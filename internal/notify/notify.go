@@ -0,0 +1,114 @@
+// Package notify contains the notification subsystem.
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// EventType is the type of an event.
+type EventType string
+
+// event types.
+const (
+	EventSegmentCreate    EventType = "segmentCreate"
+	EventSegmentComplete  EventType = "segmentComplete"
+	EventSegmentDelete    EventType = "segmentDelete"
+	EventIndexAdd         EventType = "indexAdd"
+	EventExportDone       EventType = "exportDone"
+	EventExportFailed     EventType = "exportFailed"
+	EventRecordingStart   EventType = "recordingStart"
+	EventRecordingStop    EventType = "recordingStop"
+	EventGapDetected      EventType = "gapDetected"
+	EventBitrateDeviation EventType = "bitrateDeviation"
+)
+
+// Event is an event that is sent to notification channels.
+type Event struct {
+	Type   EventType         `json:"type"`
+	Time   time.Time         `json:"time"`
+	Path   string            `json:"path"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Notifier sends events to notification channels.
+// Events are sent asynchronously, therefore publishers are never blocked.
+type Notifier struct {
+	Channels conf.NotificationChannels
+	Parent   logger.Writer
+
+	mutex    sync.RWMutex
+	channels []*channel
+}
+
+// Initialize initializes Notifier.
+func (n *Notifier) Initialize() {
+	n.channels = n.createChannels(n.Channels)
+}
+
+// Close closes Notifier.
+func (n *Notifier) Close() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for _, c := range n.channels {
+		c.close()
+	}
+	n.channels = nil
+}
+
+// Log implements logger.Writer.
+func (n *Notifier) Log(level logger.Level, format string, args ...interface{}) {
+	n.Parent.Log(level, "[notify] "+format, args...)
+}
+
+func (n *Notifier) createChannels(confs conf.NotificationChannels) []*channel {
+	out := make([]*channel, len(confs))
+
+	for i, c := range confs {
+		out[i] = &channel{
+			conf:   c,
+			parent: n,
+		}
+		out[i].initialize()
+	}
+
+	return out
+}
+
+// ReloadChannels is called by core.Core.
+func (n *Notifier) ReloadChannels(channels conf.NotificationChannels) {
+	newChannels := n.createChannels(channels)
+
+	n.mutex.Lock()
+	oldChannels := n.channels
+	n.channels = newChannels
+	n.Channels = channels
+	n.mutex.Unlock()
+
+	for _, c := range oldChannels {
+		c.close()
+	}
+}
+
+// Publish sends an event to the channels that accept it.
+// It can be called on a nil Notifier.
+func (n *Notifier) Publish(event Event) {
+	if n == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	for _, c := range n.channels {
+		c.push(event)
+	}
+}
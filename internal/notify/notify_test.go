@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierWebhook(t *testing.T) {
+	received := make(chan Event, 10)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var event Event
+		err := json.NewDecoder(r.Body).Decode(&event)
+		require.NoError(t, err)
+		received <- event
+	}))
+	defer ts.Close()
+
+	n := &Notifier{
+		Channels: conf.NotificationChannels{{
+			URL:    ts.URL,
+			Events: []string{string(EventSegmentComplete)},
+			Paths:  []string{"mypath"},
+		}},
+		Parent: test.NilLogger,
+	}
+	n.Initialize()
+	defer n.Close()
+
+	n.Publish(Event{Type: EventSegmentCreate, Path: "mypath"})
+	n.Publish(Event{Type: EventSegmentComplete, Path: "otherpath"})
+	n.Publish(Event{
+		Type:   EventSegmentComplete,
+		Path:   "mypath",
+		Fields: map[string]string{"segmentPath": "/recordings/mypath/1.mp4"},
+	})
+
+	select {
+	case event := <-received:
+		require.Equal(t, EventSegmentComplete, event.Type)
+		require.Equal(t, "mypath", event.Path)
+		require.Equal(t, map[string]string{"segmentPath": "/recordings/mypath/1.mp4"}, event.Fields)
+		require.False(t, event.Time.IsZero())
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not received")
+	}
+
+	select {
+	case <-received:
+		t.Fatal("unexpected event")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNotifierMQTT(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan []byte, 1)
+
+	go func() {
+		nconn, err2 := ln.Accept()
+		require.NoError(t, err2)
+		defer nconn.Close()
+
+		// CONNECT
+		var hdr [2]byte
+		_, err2 = io.ReadFull(nconn, hdr[:])
+		require.NoError(t, err2)
+		require.Equal(t, byte(0x10), hdr[0])
+
+		connect := make([]byte, hdr[1])
+		_, err2 = io.ReadFull(nconn, connect)
+		require.NoError(t, err2)
+		require.Equal(t, "MQTT", string(connect[2:6]))
+		require.Equal(t, byte(0xC2), connect[7])
+
+		_, err2 = nconn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		require.NoError(t, err2)
+
+		// PUBLISH and DISCONNECT
+		buf, err2 := io.ReadAll(nconn)
+		require.NoError(t, err2)
+		received <- buf
+	}()
+
+	n := &Notifier{
+		Channels: conf.NotificationChannels{{
+			URL:   "mqtt://myuser:mypass@" + ln.Addr().String(),
+			Topic: "mediamtx/%path/%event",
+		}},
+		Parent: test.NilLogger,
+	}
+	n.Initialize()
+	defer n.Close()
+
+	n.Publish(Event{Type: EventExportDone, Path: "mypath"})
+
+	select {
+	case buf := <-received:
+		require.Equal(t, byte(0x30), buf[0])
+		topicLen := int(buf[2])<<8 | int(buf[3])
+		require.Equal(t, "mediamtx/mypath/exportDone", string(buf[4:4+topicLen]))
+
+		var event Event
+		err = json.Unmarshal(buf[4+topicLen:len(buf)-2], &event)
+		require.NoError(t, err)
+		require.Equal(t, EventExportDone, event.Type)
+
+		require.Equal(t, []byte{0xE0, 0x00}, buf[len(buf)-2:])
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not received")
+	}
+}
@@ -0,0 +1,68 @@
+package playback
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const accessLogMuxTimeKey = "muxTime"
+
+// addMuxTime adds time spent reading and muxing recordings to the access log entry of a request.
+func addMuxTime(ctx *gin.Context, d time.Duration) {
+	prev, _ := ctx.Get(accessLogMuxTimeKey)
+	prevD, _ := prev.(time.Duration)
+	ctx.Set(accessLogMuxTimeKey, prevD+d)
+}
+
+// accessLogValue quotes values that contain spaces or quotes, in order to keep entries parsable.
+func accessLogValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \"=") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// middlewareAccessLog writes an entry in key=value format for each request.
+func (s *Server) middlewareAccessLog(ctx *gin.Context) {
+	start := time.Now()
+
+	ctx.Next()
+
+	// skip unknown routes, like the statistics do
+	route := ctx.FullPath()
+	if route == "" {
+		return
+	}
+
+	var b strings.Builder
+
+	b.WriteString("method=" + ctx.Request.Method +
+		" route=" + strings.TrimPrefix(route, "/v1") +
+		" status=" + strconv.FormatInt(int64(ctx.Writer.Status()), 10))
+
+	for _, key := range []string{"path", "start", "duration", "format"} {
+		if v := ctx.Query(key); v != "" {
+			b.WriteString(" " + key + "=" + accessLogValue(v))
+		}
+	}
+
+	bytesSent := ctx.Writer.Size()
+	if bytesSent < 0 {
+		bytesSent = 0
+	}
+
+	b.WriteString(" bytes=" + strconv.FormatInt(int64(bytesSent), 10))
+
+	if v, ok := ctx.Get(accessLogMuxTimeKey); ok {
+		b.WriteString(" muxTime=" + v.(time.Duration).String())
+	}
+
+	b.WriteString(" elapsed=" + time.Since(start).String() +
+		" ip=" + accessLogValue(ctx.ClientIP()))
+
+	s.Log(logger.Level(s.AccessLogLevel), "access %s", b.String())
+}
@@ -0,0 +1,359 @@
+package playback
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var errAnnotationNotFound = errors.New("annotation not found")
+
+// annotation is a bookmark or an event attached to the recordings of a path.
+type annotation struct {
+	ID       uuid.UUID         `json:"id"`
+	Created  time.Time         `json:"created"`
+	Path     string            `json:"path"`
+	Start    time.Time         `json:"start"`
+	Duration listEntryDuration `json:"duration"`
+	Label    string            `json:"label"`
+}
+
+var annotationCSVHeader = []string{"id", "path", "start", "duration", "label"}
+
+// column names used by other systems, normalized with normalizeAnnotationColumn.
+var annotationColumns = map[string][]string{
+	"path":     {"path", "camera", "cameraname", "channel", "channelname", "device", "devicename", "source"},
+	"start":    {"start", "starttime", "begin", "begintime", "timestamp", "time", "datetime", "eventtime"},
+	"end":      {"end", "endtime", "stop", "stoptime"},
+	"duration": {"duration", "length"},
+	"label":    {"label", "name", "title", "description", "comment", "note", "text", "bookmark", "eventtype"},
+}
+
+func normalizeAnnotationColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer(" ", "", "_", "", "-", "", ".", "").Replace(name)
+	return name
+}
+
+// findAnnotationField returns the value of the first column that maps to the given field.
+func findAnnotationField(record map[string]string, field string) string {
+	for _, name := range annotationColumns[field] {
+		if v, ok := record[name]; ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseAnnotationTime parses a date in RFC3339 format, in a common local format, or as a Unix timestamp.
+func parseAnnotationTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006/01/02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		// timestamps in milliseconds
+		if n > 1e11 {
+			n /= 1000
+		}
+		return time.Unix(0, int64(n*float64(time.Second))), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date: %s", v)
+}
+
+// annotationFromRecord converts a record of an export file into an annotation.
+func annotationFromRecord(record map[string]string, defaultPath string) (*annotation, error) {
+	normalized := make(map[string]string, len(record))
+	for k, v := range record {
+		normalized[normalizeAnnotationColumn(k)] = strings.TrimSpace(v)
+	}
+
+	a := &annotation{
+		Path:  findAnnotationField(normalized, "path"),
+		Label: findAnnotationField(normalized, "label"),
+	}
+
+	if a.Path == "" {
+		a.Path = defaultPath
+	}
+	if a.Path == "" {
+		return nil, fmt.Errorf("path is missing")
+	}
+
+	v := findAnnotationField(normalized, "start")
+	if v == "" {
+		return nil, fmt.Errorf("start is missing")
+	}
+
+	var err error
+	a.Start, err = parseAnnotationTime(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if v = findAnnotationField(normalized, "duration"); v != "" {
+		var duration time.Duration
+		duration, err = parseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration: %w", err)
+		}
+		a.Duration = listEntryDuration(duration)
+	} else if v = findAnnotationField(normalized, "end"); v != "" {
+		var end time.Time
+		end, err = parseAnnotationTime(v)
+		if err != nil {
+			return nil, err
+		}
+		a.Duration = listEntryDuration(end.Sub(a.Start))
+	}
+
+	if a.Duration < 0 {
+		return nil, fmt.Errorf("end is before start")
+	}
+
+	return a, nil
+}
+
+// readAnnotationsJSON reads annotations from an array of JSON objects.
+func readAnnotationsJSON(r io.Reader, defaultPath string) ([]*annotation, error) {
+	var records []map[string]interface{}
+	err := json.NewDecoder(r).Decode(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*annotation, len(records))
+
+	for i, record := range records {
+		strRecord := make(map[string]string, len(record))
+		for k, v := range record {
+			switch v := v.(type) {
+			case string:
+				strRecord[k] = v
+			case float64:
+				strRecord[k] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+
+		out[i], err = annotationFromRecord(strRecord, defaultPath)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+	}
+
+	return out, nil
+}
+
+// readAnnotationsCSV reads annotations from a CSV file with a header.
+func readAnnotationsCSV(r io.Reader, defaultPath string) ([]*annotation, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read header: %w", err)
+	}
+
+	// remove the byte order mark added by some spreadsheets
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	var out []*annotation
+
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		record := make(map[string]string, len(header))
+		for i, v := range row {
+			if i < len(header) {
+				record[header[i]] = v
+			}
+		}
+
+		a, err := annotationFromRecord(record, defaultPath)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		out = append(out, a)
+	}
+
+	return out, nil
+}
+
+func writeAnnotationsCSV(w io.Writer, annotations []annotation) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write(annotationCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range annotations {
+		err = cw.Write([]string{
+			a.ID.String(),
+			a.Path,
+			a.Start.Format(time.RFC3339Nano),
+			strconv.FormatFloat(time.Duration(a.Duration).Seconds(), 'f', -1, 64),
+			a.Label,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// annotationManager stores annotations into a file.
+type annotationManager struct {
+	filePath string
+
+	mutex       sync.Mutex
+	annotations map[uuid.UUID]*annotation
+}
+
+func (m *annotationManager) initialize() error {
+	m.annotations = make(map[uuid.UUID]*annotation)
+
+	buf, err := os.ReadFile(m.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var annotations []*annotation
+	err = json.Unmarshal(buf, &annotations)
+	if err != nil {
+		return fmt.Errorf("unable to load annotations: %w", err)
+	}
+
+	for _, a := range annotations {
+		m.annotations[a.ID] = a
+	}
+
+	return nil
+}
+
+// save writes annotations to disk atomically. It must be called with the mutex locked.
+func (m *annotationManager) save() error {
+	buf, err := json.MarshalIndent(m.listUnsafe(""), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := m.filePath + ".tmp"
+
+	err = os.WriteFile(tmp, buf, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.filePath)
+}
+
+// add adds one or more annotations at once.
+func (m *annotationManager) add(annotations []*annotation) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+
+	for _, a := range annotations {
+		a.ID = uuid.New()
+		a.Created = now
+		m.annotations[a.ID] = a
+	}
+
+	err := m.save()
+	if err != nil {
+		for _, a := range annotations {
+			delete(m.annotations, a.ID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (m *annotationManager) get(id uuid.UUID) (annotation, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	a, ok := m.annotations[id]
+	if !ok {
+		return annotation{}, errAnnotationNotFound
+	}
+
+	return *a, nil
+}
+
+func (m *annotationManager) listUnsafe(pathName string) []annotation {
+	out := []annotation{}
+
+	for _, a := range m.annotations {
+		if pathName == "" || a.Path == pathName {
+			out = append(out, *a)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Start.Before(out[j].Start)
+	})
+
+	return out
+}
+
+// list returns annotations of a path, or of all paths if pathName is empty.
+func (m *annotationManager) list(pathName string) []annotation {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.listUnsafe(pathName)
+}
+
+func (m *annotationManager) remove(id uuid.UUID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	a, ok := m.annotations[id]
+	if !ok {
+		return errAnnotationNotFound
+	}
+
+	delete(m.annotations, id)
+
+	err := m.save()
+	if err != nil {
+		m.annotations[id] = a
+		return err
+	}
+
+	return nil
+}
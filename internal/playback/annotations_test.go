@@ -0,0 +1,77 @@
+package playback
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationsReadCSV(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		in   string
+	}{
+		{
+			"native",
+			"id,path,start,duration,label\n" +
+				",cam1,2008-11-07T11:22:00Z,5,door opened\n",
+		},
+		{
+			"vms",
+			"\ufeffCamera Name,Start Time,End Time,Description\n" +
+				"cam1,2008-11-07T11:22:00Z,2008-11-07T11:22:05Z,door opened\n",
+		},
+		{
+			"unix timestamp",
+			"channel,timestamp,length,comment\n" +
+				"cam1,1226056920000,5,door opened\n",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			annotations, err := readAnnotationsCSV(strings.NewReader(ca.in), "")
+			require.NoError(t, err)
+			require.Equal(t, 1, len(annotations))
+			require.Equal(t, "cam1", annotations[0].Path)
+			require.True(t, time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC).Equal(annotations[0].Start))
+			require.Equal(t, listEntryDuration(5*time.Second), annotations[0].Duration)
+			require.Equal(t, "door opened", annotations[0].Label)
+		})
+	}
+}
+
+func TestAnnotationsReadJSON(t *testing.T) {
+	annotations, err := readAnnotationsJSON(strings.NewReader(
+		`[{"StartTime":"2008-11-07T11:22:00Z","duration":5,"name":"door opened"}]`), "cam1")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(annotations))
+	require.Equal(t, "cam1", annotations[0].Path)
+	require.Equal(t, listEntryDuration(5*time.Second), annotations[0].Duration)
+	require.Equal(t, "door opened", annotations[0].Label)
+
+	_, err = readAnnotationsJSON(strings.NewReader(`[{"name":"door opened"}]`), "cam1")
+	require.EqualError(t, err, "entry 0: start is missing")
+}
+
+func TestAnnotationsWriteCSV(t *testing.T) {
+	in := []annotation{{
+		Path:     "cam1",
+		Start:    time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC),
+		Duration: listEntryDuration(5 * time.Second),
+		Label:    "door, opened",
+	}}
+
+	var buf bytes.Buffer
+	err := writeAnnotationsCSV(&buf, in)
+	require.NoError(t, err)
+
+	out, err := readAnnotationsCSV(&buf, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(out))
+	require.Equal(t, in[0].Path, out[0].Path)
+	require.True(t, in[0].Start.Equal(out[0].Start))
+	require.Equal(t, in[0].Duration, out[0].Duration)
+	require.Equal(t, in[0].Label, out[0].Label)
+}
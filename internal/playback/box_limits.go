@@ -0,0 +1,129 @@
+package playback
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/abema/go-mp4"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// boxLimits are limits that are applied when parsing segments,
+// in order to prevent corrupted or malicious files from using unbounded resources.
+type boxLimits struct {
+	maxDepth int
+	maxCount int
+	// maximum size of boxes that are read into memory. mdat boxes are never read entirely.
+	maxSize uint64
+}
+
+var defaultBoxLimits = boxLimits{
+	maxDepth: 16,
+	maxCount: 1000000,
+	maxSize:  16 * 1024 * 1024,
+}
+
+// BoxLimits are the limits that are applied by replays when parsing segments.
+// Zero values mean no limit.
+type BoxLimits struct {
+	MaxDepth int
+	MaxCount int
+	MaxSize  conf.StringSize
+}
+
+func (l BoxLimits) limits() boxLimits {
+	return boxLimits{
+		maxDepth: l.MaxDepth,
+		maxCount: l.MaxCount,
+		maxSize:  uint64(l.MaxSize),
+	}
+}
+
+// boxLimitError is returned when a segment exceeds a parsing limit.
+type boxLimitError struct {
+	Limit  string
+	Value  uint64
+	Max    uint64
+	Offset uint64
+}
+
+// Error implements error.
+func (e *boxLimitError) Error() string {
+	return fmt.Sprintf("%s at offset %d exceeds limit (%d > %d)", e.Limit, e.Offset, e.Value, e.Max)
+}
+
+func checkBoxSize(limits boxLimits, limit string, size uint64, offset uint64) error {
+	if limits.maxSize != 0 && size > limits.maxSize {
+		return &boxLimitError{
+			Limit:  limit,
+			Value:  size,
+			Max:    limits.maxSize,
+			Offset: offset,
+		}
+	}
+	return nil
+}
+
+// readBoxStructure is like mp4.ReadBoxStructure, but applies limits.
+func readBoxStructure(r io.ReadSeeker, limits boxLimits, cb func(h *mp4.ReadHandle) (interface{}, error)) error {
+	count := 0
+
+	_, err := mp4.ReadBoxStructure(r, func(h *mp4.ReadHandle) (interface{}, error) {
+		count++
+		if limits.maxCount != 0 && count > limits.maxCount {
+			return nil, &boxLimitError{
+				Limit:  "box count",
+				Value:  uint64(count),
+				Max:    uint64(limits.maxCount),
+				Offset: h.BoxInfo.Offset,
+			}
+		}
+
+		if limits.maxDepth != 0 && len(h.Path) > limits.maxDepth {
+			return nil, &boxLimitError{
+				Limit:  "box depth",
+				Value:  uint64(len(h.Path)),
+				Max:    uint64(limits.maxDepth),
+				Offset: h.BoxInfo.Offset,
+			}
+		}
+
+		if h.BoxInfo.Type != mp4.BoxTypeMdat() {
+			err := checkBoxSize(limits, "box size", h.BoxInfo.Size, h.BoxInfo.Offset)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return cb(h)
+	})
+	return err
+}
+
+// headerBoxSize returns the size of a box from its header, that has just been read from r,
+// and checks it against limits.
+func headerBoxSize(r io.Seeker, limits boxLimits, header []byte) (uint32, error) {
+	size := uint32(header[0])<<24 | uint32(header[1])<<16 | uint32(header[2])<<8 | uint32(header[3])
+
+	offset, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	offset -= int64(len(header))
+
+	if size < 8 {
+		return 0, fmt.Errorf("invalid size of box %s at offset %d: %d", header[4:8], offset, size)
+	}
+
+	// mdat boxes are never read entirely
+	if !bytes.Equal(header[4:8], []byte{'m', 'd', 'a', 't'}) {
+		err = checkBoxSize(limits, "box size", uint64(size), uint64(offset))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return size, nil
+}
@@ -0,0 +1,355 @@
+package playback
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// returned by rangeWriter when the end of the range has been written,
+// in order to stop muxing.
+var errRangeWritten = errors.New("range written")
+
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// byteRange is a range of bytes, inclusive of both ends.
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// maximum number of ranges of a request. Requests with more ranges are answered with the whole content,
+// in order to limit the overhead of multipart responses.
+const maxByteRanges = 16
+
+// parseByteRanges parses a Range header, as described in RFC 7233.
+// It returns false when the header is invalid, in which case the whole content must be sent.
+// Unsatisfiable ranges are discarded, while overlapping and adjacent ranges are merged.
+func parseByteRanges(header string, size int64) ([]byteRange, bool, error) {
+	unit, set, ok := strings.Cut(header, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, false, nil
+	}
+
+	specs := strings.Split(set, ",")
+	if len(specs) > maxByteRanges {
+		return nil, false, nil
+	}
+
+	var out []byteRange
+	count := 0
+
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+
+		// empty elements are allowed by the list syntax
+		if spec == "" {
+			continue
+		}
+		count++
+
+		r, satisfiable, ok := parseByteRangeSpec(spec, size)
+		if !ok {
+			return nil, false, nil
+		}
+
+		if satisfiable {
+			out = append(out, r)
+		}
+	}
+
+	if count == 0 {
+		return nil, false, nil
+	}
+
+	if len(out) == 0 {
+		return nil, true, errUnsatisfiableRange
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].start < out[j].start
+	})
+
+	merged := out[:1]
+
+	for _, r := range out[1:] {
+		last := &merged[len(merged)-1]
+		if r.start <= last.end+1 {
+			last.end = max(last.end, r.end)
+		} else {
+			merged = append(merged, r)
+		}
+	}
+
+	return merged, true, nil
+}
+
+// parseByteRangeSpec parses a single range.
+// It returns whether the range is satisfiable and whether its syntax is valid.
+func parseByteRangeSpec(spec string, size int64) (byteRange, bool, bool) {
+	rawStart, rawEnd, ok := strings.Cut(spec, "-")
+	if !ok {
+		return byteRange{}, false, false
+	}
+
+	rawStart = strings.TrimSpace(rawStart)
+	rawEnd = strings.TrimSpace(rawEnd)
+
+	// suffix range
+	if rawStart == "" {
+		n, err := strconv.ParseInt(rawEnd, 10, 64)
+		if err != nil || n < 0 {
+			return byteRange{}, false, false
+		}
+		if n > size {
+			n = size
+		}
+		if n == 0 {
+			return byteRange{}, false, true
+		}
+		return byteRange{start: size - n, end: size - 1}, true, true
+	}
+
+	start, err := strconv.ParseInt(rawStart, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, false
+	}
+
+	end := size - 1
+	if rawEnd != "" {
+		end, err = strconv.ParseInt(rawEnd, 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, false, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return byteRange{}, false, true
+	}
+
+	return byteRange{start: start, end: end}, true, true
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.start, 10) + "-" + strconv.FormatInt(r.end, 10) +
+		"/" + strconv.FormatInt(size, 10)
+}
+
+func (r byteRange) length() int64 {
+	return r.end - r.start + 1
+}
+
+// rangeWriter writes the part of a stream that falls inside a byte range.
+type rangeWriter struct {
+	w   io.Writer
+	r   byteRange
+	pos int64
+}
+
+func (w *rangeWriter) Write(p []byte) (int, error) {
+	lo := w.r.start - w.pos
+	if lo < 0 {
+		lo = 0
+	}
+
+	hi := w.r.end + 1 - w.pos
+	if hi > int64(len(p)) {
+		hi = int64(len(p))
+	}
+
+	if lo < hi {
+		_, err := w.w.Write(p[lo:hi])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	w.pos += int64(len(p))
+
+	if w.pos > w.r.end {
+		return len(p), errRangeWritten
+	}
+
+	return len(p), nil
+}
+
+// multiRangeWriter writes the parts of a stream that fall inside multiple byte ranges,
+// as a multipart/byteranges body. Ranges must be sorted and must not overlap.
+type multiRangeWriter struct {
+	mw          *multipart.Writer
+	ranges      []byteRange
+	contentType string
+	size        int64
+
+	pos  int64
+	cur  int
+	part io.Writer
+}
+
+func newMultiRangeWriter(w io.Writer, ranges []byteRange, contentType string, size int64) *multiRangeWriter {
+	return &multiRangeWriter{
+		mw:          multipart.NewWriter(w),
+		ranges:      ranges,
+		contentType: contentType,
+		size:        size,
+	}
+}
+
+func (w *multiRangeWriter) partHeader(r byteRange) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", w.contentType)
+	h.Set("Content-Range", r.contentRange(w.size))
+	return h
+}
+
+// responseContentType returns the content type of the response.
+func (w *multiRangeWriter) responseContentType() string {
+	return "multipart/byteranges; boundary=" + w.mw.Boundary()
+}
+
+// length returns the size of the response.
+func (w *multiRangeWriter) length() int64 {
+	cw := &countWriter{}
+	mw := multipart.NewWriter(cw)
+	mw.SetBoundary(w.mw.Boundary()) //nolint:errcheck
+
+	n := int64(0)
+
+	for _, r := range w.ranges {
+		mw.CreatePart(w.partHeader(r)) //nolint:errcheck
+		n += r.length()
+	}
+
+	mw.Close()
+
+	return cw.n + n
+}
+
+func (w *multiRangeWriter) Write(p []byte) (int, error) {
+	n := int64(len(p))
+
+	for w.cur < len(w.ranges) {
+		r := w.ranges[w.cur]
+
+		lo := max(r.start-w.pos, 0)
+		if lo >= n {
+			break
+		}
+
+		hi := min(r.end+1-w.pos, n)
+
+		if w.part == nil {
+			var err error
+			w.part, err = w.mw.CreatePart(w.partHeader(r))
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		_, err := w.part.Write(p[lo:hi])
+		if err != nil {
+			return 0, err
+		}
+
+		// range continues in the next write
+		if r.end+1-w.pos > n {
+			break
+		}
+
+		w.part = nil
+		w.cur++
+	}
+
+	w.pos += n
+
+	if w.cur == len(w.ranges) {
+		err := w.mw.Close()
+		if err != nil {
+			return 0, err
+		}
+		return len(p), errRangeWritten
+	}
+
+	return len(p), nil
+}
+
+// muxerSizer is a muxer that replaces the payload of samples with zeros,
+// in order to compute the size of the output without reading the content of recordings.
+// It can be used with muxers whose output size depends on the payload size only.
+type muxerSizer struct {
+	muxer
+	buf []byte
+}
+
+func (w *muxerSizer) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	_ func() ([]byte, error),
+) error {
+	if uint32(len(w.buf)) < payloadSize {
+		w.buf = make([]byte, payloadSize)
+	}
+
+	return w.muxer.writeSample(dts, ptsOffset, isNonSyncSample, payloadSize, func() ([]byte, error) {
+		return w.buf[:payloadSize], nil
+	})
+}
+
+// countWriter counts the bytes of a stream.
+// When w is set, bytes are forwarded to it.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if w.w == nil {
+		w.n += int64(len(p))
+		return len(p), nil
+	}
+
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// payloadSkipper is used by muxers in the data pass of range requests, in order to avoid
+// reading samples whose payload is written entirely before the first requested byte.
+// Since the position of the following data depends on the size of payloads only,
+// these payloads are replaced with zeros, like in the sizing pass.
+type payloadSkipper struct {
+	w     io.Writer
+	start int64
+
+	pos   int64
+	zeros []byte
+}
+
+func (s *payloadSkipper) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+// skippable checks whether a payload that ends at the given position of the output is not requested.
+func (s *payloadSkipper) skippable(end int64) bool {
+	return end <= s.start
+}
+
+// placeholder returns a payload of the given size that replaces a skipped one.
+// It must not be modified.
+func (s *payloadSkipper) placeholder(size uint32) []byte {
+	if uint32(len(s.zeros)) < size {
+		s.zeros = make([]byte, size)
+	}
+	return s.zeros[:size]
+}
@@ -0,0 +1,138 @@
+package playback
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteRanges(t *testing.T) {
+	for _, ca := range []struct {
+		name   string
+		header string
+		ranges []byteRange
+		ok     bool
+		err    error
+	}{
+		{"single", "bytes=10-19", []byteRange{{10, 19}}, true, nil},
+		{"open", "bytes=90-", []byteRange{{90, 99}}, true, nil},
+		{"suffix", "bytes=-10", []byteRange{{90, 99}}, true, nil},
+		{"suffix larger than size", "bytes=-500", []byteRange{{0, 99}}, true, nil},
+		{"end after size", "bytes=95-200", []byteRange{{95, 99}}, true, nil},
+		{"multiple", "bytes=0-9, 50-59", []byteRange{{0, 9}, {50, 59}}, true, nil},
+		{"multiple unsorted", "bytes=-5,0-9", []byteRange{{0, 9}, {95, 99}}, true, nil},
+		{"overlapping", "bytes=0-20,10-30,31-40", []byteRange{{0, 40}}, true, nil},
+		{"partially unsatisfiable", "bytes=0-9,200-", []byteRange{{0, 9}}, true, nil},
+		{"unit case", "Bytes=0-9", []byteRange{{0, 9}}, true, nil},
+		{"unsatisfiable", "bytes=100-", nil, true, errUnsatisfiableRange},
+		{"unsatisfiable suffix", "bytes=-0", nil, true, errUnsatisfiableRange},
+		{"unsatisfiable multiple", "bytes=100-,200-300", nil, true, errUnsatisfiableRange},
+		{"invalid unit", "items=0-9", nil, false, nil},
+		{"invalid spec", "bytes=a-b", nil, false, nil},
+		{"invalid order", "bytes=10-5", nil, false, nil},
+		{"invalid element", "bytes=0-9,x", nil, false, nil},
+		{"empty", "bytes=,", nil, false, nil},
+		{"too many", "bytes=0-0,2-2,4-4,6-6,8-8,10-10,12-12,14-14,16-16,18-18,20-20,22-22,24-24,26-26,28-28,30-30,32-32",
+			nil, false, nil},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			ranges, ok, err := parseByteRanges(ca.header, 100)
+			require.Equal(t, ca.err, err)
+			require.Equal(t, ca.ok, ok)
+			require.Equal(t, ca.ranges, ranges)
+		})
+	}
+}
+
+// muxSkipTest muxes samples and returns the output and the number of payloads that have been read.
+func muxSkipTest(t *testing.T, format string, skipStart int64) ([]byte, int) {
+	var buf bytes.Buffer
+	m, closeM := (&Server{}).newGetMuxer(format, &buf, skipStart)
+	defer closeM()
+
+	m.writeInit(&fmp4.Init{
+		Tracks: []*fmp4.InitTrack{
+			{
+				ID:        1,
+				TimeScale: 90000,
+				Codec: &fmp4.CodecH264{
+					SPS: test.FormatH264.SPS,
+					PPS: test.FormatH264.PPS,
+				},
+			},
+			{
+				ID:        2,
+				TimeScale: 48000,
+				Codec: &fmp4.CodecMPEG4Audio{
+					Config: mpeg4audio.Config{
+						Type:         mpeg4audio.ObjectTypeAACLC,
+						SampleRate:   48000,
+						ChannelCount: 2,
+					},
+				},
+			},
+		},
+	})
+
+	reads := 0
+
+	for part := int64(0); part < 20; part++ {
+		m.setTrack(1)
+
+		for i := int64(0); i < 10; i++ {
+			n := part*10 + i
+			err := m.writeSample(n*9000, 0, n%10 != 0, uint32(100+n%7), func() ([]byte, error) {
+				reads++
+				return bytes.Repeat([]byte{byte(n)}, int(100+n%7)), nil
+			})
+			require.NoError(t, err)
+		}
+
+		m.setTrack(2)
+
+		for i := int64(0); i < 5; i++ {
+			n := part*5 + i
+			err := m.writeSample(n*9600, 0, false, 4, func() ([]byte, error) {
+				reads++
+				return []byte{1, 2, 3, byte(n)}, nil
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	m.setTrack(1)
+	m.writeFinalDTS(200 * 9000)
+	m.setTrack(2)
+	m.writeFinalDTS(100 * 9600)
+
+	err := m.flush()
+	require.NoError(t, err)
+
+	return buf.Bytes(), reads
+}
+
+func TestPayloadSkipper(t *testing.T) {
+	for _, format := range []string{"fmp4", "mp4", "mkv"} {
+		t.Run(format, func(t *testing.T) {
+			full, fullReads := muxSkipTest(t, format, 0)
+			require.Equal(t, 300, fullReads)
+
+			for _, skipStart := range []int64{1, int64(len(full)) / 3, int64(len(full)) / 2, int64(len(full)) - 10} {
+				t.Run(strconv.FormatInt(skipStart, 10), func(t *testing.T) {
+					buf, reads := muxSkipTest(t, format, skipStart)
+					require.Equal(t, len(full), len(buf))
+					require.Equal(t, full[skipStart:], buf[skipStart:])
+
+					if skipStart > int64(len(full))/3 {
+						require.Less(t, reads, fullReads)
+					}
+				})
+			}
+		})
+	}
+}
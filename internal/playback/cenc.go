@@ -0,0 +1,519 @@
+package playback
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/google/uuid"
+)
+
+// system ID of W3C Clear Key
+var clearKeySystemID = [16]byte{
+	0x10, 0x77, 0xef, 0xec, 0xc0, 0xb2, 0x4d, 0x02,
+	0xac, 0xe3, 0x3c, 0x1e, 0x52, 0xe2, 0xfb, 0x4b,
+}
+
+const (
+	cencIVSize = 8
+
+	sencFlagUseSubsamples = 0x02
+)
+
+type cencTrackKind int
+
+const (
+	// the whole sample is encrypted
+	cencTrackFull cencTrackKind = iota
+	// NALUs are encrypted, while their length and header are left in clear
+	cencTrackH264
+	cencTrackH265
+)
+
+func cencTrackKindFromCodec(codec fmp4.Codec) (cencTrackKind, error) {
+	switch codec.(type) {
+	case *fmp4.CodecH264:
+		return cencTrackH264, nil
+
+	case *fmp4.CodecH265:
+		return cencTrackH265, nil
+
+	case *fmp4.CodecMPEG4Audio, *fmp4.CodecOpus:
+		return cencTrackFull, nil
+
+	default:
+		return 0, fmt.Errorf("encryption of codec %T is not supported", codec)
+	}
+}
+
+type cencSubsample struct {
+	clear     uint16
+	protected uint32
+}
+
+// cencSampleInfo is the auxiliary information of an encrypted sample.
+type cencSampleInfo struct {
+	iv         [cencIVSize]byte
+	subsamples []cencSubsample
+}
+
+func (i *cencSampleInfo) size(useSubsamples bool) int {
+	if useSubsamples {
+		return cencIVSize + 2 + 6*len(i.subsamples)
+	}
+	return cencIVSize
+}
+
+func (i *cencSampleInfo) addSubsample(clear int, protected uint32) {
+	for clear > 0xFFFF {
+		i.subsamples = append(i.subsamples, cencSubsample{clear: 0xFFFF})
+		clear -= 0xFFFF
+	}
+	i.subsamples = append(i.subsamples, cencSubsample{clear: uint16(clear), protected: protected})
+}
+
+// cencEncrypter encrypts fMP4 files with Common Encryption (ISO/IEC 23001-7), 'cenc' scheme.
+type cencEncrypter struct {
+	kid   uuid.UUID
+	block cipher.Block
+
+	tracks map[int]cencTrackKind
+	err    error
+}
+
+func newCENCEncrypter(kid uuid.UUID, key []byte) (*cencEncrypter, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cencEncrypter{
+		kid:   kid,
+		block: block,
+	}, nil
+}
+
+// setTracks is called when the initialization segment is known,
+// even if it is not written, that happens when an export is resumed.
+func (e *cencEncrypter) setTracks(tracks []*fmp4.InitTrack) {
+	e.tracks = make(map[int]cencTrackKind)
+	e.err = nil
+
+	for _, track := range tracks {
+		kind, err := cencTrackKindFromCodec(track.Codec)
+		if err != nil {
+			e.err = err
+			return
+		}
+		e.tracks[track.ID] = kind
+	}
+}
+
+func (e *cencEncrypter) encryptSample(kind cencTrackKind, payload []byte) ([]byte, cencSampleInfo, error) {
+	var info cencSampleInfo
+
+	_, err := rand.Read(info.iv[:])
+	if err != nil {
+		return nil, info, err
+	}
+
+	var counter [aes.BlockSize]byte
+	copy(counter[:], info.iv[:])
+	stream := cipher.NewCTR(e.block, counter[:])
+
+	out := make([]byte, len(payload))
+	copy(out, payload)
+
+	if kind == cencTrackFull {
+		stream.XORKeyStream(out, out)
+		return out, info, nil
+	}
+
+	headerSize := 1
+	if kind == cencTrackH265 {
+		headerSize = 2
+	}
+
+	clear := 0
+	pos := 0
+
+	for pos < len(out) {
+		if (len(out) - pos) < 4 {
+			return nil, info, fmt.Errorf("invalid NALU length")
+		}
+
+		l := int(binary.BigEndian.Uint32(out[pos:]))
+		if l > (len(out) - pos - 4) {
+			return nil, info, fmt.Errorf("invalid NALU length")
+		}
+
+		nalu := out[pos+4 : pos+4+l]
+		pos += 4 + l
+
+		// only slices are encrypted, in order to allow parsing parameters
+		if l <= headerSize || !cencIsVCL(kind, nalu) {
+			clear += 4 + l
+			continue
+		}
+
+		stream.XORKeyStream(nalu[headerSize:], nalu[headerSize:])
+		info.addSubsample(clear+4+headerSize, uint32(l-headerSize))
+		clear = 0
+	}
+
+	if clear != 0 || len(info.subsamples) == 0 {
+		info.addSubsample(clear, 0)
+	}
+
+	return out, info, nil
+}
+
+func cencIsVCL(kind cencTrackKind, nalu []byte) bool {
+	if kind == cencTrackH264 {
+		typ := nalu[0] & 0x1F
+		return typ >= 1 && typ <= 5
+	}
+
+	typ := (nalu[0] >> 1) & 0x3F
+	return typ < 32
+}
+
+// marshalInit writes an initialization segment, in which sample entries are marked as encrypted.
+func (e *cencEncrypter) marshalInit(init *fmp4.Init, w io.WriteSeeker) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	var buf seekablebuffer.Buffer
+	err := init.Marshal(&buf)
+	if err != nil {
+		return err
+	}
+
+	r := bytes.NewReader(buf.Bytes())
+	mw := mp4.NewWriter(w)
+
+	_, err = mp4.ReadBoxStructure(r, func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type {
+		case mp4.BoxTypeMoov(), mp4.BoxTypeTrak(), mp4.BoxTypeMdia(), mp4.BoxTypeMinf(), mp4.BoxTypeStbl(), mp4.BoxTypeStsd():
+			return nil, e.rewriteBox(mw, h, h.BoxInfo.Type)
+
+		case mp4.BoxTypeAvc1(), mp4.BoxTypeHvc1(), mp4.BoxTypeHev1():
+			return nil, e.rewriteBox(mw, h, mp4.BoxTypeEncv())
+
+		case mp4.BoxTypeMp4a(), mp4.BoxTypeOpus():
+			return nil, e.rewriteBox(mw, h, mp4.BoxTypeEnca())
+
+		default:
+			return nil, mw.CopyBox(r, &h.BoxInfo)
+		}
+	})
+	return err
+}
+
+// rewriteBox writes a box with the given type, its children and additional encryption boxes.
+func (e *cencEncrypter) rewriteBox(mw *mp4.Writer, h *mp4.ReadHandle, typ mp4.BoxType) error {
+	_, err := mw.StartBox(&mp4.BoxInfo{Type: typ})
+	if err != nil {
+		return err
+	}
+
+	box, _, err := h.ReadPayload()
+	if err != nil {
+		return err
+	}
+
+	_, err = mp4.Marshal(mw, box, h.BoxInfo.Context)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.Expand()
+	if err != nil {
+		return err
+	}
+
+	switch typ {
+	case mp4.BoxTypeMoov():
+		err = writeBox(mw, &mp4.Pssh{
+			FullBox: mp4.FullBox{
+				Version: 1,
+			},
+			SystemID: clearKeySystemID,
+			KIDCount: 1,
+			KIDs:     []mp4.PsshKID{{KID: e.kid}},
+		})
+
+	case mp4.BoxTypeEncv(), mp4.BoxTypeEnca():
+		err = e.writeSinf(mw, h.BoxInfo.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = mw.EndBox()
+	return err
+}
+
+func (e *cencEncrypter) writeSinf(mw *mp4.Writer, originalType mp4.BoxType) error {
+	/*
+		|sinf|
+		|    |frma|
+		|    |schm|
+		|    |schi|
+		|    |    |tenc|
+	*/
+
+	_, err := mw.StartBox(&mp4.BoxInfo{Type: mp4.BoxTypeSinf()})
+	if err != nil {
+		return err
+	}
+
+	err = writeBox(mw, &mp4.Frma{
+		DataFormat: originalType,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeBox(mw, &mp4.Schm{
+		SchemeType:    [4]byte{'c', 'e', 'n', 'c'},
+		SchemeVersion: 0x00010000,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = mw.StartBox(&mp4.BoxInfo{Type: mp4.BoxTypeSchi()})
+	if err != nil {
+		return err
+	}
+
+	err = writeBox(mw, &mp4.Tenc{
+		DefaultIsProtected:     1,
+		DefaultPerSampleIVSize: cencIVSize,
+		DefaultKID:             e.kid,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = mw.EndBox()
+	if err != nil {
+		return err
+	}
+
+	_, err = mw.EndBox()
+	return err
+}
+
+// marshalPart encrypts the samples of a part and writes it,
+// together with the auxiliary information needed to decrypt them.
+func (e *cencEncrypter) marshalPart(part *fmp4.Part, w io.WriteSeeker) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	encPart := fmp4.Part{
+		SequenceNumber: part.SequenceNumber,
+		Tracks:         make([]*fmp4.PartTrack, len(part.Tracks)),
+	}
+	infos := make([][]cencSampleInfo, len(part.Tracks))
+	useSubsamples := make([]bool, len(part.Tracks))
+
+	// auxiliary information boxes are placed inside the moof,
+	// therefore data offsets have to be shifted by their size.
+	extraSize := 0
+
+	for i, track := range part.Tracks {
+		kind, ok := e.tracks[track.ID]
+		if !ok {
+			return fmt.Errorf("track %d not found", track.ID)
+		}
+
+		useSubsamples[i] = (kind != cencTrackFull)
+
+		encTrack := &fmp4.PartTrack{
+			ID:       track.ID,
+			BaseTime: track.BaseTime,
+			Samples:  make([]*fmp4.PartSample, len(track.Samples)),
+		}
+		infos[i] = make([]cencSampleInfo, len(track.Samples))
+
+		sencSize := 16
+		for j, sample := range track.Samples {
+			pl, info, err := e.encryptSample(kind, sample.Payload)
+			if err != nil {
+				return err
+			}
+
+			encTrack.Samples[j] = &fmp4.PartSample{
+				Duration:        sample.Duration,
+				PTSOffset:       sample.PTSOffset,
+				IsNonSyncSample: sample.IsNonSyncSample,
+				Payload:         pl,
+			}
+			if info.size(useSubsamples[i]) > 0xFF {
+				return fmt.Errorf("too many NALUs in sample")
+			}
+
+			infos[i][j] = info
+			sencSize += info.size(useSubsamples[i])
+		}
+
+		encPart.Tracks[i] = encTrack
+
+		// senc + saiz + saio
+		extraSize += sencSize + (17 + len(track.Samples)) + 20
+	}
+
+	var buf seekablebuffer.Buffer
+	err := encPart.Marshal(&buf)
+	if err != nil {
+		return err
+	}
+
+	r := bytes.NewReader(buf.Bytes())
+	mw := mp4.NewWriter(w)
+	var moofOffset uint64
+	trackIndex := 0
+
+	_, err = mp4.ReadBoxStructure(r, func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type {
+		case mp4.BoxTypeMoof(), mp4.BoxTypeTraf():
+			bi, err := mw.StartBox(&mp4.BoxInfo{Type: h.BoxInfo.Type})
+			if err != nil {
+				return nil, err
+			}
+
+			if h.BoxInfo.Type == mp4.BoxTypeMoof() {
+				moofOffset = bi.Offset
+			}
+
+			_, err = h.Expand()
+			if err != nil {
+				return nil, err
+			}
+
+			if h.BoxInfo.Type == mp4.BoxTypeTraf() {
+				err = writeSampleEncryption(mw, moofOffset, infos[trackIndex], useSubsamples[trackIndex])
+				if err != nil {
+					return nil, err
+				}
+				trackIndex++
+			}
+
+			_, err = mw.EndBox()
+			return nil, err
+
+		case mp4.BoxTypeTrun():
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+
+			trun := box.(*mp4.Trun)
+			trun.DataOffset += int32(extraSize)
+
+			return nil, writeBox(mw, trun)
+
+		default:
+			return nil, mw.CopyBox(r, &h.BoxInfo)
+		}
+	})
+	return err
+}
+
+func writeSampleEncryption(
+	mw *mp4.Writer,
+	moofOffset uint64,
+	infos []cencSampleInfo,
+	useSubsamples bool,
+) error {
+	/*
+		|senc|
+		|saiz|
+		|saio|
+	*/
+
+	sencOffset, err := mw.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = mw.StartBox(&mp4.BoxInfo{Type: mp4.StrToBoxType("senc")})
+	if err != nil {
+		return err
+	}
+
+	var flags uint32
+	if useSubsamples {
+		flags = sencFlagUseSubsamples
+	}
+
+	buf := binary.BigEndian.AppendUint32(nil, flags)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(infos)))
+
+	for _, info := range infos {
+		buf = append(buf, info.iv[:]...)
+
+		if useSubsamples {
+			buf = binary.BigEndian.AppendUint16(buf, uint16(len(info.subsamples)))
+			for _, sub := range info.subsamples {
+				buf = binary.BigEndian.AppendUint16(buf, sub.clear)
+				buf = binary.BigEndian.AppendUint32(buf, sub.protected)
+			}
+		}
+	}
+
+	_, err = mw.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = mw.EndBox()
+	if err != nil {
+		return err
+	}
+
+	saiz := &mp4.Saiz{
+		SampleCount:    uint32(len(infos)),
+		SampleInfoSize: make([]uint8, len(infos)),
+	}
+	for i, info := range infos {
+		saiz.SampleInfoSize[i] = uint8(info.size(useSubsamples))
+	}
+
+	err = writeBox(mw, saiz)
+	if err != nil {
+		return err
+	}
+
+	// auxiliary information starts after the header, flags and count of senc
+	return writeBox(mw, &mp4.Saio{
+		EntryCount: 1,
+		OffsetV0:   []uint32{uint32(uint64(sencOffset) + 16 - moofOffset)},
+	})
+}
+
+func writeBox(mw *mp4.Writer, box mp4.IBox) error {
+	_, err := mw.StartBox(&mp4.BoxInfo{Type: box.GetType()})
+	if err != nil {
+		return err
+	}
+
+	_, err = mp4.Marshal(mw, box, mp4.Context{})
+	if err != nil {
+		return err
+	}
+
+	_, err = mw.EndBox()
+	return err
+}
@@ -0,0 +1,199 @@
+package playback
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"testing"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// cencDecrypt decrypts the samples of the first part of a file by following saio and trun.
+func cencDecrypt(t *testing.T, buf []byte, key []byte) [][][]byte {
+	r := bytes.NewReader(buf)
+
+	moofs, err := mp4.ExtractBoxWithPayload(r, nil, mp4.BoxPath{mp4.BoxTypeMoof()})
+	require.NoError(t, err)
+	require.NotEmpty(t, moofs)
+	moofOffset := moofs[0].Info.Offset
+
+	truns, err := mp4.ExtractBoxWithPayload(r, nil, mp4.BoxPath{mp4.BoxTypeMoof(), mp4.BoxTypeTraf(), mp4.BoxTypeTrun()})
+	require.NoError(t, err)
+
+	saios, err := mp4.ExtractBoxWithPayload(r, nil, mp4.BoxPath{mp4.BoxTypeMoof(), mp4.BoxTypeTraf(), mp4.BoxTypeSaio()})
+	require.NoError(t, err)
+
+	sencs, err := mp4.ExtractBox(r, nil, mp4.BoxPath{mp4.BoxTypeMoof(), mp4.BoxTypeTraf(), mp4.StrToBoxType("senc")})
+	require.NoError(t, err)
+
+	require.Equal(t, len(truns), len(saios))
+	require.Equal(t, len(truns), len(sencs))
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	var out [][][]byte
+
+	for i, trunBox := range truns {
+		trun := trunBox.Payload.(*mp4.Trun)
+		saio := saios[i].Payload.(*mp4.Saio)
+		useSubsamples := (buf[sencs[i].Offset+11] & sencFlagUseSubsamples) != 0
+
+		aux := buf[moofOffset+saio.GetOffset(0):]
+		dataPos := int(moofOffset) + int(trun.DataOffset)
+		var samples [][]byte
+
+		for _, entry := range trun.Entries {
+			sample := make([]byte, entry.SampleSize)
+			copy(sample, buf[dataPos:])
+			dataPos += int(entry.SampleSize)
+
+			var counter [aes.BlockSize]byte
+			copy(counter[:], aux[:cencIVSize])
+			aux = aux[cencIVSize:]
+			stream := cipher.NewCTR(block, counter[:])
+
+			if useSubsamples {
+				count := int(binary.BigEndian.Uint16(aux))
+				aux = aux[2:]
+				pos := 0
+
+				for j := 0; j < count; j++ {
+					clear := int(binary.BigEndian.Uint16(aux))
+					protected := int(binary.BigEndian.Uint32(aux[2:]))
+					aux = aux[6:]
+
+					pos += clear
+					stream.XORKeyStream(sample[pos:pos+protected], sample[pos:pos+protected])
+					pos += protected
+				}
+
+				require.Equal(t, len(sample), pos)
+			} else {
+				stream.XORKeyStream(sample, sample)
+			}
+
+			samples = append(samples, sample)
+		}
+
+		out = append(out, samples)
+	}
+
+	return out
+}
+
+func TestCENCEncrypter(t *testing.T) {
+	kid := uuid.New()
+	key := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	enc, err := newCENCEncrypter(kid, key)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	m := &muxerFMP4{w: &buf, cenc: enc}
+
+	m.writeInit(&fmp4.Init{
+		Tracks: []*fmp4.InitTrack{
+			{
+				ID:        1,
+				TimeScale: 90000,
+				Codec: &fmp4.CodecH264{
+					SPS: test.FormatH264.SPS,
+					PPS: test.FormatH264.PPS,
+				},
+			},
+			{
+				ID:        2,
+				TimeScale: 48000,
+				Codec: &fmp4.CodecMPEG4Audio{
+					Config: mpeg4audio.Config{
+						Type:         mpeg4audio.ObjectTypeAACLC,
+						SampleRate:   48000,
+						ChannelCount: 2,
+					},
+				},
+			},
+		},
+	})
+
+	videoSamples := [][]byte{
+		{
+			0, 0, 0, 3, 0x06, 1, 2, // SEI
+			0, 0, 0, 5, 0x65, 3, 4, 5, 6, // IDR
+		},
+		{
+			0, 0, 0, 4, 0x41, 7, 8, 9, // non-IDR
+		},
+	}
+	audioSamples := [][]byte{{10, 11, 12}, {13, 14}}
+
+	m.setTrack(1)
+	for i, pl := range videoSamples {
+		err = m.writeSample(int64(i)*3000, 0, i != 0, uint32(len(pl)), func() ([]byte, error) { return pl, nil })
+		require.NoError(t, err)
+	}
+	m.writeFinalDTS(6000)
+
+	m.setTrack(2)
+	for i, pl := range audioSamples {
+		err = m.writeSample(int64(i)*1024, 0, false, uint32(len(pl)), func() ([]byte, error) { return pl, nil })
+		require.NoError(t, err)
+	}
+	m.writeFinalDTS(2048)
+
+	err = m.flush()
+	require.NoError(t, err)
+
+	r := bytes.NewReader(buf.Bytes())
+
+	for _, typ := range []mp4.BoxType{mp4.BoxTypeEncv(), mp4.BoxTypeEnca()} {
+		tencs, err2 := mp4.ExtractBoxWithPayload(r, nil, mp4.BoxPath{
+			mp4.BoxTypeMoov(), mp4.BoxTypeTrak(), mp4.BoxTypeMdia(), mp4.BoxTypeMinf(),
+			mp4.BoxTypeStbl(), mp4.BoxTypeStsd(), typ, mp4.BoxTypeSinf(), mp4.BoxTypeSchi(), mp4.BoxTypeTenc(),
+		})
+		require.NoError(t, err2)
+		require.Equal(t, 1, len(tencs))
+		require.Equal(t, [16]byte(kid), tencs[0].Payload.(*mp4.Tenc).DefaultKID)
+	}
+
+	psshs, err := mp4.ExtractBoxWithPayload(r, nil, mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypePssh()})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(psshs))
+	require.Equal(t, clearKeySystemID, psshs[0].Payload.(*mp4.Pssh).SystemID)
+
+	// payloads are not in clear
+	require.False(t, bytes.Contains(buf.Bytes(), []byte{0x65, 3, 4, 5, 6}))
+
+	require.Equal(t, [][][]byte{videoSamples, audioSamples}, cencDecrypt(t, buf.Bytes(), key))
+}
+
+func TestCENCEncrypterUnsupportedCodec(t *testing.T) {
+	enc, err := newCENCEncrypter(uuid.New(), make([]byte, 16))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	m := &muxerFMP4{w: &buf, cenc: enc}
+
+	m.writeInit(&fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec:     &fmp4.CodecMJPEG{},
+		}},
+	})
+
+	m.setTrack(1)
+	err = m.writeSample(0, 0, false, 1, func() ([]byte, error) { return []byte{1}, nil })
+	require.NoError(t, err)
+	m.writeFinalDTS(90000)
+
+	err = m.flush()
+	require.EqualError(t, err, "encryption of codec *fmp4.CodecMJPEG is not supported")
+}
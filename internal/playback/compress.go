@@ -0,0 +1,115 @@
+package playback
+
+import (
+	"compress/gzip"
+	"strconv"
+	"strings"
+
+	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/gin-gonic/gin"
+)
+
+// acceptsGzip checks whether the client accepts gzip-encoded responses.
+// An explicit gzip coding takes precedence over the wildcard.
+func acceptsGzip(acceptEncoding string) bool {
+	wildcard := false
+
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(entry, ";")
+
+		coding := strings.ToLower(strings.TrimSpace(parts[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					q = v
+				}
+			}
+		}
+
+		if coding == "gzip" {
+			return q > 0
+		}
+
+		wildcard = q > 0
+	}
+
+	return wildcard
+}
+
+// compressWriter compresses JSON responses.
+// Recordings are not compressed, since they are already compressed.
+type compressWriter struct {
+	gin.ResponseWriter
+	accepted bool
+
+	checked bool
+	gw      *gzip.Writer
+}
+
+func (w *compressWriter) check() {
+	if w.checked {
+		return
+	}
+	w.checked = true
+
+	h := w.ResponseWriter.Header()
+
+	if httpp.ParseContentType(h.Get("Content-Type")) != "application/json" || h.Get("Content-Encoding") != "" {
+		return
+	}
+
+	h.Add("Vary", "Accept-Encoding")
+
+	if !w.accepted {
+		return
+	}
+
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	w.gw = gzip.NewWriter(w.ResponseWriter)
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	w.check()
+
+	if w.gw != nil {
+		return w.gw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Flush() {
+	if w.gw != nil {
+		w.gw.Flush() //nolint:errcheck
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) close() {
+	if w.gw != nil {
+		w.gw.Close() //nolint:errcheck
+	}
+}
+
+func (s *Server) middlewareCompress(ctx *gin.Context) {
+	w := &compressWriter{
+		ResponseWriter: ctx.Writer,
+		accepted:       acceptsGzip(ctx.Request.Header.Get("Accept-Encoding")),
+	}
+	ctx.Writer = w
+
+	ctx.Next()
+
+	w.close()
+}
@@ -0,0 +1,111 @@
+package playback
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// downloadLimiter limits the number of concurrent downloads and exports.
+// Queued requests are served by priority class, then in order of arrival.
+type downloadLimiter struct {
+	max int
+
+	mutex   sync.Mutex
+	running int
+	queues  [conf.PlaybackPriorityBackup + 1][]chan struct{}
+}
+
+func (l *downloadLimiter) acquire(ctx context.Context, priority conf.PlaybackPriority) error {
+	l.mutex.Lock()
+
+	if l.running < l.max {
+		l.running++
+		l.mutex.Unlock()
+		return nil
+	}
+
+	ch := make(chan struct{})
+	l.queues[priority] = append(l.queues[priority], ch)
+	l.mutex.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+
+	case <-ctx.Done():
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		for i, c := range l.queues[priority] {
+			if c == ch {
+				l.queues[priority] = append(l.queues[priority][:i], l.queues[priority][i+1:]...)
+				return ctx.Err()
+			}
+		}
+
+		// the slot has been assigned in the meanwhile, pass it to the next request
+		l.releaseLocked()
+		return ctx.Err()
+	}
+}
+
+func (l *downloadLimiter) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.releaseLocked()
+}
+
+func (l *downloadLimiter) releaseLocked() {
+	for i, queue := range l.queues {
+		if len(queue) != 0 {
+			close(queue[0])
+			l.queues[i] = queue[1:]
+			return
+		}
+	}
+
+	l.running--
+}
+
+// requestPriority returns the priority class of a request,
+// that is the one in the query, limited by the one allowed to the user.
+func (s *Server) requestPriority(ctx *gin.Context, def conf.PlaybackPriority) (conf.PlaybackPriority, error) {
+	priority := def
+
+	if v := ctx.Query("priority"); v != "" {
+		err := priority.UnmarshalEnv("", v)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	user, _, _ := ctx.Request.BasicAuth()
+	if allowed, ok := s.Priorities[user]; ok && priority < allowed {
+		priority = allowed
+	}
+
+	return priority, nil
+}
+
+func (s *Server) middlewareLimiter(ctx *gin.Context) {
+	priority, err := s.requestPriority(ctx, conf.PlaybackPriorityInteractive)
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid priority: %w", err))
+		ctx.Abort()
+		return
+	}
+
+	err = s.limiter.acquire(ctx.Request.Context(), priority)
+	if err != nil {
+		ctx.Abort()
+		return
+	}
+	defer s.limiter.release()
+
+	ctx.Next()
+}
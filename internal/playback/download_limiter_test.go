@@ -0,0 +1,60 @@
+package playback
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadLimiter(t *testing.T) {
+	l := &downloadLimiter{max: 1}
+
+	err := l.acquire(context.Background(), conf.PlaybackPriorityBackup)
+	require.NoError(t, err)
+
+	order := make(chan conf.PlaybackPriority, 3)
+
+	for _, priority := range []conf.PlaybackPriority{
+		conf.PlaybackPriorityBackup,
+		conf.PlaybackPriorityBulk,
+		conf.PlaybackPriorityInteractive,
+	} {
+		go func() {
+			err2 := l.acquire(context.Background(), priority)
+			require.NoError(t, err2)
+			order <- priority
+		}()
+
+		// wait until the request is queued
+		for {
+			l.mutex.Lock()
+			queued := len(l.queues[priority])
+			l.mutex.Unlock()
+			if queued != 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// a canceled request leaves the queue
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	ctxCancel()
+	err = l.acquire(ctx, conf.PlaybackPriorityInteractive)
+	require.ErrorIs(t, err, context.Canceled)
+
+	for _, expected := range []conf.PlaybackPriority{
+		conf.PlaybackPriorityInteractive,
+		conf.PlaybackPriorityBulk,
+		conf.PlaybackPriorityBackup,
+	} {
+		l.release()
+		require.Equal(t, expected, <-order)
+	}
+
+	l.release()
+	require.Equal(t, 0, l.running)
+}
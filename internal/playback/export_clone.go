@@ -0,0 +1,151 @@
+package playback
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type exportCloneMethod string
+
+const (
+	exportCloneHardlink exportCloneMethod = "hardlink"
+	exportCloneReflink  exportCloneMethod = "reflink"
+	exportCloneCopy     exportCloneMethod = "copy"
+)
+
+type exportManifestFile struct {
+	Name   string            `json:"name"`
+	Size   int64             `json:"size"`
+	Method exportCloneMethod `json:"method"`
+}
+
+// exportManifest describes the content of a clone export.
+type exportManifest struct {
+	Path     string               `json:"path"`
+	Start    time.Time            `json:"start"`
+	Duration listEntryDuration    `json:"duration"`
+	Created  time.Time            `json:"created"`
+	Files    []exportManifestFile `json:"files"`
+}
+
+// cloneFile creates dest with the content of src,
+// using the cheapest method supported by the filesystem.
+func cloneFile(src string, dest string) (exportCloneMethod, error) {
+	err := os.Link(src, dest)
+	if err == nil {
+		return exportCloneHardlink, nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	method := exportCloneReflink
+
+	err = reflink(out, in)
+	if err != nil {
+		method = exportCloneCopy
+
+		_, err = io.Copy(out, in)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return method, out.Close()
+}
+
+// copyFromStorage creates dest with the content of a file that is not in the local file system.
+func copyFromStorage(file archiveFile, dest string) (exportCloneMethod, error) {
+	in, _, err := file.open()
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return "", err
+	}
+
+	return exportCloneCopy, out.Close()
+}
+
+// runJobClone fills the directory of the job with the raw segments of the timespan.
+// Since segments are not remuxed, the job is always restarted from scratch.
+func (m *exportManager) runJobClone(job *exportJob, files []archiveFile) error {
+	dir := m.dirPath(job.ID)
+
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	manifest := exportManifest{
+		Path:     job.Path,
+		Start:    job.Start,
+		Duration: job.Duration,
+		Created:  time.Now(),
+		Files:    []exportManifestFile{},
+	}
+
+	for _, file := range files {
+		if m.ctx.Err() != nil {
+			return fmt.Errorf("terminated")
+		}
+
+		dest := filepath.Join(dir, filepath.FromSlash(file.name))
+
+		err = os.MkdirAll(filepath.Dir(dest), 0o755)
+		if err != nil {
+			return err
+		}
+
+		var method exportCloneMethod
+		if _, ok := file.storage.(localStorage); ok {
+			method, err = cloneFile(file.fpath, dest)
+		} else {
+			method, err = copyFromStorage(file, dest)
+		}
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Stat(dest)
+		if err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, exportManifestFile{
+			Name:   file.name,
+			Size:   fi.Size(),
+			Method: method,
+		})
+	}
+
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the manifest is written last, therefore its presence means that the directory is complete
+	return os.WriteFile(filepath.Join(dir, "manifest.json"), buf, 0o644)
+}
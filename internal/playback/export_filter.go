@@ -0,0 +1,75 @@
+package playback
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// exportFilter pipes the output of a muxer through an external command.
+type exportFilter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	done  chan error
+}
+
+func startExportFilter(
+	ctx context.Context,
+	cmdstr string,
+	env []string,
+	out io.Writer,
+) (*exportFilter, error) {
+	cmdParts, err := shellquote.Split(cmdstr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cmdParts) == 0 {
+		return nil, fmt.Errorf("filter command is empty")
+	}
+
+	f := &exportFilter{
+		cmd:  exec.CommandContext(ctx, cmdParts[0], cmdParts[1:]...),
+		done: make(chan error),
+	}
+
+	f.cmd.Env = append(os.Environ(), env...)
+	f.cmd.Stdout = out
+	f.cmd.Stderr = os.Stderr
+
+	f.stdin, err = f.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		f.done <- f.cmd.Wait()
+	}()
+
+	return f, nil
+}
+
+// Write implements io.Writer.
+func (f *exportFilter) Write(p []byte) (int, error) {
+	return f.stdin.Write(p)
+}
+
+// close closes the input of the command and waits for it to exit.
+func (f *exportFilter) close() error {
+	f.stdin.Close()
+
+	err := <-f.done
+	if err != nil {
+		return fmt.Errorf("filter command failed: %w", err)
+	}
+	return nil
+}
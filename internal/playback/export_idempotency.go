@@ -0,0 +1,61 @@
+package playback
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// period in which a retried request with the same idempotency key returns the original export.
+	exportIdempotencyPeriod = 24 * time.Hour
+
+	// maximum length of idempotency keys.
+	exportIdempotencyKeyMaxLength = 255
+)
+
+var errIdempotencyKeyReused = errors.New("idempotency key has already been used with different parameters")
+
+// exportIdempotencyKey returns the key that identifies retries of the same request.
+// Keys of different users are kept apart, and are hashed in order not to store credentials.
+func exportIdempotencyKey(ctx *gin.Context) (string, error) {
+	key := ctx.GetHeader("Idempotency-Key")
+	if key == "" {
+		return "", nil
+	}
+
+	if len(key) > exportIdempotencyKeyMaxLength {
+		return "", errors.New("idempotency key is too long")
+	}
+
+	h := sha256.Sum256([]byte(quotaIdentity(ctx) + "\x00" + key))
+	return hex.EncodeToString(h[:]), nil
+}
+
+// sameRequest checks whether two jobs were created with the same parameters.
+func (j *exportJob) sameRequest(other *exportJob) bool {
+	return j.Path == other.Path &&
+		j.Start.Equal(other.Start) &&
+		j.Duration == other.Duration &&
+		j.Format == other.Format &&
+		j.GapPolicy == other.GapPolicy &&
+		j.Encryption == other.Encryption &&
+		j.Integrity == other.Integrity &&
+		j.Priority == other.Priority &&
+		j.Profile == other.Profile &&
+		j.ApplyPrivacy == other.ApplyPrivacy
+}
+
+// idempotentJob returns the job created with the given key during the idempotency period.
+// It must be called with the mutex locked.
+func (m *exportManager) idempotentJob(key string, now time.Time) *exportJob {
+	for _, job := range m.jobs {
+		if job.IdempotencyKey == key && now.Sub(job.Created) < exportIdempotencyPeriod {
+			return job
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/google/uuid"
+)
+
+// exportProfileLegal is the profile of exports that are meant to be used as evidence.
+// Legal exports are fMP4 files whose segments have been verified against their checksums,
+// that keep the recorded timing, contain their own description and are signed
+// together with a chain-of-custody report.
+const exportProfileLegal = "legal"
+
+// language code of the comment embedded into legal exports ("und").
+const exportCommentLanguage = 0x55c4
+
+// checkLegalExport checks whether an export can be created with the legal profile.
+func checkLegalExport(pathConf *conf.Path, format string, gapPolicy string, signed bool) error {
+	if format != "" && format != "fmp4" {
+		return fmt.Errorf("legal profile requires the fMP4 format")
+	}
+
+	// padding inserts samples that were never recorded, while filters process the content
+	if gapPolicy == "pad" || pathConf.PlaybackFilter != "" {
+		return fmt.Errorf("legal profile is not compatible with gapPolicy=pad and playbackFilter")
+	}
+
+	if !signed {
+		return fmt.Errorf("legal profile requires playbackExportSigningKey")
+	}
+
+	return nil
+}
+
+// exportLegalMetadata is the description of a legal export, that is embedded into the export.
+type exportLegalMetadata struct {
+	ID          uuid.UUID         `json:"id"`
+	Server      string            `json:"server"`
+	Path        string            `json:"path"`
+	Start       time.Time         `json:"start"`
+	Duration    listEntryDuration `json:"duration"`
+	RequestedBy string            `json:"requestedBy"`
+	Requested   time.Time         `json:"requested"`
+}
+
+func exportLegalComment(job *exportJob) (string, error) {
+	hostname, _ := os.Hostname()
+
+	buf, err := json.Marshal(exportLegalMetadata{
+		ID:          job.ID,
+		Server:      hostname,
+		Path:        job.Path,
+		Start:       job.Start,
+		Duration:    job.Duration,
+		RequestedBy: job.RequestedBy,
+		Requested:   job.Created,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+// fmp4InitAddComment adds a comment to the user data of the moov box of an initialization segment.
+// The comment is stored in a '©cmt' box, that is read by most tools.
+func fmp4InitAddComment(init []byte, comment string) ([]byte, error) {
+	if len(comment) > 0xFFFF {
+		return nil, fmt.Errorf("comment is too long")
+	}
+
+	cmtSize := 8 + 4 + len(comment)
+	udta := make([]byte, 8+cmtSize)
+	binary.BigEndian.PutUint32(udta[0:], uint32(len(udta)))
+	copy(udta[4:], "udta")
+	binary.BigEndian.PutUint32(udta[8:], uint32(cmtSize))
+	copy(udta[12:], "\xa9cmt")
+	binary.BigEndian.PutUint16(udta[16:], uint16(len(comment)))
+	binary.BigEndian.PutUint16(udta[18:], exportCommentLanguage)
+	copy(udta[20:], comment)
+
+	offset := 0
+
+	for offset+8 <= len(init) {
+		size := int(binary.BigEndian.Uint32(init[offset:]))
+		if size < 8 || offset+size > len(init) {
+			break
+		}
+
+		if bytes.Equal(init[offset+4:offset+8], []byte("moov")) {
+			end := offset + size
+
+			out := make([]byte, 0, len(init)+len(udta))
+			out = append(out, init[:end]...)
+			out = append(out, udta...)
+			out = append(out, init[end:]...)
+
+			binary.BigEndian.PutUint32(out[offset:], uint32(size+len(udta)))
+
+			return out, nil
+		}
+
+		offset += size
+	}
+
+	return nil, fmt.Errorf("moov box not found")
+}
+
+type exportCustodySegment struct {
+	File      string          `json:"file"`
+	Integrity integrityResult `json:"integrity"`
+}
+
+// exportCustodyReport describes how a legal export has been produced.
+type exportCustodyReport struct {
+	ID          uuid.UUID              `json:"id"`
+	Profile     string                 `json:"profile"`
+	Server      string                 `json:"server"`
+	Path        string                 `json:"path"`
+	Start       time.Time              `json:"start"`
+	Duration    listEntryDuration      `json:"duration"`
+	RequestedBy string                 `json:"requestedBy"`
+	Requested   time.Time              `json:"requested"`
+	Started     time.Time              `json:"started"`
+	Completed   time.Time              `json:"completed"`
+	Attempts    int                    `json:"attempts"`
+	Segments    []exportCustodySegment `json:"segments"`
+	Size        int64                  `json:"size"`
+	SHA256      string                 `json:"sha256"`
+}
+
+func (m *exportManager) custodyPath(id uuid.UUID) string {
+	return m.filePath(id) + ".custody.json"
+}
+
+// writeCustody writes the chain-of-custody report of an export next to the export.
+func (m *exportManager) writeCustody(job *exportJob, started time.Time) error {
+	size, hash, err := fileSHA256(m.filePath(job.ID))
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+
+	report := exportCustodyReport{
+		ID:          job.ID,
+		Profile:     job.Profile,
+		Server:      hostname,
+		Path:        job.Path,
+		Start:       job.Start,
+		Duration:    job.Duration,
+		RequestedBy: job.RequestedBy,
+		Requested:   job.Created,
+		Started:     started,
+		Completed:   time.Now(),
+		Attempts:    job.Attempts + 1,
+		Segments:    []exportCustodySegment{},
+		Size:        size,
+		SHA256:      hash,
+	}
+
+	if job.IntegrityReport != nil {
+		for _, seg := range job.IntegrityReport.Segments {
+			report.Segments = append(report.Segments, exportCustodySegment{
+				File:      seg.Segment,
+				Integrity: seg.Result,
+			})
+		}
+	}
+
+	buf, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := m.custodyPath(job.ID) + ".tmp"
+
+	err = os.WriteFile(tmp, buf, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.custodyPath(job.ID))
+}
@@ -0,0 +1,833 @@
+package playback
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
+)
+
+type exportJobStatus string
+
+const (
+	exportJobQueued  exportJobStatus = "queued"
+	exportJobRunning exportJobStatus = "running"
+	exportJobDone    exportJobStatus = "done"
+	exportJobFailed  exportJobStatus = "failed"
+)
+
+// exportCheckpoint is the progress of an export,
+// that allows to resume it from the last completed segment.
+type exportCheckpoint struct {
+	Segments       int       `json:"segments"`
+	SegmentEnd     time.Time `json:"segmentEnd"`
+	Offset         int64     `json:"offset"`
+	SequenceNumber uint32    `json:"sequenceNumber"`
+	StartedTracks  []int     `json:"startedTracks,omitempty"`
+}
+
+type exportJob struct {
+	ID         uuid.UUID             `json:"id"`
+	Created    time.Time             `json:"created"`
+	Path       string                `json:"path"`
+	Start      time.Time             `json:"start"`
+	Duration   listEntryDuration     `json:"duration"`
+	Format     string                `json:"format"`
+	GapPolicy  string                `json:"gapPolicy,omitempty"`
+	Status     exportJobStatus       `json:"status"`
+	Error      string                `json:"error,omitempty"`
+	Checkpoint *exportCheckpoint     `json:"checkpoint,omitempty"`
+	Encryption string                `json:"encryption,omitempty"`
+	KeyID      *uuid.UUID            `json:"keyID,omitempty"`
+	KeyExpires *time.Time            `json:"keyExpires,omitempty"`
+	Integrity  string                `json:"integrity,omitempty"`
+	Priority   conf.PlaybackPriority `json:"priority"`
+	Profile    string                `json:"profile,omitempty"`
+
+	// identity of the user that requested the export, stored by the legal profile
+	RequestedBy string `json:"requestedBy,omitempty"`
+
+	// directory that contains the segments of clone exports
+	Directory string `json:"directory,omitempty"`
+
+	// fields of scheduled exports
+	Destination string `json:"destination,omitempty"`
+	Retries     int    `json:"retries,omitempty"`
+	Attempts    int    `json:"attempts,omitempty"`
+
+	// exports triggered by events are run after the exported timespan has been recorded
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+
+	// percent of the timespan that has been exported, filled when the job is read
+	Progress *float64 `json:"progress,omitempty"`
+
+	// result of the verification of segments, filled when the job is run
+	IntegrityReport *integrityReport `json:"integrityReport,omitempty"`
+
+	// encryption key, that is delivered by the key endpoint only
+	Key []byte `json:"key,omitempty"`
+
+	// token that allows to read the key without credentials,
+	// that is returned to the creator of the export only
+	KeyToken string `json:"keyToken,omitempty"`
+
+	// whether the job was created by a non-privileged user
+	ApplyPrivacy bool `json:"applyPrivacy"`
+
+	// oldest date of recordings that the creator of the job is allowed to access
+	LookbackLimit *time.Time `json:"lookbackLimit,omitempty"`
+
+	// hash of the idempotency key of the request that created the job
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+// exportIsDirectory checks whether exports of a format are made of multiple files,
+// that are stored into a directory.
+func exportIsDirectory(format string) bool {
+	return format == "clone" || format == "static"
+}
+
+// public returns a copy of the job without secrets.
+func (j exportJob) public() exportJob {
+	j.Key = nil
+	j.KeyToken = ""
+	j.IdempotencyKey = ""
+	return j
+}
+
+// exportManager runs asynchronous exports.
+// Jobs are stored on disk, therefore they survive restarts.
+type exportManager struct {
+	path       string
+	schedules  conf.PlaybackExportSchedules
+	signingKey ed25519.PrivateKey
+	parent     *Server
+
+	ctx           context.Context
+	ctxCancel     func()
+	mutex         sync.Mutex
+	jobs          map[uuid.UUID]*exportJob
+	queue         []*exportJob
+	running       *exportJob
+	progress      *downloadProgress
+	wake          chan struct{}
+	done          chan struct{}
+	schedulerDone chan struct{}
+}
+
+func (m *exportManager) initialize() error {
+	err := os.MkdirAll(m.path, 0o755)
+	if err != nil {
+		return err
+	}
+
+	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
+	m.jobs = make(map[uuid.UUID]*exportJob)
+	m.wake = make(chan struct{}, 1)
+	m.done = make(chan struct{})
+	m.schedulerDone = make(chan struct{})
+
+	err = m.load()
+	if err != nil {
+		return err
+	}
+
+	go m.run()
+	go m.runScheduler()
+
+	return nil
+}
+
+func (m *exportManager) close() {
+	m.ctxCancel()
+	<-m.done
+	<-m.schedulerDone
+}
+
+// load reads jobs from disk and queues again the ones that were not completed.
+func (m *exportManager) load() error {
+	entries, err := os.ReadDir(m.path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		buf, err := os.ReadFile(filepath.Join(m.path, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		var job exportJob
+		err = json.Unmarshal(buf, &job)
+		if err != nil {
+			m.parent.Log(logger.Warn, "skipping invalid export job %s: %v", entry.Name(), err)
+			continue
+		}
+
+		m.jobs[job.ID] = &job
+
+		if job.Status == exportJobQueued || job.Status == exportJobRunning {
+			m.queue = append(m.queue, &job)
+		}
+	}
+
+	sort.Slice(m.queue, func(i, j int) bool {
+		return m.queue[i].Created.Before(m.queue[j].Created)
+	})
+
+	for _, job := range m.queue {
+		m.parent.Log(logger.Info, "resuming export %s", job.ID)
+	}
+
+	return nil
+}
+
+func (m *exportManager) jobPath(id uuid.UUID) string {
+	return filepath.Join(m.path, id.String()+".json")
+}
+
+func (m *exportManager) filePath(id uuid.UUID) string {
+	return filepath.Join(m.path, id.String()+".mp4")
+}
+
+// dirPath returns the directory of exports that are made of multiple files.
+func (m *exportManager) dirPath(id uuid.UUID) string {
+	return filepath.Join(m.path, id.String())
+}
+
+// save writes a job to disk atomically. It must be called with the mutex locked.
+func (m *exportManager) save(job *exportJob) error {
+	buf, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	tmp := m.jobPath(job.ID) + ".tmp"
+
+	err = os.WriteFile(tmp, buf, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.jobPath(job.ID))
+}
+
+func (m *exportManager) add(
+	pathName string,
+	start time.Time,
+	duration time.Duration,
+	format string,
+	gapPolicy string,
+	applyPrivacy bool,
+	lookbackLimit time.Time,
+	encryption string,
+	keyExpires *time.Time,
+	integrity string,
+	priority conf.PlaybackPriority,
+	profile string,
+	requestedBy string,
+	idempotencyKey string,
+) (exportJob, bool, error) {
+	job := &exportJob{
+		ID:             uuid.New(),
+		Created:        time.Now(),
+		Path:           pathName,
+		Start:          start,
+		Duration:       listEntryDuration(duration),
+		Format:         format,
+		GapPolicy:      gapPolicy,
+		Integrity:      integrity,
+		Priority:       priority,
+		Profile:        profile,
+		Status:         exportJobQueued,
+		ApplyPrivacy:   applyPrivacy,
+		IdempotencyKey: idempotencyKey,
+	}
+
+	if profile == exportProfileLegal {
+		job.RequestedBy = requestedBy
+	}
+
+	if !lookbackLimit.IsZero() {
+		job.LookbackLimit = &lookbackLimit
+	}
+
+	if encryption != "" {
+		kid := uuid.New()
+		job.Encryption = encryption
+		job.KeyID = &kid
+		job.KeyExpires = keyExpires
+		job.Key = make([]byte, 16)
+
+		_, err := rand.Read(job.Key)
+		if err != nil {
+			return exportJob{}, false, err
+		}
+
+		token := make([]byte, 16)
+		_, err = rand.Read(token)
+		if err != nil {
+			return exportJob{}, false, err
+		}
+		job.KeyToken = hex.EncodeToString(token)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// retried requests return the job created by the first one
+	if idempotencyKey != "" {
+		if existing := m.idempotentJob(idempotencyKey, job.Created); existing != nil {
+			if !existing.sameRequest(job) {
+				return exportJob{}, false, errIdempotencyKeyReused
+			}
+			return *existing, true, nil
+		}
+	}
+
+	enqueued, err := m.enqueueLocked(job)
+	return enqueued, false, err
+}
+
+// enqueue saves a new job, queues it and returns a copy of it.
+func (m *exportManager) enqueue(job *exportJob) (exportJob, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.enqueueLocked(job)
+}
+
+func (m *exportManager) enqueueLocked(job *exportJob) (exportJob, error) {
+	if exportIsDirectory(job.Format) {
+		job.Directory, _ = filepath.Abs(m.dirPath(job.ID))
+	}
+
+	err := m.save(job)
+	if err != nil {
+		return exportJob{}, err
+	}
+
+	m.jobs[job.ID] = job
+	m.queue = append(m.queue, job)
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+
+	return *job, nil
+}
+
+// get returns a copy of a job.
+func (m *exportManager) get(id uuid.UUID) (exportJob, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return exportJob{}, false
+	}
+
+	cpy := *job
+	cpy.Progress = m.progressLocked(job)
+	return cpy, true
+}
+
+// progressLocked returns the percent of the timespan of a job that has been exported.
+func (m *exportManager) progressLocked(job *exportJob) *float64 {
+	if job.Status == exportJobFailed {
+		return nil
+	}
+
+	var v float64
+
+	switch {
+	case job.Status == exportJobDone:
+		v = 100
+
+	// jobs that were running when the server was stopped are in running state until they are restarted
+	case job == m.running:
+		v = m.progress.event().Percent
+	}
+
+	return &v
+}
+
+// withProgress tracks the progress of the running job through a muxer.
+func (m *exportManager) withProgress(mux muxer) muxer {
+	return &muxerProgress{muxer: mux, progress: m.progress}
+}
+
+func (m *exportManager) setStatus(job *exportJob, status exportJobStatus, jobErr error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	job.Status = status
+	if jobErr != nil {
+		job.Error = jobErr.Error()
+	} else {
+		job.Error = ""
+	}
+
+	err := m.save(job)
+	if err != nil {
+		m.parent.Log(logger.Warn, "unable to save export %s: %v", job.ID, err)
+	}
+}
+
+func (m *exportManager) setCheckpoint(job *exportJob, checkpoint *exportCheckpoint) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	job.Checkpoint = checkpoint
+
+	return m.save(job)
+}
+
+func (m *exportManager) setIntegrityReport(job *exportJob, report *integrityReport) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	job.IntegrityReport = report
+
+	return m.save(job)
+}
+
+func (m *exportManager) run() {
+	defer close(m.done)
+
+	for {
+		m.mutex.Lock()
+		job, wait := m.nextJobLocked(time.Now())
+		m.mutex.Unlock()
+
+		if job == nil {
+			var timer <-chan time.Time
+			if wait > 0 {
+				timer = time.After(wait)
+			}
+
+			select {
+			case <-m.wake:
+				continue
+			case <-timer:
+				continue
+			case <-m.ctx.Done():
+				return
+			}
+		}
+
+		if m.parent.limiter != nil {
+			err := m.parent.limiter.acquire(m.ctx, job.Priority)
+			if err != nil {
+				return
+			}
+		}
+
+		m.mutex.Lock()
+		m.running = job
+		m.progress = &downloadProgress{
+			path:     job.Path,
+			duration: time.Duration(job.Duration),
+		}
+		m.mutex.Unlock()
+
+		m.setStatus(job, exportJobRunning, nil)
+
+		m.parent.Log(logger.Info, "export %s started", job.ID)
+
+		started := time.Now()
+		err := m.runJob(job)
+
+		// the custody report is signed together with the export
+		if err == nil && job.Profile == exportProfileLegal {
+			err = m.writeCustody(job, started)
+		}
+
+		// directory exports are not made of a single file. Clone exports are made of raw segments,
+		// that are covered by their checksums.
+		if err == nil && m.signingKey != nil && !exportIsDirectory(job.Format) {
+			err = m.sign(job)
+		}
+
+		if err == nil && job.Destination != "" {
+			err = m.deliver(job)
+		}
+
+		if m.parent.limiter != nil {
+			m.parent.limiter.release()
+		}
+
+		m.mutex.Lock()
+		m.running = nil
+		m.progress = nil
+		m.mutex.Unlock()
+
+		// server is closing, leave the job in running state in order to resume it later
+		if m.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			if job.Attempts < job.Retries {
+				m.parent.Log(logger.Warn, "export %s failed, retrying in %v: %v", job.ID, exportRetryPause, err)
+				m.retry(job, err)
+				continue
+			}
+
+			m.parent.Log(logger.Warn, "export %s failed: %v", job.ID, err)
+			m.setStatus(job, exportJobFailed, err)
+			m.parent.Notifier.Publish(notify.Event{
+				Type: notify.EventExportFailed,
+				Path: job.Path,
+				Fields: map[string]string{
+					"id":    job.ID.String(),
+					"error": err.Error(),
+				},
+			})
+		} else {
+			m.parent.Log(logger.Info, "export %s completed", job.ID)
+			m.setStatus(job, exportJobDone, nil)
+			m.parent.Notifier.Publish(notify.Event{
+				Type:   notify.EventExportDone,
+				Path:   job.Path,
+				Fields: map[string]string{"id": job.ID.String()},
+			})
+		}
+	}
+}
+
+// nextJobLocked removes from the queue and returns the first job that can be run.
+// When no job can be run, it returns the time until the first delayed job can be run, if any.
+func (m *exportManager) nextJobLocked(now time.Time) (*exportJob, time.Duration) {
+	var wait time.Duration
+
+	for i, job := range m.queue {
+		if job.NotBefore != nil && job.NotBefore.After(now) {
+			d := job.NotBefore.Sub(now)
+			if wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		m.queue = append(m.queue[:i], m.queue[i+1:]...)
+		return job, 0
+	}
+
+	return nil, wait
+}
+
+// privacy returns the privacy intervals that apply to a job.
+// They are read when the job is run, in order to include intervals that have been added in the meanwhile.
+func (m *exportManager) privacy(job *exportJob) []privacyInterval {
+	if !job.ApplyPrivacy {
+		return nil
+	}
+	return m.parent.privacyIntervals(job.Path)
+}
+
+func (m *exportManager) runJob(job *exportJob) error {
+	pathConf, err := m.parent.safeFindPathConf(job.Path)
+	if err != nil {
+		return err
+	}
+
+	duration := time.Duration(job.Duration)
+
+	// configuration may have changed since the job was created
+	err = checkPlayback(pathConf, playbackFormat(job.Format), duration)
+	if err != nil {
+		return err
+	}
+
+	if job.Profile == exportProfileLegal {
+		err = checkLegalExport(pathConf, job.Format, job.GapPolicy, m.signingKey != nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	segments, err := m.parent.segmentCache.findSegmentsInTimespan(pathConf, job.Path, job.Start, duration)
+	if err != nil {
+		return err
+	}
+
+	filler, err := loadPathGapFiller(pathConf, job.GapPolicy, m.parent.boxLimits)
+	if err != nil {
+		return err
+	}
+
+	// exports wait for a slot instead of failing, since they run in background
+	err = m.parent.muxers.acquire(m.ctx, job.Path, pathConf.PlaybackMaxConcurrentMuxers)
+	if err != nil {
+		return err
+	}
+	defer m.parent.muxers.release(job.Path)
+
+	releaseReader, err := m.parent.Registry.AcquireReader(m.ctx, job.Path, pathConf.PlaybackMaxReaders)
+	if err != nil {
+		return err
+	}
+	defer releaseReader()
+
+	if job.Integrity == "verify" {
+		report := verifySegments(segments)
+
+		err = m.setIntegrityReport(job, report)
+		if err != nil {
+			return err
+		}
+
+		// legal exports cannot contain segments whose integrity is not proven
+		if job.Profile == exportProfileLegal && report.Result != integrityVerified {
+			return fmt.Errorf("segments cannot be verified: %s", report.Result)
+		}
+	}
+
+	// clone exports contain whole raw segments, that cannot be masked,
+	// therefore checks are performed on the timespan they cover.
+	if job.Format == "clone" {
+		if job.LookbackLimit != nil {
+			err = checkLookback(*job.LookbackLimit, segments[0].Start)
+			if err != nil {
+				return err
+			}
+		}
+
+		if privacy := m.privacy(job); len(privacy) != 0 {
+			var segsEnd time.Time
+			segsEnd, err = segmentsEnd(pathConf.RecordFormat, m.parent.boxLimits, segments)
+			if err != nil {
+				return err
+			}
+
+			if privacyOverlaps(privacy, segments[0].Start, segsEnd) {
+				return fmt.Errorf("timespan contains hidden recordings")
+			}
+		}
+
+		return m.runJobClone(job, archiveFiles(pathConf, segments))
+	}
+
+	if job.Format == "static" {
+		return m.runJobStatic(job, pathConf, segments, filler)
+	}
+
+	// fMP4 exports without filters are made of independent parts,
+	// therefore they can be resumed from the last completed segment.
+	// MP4 exports are written all at once at the end, and filters have an internal state.
+	if job.Format != "mp4" && pathConf.PlaybackFilter == "" {
+		return m.runJobResumable(job, pathConf.RecordFormat, segments, filler)
+	}
+
+	if job.Encryption != "" {
+		return fmt.Errorf("encryption is not compatible with MP4 format and playbackFilter")
+	}
+
+	f, err := os.Create(m.filePath(job.ID))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+
+	var filter *exportFilter
+	if pathConf.PlaybackFilter != "" {
+		filter, err = startExportFilter(m.ctx, pathConf.PlaybackFilter, []string{
+			"MTX_PATH=" + job.Path,
+			"MTX_START=" + job.Start.Format(time.RFC3339Nano),
+			"MTX_DURATION=" + strconv.FormatFloat(duration.Seconds(), 'f', -1, 64),
+		}, f)
+		if err != nil {
+			return err
+		}
+		w = filter
+	}
+
+	var mux muxer
+	if job.Format == "mp4" {
+		mp4Mux := &muxerMP4{
+			w:           w,
+			tempDir:     m.parent.TempDir,
+			memoryLimit: uint64(m.parent.MemoryLimit),
+		}
+		defer mp4Mux.close()
+		mux = mp4Mux
+	} else {
+		mux = &muxerFMP4{w: w}
+	}
+
+	err = seekAndMux(pathConf.RecordFormat, m.parent.boxLimits, segments, job.Start, duration, m.privacy(job), filler,
+		&muxerContext{ctx: m.ctx, muxer: m.withProgress(mux)})
+
+	if filter != nil {
+		err2 := filter.close()
+		if err == nil {
+			err = err2
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func (m *exportManager) runJobResumable(
+	job *exportJob,
+	recordFormat conf.RecordFormat,
+	segments []*Segment,
+	filler *gapFiller,
+) error {
+	var f *os.File
+	var mux *muxerFMP4
+	var from muxCheckpoint
+
+	checkpoint := job.Checkpoint
+
+	// recordings may have been deleted in the meanwhile
+	if checkpoint != nil && checkpoint.Segments > len(segments) {
+		checkpoint = nil
+	}
+
+	if checkpoint != nil {
+		var err error
+		f, err = os.OpenFile(m.filePath(job.ID), os.O_WRONLY, 0o644)
+		if err == nil {
+			err = f.Truncate(checkpoint.Offset)
+			if err == nil {
+				_, err = f.Seek(checkpoint.Offset, io.SeekStart)
+			}
+			if err != nil {
+				f.Close()
+			}
+		}
+
+		if err != nil {
+			m.parent.Log(logger.Warn, "unable to resume export %s, restarting it: %v", job.ID, err)
+			checkpoint = nil
+		} else {
+			m.parent.Log(logger.Info, "export %s resumed from segment %d", job.ID, checkpoint.Segments)
+			mux = &muxerFMP4{
+				w:                  f,
+				skipInit:           true,
+				nextSequenceNumber: checkpoint.SequenceNumber,
+				resumedTracks:      checkpoint.StartedTracks,
+			}
+			from = muxCheckpoint{
+				segments: checkpoint.Segments,
+				end:      checkpoint.SegmentEnd,
+			}
+		}
+	}
+
+	if checkpoint == nil {
+		var err error
+		f, err = os.Create(m.filePath(job.ID))
+		if err != nil {
+			return err
+		}
+		mux = &muxerFMP4{w: f}
+	}
+
+	defer f.Close()
+
+	if job.Encryption != "" {
+		var err error
+		mux.cenc, err = newCENCEncrypter(*job.KeyID, job.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if job.Profile == exportProfileLegal {
+		var err error
+		mux.keepTiming = true
+		mux.comment, err = exportLegalComment(job)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := seekAndMuxResume(
+		recordFormat,
+		m.parent.boxLimits,
+		segments,
+		job.Start,
+		time.Duration(job.Duration),
+		m.privacy(job),
+		filler,
+		&muxerContext{ctx: m.ctx, muxer: m.withProgress(mux)},
+		from,
+		func(c muxCheckpoint) error {
+			err := mux.flushCheckpoint()
+			if err != nil {
+				return err
+			}
+
+			err = f.Sync()
+			if err != nil {
+				return err
+			}
+
+			offset, err := f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+
+			return m.setCheckpoint(job, &exportCheckpoint{
+				Segments:       c.segments,
+				SegmentEnd:     c.end,
+				Offset:         offset,
+				SequenceNumber: mux.nextSequenceNumber,
+				StartedTracks:  mux.startedTracks(),
+			})
+		})
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// muxerContext stops muxing when the context is canceled.
+type muxerContext struct {
+	ctx context.Context
+	muxer
+}
+
+func (m *muxerContext) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	getPayload func() ([]byte, error),
+) error {
+	if m.ctx.Err() != nil {
+		return fmt.Errorf("terminated")
+	}
+	return m.muxer.writeSample(dts, ptsOffset, isNonSyncSample, payloadSize, getPayload)
+}
@@ -0,0 +1,300 @@
+package playback
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
+)
+
+var exportRetryPause = 1 * time.Minute
+
+// time waited after the end of the timespan of exports triggered by events,
+// in order to allow the recorder to write it.
+var exportEventDelay = 10 * time.Second
+
+// exportFileName returns the name of files that contain a timespan of a path.
+func exportFileName(pathName string, start time.Time) string {
+	return strings.ReplaceAll(pathName, "/", "_") + "_" + start.Format("20060102T150405")
+}
+
+// runScheduler creates the exports of schedules when they are due.
+// Runs that were due while the server was stopped are skipped.
+func (m *exportManager) runScheduler() {
+	defer close(m.schedulerDone)
+
+	for {
+		now := time.Now()
+		var next time.Time
+
+		for _, schedule := range m.schedules {
+			t := schedule.Schedule.Next(now)
+			if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+
+		if next.IsZero() {
+			<-m.ctx.Done()
+			return
+		}
+
+		select {
+		case <-time.After(time.Until(next)):
+		case <-m.ctx.Done():
+			return
+		}
+
+		for _, schedule := range m.schedules {
+			if schedule.Schedule.Next(next.Add(-time.Minute)).Equal(next) {
+				m.schedule(schedule, next)
+			}
+		}
+	}
+}
+
+func (m *exportManager) schedule(schedule conf.PlaybackExportSchedule, t time.Time) {
+	m.enqueueScheduled(schedule, &exportJob{
+		Path:     schedule.Path,
+		Start:    t.Add(-time.Duration(schedule.Start)),
+		Duration: listEntryDuration(schedule.Duration),
+	})
+}
+
+// onEvents creates the exports of the rules that are triggered by events.
+func (m *exportManager) onEvents(events []*annotation) {
+	for _, a := range events {
+		for _, schedule := range m.schedules {
+			if schedule.Event == "" || schedule.Event != a.Label ||
+				(schedule.Path != "" && schedule.Path != a.Path) {
+				continue
+			}
+
+			start := a.Start.Add(-time.Duration(schedule.Start))
+			end := a.Start.Add(time.Duration(a.Duration) + time.Duration(schedule.End))
+
+			if !end.After(start) {
+				m.parent.Log(logger.Warn, "export of path '%s' skipped: timespan is empty", a.Path)
+				continue
+			}
+
+			notBefore := end.Add(exportEventDelay)
+
+			m.enqueueScheduled(schedule, &exportJob{
+				Path:      a.Path,
+				Start:     start,
+				Duration:  listEntryDuration(end.Sub(start)),
+				NotBefore: &notBefore,
+			})
+		}
+	}
+}
+
+// enqueueScheduled fills a job with the parameters of a rule and queues it.
+func (m *exportManager) enqueueScheduled(schedule conf.PlaybackExportSchedule, job *exportJob) {
+	if m.parent.inMaintenanceMode() {
+		m.parent.Log(logger.Warn, "export of path '%s' skipped: %v", job.Path, errMaintenanceMode)
+		return
+	}
+
+	job.ID = uuid.New()
+	job.Created = time.Now()
+	job.Format = schedule.Format
+	job.Priority = conf.PlaybackPriorityBackup
+	job.Status = exportJobQueued
+	job.Destination = schedule.Directory
+	job.Retries = schedule.Retries
+
+	_, err := m.enqueue(job)
+	if err != nil {
+		m.parent.Log(logger.Warn, "unable to schedule export of path '%s': %v", job.Path, err)
+		return
+	}
+
+	m.parent.Log(logger.Info, "export %s scheduled", job.ID)
+}
+
+// retry queues again a failed job after a pause.
+func (m *exportManager) retry(job *exportJob, jobErr error) {
+	m.mutex.Lock()
+	job.Attempts++
+	m.mutex.Unlock()
+
+	m.setStatus(job, exportJobQueued, jobErr)
+
+	time.AfterFunc(exportRetryPause, func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if m.ctx.Err() != nil {
+			return
+		}
+
+		m.queue = append(m.queue, job)
+
+		select {
+		case m.wake <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// deliver copies the result of a job into its destination.
+// Files are linked when possible, and are renamed into place once they are complete.
+func (m *exportManager) deliver(job *exportJob) error {
+	if s3.IsURL(job.Destination) {
+		return m.deliverS3(job)
+	}
+
+	err := os.MkdirAll(job.Destination, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := exportFileName(job.Path, job.Start)
+
+	if exportIsDirectory(job.Format) {
+		dest := filepath.Join(job.Destination, name)
+		tmp := dest + ".tmp"
+
+		os.RemoveAll(tmp)
+
+		src := m.dirPath(job.ID)
+
+		err = filepath.Walk(src, func(fpath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, _ := filepath.Rel(src, fpath)
+
+			if info.IsDir() {
+				return os.MkdirAll(filepath.Join(tmp, rel), 0o755)
+			}
+
+			_, err = cloneFile(fpath, filepath.Join(tmp, rel))
+			return err
+		})
+		if err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+
+		os.RemoveAll(dest)
+		return os.Rename(tmp, dest)
+	}
+
+	dest := filepath.Join(job.Destination, name+".mp4")
+	tmp := dest + ".tmp"
+
+	os.Remove(tmp)
+
+	_, err = cloneFile(m.filePath(job.ID), tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	err = os.Rename(tmp, dest)
+	if err != nil {
+		return err
+	}
+
+	if m.signingKey != nil {
+		_, err = cloneFile(m.signaturePath(job.ID), dest+".sig")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliverS3 uploads the result of a job into a S3 prefix.
+// Objects cannot be renamed, therefore the file that marks a directory as complete is uploaded last.
+func (m *exportManager) deliverS3(job *exportJob) error {
+	client, err := s3.ParseURL(job.Destination)
+	if err != nil {
+		return err
+	}
+
+	name := exportFileName(job.Path, job.Start)
+
+	type upload struct {
+		fpath string
+		name  string
+	}
+
+	var files []upload
+
+	if exportIsDirectory(job.Format) {
+		src := m.dirPath(job.ID)
+
+		marker := "manifest.json"
+		if job.Format == "static" {
+			marker = staticPlaylistName
+		}
+
+		err = filepath.Walk(src, func(fpath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			rel, _ := filepath.Rel(src, fpath)
+			if rel != marker {
+				files = append(files, upload{fpath, name + "/" + filepath.ToSlash(rel)})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		files = append(files, upload{filepath.Join(src, marker), name + "/" + marker})
+	} else {
+		files = append(files, upload{m.filePath(job.ID), name + ".mp4"})
+
+		if m.signingKey != nil {
+			files = append(files, upload{m.signaturePath(job.ID), name + ".mp4.sig"})
+		}
+	}
+
+	for _, file := range files {
+		if m.ctx.Err() != nil {
+			return fmt.Errorf("terminated")
+		}
+
+		err = s3Upload(client, file.fpath, client.Key(file.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func s3Upload(client *s3.Client, fpath string, key string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return client.Put(key, f, fi.Size())
+}
@@ -0,0 +1,144 @@
+package playback
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// exportSignatureManifest describes an export and the server that produced it.
+type exportSignatureManifest struct {
+	ID         uuid.UUID         `json:"id"`
+	Server     string            `json:"server"`
+	Path       string            `json:"path"`
+	Start      time.Time         `json:"start"`
+	Duration   listEntryDuration `json:"duration"`
+	Format     string            `json:"format"`
+	Encryption string            `json:"encryption,omitempty"`
+	Profile    string            `json:"profile,omitempty"`
+	Size       int64             `json:"size"`
+	SHA256     string            `json:"sha256"`
+	Signed     time.Time         `json:"signed"`
+	PublicKey  string            `json:"publicKey"`
+
+	// SHA256 hash of the chain-of-custody report of legal exports
+	Custody string `json:"custody,omitempty"`
+}
+
+// exportSignature is a manifest followed by the Ed25519 signature of its bytes.
+// The manifest is kept in raw form, in order to allow recipients to verify it
+// without encoding it again.
+type exportSignature struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature string          `json:"signature"`
+}
+
+// loadExportSigningKey reads an Ed25519 private key in PKCS #8 PEM format.
+func loadExportSigningKey(fpath string) (ed25519.PrivateKey, error) {
+	buf, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(buf)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("export signing key is not a PEM private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("export signing key is not an Ed25519 key")
+	}
+
+	return edKey, nil
+}
+
+func fileSHA256(fpath string) (int64, string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (m *exportManager) signaturePath(id uuid.UUID) string {
+	return m.filePath(id) + ".sig"
+}
+
+// sign writes a signed manifest of an export next to the export.
+func (m *exportManager) sign(job *exportJob) error {
+	size, hash, err := fileSHA256(m.filePath(job.ID))
+	if err != nil {
+		return err
+	}
+
+	var custody string
+	if job.Profile == exportProfileLegal {
+		_, custody, err = fileSHA256(m.custodyPath(job.ID))
+		if err != nil {
+			return err
+		}
+	}
+
+	hostname, _ := os.Hostname()
+
+	manifest, err := json.Marshal(exportSignatureManifest{
+		ID:         job.ID,
+		Server:     hostname,
+		Path:       job.Path,
+		Start:      job.Start,
+		Duration:   job.Duration,
+		Format:     job.Format,
+		Encryption: job.Encryption,
+		Profile:    job.Profile,
+		Size:       size,
+		SHA256:     hash,
+		Signed:     time.Now(),
+		PublicKey:  base64.StdEncoding.EncodeToString(m.signingKey.Public().(ed25519.PublicKey)),
+		Custody:    custody,
+	})
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(exportSignature{
+		Manifest:  manifest,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(m.signingKey, manifest)),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp := m.signaturePath(job.ID) + ".tmp"
+
+	err = os.WriteFile(tmp, buf, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.signaturePath(job.ID))
+}
@@ -0,0 +1,288 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/gohlslib/pkg/codecparams"
+	"github.com/bluenviron/gohlslib/pkg/codecs"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+const (
+	staticSegmentDuration = 10 * time.Second
+	staticPlaylistName    = "index.m3u8"
+	staticManifestName    = "manifest.mpd"
+)
+
+// staticSegment is a media segment of a static export.
+type staticSegment struct {
+	name     string
+	offset   time.Duration
+	duration time.Duration
+	size     int
+	// previous chunks did not contain recordings
+	discontinuity bool
+}
+
+func staticSegmentName(n int) string {
+	return "segment" + strconv.FormatInt(int64(n), 10) + ".m4s"
+}
+
+// staticCodecs returns the RFC 6381 codecs of the tracks of an initialization segment.
+func staticCodecs(init *fmp4.Init) string {
+	var out []string
+	for _, track := range init.Tracks {
+		if v := codecparams.Marshal(codecs.FromFMP4(track.Codec)); v != "" {
+			out = append(out, v)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// staticPlaylist returns a HLS playlist that contains the segments.
+func staticPlaylist(segments []staticSegment) []byte {
+	var b strings.Builder
+
+	b.WriteString("#EXTM3U\n" +
+		"#EXT-X-VERSION:7\n" +
+		"#EXT-X-TARGETDURATION:" + strconv.FormatInt(int64(math.Ceil(staticSegmentDuration.Seconds())), 10) + "\n" +
+		"#EXT-X-MEDIA-SEQUENCE:0\n" +
+		"#EXT-X-PLAYLIST-TYPE:VOD\n" +
+		"#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"#EXT-X-MAP:URI=\"init.mp4\"\n")
+
+	for _, seg := range segments {
+		if seg.discontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		b.WriteString("#EXTINF:" + strconv.FormatFloat(seg.duration.Seconds(), 'f', 3, 64) + ",\n" +
+			seg.name + "\n")
+	}
+
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	return []byte(b.String())
+}
+
+type staticMPDSegment struct {
+	T int64 `xml:"t,attr"`
+	D int64 `xml:"d,attr"`
+}
+
+type staticMPDSegmentTemplate struct {
+	Timescale      int                `xml:"timescale,attr"`
+	Initialization string             `xml:"initialization,attr"`
+	Media          string             `xml:"media,attr"`
+	StartNumber    int                `xml:"startNumber,attr"`
+	Segments       []staticMPDSegment `xml:"SegmentTimeline>S"`
+}
+
+type staticMPDRepresentation struct {
+	ID        string `xml:"id,attr"`
+	Bandwidth int64  `xml:"bandwidth,attr"`
+	Codecs    string `xml:"codecs,attr,omitempty"`
+}
+
+type staticMPDAdaptationSet struct {
+	MimeType        string                   `xml:"mimeType,attr"`
+	SegmentTemplate staticMPDSegmentTemplate `xml:"SegmentTemplate"`
+	Representation  staticMPDRepresentation  `xml:"Representation"`
+}
+
+type staticMPD struct {
+	XMLName                   xml.Name               `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Type                      string                 `xml:"type,attr"`
+	Profiles                  string                 `xml:"profiles,attr"`
+	MinBufferTime             string                 `xml:"minBufferTime,attr"`
+	MediaPresentationDuration string                 `xml:"mediaPresentationDuration,attr"`
+	AdaptationSet             staticMPDAdaptationSet `xml:"Period>AdaptationSet"`
+}
+
+// staticManifest returns a DASH manifest that contains the segments.
+// Tracks are multiplexed into the same segments, therefore they are described by a single representation.
+func staticManifest(init *fmp4.Init, segments []staticSegment) ([]byte, error) {
+	mpd := staticMPD{
+		Type:          "static",
+		Profiles:      "urn:mpeg:dash:profile:isoff-live:2011",
+		MinBufferTime: "PT" + strconv.FormatInt(int64(staticSegmentDuration.Seconds()), 10) + "S",
+		AdaptationSet: staticMPDAdaptationSet{
+			MimeType: "video/mp4",
+			SegmentTemplate: staticMPDSegmentTemplate{
+				Timescale:      1000,
+				Initialization: "init.mp4",
+				Media:          "segment$Number$.m4s",
+			},
+			Representation: staticMPDRepresentation{
+				ID:     "0",
+				Codecs: staticCodecs(init),
+			},
+		},
+	}
+
+	var end time.Duration
+	var size int64
+
+	for _, seg := range segments {
+		mpd.AdaptationSet.SegmentTemplate.Segments = append(mpd.AdaptationSet.SegmentTemplate.Segments,
+			staticMPDSegment{
+				T: seg.offset.Milliseconds(),
+				D: seg.duration.Milliseconds(),
+			})
+		end = seg.offset + seg.duration
+		size += int64(seg.size)
+	}
+
+	mpd.MediaPresentationDuration = "PT" + strconv.FormatFloat(end.Seconds(), 'f', 3, 64) + "S"
+
+	if end > 0 {
+		mpd.AdaptationSet.Representation.Bandwidth = int64(float64(size*8) / end.Seconds())
+	}
+
+	buf, err := xml.MarshalIndent(mpd, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), buf...), nil
+}
+
+// runJobStatic fills the directory of the job with an initialization segment,
+// media segments, a HLS playlist and a DASH manifest, that can be served by any static host.
+// Since the directory is made of independent files, the job is always restarted from scratch.
+func (m *exportManager) runJobStatic(
+	job *exportJob,
+	pathConf *conf.Path,
+	segments []*Segment,
+	filler *gapFiller,
+) error {
+	if pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		return fmt.Errorf("MPEG-TS format is not supported yet")
+	}
+
+	dir := m.dirPath(job.ID)
+
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	init, err := func() (*fmp4.Init, error) {
+		f, err2 := segments[0].open()
+		if err2 != nil {
+			return nil, err2
+		}
+		defer f.Close()
+
+		return segmentFMP4ReadInit(f, m.parent.boxLimits)
+	}()
+	if err != nil {
+		return err
+	}
+
+	var buf seekablebuffer.Buffer
+	err = init.Marshal(&buf)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "init.mp4"), buf.Bytes(), 0o644)
+	if err != nil {
+		return err
+	}
+
+	duration := time.Duration(job.Duration)
+	privacy := m.privacy(job)
+	var staticSegments []staticSegment
+	var sequenceNumber uint32
+	skipped := false
+
+	for offset := time.Duration(0); offset < duration; offset += staticSegmentDuration {
+		chunkStart := job.Start.Add(offset)
+		chunkDuration := min(staticSegmentDuration, duration-offset)
+
+		chunkSegments, err := m.parent.segmentCache.findSegmentsInTimespan(pathConf, job.Path, chunkStart, chunkDuration)
+		if err != nil {
+			if errors.Is(err, errNoSegmentsFound) {
+				skipped = true
+				continue
+			}
+			return err
+		}
+
+		var chunk bytes.Buffer
+		mux := &muxerFMP4{
+			w:                  &chunk,
+			skipInit:           true,
+			nextSequenceNumber: sequenceNumber,
+		}
+
+		err = seekAndMux(pathConf.RecordFormat, m.parent.boxLimits, chunkSegments, chunkStart, chunkDuration, privacy, filler,
+			&muxerContext{
+				ctx: m.ctx,
+				muxer: &muxerOffset{
+					muxer:  m.withProgress(mux),
+					offset: offset,
+				},
+			})
+		if err != nil && !errors.Is(err, errNoSegmentsFound) {
+			return err
+		}
+
+		if chunk.Len() == 0 {
+			skipped = true
+			continue
+		}
+
+		sequenceNumber = mux.nextSequenceNumber
+
+		seg := staticSegment{
+			name:          staticSegmentName(len(staticSegments)),
+			offset:        offset,
+			duration:      chunkDuration,
+			size:          chunk.Len(),
+			discontinuity: skipped && len(staticSegments) != 0,
+		}
+
+		err = os.WriteFile(filepath.Join(dir, seg.name), chunk.Bytes(), 0o644)
+		if err != nil {
+			return err
+		}
+
+		staticSegments = append(staticSegments, seg)
+		skipped = false
+	}
+
+	if len(staticSegments) == 0 {
+		return errNoSegmentsFound
+	}
+
+	manifest, err := staticManifest(init, staticSegments)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(dir, staticManifestName), manifest, 0o644)
+	if err != nil {
+		return err
+	}
+
+	// the playlist is written last, therefore its presence means that the directory is complete
+	return os.WriteFile(filepath.Join(dir, staticPlaylistName), staticPlaylist(staticSegments), 0o644)
+}
@@ -0,0 +1,108 @@
+package playback
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// gapFiller fills gaps between segments with a pre-encoded clip.
+type gapFiller struct {
+	fpath    string
+	limits   boxLimits
+	init     *fmp4.Init
+	duration time.Duration
+}
+
+func loadGapFiller(fpath string, limits boxLimits) (*gapFiller, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	init, err := segmentFMP4ReadInit(f, limits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filler: %w", err)
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := segmentFMP4ReadMaxDuration(f, limits, init)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filler: %w", err)
+	}
+
+	if duration <= 0 {
+		return nil, fmt.Errorf("invalid filler: clip is empty")
+	}
+
+	return &gapFiller{
+		fpath:    fpath,
+		limits:   limits,
+		init:     init,
+		duration: duration,
+	}, nil
+}
+
+// loadPathGapFiller returns the filler of a path, if gaps must be filled.
+func loadPathGapFiller(pathConf *conf.Path, gapPolicy string, limits boxLimits) (*gapFiller, error) {
+	if gapPolicy != "pad" {
+		return nil, nil
+	}
+
+	if pathConf.PlaybackFiller == "" {
+		return nil, fmt.Errorf("gapPolicy 'pad' requires playbackFiller")
+	}
+
+	return loadGapFiller(pathConf.PlaybackFiller, limits)
+}
+
+// canFill checks whether the gap between two segments can be filled.
+// Since no initialization segment can be inserted, the filler must use the same codec parameters.
+func (g *gapFiller) canFill(
+	firstInit *fmp4.Init,
+	prevEnd time.Time,
+	curInit *fmp4.Init,
+	curStart time.Time,
+) bool {
+	return reflect.DeepEqual(g.init, firstInit) &&
+		reflect.DeepEqual(firstInit, curInit) &&
+		curStart.After(prevEnd)
+}
+
+// fill writes the filler repeatedly between from and to, that are relative to the start of the muxer.
+func (g *gapFiller) fill(from time.Duration, to time.Duration, m muxer) error {
+	f, err := os.Open(g.fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for t := from; t < to; t += g.duration {
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		_, err = segmentFMP4ReadInit(f, g.limits)
+		if err != nil {
+			return err
+		}
+
+		_, err = segmentFMP4MuxParts(f, g.limits, t, to, g.init, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
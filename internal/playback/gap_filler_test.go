@@ -0,0 +1,92 @@
+package playback
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnGetGapPad(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	// two segments of 3 seconds with a gap of 5 seconds
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-10-500000.mp4"))
+
+	writeSegment2(t, filepath.Join(dir, "filler.mp4"))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+				PlaybackFiller: filepath.Join(dir, "filler.mp4"),
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	for _, ca := range []struct {
+		gapPolicy string
+		samples   int
+	}{
+		{"stop", 3},
+		// 3 samples of the first segment, 5 of the filler, 3 of the second segment
+		{"pad", 11},
+	} {
+		t.Run(ca.gapPolicy, func(t *testing.T) {
+			v := url.Values{}
+			v.Set("path", "mypath")
+			v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 2, 500000000, time.Local).Format(time.RFC3339Nano))
+			v.Set("duration", "11")
+			v.Set("gapPolicy", ca.gapPolicy)
+
+			res, err := http.Get("http://localhost:9996/get?" + v.Encode())
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			buf, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			var parts fmp4.Parts
+			err = parts.Unmarshal(buf)
+			require.NoError(t, err)
+
+			n := 0
+			var end uint64
+			for _, part := range parts {
+				for _, track := range part.Tracks {
+					n += len(track.Samples)
+					end = track.BaseTime
+					for _, sample := range track.Samples {
+						end += uint64(sample.Duration)
+					}
+				}
+			}
+
+			require.Equal(t, ca.samples, n)
+			require.Equal(t, uint64(ca.samples*90000), end)
+		})
+	}
+}
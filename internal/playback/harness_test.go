@@ -0,0 +1,422 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+// regenerate golden files with:
+// go test ./internal/playback -run TestHarness -update
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// harnessCorruption is a way in which a synthesized segment is damaged.
+type harnessCorruption int
+
+const (
+	harnessCorruptionNone harnessCorruption = iota
+
+	// the last fragment is cut in half, like after a power loss.
+	harnessCorruptionTruncated
+
+	// the segment doesn't contain a valid header.
+	harnessCorruptionGarbage
+)
+
+// harnessSegment describes a segment of a synthesized recording tree.
+type harnessSegment struct {
+	Start time.Time
+
+	// codecs of tracks, among H264, H265 and MPEG-4 Audio.
+	Codecs []string
+
+	// number of fragments and number of one-second samples of each fragment.
+	// The first sample of every fragment is a keyframe.
+	Fragments       int
+	FragmentSamples int
+
+	Corruption harnessCorruption
+
+	// add the segment to the index.
+	Indexed bool
+
+	// discontinuity stored in the index.
+	Discontinuity record.Discontinuity
+}
+
+func (s harnessSegment) duration() time.Duration {
+	return time.Duration(s.Fragments*s.FragmentSamples) * time.Second
+}
+
+func harnessInitTrack(id int, codec string) *fmp4.InitTrack {
+	track := &fmp4.InitTrack{
+		ID:        id,
+		TimeScale: 90000,
+	}
+
+	switch codec {
+	case "H264":
+		track.Codec = &fmp4.CodecH264{
+			SPS: test.FormatH264.SPS,
+			PPS: test.FormatH264.PPS,
+		}
+
+	case "H265":
+		track.Codec = &fmp4.CodecH265{
+			VPS: test.FormatH265.VPS,
+			SPS: test.FormatH265.SPS,
+			PPS: test.FormatH265.PPS,
+		}
+
+	case "MPEG-4 Audio":
+		track.Codec = &fmp4.CodecMPEG4Audio{
+			Config: mpeg4audio.Config{
+				Type:         mpeg4audio.ObjectTypeAACLC,
+				SampleRate:   48000,
+				ChannelCount: 2,
+			},
+		}
+
+	default:
+		panic(fmt.Sprintf("unsupported codec: %s", codec))
+	}
+
+	return track
+}
+
+func harnessMarshalSegment(t *testing.T, seg harnessSegment) []byte {
+	init := fmp4.Init{}
+
+	for i, codec := range seg.Codecs {
+		init.Tracks = append(init.Tracks, harnessInitTrack(i+1, codec))
+	}
+
+	var buf seekablebuffer.Buffer
+	err := init.Marshal(&buf)
+	require.NoError(t, err)
+
+	payload := byte(0)
+
+	for i := 0; i < seg.Fragments; i++ {
+		part := &fmp4.Part{
+			SequenceNumber: uint32(i + 1),
+		}
+
+		for j := range seg.Codecs {
+			track := &fmp4.PartTrack{
+				ID:       j + 1,
+				BaseTime: uint64(i*seg.FragmentSamples) * 90000,
+			}
+
+			for k := 0; k < seg.FragmentSamples; k++ {
+				payload++
+				track.Samples = append(track.Samples, &fmp4.PartSample{
+					Duration:        90000,
+					IsNonSyncSample: k != 0,
+					Payload:         []byte{payload, payload},
+				})
+			}
+
+			part.Tracks = append(part.Tracks, track)
+		}
+
+		err = part.Marshal(&buf)
+		require.NoError(t, err)
+	}
+
+	byts := buf.Bytes()
+
+	switch seg.Corruption {
+	case harnessCorruptionTruncated:
+		byts = byts[:len(byts)-8]
+
+	case harnessCorruptionGarbage:
+		byts = bytes.Repeat([]byte{0xde, 0xad}, 64)
+	}
+
+	return byts
+}
+
+// harnessTree is a synthesized recording tree of a path.
+type harnessTree struct {
+	dir         string
+	pathName    string
+	conf        *conf.Path
+	authManager serverAuthManager
+	registry    *record.Registry
+}
+
+// newHarnessTree writes segments into a temporary directory,
+// with the same layout used by the recorder.
+func newHarnessTree(t *testing.T, pathName string, segments []harnessSegment) *harnessTree {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	tr := &harnessTree{
+		dir:      dir,
+		pathName: pathName,
+		conf: &conf.Path{
+			RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			RecordFormat:   conf.RecordFormatFMP4,
+			PlaybackEnable: true,
+		},
+		registry: &record.Registry{},
+	}
+	tr.registry.Initialize()
+
+	err = os.MkdirAll(filepath.Join(dir, pathName), 0o755)
+	require.NoError(t, err)
+
+	for _, seg := range segments {
+		tr.addSegment(t, seg)
+	}
+
+	return tr
+}
+
+// addSegment writes a segment into the tree.
+func (tr *harnessTree) addSegment(t *testing.T, seg harnessSegment) {
+	fpath := filepath.Join(tr.dir, tr.pathName, seg.Start.Format("2006-01-02_15-04-05-000000")+".mp4")
+
+	err := os.WriteFile(fpath, harnessMarshalSegment(t, seg), 0o644)
+	require.NoError(t, err)
+
+	// when the index is enabled, segments are searched in the index only.
+	if seg.Indexed {
+		tr.conf.RecordIndexPath = filepath.Join(tr.dir, "index")
+
+		err = record.IndexAdd(tr.conf.RecordIndexPath, tr.pathName, record.IndexEntry{
+			Start:         seg.Start,
+			Duration:      seg.duration(),
+			Path:          fpath,
+			Codecs:        seg.Codecs,
+			Discontinuity: seg.Discontinuity,
+		})
+		require.NoError(t, err)
+	}
+
+	// invalidate cached segment lists, like the recorder does when a segment is completed.
+	tr.registry.SegmentsChanged(tr.pathName)
+}
+
+// serve starts a playback server that reads the tree.
+func (tr *harnessTree) serve(t *testing.T) {
+	authManager := tr.authManager
+	if authManager == nil {
+		authManager = test.NilAuthManager
+	}
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			tr.pathName: tr.conf,
+		},
+		AuthManager: authManager,
+		Registry:    tr.registry,
+		Parent:      test.NilLogger,
+	}
+	err := s.Initialize()
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+}
+
+// get performs a request against the playback server and returns status code and body.
+func (tr *harnessTree) get(t *testing.T, pathAndQuery string) (int, []byte) {
+	res, err := http.Get("http://localhost:9996" + pathAndQuery)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	byts, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res.StatusCode, byts
+}
+
+// requireGolden compares a response with the content of testdata/name,
+// or overwrites it when the -update flag is set.
+func requireGolden(t *testing.T, name string, byts []byte) {
+	fpath := filepath.Join("testdata", name)
+
+	if *updateGolden {
+		err := os.MkdirAll("testdata", 0o755)
+		require.NoError(t, err)
+
+		err = os.WriteFile(fpath, byts, 0o644)
+		require.NoError(t, err)
+		return
+	}
+
+	expected, err := os.ReadFile(fpath)
+	require.NoError(t, err, "golden file is missing, run tests with -update")
+	require.Equal(t, expected, byts, "response doesn't match %s", fpath)
+}
+
+func harnessList(t *testing.T, tr *harnessTree) []listEntry {
+	code, byts := tr.get(t, "/list?path="+tr.pathName)
+	require.Equal(t, http.StatusOK, code, string(byts))
+
+	var out []listEntry
+	err := json.Unmarshal(byts, &out)
+	require.NoError(t, err)
+
+	for i := range out {
+		out[i].Start = out[i].Start.Local()
+	}
+
+	return out
+}
+
+func TestHarness(t *testing.T) {
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.Local)
+
+	t.Run("gap", func(t *testing.T) {
+		tr := newHarnessTree(t, "mypath", []harnessSegment{
+			{
+				Start:           start,
+				Codecs:          []string{"H264", "MPEG-4 Audio"},
+				Fragments:       5,
+				FragmentSamples: 2,
+			},
+			{
+				Start:           start.Add(15 * time.Second),
+				Codecs:          []string{"H264", "MPEG-4 Audio"},
+				Fragments:       5,
+				FragmentSamples: 2,
+			},
+		})
+		tr.serve(t)
+
+		require.Equal(t, []listEntry{
+			{Start: start, Duration: listEntryDuration(10 * time.Second)},
+			{Start: start.Add(15 * time.Second), Duration: listEntryDuration(10 * time.Second)},
+		}, harnessList(t, tr))
+
+		for _, format := range []string{"fmp4", "mp4"} {
+			code, byts := tr.get(t, "/get?path=mypath&start="+
+				url.QueryEscape(start.Add(5*time.Second).Format(time.RFC3339Nano))+"&duration=15&format="+format)
+			require.Equal(t, http.StatusOK, code)
+			requireGolden(t, "gap."+format, byts)
+		}
+	})
+
+	t.Run("codec change", func(t *testing.T) {
+		tr := newHarnessTree(t, "mypath", []harnessSegment{
+			{
+				Start:           start,
+				Codecs:          []string{"H264"},
+				Fragments:       2,
+				FragmentSamples: 2,
+			},
+			{
+				Start:           start.Add(4 * time.Second),
+				Codecs:          []string{"H265"},
+				Fragments:       2,
+				FragmentSamples: 2,
+			},
+		})
+		tr.serve(t)
+
+		require.Equal(t, []listEntry{
+			{Start: start, Duration: listEntryDuration(4 * time.Second)},
+			{Start: start.Add(4 * time.Second), Duration: listEntryDuration(4 * time.Second)},
+		}, harnessList(t, tr))
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		tr := newHarnessTree(t, "mypath", []harnessSegment{
+			{
+				Start:           start,
+				Codecs:          []string{"H264"},
+				Fragments:       3,
+				FragmentSamples: 2,
+				Corruption:      harnessCorruptionTruncated,
+			},
+		})
+		tr.serve(t)
+
+		// the truncated fragment is ignored
+		require.Equal(t, []listEntry{
+			{Start: start, Duration: listEntryDuration(4 * time.Second)},
+		}, harnessList(t, tr))
+
+		code, byts := tr.get(t, "/get?path=mypath&start="+
+			url.QueryEscape(start.Format(time.RFC3339Nano))+"&duration=6&format=fmp4")
+		require.Equal(t, http.StatusOK, code)
+		requireGolden(t, "truncated.fmp4", byts)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		tr := newHarnessTree(t, "mypath", []harnessSegment{
+			{
+				Start:           start,
+				Codecs:          []string{"H264"},
+				Fragments:       2,
+				FragmentSamples: 2,
+			},
+			{
+				Start:      start.Add(4 * time.Second),
+				Corruption: harnessCorruptionGarbage,
+			},
+		})
+		tr.serve(t)
+
+		code, _ := tr.get(t, "/list?path=mypath")
+		require.Equal(t, http.StatusInternalServerError, code)
+
+		// segments before the damaged one can still be downloaded
+		code, byts := tr.get(t, "/get?path=mypath&start="+
+			url.QueryEscape(start.Format(time.RFC3339Nano))+"&duration=6&format=fmp4")
+		require.Equal(t, http.StatusOK, code)
+		requireGolden(t, "garbage.fmp4", byts)
+	})
+
+	t.Run("index recovery", func(t *testing.T) {
+		tr := newHarnessTree(t, "mypath", []harnessSegment{
+			{
+				Start:           start,
+				Codecs:          []string{"H264"},
+				Fragments:       2,
+				FragmentSamples: 2,
+				Indexed:         true,
+			},
+			{
+				Start:           start.Add(4 * time.Second),
+				Codecs:          []string{"H264"},
+				Fragments:       2,
+				FragmentSamples: 2,
+				Indexed:         true,
+			},
+		})
+
+		// entry truncated by a power loss
+		f, err := os.OpenFile(filepath.Join(tr.conf.RecordIndexPath, "mypath.jsonl"), os.O_WRONLY|os.O_APPEND, 0o644)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(`{"start":"2008-11-07T11:22:08Z","dur`))
+		require.NoError(t, err)
+		f.Close()
+
+		tr.serve(t)
+
+		require.Equal(t, []listEntry{
+			{Start: start, Duration: listEntryDuration(8 * time.Second)},
+		}, harnessList(t, tr))
+	})
+}
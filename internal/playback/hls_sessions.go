@@ -0,0 +1,80 @@
+package playback
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sessions that are not used for this period are removed, together with their key.
+const hlsSessionTimeout = 1 * time.Hour
+
+type hlsSession struct {
+	path     string
+	key      []byte
+	lastUsed time.Time
+}
+
+// hlsSessionManager stores the keys of encrypted HLS playlists.
+// Each playlist request generates a new session with its own key.
+// Sessions are kept in memory, since keys must not outlive the server.
+type hlsSessionManager struct {
+	mutex    sync.Mutex
+	sessions map[uuid.UUID]*hlsSession
+}
+
+func (m *hlsSessionManager) initialize() {
+	m.sessions = make(map[uuid.UUID]*hlsSession)
+}
+
+func (m *hlsSessionManager) removeExpired(now time.Time) {
+	for id, sess := range m.sessions {
+		if now.Sub(sess.lastUsed) >= hlsSessionTimeout {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+func (m *hlsSessionManager) add(pathName string) (uuid.UUID, error) {
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	id := uuid.New()
+	now := time.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.removeExpired(now)
+
+	m.sessions[id] = &hlsSession{
+		path:     pathName,
+		key:      key,
+		lastUsed: now,
+	}
+
+	return id, nil
+}
+
+// use returns the key of a session of the given path, and keeps the session alive.
+func (m *hlsSessionManager) use(id uuid.UUID, pathName string) ([]byte, bool) {
+	now := time.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.removeExpired(now)
+
+	sess, ok := m.sessions[id]
+	if !ok || sess.path != pathName {
+		return nil, false
+	}
+
+	sess.lastUsed = now
+	return sess.key, true
+}
@@ -0,0 +1,271 @@
+package playback
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/bluenviron/mediamtx/internal/record"
+)
+
+type integrityResult string
+
+const (
+	integrityVerified    integrityResult = "verified"
+	integrityFailed      integrityResult = "failed"
+	integrityRepaired    integrityResult = "repaired"
+	integrityUnavailable integrityResult = "unavailable"
+)
+
+type integritySegment struct {
+	Segment string          `json:"segment"`
+	Result  integrityResult `json:"result"`
+}
+
+// integrityReport is the result of the verification of segments against their checksums.
+type integrityReport struct {
+	Result   integrityResult    `json:"result"`
+	Segments []integritySegment `json:"segments"`
+}
+
+func (r *integrityReport) add(segmentPath string, err error) {
+	var res integrityResult
+
+	switch {
+	case err == nil:
+		res = integrityVerified
+
+	case errors.Is(err, record.ErrChecksumRepaired):
+		res = integrityRepaired
+		if r.Result != integrityFailed {
+			r.Result = integrityRepaired
+		}
+
+	case errors.Is(err, record.ErrChecksumNotFound):
+		res = integrityUnavailable
+		if r.Result == integrityVerified {
+			r.Result = integrityUnavailable
+		}
+
+	default:
+		res = integrityFailed
+		r.Result = integrityFailed
+	}
+
+	r.Segments = append(r.Segments, integritySegment{
+		Segment: segmentPath,
+		Result:  res,
+	})
+}
+
+// verifySegments checks segments against their checksum sidecars.
+// The overall result is "failed" if at least one segment doesn't match its checksum,
+// "repaired" if at least one segment has been truncated by the repairer,
+// "unavailable" if at least one segment doesn't have a checksum, "verified" otherwise.
+func verifySegments(segments []*Segment) *integrityReport {
+	report := &integrityReport{
+		Result:   integrityVerified,
+		Segments: []integritySegment{},
+	}
+
+	for _, seg := range segments {
+		storage := seg.getStorage()
+		err := record.ChecksumVerifyWith(seg.Fpath, func(name string) (io.ReadCloser, error) {
+			return storage.Open(name)
+		})
+		report.add(seg.Fpath, err)
+	}
+
+	return report
+}
+
+// maximum amount of data that verifiedFile keeps in memory while waiting to hash it.
+const verifiedFileMaxPending = 4 * 1024 * 1024
+
+type verifiedChunk struct {
+	off int64
+	buf []byte
+}
+
+// verifiedFile computes the checksum of a segment from the data that is read from it,
+// in order to verify what is served without reading the segment twice.
+// Data is hashed in order: data read ahead of the hashed part is kept in memory until the gap is read,
+// while gaps that are never read, or that would require too much memory, are read by verifiedFile itself.
+type verifiedFile struct {
+	segmentFile
+	storage segmentStorage
+	path    string
+
+	pos         int64
+	h           hash.Hash
+	hashed      int64
+	pending     []verifiedChunk
+	pendingSize int
+	err         error
+}
+
+func (f *verifiedFile) Read(p []byte) (int, error) {
+	n, err := f.segmentFile.Read(p)
+	f.record(f.pos, p[:n])
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *verifiedFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.segmentFile.Seek(offset, whence)
+	if err == nil {
+		f.pos = pos
+	}
+	return pos, err
+}
+
+func (f *verifiedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.segmentFile.ReadAt(p, off)
+	f.record(off, p[:n])
+	return n, err
+}
+
+// Close is called by the muxing routine; the file is closed by segmentVerifier once it has been hashed.
+func (f *verifiedFile) Close() error {
+	return nil
+}
+
+func (f *verifiedFile) record(off int64, p []byte) {
+	if f.err != nil || len(p) == 0 {
+		return
+	}
+
+	end := off + int64(len(p))
+	if end <= f.hashed {
+		return
+	}
+
+	if off <= f.hashed {
+		f.h.Write(p[f.hashed-off:])
+		f.hashed = end
+		f.drain()
+		return
+	}
+
+	i := sort.Search(len(f.pending), func(i int) bool { return f.pending[i].off > off })
+	f.pending = slices.Insert(f.pending, i, verifiedChunk{off: off, buf: bytes.Clone(p)})
+	f.pendingSize += len(p)
+
+	if f.pendingSize > verifiedFileMaxPending {
+		f.fillGap()
+	}
+}
+
+// drain hashes pending chunks that are contiguous to the hashed part.
+func (f *verifiedFile) drain() {
+	for len(f.pending) != 0 && f.pending[0].off <= f.hashed {
+		c := f.pending[0]
+		f.pending = f.pending[1:]
+		f.pendingSize -= len(c.buf)
+
+		if end := c.off + int64(len(c.buf)); end > f.hashed {
+			f.h.Write(c.buf[f.hashed-c.off:])
+			f.hashed = end
+		}
+	}
+}
+
+// fillGap reads and hashes the data between the hashed part and the first pending chunk.
+func (f *verifiedFile) fillGap() {
+	_, err := io.Copy(f.h, io.NewSectionReader(f.segmentFile, f.hashed, f.pending[0].off-f.hashed))
+	if err != nil {
+		f.err = err
+		return
+	}
+
+	f.hashed = f.pending[0].off
+	f.drain()
+}
+
+// verify hashes the data that has not been read and compares the checksum with the sidecar.
+func (f *verifiedFile) verify() error {
+	for f.err == nil && len(f.pending) != 0 {
+		f.fillGap()
+	}
+
+	if f.err != nil {
+		return f.err
+	}
+
+	_, err := io.Copy(f.h, io.NewSectionReader(f.segmentFile, f.hashed, math.MaxInt64-f.hashed))
+	if err != nil {
+		return err
+	}
+
+	return record.ChecksumMatchWith(f.path, f.h.Sum(nil), func(name string) (io.ReadCloser, error) {
+		return f.storage.Open(name)
+	})
+}
+
+// verifiedStorage is a segmentStorage whose segments are verified by a segmentVerifier.
+type verifiedStorage struct {
+	segmentStorage
+	v *segmentVerifier
+}
+
+func (s *verifiedStorage) Open(name string) (segmentFile, error) {
+	f, err := s.segmentStorage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	vf := &verifiedFile{
+		segmentFile: f,
+		storage:     s.segmentStorage,
+		path:        name,
+		h:           sha256.New(),
+	}
+	s.v.files = append(s.v.files, vf)
+
+	return vf, nil
+}
+
+// segmentVerifier verifies the segments that are read while muxing,
+// by hashing their content while it is served.
+type segmentVerifier struct {
+	files []*verifiedFile
+}
+
+// wrap returns copies of segments whose content is verified.
+func (v *segmentVerifier) wrap(segments []*Segment) []*Segment {
+	out := make([]*Segment, len(segments))
+
+	for i, seg := range segments {
+		seg2 := *seg
+		seg2.storage = &verifiedStorage{segmentStorage: seg.getStorage(), v: v}
+		out[i] = &seg2
+	}
+
+	return out
+}
+
+// report verifies the segments that have been read.
+// Segments that have not been read are not part of the output, therefore they are not reported.
+func (v *segmentVerifier) report() *integrityReport {
+	report := &integrityReport{
+		Result:   integrityVerified,
+		Segments: []integritySegment{},
+	}
+
+	for _, f := range v.files {
+		report.add(f.path, f.verify())
+	}
+
+	return report
+}
+
+func (v *segmentVerifier) close() {
+	for _, f := range v.files {
+		f.segmentFile.Close()
+	}
+}
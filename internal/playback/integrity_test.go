@@ -0,0 +1,140 @@
+package playback
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/stretchr/testify/require"
+)
+
+type countingFile struct {
+	segmentFile
+	n int
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.segmentFile.Read(p)
+	f.n += n
+	return n, err
+}
+
+func (f *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.segmentFile.ReadAt(p, off)
+	f.n += n
+	return n, err
+}
+
+func TestVerifiedFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "seg.mp4")
+
+	buf := make([]byte, 6*1024*1024)
+	_, err = rand.Read(buf)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, buf, 0o644)
+	require.NoError(t, err)
+
+	err = record.ChecksumWrite(fpath)
+	require.NoError(t, err)
+
+	for _, ca := range []string{"in order", "read ahead", "too much read ahead"} {
+		t.Run(ca, func(t *testing.T) {
+			f, err2 := os.Open(fpath)
+			require.NoError(t, err2)
+			defer f.Close()
+
+			cf := &countingFile{segmentFile: f}
+
+			vf := &verifiedFile{
+				segmentFile: cf,
+				storage:     localStorage{},
+				path:        fpath,
+				h:           sha256.New(),
+			}
+
+			p := make([]byte, 100)
+
+			switch ca {
+			case "in order":
+				_, err2 = io.ReadFull(vf, p)
+				require.NoError(t, err2)
+
+				_, err2 = vf.Seek(1000, io.SeekStart)
+				require.NoError(t, err2)
+
+				_, err2 = io.ReadFull(vf, p)
+				require.NoError(t, err2)
+
+			case "read ahead":
+				_, err2 = io.ReadFull(vf, p)
+				require.NoError(t, err2)
+
+				// header of the next part, read before payloads of the current one
+				_, err2 = vf.Seek(1000, io.SeekStart)
+				require.NoError(t, err2)
+
+				_, err2 = io.ReadFull(vf, p)
+				require.NoError(t, err2)
+
+				_, err2 = vf.ReadAt(make([]byte, 900), 100)
+				require.NoError(t, err2)
+
+				// data already hashed
+				_, err2 = vf.ReadAt(p, 50)
+				require.NoError(t, err2)
+
+				_, err2 = vf.ReadAt(p, 5000)
+				require.NoError(t, err2)
+
+			case "too much read ahead":
+				_, err2 = vf.ReadAt(p, 0)
+				require.NoError(t, err2)
+
+				_, err2 = vf.ReadAt(make([]byte, 5*1024*1024), 1024*1024)
+				require.NoError(t, err2)
+
+				require.Empty(t, vf.pending)
+			}
+
+			err2 = vf.verify()
+			require.NoError(t, err2)
+
+			// each byte is read once, except the ones that are read again by the caller
+			if ca == "read ahead" {
+				require.Equal(t, len(buf)+100, cf.n)
+			} else {
+				require.Equal(t, len(buf), cf.n)
+			}
+		})
+	}
+
+	buf[len(buf)-1]++
+	err = os.WriteFile(fpath, buf, 0o644)
+	require.NoError(t, err)
+
+	f, err := os.Open(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	vf := &verifiedFile{
+		segmentFile: f,
+		storage:     localStorage{},
+		path:        fpath,
+		h:           sha256.New(),
+	}
+
+	_, err = vf.ReadAt(make([]byte, 100), 0)
+	require.NoError(t, err)
+
+	err = vf.verify()
+	require.ErrorIs(t, err, record.ErrChecksumMismatch)
+}
@@ -0,0 +1,99 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// suggested delay before retrying requests rejected by the muxer limiter.
+const muxLimiterRetryAfter = 5 * time.Second
+
+var errTooManyMuxers = errors.New("too many concurrent playback operations")
+
+// muxLimiter limits the number of recordings that are read and remuxed at the same time,
+// globally and for each path, in order to prevent large downloads from saturating the disk.
+// Unlike downloadLimiter, requests that exceed the limit are rejected instead of queued.
+type muxLimiter struct {
+	max int
+
+	mutex   sync.Mutex
+	running int
+	perPath map[string]int
+}
+
+func (l *muxLimiter) initialize() {
+	l.perPath = make(map[string]int)
+}
+
+func (l *muxLimiter) tryAcquire(pathName string, pathMax int) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.max != 0 && l.running >= l.max {
+		return false
+	}
+
+	if pathMax != 0 && l.perPath[pathName] >= pathMax {
+		return false
+	}
+
+	l.running++
+	l.perPath[pathName]++
+	return true
+}
+
+// acquire waits until a slot is available. It is used by exports, that run in background.
+func (l *muxLimiter) acquire(ctx context.Context, pathName string, pathMax int) error {
+	for {
+		if l.tryAcquire(pathName, pathMax) {
+			return nil
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *muxLimiter) release(pathName string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.running--
+	l.perPath[pathName]--
+
+	if l.perPath[pathName] == 0 {
+		delete(l.perPath, pathName)
+	}
+}
+
+// acquireMuxer reserves a slot for reading the recordings of a path.
+// When muxer limits are exceeded, the request is rejected with status 503,
+// then it waits until the recordings of the path can be read.
+func (p *Server) acquireMuxer(ctx *gin.Context, pathConf *conf.Path, pathName string) (func(), bool) {
+	if !p.muxers.tryAcquire(pathName, pathConf.PlaybackMaxConcurrentMuxers) {
+		ctx.Header("Retry-After", strconv.FormatInt(int64(muxLimiterRetryAfter/time.Second), 10))
+		p.writeError(ctx, http.StatusServiceUnavailable, errTooManyMuxers)
+		return nil, false
+	}
+
+	releaseReader, ok := p.acquireReader(ctx, pathConf, pathName)
+	if !ok {
+		p.muxers.release(pathName)
+		return nil, false
+	}
+
+	return func() {
+		releaseReader()
+		p.muxers.release(pathName)
+	}, true
+}
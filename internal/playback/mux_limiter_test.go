@@ -0,0 +1,76 @@
+package playback
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMuxLimiter(t *testing.T) {
+	l := &muxLimiter{max: 3}
+	l.initialize()
+
+	require.True(t, l.tryAcquire("path1", 2))
+	require.True(t, l.tryAcquire("path1", 2))
+
+	// path limit
+	require.False(t, l.tryAcquire("path1", 2))
+
+	require.True(t, l.tryAcquire("path2", 0))
+
+	// global limit
+	require.False(t, l.tryAcquire("path3", 0))
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	ctxCancel()
+	err := l.acquire(ctx, "path3", 0)
+	require.ErrorIs(t, err, context.Canceled)
+
+	l.release("path1")
+	require.True(t, l.tryAcquire("path3", 0))
+
+	l.release("path1")
+	l.release("path2")
+	l.release("path3")
+	require.Equal(t, 0, l.running)
+	require.Empty(t, l.perPath)
+}
+
+func TestMuxLimiterReject(t *testing.T) {
+	s := &Server{
+		Parent: test.NilLogger,
+		muxers: &muxLimiter{},
+	}
+	s.muxers.initialize()
+
+	pathConf := &conf.Path{PlaybackMaxConcurrentMuxers: 1}
+
+	w1 := httptest.NewRecorder()
+	ctx1, _ := gin.CreateTestContext(w1)
+	ctx1.Request = httptest.NewRequest(http.MethodGet, "/get", nil)
+	release, ok := s.acquireMuxer(ctx1, pathConf, "mypath")
+	require.True(t, ok)
+
+	w2 := httptest.NewRecorder()
+	ctx2, _ := gin.CreateTestContext(w2)
+	ctx2.Request = httptest.NewRequest(http.MethodGet, "/get", nil)
+	_, ok = s.acquireMuxer(ctx2, pathConf, "mypath")
+	require.False(t, ok)
+	require.Equal(t, http.StatusServiceUnavailable, w2.Code)
+	require.Equal(t, "5", w2.Header().Get("Retry-After"))
+
+	release()
+
+	w3 := httptest.NewRecorder()
+	ctx3, _ := gin.CreateTestContext(w3)
+	ctx3.Request = httptest.NewRequest(http.MethodGet, "/get", nil)
+	release, ok = s.acquireMuxer(ctx3, pathConf, "mypath")
+	require.True(t, ok)
+	release()
+}
@@ -18,6 +18,12 @@ type muxerFMP4Track struct {
 	firstDTS  int64
 	lastDTS   int64
 	samples   []*fmp4.PartSample
+
+	// functions that read the payload of samples that have been skipped
+	loaders []func() ([]byte, error)
+
+	// whether a sync sample has been received, used when timing is kept
+	started bool
 }
 
 func findTrack(tracks []*muxerFMP4Track, id int) *muxerFMP4Track {
@@ -30,17 +36,40 @@ func findTrack(tracks []*muxerFMP4Track, id int) *muxerFMP4Track {
 }
 
 type muxerFMP4 struct {
-	w io.Writer
-
-	init               *fmp4.Init
+	w                  io.Writer
+	skipInit           bool
 	nextSequenceNumber uint32
-	tracks             []*muxerFMP4Track
-	curTrack           *muxerFMP4Track
-	outBuf             seekablebuffer.Buffer
+	cenc               *cencEncrypter
+
+	// when keepTiming is true, samples that precede the start of the timespan are discarded
+	// instead of being compressed at the start, therefore all samples keep their original timing
+	// and the output starts with the first sync sample of each track.
+	keepTiming bool
+
+	// tracks that received a sync sample before muxing was resumed, used when timing is kept
+	resumedTracks []int
+
+	// comment that is embedded into the initialization segment
+	comment string
+
+	// when set, payloads that are not requested are not read
+	skipper *payloadSkipper
+
+	init     *fmp4.Init
+	tracks   []*muxerFMP4Track
+	curTrack *muxerFMP4Track
+	outBuf   seekablebuffer.Buffer
 }
 
 func (w *muxerFMP4) writeInit(init *fmp4.Init) {
-	w.init = init
+	// when appending to an existing file, the initialization segment has already been written
+	if !w.skipInit {
+		w.init = init
+	}
+
+	if w.cenc != nil {
+		w.cenc.setTracks(init.Tracks)
+	}
 
 	w.tracks = make([]*muxerFMP4Track, len(init.Tracks))
 
@@ -51,6 +80,24 @@ func (w *muxerFMP4) writeInit(init *fmp4.Init) {
 			firstDTS:  -1,
 		}
 	}
+
+	for _, id := range w.resumedTracks {
+		if track := findTrack(w.tracks, id); track != nil {
+			track.started = true
+		}
+	}
+}
+
+// startedTracks returns the tracks that received a sync sample,
+// that have to be restored when muxing is resumed.
+func (w *muxerFMP4) startedTracks() []int {
+	var out []int
+	for _, track := range w.tracks {
+		if track.started {
+			out = append(out, track.id)
+		}
+	}
+	return out
 }
 
 func (w *muxerFMP4) setTrack(trackID int) {
@@ -61,12 +108,29 @@ func (w *muxerFMP4) writeSample(
 	dts int64,
 	ptsOffset int32,
 	isNonSyncSample bool,
-	_ uint32,
+	payloadSize uint32,
 	getPayload func() ([]byte, error),
 ) error {
-	pl, err := getPayload()
-	if err != nil {
-		return err
+	if w.keepTiming {
+		if dts < 0 || (!w.curTrack.started && isNonSyncSample) {
+			return nil
+		}
+		w.curTrack.started = true
+	}
+
+	// payloads are read when parts are written, if they are requested
+	var pl []byte
+	var loader func() ([]byte, error)
+
+	if w.skipper != nil {
+		pl = w.skipper.placeholder(payloadSize)
+		loader = getPayload
+	} else {
+		var err error
+		pl, err = getPayload()
+		if err != nil {
+			return err
+		}
 	}
 
 	if dts >= 0 {
@@ -76,6 +140,7 @@ func (w *muxerFMP4) writeSample(
 			// if frame is a IDR, remove previous GOP
 			if !isNonSyncSample {
 				w.curTrack.samples = nil
+				w.curTrack.loaders = nil
 			}
 		} else {
 			diff := dts - w.curTrack.lastDTS
@@ -90,6 +155,7 @@ func (w *muxerFMP4) writeSample(
 			IsNonSyncSample: isNonSyncSample,
 			Payload:         pl,
 		})
+		w.curTrack.loaders = append(w.curTrack.loaders, loader)
 		w.curTrack.lastDTS = dts
 
 		partDurationMP4 := durationGoToMp4(partDuration, w.curTrack.timeScale)
@@ -107,12 +173,14 @@ func (w *muxerFMP4) writeSample(
 				IsNonSyncSample: isNonSyncSample,
 				Payload:         pl,
 			}}
+			w.curTrack.loaders = []func() ([]byte, error){loader}
 		} else {
 			// append frame to current GOP
 			w.curTrack.samples = append(w.curTrack.samples, &fmp4.PartSample{
 				IsNonSyncSample: isNonSyncSample,
 				Payload:         pl,
 			})
+			w.curTrack.loaders = append(w.curTrack.loaders, loader)
 		}
 	}
 
@@ -131,6 +199,7 @@ func (w *muxerFMP4) writeFinalDTS(dts int64) {
 
 func (w *muxerFMP4) innerFlush(final bool) error {
 	var part fmp4.Part
+	var loaders []func() ([]byte, error)
 
 	for _, track := range w.tracks {
 		if track.firstDTS >= 0 && (len(track.samples) > 1 || (final && len(track.samples) != 0)) {
@@ -148,9 +217,11 @@ func (w *muxerFMP4) innerFlush(final bool) error {
 				BaseTime: uint64(track.firstDTS),
 				Samples:  samples,
 			})
+			loaders = append(loaders, track.loaders[:len(samples)]...)
 
 			if !final {
 				track.samples = track.samples[len(track.samples)-1:]
+				track.loaders = track.loaders[len(track.loaders)-1:]
 				track.firstDTS = track.lastDTS
 			}
 		}
@@ -161,12 +232,25 @@ func (w *muxerFMP4) innerFlush(final bool) error {
 		w.nextSequenceNumber++
 
 		if w.init != nil {
-			err := w.init.Marshal(&w.outBuf)
+			var err error
+			if w.cenc != nil {
+				err = w.cenc.marshalInit(w.init, &w.outBuf)
+			} else {
+				err = w.init.Marshal(&w.outBuf)
+			}
 			if err != nil {
 				return err
 			}
 
-			_, err = w.w.Write(w.outBuf.Bytes())
+			buf := w.outBuf.Bytes()
+			if w.comment != "" {
+				buf, err = fmp4InitAddComment(buf, w.comment)
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = w.w.Write(buf)
 			if err != nil {
 				return err
 			}
@@ -175,11 +259,24 @@ func (w *muxerFMP4) innerFlush(final bool) error {
 			w.outBuf.Reset()
 		}
 
-		err := part.Marshal(&w.outBuf)
+		var err error
+		if w.cenc != nil {
+			err = w.cenc.marshalPart(&part, &w.outBuf)
+		} else {
+			err = part.Marshal(&w.outBuf)
+		}
 		if err != nil {
 			return err
 		}
 
+		// the part contains requested bytes, write it again with actual payloads
+		if w.skipper != nil && !w.skipper.skippable(w.skipper.pos+int64(len(w.outBuf.Bytes()))) {
+			err = w.loadPayloads(&part, loaders)
+			if err != nil {
+				return err
+			}
+		}
+
 		_, err = w.w.Write(w.outBuf.Bytes())
 		if err != nil {
 			return err
@@ -191,6 +288,42 @@ func (w *muxerFMP4) innerFlush(final bool) error {
 	return nil
 }
 
+func (w *muxerFMP4) loadPayloads(part *fmp4.Part, loaders []func() ([]byte, error)) error {
+	i := 0
+	for _, track := range part.Tracks {
+		for _, sample := range track.Samples {
+			var err error
+			sample.Payload, err = loaders[i]()
+			if err != nil {
+				return err
+			}
+			i++
+		}
+	}
+
+	w.outBuf.Reset()
+	return part.Marshal(&w.outBuf)
+}
+
 func (w *muxerFMP4) flush() error {
 	return w.innerFlush(true)
 }
+
+// flushCheckpoint writes all pending samples,
+// in order to allow resuming muxing from the current position.
+func (w *muxerFMP4) flushCheckpoint() error {
+	err := w.innerFlush(true)
+	if err != nil {
+		return err
+	}
+
+	for _, track := range w.tracks {
+		if track.firstDTS >= 0 {
+			track.samples = nil
+			track.loaders = nil
+			track.firstDTS = -1
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package playback
+
+import (
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+type muxerInterleavedSample struct {
+	dts             time.Duration
+	pts             time.Duration
+	isNonSyncSample bool
+	payloadSize     uint32
+	getPayload      func() ([]byte, error)
+}
+
+type muxerInterleavedTrack struct {
+	id        int
+	timeScale uint32
+	codec     fmp4.Codec
+	started   bool
+	lastDTS   time.Duration
+	samples   []*muxerInterleavedSample
+}
+
+// muxerInterleaved is a muxer that sorts samples by decoding time.
+// It is used by formats that, unlike MP4, don't group samples by track,
+// while segments contain samples grouped by track.
+type muxerInterleaved struct {
+	// called once, before writing samples.
+	onInit func(tracks []*muxerInterleavedTrack) error
+	// called for each sample, in decoding order.
+	onSample func(track *muxerInterleavedTrack, sample *muxerInterleavedSample) error
+
+	tracks      []*muxerInterleavedTrack
+	curTrack    *muxerInterleavedTrack
+	initWritten bool
+}
+
+func (w *muxerInterleaved) writeInit(init *fmp4.Init) {
+	// when segments are concatenated, tracks don't change
+	if w.tracks != nil {
+		return
+	}
+
+	w.tracks = make([]*muxerInterleavedTrack, len(init.Tracks))
+
+	for i, track := range init.Tracks {
+		w.tracks[i] = &muxerInterleavedTrack{
+			id:        track.ID,
+			timeScale: track.TimeScale,
+			codec:     track.Codec,
+		}
+	}
+}
+
+func (w *muxerInterleaved) setTrack(trackID int) {
+	for _, track := range w.tracks {
+		if track.id == trackID {
+			w.curTrack = track
+			return
+		}
+	}
+}
+
+func (w *muxerInterleaved) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	getPayload func() ([]byte, error),
+) error {
+	track := w.curTrack
+
+	if dts < 0 {
+		// store GOP of the first frame, with timestamps set to zero
+		if !isNonSyncSample {
+			track.samples = nil
+		}
+
+		track.samples = append(track.samples, &muxerInterleavedSample{
+			isNonSyncSample: isNonSyncSample,
+			payloadSize:     payloadSize,
+			getPayload:      getPayload,
+		})
+		return nil
+	}
+
+	if !track.started {
+		track.started = true
+
+		// if frame is a IDR, remove previous GOP
+		if !isNonSyncSample {
+			track.samples = nil
+		}
+	}
+
+	track.lastDTS = durationMp4ToGo(dts, track.timeScale)
+
+	track.samples = append(track.samples, &muxerInterleavedSample{
+		dts:             track.lastDTS,
+		pts:             durationMp4ToGo(dts+int64(ptsOffset), track.timeScale),
+		isNonSyncSample: isNonSyncSample,
+		payloadSize:     payloadSize,
+		getPayload:      getPayload,
+	})
+
+	return w.writeReady(false)
+}
+
+func (w *muxerInterleaved) writeFinalDTS(_ int64) {
+}
+
+// writeReady writes samples that can't be preceded by samples of other tracks anymore,
+// or all samples when final is true.
+func (w *muxerInterleaved) writeReady(final bool) error {
+	if !w.initWritten {
+		if !final {
+			for _, track := range w.tracks {
+				if !track.started {
+					return nil
+				}
+			}
+		}
+
+		w.initWritten = true
+
+		err := w.onInit(w.tracks)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		var next *muxerInterleavedTrack
+
+		for _, track := range w.tracks {
+			if len(track.samples) == 0 {
+				// a track without queued samples may still receive older samples
+				if !final {
+					return nil
+				}
+				continue
+			}
+
+			if next == nil || track.samples[0].dts < next.samples[0].dts {
+				next = track
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		err := w.onSample(next, next.samples[0])
+		if err != nil {
+			return err
+		}
+
+		next.samples[0] = nil
+		next.samples = next.samples[1:]
+	}
+}
+
+func (w *muxerInterleaved) flush() error {
+	return w.writeReady(true)
+}
@@ -0,0 +1,424 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+// Matroska element IDs.
+const (
+	mkvIDEBML               = 0x1A45DFA3
+	mkvIDEBMLVersion        = 0x4286
+	mkvIDEBMLReadVersion    = 0x42F7
+	mkvIDEBMLMaxIDLength    = 0x42F2
+	mkvIDEBMLMaxSizeLength  = 0x42F3
+	mkvIDDocType            = 0x4282
+	mkvIDDocTypeVersion     = 0x4287
+	mkvIDDocTypeReadVersion = 0x4285
+	mkvIDSegment            = 0x18538067
+	mkvIDInfo               = 0x1549A966
+	mkvIDTimestampScale     = 0x2AD7B1
+	mkvIDMuxingApp          = 0x4D80
+	mkvIDWritingApp         = 0x5741
+	mkvIDTracks             = 0x1654AE6B
+	mkvIDTrackEntry         = 0xAE
+	mkvIDTrackNumber        = 0xD7
+	mkvIDTrackUID           = 0x73C5
+	mkvIDTrackType          = 0x83
+	mkvIDFlagLacing         = 0x9C
+	mkvIDCodecID            = 0x86
+	mkvIDCodecPrivate       = 0x63A2
+	mkvIDVideo              = 0xE0
+	mkvIDPixelWidth         = 0xB0
+	mkvIDPixelHeight        = 0xBA
+	mkvIDAudio              = 0xE1
+	mkvIDSamplingFrequency  = 0xB5
+	mkvIDChannels           = 0x9F
+	mkvIDCluster            = 0x1F43B675
+	mkvIDTimestamp          = 0xE7
+	mkvIDSimpleBlock        = 0xA3
+)
+
+const (
+	mkvTrackTypeVideo = 1
+	mkvTrackTypeAudio = 2
+)
+
+// maximum duration of a cluster.
+// Block timestamps are relative to the cluster and are stored in 16 bits.
+const muxerMKVMaxClusterDuration = 5 * time.Second
+
+// maximum size of the data that precedes a payload inside the current cluster:
+// cluster ID and size, block ID and size, track number, timestamp and flags.
+const muxerMKVMaxBlockOverhead = 4 + 8 + 1 + 8 + 8 + 3
+
+func ebmlAppendID(buf []byte, id uint32) []byte {
+	switch {
+	case id > 0xFFFFFF:
+		return append(buf, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xFFFF:
+		return append(buf, byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xFF:
+		return append(buf, byte(id>>8), byte(id))
+	}
+	return append(buf, byte(id))
+}
+
+func ebmlAppendSize(buf []byte, size uint64) []byte {
+	n := 1
+	for n < 8 && size >= (uint64(1)<<(7*n))-1 {
+		n++
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		b := byte(size >> (8 * i))
+		if i == n-1 {
+			b |= 0x80 >> (n - 1)
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+func ebmlElement(id uint32, payload ...[]byte) []byte {
+	size := 0
+	for _, p := range payload {
+		size += len(p)
+	}
+
+	buf := ebmlAppendID(nil, id)
+	buf = ebmlAppendSize(buf, uint64(size))
+	for _, p := range payload {
+		buf = append(buf, p...)
+	}
+	return buf
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	n := 1
+	for n < 8 && v >= uint64(1)<<(8*n) {
+		n++
+	}
+
+	payload := make([]byte, n)
+	for i := 0; i < n; i++ {
+		payload[i] = byte(v >> (8 * (n - 1 - i)))
+	}
+	return ebmlElement(id, payload)
+}
+
+func ebmlFloat(id uint32, v float64) []byte {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, math.Float64bits(v))
+	return ebmlElement(id, payload)
+}
+
+func ebmlString(id uint32, v string) []byte {
+	return ebmlElement(id, []byte(v))
+}
+
+func mkvMarshalBox(box mp4.IImmutableBox) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := mp4.Marshal(&buf, box, mp4.Context{})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mkvTrackEntry returns the TrackEntry element of a track,
+// or nil if the codec is not supported.
+func mkvTrackEntry(number int, codec fmp4.Codec) ([]byte, error) {
+	var trackType uint64
+	var codecID string
+	var codecPrivate []byte
+	var details []byte
+
+	switch codec := codec.(type) {
+	case *fmp4.CodecH265:
+		var sps h265.SPS
+		err := sps.Unmarshal(codec.SPS)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse H265 SPS: %w", err)
+		}
+
+		codecPrivate, err = mkvMarshalBox(&mp4.HvcC{
+			ConfigurationVersion:        1,
+			GeneralProfileIdc:           sps.ProfileTierLevel.GeneralProfileIdc,
+			GeneralProfileCompatibility: sps.ProfileTierLevel.GeneralProfileCompatibilityFlag,
+			GeneralConstraintIndicator: [6]uint8{
+				codec.SPS[7], codec.SPS[8], codec.SPS[9],
+				codec.SPS[10], codec.SPS[11], codec.SPS[12],
+			},
+			GeneralLevelIdc:      sps.ProfileTierLevel.GeneralLevelIdc,
+			Reserved1:            15,
+			Reserved2:            63,
+			Reserved3:            63,
+			ChromaFormatIdc:      uint8(sps.ChromaFormatIdc),
+			Reserved4:            31,
+			BitDepthLumaMinus8:   uint8(sps.BitDepthLumaMinus8),
+			Reserved5:            31,
+			BitDepthChromaMinus8: uint8(sps.BitDepthChromaMinus8),
+			NumTemporalLayers:    1,
+			LengthSizeMinusOne:   3,
+			NumOfNaluArrays:      3,
+			NaluArrays: []mp4.HEVCNaluArray{
+				{
+					NaluType: byte(h265.NALUType_VPS_NUT),
+					NumNalus: 1,
+					Nalus:    []mp4.HEVCNalu{{Length: uint16(len(codec.VPS)), NALUnit: codec.VPS}},
+				},
+				{
+					NaluType: byte(h265.NALUType_SPS_NUT),
+					NumNalus: 1,
+					Nalus:    []mp4.HEVCNalu{{Length: uint16(len(codec.SPS)), NALUnit: codec.SPS}},
+				},
+				{
+					NaluType: byte(h265.NALUType_PPS_NUT),
+					NumNalus: 1,
+					Nalus:    []mp4.HEVCNalu{{Length: uint16(len(codec.PPS)), NALUnit: codec.PPS}},
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		trackType = mkvTrackTypeVideo
+		codecID = "V_MPEGH/ISO/HEVC"
+		details = ebmlElement(mkvIDVideo,
+			ebmlUint(mkvIDPixelWidth, uint64(sps.Width())),
+			ebmlUint(mkvIDPixelHeight, uint64(sps.Height())))
+
+	case *fmp4.CodecH264:
+		var sps h264.SPS
+		err := sps.Unmarshal(codec.SPS)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse H264 SPS: %w", err)
+		}
+
+		codecPrivate, err = mkvMarshalBox(&mp4.AVCDecoderConfiguration{
+			AnyTypeBox: mp4.AnyTypeBox{
+				Type: mp4.BoxTypeAvcC(),
+			},
+			ConfigurationVersion:       1,
+			Profile:                    sps.ProfileIdc,
+			ProfileCompatibility:       codec.SPS[2],
+			Level:                      sps.LevelIdc,
+			Reserved:                   63,
+			LengthSizeMinusOne:         3,
+			Reserved2:                  7,
+			NumOfSequenceParameterSets: 1,
+			SequenceParameterSets:      []mp4.AVCParameterSet{{Length: uint16(len(codec.SPS)), NALUnit: codec.SPS}},
+			NumOfPictureParameterSets:  1,
+			PictureParameterSets:       []mp4.AVCParameterSet{{Length: uint16(len(codec.PPS)), NALUnit: codec.PPS}},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		trackType = mkvTrackTypeVideo
+		codecID = "V_MPEG4/ISO/AVC"
+		details = ebmlElement(mkvIDVideo,
+			ebmlUint(mkvIDPixelWidth, uint64(sps.Width())),
+			ebmlUint(mkvIDPixelHeight, uint64(sps.Height())))
+
+	case *fmp4.CodecVP9:
+		trackType = mkvTrackTypeVideo
+		codecID = "V_VP9"
+		details = ebmlElement(mkvIDVideo,
+			ebmlUint(mkvIDPixelWidth, uint64(codec.Width)),
+			ebmlUint(mkvIDPixelHeight, uint64(codec.Height)))
+
+	case *fmp4.CodecOpus:
+		// OpusHead, with the same pre-skip used in MP4
+		codecPrivate = []byte{'O', 'p', 'u', 's', 'H', 'e', 'a', 'd', 1, byte(codec.ChannelCount), 0x38, 0x01,
+			0x80, 0xBB, 0, 0, 0, 0, 0}
+
+		trackType = mkvTrackTypeAudio
+		codecID = "A_OPUS"
+		details = ebmlElement(mkvIDAudio,
+			ebmlFloat(mkvIDSamplingFrequency, 48000),
+			ebmlUint(mkvIDChannels, uint64(codec.ChannelCount)))
+
+	case *fmp4.CodecMPEG4Audio:
+		var err error
+		codecPrivate, err = codec.Config.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		trackType = mkvTrackTypeAudio
+		codecID = "A_AAC"
+		details = ebmlElement(mkvIDAudio,
+			ebmlFloat(mkvIDSamplingFrequency, float64(codec.Config.SampleRate)),
+			ebmlUint(mkvIDChannels, uint64(codec.Config.ChannelCount)))
+
+	case *fmp4.CodecAC3:
+		trackType = mkvTrackTypeAudio
+		codecID = "A_AC3"
+		details = ebmlElement(mkvIDAudio,
+			ebmlFloat(mkvIDSamplingFrequency, float64(codec.SampleRate)),
+			ebmlUint(mkvIDChannels, uint64(codec.ChannelCount)))
+
+	default:
+		return nil, nil
+	}
+
+	children := [][]byte{
+		ebmlUint(mkvIDTrackNumber, uint64(number)),
+		ebmlUint(mkvIDTrackUID, uint64(number)),
+		ebmlUint(mkvIDTrackType, trackType),
+		ebmlUint(mkvIDFlagLacing, 0),
+		ebmlString(mkvIDCodecID, codecID),
+	}
+	if codecPrivate != nil {
+		children = append(children, ebmlElement(mkvIDCodecPrivate, codecPrivate))
+	}
+	children = append(children, details)
+
+	return ebmlElement(mkvIDTrackEntry, children...), nil
+}
+
+// muxerMKV is a muxer that writes Matroska.
+// Tracks whose codec is not supported are skipped.
+//
+// The file is written progressively: the segment has an unknown size
+// and doesn't contain cues, therefore it can be played but seeking may be slow.
+type muxerMKV struct {
+	w io.Writer
+
+	// when set, payloads that are not requested are not read.
+	skipper *payloadSkipper
+
+	muxerInterleaved
+	numbers      map[int]int
+	cluster      []byte
+	clusterStart time.Duration
+}
+
+func (w *muxerMKV) writeInit(init *fmp4.Init) {
+	w.onInit = w.onInterleavedInit
+	w.onSample = w.onInterleavedSample
+	w.muxerInterleaved.writeInit(init)
+}
+
+func (w *muxerMKV) onInterleavedInit(tracks []*muxerInterleavedTrack) error {
+	w.numbers = make(map[int]int)
+	var entries [][]byte
+
+	for _, track := range tracks {
+		entry, err := mkvTrackEntry(len(entries)+1, track.codec)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+
+		entries = append(entries, entry)
+		w.numbers[track.id] = len(entries)
+	}
+
+	if entries == nil {
+		return fmt.Errorf("recording doesn't contain any track supported by Matroska")
+	}
+
+	buf := ebmlElement(mkvIDEBML,
+		ebmlUint(mkvIDEBMLVersion, 1),
+		ebmlUint(mkvIDEBMLReadVersion, 1),
+		ebmlUint(mkvIDEBMLMaxIDLength, 4),
+		ebmlUint(mkvIDEBMLMaxSizeLength, 8),
+		ebmlString(mkvIDDocType, "matroska"),
+		ebmlUint(mkvIDDocTypeVersion, 4),
+		ebmlUint(mkvIDDocTypeReadVersion, 2))
+
+	// segment with unknown size
+	buf = ebmlAppendID(buf, mkvIDSegment)
+	buf = append(buf, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+
+	// wall clock is not written, in order to generate the same output for the same recordings
+	buf = append(buf, ebmlElement(mkvIDInfo,
+		ebmlUint(mkvIDTimestampScale, uint64(time.Millisecond)),
+		ebmlString(mkvIDMuxingApp, "mediamtx"),
+		ebmlString(mkvIDWritingApp, "mediamtx"))...)
+
+	buf = append(buf, ebmlElement(mkvIDTracks, entries...)...)
+
+	_, err := w.w.Write(buf)
+	return err
+}
+
+func (w *muxerMKV) onInterleavedSample(track *muxerInterleavedTrack, sample *muxerInterleavedSample) error {
+	number, ok := w.numbers[track.id]
+	if !ok {
+		return nil
+	}
+
+	// clusters start with keyframes of video tracks, in order to allow seeking
+	if w.cluster == nil ||
+		(track.codec.IsVideo() && !sample.isNonSyncSample) ||
+		sample.pts-w.clusterStart >= muxerMKVMaxClusterDuration {
+		err := w.writeCluster()
+		if err != nil {
+			return err
+		}
+
+		w.clusterStart = sample.pts
+		w.cluster = ebmlUint(mkvIDTimestamp, uint64(sample.pts.Milliseconds()))
+	}
+
+	var pl []byte
+	if w.skipper != nil && w.skipper.skippable(w.skipper.pos+int64(len(w.cluster))+
+		muxerMKVMaxBlockOverhead+int64(sample.payloadSize)) {
+		pl = w.skipper.placeholder(sample.payloadSize)
+	} else {
+		var err error
+		pl, err = sample.getPayload()
+		if err != nil {
+			return err
+		}
+	}
+
+	var flags byte
+	if !sample.isNonSyncSample {
+		flags = 0x80
+	}
+
+	relative := int16(sample.pts.Milliseconds() - w.clusterStart.Milliseconds())
+
+	w.cluster = append(w.cluster, ebmlElement(mkvIDSimpleBlock,
+		ebmlAppendSize(nil, uint64(number)),
+		[]byte{byte(uint16(relative) >> 8), byte(relative), flags},
+		pl)...)
+
+	return nil
+}
+
+func (w *muxerMKV) writeCluster() error {
+	if w.cluster == nil {
+		return nil
+	}
+
+	_, err := w.w.Write(ebmlElement(mkvIDCluster, w.cluster))
+	w.cluster = nil
+	return err
+}
+
+func (w *muxerMKV) flush() error {
+	err := w.muxerInterleaved.flush()
+	if err != nil {
+		return err
+	}
+
+	return w.writeCluster()
+}
@@ -10,6 +10,9 @@ import (
 type muxerMP4Track struct {
 	pmp4.Track
 	lastDTS int64
+
+	// samples that have been moved to disk
+	spill *muxerMP4SpillTrack
 }
 
 func findTrackMP4(tracks []*muxerMP4Track, id int) *muxerMP4Track {
@@ -24,8 +27,45 @@ func findTrackMP4(tracks []*muxerMP4Track, id int) *muxerMP4Track {
 type muxerMP4 struct {
 	w io.Writer
 
-	tracks   []*muxerMP4Track
-	curTrack *muxerMP4Track
+	// when the memory used by samples exceeds memoryLimit,
+	// samples are moved into files placed in tempDir.
+	tempDir     string
+	memoryLimit uint64
+
+	// when set, payloads that are not requested are not read.
+	// Samples that have been moved to disk are always read.
+	skipper *payloadSkipper
+
+	tracks      []*muxerMP4Track
+	curTrack    *muxerMP4Track
+	memoryUsage uint64
+	spill       *muxerMP4Spill
+}
+
+func (w *muxerMP4) close() {
+	if w.spill != nil {
+		w.spill.close()
+	}
+}
+
+func (w *muxerMP4) startSpill() error {
+	w.spill = &muxerMP4Spill{
+		dir: w.tempDir,
+	}
+	err := w.spill.initialize()
+	if err != nil {
+		return err
+	}
+
+	for _, track := range w.tracks {
+		err = w.spill.moveTrack(track)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.memoryUsage = 0
+	return nil
 }
 
 func (w *muxerMP4) writeInit(init *fmp4.Init) {
@@ -53,8 +93,13 @@ func (w *muxerMP4) writeSample(
 	payloadSize uint32,
 	getPayload func() ([]byte, error),
 ) error {
+	if w.spill != nil {
+		return w.spill.writeSample(w.curTrack, dts, ptsOffset, isNonSyncSample, getPayload)
+	}
+
 	// remove GOPs before the GOP of the first frame
 	if (dts < 0 || (dts >= 0 && w.curTrack.lastDTS < 0)) && !isNonSyncSample {
+		w.memoryUsage -= uint64(len(w.curTrack.Samples)) * muxerMP4SampleMemory
 		w.curTrack.Samples = nil
 	}
 
@@ -73,6 +118,10 @@ func (w *muxerMP4) writeSample(
 		ptsOffset = 0
 	}
 
+	if w.skipper != nil {
+		getPayload = w.skippablePayload(payloadSize, getPayload)
+	}
+
 	w.curTrack.Samples = append(w.curTrack.Samples, &pmp4.Sample{
 		PTSOffset:       ptsOffset,
 		IsNonSyncSample: isNonSyncSample,
@@ -81,10 +130,31 @@ func (w *muxerMP4) writeSample(
 	})
 	w.curTrack.lastDTS = dts
 
+	w.memoryUsage += muxerMP4SampleMemory
+	if w.memoryLimit != 0 && w.memoryUsage > w.memoryLimit {
+		return w.startSpill()
+	}
+
 	return nil
 }
 
+// skippablePayload returns a function that reads a payload only when it is requested.
+// Payloads are read while they are written into mdat, therefore their position is the current one.
+func (w *muxerMP4) skippablePayload(size uint32, getPayload func() ([]byte, error)) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		if w.spill == nil && w.skipper.skippable(w.skipper.pos+int64(size)) {
+			return w.skipper.placeholder(size), nil
+		}
+		return getPayload()
+	}
+}
+
 func (w *muxerMP4) writeFinalDTS(dts int64) {
+	if w.spill != nil {
+		w.spill.writeFinalDTS(w.curTrack, dts)
+		return
+	}
+
 	diff := dts - w.curTrack.lastDTS
 	if diff < 0 {
 		diff = 0
@@ -93,6 +163,10 @@ func (w *muxerMP4) writeFinalDTS(dts int64) {
 }
 
 func (w *muxerMP4) flush() error {
+	if w.spill != nil {
+		return w.spill.marshal(w.tracks, w.w)
+	}
+
 	h := pmp4.Presentation{
 		Tracks: make([]*pmp4.Track, len(w.tracks)),
 	}
@@ -0,0 +1,812 @@
+package playback
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/bluenviron/mediacommon/pkg/formats/pmp4"
+)
+
+const (
+	// estimated memory used by each sample kept in memory by muxerMP4.
+	muxerMP4SampleMemory = 128
+
+	muxerMP4SpillRecordSize = 24
+)
+
+type muxerMP4SpillRecord struct {
+	duration  uint32
+	ptsOffset int32
+	size      uint32
+	nonSync   bool
+	offset    uint64
+}
+
+func (r *muxerMP4SpillRecord) marshal(buf []byte) {
+	binary.BigEndian.PutUint32(buf[0:], r.duration)
+	binary.BigEndian.PutUint32(buf[4:], uint32(r.ptsOffset))
+	binary.BigEndian.PutUint32(buf[8:], r.size)
+	if r.nonSync {
+		binary.BigEndian.PutUint32(buf[12:], 1)
+	} else {
+		binary.BigEndian.PutUint32(buf[12:], 0)
+	}
+	binary.BigEndian.PutUint64(buf[16:], r.offset)
+}
+
+func (r *muxerMP4SpillRecord) unmarshal(buf []byte) {
+	r.duration = binary.BigEndian.Uint32(buf[0:])
+	r.ptsOffset = int32(binary.BigEndian.Uint32(buf[4:]))
+	r.size = binary.BigEndian.Uint32(buf[8:])
+	r.nonSync = binary.BigEndian.Uint32(buf[12:]) != 0
+	r.offset = binary.BigEndian.Uint64(buf[16:])
+}
+
+// muxerMP4SpillTrack contains the samples of a track that have been moved to disk.
+type muxerMP4SpillTrack struct {
+	f     *os.File
+	bw    *bufio.Writer
+	count int
+
+	// last sample, whose duration is not known yet
+	last *muxerMP4SpillRecord
+}
+
+func (t *muxerMP4SpillTrack) writeRecord(r *muxerMP4SpillRecord) error {
+	var buf [muxerMP4SpillRecordSize]byte
+	r.marshal(buf[:])
+	_, err := t.bw.Write(buf[:])
+	t.count++
+	return err
+}
+
+func (t *muxerMP4SpillTrack) reset() error {
+	t.bw.Reset(t.f)
+	t.count = 0
+	t.last = nil
+
+	err := t.f.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.f.Seek(0, io.SeekStart)
+	return err
+}
+
+func (t *muxerMP4SpillTrack) forEachRecord(cb func(r *muxerMP4SpillRecord) error) error {
+	_, err := t.f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(t.f)
+	var buf [muxerMP4SpillRecordSize]byte
+	var r muxerMP4SpillRecord
+
+	for i := 0; i < t.count; i++ {
+		_, err = io.ReadFull(br, buf[:])
+		if err != nil {
+			return err
+		}
+
+		r.unmarshal(buf[:])
+
+		err = cb(&r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forEachChunk calls cb for every group of samples that are contiguous in the data file.
+func (t *muxerMP4SpillTrack) forEachChunk(cb func(offset uint64, sampleCount uint32) error) error {
+	var chunkOffset uint64
+	var chunkEnd uint64
+	var chunkSamples uint32
+
+	err := t.forEachRecord(func(r *muxerMP4SpillRecord) error {
+		if chunkSamples != 0 && r.offset == chunkEnd {
+			chunkSamples++
+			chunkEnd += uint64(r.size)
+			return nil
+		}
+
+		if chunkSamples != 0 {
+			err := cb(chunkOffset, chunkSamples)
+			if err != nil {
+				return err
+			}
+		}
+
+		chunkOffset = r.offset
+		chunkEnd = r.offset + uint64(r.size)
+		chunkSamples = 1
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if chunkSamples != 0 {
+		return cb(chunkOffset, chunkSamples)
+	}
+
+	return nil
+}
+
+type muxerMP4SpillStats struct {
+	duration    uint64
+	syncCount   int
+	sttsEntries int
+	cttsEntries int
+	chunks      int
+	stscEntries int
+}
+
+func (t *muxerMP4SpillTrack) stats() (*muxerMP4SpillStats, error) {
+	st := &muxerMP4SpillStats{}
+	first := true
+	var prevDuration uint32
+	var prevPTSOffset int32
+
+	err := t.forEachRecord(func(r *muxerMP4SpillRecord) error {
+		st.duration += uint64(r.duration)
+
+		if !r.nonSync {
+			st.syncCount++
+		}
+
+		if first || r.duration != prevDuration {
+			st.sttsEntries++
+		}
+
+		if first || r.ptsOffset != prevPTSOffset {
+			st.cttsEntries++
+		}
+
+		first = false
+		prevDuration = r.duration
+		prevPTSOffset = r.ptsOffset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var prevSampleCount uint32
+
+	err = t.forEachChunk(func(_ uint64, sampleCount uint32) error {
+		if st.chunks == 0 || sampleCount != prevSampleCount {
+			st.stscEntries++
+		}
+		st.chunks++
+		prevSampleCount = sampleCount
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// muxerMP4Spill stores samples of a muxerMP4 on disk,
+// in order to build MP4 files of any length with a constant amount of memory.
+// Payloads are written into a data file, that becomes the mdat box,
+// while sample tables are written into a temporary header file.
+type muxerMP4Spill struct {
+	dir string
+
+	data     *os.File
+	dataW    *bufio.Writer
+	dataSize uint64
+	files    []*os.File
+}
+
+func (s *muxerMP4Spill) initialize() error {
+	var err error
+	s.data, err = s.createFile()
+	if err != nil {
+		return err
+	}
+
+	s.dataW = bufio.NewWriter(s.data)
+	return nil
+}
+
+func (s *muxerMP4Spill) createFile() (*os.File, error) {
+	f, err := os.CreateTemp(s.dir, "mediamtx-mp4-")
+	if err != nil {
+		return nil, err
+	}
+
+	s.files = append(s.files, f)
+	return f, nil
+}
+
+func (s *muxerMP4Spill) close() {
+	for _, f := range s.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+func (s *muxerMP4Spill) newTrack() (*muxerMP4SpillTrack, error) {
+	f, err := s.createFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return &muxerMP4SpillTrack{
+		f:  f,
+		bw: bufio.NewWriter(f),
+	}, nil
+}
+
+func (s *muxerMP4Spill) writePayload(payload []byte) (uint64, error) {
+	offset := s.dataSize
+
+	_, err := s.dataW.Write(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	s.dataSize += uint64(len(payload))
+	return offset, nil
+}
+
+// moveTrack moves the samples of a track from memory to disk.
+func (s *muxerMP4Spill) moveTrack(track *muxerMP4Track) error {
+	var err error
+	track.spill, err = s.newTrack()
+	if err != nil {
+		return err
+	}
+
+	for _, sa := range track.Samples {
+		if track.spill.last != nil {
+			err = track.spill.writeRecord(track.spill.last)
+			if err != nil {
+				return err
+			}
+		}
+
+		var payload []byte
+		payload, err = sa.GetPayload()
+		if err != nil {
+			return err
+		}
+
+		var offset uint64
+		offset, err = s.writePayload(payload)
+		if err != nil {
+			return err
+		}
+
+		track.spill.last = &muxerMP4SpillRecord{
+			duration:  sa.Duration,
+			ptsOffset: sa.PTSOffset,
+			size:      uint32(len(payload)),
+			nonSync:   sa.IsNonSyncSample,
+			offset:    offset,
+		}
+	}
+
+	track.Samples = nil
+	return nil
+}
+
+func (s *muxerMP4Spill) writeSample(
+	track *muxerMP4Track,
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	getPayload func() ([]byte, error),
+) error {
+	st := track.spill
+
+	// remove GOPs before the GOP of the first frame
+	if (dts < 0 || (dts >= 0 && track.lastDTS < 0)) && !isNonSyncSample {
+		err := st.reset()
+		if err != nil {
+			return err
+		}
+	}
+
+	if st.last == nil {
+		track.TimeOffset = int32(dts)
+	} else {
+		diff := dts - track.lastDTS
+		if diff < 0 {
+			diff = 0
+		}
+		st.last.duration = uint32(diff)
+
+		err := st.writeRecord(st.last)
+		if err != nil {
+			return err
+		}
+	}
+
+	// prevent warning "edit list: 1 Missing key frame while searching for timestamp: 0"
+	if !isNonSyncSample {
+		ptsOffset = 0
+	}
+
+	payload, err := getPayload()
+	if err != nil {
+		return err
+	}
+
+	offset, err := s.writePayload(payload)
+	if err != nil {
+		return err
+	}
+
+	st.last = &muxerMP4SpillRecord{
+		ptsOffset: ptsOffset,
+		size:      uint32(len(payload)),
+		nonSync:   isNonSyncSample,
+		offset:    offset,
+	}
+	track.lastDTS = dts
+
+	return nil
+}
+
+func (s *muxerMP4Spill) writeFinalDTS(track *muxerMP4Track, dts int64) {
+	diff := dts - track.lastDTS
+	if diff < 0 {
+		diff = 0
+	}
+	track.spill.last.duration = uint32(diff)
+}
+
+func writeSpillTable(
+	mw *mp4.Writer,
+	typ string,
+	header []uint32,
+	entries func(bw *bufio.Writer) error,
+) error {
+	_, err := mw.StartBox(&mp4.BoxInfo{Type: mp4.StrToBoxType(typ)})
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(mw)
+	var buf [4]byte
+
+	// version and flags
+	_, err = bw.Write(buf[:])
+	if err != nil {
+		return err
+	}
+
+	for _, v := range header {
+		binary.BigEndian.PutUint32(buf[:], v)
+		_, err = bw.Write(buf[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = entries(bw)
+	if err != nil {
+		return err
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = mw.EndBox()
+	return err
+}
+
+func writeUint32s(bw *bufio.Writer, vals ...uint32) error {
+	var buf [4]byte
+	for _, v := range vals {
+		binary.BigEndian.PutUint32(buf[:], v)
+		_, err := bw.Write(buf[:])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkOffsetTable is a stco or co64 box whose entries have to be shifted
+// by the position of the mdat box, that is known once all tables are written.
+type chunkOffsetTable struct {
+	pos   int64
+	count int
+	co64  bool
+}
+
+func writeSpillTables(
+	mw *mp4.Writer,
+	track *muxerMP4SpillTrack,
+	st *muxerMP4SpillStats,
+	co64 bool,
+) (*chunkOffsetTable, error) {
+	err := writeSpillTable(mw, "stts", []uint32{uint32(st.sttsEntries)}, func(bw *bufio.Writer) error {
+		var count uint32
+		var delta uint32
+
+		err := track.forEachRecord(func(r *muxerMP4SpillRecord) error {
+			if count != 0 && r.duration == delta {
+				count++
+				return nil
+			}
+			if count != 0 {
+				err := writeUint32s(bw, count, delta)
+				if err != nil {
+					return err
+				}
+			}
+			count = 1
+			delta = r.duration
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if count != 0 {
+			return writeUint32s(bw, count, delta)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if st.syncCount != track.count {
+		err = writeSpillTable(mw, "stss", []uint32{uint32(st.syncCount)}, func(bw *bufio.Writer) error {
+			i := uint32(0)
+			return track.forEachRecord(func(r *muxerMP4SpillRecord) error {
+				i++
+				if !r.nonSync {
+					return writeUint32s(bw, i)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writeSpillTable(mw, "ctts", []uint32{uint32(st.cttsEntries)}, func(bw *bufio.Writer) error {
+		var count uint32
+		var offset int32
+
+		err := track.forEachRecord(func(r *muxerMP4SpillRecord) error {
+			if count != 0 && r.ptsOffset == offset {
+				count++
+				return nil
+			}
+			if count != 0 {
+				err := writeUint32s(bw, count, uint32(offset))
+				if err != nil {
+					return err
+				}
+			}
+			count = 1
+			offset = r.ptsOffset
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if count != 0 {
+			return writeUint32s(bw, count, uint32(offset))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeSpillTable(mw, "stsc", []uint32{uint32(st.stscEntries)}, func(bw *bufio.Writer) error {
+		chunk := uint32(0)
+		var prevSampleCount uint32
+
+		return track.forEachChunk(func(_ uint64, sampleCount uint32) error {
+			chunk++
+			if chunk == 1 || sampleCount != prevSampleCount {
+				prevSampleCount = sampleCount
+				return writeUint32s(bw, chunk, sampleCount, 1)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeSpillTable(mw, "stsz", []uint32{0, uint32(track.count)}, func(bw *bufio.Writer) error {
+		return track.forEachRecord(func(r *muxerMP4SpillRecord) error {
+			return writeUint32s(bw, r.size)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	co := &chunkOffsetTable{
+		count: st.chunks,
+		co64:  co64,
+	}
+
+	typ := "stco"
+	if co64 {
+		typ = "co64"
+	}
+
+	err = writeSpillTable(mw, typ, []uint32{uint32(st.chunks)}, func(bw *bufio.Writer) error {
+		err2 := bw.Flush()
+		if err2 != nil {
+			return err2
+		}
+
+		co.pos, err2 = mw.Seek(0, io.SeekCurrent)
+		if err2 != nil {
+			return err2
+		}
+
+		// offsets are relative to the beginning of the data file
+		return track.forEachChunk(func(offset uint64, _ uint32) error {
+			if co64 {
+				return writeUint32s(bw, uint32(offset>>32), uint32(offset))
+			}
+			return writeUint32s(bw, uint32(offset))
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return co, nil
+}
+
+// shift adds the position of the beginning of the data to all entries.
+func (co *chunkOffsetTable) shift(f *os.File, base uint64) error {
+	entrySize := 4
+	if co.co64 {
+		entrySize = 8
+	}
+
+	buf := make([]byte, 4096*entrySize)
+	pos := co.pos
+
+	for remaining := co.count; remaining > 0; {
+		n := min(remaining, 4096)
+		b := buf[:n*entrySize]
+
+		_, err := f.ReadAt(b, pos)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < n; i++ {
+			if co.co64 {
+				binary.BigEndian.PutUint64(b[i*8:], binary.BigEndian.Uint64(b[i*8:])+base)
+			} else {
+				binary.BigEndian.PutUint32(b[i*4:], binary.BigEndian.Uint32(b[i*4:])+uint32(base))
+			}
+		}
+
+		_, err = f.WriteAt(b, pos)
+		if err != nil {
+			return err
+		}
+
+		pos += int64(len(b))
+		remaining -= n
+	}
+
+	return nil
+}
+
+// marshal writes the MP4 file.
+// Boxes that do not depend on samples are generated by pmp4 with a placeholder sample per track,
+// that has the duration of the entire track, then sample tables are replaced.
+func (s *muxerMP4Spill) marshal(tracks []*muxerMP4Track, w io.Writer) error {
+	err := s.dataW.Flush()
+	if err != nil {
+		return err
+	}
+
+	stats := make(map[int]*muxerMP4SpillStats)
+	spillTracks := make(map[int]*muxerMP4SpillTrack)
+
+	skeleton := pmp4.Presentation{
+		Tracks: make([]*pmp4.Track, len(tracks)),
+	}
+
+	// upper bound of the size of the header, computed with 64-bit chunk offsets
+	headerMaxSize := uint64(0)
+
+	for i, track := range tracks {
+		st := track.spill
+
+		if st.last != nil {
+			err = st.writeRecord(st.last)
+			if err != nil {
+				return err
+			}
+			st.last = nil
+		}
+
+		err = st.bw.Flush()
+		if err != nil {
+			return err
+		}
+
+		if st.count == 0 {
+			return fmt.Errorf("track %d has no samples", track.ID)
+		}
+
+		var trackStats *muxerMP4SpillStats
+		trackStats, err = st.stats()
+		if err != nil {
+			return err
+		}
+
+		if trackStats.duration > math.MaxUint32 {
+			return fmt.Errorf("track %d is too long", track.ID)
+		}
+
+		stats[track.ID] = trackStats
+		spillTracks[track.ID] = st
+
+		headerMaxSize += uint64(16+8*trackStats.sttsEntries) +
+			uint64(16+4*trackStats.syncCount) +
+			uint64(16+8*trackStats.cttsEntries) +
+			uint64(16+12*trackStats.stscEntries) +
+			uint64(20+4*st.count) +
+			uint64(16+8*trackStats.chunks)
+
+		skeleton.Tracks[i] = &pmp4.Track{
+			ID:         track.ID,
+			TimeScale:  track.TimeScale,
+			TimeOffset: track.TimeOffset,
+			Codec:      track.Codec,
+			Samples: []*pmp4.Sample{{
+				Duration: uint32(trackStats.duration),
+				GetPayload: func() ([]byte, error) {
+					return nil, nil
+				},
+			}},
+		}
+	}
+
+	var skeletonBuf seekablebuffer.Buffer
+	err = skeleton.Marshal(&skeletonBuf)
+	if err != nil {
+		return err
+	}
+
+	headerMaxSize += uint64(len(skeletonBuf.Bytes()))
+	skeletonR := bytes.NewReader(skeletonBuf.Bytes())
+
+	mdatHeaderSize := uint64(8)
+	if s.dataSize+mdatHeaderSize > math.MaxUint32 {
+		mdatHeaderSize = 16
+	}
+
+	co64 := headerMaxSize+mdatHeaderSize+s.dataSize > math.MaxUint32
+
+	header, err := s.createFile()
+	if err != nil {
+		return err
+	}
+
+	mw := mp4.NewWriter(header)
+	var curTrackID int
+	var cos []*chunkOffsetTable
+
+	_, err = mp4.ReadBoxStructure(skeletonR, func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moov", "trak", "mdia", "minf", "stbl":
+			_, err2 := mw.StartBox(&mp4.BoxInfo{Type: h.BoxInfo.Type})
+			if err2 != nil {
+				return nil, err2
+			}
+
+			_, err2 = h.Expand()
+			if err2 != nil {
+				return nil, err2
+			}
+
+			if h.BoxInfo.Type.String() == "stbl" {
+				var co *chunkOffsetTable
+				co, err2 = writeSpillTables(mw, spillTracks[curTrackID], stats[curTrackID], co64)
+				if err2 != nil {
+					return nil, err2
+				}
+				cos = append(cos, co)
+			}
+
+			_, err2 = mw.EndBox()
+			return nil, err2
+
+		case "tkhd":
+			box, _, err2 := h.ReadPayload()
+			if err2 != nil {
+				return nil, err2
+			}
+			curTrackID = int(box.(*mp4.Tkhd).TrackID)
+
+			return nil, mw.CopyBox(skeletonR, &h.BoxInfo)
+
+		case "stts", "stss", "ctts", "stsc", "stsz", "stco", "mdat":
+			return nil, nil
+
+		default:
+			return nil, mw.CopyBox(skeletonR, &h.BoxInfo)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	headerSize, err := header.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	for _, co := range cos {
+		err = co.shift(header, uint64(headerSize)+mdatHeaderSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = header.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, header)
+	if err != nil {
+		return err
+	}
+
+	if mdatHeaderSize == 16 {
+		var buf [16]byte
+		binary.BigEndian.PutUint32(buf[0:], 1)
+		copy(buf[4:], "mdat")
+		binary.BigEndian.PutUint64(buf[8:], s.dataSize+16)
+		_, err = w.Write(buf[:])
+	} else {
+		var buf [8]byte
+		binary.BigEndian.PutUint32(buf[0:], uint32(s.dataSize+8))
+		copy(buf[4:], "mdat")
+		_, err = w.Write(buf[:])
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.data.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, s.data)
+	return err
+}
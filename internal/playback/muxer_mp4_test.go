@@ -0,0 +1,168 @@
+package playback
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+type muxerMP4TestSample struct {
+	dts       int64
+	ptsOffset int32
+	payload   []byte
+}
+
+type muxerMP4TestTrack struct {
+	ID        uint32
+	Timescale uint32
+	Duration  uint64
+	EditList  mp4.EditList
+	Samples   []mp4.Sample
+	Payloads  [][]byte
+	SyncCount int
+}
+
+func muxMP4Test(t *testing.T, m *muxerMP4) []byte {
+	var buf bytes.Buffer
+	m.w = &buf
+
+	m.writeInit(&fmp4.Init{
+		Tracks: []*fmp4.InitTrack{
+			{
+				ID:        1,
+				TimeScale: 90000,
+				Codec: &fmp4.CodecH264{
+					SPS: test.FormatH264.SPS,
+					PPS: test.FormatH264.PPS,
+				},
+			},
+			{
+				ID:        2,
+				TimeScale: 48000,
+				Codec: &fmp4.CodecMPEG4Audio{
+					Config: mpeg4audio.Config{
+						Type:         mpeg4audio.ObjectTypeAACLC,
+						SampleRate:   48000,
+						ChannelCount: 2,
+					},
+				},
+			},
+		},
+	})
+
+	// alternate tracks in parts, like segments do
+	for part := int64(-1); part < 20; part++ {
+		m.setTrack(1)
+
+		for i := int64(0); i < 10; i++ {
+			n := part*10 + i
+			err := m.writeSample(
+				n*9000+(n%3)*100,
+				int32(n%4)*3000,
+				n%10 != 0,
+				uint32(10+n%7),
+				func() ([]byte, error) {
+					return bytes.Repeat([]byte{byte(n)}, int(10+n%7)), nil
+				})
+			require.NoError(t, err)
+		}
+
+		m.setTrack(2)
+
+		for i := int64(0); i < 5; i++ {
+			n := part*5 + i
+			err := m.writeSample(
+				n*9600,
+				0,
+				false,
+				4,
+				func() ([]byte, error) {
+					return []byte{1, 2, 3, byte(n)}, nil
+				})
+			require.NoError(t, err)
+		}
+	}
+
+	m.setTrack(1)
+	m.writeFinalDTS(200 * 9000)
+	m.setTrack(2)
+	m.writeFinalDTS(100 * 9600)
+
+	err := m.flush()
+	require.NoError(t, err)
+
+	return buf.Bytes()
+}
+
+func probeMP4Test(t *testing.T, buf []byte) []muxerMP4TestTrack {
+	info, err := mp4.Probe(bytes.NewReader(buf))
+	require.NoError(t, err)
+
+	stss, err := mp4.ExtractBoxWithPayload(bytes.NewReader(buf), nil,
+		mp4.BoxPath{mp4.BoxTypeMoov(), mp4.BoxTypeTrak(), mp4.BoxTypeMdia(), mp4.BoxTypeMinf(),
+			mp4.BoxTypeStbl(), mp4.BoxTypeStss()})
+	require.NoError(t, err)
+
+	tracks := make([]muxerMP4TestTrack, len(info.Tracks))
+
+	for i, track := range info.Tracks {
+		tracks[i] = muxerMP4TestTrack{
+			ID:        track.TrackID,
+			Timescale: track.Timescale,
+			Duration:  track.Duration,
+			EditList:  track.EditList,
+		}
+
+		for _, sa := range track.Samples {
+			tracks[i].Samples = append(tracks[i].Samples, *sa)
+		}
+
+		j := 0
+		for _, chunk := range track.Chunks {
+			offset := chunk.DataOffset
+			for k := uint32(0); k < chunk.SamplesPerChunk; k++ {
+				size := uint64(track.Samples[j].Size)
+				tracks[i].Payloads = append(tracks[i].Payloads, buf[offset:offset+size])
+				offset += size
+				j++
+			}
+		}
+	}
+
+	// video track is the only one with non-sync samples
+	require.Equal(t, 1, len(stss))
+	tracks[0].SyncCount = int(stss[0].Payload.(*mp4.Stss).EntryCount)
+
+	return tracks
+}
+
+func TestMuxerMP4Spill(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	inMemory := &muxerMP4{}
+	buf1 := muxMP4Test(t, inMemory)
+	require.Nil(t, inMemory.spill)
+
+	spilled := &muxerMP4{
+		tempDir:     dir,
+		memoryLimit: 50 * muxerMP4SampleMemory,
+	}
+	buf2 := muxMP4Test(t, spilled)
+	require.NotNil(t, spilled.spill)
+
+	require.Equal(t, probeMP4Test(t, buf1), probeMP4Test(t, buf2))
+
+	spilled.close()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
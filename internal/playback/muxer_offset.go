@@ -0,0 +1,51 @@
+package playback
+
+import (
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+// muxerOffset is a muxer that shifts timestamps by a fixed amount,
+// in order to place a chunk of a recording at its position inside a longer timeline.
+type muxerOffset struct {
+	muxer
+	offset time.Duration
+
+	offsets  map[int]int64
+	curTrack int
+}
+
+func (w *muxerOffset) writeInit(init *fmp4.Init) {
+	w.offsets = make(map[int]int64)
+
+	for _, track := range init.Tracks {
+		w.offsets[track.ID] = durationGoToMp4(w.offset, track.TimeScale)
+	}
+
+	w.muxer.writeInit(init)
+}
+
+func (w *muxerOffset) setTrack(trackID int) {
+	w.curTrack = trackID
+	w.muxer.setTrack(trackID)
+}
+
+func (w *muxerOffset) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	getPayload func() ([]byte, error),
+) error {
+	// negative timestamps mark samples that precede the chunk and must not be shifted
+	if dts >= 0 {
+		dts += w.offsets[w.curTrack]
+	}
+
+	return w.muxer.writeSample(dts, ptsOffset, isNonSyncSample, payloadSize, getPayload)
+}
+
+func (w *muxerOffset) writeFinalDTS(dts int64) {
+	w.muxer.writeFinalDTS(dts + w.offsets[w.curTrack])
+}
@@ -0,0 +1,62 @@
+package playback
+
+import (
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+// muxerPrivacy is a muxer that removes samples inside privacy intervals.
+// After an interval, samples are removed until the next sync sample,
+// in order to allow decoding.
+type muxerPrivacy struct {
+	muxer
+	start     time.Time
+	intervals []privacyInterval
+
+	timeScales map[int]uint32
+	waitSync   map[int]bool
+	curTrack   int
+}
+
+func (w *muxerPrivacy) writeInit(init *fmp4.Init) {
+	w.timeScales = make(map[int]uint32)
+	w.waitSync = make(map[int]bool)
+
+	for _, track := range init.Tracks {
+		w.timeScales[track.ID] = track.TimeScale
+	}
+
+	w.muxer.writeInit(init)
+}
+
+func (w *muxerPrivacy) setTrack(trackID int) {
+	w.curTrack = trackID
+	w.muxer.setTrack(trackID)
+}
+
+func (w *muxerPrivacy) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	getPayload func() ([]byte, error),
+) error {
+	t := w.start.Add(durationMp4ToGo(dts, w.timeScales[w.curTrack]))
+
+	for _, interval := range w.intervals {
+		if interval.contains(t) {
+			w.waitSync[w.curTrack] = true
+			return nil
+		}
+	}
+
+	if w.waitSync[w.curTrack] {
+		if isNonSyncSample {
+			return nil
+		}
+		w.waitSync[w.curTrack] = false
+	}
+
+	return w.muxer.writeSample(dts, ptsOffset, isNonSyncSample, payloadSize, getPayload)
+}
@@ -0,0 +1,349 @@
+package playback
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/codecs/av1"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// samples are reordered among tracks inside this window before being written.
+const replayReorderWindow = 2 * time.Second
+
+func replayMediaFromCodec(codec fmp4.Codec) *description.Media {
+	switch codec := codec.(type) {
+	case *fmp4.CodecAV1:
+		return &description.Media{
+			Type:    description.MediaTypeVideo,
+			Formats: []format.Format{&format.AV1{PayloadTyp: 96}},
+		}
+
+	case *fmp4.CodecVP9:
+		return &description.Media{
+			Type:    description.MediaTypeVideo,
+			Formats: []format.Format{&format.VP9{PayloadTyp: 96}},
+		}
+
+	case *fmp4.CodecH265:
+		return &description.Media{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H265{
+				PayloadTyp: 96,
+				VPS:        codec.VPS,
+				SPS:        codec.SPS,
+				PPS:        codec.PPS,
+			}},
+		}
+
+	case *fmp4.CodecH264:
+		return &description.Media{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+				SPS:               codec.SPS,
+				PPS:               codec.PPS,
+			}},
+		}
+
+	case *fmp4.CodecMPEG4Video:
+		return &description.Media{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.MPEG4Video{
+				PayloadTyp:     96,
+				ProfileLevelID: 1,
+				Config:         codec.Config,
+			}},
+		}
+
+	case *fmp4.CodecMPEG1Video:
+		return &description.Media{
+			Type:    description.MediaTypeVideo,
+			Formats: []format.Format{&format.MPEG1Video{}},
+		}
+
+	case *fmp4.CodecMJPEG:
+		return &description.Media{
+			Type:    description.MediaTypeVideo,
+			Formats: []format.Format{&format.MJPEG{}},
+		}
+
+	case *fmp4.CodecOpus:
+		return &description.Media{
+			Type: description.MediaTypeAudio,
+			Formats: []format.Format{&format.Opus{
+				PayloadTyp:   96,
+				ChannelCount: codec.ChannelCount,
+			}},
+		}
+
+	case *fmp4.CodecMPEG4Audio:
+		return &description.Media{
+			Type: description.MediaTypeAudio,
+			Formats: []format.Format{&format.MPEG4Audio{
+				PayloadTyp:       96,
+				SizeLength:       13,
+				IndexLength:      3,
+				IndexDeltaLength: 3,
+				Config:           &codec.Config,
+			}},
+		}
+
+	case *fmp4.CodecMPEG1Audio:
+		return &description.Media{
+			Type:    description.MediaTypeAudio,
+			Formats: []format.Format{&format.MPEG1Audio{}},
+		}
+
+	case *fmp4.CodecAC3:
+		return &description.Media{
+			Type: description.MediaTypeAudio,
+			Formats: []format.Format{&format.AC3{
+				PayloadTyp:   96,
+				SampleRate:   codec.SampleRate,
+				ChannelCount: codec.ChannelCount,
+			}},
+		}
+
+	case *fmp4.CodecLPCM:
+		if codec.LittleEndian {
+			return nil
+		}
+
+		return &description.Media{
+			Type: description.MediaTypeAudio,
+			Formats: []format.Format{&format.LPCM{
+				PayloadTyp:   96,
+				BitDepth:     codec.BitDepth,
+				SampleRate:   codec.SampleRate,
+				ChannelCount: codec.ChannelCount,
+			}},
+		}
+	}
+
+	return nil
+}
+
+func replayDescription(init *fmp4.Init) (*description.Session, error) {
+	desc := &description.Session{}
+
+	for _, track := range init.Tracks {
+		medi := replayMediaFromCodec(track.Codec)
+		if medi == nil {
+			return nil, fmt.Errorf("unsupported codec: %T", track.Codec)
+		}
+		desc.Medias = append(desc.Medias, medi)
+	}
+
+	return desc, nil
+}
+
+func replayUnit(codec fmp4.Codec, base unit.Base, payload []byte) (unit.Unit, error) {
+	switch codec.(type) {
+	case *fmp4.CodecAV1:
+		tu, err := av1.BitstreamUnmarshal(payload, true)
+		if err != nil {
+			return nil, err
+		}
+		return &unit.AV1{Base: base, TU: tu}, nil
+
+	case *fmp4.CodecVP9:
+		return &unit.VP9{Base: base, Frame: payload}, nil
+
+	case *fmp4.CodecH265:
+		au, err := h264.AVCCUnmarshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		return &unit.H265{Base: base, AU: au}, nil
+
+	case *fmp4.CodecH264:
+		au, err := h264.AVCCUnmarshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		return &unit.H264{Base: base, AU: au}, nil
+
+	case *fmp4.CodecMPEG4Video:
+		return &unit.MPEG4Video{Base: base, Frame: payload}, nil
+
+	case *fmp4.CodecMPEG1Video:
+		return &unit.MPEG1Video{Base: base, Frame: payload}, nil
+
+	case *fmp4.CodecMJPEG:
+		return &unit.MJPEG{Base: base, Frame: payload}, nil
+
+	case *fmp4.CodecOpus:
+		return &unit.Opus{Base: base, Packets: [][]byte{payload}}, nil
+
+	case *fmp4.CodecMPEG4Audio:
+		return &unit.MPEG4Audio{Base: base, AUs: [][]byte{payload}}, nil
+
+	case *fmp4.CodecMPEG1Audio:
+		return &unit.MPEG1Audio{Base: base, Frames: [][]byte{payload}}, nil
+
+	case *fmp4.CodecAC3:
+		return &unit.AC3{Base: base, Frames: [][]byte{payload}}, nil
+
+	case *fmp4.CodecLPCM:
+		return &unit.LPCM{Base: base, Samples: payload}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported codec: %T", codec)
+}
+
+type muxerReplaySample struct {
+	track   *muxerReplayTrack
+	dts     time.Duration
+	pts     time.Duration
+	payload []byte
+}
+
+type muxerReplayTrack struct {
+	id        int
+	timeScale uint32
+	codec     fmp4.Codec
+	media     *description.Media
+	started   bool
+	gop       []*muxerReplaySample
+}
+
+// muxerReplay writes samples into a stream, at real-time speed.
+type muxerReplay struct {
+	ctx       context.Context
+	stream    *stream.Stream
+	start     time.Time
+	basePTS   time.Duration
+	wallStart time.Time
+
+	tracks   []*muxerReplayTrack
+	curTrack *muxerReplayTrack
+	queue    []*muxerReplaySample
+	lastDTS  time.Duration
+}
+
+func (w *muxerReplay) writeInit(init *fmp4.Init) {
+	w.tracks = make([]*muxerReplayTrack, len(init.Tracks))
+
+	for i, track := range init.Tracks {
+		w.tracks[i] = &muxerReplayTrack{
+			id:        track.ID,
+			timeScale: track.TimeScale,
+			codec:     track.Codec,
+			media:     w.stream.Desc().Medias[i],
+		}
+	}
+}
+
+func (w *muxerReplay) setTrack(trackID int) {
+	for _, track := range w.tracks {
+		if track.id == trackID {
+			w.curTrack = track
+			return
+		}
+	}
+	w.curTrack = nil
+}
+
+func (w *muxerReplay) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	_ uint32,
+	getPayload func() ([]byte, error),
+) error {
+	if w.curTrack == nil {
+		return nil
+	}
+
+	pl, err := getPayload()
+	if err != nil {
+		return err
+	}
+
+	smpl := &muxerReplaySample{
+		track:   w.curTrack,
+		dts:     durationMp4ToGo(dts, w.curTrack.timeScale),
+		pts:     durationMp4ToGo(dts+int64(ptsOffset), w.curTrack.timeScale),
+		payload: pl,
+	}
+
+	if dts < 0 {
+		// store GOP of the first frame, in order to write it as soon as playback starts
+		if w.curTrack.codec.IsVideo() {
+			if !isNonSyncSample {
+				w.curTrack.gop = nil
+			}
+			smpl.dts = 0
+			smpl.pts = 0
+			w.curTrack.gop = append(w.curTrack.gop, smpl)
+		}
+		return nil
+	}
+
+	if !w.curTrack.started {
+		w.curTrack.started = true
+		w.queue = append(w.queue, w.curTrack.gop...)
+		w.curTrack.gop = nil
+	}
+
+	w.queue = append(w.queue, smpl)
+
+	if smpl.dts > w.lastDTS {
+		w.lastDTS = smpl.dts
+	}
+
+	return w.writeQueue(w.lastDTS - replayReorderWindow)
+}
+
+func (w *muxerReplay) writeFinalDTS(_ int64) {
+}
+
+func (w *muxerReplay) writeQueue(maxDTS time.Duration) error {
+	sort.SliceStable(w.queue, func(i, j int) bool {
+		return w.queue[i].dts < w.queue[j].dts
+	})
+
+	n := 0
+	for _, smpl := range w.queue {
+		if smpl.dts > maxDTS {
+			break
+		}
+
+		wait := time.Until(w.wallStart.Add(smpl.dts))
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-w.ctx.Done():
+				return w.ctx.Err()
+			}
+		}
+
+		u, err := replayUnit(smpl.track.codec, unit.Base{
+			NTP: w.start.Add(smpl.dts),
+			PTS: w.basePTS + smpl.pts,
+		}, smpl.payload)
+		if err != nil {
+			return err
+		}
+
+		w.stream.WriteUnit(smpl.track.media, smpl.track.media.Formats[0], u)
+		n++
+	}
+
+	w.queue = w.queue[n:]
+	return nil
+}
+
+func (w *muxerReplay) flush() error {
+	return w.writeQueue(w.lastDTS)
+}
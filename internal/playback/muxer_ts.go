@@ -0,0 +1,177 @@
+package playback
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/mpegts"
+)
+
+// timestamps are shifted, since the PCR is written before the first DTS.
+const muxerTSTimeOffset = 1 * time.Second
+
+func durationGoToMPEGTS(v time.Duration) int64 {
+	return int64((v + muxerTSTimeOffset).Seconds() * 90000)
+}
+
+func mpegtsCodec(codec fmp4.Codec) mpegts.Codec {
+	switch codec := codec.(type) {
+	case *fmp4.CodecH265:
+		return &mpegts.CodecH265{}
+
+	case *fmp4.CodecH264:
+		return &mpegts.CodecH264{}
+
+	case *fmp4.CodecMPEG4Video:
+		return &mpegts.CodecMPEG4Video{}
+
+	case *fmp4.CodecMPEG1Video:
+		return &mpegts.CodecMPEG1Video{}
+
+	case *fmp4.CodecOpus:
+		return &mpegts.CodecOpus{
+			ChannelCount: codec.ChannelCount,
+		}
+
+	case *fmp4.CodecMPEG4Audio:
+		return &mpegts.CodecMPEG4Audio{
+			Config: codec.Config,
+		}
+
+	case *fmp4.CodecMPEG1Audio:
+		return &mpegts.CodecMPEG1Audio{}
+
+	case *fmp4.CodecAC3:
+		return &mpegts.CodecAC3{}
+	}
+
+	return nil
+}
+
+// muxerTS is a muxer that writes MPEG-TS.
+// Tracks whose codec is not supported by MPEG-TS are skipped.
+type muxerTS struct {
+	w io.Writer
+
+	muxerInterleaved
+	mw      *mpegts.Writer
+	mtracks map[int]*mpegts.Track
+}
+
+func (w *muxerTS) writeInit(init *fmp4.Init) {
+	w.onInit = w.onInterleavedInit
+	w.onSample = w.onInterleavedSample
+	w.muxerInterleaved.writeInit(init)
+}
+
+func (w *muxerTS) onInterleavedInit(tracks []*muxerInterleavedTrack) error {
+	w.mtracks = make(map[int]*mpegts.Track)
+	var mtracks []*mpegts.Track
+
+	for _, track := range tracks {
+		codec := mpegtsCodec(track.codec)
+		if codec == nil {
+			continue
+		}
+
+		mtrack := &mpegts.Track{Codec: codec}
+		w.mtracks[track.id] = mtrack
+		mtracks = append(mtracks, mtrack)
+	}
+
+	if mtracks == nil {
+		return fmt.Errorf("recording doesn't contain any track supported by MPEG-TS")
+	}
+
+	w.mw = mpegts.NewWriter(w.w, mtracks)
+	return nil
+}
+
+func (w *muxerTS) onInterleavedSample(track *muxerInterleavedTrack, sample *muxerInterleavedSample) error {
+	mtrack, ok := w.mtracks[track.id]
+	if !ok {
+		return nil
+	}
+
+	pl, err := sample.getPayload()
+	if err != nil {
+		return err
+	}
+
+	pts := durationGoToMPEGTS(sample.pts)
+	dts := durationGoToMPEGTS(sample.dts)
+
+	switch codec := track.codec.(type) {
+	case *fmp4.CodecH265:
+		var au [][]byte
+		au, err = h264.AVCCUnmarshal(pl)
+		if err != nil {
+			return err
+		}
+
+		// parameters may be stored in the initialization segment only
+		randomAccess := !sample.isNonSyncSample
+		if randomAccess && !h265ParamsPresent(au) {
+			au = append([][]byte{codec.VPS, codec.SPS, codec.PPS}, au...)
+		}
+
+		return w.mw.WriteH265(mtrack, pts, dts, randomAccess, au)
+
+	case *fmp4.CodecH264:
+		var au [][]byte
+		au, err = h264.AVCCUnmarshal(pl)
+		if err != nil {
+			return err
+		}
+
+		// parameters may be stored in the initialization segment only
+		randomAccess := !sample.isNonSyncSample
+		if randomAccess && !h264ParamsPresent(au) {
+			au = append([][]byte{codec.SPS, codec.PPS}, au...)
+		}
+
+		return w.mw.WriteH264(mtrack, pts, dts, randomAccess, au)
+
+	case *fmp4.CodecMPEG4Video:
+		return w.mw.WriteMPEG4Video(mtrack, pts, pl)
+
+	case *fmp4.CodecMPEG1Video:
+		return w.mw.WriteMPEG1Video(mtrack, pts, pl)
+
+	case *fmp4.CodecOpus:
+		return w.mw.WriteOpus(mtrack, pts, [][]byte{pl})
+
+	case *fmp4.CodecMPEG4Audio:
+		return w.mw.WriteMPEG4Audio(mtrack, pts, [][]byte{pl})
+
+	case *fmp4.CodecMPEG1Audio:
+		return w.mw.WriteMPEG1Audio(mtrack, pts, [][]byte{pl})
+
+	case *fmp4.CodecAC3:
+		return w.mw.WriteAC3(mtrack, pts, pl)
+	}
+
+	return nil
+}
+
+func h264ParamsPresent(au [][]byte) bool {
+	for _, nalu := range au {
+		if h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeSPS {
+			return true
+		}
+	}
+	return false
+}
+
+func h265ParamsPresent(au [][]byte) bool {
+	for _, nalu := range au {
+		if h265.NALUType((nalu[0]>>1)&0x3F) == h265.NALUType_SPS_NUT {
+			return true
+		}
+	}
+	return false
+}
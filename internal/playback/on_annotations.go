@@ -0,0 +1,162 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (p *Server) onAnnotationsAdd(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionAPI) {
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	var duration time.Duration
+	if v := ctx.Query("duration"); v != "" {
+		duration, err = parseDuration(v)
+		if err != nil || duration < 0 {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %s", v))
+			return
+		}
+	}
+
+	a := &annotation{
+		Path:     pathName,
+		Start:    start,
+		Duration: listEntryDuration(duration),
+		Label:    ctx.Query("label"),
+	}
+
+	err = p.annotations.add([]*annotation{a})
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	if p.exports != nil {
+		p.exports.onEvents([]*annotation{a})
+	}
+
+	ctx.JSON(http.StatusOK, a)
+}
+
+func (p *Server) onAnnotationsList(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	annotations := p.annotations.list(pathName)
+
+	switch ctx.Query("format") {
+	case "", "json":
+		ctx.JSON(http.StatusOK, annotations)
+
+	case "csv":
+		ctx.Header("Content-Type", "text/csv")
+		ctx.Status(http.StatusOK)
+		err := writeAnnotationsCSV(ctx.Writer, annotations)
+		if err != nil {
+			p.Log(logger.Error, err.Error())
+		}
+
+	default:
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", ctx.Query("format")))
+	}
+}
+
+func (p *Server) onAnnotationsImport(ctx *gin.Context) {
+	// path of entries that do not contain one
+	defaultPath := ctx.Query("path")
+
+	var annotations []*annotation
+	var err error
+
+	switch ctx.Query("format") {
+	case "", "json":
+		annotations, err = readAnnotationsJSON(ctx.Request.Body, defaultPath)
+
+	case "csv":
+		annotations, err = readAnnotationsCSV(ctx.Request.Body, defaultPath)
+
+	default:
+		err = fmt.Errorf("invalid format: %s", ctx.Query("format"))
+	}
+
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	checked := make(map[string]struct{})
+
+	for _, a := range annotations {
+		if _, ok := checked[a.Path]; ok {
+			continue
+		}
+
+		if !p.doAuth(ctx, a.Path, conf.AuthActionAPI) {
+			return
+		}
+		checked[a.Path] = struct{}{}
+	}
+
+	err = p.annotations.add(annotations)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	if p.exports != nil {
+		p.exports.onEvents(annotations)
+	}
+
+	p.Log(logger.Info, "%d annotations imported", len(annotations))
+
+	ctx.JSON(http.StatusOK, annotations)
+}
+
+func (p *Server) onAnnotationsDelete(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid ID: %w", err))
+		return
+	}
+
+	a, err := p.annotations.get(id)
+	if err != nil {
+		p.writeError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	if !p.doAuth(ctx, a.Path, conf.AuthActionAPI) {
+		return
+	}
+
+	err = p.annotations.remove(id)
+	if err != nil {
+		if errors.Is(err, errAnnotationNotFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
@@ -0,0 +1,291 @@
+package playback
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/gin-gonic/gin"
+)
+
+// archiveFile is a file of the recording directory that is part of an archive.
+type archiveFile struct {
+	fpath   string
+	storage segmentStorage
+	// path relative to the recording directory
+	name string
+}
+
+func (f *archiveFile) open() (segmentFile, fs.FileInfo, error) {
+	fi, err := f.storage.Stat(f.fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := f.storage.Open(f.fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r, fi, nil
+}
+
+// archiveFiles returns the segments and their sidecar files,
+// with paths relative to the common path of recordPath,
+// in order to allow other instances with the same recordPath to use them.
+func archiveFiles(pathConf *conf.Path, segments []*Segment) []archiveFile {
+	// %path is not replaced, in order to keep the path name in relative paths
+	recordPath, _ := filepath.Abs(pathConf.RecordPath)
+	commonPath := record.CommonPath(recordPath)
+
+	// archived segments have the same layout, starting from the root of the archive
+	var archiveRoot string
+	if pathConf.RecordArchiveTo != "" {
+		_, archiveRoot, _ = archiveStorage(pathConf.RecordArchiveTo)
+	}
+
+	var out []archiveFile
+
+	add := func(seg *Segment, fpath string) {
+		if seg.isLocal() {
+			fpath, _ = filepath.Abs(fpath)
+		}
+
+		name, err := filepath.Rel(commonPath, fpath)
+		if err != nil || strings.HasPrefix(name, "..") {
+			name, err = filepath.Rel(archiveRoot, fpath)
+			if err != nil || strings.HasPrefix(name, "..") {
+				name = filepath.Base(fpath)
+			}
+		}
+
+		out = append(out, archiveFile{
+			fpath:   fpath,
+			storage: seg.getStorage(),
+			name:    filepath.ToSlash(name),
+		})
+	}
+
+	for _, seg := range segments {
+		add(seg, seg.Fpath)
+
+		if _, err := seg.getStorage().Stat(record.ChecksumPath(seg.Fpath)); err == nil {
+			add(seg, record.ChecksumPath(seg.Fpath))
+		}
+	}
+
+	return out
+}
+
+// segmentsEnd returns the end of the last segment.
+// The duration of MPEG-TS segments is not available, therefore their end is unbounded.
+func segmentsEnd(recordFormat conf.RecordFormat, limits boxLimits, segments []*Segment) (time.Time, error) {
+	last := segments[len(segments)-1]
+
+	if recordFormat != conf.RecordFormatFMP4 {
+		return time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), nil
+	}
+
+	duration, err := segmentFMP4Duration(last, limits)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return last.Start.Add(duration), nil
+}
+
+func writeTar(w io.Writer, files []archiveFile) error {
+	tw := tar.NewWriter(w)
+
+	for _, file := range files {
+		err := func() error {
+			f, fi, err := file.open()
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			hdr, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = file.name
+
+			err = tw.WriteHeader(hdr)
+			if err != nil {
+				return err
+			}
+
+			// the segment may still be growing, copy only the size written in the header
+			_, err = io.CopyN(tw, f, fi.Size())
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, files []archiveFile) error {
+	zw := zip.NewWriter(w)
+
+	for _, file := range files {
+		err := func() error {
+			f, fi, err := file.open()
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			hdr, err := zip.FileInfoHeader(fi)
+			if err != nil {
+				return err
+			}
+			hdr.Name = file.name
+
+			// segments are already compressed
+			hdr.Method = zip.Store
+
+			fw, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.CopyN(fw, f, fi.Size())
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// onArchive streams the raw segments that cover a timespan, without remuxing them,
+// in order to allow backups and transfers to other instances.
+func (p *Server) onArchive(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	duration, err := parseDuration(ctx.Query("duration"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+		return
+	}
+
+	start, duration, err = clampLookback(lookbackLimit(ctx), start, duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	format := ctx.Query("format")
+	if format != "" && format != "tar" && format != "zip" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", format))
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, "archive", duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(pathConf, pathName, start, duration)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	// raw segments are sent whole, therefore checks are performed on the timespan they cover
+	// instead of the requested one.
+	err = checkLookback(lookbackLimit(ctx), segments[0].Start)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	// raw segments cannot be masked
+	if privacy := p.privacyFor(ctx, pathName); len(privacy) != 0 {
+		var segsEnd time.Time
+		segsEnd, err = segmentsEnd(pathConf.RecordFormat, p.boxLimits, segments)
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+
+		if privacyOverlaps(privacy, segments[0].Start, segsEnd) {
+			p.writeError(ctx, http.StatusForbidden, fmt.Errorf("timespan contains hidden recordings"))
+			return
+		}
+	}
+
+	release, ok := p.acquireReader(ctx, pathConf, pathName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	files := archiveFiles(pathConf, segments)
+
+	fileName := exportFileName(pathName, start)
+
+	writeHeaders(ctx, pathHeaders(pathConf, start.Add(duration)))
+	ctx.Header("Accept-Ranges", "none")
+
+	if format == "zip" {
+		ctx.Header("Content-Type", "application/zip")
+		ctx.Header("Content-Disposition", `attachment; filename="`+fileName+`.zip"`)
+		ctx.Status(http.StatusOK)
+		err = writeZip(ctx.Writer, files)
+	} else {
+		ctx.Header("Content-Type", "application/x-tar")
+		ctx.Header("Content-Disposition", `attachment; filename="`+fileName+`.tar"`)
+		ctx.Status(http.StatusOK)
+		err = writeTar(ctx.Writer, files)
+	}
+
+	if err != nil {
+		// user aborted the download
+		var neterr *net.OpError
+		if errors.As(err, &neterr) || ctx.Request.Context().Err() != nil {
+			return
+		}
+
+		// something has already been written: abort and write logs only
+		p.Log(logger.Error, err.Error())
+	}
+}
@@ -0,0 +1,215 @@
+package playback
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	bitrateMaxIntervals = 100000
+)
+
+type bitrateEntry struct {
+	Start   time.Time `json:"start"`
+	Bytes   uint64    `json:"bytes"`
+	Bitrate float64   `json:"bitrate"`
+}
+
+func writeBitrateCSV(w io.Writer, entries []bitrateEntry) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"start", "bytes", "bitrate"})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		err = cw.Write([]string{
+			e.Start.Format(time.RFC3339Nano),
+			strconv.FormatUint(e.Bytes, 10),
+			strconv.FormatFloat(e.Bitrate, 'f', -1, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// computeBitrate sums sizes of samples of segments into intervals.
+func computeBitrate(
+	segments []*Segment,
+	limits boxLimits,
+	start time.Time,
+	duration time.Duration,
+	interval time.Duration,
+) ([]bitrateEntry, error) {
+	count := int((duration + interval - 1) / interval)
+	entries := make([]bitrateEntry, count)
+
+	for i := range entries {
+		entries[i].Start = start.Add(time.Duration(i) * interval)
+	}
+
+	end := start.Add(duration)
+
+	for _, seg := range segments {
+		err := func() error {
+			f, err := seg.open()
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			init, err := segmentFMP4ReadInit(f, limits)
+			if err != nil {
+				return err
+			}
+
+			_, err = f.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+
+			return segmentFMP4ReadSampleSizes(f, limits, init, func(dts time.Duration, size uint32) {
+				t := seg.Start.Add(dts)
+				if t.Before(start) || !t.Before(end) {
+					return
+				}
+				entries[t.Sub(start)/interval].Bytes += uint64(size)
+			})
+		}()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range entries {
+		d := min(interval, end.Sub(entries[i].Start))
+		entries[i].Bitrate = float64(entries[i].Bytes*8) / d.Seconds()
+	}
+
+	return entries, nil
+}
+
+// onBitrate returns the bitrate of recordings over time, computed from sample sizes.
+func (p *Server) onBitrate(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	duration, err := parseDuration(ctx.Query("duration"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+		return
+	}
+
+	if duration <= 0 {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %v", duration))
+		return
+	}
+
+	start, duration, err = clampLookback(lookbackLimit(ctx), start, duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	interval := time.Second
+
+	if v := ctx.Query("interval"); v != "" {
+		interval, err = parseDuration(v)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid interval: %w", err))
+			return
+		}
+
+		if interval <= 0 {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid interval: %v", interval))
+			return
+		}
+	}
+
+	if (duration+interval-1)/interval > bitrateMaxIntervals {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("too many intervals"))
+		return
+	}
+
+	format := ctx.Query("format")
+	if format != "" && format != "json" && format != "csv" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", format))
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, "", 0)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	if pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("MPEG-TS format is not supported yet"))
+		return
+	}
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(pathConf, pathName, start, duration)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	release, ok := p.acquireReader(ctx, pathConf, pathName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	entries, err := computeBitrate(segments, p.boxLimits, start, duration, interval)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeHeaders(ctx, pathHeaders(pathConf, start.Add(duration)))
+
+	if format == "csv" {
+		ctx.Header("Content-Type", "text/csv")
+		ctx.Status(http.StatusOK)
+		err = writeBitrateCSV(ctx.Writer, entries)
+		if err != nil {
+			p.Log(logger.Error, err.Error())
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,85 @@
+package playback
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnBitrate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4"))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	start := time.Date(2008, 11, 0o7, 11, 23, 2, 500000000, time.Local)
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", start.Format(time.RFC3339Nano))
+	v.Set("duration", "3")
+	v.Set("interval", "2")
+
+	res, err := http.Get("http://localhost:9996/bitrate?" + v.Encode())
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out []bitrateEntry
+	err = json.NewDecoder(res.Body).Decode(&out)
+	require.NoError(t, err)
+
+	require.Equal(t, 2, len(out))
+	require.True(t, start.Equal(out[0].Start))
+	require.Equal(t, uint64(4), out[0].Bytes)
+	require.Equal(t, float64(16), out[0].Bitrate)
+	require.True(t, start.Add(2*time.Second).Equal(out[1].Start))
+	require.Equal(t, uint64(2), out[1].Bytes)
+	require.Equal(t, float64(16), out[1].Bitrate)
+
+	v.Set("format", "csv")
+
+	res2, err := http.Get("http://localhost:9996/bitrate?" + v.Encode())
+	require.NoError(t, err)
+	defer res2.Body.Close()
+
+	require.Equal(t, http.StatusOK, res2.StatusCode)
+	require.Equal(t, "text/csv", res2.Header.Get("Content-Type"))
+
+	byts, err := io.ReadAll(res2.Body)
+	require.NoError(t, err)
+
+	require.Equal(t, "start,bytes,bitrate\n"+
+		start.Format(time.RFC3339Nano)+",4,16\n"+
+		start.Add(2*time.Second).Format(time.RFC3339Nano)+",2,16\n", string(byts))
+}
@@ -0,0 +1,246 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// maximum duration of clips, in order to keep MP4 files small enough to be played by browsers.
+const browseClipMaxDuration = 1 * time.Hour
+
+const browseDayFormat = "2006-01-02"
+
+// browseItem is an item of the media browser of Home Assistant.
+type browseItem struct {
+	Title            string        `json:"title"`
+	MediaClass       string        `json:"media_class"`
+	MediaContentID   string        `json:"media_content_id"`
+	MediaContentType string        `json:"media_content_type"`
+	CanPlay          bool          `json:"can_play"`
+	CanExpand        bool          `json:"can_expand"`
+	Thumbnail        *string       `json:"thumbnail"`
+	Children         []*browseItem `json:"children,omitempty"`
+}
+
+// browseDays returns the days that contain recordings, in local time.
+func browseDays(entries []listEntry) []time.Time {
+	var out []time.Time
+
+	for _, entry := range entries {
+		end := entry.Start.Add(time.Duration(entry.Duration))
+		start := entry.Start.Local()
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+
+		for day.Before(end) {
+			if len(out) == 0 || !out[len(out)-1].Equal(day) {
+				out = append(out, day)
+			}
+			day = day.AddDate(0, 0, 1)
+		}
+	}
+
+	return out
+}
+
+// browseClips splits recordings of a day into clips.
+func browseClips(entries []listEntry, day time.Time) []listEntry {
+	dayEnd := day.AddDate(0, 0, 1)
+	var out []listEntry
+
+	for _, entry := range entries {
+		start := entry.Start
+		end := entry.Start.Add(time.Duration(entry.Duration))
+
+		if start.Before(day) {
+			start = day
+		}
+		if end.After(dayEnd) {
+			end = dayEnd
+		}
+
+		for start.Before(end) {
+			clipEnd := start.Add(browseClipMaxDuration)
+			if clipEnd.After(end) {
+				clipEnd = end
+			}
+
+			out = append(out, listEntry{
+				Start:    start,
+				Duration: listEntryDuration(clipEnd.Sub(start)),
+			})
+			start = clipEnd
+		}
+	}
+
+	return out
+}
+
+func (p *Server) browseBaseURL(ctx *gin.Context) string {
+	if p.Encryption {
+		return "https://" + ctx.Request.Host + routePrefix(ctx)
+	}
+	return "http://" + ctx.Request.Host + routePrefix(ctx)
+}
+
+// onBrowse lists recordings in the format of the media browser of Home Assistant,
+// that is paths, then days, then clips that can be played directly.
+func (p *Server) onBrowse(ctx *gin.Context) {
+	baseURL := p.browseBaseURL(ctx)
+
+	pathName, ok := ctx.GetQuery("path")
+	if !ok {
+		p.browsePaths(ctx, baseURL)
+		return
+	}
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, "", 0)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	segments, err := p.segmentCache.findSegments(pathConf, pathName)
+	if err == nil {
+		segments = removeSegmentsBefore(segments, lookbackLimit(ctx))
+		if segments == nil {
+			err = errNoSegmentsFound
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	entries, err := computeDurationAndConcatenate(pathConf.RecordFormat, p.boxLimits, segments)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	rawDay, ok := ctx.GetQuery("day")
+	if !ok {
+		p.browseDays(ctx, baseURL, pathName, entries)
+		return
+	}
+
+	day, err := time.ParseInLocation(browseDayFormat, rawDay, time.Local)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid day: %w", err))
+		return
+	}
+
+	v := url.Values{}
+	v.Set("path", pathName)
+	v.Set("day", rawDay)
+
+	out := &browseItem{
+		Title:          pathName + " - " + rawDay,
+		MediaClass:     "directory",
+		MediaContentID: baseURL + "/browse?" + v.Encode(),
+		CanExpand:      true,
+		Children:       []*browseItem{},
+	}
+
+	for _, clip := range browseClips(entries, day) {
+		v := url.Values{}
+		v.Set("path", pathName)
+		v.Set("start", clip.Start.Format(time.RFC3339Nano))
+		v.Set("duration", strconv.FormatFloat(time.Duration(clip.Duration).Seconds(), 'f', -1, 64))
+		v.Set("format", "mp4")
+
+		out.Children = append(out.Children, &browseItem{
+			Title: clip.Start.Local().Format("15:04:05") + " - " +
+				clip.Start.Add(time.Duration(clip.Duration)).Local().Format("15:04:05"),
+			MediaClass:       "video",
+			MediaContentID:   baseURL + "/get?" + v.Encode(),
+			MediaContentType: "video/mp4",
+			CanPlay:          true,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, out)
+}
+
+func (p *Server) browsePaths(ctx *gin.Context, baseURL string) {
+	names, denied := p.readablePaths(ctx)
+	_, _, hasCredentials := ctx.Request.BasicAuth()
+
+	// ask for credentials if they are needed to access some paths
+	if len(names) == 0 && denied && !hasCredentials {
+		ctx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+		ctx.Writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	out := &browseItem{
+		Title:          "Recordings",
+		MediaClass:     "directory",
+		MediaContentID: baseURL + "/browse",
+		CanExpand:      true,
+		Children:       []*browseItem{},
+	}
+
+	for _, name := range names {
+		v := url.Values{}
+		v.Set("path", name)
+
+		out.Children = append(out.Children, &browseItem{
+			Title:          name,
+			MediaClass:     "directory",
+			MediaContentID: baseURL + "/browse?" + v.Encode(),
+			CanExpand:      true,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, out)
+}
+
+func (p *Server) browseDays(ctx *gin.Context, baseURL string, pathName string, entries []listEntry) {
+	v := url.Values{}
+	v.Set("path", pathName)
+
+	out := &browseItem{
+		Title:          pathName,
+		MediaClass:     "directory",
+		MediaContentID: baseURL + "/browse?" + v.Encode(),
+		CanExpand:      true,
+		Children:       []*browseItem{},
+	}
+
+	days := browseDays(entries)
+
+	// most recent days first
+	for i := len(days) - 1; i >= 0; i-- {
+		v.Set("day", days[i].Format(browseDayFormat))
+
+		out.Children = append(out.Children, &browseItem{
+			Title:          days[i].Format(browseDayFormat),
+			MediaClass:     "directory",
+			MediaContentID: baseURL + "/browse?" + v.Encode(),
+			CanExpand:      true,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, out)
+}
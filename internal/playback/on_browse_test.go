@@ -0,0 +1,97 @@
+package playback
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnBrowse(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-08_11-23-02-500000.mp4"))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	browse := func(v url.Values) browseItem {
+		res, err2 := http.Get("http://localhost:9996/browse?" + v.Encode())
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var out browseItem
+		err2 = json.NewDecoder(res.Body).Decode(&out)
+		require.NoError(t, err2)
+		return out
+	}
+
+	out := browse(url.Values{})
+	require.Equal(t, 1, len(out.Children))
+	require.Equal(t, "mypath", out.Children[0].Title)
+	require.Equal(t, "http://localhost:9996/browse?path=mypath", out.Children[0].MediaContentID)
+
+	out = browse(url.Values{"path": []string{"mypath"}})
+	require.Equal(t, 2, len(out.Children))
+	require.Equal(t, "2008-11-08", out.Children[0].Title)
+	require.Equal(t, "2008-11-07", out.Children[1].Title)
+	require.Equal(t, "http://localhost:9996/browse?day=2008-11-07&path=mypath", out.Children[1].MediaContentID)
+
+	out = browse(url.Values{"path": []string{"mypath"}, "day": []string{"2008-11-08"}})
+	require.Equal(t, []*browseItem{{
+		Title:            "11:23:02 - 11:23:05",
+		MediaClass:       "video",
+		MediaContentType: "video/mp4",
+		MediaContentID: "http://localhost:9996/get?duration=3&format=mp4&path=mypath&start=" +
+			url.QueryEscape(time.Date(2008, 11, 8, 11, 23, 2, 500000000, time.Local).Format(time.RFC3339Nano)),
+		CanPlay: true,
+	}}, out.Children)
+}
+
+func TestBrowseClips(t *testing.T) {
+	day := time.Date(2008, 11, 7, 0, 0, 0, 0, time.Local)
+
+	clips := browseClips([]listEntry{
+		{
+			Start:    day.Add(-30 * time.Minute),
+			Duration: listEntryDuration(90 * time.Minute),
+		},
+		{
+			Start:    day.Add(23 * time.Hour),
+			Duration: listEntryDuration(2 * time.Hour),
+		},
+	}, day)
+
+	require.Equal(t, []listEntry{
+		{Start: day, Duration: listEntryDuration(time.Hour)},
+		{Start: day.Add(23 * time.Hour), Duration: listEntryDuration(time.Hour)},
+	}, clips)
+}
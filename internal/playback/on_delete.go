@@ -0,0 +1,143 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/gin-gonic/gin"
+)
+
+func segmentFMP4Duration(seg *Segment, limits boxLimits) (time.Duration, error) {
+	f, err := seg.open()
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	init, err := segmentFMP4ReadInit(f, limits)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	return segmentFMP4ReadMaxDuration(f, limits, init)
+}
+
+// onDelete removes the segments that are entirely inside a timespan.
+// Segments that are partially inside the timespan, segments that are being written
+// and archived segments are kept.
+func (p *Server) onDelete(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionAPI) {
+		return
+	}
+
+	if p.inMaintenanceMode() {
+		p.writeError(ctx, http.StatusServiceUnavailable, errMaintenanceMode)
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	duration, err := parseDuration(ctx.Query("duration"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("MPEG-TS format is not supported yet"))
+		return
+	}
+
+	segments, err := p.segmentCache.findSegments(pathConf, pathName)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	end := start.Add(duration)
+	deleted := make(map[string]struct{})
+	out := []listEntry{}
+
+	for _, seg := range segments {
+		if seg.Start.Before(start) || !seg.Start.Before(end) || p.Registry.SegmentIsOpen(seg.Fpath) ||
+			seg.archived {
+			continue
+		}
+
+		var segDuration time.Duration
+		segDuration, err = segmentFMP4Duration(seg, p.boxLimits)
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+
+		if seg.Start.Add(segDuration).After(end) {
+			continue
+		}
+
+		err = os.Remove(seg.Fpath)
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		os.Remove(record.ChecksumPath(seg.Fpath))
+		p.Registry.SegmentsChanged(pathName)
+
+		p.Log(logger.Info, "removed segment %s", seg.Fpath)
+
+		p.Notifier.Publish(notify.Event{
+			Type:   notify.EventSegmentDelete,
+			Path:   pathName,
+			Fields: map[string]string{"segmentPath": seg.Fpath},
+		})
+
+		deleted[seg.Fpath] = struct{}{}
+		out = append(out, listEntry{
+			Start:    seg.Start,
+			Duration: listEntryDuration(segDuration),
+		})
+	}
+
+	if pathConf.RecordIndexPath != "" && len(deleted) != 0 {
+		err = record.IndexPrune(pathConf.RecordIndexPath, pathName, func(entry record.IndexEntry) bool {
+			_, ok := deleted[entry.Path]
+			return !ok
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			p.Log(logger.Warn, "unable to prune index: %v", err)
+		}
+
+		p.Registry.SegmentsChanged(pathName)
+	}
+
+	ctx.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,101 @@
+package playback
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnDelete(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	seg1 := filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4")
+	seg2 := filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4")
+
+	writeSegment1(t, seg1)
+	writeSegment2(t, seg2)
+
+	for _, entry := range []record.IndexEntry{
+		{
+			Start:    time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local),
+			Duration: 62 * time.Second,
+			Path:     seg1,
+		},
+		{
+			Start:    time.Date(2008, 11, 0o7, 11, 23, 2, 500000000, time.Local),
+			Duration: 3 * time.Second,
+			Path:     seg2,
+		},
+	} {
+		err = record.IndexAdd(filepath.Join(dir, "index"), "mypath", entry)
+		require.NoError(t, err)
+	}
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable:  true,
+				RecordIndexPath: filepath.Join(dir, "index"),
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	// the first segment starts before the timespan and is kept
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 0, 0, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "60")
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	req, err := http.NewRequest(http.MethodDelete, "http://localhost:9996/delete?"+v.Encode(), nil)
+	require.NoError(t, err)
+
+	res, err := hc.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out []listEntry
+	err = json.NewDecoder(res.Body).Decode(&out)
+	require.NoError(t, err)
+
+	require.Len(t, out, 1)
+	require.True(t, out[0].Start.Equal(time.Date(2008, 11, 0o7, 11, 23, 2, 500000000, time.Local)))
+
+	_, err = os.Stat(seg1)
+	require.NoError(t, err)
+
+	_, err = os.Stat(seg2)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	entries, err := record.IndexRead(filepath.Join(dir, "index"), "mypath")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, seg1, entries[0].Path)
+}
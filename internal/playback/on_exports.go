@@ -0,0 +1,340 @@
+package playback
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (p *Server) onExportsAdd(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	if p.inMaintenanceMode() {
+		p.writeError(ctx, http.StatusServiceUnavailable, errMaintenanceMode)
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	duration, err := parseDuration(ctx.Query("duration"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+		return
+	}
+
+	start, duration, err = clampLookback(lookbackLimit(ctx), start, duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	format := ctx.Query("format")
+	if format != "" && format != "fmp4" && format != "mp4" && format != "clone" && format != "static" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", format))
+		return
+	}
+
+	gapPolicy := ctx.Query("gapPolicy")
+	if gapPolicy != "" && gapPolicy != "stop" && gapPolicy != "pad" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid gapPolicy: %s", gapPolicy))
+		return
+	}
+
+	encryption := ctx.Query("encryption")
+
+	// the 'cbcs' scheme, that uses pattern encryption with AES-CBC, is not implemented
+	if encryption == "cbcs" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("encryption scheme 'cbcs' is not supported, use 'cenc'"))
+		return
+	}
+
+	if encryption != "" && encryption != "cenc" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid encryption: %s", encryption))
+		return
+	}
+
+	integrity := ctx.Query("integrity")
+	if integrity != "" && integrity != "verify" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid integrity: %s", integrity))
+		return
+	}
+
+	profile := ctx.Query("profile")
+	if profile != "" && profile != exportProfileLegal {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid profile: %s", profile))
+		return
+	}
+
+	priority, err := p.requestPriority(ctx, conf.PlaybackPriorityBulk)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid priority: %w", err))
+		return
+	}
+
+	idempotencyKey, err := exportIdempotencyKey(ctx)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	var keyExpires *time.Time
+
+	if v, ok := ctx.GetQuery("keyExpiry"); ok {
+		if encryption == "" {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("keyExpiry requires encryption"))
+			return
+		}
+
+		var keyExpiry time.Duration
+		keyExpiry, err = parseDuration(v)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid keyExpiry: %w", err))
+			return
+		}
+
+		if keyExpiry != 0 {
+			t := time.Now().Add(keyExpiry)
+			keyExpires = &t
+		}
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, playbackFormat(format), duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	// encrypted exports are written by the fMP4 muxer directly
+	if encryption != "" && (format == "mp4" || pathConf.PlaybackFilter != "") {
+		p.writeError(ctx, http.StatusBadRequest,
+			fmt.Errorf("encryption is not compatible with MP4 format and playbackFilter"))
+		return
+	}
+
+	// clone exports contain raw segments
+	if format == "clone" && (encryption != "" || gapPolicy != "" || pathConf.PlaybackFilter != "") {
+		p.writeError(ctx, http.StatusBadRequest,
+			fmt.Errorf("clone format is not compatible with encryption, gapPolicy and playbackFilter"))
+		return
+	}
+
+	// static exports are made of independent segments, that are encrypted and filtered separately
+	if format == "static" && (encryption != "" || pathConf.PlaybackFilter != "") {
+		p.writeError(ctx, http.StatusBadRequest,
+			fmt.Errorf("static format is not compatible with encryption and playbackFilter"))
+		return
+	}
+
+	if profile == exportProfileLegal {
+		err = checkLegalExport(pathConf, format, gapPolicy, p.exports.signingKey != nil)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		// segments of legal exports are always verified
+		integrity = "verify"
+	}
+
+	// check the filler in advance
+	_, err = loadPathGapFiller(pathConf, gapPolicy, p.boxLimits)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	applyPrivacy := p.privacy != nil && !p.isPrivileged(ctx, pathName)
+
+	job, replayed, err := p.exports.add(pathName, start, duration, format, gapPolicy, applyPrivacy, lookbackLimit(ctx),
+		encryption, keyExpires, integrity, priority, profile, quotaIdentity(ctx), idempotencyKey)
+	if err != nil {
+		if errors.Is(err, errIdempotencyKeyReused) {
+			p.writeError(ctx, http.StatusUnprocessableEntity, err)
+		} else {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	if replayed {
+		ctx.Header("Idempotent-Replayed", "true")
+	}
+
+	out := job.public()
+	out.KeyToken = job.KeyToken
+
+	ctx.JSON(http.StatusOK, out)
+}
+
+// getExport returns the job with the ID in the URL, checking that the user can read its path.
+func (p *Server) getExport(ctx *gin.Context) (exportJob, bool) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid ID: %w", err))
+		return exportJob{}, false
+	}
+
+	job, ok := p.exports.get(id)
+	if !ok {
+		p.writeError(ctx, http.StatusNotFound, fmt.Errorf("export not found"))
+		return exportJob{}, false
+	}
+
+	if !p.doAuth(ctx, job.Path, conf.AuthActionPlayback) {
+		return exportJob{}, false
+	}
+
+	// exports created by other users may contain older recordings
+	err = checkLookback(lookbackLimit(ctx), job.Start)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return exportJob{}, false
+	}
+
+	// exports created by privileged users may contain hidden recordings
+	if !job.ApplyPrivacy && p.privacy != nil && !p.isPrivileged(ctx, job.Path) {
+		p.writeError(ctx, http.StatusForbidden, fmt.Errorf("export may contain hidden recordings"))
+		return exportJob{}, false
+	}
+
+	return job, true
+}
+
+func (p *Server) onExportsGet(ctx *gin.Context) {
+	job, ok := p.getExport(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job.public())
+}
+
+func (p *Server) onExportsDownload(ctx *gin.Context) {
+	job, ok := p.getExport(ctx)
+	if !ok {
+		return
+	}
+
+	if job.Status != exportJobDone {
+		p.writeError(ctx, http.StatusConflict, fmt.Errorf("export is %s", job.Status))
+		return
+	}
+
+	if job.Format == "clone" {
+		ctx.File(filepath.Join(p.exports.dirPath(job.ID), "manifest.json"))
+		return
+	}
+
+	if job.Format == "static" {
+		ctx.Header("Content-Type", "application/vnd.apple.mpegurl")
+		ctx.File(filepath.Join(p.exports.dirPath(job.ID), staticPlaylistName))
+		return
+	}
+
+	ctx.Header("Content-Type", "video/mp4")
+	ctx.File(p.exports.filePath(job.ID))
+}
+
+// onExportsSignature returns the signed manifest of an export,
+// that allows recipients to verify that the export has been produced by this server.
+func (p *Server) onExportsSignature(ctx *gin.Context) {
+	job, ok := p.getExport(ctx)
+	if !ok {
+		return
+	}
+
+	if job.Status != exportJobDone {
+		p.writeError(ctx, http.StatusConflict, fmt.Errorf("export is %s", job.Status))
+		return
+	}
+
+	buf, err := os.ReadFile(p.exports.signaturePath(job.ID))
+	if err != nil {
+		p.writeError(ctx, http.StatusNotFound, fmt.Errorf("export is not signed"))
+		return
+	}
+
+	ctx.Data(http.StatusOK, "application/json", buf)
+}
+
+func (p *Server) onExportsCustody(ctx *gin.Context) {
+	job, ok := p.getExport(ctx)
+	if !ok {
+		return
+	}
+
+	if job.Status != exportJobDone {
+		p.writeError(ctx, http.StatusConflict, fmt.Errorf("export is %s", job.Status))
+		return
+	}
+
+	buf, err := os.ReadFile(p.exports.custodyPath(job.ID))
+	if err != nil {
+		p.writeError(ctx, http.StatusNotFound, fmt.Errorf("export doesn't have a custody report"))
+		return
+	}
+
+	ctx.Data(http.StatusOK, "application/json", buf)
+}
+
+// onExportsKey delivers the key of an encrypted export, in the W3C Clear Key format.
+// It doesn't require credentials when the key token is provided, since it is meant to be used
+// by external parties that received the export.
+func (p *Server) onExportsKey(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		p.writeError(ctx, http.StatusNotFound, fmt.Errorf("export not found"))
+		return
+	}
+
+	job, ok := p.exports.get(id)
+	if !ok || job.Encryption == "" {
+		p.writeError(ctx, http.StatusNotFound, fmt.Errorf("export not found"))
+		return
+	}
+
+	// export IDs are not secret, therefore they are not enough to obtain the key
+	token := ctx.Query("token")
+	if job.KeyToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(job.KeyToken)) != 1 {
+		if !p.doAuth(ctx, job.Path, conf.AuthActionPlayback) {
+			return
+		}
+	}
+
+	if job.KeyExpires != nil && !time.Now().Before(*job.KeyExpires) {
+		p.writeError(ctx, http.StatusGone, fmt.Errorf("key is expired"))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"keys": []gin.H{{
+			"kty": "oct",
+			"kid": base64.RawURLEncoding.EncodeToString(job.KeyID[:]),
+			"k":   base64.RawURLEncoding.EncodeToString(job.Key),
+		}},
+		"type": "temporary",
+	})
+}
@@ -1,30 +1,48 @@
 package playback
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/gin-gonic/gin"
 )
 
 type writerWrapper struct {
-	ctx     *gin.Context
-	written bool
+	ctx         *gin.Context
+	headers     map[string]string
+	contentType string
+	status      int
+	written     bool
 }
 
 func (w *writerWrapper) Write(p []byte) (int, error) {
 	if !w.written {
 		w.written = true
-		w.ctx.Header("Accept-Ranges", "none")
-		w.ctx.Header("Content-Type", "video/mp4")
+		writeHeaders(w.ctx, w.headers)
+		if !hasHeader(w.headers, "Accept-Ranges") {
+			w.ctx.Header("Accept-Ranges", "none")
+		}
+		if w.contentType != "" {
+			w.ctx.Header("Content-Type", w.contentType)
+		} else {
+			w.ctx.Header("Content-Type", "video/mp4")
+		}
+		if w.status != 0 {
+			w.ctx.Status(w.status)
+		}
 	}
 	return w.ctx.Writer.Write(p)
 }
@@ -39,65 +57,138 @@ func parseDuration(raw string) (time.Duration, error) {
 	return time.ParseDuration(raw)
 }
 
+// muxCheckpoint is a position between two segments from which muxing can be resumed.
+type muxCheckpoint struct {
+	// number of segments that have been muxed
+	segments int
+	// end of the last muxed segment
+	end time.Time
+}
+
 func seekAndMux(
 	recordFormat conf.RecordFormat,
+	limits boxLimits,
 	segments []*Segment,
 	start time.Time,
 	duration time.Duration,
+	privacy []privacyInterval,
+	filler *gapFiller,
 	m muxer,
 ) error {
+	return seekAndMuxResume(recordFormat, limits, segments, start, duration, privacy, filler, m, muxCheckpoint{}, nil)
+}
+
+// seekAndMuxResume is like seekAndMux, but skips the segments that have already been muxed,
+// and calls onCheckpoint after each segment.
+func seekAndMuxResume(
+	recordFormat conf.RecordFormat,
+	limits boxLimits,
+	segments []*Segment,
+	start time.Time,
+	duration time.Duration,
+	privacy []privacyInterval,
+	filler *gapFiller,
+	m muxer,
+	from muxCheckpoint,
+	onCheckpoint func(muxCheckpoint) error,
+) error {
+	// privacy is enforced here in order not to depend on callers
+	if len(privacy) != 0 {
+		m = &muxerPrivacy{
+			muxer:     m,
+			start:     start,
+			intervals: privacy,
+		}
+	}
+
 	if recordFormat == conf.RecordFormatFMP4 {
 		var firstInit *fmp4.Init
 		var segmentEnd time.Time
 
-		f, err := os.Open(segments[0].Fpath)
+		f, err := segments[0].open()
 		if err != nil {
 			return err
 		}
 		defer f.Close()
 
-		firstInit, err = segmentFMP4ReadInit(f)
+		firstInit, err = segmentFMP4ReadInit(f, limits)
 		if err != nil {
 			return err
 		}
 
 		m.writeInit(firstInit)
 
-		segmentStartOffset := start.Sub(segments[0].Start)
+		if from.segments == 0 {
+			segmentStartOffset := start.Sub(segments[0].Start)
 
-		segmentMaxElapsed, err := segmentFMP4SeekAndMuxParts(f, segmentStartOffset, duration, firstInit, m)
-		if err != nil {
-			return err
+			var segmentMaxElapsed time.Duration
+			segmentMaxElapsed, err = segmentFMP4SeekAndMuxParts(f, limits, segmentStartOffset, duration, firstInit, m)
+			if err != nil {
+				return err
+			}
+
+			segmentEnd = start.Add(segmentMaxElapsed)
+
+			if onCheckpoint != nil {
+				err = onCheckpoint(muxCheckpoint{segments: 1, end: segmentEnd})
+				if err != nil {
+					return err
+				}
+			}
+
+			from.segments = 1
+		} else {
+			segmentEnd = from.end
 		}
 
-		segmentEnd = start.Add(segmentMaxElapsed)
+		for i := from.segments; i < len(segments); i++ {
+			seg := segments[i]
 
-		for _, seg := range segments[1:] {
-			f, err = os.Open(seg.Fpath)
+			f, err = seg.open()
 			if err != nil {
 				return err
 			}
 			defer f.Close()
 
 			var init *fmp4.Init
-			init, err = segmentFMP4ReadInit(f)
+			init, err = segmentFMP4ReadInit(f, limits)
 			if err != nil {
 				return err
 			}
 
-			if !segmentFMP4CanBeConcatenated(firstInit, segmentEnd, init, seg.Start) {
+			// discontinuities detected by the recorder are handled like gaps,
+			// even when segments are contiguous
+			if seg.discontinuity != "" && filler == nil {
 				break
 			}
 
+			if !segmentFMP4CanBeConcatenated(firstInit, segmentEnd, init, seg.Start) {
+				if filler == nil || !filler.canFill(firstInit, segmentEnd, init, seg.Start) {
+					break
+				}
+
+				err = filler.fill(segmentEnd.Sub(start), min(seg.Start.Sub(start), duration), m)
+				if err != nil {
+					return err
+				}
+			}
+
 			segmentStartOffset := seg.Start.Sub(start)
 
 			var segmentMaxElapsed time.Duration
-			segmentMaxElapsed, err = segmentFMP4MuxParts(f, segmentStartOffset, duration, firstInit, m)
+			segmentMaxElapsed, err = segmentFMP4MuxParts(f, limits, segmentStartOffset, duration, firstInit, m)
 			if err != nil {
 				return err
 			}
 
 			segmentEnd = start.Add(segmentMaxElapsed)
+
+			if onCheckpoint != nil {
+				err = onCheckpoint(muxCheckpoint{segments: i + 1, end: segmentEnd})
+				if err != nil {
+					return err
+				}
+			}
 		}
 
 		err = m.flush()
@@ -111,10 +202,76 @@ func seekAndMux(
 	return fmt.Errorf("MPEG-TS format is not supported yet")
 }
 
+// segmentsLastModified returns the modification time of the newest segment.
+func segmentsLastModified(segments []*Segment) (time.Time, error) {
+	var out time.Time
+
+	for _, seg := range segments {
+		fi, err := seg.Stat()
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if fi.ModTime().After(out) {
+			out = fi.ModTime()
+		}
+	}
+
+	return out, nil
+}
+
+// contentETag returns an entity tag that identifies the output of a request.
+// Since output is deterministic, it depends on parameters and on the state of segments only.
+func contentETag(
+	pathName string,
+	start time.Time,
+	duration time.Duration,
+	format string,
+	gapPolicy string,
+	segments []*Segment,
+	privacy []privacyInterval,
+) (string, error) {
+	rev, err := contentRevision(segments, privacy)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.Sum256([]byte(canonicalGetURL("", pathName, start, duration, format, gapPolicy, rev)))
+
+	return `"` + hex.EncodeToString(h[:16]) + `"`, nil
+}
+
+// etagMatches checks whether an entity tag is contained in the value of a If-None-Match header.
+func etagMatches(header string, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotModified checks whether the client already owns the latest version of a response.
+func isNotModified(ctx *gin.Context, etag string, lastModified time.Time) bool {
+	// If-None-Match takes precedence over If-Modified-Since
+	if inm := ctx.GetHeader("If-None-Match"); inm != "" {
+		return etag != "" && etagMatches(inm, etag)
+	}
+
+	ims, err := http.ParseTime(ctx.GetHeader("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	// HTTP dates have a resolution of one second
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
 func (p *Server) onGet(ctx *gin.Context) {
 	pathName := ctx.Query("path")
 
-	if !p.doAuth(ctx, pathName) {
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
 		return
 	}
 
@@ -124,50 +281,427 @@ func (p *Server) onGet(ctx *gin.Context) {
 		return
 	}
 
-	duration, err := parseDuration(ctx.Query("duration"))
-	if err != nil {
-		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+	// when both duration and end are omitted, playback is open-ended
+	// and follows the recording while it is being written.
+	var duration time.Duration
+	follow := false
+
+	rawDuration := ctx.Query("duration")
+	rawEnd := ctx.Query("end")
+
+	switch {
+	case rawDuration != "" && rawEnd != "":
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("duration and end cannot be used together"))
 		return
-	}
 
-	ww := &writerWrapper{ctx: ctx}
-	var m muxer
+	case rawEnd != "":
+		var end time.Time
+		end, err = time.Parse(time.RFC3339, rawEnd)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid end: %w", err))
+			return
+		}
 
-	format := ctx.Query("format")
-	switch format {
-	case "", "fmp4":
-		m = &muxerFMP4{w: ww}
+		duration = end.Sub(start)
+		if duration <= 0 {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("end must be after start"))
+			return
+		}
 
-	case "mp4":
-		m = &muxerMP4{w: ww}
+	case rawDuration == "" || rawDuration == "inf":
+		follow = true
 
 	default:
+		duration, err = parseDuration(rawDuration)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+			return
+		}
+	}
+
+	start, duration, err = clampLookback(lookbackLimit(ctx), start, duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	format := ctx.Query("format")
+	if format != "" && format != "fmp4" && format != "mp4" && format != "ts" && format != "mkv" && format != "hls" {
 		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", format))
 		return
 	}
 
+	// HLS playlists contain relative URLs of segments, therefore they are served by a dedicated endpoint
+	if format == "hls" {
+		query := ctx.Request.URL.Query()
+		query.Del("format")
+		ctx.Redirect(http.StatusFound, routePrefix(ctx)+"/hls/index.m3u8?"+query.Encode())
+		return
+	}
+
+	gapPolicy := ctx.Query("gapPolicy")
+	if gapPolicy != "" && gapPolicy != "stop" && gapPolicy != "pad" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid gapPolicy: %s", gapPolicy))
+		return
+	}
+
+	integrity := ctx.Query("integrity")
+	if integrity != "" && integrity != "verify" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid integrity: %s", integrity))
+		return
+	}
+
+	dryRun := ctx.Query("dryRun")
+	if dryRun != "" && dryRun != "true" && dryRun != "false" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid dryRun: %s", dryRun))
+		return
+	}
+
+	if follow {
+		if (format != "" && format != "fmp4") || gapPolicy != "" || integrity != "" || dryRun == "true" || ctx.Query("progressId") != "" {
+			p.writeError(ctx, http.StatusBadRequest,
+				fmt.Errorf("open-ended playback doesn't support mp4, ts, mkv, gapPolicy, integrity, dryRun and progressId"))
+			return
+		}
+
+		// the size of open-ended playback is unknown
+		if ctx.Request.Method == http.MethodHead {
+			ctx.Header("Accept-Ranges", "none")
+			ctx.Header("Content-Type", "video/mp4")
+			ctx.Status(http.StatusOK)
+			return
+		}
+
+		p.followRecording(ctx, pathName, start, p.privacyFor(ctx, pathName))
+		return
+	}
+
+	if dryRun == "true" {
+		p.writePlan(ctx, pathName, start, duration, format, gapPolicy)
+		return
+	}
+
+	var progress *downloadProgress
+	if id := ctx.Query("progressId"); id != "" && ctx.Request.Method != http.MethodHead {
+		progress, err = p.progress.add(id, pathName, duration)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		defer p.progress.finish(progress)
+	}
+
+	p.writeRecording(ctx, pathName, start, duration, format, gapPolicy, integrity, ctx.Query("rev"),
+		p.privacyFor(ctx, pathName), true, progress)
+}
+
+// wholeSegment returns the segment that is entirely covered by a timespan,
+// if the timespan starts at the beginning of the segment and doesn't contain other segments.
+func wholeSegment(
+	segments []*Segment,
+	start time.Time,
+	duration time.Duration,
+	limits boxLimits,
+	registry *record.Registry,
+) (*Segment, error) {
+	if !segments[0].Start.Equal(start) || registry.SegmentIsOpen(segments[0].Fpath) {
+		return nil, nil
+	}
+
+	// the next segment may start exactly at the end of the timespan
+	if len(segments) > 1 && segments[1].Start.Before(start.Add(duration)) {
+		return nil, nil
+	}
+
+	segDuration, err := segmentFMP4Duration(segments[0], limits)
+	if err != nil {
+		return nil, err
+	}
+
+	if segDuration > duration {
+		return nil, nil
+	}
+
+	return segments[0], nil
+}
+
+// writeRecording writes the recordings of a path inside the given timespan.
+// It returns true when the recordings have been entirely sent.
+func (p *Server) writeRecording(
+	ctx *gin.Context,
+	pathName string,
+	start time.Time,
+	duration time.Duration,
+	format string,
+	gapPolicy string,
+	integrity string,
+	rev string,
+	privacy []privacyInterval,
+	allowPeers bool,
+	progress *downloadProgress,
+) bool {
 	pathConf, err := p.safeFindPathConf(pathName)
 	if err != nil {
 		p.writeError(ctx, http.StatusBadRequest, err)
-		return
+		return false
 	}
 
-	segments, err := findSegmentsInTimespan(pathConf, pathName, start, duration)
+	err = checkPlayback(pathConf, playbackFormat(format), duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return false
+	}
+
+	filler, err := loadPathGapFiller(pathConf, gapPolicy, p.boxLimits)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return false
+	}
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(pathConf, pathName, start, duration)
 	if err != nil {
 		if errors.Is(err, errNoSegmentsFound) {
+			if allowPeers && p.usePeers(ctx) && p.forwardGet(ctx) {
+				return false
+			}
 			p.writeError(ctx, http.StatusNotFound, err)
 		} else {
 			p.writeError(ctx, http.StatusBadRequest, err)
 		}
-		return
+		return false
+	}
+
+	lastModified, err := segmentsLastModified(segments)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return false
+	}
+
+	// output changes when a privacy interval is added
+	for _, interval := range privacy {
+		if interval.Created.After(lastModified) {
+			lastModified = interval.Created
+		}
+	}
+
+	headers := pathHeaders(pathConf, start.Add(duration))
+	headers["Last-Modified"] = lastModified.UTC().Format(http.TimeFormat)
+
+	// the output of filters is not guaranteed to be deterministic
+	var etag string
+	if pathConf.PlaybackFilter == "" {
+		etag, err = contentETag(pathName, start, duration, format, gapPolicy, segments, privacy)
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return false
+		}
+		headers["ETag"] = etag
+	}
+
+	switch {
+	case rev != "":
+		var curRev string
+		if windowFinished(pathConf, start.Add(duration)) && pathConf.PlaybackFilter == "" {
+			curRev, err = contentRevision(segments, privacy)
+			if err != nil {
+				p.writeError(ctx, http.StatusInternalServerError, err)
+				return false
+			}
+		}
+
+		// content has changed, redirect to the current URL
+		if rev != curRev {
+			ctx.Header("Cache-Control", "no-store")
+			ctx.Redirect(http.StatusFound, canonicalGetURL(routePrefix(ctx), pathName, start, duration, format, gapPolicy, curRev))
+			return false
+		}
+
+		headers["Cache-Control"] = immutableCacheControl
+
+	case !windowFinished(pathConf, start.Add(duration)) && !hasHeader(headers, "Cache-Control"):
+		headers["Cache-Control"] = liveCacheControl(pathConf)
+	}
+
+	if isNotModified(ctx, etag, lastModified) {
+		writeHeaders(ctx, headers)
+		ctx.Status(http.StatusNotModified)
+		return false
+	}
+
+	// when the timespan covers exactly one segment, the segment can be served as is,
+	// avoiding remuxing and allowing byte-range requests.
+	if pathConf.PlaybackServeSegments && playbackFormat(format) == "fmp4" && pathConf.RecordFormat == conf.RecordFormatFMP4 &&
+		pathConf.PlaybackFilter == "" && len(privacy) == 0 && integrity == "" && progress == nil {
+		var seg *Segment
+		seg, err = wholeSegment(segments, start, duration, p.boxLimits, p.Registry)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, err)
+			return false
+		}
+
+		if seg != nil {
+			release, ok := p.acquireReader(ctx, pathConf, pathName)
+			if !ok {
+				return false
+			}
+			defer release()
+
+			p.writeSegmentFile(ctx, seg, headers)
+
+			// segments are served with http.ServeContent, that doesn't report errors
+			return ctx.Writer.Status() < http.StatusMultipleChoices && ctx.Request.Context().Err() == nil
+		}
+	}
+
+	if ctx.Request.Method == http.MethodHead {
+		p.writeRecordingHead(ctx, pathConf, pathName, segments, start, duration, format, integrity,
+			privacy, filler, headers, progress)
+		return false
+	}
+
+	release, ok := p.acquireMuxer(ctx, pathConf, pathName)
+	if !ok {
+		return false
+	}
+	defer release()
+
+	// the result of the verification is sent as a trailer,
+	// in order not to delay the response until all segments are read.
+	if integrity == "verify" {
+		headers["Trailer"] = "X-Integrity"
+	}
+
+	ww := &writerWrapper{
+		ctx:         ctx,
+		headers:     headers,
+		contentType: formatContentType(format),
+	}
+	var w io.Writer = ww
+	if progress != nil {
+		w = &progressWriter{w: ww, progress: progress}
+	}
+
+	// position of the first requested byte
+	var skipStart int64
+
+	// since output is deterministic, byte ranges can be extracted from the output.
+	if etag != "" && integrity == "" && progress == nil {
+		if !rangesSupported(format) {
+			headers["Accept-Ranges"] = "none"
+		} else {
+			headers["Accept-Ranges"] = "bytes"
+
+			if rawRange := ctx.GetHeader("Range"); rawRange != "" && ifRangeMatches(ctx, etag, headers["Last-Modified"]) {
+				// invalid headers are ignored without computing the size
+				if _, ok, _ = parseByteRanges(rawRange, math.MaxInt64); ok {
+					var size int64
+					size, err = p.recordingSize(etag, pathConf, segments, start, duration, format, privacy, filler)
+					if err != nil {
+						if errors.Is(err, errNoSegmentsFound) {
+							p.writeError(ctx, http.StatusNotFound, err)
+						} else {
+							p.writeError(ctx, http.StatusBadRequest, err)
+						}
+						return false
+					}
+
+					var rngs []byteRange
+					rngs, _, err = parseByteRanges(rawRange, size)
+					if err != nil {
+						writeHeaders(ctx, headers)
+						ctx.Header("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+						ctx.Status(http.StatusRequestedRangeNotSatisfiable)
+						return false
+					}
+
+					skipStart = rngs[0].start
+
+					if len(rngs) == 1 {
+						headers["Content-Range"] = rngs[0].contentRange(size)
+						headers["Content-Length"] = strconv.FormatInt(rngs[0].length(), 10)
+						ww.status = http.StatusPartialContent
+						w = &rangeWriter{w: ww, r: rngs[0]}
+					} else {
+						partContentType := ww.contentType
+						if partContentType == "" {
+							partContentType = "video/mp4"
+						}
+
+						mrw := newMultiRangeWriter(ww, rngs, partContentType, size)
+						headers["Content-Length"] = strconv.FormatInt(mrw.length(), 10)
+						ww.contentType = mrw.responseContentType()
+						ww.status = http.StatusPartialContent
+						w = mrw
+					}
+				}
+			}
+		}
+	}
+
+	// the size of whole responses is cached, in order to serve the following range requests,
+	// that are used to resume downloads, with a single pass.
+	var counter *countWriter
+	if etag != "" && integrity == "" && progress == nil && rangesSupported(format) && ww.status == 0 {
+		if size, ok := p.sizeCache.get(etag); ok {
+			headers["Content-Length"] = strconv.FormatInt(size, 10)
+		} else {
+			counter = &countWriter{w: w}
+			w = counter
+		}
+	}
+
+	var filter *exportFilter
+	if pathConf.PlaybackFilter != "" {
+		filter, err = startExportFilter(ctx.Request.Context(), pathConf.PlaybackFilter, []string{
+			"MTX_PATH=" + pathName,
+			"MTX_START=" + start.Format(time.RFC3339Nano),
+			"MTX_DURATION=" + strconv.FormatFloat(duration.Seconds(), 'f', -1, 64),
+		}, w)
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return false
+		}
+		w = filter
+
+		// the output of the filter doesn't correspond to the output of the muxer
+		skipStart = 0
+	}
+
+	m, closeM := p.newGetMuxer(format, w, skipStart)
+	defer closeM()
+
+	if progress != nil {
+		m = &muxerProgress{muxer: m, progress: progress}
+	}
+
+	// segments are verified while they are read, in order to vouch for the data that is served.
+	var verifier *segmentVerifier
+	if integrity == "verify" {
+		verifier = &segmentVerifier{}
+		defer verifier.close()
+		segments = verifier.wrap(segments)
+	}
+
+	muxStart := time.Now()
+	err = seekAndMux(pathConf.RecordFormat, p.boxLimits, segments, start, duration, privacy, filler, m)
+	addMuxTime(ctx, time.Since(muxStart))
+
+	if errors.Is(err, errRangeWritten) {
+		err = nil
+	}
+
+	if filter != nil {
+		err2 := filter.close()
+		if err == nil {
+			err = err2
+		}
 	}
 
-	err = seekAndMux(pathConf.RecordFormat, segments, start, duration, m)
 	if err != nil {
 		// user aborted the download
 		var neterr *net.OpError
-		if errors.As(err, &neterr) {
-			return
+		if errors.As(err, &neterr) || ctx.Request.Context().Err() != nil {
+			return false
 		}
 
 		// nothing has been written yet; send back JSON
@@ -177,11 +711,166 @@ func (p *Server) onGet(ctx *gin.Context) {
 			} else {
 				p.writeError(ctx, http.StatusBadRequest, err)
 			}
-			return
+			return false
 		}
 
 		// something has already been written: abort and write logs only
 		p.Log(logger.Error, err.Error())
+		return false
+	}
+
+	if counter != nil {
+		p.sizeCache.set(etag, counter.n)
+	}
+
+	if verifier != nil {
+		ctx.Writer.Header().Set("X-Integrity", string(verifier.report().Result))
+	}
+
+	return true
+}
+
+// writeRecordingHead answers HEAD requests.
+// When byte ranges are supported, the size of the output is computed without reading the content of recordings.
+func (p *Server) writeRecordingHead(
+	ctx *gin.Context,
+	pathConf *conf.Path,
+	pathName string,
+	segments []*Segment,
+	start time.Time,
+	duration time.Duration,
+	format string,
+	integrity string,
+	privacy []privacyInterval,
+	filler *gapFiller,
+	headers map[string]string,
+	progress *downloadProgress,
+) {
+	if etag := headers["ETag"]; etag != "" && integrity == "" && progress == nil && rangesSupported(format) {
+		// recordings are read only when the size is not cached
+		size, ok := p.sizeCache.get(etag)
+		if !ok {
+			var release func()
+			release, ok = p.acquireReader(ctx, pathConf, pathName)
+			if !ok {
+				return
+			}
+			defer release()
+
+			var err error
+			size, err = p.recordingSize(etag, pathConf, segments, start, duration, format, privacy, filler)
+			if err != nil {
+				if errors.Is(err, errNoSegmentsFound) {
+					p.writeError(ctx, http.StatusNotFound, err)
+				} else {
+					p.writeError(ctx, http.StatusBadRequest, err)
+				}
+				return
+			}
+		}
+
+		headers["Accept-Ranges"] = "bytes"
+		headers["Content-Length"] = strconv.FormatInt(size, 10)
+	} else {
+		headers["Accept-Ranges"] = "none"
+	}
+
+	if integrity == "verify" {
+		headers["Trailer"] = "X-Integrity"
+	}
+
+	writeHeaders(ctx, headers)
+	ctx.Header("Content-Type", formatContentType(format))
+	ctx.Status(http.StatusOK)
+}
+
+// ifRangeMatches checks whether a range request can be served,
+// that is when the If-Range header is missing or matches the current version of the response.
+func ifRangeMatches(ctx *gin.Context, etag string, lastModified string) bool {
+	ir := ctx.GetHeader("If-Range")
+	return ir == "" || ir == etag || ir == lastModified
+}
+
+// rangesSupported checks whether the size of the output of a format
+// can be computed from the size of samples, without reading their content.
+func rangesSupported(format string) bool {
+	switch format {
+	case "", "fmp4", "mp4", "mkv":
+		return true
+	}
+	return false
+}
+
+// recordingSize computes the size of the output of writeRecording.
+// Only the sample tables of recordings are read, and sizes are cached by ETag.
+func (p *Server) recordingSize(
+	etag string,
+	pathConf *conf.Path,
+	segments []*Segment,
+	start time.Time,
+	duration time.Duration,
+	format string,
+	privacy []privacyInterval,
+	filler *gapFiller,
+) (int64, error) {
+	if size, ok := p.sizeCache.get(etag); ok {
+		return size, nil
+	}
+
+	cw := &countWriter{}
+	m, closeM := p.newGetMuxer(format, cw, 0)
+	defer closeM()
+
+	err := seekAndMux(pathConf.RecordFormat, p.boxLimits, segments, start, duration, privacy, filler,
+		&muxerSizer{muxer: m})
+	if err != nil {
+		return 0, err
+	}
+
+	p.sizeCache.set(etag, cw.n)
+
+	return cw.n, nil
+}
+
+// newGetMuxer allocates a muxer.
+// When skipStart is not zero, payloads written entirely before skipStart are not read.
+func (p *Server) newGetMuxer(format string, w io.Writer, skipStart int64) (muxer, func()) {
+	var skipper *payloadSkipper
+	if skipStart != 0 && rangesSupported(format) {
+		skipper = &payloadSkipper{w: w, start: skipStart}
+		w = skipper
+	}
+
+	switch format {
+	case "mp4":
+		m := &muxerMP4{
+			w:           w,
+			tempDir:     p.TempDir,
+			memoryLimit: uint64(p.MemoryLimit),
+			skipper:     skipper,
+		}
+		return m, m.close
+
+	case "ts":
+		return &muxerTS{w: w}, func() {}
+
+	case "mkv":
+		return &muxerMKV{w: w, skipper: skipper}, func() {}
+
+	default:
+		return &muxerFMP4{w: w, skipper: skipper}, func() {}
+	}
+}
+
+func (p *Server) writeSegmentFile(ctx *gin.Context, seg *Segment, headers map[string]string) {
+	f, err := seg.open()
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
 		return
 	}
+	defer f.Close()
+
+	writeHeaders(ctx, headers)
+	ctx.Header("Content-Type", "video/mp4")
+	http.ServeContent(ctx.Writer, ctx.Request, "", time.Time{}, f)
 }
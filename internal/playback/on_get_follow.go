@@ -0,0 +1,138 @@
+package playback
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/gin-gonic/gin"
+)
+
+// interval between checks for completed segments in open-ended playback.
+const followInterval = 1 * time.Second
+
+// open-ended playback ends after this number of checks in which
+// no segment has been completed and no segment is being written.
+const followMaxIdleChecks = 3
+
+// duration used to mux segments in open-ended playback.
+const followMaxDuration = 100 * 365 * 24 * time.Hour
+
+// removeOpenSegments removes segments that are still being written by the recorder.
+func removeOpenSegments(segments []*Segment, registry *record.Registry) []*Segment {
+	var out []*Segment
+	for _, seg := range segments {
+		if !registry.SegmentIsOpen(seg.Fpath) {
+			out = append(out, seg)
+		}
+	}
+	return out
+}
+
+// followRecording writes the recordings of a path from start on,
+// and keeps writing segments as they are completed by the recorder,
+// until the recording stops, it cannot be concatenated or the client disconnects.
+func (p *Server) followRecording(
+	ctx *gin.Context,
+	pathName string,
+	start time.Time,
+	privacy []privacyInterval,
+) {
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, "fmp4", followMaxDuration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	release, ok := p.acquireMuxer(ctx, pathConf, pathName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// the response grows over time, therefore it can't be cached
+	headers := pathHeaders(pathConf, start.Add(followMaxDuration))
+	headers["Cache-Control"] = "no-store"
+
+	ww := &writerWrapper{
+		ctx:     ctx,
+		headers: headers,
+	}
+	mux := &muxerFMP4{w: ww}
+	m := &muxerContext{ctx: ctx.Request.Context(), muxer: mux}
+
+	var from muxCheckpoint
+	idleChecks := 0
+
+	for {
+		segments, err := p.segmentCache.findSegmentsInTimespan(pathConf, pathName, start, followMaxDuration)
+		if err != nil && !errors.Is(err, errNoSegmentsFound) {
+			break
+		}
+		segments = removeOpenSegments(segments, p.Registry)
+
+		if len(segments) > from.segments {
+			idleChecks = 0
+
+			err = seekAndMuxResume(pathConf.RecordFormat, p.boxLimits, segments, start, followMaxDuration, privacy, nil, m, from,
+				func(c muxCheckpoint) error {
+					from = c
+
+					err2 := mux.flushCheckpoint()
+					if err2 != nil {
+						return err2
+					}
+
+					ctx.Writer.Flush()
+					return nil
+				})
+			if err != nil {
+				// user aborted the download
+				var neterr *net.OpError
+				if errors.As(err, &neterr) || ctx.Request.Context().Err() != nil {
+					return
+				}
+
+				if !ww.written {
+					p.writeError(ctx, http.StatusBadRequest, err)
+					return
+				}
+
+				p.Log(logger.Error, err.Error())
+				return
+			}
+
+			// the initialization segment has been written already
+			mux.skipInit = true
+
+			// next segment can't be concatenated, for instance because tracks have changed
+			if from.segments < len(segments) {
+				break
+			}
+		} else if len(p.Registry.OpenSegments(pathName)) == 0 {
+			idleChecks++
+			if idleChecks >= followMaxIdleChecks {
+				break
+			}
+		}
+
+		select {
+		case <-time.After(followInterval):
+		case <-ctx.Request.Context().Done():
+			return
+		}
+	}
+
+	if !ww.written {
+		p.writeError(ctx, http.StatusNotFound, errNoSegmentsFound)
+	}
+}
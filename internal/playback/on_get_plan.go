@@ -0,0 +1,206 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// getPlanSegment is a segment that is used by a download.
+type getPlanSegment struct {
+	Start    time.Time         `json:"start"`
+	Duration listEntryDuration `json:"duration"`
+	// estimated size of the part of the segment inside the timespan
+	Size int64 `json:"size"`
+}
+
+// getPlan describes how a download is going to be performed.
+type getPlan struct {
+	Segments []getPlanSegment `json:"segments"`
+	// the download stops before the end of the timespan
+	// when recordings are missing or cannot be concatenated.
+	End           time.Time `json:"end"`
+	Truncated     bool      `json:"truncated"`
+	EstimatedSize int64     `json:"estimatedSize"`
+}
+
+// planFMP4Segment returns the duration of a segment
+// and the size of the fragments that are inside the timespan.
+func planFMP4Segment(
+	r io.ReadSeeker,
+	limits boxLimits,
+	init *fmp4.Init,
+	segmentStart time.Time,
+	start time.Time,
+	end time.Time,
+) (time.Duration, int64, error) {
+	_, err := r.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	maxDuration, err := segmentFMP4ReadMaxDuration(r, limits, init)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fragments, err := segmentFMP4ReadFragments(r, limits, init)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var size int64
+
+	for i, fragment := range fragments {
+		fragmentStart := segmentStart.Add(fragment.dts)
+		fragmentEnd := segmentStart.Add(maxDuration)
+		if i < (len(fragments) - 1) {
+			fragmentEnd = segmentStart.Add(fragments[i+1].dts)
+		}
+
+		if fragmentStart.Before(end) && fragmentEnd.After(start) {
+			size += fragment.size
+		}
+	}
+
+	return maxDuration, size, nil
+}
+
+// planRecording computes the plan of a download, with the same rules of seekAndMux, without muxing.
+func planRecording(
+	recordFormat conf.RecordFormat,
+	limits boxLimits,
+	segments []*Segment,
+	start time.Time,
+	duration time.Duration,
+	filler *gapFiller,
+) (*getPlan, error) {
+	if recordFormat != conf.RecordFormatFMP4 {
+		return nil, fmt.Errorf("MPEG-TS format is not supported yet")
+	}
+
+	end := start.Add(duration)
+
+	out := &getPlan{
+		Segments: []getPlanSegment{},
+	}
+
+	var firstInit *fmp4.Init
+	var segmentEnd time.Time
+
+	for i, seg := range segments {
+		stop, err := func() (bool, error) {
+			f, err := seg.open()
+			if err != nil {
+				return false, err
+			}
+			defer f.Close()
+
+			init, err := segmentFMP4ReadInit(f, limits)
+			if err != nil {
+				return false, err
+			}
+
+			if i == 0 {
+				firstInit = init
+			} else if (seg.discontinuity != "" && filler == nil) ||
+				(!segmentFMP4CanBeConcatenated(firstInit, segmentEnd, init, seg.Start) &&
+					(filler == nil || !filler.canFill(firstInit, segmentEnd, init, seg.Start))) {
+				return true, nil
+			}
+
+			maxDuration, size, err := planFMP4Segment(f, limits, init, seg.Start, start, end)
+			if err != nil {
+				return false, err
+			}
+
+			out.Segments = append(out.Segments, getPlanSegment{
+				Start:    seg.Start,
+				Duration: listEntryDuration(maxDuration),
+				Size:     size,
+			})
+			out.EstimatedSize += size
+			segmentEnd = seg.Start.Add(maxDuration)
+
+			return false, nil
+		}()
+		if err != nil {
+			return nil, err
+		}
+
+		if stop {
+			break
+		}
+	}
+
+	out.End = segmentEnd
+	if out.End.After(end) {
+		out.End = end
+	}
+	out.Truncated = out.End.Before(end)
+
+	return out, nil
+}
+
+// writePlan resolves the segments of a download and writes its plan, without muxing them.
+func (p *Server) writePlan(
+	ctx *gin.Context,
+	pathName string,
+	start time.Time,
+	duration time.Duration,
+	format string,
+	gapPolicy string,
+) {
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, playbackFormat(format), duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	filler, err := loadPathGapFiller(pathConf, gapPolicy, p.boxLimits)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(pathConf, pathName, start, duration)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	release, ok := p.acquireReader(ctx, pathConf, pathName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	plan, err := planRecording(pathConf.RecordFormat, p.boxLimits, segments, start, duration, filler)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, plan)
+}
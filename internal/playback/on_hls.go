@@ -0,0 +1,373 @@
+package playback
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	hlsSegmentDuration = 10 * time.Second
+)
+
+type hlsRequest struct {
+	pathName string
+	pathConf *conf.Path
+	start    time.Time
+	duration time.Duration
+}
+
+func (r *hlsRequest) segmentCount() int {
+	return int((r.duration + hlsSegmentDuration - 1) / hlsSegmentDuration)
+}
+
+// hlsIV returns the initialization vector of the initialization segment (index 0)
+// or of a media segment (index 1 and following).
+func hlsIV(index int) []byte {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(index))
+	return iv
+}
+
+// hlsEncrypt encrypts a segment with AES-128-CBC and PKCS7 padding.
+func hlsEncrypt(key []byte, iv []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	out := make([]byte, len(data)+padding)
+	copy(out, data)
+	for i := len(data); i < len(out); i++ {
+		out[i] = byte(padding)
+	}
+
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return out, nil
+}
+
+func (p *Server) parseHLSRequest(ctx *gin.Context) (*hlsRequest, bool) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return nil, false
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return nil, false
+	}
+
+	duration, err := parseDuration(ctx.Query("duration"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+		return nil, false
+	}
+
+	if duration <= 0 {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %v", duration))
+		return nil, false
+	}
+
+	start, duration, err = clampLookback(lookbackLimit(ctx), start, duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return nil, false
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	err = checkPlayback(pathConf, "hls", duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return nil, false
+	}
+
+	return &hlsRequest{
+		pathName: pathName,
+		pathConf: pathConf,
+		start:    start,
+		duration: duration,
+	}, true
+}
+
+// hlsKey returns the key of the session in the URL, if any.
+func (p *Server) hlsKey(ctx *gin.Context, req *hlsRequest) ([]byte, bool) {
+	v := ctx.Query("session")
+	if v == "" {
+		if p.HLSEncryption {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("encryption is required"))
+			return nil, false
+		}
+		return nil, true
+	}
+
+	id, err := uuid.Parse(v)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid session: %w", err))
+		return nil, false
+	}
+
+	key, ok := p.hlsSessions.use(id, req.pathName)
+	if !ok {
+		p.writeError(ctx, http.StatusNotFound, fmt.Errorf("session not found"))
+		return nil, false
+	}
+
+	return key, true
+}
+
+func (p *Server) writeHLSSegment(
+	ctx *gin.Context,
+	key []byte,
+	index int,
+	data []byte,
+	headers map[string]string,
+) {
+	if key != nil {
+		var err error
+		data, err = hlsEncrypt(key, hlsIV(index), data)
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	writeHeaders(ctx, headers)
+	ctx.Header("Content-Type", "video/mp4")
+
+	// segments are deterministic and built in memory, therefore byte ranges can be served,
+	// allowing players to resume interrupted downloads.
+	http.ServeContent(ctx.Writer, ctx.Request, "", time.Time{}, bytes.NewReader(data))
+}
+
+func (p *Server) onHLSPlaylist(ctx *gin.Context) {
+	req, ok := p.parseHLSRequest(ctx)
+	if !ok {
+		return
+	}
+
+	encryption := ctx.Query("encryption")
+	if encryption != "" && encryption != "aes128" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid encryption: %s", encryption))
+		return
+	}
+
+	_, err := p.segmentCache.findSegmentsInTimespan(req.pathConf, req.pathName, req.start, req.duration)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	// forward all query parameters, including credentials, to the other endpoints
+	query := ctx.Request.URL.Query()
+	query.Del("encryption")
+
+	encrypt := p.HLSEncryption || encryption == "aes128"
+
+	if encrypt {
+		var id uuid.UUID
+		id, err = p.hlsSessions.add(req.pathName)
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		query.Set("session", id.String())
+	}
+
+	keyTag := func(index int) string {
+		return "#EXT-X-KEY:METHOD=AES-128,URI=\"key?" + query.Encode() + "\"," +
+			"IV=0x" + hex.EncodeToString(hlsIV(index)) + "\n"
+	}
+
+	var b strings.Builder
+
+	b.WriteString("#EXTM3U\n" +
+		"#EXT-X-VERSION:7\n" +
+		"#EXT-X-TARGETDURATION:" + strconv.FormatInt(int64(math.Ceil(hlsSegmentDuration.Seconds())), 10) + "\n" +
+		"#EXT-X-MEDIA-SEQUENCE:0\n" +
+		"#EXT-X-PLAYLIST-TYPE:VOD\n")
+
+	if encrypt {
+		b.WriteString(keyTag(0))
+	}
+
+	b.WriteString("#EXT-X-MAP:URI=\"init.mp4?" + query.Encode() + "\"\n")
+
+	for i := 0; i < req.segmentCount(); i++ {
+		if encrypt {
+			b.WriteString(keyTag(i + 1))
+		}
+
+		d := min(hlsSegmentDuration, req.duration-time.Duration(i)*hlsSegmentDuration)
+
+		segQuery := url.Values{}
+		for k, v := range query {
+			segQuery[k] = v
+		}
+		segQuery.Set("index", strconv.FormatInt(int64(i), 10))
+
+		b.WriteString("#EXTINF:" + strconv.FormatFloat(d.Seconds(), 'f', 3, 64) + ",\n" +
+			"segment.m4s?" + segQuery.Encode() + "\n")
+	}
+
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	// encrypted playlists contain a session, therefore they must never be cached
+	if encrypt {
+		ctx.Header("Cache-Control", "no-store")
+	} else {
+		writeHeaders(ctx, pathHeaders(req.pathConf, req.start.Add(req.duration)))
+	}
+	ctx.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(b.String()))
+}
+
+func (p *Server) onHLSKey(ctx *gin.Context) {
+	req, ok := p.parseHLSRequest(ctx)
+	if !ok {
+		return
+	}
+
+	key, ok := p.hlsKey(ctx, req)
+	if !ok {
+		return
+	}
+
+	if key == nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("session is missing"))
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, "application/octet-stream", key)
+}
+
+func (p *Server) onHLSInit(ctx *gin.Context) {
+	req, ok := p.parseHLSRequest(ctx)
+	if !ok {
+		return
+	}
+
+	key, ok := p.hlsKey(ctx, req)
+	if !ok {
+		return
+	}
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(req.pathConf, req.pathName, req.start, req.duration)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	if req.pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("MPEG-TS format is not supported yet"))
+		return
+	}
+
+	f, err := segments[0].open()
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	init, err := segmentFMP4ReadInit(f, p.boxLimits)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	var buf seekablebuffer.Buffer
+	err = init.Marshal(&buf)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	p.writeHLSSegment(ctx, key, 0, buf.Bytes(), pathHeaders(req.pathConf, req.start.Add(req.duration)))
+}
+
+func (p *Server) onHLSSegment(ctx *gin.Context) {
+	req, ok := p.parseHLSRequest(ctx)
+	if !ok {
+		return
+	}
+
+	index, err := strconv.ParseUint(ctx.Query("index"), 10, 31)
+	if err != nil || int(index) >= req.segmentCount() {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid index"))
+		return
+	}
+
+	key, ok := p.hlsKey(ctx, req)
+	if !ok {
+		return
+	}
+
+	offset := time.Duration(index) * hlsSegmentDuration
+	start := req.start.Add(offset)
+	duration := min(hlsSegmentDuration, req.duration-offset)
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(req.pathConf, req.pathName, start, duration)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	release, ok := p.acquireMuxer(ctx, req.pathConf, req.pathName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// segments are written in memory since they have to be encrypted as a whole
+	var buf bytes.Buffer
+
+	muxStart := time.Now()
+	err = seekAndMux(req.pathConf.RecordFormat, p.boxLimits, segments, start, duration,
+		p.privacyFor(ctx, req.pathName), nil,
+		&muxerOffset{
+			muxer:  &muxerFMP4{w: &buf, skipInit: true},
+			offset: offset,
+		})
+	addMuxTime(ctx, time.Since(muxStart))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	p.writeHLSSegment(ctx, key, int(index)+1, buf.Bytes(), pathHeaders(req.pathConf, start.Add(duration)))
+}
@@ -0,0 +1,309 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// muxerKeyframe is a muxer that writes only the first keyframe of a track.
+type muxerKeyframe struct {
+	muxer
+	trackID int
+
+	curTrack int
+	written  bool
+}
+
+func (w *muxerKeyframe) setTrack(trackID int) {
+	w.curTrack = trackID
+	w.muxer.setTrack(trackID)
+}
+
+func (w *muxerKeyframe) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	getPayload func() ([]byte, error),
+) error {
+	if w.curTrack != w.trackID || w.written || dts < 0 || isNonSyncSample {
+		return nil
+	}
+
+	w.written = true
+	return w.muxer.writeSample(dts, ptsOffset, isNonSyncSample, payloadSize, getPayload)
+}
+
+func (w *muxerKeyframe) writeFinalDTS(dts int64) {
+	if w.curTrack == w.trackID {
+		w.muxer.writeFinalDTS(dts)
+	}
+}
+
+// hlsKeyframes returns the ID of the first video track
+// and the position of its keyframes inside the timespan of a request.
+func hlsKeyframes(req *hlsRequest, limits boxLimits, segments []*Segment) (int, []time.Duration, error) {
+	if req.pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		return 0, nil, fmt.Errorf("MPEG-TS format is not supported yet")
+	}
+
+	end := req.start.Add(req.duration)
+	trackID := 0
+	var out []time.Duration
+
+	for _, seg := range segments {
+		err := func() error {
+			f, err := seg.open()
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			var init *fmp4.Init
+			init, err = segmentFMP4ReadInit(f, limits)
+			if err != nil {
+				return err
+			}
+
+			if trackID == 0 {
+				for _, track := range init.Tracks {
+					if track.Codec.IsVideo() {
+						trackID = track.ID
+						break
+					}
+				}
+
+				if trackID == 0 {
+					return fmt.Errorf("recording doesn't contain any video track")
+				}
+			}
+
+			_, err = f.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+
+			return segmentFMP4ReadKeyframes(f, limits, init, trackID, func(dts time.Duration) {
+				t := seg.Start.Add(dts)
+				if !t.Before(req.start) && t.Before(end) {
+					out = append(out, t.Sub(req.start))
+				}
+			})
+		}()
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if out == nil {
+		return 0, nil, errNoSegmentsFound
+	}
+
+	return trackID, out, nil
+}
+
+// hlsKeyframeDuration returns the time between a keyframe and the next one.
+func hlsKeyframeDuration(req *hlsRequest, keyframes []time.Duration, i int) time.Duration {
+	if i < (len(keyframes) - 1) {
+		return keyframes[i+1] - keyframes[i]
+	}
+	return req.duration - keyframes[i]
+}
+
+// hlsKeyframeIndex returns the index of a I-frame segment that is used to compute its initialization vector.
+// I-frame segments follow media segments, in order to use distinct vectors.
+func hlsKeyframeIndex(req *hlsRequest, index int) int {
+	return req.segmentCount() + 1 + index
+}
+
+func (p *Server) findHLSKeyframes(ctx *gin.Context, req *hlsRequest) (int, []time.Duration, bool) {
+	segments, err := p.segmentCache.findSegmentsInTimespan(req.pathConf, req.pathName, req.start, req.duration)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return 0, nil, false
+	}
+
+	trackID, keyframes, err := hlsKeyframes(req, p.boxLimits, segments)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return 0, nil, false
+	}
+
+	return trackID, keyframes, true
+}
+
+// onHLSIFramesPlaylist writes a playlist made of keyframes only,
+// that can be used by players to show previews while seeking.
+func (p *Server) onHLSIFramesPlaylist(ctx *gin.Context) {
+	req, ok := p.parseHLSRequest(ctx)
+	if !ok {
+		return
+	}
+
+	encryption := ctx.Query("encryption")
+	if encryption != "" && encryption != "aes128" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid encryption: %s", encryption))
+		return
+	}
+
+	_, keyframes, ok := p.findHLSKeyframes(ctx, req)
+	if !ok {
+		return
+	}
+
+	// forward all query parameters, including credentials, to the other endpoints
+	query := ctx.Request.URL.Query()
+	query.Del("encryption")
+
+	encrypt := p.HLSEncryption || encryption == "aes128"
+
+	if encrypt {
+		id, err := p.hlsSessions.add(req.pathName)
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		query.Set("session", id.String())
+	}
+
+	keyTag := func(iv []byte) string {
+		return "#EXT-X-KEY:METHOD=AES-128,URI=\"key?" + query.Encode() + "\"," +
+			"IV=0x" + hex.EncodeToString(iv) + "\n"
+	}
+
+	var targetDuration time.Duration
+	for i := range keyframes {
+		targetDuration = max(targetDuration, hlsKeyframeDuration(req, keyframes, i))
+	}
+
+	var b strings.Builder
+
+	b.WriteString("#EXTM3U\n" +
+		"#EXT-X-VERSION:7\n" +
+		"#EXT-X-TARGETDURATION:" + strconv.FormatInt(int64(math.Ceil(targetDuration.Seconds())), 10) + "\n" +
+		"#EXT-X-MEDIA-SEQUENCE:0\n" +
+		"#EXT-X-PLAYLIST-TYPE:VOD\n" +
+		"#EXT-X-I-FRAMES-ONLY\n")
+
+	if encrypt {
+		b.WriteString(keyTag(hlsIV(0)))
+	}
+
+	b.WriteString("#EXT-X-MAP:URI=\"init.mp4?" + query.Encode() + "\"\n")
+
+	for i := range keyframes {
+		if encrypt {
+			b.WriteString(keyTag(hlsIV(hlsKeyframeIndex(req, i))))
+		}
+
+		segQuery := url.Values{}
+		for k, v := range query {
+			segQuery[k] = v
+		}
+		segQuery.Set("index", strconv.FormatInt(int64(i), 10))
+
+		d := hlsKeyframeDuration(req, keyframes, i)
+
+		b.WriteString("#EXTINF:" + strconv.FormatFloat(d.Seconds(), 'f', 3, 64) + ",\n" +
+			"iframe.m4s?" + segQuery.Encode() + "\n")
+	}
+
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	// encrypted playlists contain a session, therefore they must never be cached
+	if encrypt {
+		ctx.Header("Cache-Control", "no-store")
+	} else {
+		writeHeaders(ctx, pathHeaders(req.pathConf, req.start.Add(req.duration)))
+	}
+	ctx.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(b.String()))
+}
+
+// onHLSIFrame writes a segment that contains a single keyframe.
+func (p *Server) onHLSIFrame(ctx *gin.Context) {
+	req, ok := p.parseHLSRequest(ctx)
+	if !ok {
+		return
+	}
+
+	index, err := strconv.ParseUint(ctx.Query("index"), 10, 31)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid index"))
+		return
+	}
+
+	key, ok := p.hlsKey(ctx, req)
+	if !ok {
+		return
+	}
+
+	trackID, keyframes, ok := p.findHLSKeyframes(ctx, req)
+	if !ok {
+		return
+	}
+
+	if int(index) >= len(keyframes) {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid index"))
+		return
+	}
+
+	offset := keyframes[index]
+	start := req.start.Add(offset)
+	duration := hlsKeyframeDuration(req, keyframes, int(index))
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(req.pathConf, req.pathName, start, duration)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	release, ok := p.acquireMuxer(ctx, req.pathConf, req.pathName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var buf bytes.Buffer
+
+	err = seekAndMux(req.pathConf.RecordFormat, p.boxLimits, segments, start, duration,
+		p.privacyFor(ctx, req.pathName), nil,
+		&muxerOffset{
+			muxer: &muxerKeyframe{
+				muxer:   &muxerFMP4{w: &buf, skipInit: true},
+				trackID: trackID,
+			},
+			offset: offset,
+		})
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	p.writeHLSSegment(ctx, key, hlsKeyframeIndex(req, int(index)), buf.Bytes(),
+		pathHeaders(req.pathConf, start.Add(duration)))
+}
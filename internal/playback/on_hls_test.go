@@ -0,0 +1,280 @@
+package playback
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func hlsDecrypt(t *testing.T, key []byte, iv []byte, data []byte) []byte {
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	require.Equal(t, 0, len(data)%aes.BlockSize)
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	padding := int(out[len(out)-1])
+	return out[:len(out)-padding]
+}
+
+func TestOnHLS(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4"))
+
+	s := &Server{
+		Address:       "127.0.0.1:9996",
+		ReadTimeout:   conf.StringDuration(10 * time.Second),
+		HLSEncryption: true,
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	get := func(u string) (int, []byte) {
+		res, err2 := http.Get("http://localhost:9996/hls/" + u)
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		buf, err2 := io.ReadAll(res.Body)
+		require.NoError(t, err2)
+		return res.StatusCode, buf
+	}
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 1, 500000000, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "3")
+
+	code, buf := get("index.m3u8?" + v.Encode())
+	require.Equal(t, http.StatusOK, code)
+
+	playlist := string(buf)
+	require.Contains(t, playlist, "#EXT-X-PLAYLIST-TYPE:VOD\n")
+	require.Contains(t, playlist, "#EXTINF:3.000,\n")
+	require.Contains(t, playlist, "#EXT-X-ENDLIST\n")
+
+	keys := regexp.MustCompile(`#EXT-X-KEY:METHOD=AES-128,URI="(.+?)",IV=0x([0-9a-f]+)`).FindAllStringSubmatch(playlist, -1)
+	require.Equal(t, 2, len(keys))
+
+	mapURI := regexp.MustCompile(`#EXT-X-MAP:URI="(.+?)"`).FindStringSubmatch(playlist)[1]
+
+	var segmentURI string
+	for _, line := range strings.Split(playlist, "\n") {
+		if strings.HasPrefix(line, "segment.m4s?") {
+			segmentURI = line
+		}
+	}
+	require.NotEmpty(t, segmentURI)
+
+	code, key := get(keys[0][1])
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 16, len(key))
+
+	// segments are never served in clear
+	u, err := url.Parse(segmentURI)
+	require.NoError(t, err)
+	q := u.Query()
+	q.Del("session")
+	code, _ = get("segment.m4s?" + q.Encode())
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// sessions are bound to a path
+	q = u.Query()
+	q.Set("path", "otherpath")
+	code, _ = get("segment.m4s?" + q.Encode())
+	require.NotEqual(t, http.StatusOK, code)
+
+	iv, err := hex.DecodeString(keys[0][2])
+	require.NoError(t, err)
+	code, buf = get(mapURI)
+	require.Equal(t, http.StatusOK, code)
+	buf = hlsDecrypt(t, key, iv, buf)
+
+	var init fmp4.Init
+	err = init.Unmarshal(bytes.NewReader(buf))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(init.Tracks))
+
+	iv, err = hex.DecodeString(keys[1][2])
+	require.NoError(t, err)
+	code, buf = get(segmentURI)
+	require.Equal(t, http.StatusOK, code)
+	encrypted := buf
+	buf = hlsDecrypt(t, key, iv, buf)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(buf)
+	require.NoError(t, err)
+	require.NotEmpty(t, parts)
+
+	// interrupted downloads can be resumed
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:9996/hls/"+segmentURI, nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=16-")
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+	require.Equal(t, "video/mp4", res.Header.Get("Content-Type"))
+
+	partial, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, encrypted[16:], partial)
+}
+
+func TestOnHLSIFrames(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4"))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	get := func(u string) (int, []byte) {
+		res, err2 := http.Get("http://localhost:9996/hls/" + u)
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		buf, err2 := io.ReadAll(res.Body)
+		require.NoError(t, err2)
+		return res.StatusCode, buf
+	}
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 1, 500000000, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "3")
+
+	code, buf := get("iframes.m3u8?" + v.Encode())
+	require.Equal(t, http.StatusOK, code)
+
+	playlist := string(buf)
+	require.Contains(t, playlist, "#EXT-X-I-FRAMES-ONLY\n")
+	require.Contains(t, playlist, "#EXT-X-ENDLIST\n")
+
+	var segmentURIs []string
+	for _, line := range strings.Split(playlist, "\n") {
+		if strings.HasPrefix(line, "iframe.m4s?") {
+			segmentURIs = append(segmentURIs, line)
+		}
+	}
+
+	// keyframes of the second segment, at 11:23:02.5 and 11:23:03.5
+	require.Len(t, segmentURIs, 2)
+	require.Equal(t, 2, strings.Count(playlist, "#EXTINF:1.000,\n"))
+
+	code, buf = get(segmentURIs[1])
+	require.Equal(t, http.StatusOK, code)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(buf)
+	require.NoError(t, err)
+	require.Equal(t, fmp4.Parts{{
+		Tracks: []*fmp4.PartTrack{{
+			ID:       1,
+			BaseTime: 2 * 90000,
+			Samples: []*fmp4.PartSample{{
+				Duration: 1 * 90000,
+				Payload:  []byte{9, 10},
+			}},
+		}},
+	}}, parts)
+}
+
+func TestOnGetHLS(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4"))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 1, 500000000, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "3")
+	v.Set("format", "hls")
+
+	res, err := http.Get("http://localhost:9996/get?" + v.Encode())
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "/hls/index.m3u8", res.Request.URL.Path)
+	require.Equal(t, "", res.Request.URL.Query().Get("format"))
+
+	buf, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(buf), "#EXT-X-PLAYLIST-TYPE:VOD\n")
+}
@@ -0,0 +1,151 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/gin-gonic/gin"
+)
+
+// importFile writes a MP4 or fMP4 file into the recording directory of a path.
+// Files are always remuxed, in order to produce segments with the same layout of recordings.
+func importFile(
+	pathConf *conf.Path,
+	pathName string,
+	start time.Time,
+	r io.ReadSeeker,
+	limits boxLimits,
+) (string, time.Duration, error) {
+	fpath := record.Path{Start: start}.Encode(record.PathAddExtension(
+		strings.ReplaceAll(pathConf.RecordPath, "%path", pathName),
+		pathConf.RecordFormat,
+	))
+
+	if _, err := os.Stat(fpath); err == nil {
+		return "", 0, fmt.Errorf("a segment with the same start already exists")
+	}
+
+	err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+	if err != nil {
+		return "", 0, err
+	}
+
+	f, err := os.Create(fpath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	duration, err := remuxMP4(r, f, limits)
+
+	err2 := f.Close()
+	if err == nil {
+		err = err2
+	}
+
+	if err != nil {
+		os.Remove(fpath)
+		return "", 0, err
+	}
+
+	return fpath, duration, nil
+}
+
+func (p *Server) onImport(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPublish) {
+		return
+	}
+
+	if p.inMaintenanceMode() {
+		p.writeError(ctx, http.StatusServiceUnavailable, errMaintenanceMode)
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("recordings can be imported only in fMP4 format"))
+		return
+	}
+
+	// input must be seekable
+	tmp, err := os.CreateTemp(p.TempDir, "mediamtx-import")
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	body := ctx.Request.Body
+	if p.MaxImportSize != 0 {
+		body = http.MaxBytesReader(ctx.Writer, body, int64(p.MaxImportSize))
+	}
+
+	_, err = io.Copy(tmp, body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			p.writeError(ctx, http.StatusRequestEntityTooLarge, fmt.Errorf("file is bigger than %d bytes", maxErr.Limit))
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	fpath, duration, err := importFile(pathConf, pathName, start, tmp, p.boxLimits)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if pathConf.RecordIndexPath != "" {
+		absPath, _ := filepath.Abs(fpath)
+		format := conf.RecordFormatFMP4
+
+		err = record.IndexAdd(pathConf.RecordIndexPath, pathName, record.IndexEntry{
+			Start:    start,
+			Duration: duration,
+			Path:     absPath,
+			Format:   &format,
+		})
+		if err != nil {
+			p.Log(logger.Warn, "unable to update index: %v", err)
+		}
+	}
+
+	p.Registry.SegmentsChanged(pathName)
+
+	p.Log(logger.Info, "imported segment %s", fpath)
+
+	ctx.JSON(http.StatusOK, listEntry{
+		Start:    start,
+		Duration: listEntryDuration(duration),
+	})
+}
@@ -0,0 +1,281 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/bluenviron/mediacommon/pkg/formats/pmp4"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnImport(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+				RecordFormat:   conf.RecordFormatFMP4,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	sample := func(payload []byte, isNonSyncSample bool) *pmp4.Sample {
+		return &pmp4.Sample{
+			Duration:        45000,
+			IsNonSyncSample: isNonSyncSample,
+			PayloadSize:     uint32(len(payload)),
+			GetPayload: func() ([]byte, error) {
+				return payload, nil
+			},
+		}
+	}
+
+	pres := pmp4.Presentation{
+		Tracks: []*pmp4.Track{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec: &fmp4.CodecH264{
+				SPS: test.FormatH264.SPS,
+				PPS: test.FormatH264.PPS,
+			},
+			Samples: []*pmp4.Sample{
+				sample([]byte{0, 0, 0, 1, 5}, false),
+				sample([]byte{0, 0, 0, 1, 1}, true),
+				sample([]byte{0, 0, 0, 1, 5}, false),
+			},
+		}},
+	}
+
+	var buf bytes.Buffer
+	err = pres.Marshal(&buf)
+	require.NoError(t, err)
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	res, err := hc.Post("http://localhost:9996/import?path=mypath&start=2008-11-07T11:22:00Z",
+		"video/mp4", &buf)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out interface{}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]interface{}{
+		"duration": float64(1.5),
+		"start":    time.Date(2008, 11, 0o7, 11, 22, 0, 0, time.UTC).Format(time.RFC3339Nano),
+	}, out)
+
+	segments, err := FindSegments(s.PathConfs["mypath"], "mypath", nil)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	f, err := os.Open(segments[0].Fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	init, err := segmentFMP4ReadInit(f, defaultBoxLimits)
+	require.NoError(t, err)
+	require.Equal(t, pres.Tracks[0].Codec, init.Tracks[0].Codec)
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	duration, err := segmentFMP4ReadMaxDuration(f, defaultBoxLimits, init)
+	require.NoError(t, err)
+	require.Equal(t, 1500*time.Millisecond, duration)
+}
+
+// writeFragmentV0 writes a fragment with a version 0 tfdt box, like the ones of some cameras.
+func writeFragmentV0(t *testing.T, w io.Writer, baseTime uint32, payload []byte) {
+	marshalMoof := func(dataOffset int32) []byte {
+		var buf seekablebuffer.Buffer
+		mw := mp4.NewWriter(&buf)
+
+		boxes := []struct {
+			typ  mp4.BoxType
+			box  mp4.IBox
+			ends int
+		}{
+			{mp4.BoxTypeMoof(), nil, 0},
+			{mp4.BoxTypeMfhd(), &mp4.Mfhd{SequenceNumber: 1}, 1},
+			{mp4.BoxTypeTraf(), nil, 0},
+			{mp4.BoxTypeTfhd(), &mp4.Tfhd{
+				FullBox: mp4.FullBox{Flags: [3]byte{2, 0, 0}},
+				TrackID: 1,
+			}, 1},
+			{mp4.BoxTypeTfdt(), &mp4.Tfdt{BaseMediaDecodeTimeV0: baseTime}, 1},
+			{mp4.BoxTypeTrun(), &mp4.Trun{
+				FullBox:     mp4.FullBox{Flags: [3]byte{0, 3, 1}},
+				SampleCount: 1,
+				DataOffset:  dataOffset,
+				Entries: []mp4.TrunEntry{{
+					SampleDuration: 90000,
+					SampleSize:     uint32(len(payload)),
+				}},
+			}, 3},
+		}
+
+		for _, b := range boxes {
+			_, err := mw.StartBox(&mp4.BoxInfo{Type: b.typ})
+			require.NoError(t, err)
+
+			if b.box != nil {
+				_, err = mp4.Marshal(mw, b.box, mp4.Context{})
+				require.NoError(t, err)
+			}
+
+			for i := 0; i < b.ends; i++ {
+				_, err = mw.EndBox()
+				require.NoError(t, err)
+			}
+		}
+
+		return buf.Bytes()
+	}
+
+	moof := marshalMoof(0)
+	moof = marshalMoof(int32(len(moof) + 8))
+
+	_, err := w.Write(moof)
+	require.NoError(t, err)
+
+	mdat := []byte{0, 0, 0, byte(8 + len(payload)), 'm', 'd', 'a', 't'}
+	_, err = w.Write(append(mdat, payload...))
+	require.NoError(t, err)
+}
+
+func TestOnImportFragmented(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &Server{
+		Address:       "127.0.0.1:9996",
+		ReadTimeout:   conf.StringDuration(10 * time.Second),
+		MaxImportSize: 10 * 1024,
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+				RecordFormat:   conf.RecordFormatFMP4,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	init := fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec: &fmp4.CodecH264{
+				SPS: test.FormatH264.SPS,
+				PPS: test.FormatH264.PPS,
+			},
+		}},
+	}
+
+	var buf seekablebuffer.Buffer
+	err = init.Marshal(&buf)
+	require.NoError(t, err)
+
+	// timestamps of the file don't start from zero
+	writeFragmentV0(t, &buf, 10*90000, []byte{0, 0, 0, 1, 5})
+
+	part := fmp4.Part{
+		SequenceNumber: 2,
+		Tracks: []*fmp4.PartTrack{{
+			ID:       1,
+			BaseTime: 11 * 90000,
+			Samples: []*fmp4.PartSample{{
+				Duration:        90000,
+				IsNonSyncSample: true,
+				Payload:         []byte{0, 0, 0, 1, 1},
+			}},
+		}},
+	}
+	err = part.Marshal(&buf)
+	require.NoError(t, err)
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	res, err := hc.Post("http://localhost:9996/import?path=mypath&start=2008-11-07T11:22:00Z",
+		"video/mp4", bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out listEntry
+	err = json.NewDecoder(res.Body).Decode(&out)
+	require.NoError(t, err)
+	require.Equal(t, listEntryDuration(2*time.Second), out.Duration)
+
+	segments, err := FindSegments(s.PathConfs["mypath"], "mypath", nil)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	byts, err := os.ReadFile(segments[0].Fpath)
+	require.NoError(t, err)
+
+	f := bytes.NewReader(byts)
+
+	init2, err := segmentFMP4ReadInit(f, defaultBoxLimits)
+	require.NoError(t, err)
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	fragments, err := segmentFMP4ReadFragments(f, defaultBoxLimits, init2)
+	require.NoError(t, err)
+	require.Equal(t, []segmentFMP4Fragment{
+		{offset: 683, size: 109, dts: 0},
+		{offset: 792, size: 113, dts: 1 * time.Second},
+	}, fragments)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(byts[fragments[0].offset:])
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0, 0, 1, 5}, parts[0].Tracks[0].Samples[0].Payload)
+	require.Equal(t, []byte{0, 0, 0, 1, 1}, parts[1].Tracks[0].Samples[0].Payload)
+
+	// files bigger than the limit are rejected
+	res, err = hc.Post("http://localhost:9996/import?path=mypath&start=2008-11-07T11:23:00Z",
+		"video/mp4", bytes.NewReader(make([]byte, 11*1024)))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+}
@@ -0,0 +1,163 @@
+package playback
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// keyframeDuration is the duration of the keyframe inside keyframe clips.
+const keyframeDuration = 1 * time.Millisecond
+
+// nearestKeyframe returns the ID of the first video track of a segment
+// and the time of the keyframe that is nearest to t.
+func nearestKeyframe(seg *Segment, limits boxLimits, t time.Time) (int, time.Time, error) {
+	f, err := seg.open()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer f.Close()
+
+	init, err := segmentFMP4ReadInit(f, limits)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	trackID := 0
+	for _, track := range init.Tracks {
+		if track.Codec.IsVideo() {
+			trackID = track.ID
+			break
+		}
+	}
+
+	if trackID == 0 {
+		return 0, time.Time{}, fmt.Errorf("recording doesn't contain any video track")
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var nearest time.Time
+	found := false
+
+	err = segmentFMP4ReadKeyframes(f, limits, init, trackID, func(dts time.Duration) {
+		cur := seg.Start.Add(dts)
+		if !found || absDuration(cur.Sub(t)) < absDuration(nearest.Sub(t)) {
+			nearest = cur
+			found = true
+		}
+	})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if !found {
+		return 0, time.Time{}, errNoSegmentsFound
+	}
+
+	return trackID, nearest, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// onKeyframe writes the keyframe that is nearest to a given time,
+// inside a fMP4 clip, in order to allow web interfaces to show previews.
+// Video is not decoded, therefore the keyframe is not converted into an image.
+func (p *Server) onKeyframe(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	t, err := time.Parse(time.RFC3339, ctx.Query("time"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid time: %w", err))
+		return
+	}
+
+	err = checkLookback(lookbackLimit(ctx), t)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, "", 0)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	if pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("MPEG-TS format is not supported yet"))
+		return
+	}
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(pathConf, pathName, t, 0)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	trackID, keyframe, err := nearestKeyframe(segments[0], p.boxLimits, t)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	segments, err = p.segmentCache.findSegmentsInTimespan(pathConf, pathName, keyframe, keyframeDuration)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	release, ok := p.acquireMuxer(ctx, pathConf, pathName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var buf bytes.Buffer
+
+	err = seekAndMux(pathConf.RecordFormat, p.boxLimits, segments, keyframe, keyframeDuration,
+		p.privacyFor(ctx, pathName), nil,
+		&muxerKeyframe{
+			muxer:   &muxerFMP4{w: &buf},
+			trackID: trackID,
+		})
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	writeHeaders(ctx, pathHeaders(pathConf, keyframe))
+	ctx.Data(http.StatusOK, "video/mp4", buf.Bytes())
+}
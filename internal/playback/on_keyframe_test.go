@@ -0,0 +1,52 @@
+package playback
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnKeyframe(t *testing.T) {
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.Local)
+
+	tr := newHarnessTree(t, "mypath", []harnessSegment{
+		{
+			Start:           start,
+			Codecs:          []string{"H264"},
+			Fragments:       3,
+			FragmentSamples: 2,
+		},
+	})
+	tr.serve(t)
+
+	// keyframes are at 0s, 2s and 4s
+	code, buf := tr.get(t, "/keyframe?path=mypath&time="+
+		url.QueryEscape(start.Add(2800*time.Millisecond).Format(time.RFC3339Nano)))
+	require.Equal(t, http.StatusOK, code)
+
+	var init fmp4.Init
+	err := init.Unmarshal(bytes.NewReader(buf))
+	require.NoError(t, err)
+	require.Len(t, init.Tracks, 1)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(buf)
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	require.Len(t, parts[0].Tracks, 1)
+	require.Len(t, parts[0].Tracks[0].Samples, 1)
+	require.Equal(t, []byte{3, 3}, parts[0].Tracks[0].Samples[0].Payload)
+	require.False(t, parts[0].Tracks[0].Samples[0].IsNonSyncSample)
+
+	code, _ = tr.get(t, "/keyframe?path=mypath&time="+
+		url.QueryEscape(start.Add(-time.Hour).Format(time.RFC3339Nano)))
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, _ = tr.get(t, "/keyframe?path=mypath&time=invalid")
+	require.Equal(t, http.StatusBadRequest, code)
+}
@@ -6,7 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
@@ -20,25 +21,40 @@ func (d listEntryDuration) MarshalJSON() ([]byte, error) {
 	return json.Marshal(time.Duration(d).Seconds())
 }
 
+func (d *listEntryDuration) UnmarshalJSON(b []byte) error {
+	var secs float64
+	err := json.Unmarshal(b, &secs)
+	if err != nil {
+		return err
+	}
+
+	*d = listEntryDuration(secs * float64(time.Second))
+	return nil
+}
+
 type listEntry struct {
 	Start    time.Time         `json:"start"`
 	Duration listEntryDuration `json:"duration"`
 }
 
-func computeDurationAndConcatenate(recordFormat conf.RecordFormat, segments []*Segment) ([]listEntry, error) {
+func computeDurationAndConcatenate(
+	recordFormat conf.RecordFormat,
+	limits boxLimits,
+	segments []*Segment,
+) ([]listEntry, error) {
 	if recordFormat == conf.RecordFormatFMP4 {
 		out := []listEntry{}
 		var prevInit *fmp4.Init
 
 		for _, seg := range segments {
 			err := func() error {
-				f, err := os.Open(seg.Fpath)
+				f, err := seg.open()
 				if err != nil {
 					return err
 				}
 				defer f.Close()
 
-				init, err := segmentFMP4ReadInit(f)
+				init, err := segmentFMP4ReadInit(f, limits)
 				if err != nil {
 					return err
 				}
@@ -48,7 +64,7 @@ func computeDurationAndConcatenate(recordFormat conf.RecordFormat, segments []*S
 					return err
 				}
 
-				maxDuration, err := segmentFMP4ReadMaxDuration(f, init)
+				maxDuration, err := segmentFMP4ReadMaxDuration(f, limits, init)
 				if err != nil {
 					return err
 				}
@@ -83,34 +99,147 @@ func computeDurationAndConcatenate(recordFormat conf.RecordFormat, segments []*S
 	return nil, fmt.Errorf("MPEG-TS format is not supported yet")
 }
 
+// coalesceListEntries merges entries separated by gaps shorter or equal than tolerance.
+func coalesceListEntries(entries []listEntry, tolerance time.Duration) []listEntry {
+	out := []listEntry{}
+
+	for _, entry := range entries {
+		if len(out) != 0 {
+			prev := &out[len(out)-1]
+			prevEnd := prev.Start.Add(time.Duration(prev.Duration))
+
+			if entry.Start.Sub(prevEnd) <= tolerance {
+				curEnd := entry.Start.Add(time.Duration(entry.Duration))
+				if curEnd.After(prevEnd) {
+					prev.Duration = listEntryDuration(curEnd.Sub(prev.Start))
+				}
+				continue
+			}
+		}
+
+		out = append(out, entry)
+	}
+
+	return out
+}
+
+// summarizeListEntries reduces entries to maxRanges, by merging entries separated by the shortest gaps.
+func summarizeListEntries(entries []listEntry, maxRanges int) []listEntry {
+	if len(entries) <= maxRanges {
+		return entries
+	}
+
+	// gaps[i] is the gap between entry i and entry i+1
+	gaps := make([]int, len(entries)-1)
+	for i := range gaps {
+		gaps[i] = i
+	}
+
+	gapDuration := func(i int) time.Duration {
+		return entries[i+1].Start.Sub(entries[i].Start.Add(time.Duration(entries[i].Duration)))
+	}
+
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return gapDuration(gaps[i]) < gapDuration(gaps[j])
+	})
+
+	merged := make([]bool, len(entries)-1)
+	for _, i := range gaps[:len(entries)-maxRanges] {
+		merged[i] = true
+	}
+
+	out := []listEntry{entries[0]}
+
+	for i := 1; i < len(entries); i++ {
+		if merged[i-1] {
+			prev := &out[len(out)-1]
+			prevEnd := prev.Start.Add(time.Duration(prev.Duration))
+			curEnd := entries[i].Start.Add(time.Duration(entries[i].Duration))
+			if curEnd.After(prevEnd) {
+				prev.Duration = listEntryDuration(curEnd.Sub(prev.Start))
+			}
+		} else {
+			out = append(out, entries[i])
+		}
+	}
+
+	return out
+}
+
 func (p *Server) onList(ctx *gin.Context) {
 	pathName := ctx.Query("path")
 
-	if !p.doAuth(ctx, pathName) {
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
 		return
 	}
 
+	var gapTolerance time.Duration
+	if raw := ctx.Query("gapTolerance"); raw != "" {
+		var err error
+		gapTolerance, err = parseDuration(raw)
+		if err != nil || gapTolerance < 0 {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid gapTolerance: %s", raw))
+			return
+		}
+	}
+
+	var maxRanges int
+	if raw := ctx.Query("maxRanges"); raw != "" {
+		var err error
+		maxRanges, err = strconv.Atoi(raw)
+		if err != nil || maxRanges < 1 {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid maxRanges: %s", raw))
+			return
+		}
+	}
+
 	pathConf, err := p.safeFindPathConf(pathName)
 	if err != nil {
 		p.writeError(ctx, http.StatusBadRequest, err)
 		return
 	}
 
-	segments, err := FindSegments(pathConf, pathName)
+	err = checkPlayback(pathConf, "", 0)
 	if err != nil {
-		if errors.Is(err, errNoSegmentsFound) {
-			p.writeError(ctx, http.StatusNotFound, err)
-		} else {
-			p.writeError(ctx, http.StatusBadRequest, err)
-		}
+		p.writeError(ctx, http.StatusForbidden, err)
 		return
 	}
 
-	out, err := computeDurationAndConcatenate(pathConf.RecordFormat, segments)
+	out := []listEntry{}
+
+	segments, err := p.segmentCache.findSegments(pathConf, pathName)
 	if err != nil {
-		p.writeError(ctx, http.StatusInternalServerError, err)
+		if !errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		segments = removeSegmentsBefore(segments, lookbackLimit(ctx))
+
+		out, err = computeDurationAndConcatenate(pathConf.RecordFormat, p.boxLimits, segments)
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if p.usePeers(ctx) {
+		out = mergeListEntries(append(out, p.listPeers(ctx)...))
+	}
+
+	if len(out) == 0 {
+		p.writeError(ctx, http.StatusNotFound, errNoSegmentsFound)
 		return
 	}
 
+	if gapTolerance != 0 {
+		out = coalesceListEntries(out, gapTolerance)
+	}
+
+	if maxRanges != 0 {
+		out = summarizeListEntries(out, maxRanges)
+	}
+
+	writeHeaders(ctx, pathHeaders(pathConf, time.Time{}))
 	ctx.JSON(http.StatusOK, out)
 }
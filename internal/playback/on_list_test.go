@@ -11,6 +11,7 @@ import (
 
 	"github.com/bluenviron/mediamtx/internal/auth"
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/test"
 	"github.com/stretchr/testify/require"
 )
@@ -32,7 +33,8 @@ func TestOnList(t *testing.T) {
 		ReadTimeout: conf.StringDuration(10 * time.Second),
 		PathConfs: map[string]*conf.Path{
 			"mypath": {
-				RecordPath: filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
 			},
 		},
 		AuthManager: &test.AuthManager{
@@ -102,7 +104,8 @@ func TestOnListDifferentInit(t *testing.T) {
 		ReadTimeout: conf.StringDuration(10 * time.Second),
 		PathConfs: map[string]*conf.Path{
 			"mypath": {
-				RecordPath: filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
 			},
 		},
 		AuthManager: test.NilAuthManager,
@@ -143,3 +146,220 @@ func TestOnListDifferentInit(t *testing.T) {
 		},
 	}, out)
 }
+
+func TestOnListPeers(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+
+	dir2, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir2)
+
+	err = os.Mkdir(filepath.Join(dir2, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment2(t, filepath.Join(dir2, "mypath", "2008-11-07_11-23-02-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir2, "mypath", "2009-11-07_11-23-02-500000.mp4"))
+
+	peer := &Server{
+		Address:     "127.0.0.1:9997",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir2, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = peer.Initialize()
+	require.NoError(t, err)
+	defer peer.Close()
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		Peers:       []string{"http://localhost:9997"},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	res, err := http.Get("http://localhost:9996/list?path=mypath")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out interface{}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	require.NoError(t, err)
+
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			"duration": float64(65),
+			"start":    time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local).Format(time.RFC3339Nano),
+		},
+		map[string]interface{}{
+			"duration": float64(3),
+			"start":    time.Date(2009, 11, 0o7, 11, 23, 2, 500000000, time.Local).Format(time.RFC3339Nano),
+		},
+	}, out)
+}
+
+func TestOnListIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "othernode"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "othernode", "seg1.mp4"))
+	writeSegment2(t, filepath.Join(dir, "othernode", "seg2.mp4"))
+	writeSegment3(t, filepath.Join(dir, "othernode", "seg4.mp4"))
+
+	err = record.IndexAdd(filepath.Join(dir, "index"), "mypath", record.IndexEntry{
+		Start:    time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local),
+		Duration: 62 * time.Second,
+		Path:     filepath.Join(dir, "othernode", "seg1.mp4"),
+	})
+	require.NoError(t, err)
+
+	err = record.IndexAdd(filepath.Join(dir, "index"), "mypath", record.IndexEntry{
+		Start:    time.Date(2008, 11, 0o7, 11, 23, 2, 500000000, time.Local),
+		Duration: 3 * time.Second,
+		Path:     filepath.Join(dir, "othernode", "seg2.mp4"),
+	})
+	require.NoError(t, err)
+
+	// deleted segment
+	err = record.IndexAdd(filepath.Join(dir, "index"), "mypath", record.IndexEntry{
+		Start:    time.Date(2009, 11, 0o7, 11, 23, 2, 500000000, time.Local),
+		Duration: 3 * time.Second,
+		Path:     filepath.Join(dir, "othernode", "seg3.mp4"),
+	})
+	require.NoError(t, err)
+
+	// segment with a different format
+	mpegtsFormat := conf.RecordFormatMPEGTS
+	err = record.IndexAdd(filepath.Join(dir, "index"), "mypath", record.IndexEntry{
+		Start:    time.Date(2010, 11, 0o7, 11, 23, 2, 500000000, time.Local),
+		Duration: 3 * time.Second,
+		Path:     filepath.Join(dir, "othernode", "seg4.mp4"),
+		Format:   &mpegtsFormat,
+	})
+	require.NoError(t, err)
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable:  true,
+				RecordIndexPath: filepath.Join(dir, "index"),
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	res, err := http.Get("http://localhost:9996/list?path=mypath")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out interface{}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	require.NoError(t, err)
+
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			"duration": float64(65),
+			"start":    time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local).Format(time.RFC3339Nano),
+		},
+	}, out)
+}
+
+func TestOnListGranularity(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-10-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2009-11-07_11-23-02-500000.mp4"))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	list := func(query string) []listEntry {
+		res, err2 := http.Get("http://localhost:9996/list?path=mypath" + query)
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var out []listEntry
+		err2 = json.NewDecoder(res.Body).Decode(&out)
+		require.NoError(t, err2)
+		return out
+	}
+
+	require.Len(t, list(""), 3)
+
+	out := list("&gapTolerance=5")
+	require.Len(t, out, 2)
+	require.True(t, out[0].Start.Equal(time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local)))
+	require.Equal(t, listEntryDuration(73*time.Second), out[0].Duration)
+	require.True(t, out[1].Start.Equal(time.Date(2009, 11, 0o7, 11, 23, 2, 500000000, time.Local)))
+	require.Equal(t, listEntryDuration(3*time.Second), out[1].Duration)
+
+	out = list("&maxRanges=1")
+	require.Len(t, out, 1)
+	require.True(t, out[0].Start.Equal(time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local)))
+	require.True(t, out[0].Start.Add(time.Duration(out[0].Duration)).Equal(
+		time.Date(2009, 11, 0o7, 11, 23, 5, 500000000, time.Local)))
+
+	res, err := http.Get("http://localhost:9996/list?path=mypath&maxRanges=0")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,142 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+type mapEntry struct {
+	Segment      string    `json:"segment"`
+	SegmentStart time.Time `json:"segmentStart"`
+	Offset       int64     `json:"offset"`
+	Size         int64     `json:"size"`
+	Time         time.Time `json:"time"`
+}
+
+// onMap returns the position inside recording segments of the fragment that contains a given time,
+// in order to allow external tools to read data from segments directly.
+func (p *Server) onMap(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	t, err := time.Parse(time.RFC3339, ctx.Query("time"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid time: %w", err))
+		return
+	}
+
+	err = checkLookback(lookbackLimit(ctx), t)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, "", 0)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	if pathConf.RecordFormat != conf.RecordFormatFMP4 {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("MPEG-TS format is not supported yet"))
+		return
+	}
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(pathConf, pathName, t, 0)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	release, ok := p.acquireReader(ctx, pathConf, pathName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	seg := segments[0]
+
+	f, err := seg.open()
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	init, err := segmentFMP4ReadInit(f, p.boxLimits)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	maxDuration, err := segmentFMP4ReadMaxDuration(f, p.boxLimits, init)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	// time is inside a gap
+	if !t.Before(seg.Start.Add(maxDuration)) {
+		p.writeError(ctx, http.StatusNotFound, errNoSegmentsFound)
+		return
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	fragments, err := segmentFMP4ReadFragments(f, p.boxLimits, init)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	var found *segmentFMP4Fragment
+
+	for i, frag := range fragments {
+		if seg.Start.Add(frag.dts).After(t) {
+			break
+		}
+		found = &fragments[i]
+	}
+
+	if found == nil {
+		p.writeError(ctx, http.StatusNotFound, errNoSegmentsFound)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, mapEntry{
+		Segment:      seg.Fpath,
+		SegmentStart: seg.Start,
+		Offset:       found.offset,
+		Size:         found.size,
+		Time:         seg.Start.Add(found.dts),
+	})
+}
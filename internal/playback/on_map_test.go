@@ -0,0 +1,97 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnMap(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	fpath := filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4")
+	writeSegment2(t, fpath)
+
+	buf, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+
+	moofs, err := mp4.ExtractBox(bytes.NewReader(buf), nil, mp4.BoxPath{mp4.BoxTypeMoof()})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(moofs))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	segmentStart := time.Date(2008, 11, 0o7, 11, 23, 2, 500000000, time.Local)
+
+	for _, ca := range []struct {
+		name     string
+		time     time.Time
+		fragment int
+	}{
+		{"first fragment", segmentStart.Add(500 * time.Millisecond), 0},
+		{"second fragment", segmentStart.Add(2500 * time.Millisecond), 1},
+		{"after end", segmentStart.Add(4 * time.Second), -1},
+		{"before start", segmentStart.Add(-time.Second), -1},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			v := url.Values{}
+			v.Set("path", "mypath")
+			v.Set("time", ca.time.Format(time.RFC3339Nano))
+
+			res, err := http.Get("http://localhost:9996/map?" + v.Encode())
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			if ca.fragment < 0 {
+				require.Equal(t, http.StatusNotFound, res.StatusCode)
+				return
+			}
+
+			require.Equal(t, http.StatusOK, res.StatusCode)
+
+			var out mapEntry
+			err = json.NewDecoder(res.Body).Decode(&out)
+			require.NoError(t, err)
+
+			require.Equal(t, fpath, out.Segment)
+			require.Equal(t, int64(moofs[ca.fragment].Offset), out.Offset)
+			require.Equal(t, []byte("moof"), buf[out.Offset+4:out.Offset+8])
+			require.True(t, segmentStart.Add(time.Duration(ca.fragment)*2*time.Second).Equal(out.Time))
+
+			if ca.fragment == 0 {
+				require.Equal(t, int64(moofs[1].Offset)-out.Offset, out.Size)
+			} else {
+				require.Equal(t, int64(len(buf))-out.Offset, out.Size)
+			}
+		})
+	}
+}
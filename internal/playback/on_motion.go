@@ -0,0 +1,224 @@
+package playback
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/gin-gonic/gin"
+)
+
+type motionEntry struct {
+	Start    time.Time         `json:"start"`
+	Duration listEntryDuration `json:"duration"`
+	Score    float64           `json:"score"`
+}
+
+func (p *Server) findMotionIndexPath(ctx *gin.Context, pathName string) (string, bool) {
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return "", false
+	}
+
+	err = checkPlayback(pathConf, "", 0)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return "", false
+	}
+
+	if pathConf.RecordIndexPath == "" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("motion scores require recordIndexPath"))
+		return "", false
+	}
+
+	return pathConf.RecordIndexPath, true
+}
+
+func parseMinScore(ctx *gin.Context) (float64, error) {
+	v := ctx.Query("minScore")
+	if v == "" {
+		return 0, nil
+	}
+
+	minScore, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid minScore: %w", err)
+	}
+	return minScore, nil
+}
+
+func (p *Server) readMotion(ctx *gin.Context, indexPath string, pathName string) ([]record.MotionEntry, bool) {
+	entries, err := record.MotionRead(indexPath, pathName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, true
+		}
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return entries, true
+}
+
+func (p *Server) onMotionAdd(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPublish) {
+		return
+	}
+
+	indexPath, ok := p.findMotionIndexPath(ctx, pathName)
+	if !ok {
+		return
+	}
+
+	var in []motionEntry
+	err := json.NewDecoder(ctx.Request.Body).Decode(&in)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	entries := make([]record.MotionEntry, len(in))
+	for i, e := range in {
+		if e.Start.IsZero() || e.Duration <= 0 {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("entry %d: start and duration are required", i))
+			return
+		}
+
+		entries[i] = record.MotionEntry{
+			Start:    e.Start,
+			Duration: time.Duration(e.Duration),
+			Score:    e.Score,
+		}
+	}
+
+	err = record.MotionAdd(indexPath, pathName, entries)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (p *Server) onMotionList(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	var start time.Time
+	var end time.Time
+
+	if v := ctx.Query("start"); v != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+			return
+		}
+	}
+
+	if v := ctx.Query("duration"); v != "" {
+		duration, err := parseDuration(v)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+			return
+		}
+		end = start.Add(duration)
+	}
+
+	if limit := lookbackLimit(ctx); start.Before(limit) {
+		start = limit
+	}
+
+	minScore, err := parseMinScore(ctx)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	indexPath, ok := p.findMotionIndexPath(ctx, pathName)
+	if !ok {
+		return
+	}
+
+	entries, ok := p.readMotion(ctx, indexPath, pathName)
+	if !ok {
+		return
+	}
+
+	out := []motionEntry{}
+
+	for _, e := range entries {
+		if e.Score < minScore ||
+			!e.Start.Add(e.Duration).After(start) ||
+			(!end.IsZero() && !e.Start.Before(end)) {
+			continue
+		}
+
+		out = append(out, motionEntry{
+			Start:    e.Start,
+			Duration: listEntryDuration(e.Duration),
+			Score:    e.Score,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, out)
+}
+
+// onMotionNext returns the first bucket with activity that starts after the given date.
+func (p *Server) onMotionNext(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	after, err := time.Parse(time.RFC3339, ctx.Query("after"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid after: %w", err))
+		return
+	}
+
+	if limit := lookbackLimit(ctx); after.Before(limit) {
+		after = limit
+	}
+
+	minScore, err := parseMinScore(ctx)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	indexPath, ok := p.findMotionIndexPath(ctx, pathName)
+	if !ok {
+		return
+	}
+
+	entries, ok := p.readMotion(ctx, indexPath, pathName)
+	if !ok {
+		return
+	}
+
+	for _, e := range entries {
+		if e.Start.After(after) && e.Score > 0 && e.Score >= minScore {
+			ctx.JSON(http.StatusOK, motionEntry{
+				Start:    e.Start,
+				Duration: listEntryDuration(e.Duration),
+				Score:    e.Score,
+			})
+			return
+		}
+	}
+
+	p.writeError(ctx, http.StatusNotFound, fmt.Errorf("no activity found"))
+}
@@ -0,0 +1,107 @@
+package playback
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnMotion(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable:  true,
+				RecordIndexPath: filepath.Join(dir, "index"),
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	start := time.Date(2008, 11, 0o7, 11, 22, 0, 0, time.UTC)
+
+	var in []motionEntry
+	for i, score := range []float64{0, 0.1, 0.8, 0, 0.5} {
+		in = append(in, motionEntry{
+			Start:    start.Add(time.Duration(i) * 10 * time.Second),
+			Duration: listEntryDuration(10 * time.Second),
+			Score:    score,
+		})
+	}
+
+	buf, err := json.Marshal(in)
+	require.NoError(t, err)
+
+	res, err := hc.Post("http://localhost:9996/motion?path=mypath", "application/json", bytes.NewReader(buf))
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	get := func(endpoint string, v url.Values, out interface{}) int {
+		v.Set("path", "mypath")
+
+		res2, err2 := hc.Get("http://localhost:9996" + endpoint + "?" + v.Encode())
+		require.NoError(t, err2)
+		defer res2.Body.Close()
+
+		if res2.StatusCode == http.StatusOK {
+			err2 = json.NewDecoder(res2.Body).Decode(out)
+			require.NoError(t, err2)
+		}
+		return res2.StatusCode
+	}
+
+	var entries []motionEntry
+	code := get("/motion", url.Values{
+		"start":    []string{start.Add(15 * time.Second).Format(time.RFC3339)},
+		"duration": []string{"30"},
+		"minScore": []string{"0.5"},
+	}, &entries)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 2, len(entries))
+	require.True(t, in[2].Start.Equal(entries[0].Start))
+	require.True(t, in[4].Start.Equal(entries[1].Start))
+
+	var next motionEntry
+	code = get("/motion/next", url.Values{
+		"after": []string{start.Format(time.RFC3339)},
+	}, &next)
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, in[1].Start.Equal(next.Start))
+	require.Equal(t, 0.1, next.Score)
+
+	code = get("/motion/next", url.Values{
+		"after":    []string{start.Add(20 * time.Second).Format(time.RFC3339)},
+		"minScore": []string{"0.5"},
+	}, &next)
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, in[4].Start.Equal(next.Start))
+
+	code = get("/motion/next", url.Values{
+		"after": []string{start.Add(40 * time.Second).Format(time.RFC3339)},
+	}, &next)
+	require.Equal(t, http.StatusNotFound, code)
+}
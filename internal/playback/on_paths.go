@@ -0,0 +1,117 @@
+package playback
+
+import (
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/gin-gonic/gin"
+)
+
+// findRecordedPaths returns names of paths that may have recordings.
+func findRecordedPaths(pathConfs map[string]*conf.Path) []string {
+	names := make(map[string]struct{})
+
+	for name, pathConf := range pathConfs {
+		if pathConf.Regexp == nil {
+			names[name] = struct{}{}
+			continue
+		}
+
+		if pathConf.RecordIndexPath != "" {
+			entries, _ := os.ReadDir(pathConf.RecordIndexPath)
+			for _, entry := range entries {
+				if v, ok := strings.CutSuffix(entry.Name(), ".jsonl"); ok {
+					if v, err := url.PathUnescape(v); err == nil {
+						names[v] = struct{}{}
+					}
+				}
+			}
+			continue
+		}
+
+		if !strings.Contains(pathConf.RecordPath, "%path") {
+			continue
+		}
+
+		recordPath := record.PathAddExtension(pathConf.RecordPath, pathConf.RecordFormat)
+		recordPath, _ = filepath.Abs(recordPath)
+
+		filepath.Walk(record.CommonPath(recordPath), func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() {
+				var pa record.Path
+				if pa.Decode(recordPath, fpath) && pa.Path != "" {
+					names[pa.Path] = struct{}{}
+				}
+			}
+
+			return nil
+		})
+	}
+
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	return out
+}
+
+// readablePaths returns names of paths that have recordings and can be read by the user,
+// and whether some paths have been hidden since the user is not allowed to read them.
+func (p *Server) readablePaths(ctx *gin.Context) ([]string, bool) {
+	p.mutex.RLock()
+	names := findRecordedPaths(p.PathConfs)
+	p.mutex.RUnlock()
+
+	out := []string{}
+	denied := false
+
+	for _, name := range names {
+		pathConf, err := p.safeFindPathConf(name)
+		if err != nil || !pathConf.PlaybackEnable {
+			continue
+		}
+
+		req, _ := authRequest(ctx, name, conf.AuthActionPlayback)
+
+		err = p.AuthManager.Authenticate(req)
+		if err != nil {
+			denied = true
+			continue
+		}
+
+		if _, err = p.segmentCache.findSegments(pathConf, name); err != nil {
+			continue
+		}
+
+		out = append(out, name)
+	}
+
+	sort.Strings(out)
+
+	return out, denied
+}
+
+func (p *Server) onPaths(ctx *gin.Context) {
+	out, denied := p.readablePaths(ctx)
+	_, _, hasCredentials := ctx.Request.BasicAuth()
+
+	// ask for credentials if they are needed to access some paths
+	if len(out) == 0 && denied && !hasCredentials {
+		ctx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+		ctx.Writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, out)
+}
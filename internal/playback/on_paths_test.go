@@ -0,0 +1,63 @@
+package playback
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnPaths(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"mypath", "other/path"} {
+		err = os.MkdirAll(filepath.Join(dir, name), 0o755)
+		require.NoError(t, err)
+
+		writeSegment1(t, filepath.Join(dir, name, "2008-11-07_11-22-00-500000.mp4"))
+	}
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"all_others": {
+				Regexp:         regexp.MustCompile("^.*$"),
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	res, err := http.Get("http://localhost:9996/paths")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out []string
+	err = json.NewDecoder(res.Body).Decode(&out)
+	require.NoError(t, err)
+	require.Equal(t, []string{"mypath", "other/path"}, out)
+
+	res2, err := http.Get("http://localhost:9996/ui")
+	require.NoError(t, err)
+	defer res2.Body.Close()
+
+	require.Equal(t, http.StatusOK, res2.StatusCode)
+	require.Equal(t, "text/html", res2.Header.Get("Content-Type"))
+}
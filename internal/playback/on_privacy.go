@@ -0,0 +1,123 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// privacyIntervals returns the privacy intervals of a path.
+func (p *Server) privacyIntervals(pathName string) []privacyInterval {
+	if p.privacy == nil {
+		return nil
+	}
+	return p.privacy.list(pathName)
+}
+
+// isPrivileged checks whether the user is allowed to see privacy intervals,
+// that is, whether it is allowed to perform the api action on the path.
+func (p *Server) isPrivileged(ctx *gin.Context, pathName string) bool {
+	req, _ := authRequest(ctx, pathName, conf.AuthActionAPI)
+
+	return p.AuthManager.Authenticate(req) == nil
+}
+
+// privacyFor returns the privacy intervals that apply to the user.
+func (p *Server) privacyFor(ctx *gin.Context, pathName string) []privacyInterval {
+	intervals := p.privacyIntervals(pathName)
+	if len(intervals) == 0 || p.isPrivileged(ctx, pathName) {
+		return nil
+	}
+	return intervals
+}
+
+func (p *Server) onPrivacyAdd(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionAPI) {
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	duration, err := parseDuration(ctx.Query("duration"))
+	if err != nil || duration <= 0 {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %s", ctx.Query("duration")))
+		return
+	}
+
+	_, err = p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	interval := &privacyInterval{
+		Path:     pathName,
+		Start:    start,
+		Duration: listEntryDuration(duration),
+		Reason:   ctx.Query("reason"),
+	}
+
+	err = p.privacy.add(interval)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	p.Log(logger.Info, "privacy interval %s added to path '%s'", interval.ID, pathName)
+
+	ctx.JSON(http.StatusOK, interval)
+}
+
+func (p *Server) onPrivacyList(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionAPI) {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p.privacy.list(pathName))
+}
+
+func (p *Server) onPrivacyDelete(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid ID: %w", err))
+		return
+	}
+
+	interval, err := p.privacy.get(id)
+	if err != nil {
+		p.writeError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	if !p.doAuth(ctx, interval.Path, conf.AuthActionAPI) {
+		return
+	}
+
+	err = p.privacy.remove(id)
+	if err != nil {
+		if errors.Is(err, errPrivacyIntervalNotFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	p.Log(logger.Info, "privacy interval %s removed", id)
+
+	ctx.Status(http.StatusOK)
+}
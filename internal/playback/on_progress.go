@@ -0,0 +1,56 @@
+package playback
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// onGetProgress sends the progress of a download as server-sent events,
+// until the download is finished or the client disconnects.
+func (p *Server) onGetProgress(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	d, ok := p.progress.get(ctx.Query("id"), pathName)
+	if !ok {
+		p.writeError(ctx, http.StatusNotFound, fmt.Errorf("download not found"))
+		return
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Status(http.StatusOK)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		ev := d.event()
+
+		buf, _ := json.Marshal(ev)
+		_, err := ctx.Writer.Write([]byte("data: " + string(buf) + "\n\n"))
+		if err != nil {
+			return
+		}
+		ctx.Writer.Flush()
+
+		if ev.Done {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-d.done:
+		case <-ctx.Request.Context().Done():
+			return
+		}
+	}
+}
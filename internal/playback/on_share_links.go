@@ -0,0 +1,245 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// applyShareLinkParams fills the optional parameters of a link with the ones in the query.
+func applyShareLinkParams(ctx *gin.Context, link *shareLink) error {
+	if v, ok := ctx.GetQuery("name"); ok {
+		link.Name = v
+	}
+
+	if v, ok := ctx.GetQuery("expiry"); ok {
+		expiry, err := parseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid expiry: %w", err)
+		}
+
+		if expiry == 0 {
+			link.Expires = nil
+		} else {
+			expires := time.Now().Add(expiry)
+			link.Expires = &expires
+		}
+	}
+
+	if v, ok := ctx.GetQuery("maxDownloads"); ok {
+		maxDownloads, err := strconv.ParseUint(v, 10, 31)
+		if err != nil {
+			return fmt.Errorf("invalid maxDownloads: %w", err)
+		}
+		link.MaxDownloads = int(maxDownloads)
+	}
+
+	return nil
+}
+
+func (p *Server) writeShareLinkError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errShareLinkNotFound):
+		p.writeError(ctx, http.StatusNotFound, err)
+
+	case errors.Is(err, errShareLinkExpired):
+		p.writeError(ctx, http.StatusGone, err)
+
+	default:
+		p.writeError(ctx, http.StatusInternalServerError, err)
+	}
+}
+
+// getShareLink returns the link with the ID in the URL, checking that the user can manage it.
+func (p *Server) getShareLink(ctx *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid ID: %w", err))
+		return uuid.UUID{}, false
+	}
+
+	link, err := p.shareLinks.get(id)
+	if err != nil {
+		p.writeShareLinkError(ctx, err)
+		return uuid.UUID{}, false
+	}
+
+	if !p.doAuth(ctx, link.Path, conf.AuthActionAPI) {
+		return uuid.UUID{}, false
+	}
+
+	return id, true
+}
+
+func (p *Server) onShareLinksAdd(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionAPI) {
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	duration, err := parseDuration(ctx.Query("duration"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+		return
+	}
+
+	start, duration, err = clampLookback(lookbackLimit(ctx), start, duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	format := ctx.Query("format")
+	if format != "" && format != "fmp4" && format != "mp4" && format != "ts" && format != "mkv" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", format))
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, playbackFormat(format), duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	link := &shareLink{
+		Path:     pathName,
+		Start:    start,
+		Duration: listEntryDuration(duration),
+		Format:   format,
+	}
+
+	err = applyShareLinkParams(ctx, link)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = p.shareLinks.add(link)
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	p.Log(logger.Info, "share link %s created for path '%s'", link.ID, pathName)
+
+	ctx.JSON(http.StatusOK, link)
+}
+
+func (p *Server) onShareLinksList(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionAPI) {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p.shareLinks.list(pathName))
+}
+
+func (p *Server) onShareLinksGet(ctx *gin.Context) {
+	id, ok := p.getShareLink(ctx)
+	if !ok {
+		return
+	}
+
+	link, err := p.shareLinks.get(id)
+	if err != nil {
+		p.writeShareLinkError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, link)
+}
+
+func (p *Server) onShareLinksPatch(ctx *gin.Context) {
+	id, ok := p.getShareLink(ctx)
+	if !ok {
+		return
+	}
+
+	var paramsErr error
+
+	link, err := p.shareLinks.update(id, func(link *shareLink) error {
+		paramsErr = applyShareLinkParams(ctx, link)
+		return paramsErr
+	})
+	if err != nil {
+		if paramsErr != nil {
+			p.writeError(ctx, http.StatusBadRequest, paramsErr)
+		} else {
+			p.writeShareLinkError(ctx, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, link)
+}
+
+func (p *Server) onShareLinksDelete(ctx *gin.Context) {
+	id, ok := p.getShareLink(ctx)
+	if !ok {
+		return
+	}
+
+	err := p.shareLinks.remove(id)
+	if err != nil {
+		p.writeShareLinkError(ctx, err)
+		return
+	}
+
+	p.Log(logger.Info, "share link %s revoked", id)
+
+	ctx.Status(http.StatusOK)
+}
+
+// onShare serves the recording of a share link, without authentication.
+func (p *Server) onShare(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		p.writeError(ctx, http.StatusNotFound, errShareLinkNotFound)
+		return
+	}
+
+	// users of share links are not authenticated, therefore they are counted by IP
+	if !p.applyQuota(ctx, "ip:"+ctx.ClientIP()) {
+		return
+	}
+
+	link, err := p.shareLinks.use(id)
+	if err != nil {
+		p.writeShareLinkError(ctx, err)
+		return
+	}
+
+	// users of share links are never privileged
+	ok := p.writeRecording(ctx, link.Path, link.Start, time.Duration(link.Duration), link.Format, "", "", "",
+		p.privacyIntervals(link.Path), false, nil)
+
+	// the download is reserved before sending the recording, in order not to exceed maxDownloads
+	// with concurrent requests, and is given back when the recording has not been sent entirely.
+	if !ok {
+		err = p.shareLinks.refund(id)
+		if err != nil {
+			p.Log(logger.Warn, "unable to update share link %s: %v", id, err)
+		}
+	}
+}
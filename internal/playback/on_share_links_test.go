@@ -0,0 +1,196 @@
+package playback
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnShareLinks(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4"))
+
+	s := &Server{
+		Address:        "127.0.0.1:9996",
+		ReadTimeout:    conf.StringDuration(10 * time.Second),
+		ShareLinksFile: filepath.Join(dir, "sharelinks.json"),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	do := func(method string, u string) *http.Response {
+		req, err2 := http.NewRequest(method, u, nil)
+		require.NoError(t, err2)
+
+		res, err2 := hc.Do(req)
+		require.NoError(t, err2)
+		return res
+	}
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 1, 500000000, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "3")
+	v.Set("name", "incident")
+	v.Set("expiry", "3600")
+	v.Set("maxDownloads", "1")
+
+	res := do(http.MethodPost, "http://localhost:9996/sharelinks?"+v.Encode())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var link shareLink
+	err = json.NewDecoder(res.Body).Decode(&link)
+	res.Body.Close()
+	require.NoError(t, err)
+
+	require.Equal(t, "incident", link.Name)
+	require.Equal(t, "mypath", link.Path)
+	require.Equal(t, 1, link.MaxDownloads)
+	require.NotNil(t, link.Expires)
+
+	res = do(http.MethodGet, "http://localhost:9996/sharelinks?path=mypath")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var links []shareLink
+	err = json.NewDecoder(res.Body).Decode(&links)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(links))
+	require.Equal(t, link.ID, links[0].ID)
+
+	res = do(http.MethodGet, "http://localhost:9996/share/"+link.ID.String())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	buf, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.NotEmpty(t, buf)
+
+	// download limit reached
+	res = do(http.MethodGet, "http://localhost:9996/share/"+link.ID.String())
+	res.Body.Close()
+	require.Equal(t, http.StatusGone, res.StatusCode)
+
+	res = do(http.MethodGet, "http://localhost:9996/sharelinks?path=mypath")
+	err = json.NewDecoder(res.Body).Decode(&links)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, []shareLink{}, links)
+
+	res = do(http.MethodPatch, "http://localhost:9996/sharelinks/"+link.ID.String()+"?maxDownloads=2")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	err = json.NewDecoder(res.Body).Decode(&link)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, 2, link.MaxDownloads)
+	require.Equal(t, 1, link.Downloads)
+	require.Equal(t, "incident", link.Name)
+
+	res = do(http.MethodGet, "http://localhost:9996/share/"+link.ID.String())
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = do(http.MethodDelete, "http://localhost:9996/sharelinks/"+link.ID.String())
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = do(http.MethodGet, "http://localhost:9996/share/"+link.ID.String())
+	res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestOnShareLinksFailedDownload(t *testing.T) {
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.Local)
+
+	tr := newHarnessTree(t, "mypath", []harnessSegment{{
+		Start:           start,
+		Codecs:          []string{"H264"},
+		Fragments:       5,
+		FragmentSamples: 2,
+	}})
+
+	s := &Server{
+		Address:        "127.0.0.1:9996",
+		ReadTimeout:    conf.StringDuration(10 * time.Second),
+		ShareLinksFile: filepath.Join(tr.dir, "sharelinks.json"),
+		PathConfs: map[string]*conf.Path{
+			"mypath": tr.conf,
+		},
+		AuthManager: test.NilAuthManager,
+		Registry:    tr.registry,
+		Parent:      test.NilLogger,
+	}
+	err := s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	addLink := func(start time.Time, format string) shareLink {
+		v := url.Values{}
+		v.Set("path", "mypath")
+		v.Set("start", start.Format(time.RFC3339Nano))
+		v.Set("duration", "3")
+		v.Set("format", format)
+		v.Set("maxDownloads", "1")
+
+		res, err2 := http.Post("http://localhost:9996/sharelinks?"+v.Encode(), "", nil)
+		require.NoError(t, err2)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var link shareLink
+		err2 = json.NewDecoder(res.Body).Decode(&link)
+		require.NoError(t, err2)
+		return link
+	}
+
+	// the timespan doesn't contain recordings, therefore the download is not counted
+	link := addLink(start.Add(-time.Hour), "mkv")
+
+	for i := 0; i < 2; i++ {
+		code, _ := tr.get(t, "/share/"+link.ID.String())
+		require.Equal(t, http.StatusNotFound, code)
+	}
+
+	link, err = s.shareLinks.get(link.ID)
+	require.NoError(t, err)
+	require.Equal(t, 0, link.Downloads)
+
+	link = addLink(start, "mkv")
+
+	code, buf := tr.get(t, "/share/"+link.ID.String())
+	require.Equal(t, http.StatusOK, code)
+	require.NotEmpty(t, buf)
+
+	code, _ = tr.get(t, "/share/"+link.ID.String())
+	require.Equal(t, http.StatusGone, code)
+
+	addLink(start, "ts")
+}
@@ -0,0 +1,304 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/gin-gonic/gin"
+)
+
+// timelineSpan is the timespan covered by a segment.
+type timelineSpan struct {
+	start         time.Time
+	end           time.Time
+	codecs        []string
+	discontinuity record.Discontinuity
+}
+
+// timelineDiscontinuity is a discontinuity detected by the recorder.
+type timelineDiscontinuity struct {
+	Time   time.Time            `json:"time"`
+	Reason record.Discontinuity `json:"reason"`
+}
+
+type timelineRes struct {
+	Ranges          []listEntry             `json:"ranges"`
+	Gaps            []listEntry             `json:"gaps"`
+	Restarts        []time.Time             `json:"restarts"`
+	Discontinuities []timelineDiscontinuity `json:"discontinuities"`
+}
+
+// timelineSpansFromIndex reads timespans of segments from the index, without opening segments.
+func timelineSpansFromIndex(
+	pathConf *conf.Path,
+	pathName string,
+	now time.Time,
+	registry *record.Registry,
+) ([]timelineSpan, error) {
+	entries, err := record.IndexRead(pathConf.RecordIndexPath, pathName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// when a segment has multiple entries, the last one is used.
+	last := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		last[entry.Path] = i
+	}
+
+	var out []timelineSpan
+
+	for i, entry := range entries {
+		if last[entry.Path] != i {
+			continue
+		}
+
+		if entry.Format != nil && *entry.Format != pathConf.RecordFormat {
+			continue
+		}
+
+		// skip segments that have been deleted
+		if _, err := os.Stat(entry.Path); err == nil {
+			out = append(out, timelineSpan{
+				start:         entry.Start,
+				end:           entry.Start.Add(entry.Duration),
+				codecs:        entry.Codecs,
+				discontinuity: entry.Discontinuity,
+			})
+		}
+	}
+
+	// segments that are being written are not in the index yet
+	for _, seg := range registry.OpenSegments(pathName) {
+		if _, ok := last[seg.Path]; !ok && seg.Format == pathConf.RecordFormat {
+			out = append(out, timelineSpan{
+				start: seg.Start,
+				end:   now,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+// timelineSpansFromFiles reads timespans of segments from the recording directory.
+func timelineSpansFromFiles(
+	pathConf *conf.Path,
+	pathName string,
+	now time.Time,
+	limits boxLimits,
+	registry *record.Registry,
+) ([]timelineSpan, error) {
+	segments, err := FindSegmentFiles(pathConf, pathName, registry)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	out := make([]timelineSpan, 0, len(segments))
+
+	for _, seg := range segments {
+		if registry.SegmentIsOpen(seg.Fpath) {
+			out = append(out, timelineSpan{
+				start: seg.Start,
+				end:   now,
+			})
+			continue
+		}
+
+		details, err := readSegmentDetails(pathConf.RecordFormat, limits, seg)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, timelineSpan{
+			start:  seg.Start,
+			end:    seg.Start.Add(details.Duration),
+			codecs: details.Codecs,
+		})
+	}
+
+	return out, nil
+}
+
+// computeTimeline merges contiguous spans into ranges, and finds gaps between ranges,
+// restart points, that are boundaries between contiguous segments with different codecs,
+// and discontinuities detected by the recorder.
+// Spans are clipped to the window; gaps before the first range are reported only when start is set.
+func computeTimeline(spans []timelineSpan, start time.Time, end time.Time) timelineRes {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start.Before(spans[j].start)
+	})
+
+	res := timelineRes{
+		Ranges:          []listEntry{},
+		Gaps:            []listEntry{},
+		Restarts:        []time.Time{},
+		Discontinuities: []timelineDiscontinuity{},
+	}
+
+	var prev *timelineSpan
+	var rangeStart time.Time
+	var rangeEnd time.Time
+
+	closeRange := func() {
+		res.Ranges = append(res.Ranges, listEntry{
+			Start:    rangeStart,
+			Duration: listEntryDuration(rangeEnd.Sub(rangeStart)),
+		})
+	}
+
+	for i := range spans {
+		span := spans[i]
+
+		if !span.start.Before(end) || (!start.IsZero() && !span.end.After(start)) {
+			continue
+		}
+
+		if span.discontinuity != "" && !span.start.Before(start) {
+			res.Discontinuities = append(res.Discontinuities, timelineDiscontinuity{
+				Time:   span.start,
+				Reason: span.discontinuity,
+			})
+		}
+
+		if !start.IsZero() && span.start.Before(start) {
+			span.start = start
+		}
+		if span.end.After(end) {
+			span.end = end
+		}
+
+		switch {
+		case prev == nil:
+			if !start.IsZero() && span.start.Sub(start) > concatenationTolerance {
+				res.Gaps = append(res.Gaps, listEntry{
+					Start:    start,
+					Duration: listEntryDuration(span.start.Sub(start)),
+				})
+			}
+			rangeStart = span.start
+			rangeEnd = span.end
+
+		case span.start.Sub(rangeEnd) <= concatenationTolerance:
+			if prev.codecs != nil && span.codecs != nil && !reflect.DeepEqual(prev.codecs, span.codecs) {
+				res.Restarts = append(res.Restarts, span.start)
+			}
+			if span.end.After(rangeEnd) {
+				rangeEnd = span.end
+			}
+
+		default:
+			closeRange()
+			res.Gaps = append(res.Gaps, listEntry{
+				Start:    rangeEnd,
+				Duration: listEntryDuration(span.start.Sub(rangeEnd)),
+			})
+			rangeStart = span.start
+			rangeEnd = span.end
+		}
+
+		prev = &span
+	}
+
+	if prev == nil {
+		if !start.IsZero() {
+			res.Gaps = append(res.Gaps, listEntry{
+				Start:    start,
+				Duration: listEntryDuration(end.Sub(start)),
+			})
+		}
+		return res
+	}
+
+	closeRange()
+
+	if end.Sub(rangeEnd) > concatenationTolerance {
+		res.Gaps = append(res.Gaps, listEntry{
+			Start:    rangeEnd,
+			Duration: listEntryDuration(end.Sub(rangeEnd)),
+		})
+	}
+
+	return res
+}
+
+func (p *Server) onTimeline(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	now := time.Now()
+
+	var start time.Time
+	if raw := ctx.Query("start"); raw != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+			return
+		}
+	}
+
+	end := now
+	if raw := ctx.Query("end"); raw != "" {
+		var err error
+		end, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid end: %w", err))
+			return
+		}
+	}
+
+	if !start.IsZero() && !end.After(start) {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("end must be after start"))
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, "", 0)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	if limit := lookbackLimit(ctx); !limit.IsZero() && start.Before(limit) {
+		start = limit
+	}
+
+	release, ok := p.acquireReader(ctx, pathConf, pathName)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var spans []timelineSpan
+	if pathConf.RecordIndexPath != "" {
+		spans, err = timelineSpansFromIndex(pathConf, pathName, now, p.Registry)
+	} else {
+		spans, err = timelineSpansFromFiles(pathConf, pathName, now, p.boxLimits, p.Registry)
+	}
+	if err != nil {
+		p.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeHeaders(ctx, pathHeaders(pathConf, time.Time{}))
+	ctx.JSON(http.StatusOK, computeTimeline(spans, start, end))
+}
@@ -0,0 +1,96 @@
+package playback
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnTimeline(t *testing.T) {
+	for _, ca := range []string{"files", "index"} {
+		t.Run(ca, func(t *testing.T) {
+			start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC)
+
+			tr := newHarnessTree(t, "mypath", []harnessSegment{
+				{
+					Start:           start,
+					Codecs:          []string{"H264", "MPEG-4 Audio"},
+					Fragments:       5,
+					FragmentSamples: 2,
+					Indexed:         ca == "index",
+				},
+				{
+					Start:           start.Add(10 * time.Second),
+					Codecs:          []string{"H264"},
+					Fragments:       5,
+					FragmentSamples: 2,
+					Indexed:         ca == "index",
+				},
+				{
+					Start:           start.Add(30 * time.Second),
+					Codecs:          []string{"H264"},
+					Fragments:       5,
+					FragmentSamples: 2,
+					Indexed:         ca == "index",
+					Discontinuity:   record.DiscontinuityStart,
+				},
+			})
+			tr.serve(t)
+
+			v := url.Values{}
+			v.Set("path", "mypath")
+			v.Set("start", start.Add(-5*time.Second).Format(time.RFC3339))
+			v.Set("end", start.Add(45*time.Second).Format(time.RFC3339))
+
+			code, byts := tr.get(t, "/timeline?"+v.Encode())
+			require.Equal(t, http.StatusOK, code)
+
+			var res timelineRes
+			err := json.Unmarshal(byts, &res)
+			require.NoError(t, err)
+
+			require.Equal(t, []listEntry{
+				{Start: start, Duration: listEntryDuration(20 * time.Second)},
+				{Start: start.Add(30 * time.Second), Duration: listEntryDuration(10 * time.Second)},
+			}, res.Ranges)
+
+			require.Equal(t, []listEntry{
+				{Start: start.Add(-5 * time.Second), Duration: listEntryDuration(5 * time.Second)},
+				{Start: start.Add(20 * time.Second), Duration: listEntryDuration(10 * time.Second)},
+				{Start: start.Add(40 * time.Second), Duration: listEntryDuration(5 * time.Second)},
+			}, res.Gaps)
+
+			require.Equal(t, []time.Time{start.Add(10 * time.Second)}, res.Restarts)
+
+			// discontinuities are stored in the index only
+			if ca == "index" {
+				require.Equal(t, []timelineDiscontinuity{{
+					Time:   start.Add(30 * time.Second),
+					Reason: record.DiscontinuityStart,
+				}}, res.Discontinuities)
+			} else {
+				require.Empty(t, res.Discontinuities)
+			}
+
+			// window without recordings
+			v.Set("start", start.Add(time.Hour).Format(time.RFC3339))
+			v.Set("end", start.Add(2*time.Hour).Format(time.RFC3339))
+
+			code, byts = tr.get(t, "/timeline?"+v.Encode())
+			require.Equal(t, http.StatusOK, code)
+
+			res = timelineRes{}
+			err = json.Unmarshal(byts, &res)
+			require.NoError(t, err)
+			require.Empty(t, res.Ranges)
+			require.Equal(t, []listEntry{
+				{Start: start.Add(time.Hour), Duration: listEntryDuration(time.Hour)},
+			}, res.Gaps)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package playback
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed ui_index.html
+var uiIndex []byte
+
+func (p *Server) onUI(ctx *gin.Context) {
+	ctx.Writer.Header().Set("Cache-Control", "max-age=3600")
+	ctx.Writer.Header().Set("Content-Type", "text/html")
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Write(uiIndex)
+}
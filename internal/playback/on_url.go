@@ -0,0 +1,172 @@
+package playback
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// cache duration of immutable URLs.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+type urlRes struct {
+	URL       string `json:"url"`
+	Immutable bool   `json:"immutable"`
+}
+
+// contentRevision returns a string that changes every time the output of a window may change,
+// that is when segments are added, modified or deleted, or when privacy intervals are added.
+func contentRevision(segments []*Segment, privacy []privacyInterval) (string, error) {
+	h := sha256.New()
+
+	for _, seg := range segments {
+		fi, err := seg.Stat()
+		if err != nil {
+			return "", err
+		}
+
+		h.Write([]byte(filepath.Base(seg.Fpath)))
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(fi.Size())))
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(fi.ModTime().UnixNano())))
+	}
+
+	for _, interval := range privacy {
+		h.Write(interval.ID[:])
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(interval.Created.UnixNano())))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+// canonicalGetURL returns the canonical URL of a window.
+// Parameters are normalized, in order to allow caches to deduplicate requests.
+func canonicalGetURL(
+	baseURL string,
+	pathName string,
+	start time.Time,
+	duration time.Duration,
+	format string,
+	gapPolicy string,
+	rev string,
+) string {
+	v := url.Values{}
+	v.Set("path", pathName)
+	v.Set("start", start.UTC().Format(time.RFC3339Nano))
+	v.Set("duration", strconv.FormatFloat(duration.Seconds(), 'f', -1, 64))
+
+	if format != "" && format != "fmp4" {
+		v.Set("format", format)
+	}
+
+	if gapPolicy != "" && gapPolicy != "stop" {
+		v.Set("gapPolicy", gapPolicy)
+	}
+
+	if rev != "" {
+		v.Set("rev", rev)
+	}
+
+	return baseURL + "/get?" + v.Encode()
+}
+
+// liveCacheControl returns the cache duration of windows that touch the live edge,
+// that is the time needed to write a new part.
+func liveCacheControl(pathConf *conf.Path) string {
+	secs := int(time.Duration(pathConf.RecordPartDuration).Seconds())
+	if secs < 1 {
+		secs = 1
+	}
+	return "max-age=" + strconv.Itoa(secs)
+}
+
+// onURL returns the canonical URL of a window.
+// When the window is entirely in the past, the URL contains the revision of its content
+// and can be cached forever.
+func (p *Server) onURL(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !p.doAuth(ctx, pathName, conf.AuthActionPlayback) {
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	duration, err := parseDuration(ctx.Query("duration"))
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+		return
+	}
+
+	start, duration, err = clampLookback(lookbackLimit(ctx), start, duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	format := ctx.Query("format")
+	if format != "" && format != "fmp4" && format != "mp4" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", format))
+		return
+	}
+
+	gapPolicy := ctx.Query("gapPolicy")
+	if gapPolicy != "" && gapPolicy != "stop" && gapPolicy != "pad" {
+		p.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid gapPolicy: %s", gapPolicy))
+		return
+	}
+
+	pathConf, err := p.safeFindPathConf(pathName)
+	if err != nil {
+		p.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = checkPlayback(pathConf, playbackFormat(format), duration)
+	if err != nil {
+		p.writeError(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	segments, err := p.segmentCache.findSegmentsInTimespan(pathConf, pathName, start, duration)
+	if err != nil {
+		if errors.Is(err, errNoSegmentsFound) {
+			p.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			p.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	var rev string
+
+	// output of filters is not deterministic
+	immutable := windowFinished(pathConf, start.Add(duration)) && pathConf.PlaybackFilter == ""
+
+	if immutable {
+		rev, err = contentRevision(segments, p.privacyFor(ctx, pathName))
+		if err != nil {
+			p.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, &urlRes{
+		URL:       canonicalGetURL(p.browseBaseURL(ctx), pathName, start, duration, format, gapPolicy, rev),
+		Immutable: immutable,
+	})
+}
@@ -0,0 +1,101 @@
+package playback
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnURL(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	seg2 := filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4")
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	writeSegment2(t, seg2)
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:         filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable:     true,
+				RecordPartDuration: conf.StringDuration(1 * time.Second),
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 1, 500000000, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "3.0")
+	v.Set("format", "fmp4")
+
+	getURL := func() urlRes {
+		res, err2 := client.Get("http://localhost:9996/url?" + v.Encode())
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var out urlRes
+		err2 = json.NewDecoder(res.Body).Decode(&out)
+		require.NoError(t, err2)
+		return out
+	}
+
+	out := getURL()
+	require.True(t, out.Immutable)
+
+	u, err := url.Parse(out.URL)
+	require.NoError(t, err)
+	require.Equal(t, "/get", u.Path)
+	require.Equal(t, "3", u.Query().Get("duration"))
+	require.Equal(t, "", u.Query().Get("format"))
+	require.NotEqual(t, "", u.Query().Get("rev"))
+
+	res, err := client.Get(out.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, immutableCacheControl, res.Header.Get("Cache-Control"))
+
+	// recordings change
+	err = os.Chtimes(seg2, time.Now(), time.Now())
+	require.NoError(t, err)
+
+	res, err = client.Get(out.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+	require.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+
+	out2 := getURL()
+	require.NotEqual(t, out.URL, out2.URL)
+	require.Equal(t, out2.URL, "http://localhost:9996"+res.Header.Get("Location"))
+}
@@ -0,0 +1,144 @@
+package playback
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// header added to requests sent to peers, in order to avoid loops.
+const peerForwardedHeader = "X-Playback-Forwarded"
+
+func mergeListEntries(entries []listEntry) []listEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Start.Before(entries[j].Start)
+	})
+
+	out := []listEntry{}
+
+	for _, entry := range entries {
+		if len(out) != 0 {
+			prev := &out[len(out)-1]
+			prevEnd := prev.Start.Add(time.Duration(prev.Duration))
+
+			if !entry.Start.After(prevEnd) {
+				curEnd := entry.Start.Add(time.Duration(entry.Duration))
+				if curEnd.After(prevEnd) {
+					prev.Duration = listEntryDuration(curEnd.Sub(prev.Start))
+				}
+				continue
+			}
+		}
+
+		out = append(out, entry)
+	}
+
+	return out
+}
+
+func (p *Server) usePeers(ctx *gin.Context) bool {
+	return len(p.Peers) != 0 && ctx.GetHeader(peerForwardedHeader) == ""
+}
+
+func (p *Server) doPeerRequest(ctx *gin.Context, peer string, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx.Request.Context(), http.MethodGet,
+		strings.TrimSuffix(peer, "/")+endpoint+"?"+ctx.Request.URL.RawQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if v := ctx.GetHeader("Authorization"); v != "" {
+		req.Header.Set("Authorization", v)
+	}
+	req.Header.Set(peerForwardedHeader, "1")
+
+	return p.peerClient.Do(req)
+}
+
+func (p *Server) listPeer(ctx *gin.Context, peer string) ([]listEntry, error) {
+	res, err := p.doPeerRequest(ctx, peer, "/list")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code: %d", res.StatusCode)
+	}
+
+	var entries []listEntry
+	err = json.NewDecoder(res.Body).Decode(&entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// listPeers fetches recorded timespans from all peers.
+// Peers that cannot be reached or that don't have recordings are skipped.
+func (p *Server) listPeers(ctx *gin.Context) []listEntry {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var out []listEntry
+
+	for _, peer := range p.Peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+
+			entries, err := p.listPeer(ctx, peer)
+			if err != nil {
+				p.Log(logger.Debug, "unable to list recordings of peer %s: %v", peer, err)
+				return
+			}
+
+			mutex.Lock()
+			out = append(out, entries...)
+			mutex.Unlock()
+		}(peer)
+	}
+
+	wg.Wait()
+
+	return out
+}
+
+// forwardGet forwards a download request to the first peer that owns the requested recordings.
+// It returns false if no peer owns them.
+func (p *Server) forwardGet(ctx *gin.Context) bool {
+	for _, peer := range p.Peers {
+		res, err := p.doPeerRequest(ctx, peer, "/get")
+		if err != nil {
+			p.Log(logger.Debug, "unable to download recordings from peer %s: %v", peer, err)
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			continue
+		}
+
+		ctx.Header("Accept-Ranges", "none")
+		ctx.Header("Content-Type", res.Header.Get("Content-Type"))
+		ctx.Status(http.StatusOK)
+
+		_, err = io.Copy(ctx.Writer, res.Body)
+		res.Body.Close()
+		if err != nil {
+			p.Log(logger.Debug, "download from peer %s aborted: %v", peer, err)
+		}
+
+		return true
+	}
+
+	return false
+}
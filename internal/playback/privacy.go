@@ -0,0 +1,187 @@
+package playback
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/record"
+)
+
+var errPrivacyIntervalNotFound = errors.New("privacy interval not found")
+
+// privacyInterval is a timespan of a path that is hidden to non-privileged users.
+type privacyInterval struct {
+	ID       uuid.UUID         `json:"id"`
+	Created  time.Time         `json:"created"`
+	Path     string            `json:"path"`
+	Start    time.Time         `json:"start"`
+	Duration listEntryDuration `json:"duration"`
+	Reason   string            `json:"reason"`
+}
+
+func (i privacyInterval) contains(t time.Time) bool {
+	return !t.Before(i.Start) && t.Before(i.Start.Add(time.Duration(i.Duration)))
+}
+
+// privacyOverlaps checks whether any interval overlaps a timespan.
+func privacyOverlaps(intervals []privacyInterval, start time.Time, end time.Time) bool {
+	for _, i := range intervals {
+		if i.Start.Before(end) && start.Before(i.Start.Add(time.Duration(i.Duration))) {
+			return true
+		}
+	}
+	return false
+}
+
+// privacyManager stores privacy intervals into a file,
+// and publishes them into the registry, in order to apply them to replays.
+type privacyManager struct {
+	filePath string
+	registry *record.Registry
+
+	mutex     sync.Mutex
+	intervals map[uuid.UUID]*privacyInterval
+}
+
+func (m *privacyManager) initialize() error {
+	m.intervals = make(map[uuid.UUID]*privacyInterval)
+
+	buf, err := os.ReadFile(m.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			m.publish()
+			return nil
+		}
+		return err
+	}
+
+	var intervals []*privacyInterval
+	err = json.Unmarshal(buf, &intervals)
+	if err != nil {
+		return fmt.Errorf("unable to load privacy intervals: %w", err)
+	}
+
+	for _, interval := range intervals {
+		m.intervals[interval.ID] = interval
+	}
+
+	m.publish()
+
+	return nil
+}
+
+// publish copies intervals into the registry. It must be called with the mutex locked.
+func (m *privacyManager) publish() {
+	spans := make(map[string][]record.HiddenTimespan)
+
+	for _, interval := range m.listUnsafe("") {
+		spans[interval.Path] = append(spans[interval.Path], record.HiddenTimespan{
+			Start:    interval.Start,
+			Duration: time.Duration(interval.Duration),
+		})
+	}
+
+	m.registry.SetHiddenTimespans(spans)
+}
+
+// save writes intervals to disk atomically. It must be called with the mutex locked.
+func (m *privacyManager) save() error {
+	buf, err := json.MarshalIndent(m.listUnsafe(""), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := m.filePath + ".tmp"
+
+	err = os.WriteFile(tmp, buf, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.filePath)
+}
+
+func (m *privacyManager) add(interval *privacyInterval) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	interval.ID = uuid.New()
+	interval.Created = time.Now()
+
+	m.intervals[interval.ID] = interval
+
+	err := m.save()
+	if err != nil {
+		delete(m.intervals, interval.ID)
+		return err
+	}
+
+	m.publish()
+
+	return nil
+}
+
+func (m *privacyManager) get(id uuid.UUID) (privacyInterval, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	interval, ok := m.intervals[id]
+	if !ok {
+		return privacyInterval{}, errPrivacyIntervalNotFound
+	}
+
+	return *interval, nil
+}
+
+func (m *privacyManager) listUnsafe(pathName string) []privacyInterval {
+	out := []privacyInterval{}
+
+	for _, interval := range m.intervals {
+		if pathName == "" || interval.Path == pathName {
+			out = append(out, *interval)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Start.Before(out[j].Start)
+	})
+
+	return out
+}
+
+// list returns intervals of a path, or of all paths if pathName is empty.
+func (m *privacyManager) list(pathName string) []privacyInterval {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.listUnsafe(pathName)
+}
+
+func (m *privacyManager) remove(id uuid.UUID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	interval, ok := m.intervals[id]
+	if !ok {
+		return errPrivacyIntervalNotFound
+	}
+
+	delete(m.intervals, id)
+
+	err := m.save()
+	if err != nil {
+		m.intervals[id] = interval
+		return err
+	}
+
+	m.publish()
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package playback
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+// finished downloads are kept for this period, in order to allow clients to read their final state.
+const progressRetention = 1 * time.Minute
+
+// interval between progress events.
+const progressInterval = 1 * time.Second
+
+var progressIDRegexp = regexp.MustCompile(`^[0-9a-zA-Z_-]{1,64}$`)
+
+// progressEvent is the state of a download, sent to clients.
+type progressEvent struct {
+	// percent of the timespan that has been muxed
+	Percent   float64 `json:"percent"`
+	BytesSent uint64  `json:"bytesSent"`
+	Done      bool    `json:"done"`
+}
+
+// downloadProgress is the progress of a single download.
+type downloadProgress struct {
+	path     string
+	duration time.Duration
+
+	muxed atomic.Int64
+	sent  atomic.Uint64
+
+	done       chan struct{}
+	finishedAt time.Time
+}
+
+func (d *downloadProgress) event() progressEvent {
+	ev := progressEvent{
+		BytesSent: d.sent.Load(),
+	}
+
+	select {
+	case <-d.done:
+		ev.Done = true
+	default:
+	}
+
+	if d.duration > 0 {
+		ev.Percent = min(float64(d.muxed.Load())*100/float64(d.duration), 100)
+	}
+
+	return ev
+}
+
+// progressManager stores the progress of downloads, keyed by an ID chosen by clients.
+type progressManager struct {
+	mutex     sync.Mutex
+	downloads map[string]*downloadProgress
+}
+
+func (m *progressManager) initialize() {
+	m.downloads = make(map[string]*downloadProgress)
+}
+
+func (m *progressManager) removeExpired(now time.Time) {
+	for id, d := range m.downloads {
+		if !d.finishedAt.IsZero() && now.Sub(d.finishedAt) >= progressRetention {
+			delete(m.downloads, id)
+		}
+	}
+}
+
+func (m *progressManager) add(id string, pathName string, duration time.Duration) (*downloadProgress, error) {
+	if !progressIDRegexp.MatchString(id) {
+		return nil, fmt.Errorf("invalid progressId")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.removeExpired(time.Now())
+
+	if d, ok := m.downloads[id]; ok && d.finishedAt.IsZero() {
+		return nil, fmt.Errorf("progressId is already in use")
+	}
+
+	d := &downloadProgress{
+		path:     pathName,
+		duration: duration,
+		done:     make(chan struct{}),
+	}
+	m.downloads[id] = d
+
+	return d, nil
+}
+
+func (m *progressManager) finish(d *downloadProgress) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	d.finishedAt = time.Now()
+	close(d.done)
+}
+
+// get returns a download of the given path.
+func (m *progressManager) get(id string, pathName string) (*downloadProgress, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.removeExpired(time.Now())
+
+	d, ok := m.downloads[id]
+	if !ok || d.path != pathName {
+		return nil, false
+	}
+
+	return d, true
+}
+
+// progressWriter counts the bytes that are sent to the client.
+type progressWriter struct {
+	w        *writerWrapper
+	progress *downloadProgress
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.progress.sent.Add(uint64(n))
+	return n, err
+}
+
+// muxerProgress is a muxer that tracks the position of muxed samples inside the timespan.
+type muxerProgress struct {
+	muxer
+	progress *downloadProgress
+
+	timeScales map[int]uint32
+	curTrack   int
+}
+
+func (w *muxerProgress) writeInit(init *fmp4.Init) {
+	w.timeScales = make(map[int]uint32)
+
+	for _, track := range init.Tracks {
+		w.timeScales[track.ID] = track.TimeScale
+	}
+
+	w.muxer.writeInit(init)
+}
+
+func (w *muxerProgress) setTrack(trackID int) {
+	w.curTrack = trackID
+	w.muxer.setTrack(trackID)
+}
+
+func (w *muxerProgress) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	getPayload func() ([]byte, error),
+) error {
+	err := w.muxer.writeSample(dts, ptsOffset, isNonSyncSample, payloadSize, getPayload)
+	if err != nil {
+		return err
+	}
+
+	if timeScale, ok := w.timeScales[w.curTrack]; ok && dts >= 0 {
+		pos := int64(durationMp4ToGo(dts, timeScale))
+		if pos > w.progress.muxed.Load() {
+			w.progress.muxed.Store(pos)
+		}
+	}
+
+	return nil
+}
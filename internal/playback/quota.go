@@ -0,0 +1,230 @@
+package playback
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+type quotaExceededError struct {
+	period string
+	quota  uint64
+}
+
+func (e quotaExceededError) Error() string {
+	return fmt.Sprintf("%s download quota of %d bytes exceeded", e.period, e.quota)
+}
+
+type quotaUsage struct {
+	Identity     string `json:"identity"`
+	Day          string `json:"day"`
+	DailyBytes   uint64 `json:"dailyBytes"`
+	Month        string `json:"month"`
+	MonthlyBytes uint64 `json:"monthlyBytes"`
+}
+
+// quotaIdentity returns the credential that is used to count downloaded bytes.
+// It must be called after the request has been authenticated.
+func quotaIdentity(ctx *gin.Context) string {
+	req, _ := authRequest(ctx, "", "")
+
+	if req.User != "" {
+		return "user:" + req.User
+	}
+
+	// do not expose tokens in usage reports
+	q, _ := url.ParseQuery(req.Query)
+	if token := q.Get("jwt"); token != "" {
+		h := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(h[:8])
+	}
+
+	return "ip:" + ctx.ClientIP()
+}
+
+// quotaManager counts bytes downloaded by each credential
+// and enforces daily and monthly quotas.
+type quotaManager struct {
+	daily   uint64
+	monthly uint64
+
+	mutex sync.Mutex
+	usage map[string]*quotaUsage
+	day   string
+}
+
+func (m *quotaManager) initialize() {
+	m.usage = make(map[string]*quotaUsage)
+}
+
+// get returns the usage of an identity. It must be called with the mutex locked.
+func (m *quotaManager) get(identity string, now time.Time) *quotaUsage {
+	day := now.Format("2006-01-02")
+	month := now.Format("2006-01")
+
+	if m.day != day {
+		m.day = day
+		m.evict(day, month)
+	}
+
+	u, ok := m.usage[identity]
+	if !ok {
+		u = &quotaUsage{Identity: identity}
+		m.usage[identity] = u
+	}
+
+	if u.Day != day {
+		u.Day = day
+		u.DailyBytes = 0
+	}
+
+	if u.Month != month {
+		u.Month = month
+		u.MonthlyBytes = 0
+	}
+
+	return u
+}
+
+// evict removes identities whose windows have expired, in order not to keep
+// every identity that has ever downloaded something. It must be called with the mutex locked.
+func (m *quotaManager) evict(day string, month string) {
+	for identity, u := range m.usage {
+		if u.Day != day && (m.monthly == 0 || u.Month != month) {
+			delete(m.usage, identity)
+		}
+	}
+}
+
+func (m *quotaManager) check(u *quotaUsage) error {
+	if m.daily != 0 && u.DailyBytes >= m.daily {
+		return quotaExceededError{period: "daily", quota: m.daily}
+	}
+	if m.monthly != 0 && u.MonthlyBytes >= m.monthly {
+		return quotaExceededError{period: "monthly", quota: m.monthly}
+	}
+	return nil
+}
+
+// allow checks whether an identity can still download.
+func (m *quotaManager) allow(identity string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.check(m.get(identity, time.Now()))
+}
+
+// add counts downloaded bytes and returns an error if a quota has been exceeded.
+func (m *quotaManager) add(identity string, n uint64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	u := m.get(identity, time.Now())
+	u.DailyBytes += n
+	u.MonthlyBytes += n
+
+	if m.daily != 0 && u.DailyBytes > m.daily {
+		return quotaExceededError{period: "daily", quota: m.daily}
+	}
+	if m.monthly != 0 && u.MonthlyBytes > m.monthly {
+		return quotaExceededError{period: "monthly", quota: m.monthly}
+	}
+	return nil
+}
+
+func (m *quotaManager) report() []quotaUsage {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	out := make([]quotaUsage, 0, len(m.usage))
+
+	for identity := range m.usage {
+		out = append(out, *m.get(identity, now))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Identity < out[j].Identity
+	})
+
+	return out
+}
+
+// quotaWriter counts bytes written to the response and stops the download when a quota is exceeded.
+// Bytes are counted once the identity has been set by applyQuota().
+type quotaWriter struct {
+	gin.ResponseWriter
+	m        *quotaManager
+	identity string
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	if w.identity == "" {
+		return w.ResponseWriter.Write(p)
+	}
+
+	err := w.m.add(w.identity, uint64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (s *Server) middlewareQuota(ctx *gin.Context) {
+	w := &quotaWriter{
+		ResponseWriter: ctx.Writer,
+		m:              s.quotas,
+	}
+	ctx.Writer = w
+	ctx.Set("quotaWriter", w)
+}
+
+// applyQuota checks the quota of an identity and starts counting the bytes it downloads.
+// It is called once the identity has been verified, in order not to charge other users,
+// and does nothing in routes that do not download recordings.
+func (s *Server) applyQuota(ctx *gin.Context, identity string) bool {
+	v, ok := ctx.Get("quotaWriter")
+	if !ok {
+		return true
+	}
+
+	w := v.(*quotaWriter)
+	if w.identity != "" {
+		return true
+	}
+
+	err := s.quotas.allow(identity)
+	if err != nil {
+		s.writeError(ctx, http.StatusTooManyRequests, err)
+		return false
+	}
+
+	w.identity = identity
+	return true
+}
+
+type quotaReport struct {
+	DailyQuota   uint64       `json:"dailyQuota"`
+	MonthlyQuota uint64       `json:"monthlyQuota"`
+	Usage        []quotaUsage `json:"usage"`
+}
+
+func (s *Server) onUsage(ctx *gin.Context) {
+	if !s.doAuth(ctx, "", conf.AuthActionAPI) {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, quotaReport{
+		DailyQuota:   s.quotas.daily,
+		MonthlyQuota: s.quotas.monthly,
+		Usage:        s.quotas.report(),
+	})
+}
@@ -0,0 +1,15 @@
+//go:build linux
+// +build linux
+
+package playback
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink makes dest share the data blocks of src, on filesystems that support it.
+func reflink(dest *os.File, src *os.File) error {
+	return unix.IoctlFileClone(int(dest.Fd()), int(src.Fd()))
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package playback
+
+import (
+	"fmt"
+	"os"
+)
+
+func reflink(_ *os.File, _ *os.File) error {
+	return fmt.Errorf("reflinks are not supported on this platform")
+}
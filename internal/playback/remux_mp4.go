@@ -0,0 +1,559 @@
+package playback
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+)
+
+const (
+	remuxPartDuration = 1 * time.Second
+)
+
+// flags of trun boxes, that are not exported by go-mp4.
+const (
+	trunDataOffsetPresent                  = 0x000001
+	trunFirstSampleFlagsPresent            = 0x000004
+	trunSampleDurationPresent              = 0x000100
+	trunSampleSizePresent                  = 0x000200
+	trunSampleFlagsPresent                 = 0x000400
+	trunSampleCompositionTimeOffsetPresent = 0x000800
+)
+
+type remuxMP4Sample struct {
+	offset    uint64
+	size      uint32
+	dts       int64
+	duration  uint32
+	ptsOffset int32
+	isSync    bool
+}
+
+type remuxMP4Track struct {
+	id        int
+	timeScale uint32
+	stts      *mp4.Stts
+	ctts      *mp4.Ctts
+	stss      *mp4.Stss
+	stsz      *mp4.Stsz
+	stsc      *mp4.Stsc
+	chunks    []uint64
+	samples   []*remuxMP4Sample
+	next      int
+}
+
+func (t *remuxMP4Track) fillSamples() error {
+	if t.stts == nil || t.stsz == nil || t.stsc == nil || t.chunks == nil {
+		return fmt.Errorf("track %d has an incomplete sample table", t.id)
+	}
+
+	count := int(t.stsz.SampleCount)
+	t.samples = make([]*remuxMP4Sample, count)
+
+	for i := range t.samples {
+		t.samples[i] = &remuxMP4Sample{
+			isSync: t.stss == nil,
+		}
+
+		if t.stsz.SampleSize != 0 {
+			t.samples[i].size = t.stsz.SampleSize
+		} else {
+			if i >= len(t.stsz.EntrySize) {
+				return fmt.Errorf("invalid stsz")
+			}
+			t.samples[i].size = t.stsz.EntrySize[i]
+		}
+	}
+
+	// timestamps
+	i := 0
+	dts := int64(0)
+	for _, e := range t.stts.Entries {
+		for j := uint32(0); j < e.SampleCount && i < count; j++ {
+			t.samples[i].dts = dts
+			t.samples[i].duration = e.SampleDelta
+			dts += int64(e.SampleDelta)
+			i++
+		}
+	}
+	if i != count {
+		return fmt.Errorf("invalid stts")
+	}
+
+	if t.ctts != nil {
+		i = 0
+		for _, e := range t.ctts.Entries {
+			for j := uint32(0); j < e.SampleCount && i < count; j++ {
+				if t.ctts.GetVersion() == 0 {
+					t.samples[i].ptsOffset = int32(e.SampleOffsetV0)
+				} else {
+					t.samples[i].ptsOffset = e.SampleOffsetV1
+				}
+				i++
+			}
+		}
+	}
+
+	if t.stss != nil {
+		for _, n := range t.stss.SampleNumber {
+			if n == 0 || int(n) > count {
+				return fmt.Errorf("invalid stss")
+			}
+			t.samples[n-1].isSync = true
+		}
+	}
+
+	// offsets
+	i = 0
+	for k, e := range t.stsc.Entries {
+		lastChunk := uint32(len(t.chunks))
+		if k < len(t.stsc.Entries)-1 {
+			lastChunk = t.stsc.Entries[k+1].FirstChunk - 1
+		}
+
+		for chunk := e.FirstChunk; chunk <= lastChunk; chunk++ {
+			if chunk == 0 || int(chunk) > len(t.chunks) {
+				return fmt.Errorf("invalid stsc")
+			}
+
+			offset := t.chunks[chunk-1]
+
+			for j := uint32(0); j < e.SamplesPerChunk && i < count; j++ {
+				t.samples[i].offset = offset
+				offset += uint64(t.samples[i].size)
+				i++
+			}
+		}
+	}
+	if i != count {
+		return fmt.Errorf("invalid stsc")
+	}
+
+	return nil
+}
+
+func (t *remuxMP4Track) duration() time.Duration {
+	if len(t.samples) == 0 {
+		return 0
+	}
+	last := t.samples[len(t.samples)-1]
+	return durationMp4ToGo(last.dts+int64(last.duration), t.timeScale)
+}
+
+func remuxMP4ReadTracks(r io.ReadSeeker) ([]*remuxMP4Track, error) {
+	var tracks []*remuxMP4Track
+	var curTrack *remuxMP4Track
+
+	_, err := mp4.ReadBoxStructure(r, func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moov", "mdia", "minf", "stbl":
+			return h.Expand()
+
+		case "trak":
+			curTrack = &remuxMP4Track{}
+			tracks = append(tracks, curTrack)
+			return h.Expand()
+		}
+
+		if curTrack == nil {
+			return nil, nil
+		}
+
+		switch h.BoxInfo.Type.String() {
+		case "tkhd", "mdhd", "stts", "ctts", "stss", "stsz", "stsc", "stco", "co64":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+
+			switch box := box.(type) {
+			case *mp4.Tkhd:
+				curTrack.id = int(box.TrackID)
+			case *mp4.Mdhd:
+				curTrack.timeScale = box.Timescale
+			case *mp4.Stts:
+				curTrack.stts = box
+			case *mp4.Ctts:
+				curTrack.ctts = box
+			case *mp4.Stss:
+				curTrack.stss = box
+			case *mp4.Stsz:
+				curTrack.stsz = box
+			case *mp4.Stsc:
+				curTrack.stsc = box
+			case *mp4.Stco:
+				curTrack.chunks = make([]uint64, len(box.ChunkOffset))
+				for i, v := range box.ChunkOffset {
+					curTrack.chunks[i] = uint64(v)
+				}
+			case *mp4.Co64:
+				curTrack.chunks = box.ChunkOffset
+			}
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, track := range tracks {
+		err = track.fillSamples()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tracks, nil
+}
+
+func isFragmentedMP4(r io.ReadSeeker) (bool, error) {
+	fragmented := false
+
+	_, err := mp4.ReadBoxStructure(r, func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moov":
+			return h.Expand()
+
+		case "mvex", "moof":
+			fragmented = true
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return fragmented, nil
+}
+
+// remuxFMP4ReadTracks reads the samples of a fMP4 file.
+// Timestamps are shifted in order to make the first sample start from zero,
+// since fragments of external files may have any base time.
+func remuxFMP4ReadTracks(r io.ReadSeeker, limits boxLimits, init *fmp4.Init) ([]*remuxMP4Track, error) {
+	tracks := make(map[int]*remuxMP4Track)
+	defaults := make(map[int]*mp4.Trex)
+	var ordered []*remuxMP4Track
+
+	var moofOffset uint64
+	var tfhd *mp4.Tfhd
+	var curTrack *remuxMP4Track
+	dts := int64(-1)
+	var dataOffset uint64
+
+	err := readBoxStructure(r, limits, func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moov", "mvex", "traf":
+			return h.Expand()
+
+		case "moof":
+			moofOffset = h.BoxInfo.Offset
+			return h.Expand()
+
+		case "trex":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			trex := box.(*mp4.Trex)
+			defaults[int(trex.TrackID)] = trex
+
+		case "tfhd":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			tfhd = box.(*mp4.Tfhd)
+
+			initTrack := findInitTrack(init.Tracks, int(tfhd.TrackID))
+			if initTrack == nil {
+				// tracks with unsupported codecs are skipped
+				curTrack = nil
+				return nil, nil
+			}
+
+			curTrack = tracks[initTrack.ID]
+			if curTrack == nil {
+				curTrack = &remuxMP4Track{
+					id:        initTrack.ID,
+					timeScale: initTrack.TimeScale,
+				}
+				tracks[initTrack.ID] = curTrack
+				ordered = append(ordered, curTrack)
+			}
+
+			dataOffset = moofOffset
+			if tfhd.CheckFlag(mp4.TfhdBaseDataOffsetPresent) {
+				dataOffset = tfhd.BaseDataOffset
+			}
+
+		case "tfdt":
+			if curTrack == nil {
+				return nil, nil
+			}
+
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			tfdt := box.(*mp4.Tfdt)
+
+			if tfdt.GetVersion() == 0 {
+				dts = int64(tfdt.BaseMediaDecodeTimeV0)
+			} else {
+				dts = int64(tfdt.BaseMediaDecodeTimeV1)
+			}
+
+		case "trun":
+			if curTrack == nil {
+				return nil, nil
+			}
+
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			trun := box.(*mp4.Trun)
+
+			// fragments without tfdt continue from the previous one
+			if len(curTrack.samples) != 0 && dts < 0 {
+				last := curTrack.samples[len(curTrack.samples)-1]
+				dts = last.dts + int64(last.duration)
+			}
+			dts = max(dts, 0)
+
+			if trun.CheckFlag(trunDataOffsetPresent) {
+				dataOffset = uint64(int64(dataOffset) + int64(trun.DataOffset))
+			}
+
+			def := defaults[curTrack.id]
+			if def == nil {
+				def = &mp4.Trex{}
+			}
+
+			for i, e := range trun.Entries {
+				sample := &remuxMP4Sample{
+					offset:   dataOffset,
+					dts:      dts,
+					duration: def.DefaultSampleDuration,
+					size:     def.DefaultSampleSize,
+				}
+				flags := def.DefaultSampleFlags
+
+				if tfhd.CheckFlag(mp4.TfhdDefaultSampleDurationPresent) {
+					sample.duration = tfhd.DefaultSampleDuration
+				}
+				if tfhd.CheckFlag(mp4.TfhdDefaultSampleSizePresent) {
+					sample.size = tfhd.DefaultSampleSize
+				}
+				if tfhd.CheckFlag(mp4.TfhdDefaultSampleFlagsPresent) {
+					flags = tfhd.DefaultSampleFlags
+				}
+
+				if trun.CheckFlag(trunSampleDurationPresent) {
+					sample.duration = e.SampleDuration
+				}
+				if trun.CheckFlag(trunSampleSizePresent) {
+					sample.size = e.SampleSize
+				}
+				if i == 0 && trun.CheckFlag(trunFirstSampleFlagsPresent) {
+					flags = trun.FirstSampleFlags
+				} else if trun.CheckFlag(trunSampleFlagsPresent) {
+					flags = e.SampleFlags
+				}
+				if trun.CheckFlag(trunSampleCompositionTimeOffsetPresent) {
+					if trun.GetVersion() == 0 {
+						sample.ptsOffset = int32(e.SampleCompositionTimeOffsetV0)
+					} else {
+						sample.ptsOffset = e.SampleCompositionTimeOffsetV1
+					}
+				}
+
+				sample.isSync = (flags & sampleFlagIsNonSyncSample) == 0
+
+				curTrack.samples = append(curTrack.samples, sample)
+				dataOffset += uint64(sample.size)
+				dts += int64(sample.duration)
+			}
+
+			dts = -1
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// shift all tracks by the same amount, in order to preserve synchronization
+	var offset time.Duration = -1
+	for _, track := range ordered {
+		if len(track.samples) == 0 {
+			continue
+		}
+		start := durationMp4ToGo(track.samples[0].dts, track.timeScale)
+		if offset < 0 || start < offset {
+			offset = start
+		}
+	}
+
+	for _, track := range ordered {
+		trackOffset := durationGoToMp4(offset, track.timeScale)
+		for _, sample := range track.samples {
+			sample.dts -= trackOffset
+		}
+	}
+
+	return ordered, nil
+}
+
+// remuxMP4 converts a MP4 or fMP4 file into a fMP4 segment whose timestamps start from zero.
+// It returns the duration of the segment.
+func remuxMP4(r io.ReadSeeker, w io.Writer, limits boxLimits) (time.Duration, error) {
+	fragmented, err := isFragmentedMP4(r)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	var init *fmp4.Init
+	var allTracks []*remuxMP4Track
+
+	if fragmented {
+		init, err = segmentFMP4ReadInit(r, limits)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		init = &fmp4.Init{}
+		err = init.Unmarshal(r)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if len(init.Tracks) == 0 {
+		return 0, fmt.Errorf("no supported tracks found")
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	if fragmented {
+		allTracks, err = remuxFMP4ReadTracks(r, limits, init)
+	} else {
+		allTracks, err = remuxMP4ReadTracks(r)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// keep tracks with a supported codec only
+	var tracks []*remuxMP4Track
+	for _, track := range allTracks {
+		for _, initTrack := range init.Tracks {
+			if initTrack.ID == track.id {
+				tracks = append(tracks, track)
+				break
+			}
+		}
+	}
+
+	var buf seekablebuffer.Buffer
+	err = init.Marshal(&buf)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	var duration time.Duration
+	for _, track := range tracks {
+		if d := track.duration(); d > duration {
+			duration = d
+		}
+	}
+
+	seqNum := uint32(1)
+
+	for partEnd := remuxPartDuration; ; partEnd += remuxPartDuration {
+		part := &fmp4.Part{
+			SequenceNumber: seqNum,
+		}
+
+		for _, track := range tracks {
+			var partTrack *fmp4.PartTrack
+
+			for track.next < len(track.samples) {
+				sample := track.samples[track.next]
+				if durationMp4ToGo(sample.dts, track.timeScale) >= partEnd {
+					break
+				}
+
+				if partTrack == nil {
+					partTrack = &fmp4.PartTrack{
+						ID:       track.id,
+						BaseTime: uint64(sample.dts),
+					}
+				}
+
+				_, err = r.Seek(int64(sample.offset), io.SeekStart)
+				if err != nil {
+					return 0, err
+				}
+
+				payload := make([]byte, sample.size)
+				_, err = io.ReadFull(r, payload)
+				if err != nil {
+					return 0, err
+				}
+
+				partTrack.Samples = append(partTrack.Samples, &fmp4.PartSample{
+					Duration:        sample.duration,
+					PTSOffset:       sample.ptsOffset,
+					IsNonSyncSample: !sample.isSync,
+					Payload:         payload,
+				})
+
+				track.next++
+			}
+
+			if partTrack != nil {
+				part.Tracks = append(part.Tracks, partTrack)
+			}
+		}
+
+		if part.Tracks != nil {
+			buf.Reset()
+			err = part.Marshal(&buf)
+			if err != nil {
+				return 0, err
+			}
+
+			_, err = w.Write(buf.Bytes())
+			if err != nil {
+				return 0, err
+			}
+			seqNum++
+		}
+
+		if partEnd >= duration {
+			break
+		}
+	}
+
+	return duration, nil
+}
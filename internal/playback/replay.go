@@ -0,0 +1,305 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	// maximum duration of a replay without end.
+	replayMaxDuration = 100 * 365 * 24 * time.Hour
+
+	// give readers the time to become active before writing the first samples.
+	replayStartDelay = 100 * time.Millisecond
+)
+
+// ParseReplayQuery parses the start date and duration of a replay from a URL query.
+// Both are optional.
+func ParseReplayQuery(query string) (time.Time, time.Duration, error) {
+	vals, err := url.ParseQuery(query)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid query: %w", err)
+	}
+
+	var start time.Time
+	if v := vals.Get("start"); v != "" {
+		start, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, 0, fmt.Errorf("invalid start: %w", err)
+		}
+	}
+
+	var duration time.Duration
+	if v := vals.Get("duration"); v != "" {
+		duration, err = parseDuration(v)
+		if err != nil || duration <= 0 {
+			return time.Time{}, 0, fmt.Errorf("invalid duration: %s", v)
+		}
+	}
+
+	return start, duration, nil
+}
+
+// Replay reads recordings of a path and writes them into a stream, at real-time speed.
+type Replay struct {
+	PathConf          *conf.Path
+	PathName          string
+	UDPMaxPayloadSize int
+	// limits applied when parsing segments, filled with the playbackMaxBox* settings.
+	BoxLimits BoxLimits
+	// maximum age of recordings that can be replayed. Zero means no limit.
+	MaxLookback time.Duration
+	// whether the reader is allowed to see recordings hidden by privacy intervals.
+	// Otherwise, intervals published into Registry are masked.
+	Privileged bool
+	// segments that are being written by this process.
+	Registry *record.Registry
+	// if true, NTP timestamps are set to the current time instead of the recording time.
+	LiveNTP bool
+	// if set, it is called to obtain the stream instead of creating a new one.
+	// The stream is not closed by Close().
+	OnDescription func(desc *description.Session) (*stream.Stream, error)
+	Parent        logger.Writer
+
+	boxLimits    boxLimits
+	segmentCache *segmentCache
+	init         *fmp4.Init
+	stream       *stream.Stream
+	streamCustom bool
+	createdAt    time.Time
+
+	ctx       context.Context
+	ctxCancel func()
+	done      chan struct{}
+	err       error
+}
+
+// Initialize initializes Replay.
+// The stream description is built from the most recent recording segment.
+func (r *Replay) Initialize() error {
+	r.boxLimits = r.BoxLimits.limits()
+
+	r.segmentCache = &segmentCache{
+		registry: r.Registry,
+	}
+	r.segmentCache.initialize()
+
+	err := checkPlayback(r.PathConf, "replay", 0)
+	if err != nil {
+		return err
+	}
+
+	if r.PathConf.RecordFormat != conf.RecordFormatFMP4 {
+		return fmt.Errorf("MPEG-TS format is not supported yet")
+	}
+
+	segments, err := r.segmentCache.findSegments(r.PathConf, r.PathName)
+	if err != nil {
+		return err
+	}
+
+	r.init, err = readSegmentInit(segments[len(segments)-1], r.boxLimits)
+	if err != nil {
+		return err
+	}
+
+	desc, err := replayDescription(r.init)
+	if err != nil {
+		return err
+	}
+
+	if r.OnDescription != nil {
+		r.stream, err = r.OnDescription(desc)
+		r.streamCustom = true
+	} else {
+		r.stream, err = stream.New(
+			r.UDPMaxPayloadSize,
+			desc,
+			true,
+			logger.NewLimitedLogger(r),
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.createdAt = time.Now()
+
+	return nil
+}
+
+// Close closes Replay.
+func (r *Replay) Close() {
+	r.Stop()
+
+	if !r.streamCustom {
+		r.stream.Close()
+	}
+}
+
+// Log implements logger.Writer.
+func (r *Replay) Log(level logger.Level, format string, args ...interface{}) {
+	r.Parent.Log(level, "[replay] "+format, args...)
+}
+
+// Stream returns the stream in which recordings are written.
+func (r *Replay) Stream() *stream.Stream {
+	return r.stream
+}
+
+// Play starts writing recordings into the stream, from the given time.
+// A zero start means that recordings are written from the beginning.
+// A zero duration means that recordings are written until they end.
+// Any previous playback is stopped.
+func (r *Replay) Play(start time.Time, duration time.Duration) error {
+	r.Stop()
+
+	if duration <= 0 {
+		duration = replayMaxDuration
+
+		// replays without end are limited to the maximum duration
+		if r.PathConf.PlaybackMaxDuration != 0 {
+			duration = time.Duration(r.PathConf.PlaybackMaxDuration)
+		}
+	}
+
+	err := checkPlayback(r.PathConf, "replay", duration)
+	if err != nil {
+		return err
+	}
+
+	if start.IsZero() {
+		segments, err := r.segmentCache.findSegments(r.PathConf, r.PathName)
+		if err != nil {
+			return err
+		}
+		start = segments[0].Start
+	}
+
+	if r.MaxLookback != 0 {
+		start, duration, err = clampLookback(time.Now().Add(-r.MaxLookback), start, duration)
+		if err != nil {
+			return err
+		}
+	}
+
+	segments, err := r.segmentCache.findSegmentsInTimespan(r.PathConf, r.PathName, start, duration)
+	if err != nil {
+		return err
+	}
+
+	init, err := readSegmentInit(segments[0], r.boxLimits)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(init, r.init) {
+		return fmt.Errorf("recording at %v has different tracks than the described ones", start)
+	}
+
+	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
+	r.done = make(chan struct{})
+	r.err = nil
+
+	m := &muxerReplay{
+		ctx:       r.ctx,
+		stream:    r.stream,
+		start:     start,
+		basePTS:   time.Since(r.createdAt),
+		wallStart: time.Now().Add(replayStartDelay),
+	}
+
+	if r.LiveNTP {
+		m.start = m.wallStart
+	}
+
+	go r.run(segments, start, duration, r.privacy(), m)
+
+	return nil
+}
+
+// Done returns a channel that is closed when the last playback ends.
+func (r *Replay) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns the error that caused the last playback to end, if any.
+// It must be called after Done() is closed.
+func (r *Replay) Err() error {
+	return r.err
+}
+
+// Stop stops writing recordings into the stream.
+func (r *Replay) Stop() {
+	if r.ctxCancel != nil {
+		r.ctxCancel()
+		<-r.done
+		r.ctxCancel = nil
+	}
+}
+
+// privacy returns the privacy intervals that apply to the reader.
+func (r *Replay) privacy() []privacyInterval {
+	if r.Privileged {
+		return nil
+	}
+
+	var out []privacyInterval
+	for _, span := range r.Registry.HiddenTimespans(r.PathName) {
+		out = append(out, privacyInterval{
+			Path:     r.PathName,
+			Start:    span.Start,
+			Duration: listEntryDuration(span.Duration),
+		})
+	}
+	return out
+}
+
+func (r *Replay) run(
+	segments []*Segment,
+	start time.Time,
+	duration time.Duration,
+	privacy []privacyInterval,
+	m *muxerReplay,
+) {
+	defer close(r.done)
+
+	release, err := r.Registry.AcquireReader(r.ctx, r.PathName, r.PathConf.PlaybackMaxReaders)
+	if err != nil {
+		return
+	}
+	defer release()
+
+	r.Log(logger.Debug, "replaying path '%s' from %v", r.PathName, start)
+
+	err = seekAndMux(r.PathConf.RecordFormat, r.boxLimits, segments, start, duration, privacy, nil, m)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		r.Log(logger.Warn, "replay of path '%s' stopped: %v", r.PathName, err)
+		r.err = err
+		return
+	}
+
+	r.Log(logger.Debug, "replay of path '%s' finished", r.PathName)
+}
+
+func readSegmentInit(seg *Segment, limits boxLimits) (*fmp4.Init, error) {
+	f, err := seg.open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return segmentFMP4ReadInit(f, limits)
+}
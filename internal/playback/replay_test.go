@@ -0,0 +1,310 @@
+package playback
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/bluenviron/mediamtx/internal/asyncwriter"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	init := fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec: &fmp4.CodecH264{
+				SPS: test.FormatH264.SPS,
+				PPS: test.FormatH264.PPS,
+			},
+		}},
+	}
+
+	var buf1 seekablebuffer.Buffer
+	err = init.Marshal(&buf1)
+	require.NoError(t, err)
+
+	var buf2 seekablebuffer.Buffer
+	parts := fmp4.Parts{{
+		SequenceNumber: 1,
+		Tracks: []*fmp4.PartTrack{{
+			ID:       1,
+			BaseTime: 0,
+			Samples: []*fmp4.PartSample{
+				{
+					Duration: 9000,
+					Payload:  []byte{0, 0, 0, 1, 5},
+				},
+				{
+					Duration:        9000,
+					IsNonSyncSample: true,
+					Payload:         []byte{0, 0, 0, 1, 1},
+				},
+			},
+		}},
+	}}
+	err = parts.Marshal(&buf2)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"),
+		append(buf1.Bytes(), buf2.Bytes()...), 0o644)
+	require.NoError(t, err)
+
+	r := &Replay{
+		PathConf: &conf.Path{
+			RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			PlaybackEnable: true,
+			RecordFormat:   conf.RecordFormatFMP4,
+		},
+		PathName:          "mypath",
+		UDPMaxPayloadSize: 1472,
+		Parent:            test.NilLogger,
+	}
+	err = r.Initialize()
+	require.NoError(t, err)
+	defer r.Close()
+
+	aw := asyncwriter.New(512, test.NilLogger)
+
+	recv := make(chan unit.Unit, 2)
+
+	r.Stream().AddReader(aw,
+		r.Stream().Desc().Medias[0],
+		r.Stream().Desc().Medias[0].Formats[0],
+		func(u unit.Unit) error {
+			recv <- u
+			return nil
+		})
+
+	aw.Start()
+	defer aw.Stop()
+
+	err = r.Play(time.Date(2008, 11, 7, 11, 22, 0, 500000000, time.Local), 0)
+	require.NoError(t, err)
+
+	u := <-recv
+	require.Equal(t, time.Date(2008, 11, 7, 11, 22, 0, 500000000, time.Local), u.GetNTP())
+	require.Equal(t, []byte{5}, u.(*unit.H264).AU[len(u.(*unit.H264).AU)-1])
+
+	u = <-recv
+	require.Equal(t, time.Date(2008, 11, 7, 11, 22, 0, 600000000, time.Local), u.GetNTP())
+	require.Equal(t, [][]byte{{1}}, u.(*unit.H264).AU)
+}
+
+func TestReplayNotAllowed(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = test.CreateRecording(filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	require.NoError(t, err)
+
+	pathConf := &conf.Path{
+		RecordPath:          filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat:        conf.RecordFormatFMP4,
+		PlaybackFormats:     conf.PlaybackFormats{"mp4"},
+		PlaybackMaxDuration: conf.StringDuration(10 * time.Second),
+	}
+
+	newReplay := func() (*Replay, error) {
+		r := &Replay{
+			PathConf:          pathConf,
+			PathName:          "mypath",
+			UDPMaxPayloadSize: 1472,
+			Parent:            test.NilLogger,
+		}
+		return r, r.Initialize()
+	}
+
+	var nerr NotAllowedError
+
+	_, err = newReplay()
+	require.ErrorAs(t, err, &nerr)
+
+	pathConf.PlaybackEnable = true
+	_, err = newReplay()
+	require.ErrorAs(t, err, &nerr)
+
+	pathConf.PlaybackFormats = conf.PlaybackFormats{"mp4", "replay"}
+	r, err := newReplay()
+	require.NoError(t, err)
+	defer r.Close()
+
+	err = r.Play(time.Date(2008, 11, 7, 11, 22, 0, 500000000, time.Local), 20*time.Second)
+	require.ErrorAs(t, err, &nerr)
+
+	// replays without end are limited to the maximum duration
+	err = r.Play(time.Date(2008, 11, 7, 11, 22, 0, 500000000, time.Local), 0)
+	require.NoError(t, err)
+	<-r.Done()
+	require.NoError(t, r.Err())
+}
+
+func TestReplayMaxLookback(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = test.CreateRecording(filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	require.NoError(t, err)
+
+	r := &Replay{
+		PathConf: &conf.Path{
+			RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			RecordFormat:   conf.RecordFormatFMP4,
+			PlaybackEnable: true,
+		},
+		PathName:          "mypath",
+		MaxLookback:       1 * time.Hour,
+		UDPMaxPayloadSize: 1472,
+		Parent:            test.NilLogger,
+	}
+	err = r.Initialize()
+	require.NoError(t, err)
+	defer r.Close()
+
+	var nerr NotAllowedError
+	err = r.Play(time.Date(2008, 11, 7, 11, 22, 0, 500000000, time.Local), time.Second)
+	require.ErrorAs(t, err, &nerr)
+
+	aw := asyncwriter.New(512, test.NilLogger)
+
+	recv := make(chan unit.Unit, 2)
+
+	r.Stream().AddReader(aw,
+		r.Stream().Desc().Medias[0],
+		r.Stream().Desc().Medias[0].Formats[0],
+		func(u unit.Unit) error {
+			recv <- u
+			return nil
+		})
+
+	aw.Start()
+	defer aw.Stop()
+
+	// the implicit start is moved to the limit, therefore older recordings are not played
+	err = r.Play(time.Time{}, 0)
+	require.NoError(t, err)
+	<-r.Done()
+	require.ErrorIs(t, r.Err(), errNoSegmentsFound)
+	require.Empty(t, recv)
+}
+
+func TestReplayBoxLimits(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = test.CreateRecording(filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	require.NoError(t, err)
+
+	r := &Replay{
+		PathConf: &conf.Path{
+			RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			RecordFormat:   conf.RecordFormatFMP4,
+			PlaybackEnable: true,
+		},
+		PathName:          "mypath",
+		UDPMaxPayloadSize: 1472,
+		BoxLimits:         BoxLimits{MaxSize: 8},
+		Parent:            test.NilLogger,
+	}
+	err = r.Initialize()
+	var lerr *boxLimitError
+	require.ErrorAs(t, err, &lerr)
+	require.Equal(t, "box size", lerr.Limit)
+}
+
+func TestReplayPrivacy(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = test.CreateRecording(filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	require.NoError(t, err)
+
+	registry := &record.Registry{}
+	registry.Initialize()
+
+	// the whole recording is hidden
+	registry.SetHiddenTimespans(map[string][]record.HiddenTimespan{
+		"mypath": {{
+			Start:    time.Date(2008, 11, 7, 11, 22, 0, 0, time.Local),
+			Duration: time.Minute,
+		}},
+	})
+
+	for _, privileged := range []bool{false, true} {
+		t.Run(strconv.FormatBool(privileged), func(t *testing.T) {
+			r := &Replay{
+				PathConf: &conf.Path{
+					RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+					RecordFormat:   conf.RecordFormatFMP4,
+					PlaybackEnable: true,
+				},
+				PathName:          "mypath",
+				Privileged:        privileged,
+				UDPMaxPayloadSize: 1472,
+				Registry:          registry,
+				Parent:            test.NilLogger,
+			}
+			err = r.Initialize()
+			require.NoError(t, err)
+			defer r.Close()
+
+			aw := asyncwriter.New(512, test.NilLogger)
+
+			recv := make(chan unit.Unit, 2)
+
+			r.Stream().AddReader(aw,
+				r.Stream().Desc().Medias[0],
+				r.Stream().Desc().Medias[0].Formats[0],
+				func(u unit.Unit) error {
+					recv <- u
+					return nil
+				})
+
+			aw.Start()
+			defer aw.Stop()
+
+			err = r.Play(time.Time{}, 0)
+			require.NoError(t, err)
+
+			if privileged {
+				u := <-recv
+				require.Equal(t, []byte{5}, u.(*unit.H264).AU[len(u.(*unit.H264).AU)-1])
+			} else {
+				<-r.Done()
+				require.Empty(t, recv)
+			}
+		})
+	}
+}
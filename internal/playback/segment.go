@@ -1,13 +1,17 @@
 package playback
 
 import (
+	"errors"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
 	"github.com/bluenviron/mediamtx/internal/record"
 )
 
@@ -15,59 +19,65 @@ import (
 type Segment struct {
 	Fpath string
 	Start time.Time
+
+	// storage in which the segment is placed. When nil, it is the local file system.
+	storage segmentStorage
+
+	// whether the segment has been moved into the archive.
+	archived bool
+
+	// discontinuity detected by the recorder at the start of the segment.
+	// It is available when segments are read from the index.
+	discontinuity record.Discontinuity
+}
+
+func (s *Segment) getStorage() segmentStorage {
+	if s.storage == nil {
+		return localStorage{}
+	}
+	return s.storage
 }
 
-func findSegmentsInTimespan(
+func (s *Segment) open() (segmentFile, error) {
+	return s.getStorage().Open(s.Fpath)
+}
+
+// Stat returns information about the segment.
+func (s *Segment) Stat() (fs.FileInfo, error) {
+	return s.getStorage().Stat(s.Fpath)
+}
+
+// isLocal checks whether the segment is in the local file system.
+func (s *Segment) isLocal() bool {
+	_, ok := s.getStorage().(localStorage)
+	return ok
+}
+
+func (c *segmentCache) findSegmentsInTimespan(
 	pathConf *conf.Path,
 	pathName string,
 	start time.Time,
 	duration time.Duration,
 ) ([]*Segment, error) {
-	recordPath := record.PathAddExtension(
-		strings.ReplaceAll(pathConf.RecordPath, "%path", pathName),
-		pathConf.RecordFormat,
-	)
-
-	// we have to convert to absolute paths
-	// otherwise, recordPath and fpath inside Walk() won't have common elements
-	recordPath, _ = filepath.Abs(recordPath)
+	allSegments, err := c.findSegments(pathConf, pathName)
+	if err != nil {
+		return nil, err
+	}
 
-	commonPath := record.CommonPath(recordPath)
 	end := start.Add(duration)
 	var segments []*Segment
 
-	err := filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() {
-			var pa record.Path
-			ok := pa.Decode(recordPath, fpath)
-
-			// gather all segments that starts before the end of the playback
-			if ok && !end.Before(pa.Start) {
-				segments = append(segments, &Segment{
-					Fpath: fpath,
-					Start: pa.Start,
-				})
-			}
+	// gather all segments that starts before the end of the playback
+	for _, seg := range allSegments {
+		if !end.Before(seg.Start) {
+			segments = append(segments, seg)
 		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
 
 	if segments == nil {
 		return nil, errNoSegmentsFound
 	}
 
-	sort.Slice(segments, func(i, j int) bool {
-		return segments[i].Start.Before(segments[j].Start)
-	})
-
 	// find the segment that may contain the start of the playback and remove all previous ones
 	found := false
 	for i := 0; i < len(segments)-1; i++ {
@@ -89,10 +99,146 @@ func findSegmentsInTimespan(
 	return segments, nil
 }
 
+// removeSegmentsBefore removes segments that start before a given date.
+func removeSegmentsBefore(segments []*Segment, limit time.Time) []*Segment {
+	if limit.IsZero() {
+		return segments
+	}
+
+	var out []*Segment
+	for _, seg := range segments {
+		if !seg.Start.Before(limit) {
+			out = append(out, seg)
+		}
+	}
+	return out
+}
+
 // FindSegments returns all segments of a path.
 func FindSegments(
 	pathConf *conf.Path,
 	pathName string,
+	registry *record.Registry,
+) ([]*Segment, error) {
+	var segments []*Segment
+	var err error
+
+	if pathConf.RecordIndexPath != "" {
+		segments, err = findSegmentsInIndex(pathConf, pathName, registry)
+	} else {
+		segments, err = FindSegmentFiles(pathConf, pathName, registry)
+	}
+
+	if pathConf.RecordArchiveTo == "" {
+		return segments, err
+	}
+
+	if err != nil && !errors.Is(err, errNoSegmentsFound) {
+		return nil, err
+	}
+
+	archived, err := findArchivedSegments(pathConf, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeSegments(segments, archived)
+}
+
+// archiveStorage returns the storage of an archive destination, and the root of the archive inside it.
+func archiveStorage(dest string) (segmentStorage, string, error) {
+	if !s3.IsURL(dest) {
+		root, _ := filepath.Abs(dest)
+		return localStorage{}, root, nil
+	}
+
+	client, err := s3.ParseURL(dest)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &s3Storage{client: client}, client.URL(client.Prefix), nil
+}
+
+// findArchivedSegments returns the segments of a path that have been moved
+// into the archive by the cleaner.
+func findArchivedSegments(
+	pathConf *conf.Path,
+	pathName string,
+) ([]*Segment, error) {
+	storage, root, err := archiveStorage(pathConf.RecordArchiveTo)
+	if err != nil {
+		return nil, err
+	}
+
+	// the archive has the same layout of the recording directory,
+	// starting from the first element that contains a variable.
+	recordPath := record.PathAddExtension(pathConf.RecordPath, pathConf.RecordFormat)
+	recordPath, _ = filepath.Abs(recordPath)
+	rel, _ := filepath.Rel(record.CommonPath(recordPath), recordPath)
+
+	var archivePath string
+	if _, ok := storage.(localStorage); ok {
+		archivePath = filepath.Join(root, rel)
+	} else {
+		archivePath = strings.TrimSuffix(root, "/") + "/" + filepath.ToSlash(rel)
+	}
+
+	archivePath = strings.ReplaceAll(archivePath, "%path", pathName)
+
+	var segments []*Segment
+
+	err = storage.List(record.CommonPath(archivePath), func(name string, _ fs.FileInfo) error {
+		var pa record.Path
+		if pa.Decode(archivePath, name) {
+			segments = append(segments, &Segment{
+				Fpath:    name,
+				Start:    pa.Start,
+				storage:  storage,
+				archived: true,
+			})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+// mergeSegments merges local and archived segments.
+// When a segment is in both places, the local copy is used.
+func mergeSegments(local []*Segment, archived []*Segment) ([]*Segment, error) {
+	starts := make(map[time.Time]struct{}, len(local))
+	for _, seg := range local {
+		starts[seg.Start.UTC()] = struct{}{}
+	}
+
+	segments := local
+	for _, seg := range archived {
+		if _, ok := starts[seg.Start.UTC()]; !ok {
+			segments = append(segments, seg)
+		}
+	}
+
+	if segments == nil {
+		return nil, errNoSegmentsFound
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Start.Before(segments[j].Start)
+	})
+
+	return segments, nil
+}
+
+// FindSegmentFiles returns all segments of a path that are in the recording directory,
+// without using the index.
+func FindSegmentFiles(
+	pathConf *conf.Path,
+	pathName string,
+	registry *record.Registry,
 ) ([]*Segment, error) {
 	recordPath := record.PathAddExtension(
 		strings.ReplaceAll(pathConf.RecordPath, "%path", pathName),
@@ -114,7 +260,9 @@ func FindSegments(
 		if !info.IsDir() {
 			var pa record.Path
 			ok := pa.Decode(recordPath, fpath)
-			if ok {
+
+			// skip segments whose header is still being written by the recorder
+			if ok && !registry.SegmentIsCreating(fpath) {
 				segments = append(segments, &Segment{
 					Fpath: fpath,
 					Start: pa.Start,
@@ -138,3 +286,100 @@ func FindSegments(
 
 	return segments, nil
 }
+
+// checkIndexLocations warns when the last segment of an index cannot be found.
+// Segments are stored in the index with their absolute path,
+// therefore all instances that share an index must reach segments at the same location.
+func checkIndexLocations(pathConfs map[string]*conf.Path, l logger.Writer) {
+	checked := make(map[string]struct{})
+
+	for _, pathConf := range pathConfs {
+		if pathConf.RecordIndexPath == "" {
+			continue
+		}
+
+		if _, ok := checked[pathConf.RecordIndexPath]; ok {
+			continue
+		}
+		checked[pathConf.RecordIndexPath] = struct{}{}
+
+		pathNames, err := record.IndexPathNames(pathConf.RecordIndexPath)
+		if err != nil {
+			continue
+		}
+
+		for _, pathName := range pathNames {
+			entry, ok, err := record.IndexLast(pathConf.RecordIndexPath, pathName)
+			if err != nil || !ok || entry.Removed {
+				continue
+			}
+
+			if _, err = os.Stat(entry.Path); errors.Is(err, os.ErrNotExist) {
+				l.Log(logger.Warn, "segment %s of path '%s' is in the index but doesn't exist. "+
+					"Segments must be reachable at the same location by all instances that share the index",
+					entry.Path, pathName)
+			}
+		}
+	}
+}
+
+func findSegmentsInIndex(
+	pathConf *conf.Path,
+	pathName string,
+	registry *record.Registry,
+) ([]*Segment, error) {
+	entries, err := record.IndexRead(pathConf.RecordIndexPath, pathName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// entries are mapped to segments through their path.
+	// when a segment has multiple entries, the last one is used.
+	last := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		last[entry.Path] = i
+	}
+
+	var segments []*Segment
+
+	for i, entry := range entries {
+		if last[entry.Path] != i {
+			continue
+		}
+
+		// segments are parsed with the format of the path
+		if entry.Format != nil && *entry.Format != pathConf.RecordFormat {
+			continue
+		}
+
+		// skip segments that have been deleted
+		if _, err := os.Stat(entry.Path); err == nil {
+			segments = append(segments, &Segment{
+				Fpath:         entry.Path,
+				Start:         entry.Start,
+				discontinuity: entry.Discontinuity,
+			})
+		}
+	}
+
+	// segments are added to the index when they are completed,
+	// therefore the segments that are being written are provided by the recorder.
+	for _, seg := range registry.OpenSegments(pathName) {
+		if _, ok := last[seg.Path]; !ok && seg.Format == pathConf.RecordFormat {
+			segments = append(segments, &Segment{
+				Fpath: seg.Path,
+				Start: seg.Start,
+			})
+		}
+	}
+
+	if segments == nil {
+		return nil, errNoSegmentsFound
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Start.Before(segments[j].Start)
+	})
+
+	return segments, nil
+}
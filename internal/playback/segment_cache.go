@@ -0,0 +1,110 @@
+package playback
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/record"
+)
+
+// maximum age of cached segment lists.
+// Changes performed by this process invalidate lists immediately,
+// while changes performed by other instances on a shared storage are detected after this period.
+const segmentCacheTTL = 5 * time.Second
+
+type segmentCacheKey struct {
+	pathName   string
+	recordPath string
+	format     conf.RecordFormat
+	indexPath  string
+	archiveTo  string
+}
+
+type segmentCacheEntry struct {
+	generation uint64
+	created    time.Time
+	segments   []*Segment
+	err        error
+}
+
+// segmentCache stores the segments of each path, in order to avoid walking
+// the recording directory or reading the index on every request.
+type segmentCache struct {
+	registry *record.Registry
+
+	mutex   sync.Mutex
+	entries map[segmentCacheKey]*segmentCacheEntry
+}
+
+func (c *segmentCache) initialize() {
+	c.entries = make(map[segmentCacheKey]*segmentCacheEntry)
+}
+
+// findSegments returns all segments of a path.
+func (c *segmentCache) findSegments(pathConf *conf.Path, pathName string) ([]*Segment, error) {
+	return c.find(pathConf, pathName, func() ([]*Segment, error) {
+		return FindSegments(pathConf, pathName, c.registry)
+	})
+}
+
+func (c *segmentCache) find(
+	pathConf *conf.Path,
+	pathName string,
+	load func() ([]*Segment, error),
+) ([]*Segment, error) {
+	key := segmentCacheKey{
+		pathName:   pathName,
+		recordPath: pathConf.RecordPath,
+		format:     pathConf.RecordFormat,
+		indexPath:  pathConf.RecordIndexPath,
+		archiveTo:  pathConf.RecordArchiveTo,
+	}
+
+	// the generation is read before loading segments,
+	// in order not to store lists that miss concurrent changes.
+	generation := c.registry.SegmentsGeneration(pathName)
+	now := time.Now()
+
+	c.mutex.Lock()
+	entry, ok := c.entries[key]
+	c.mutex.Unlock()
+
+	if !ok || entry.generation != generation || now.Sub(entry.created) >= segmentCacheTTL {
+		segs, err := load()
+
+		// unexpected errors are not cached
+		if err != nil && !errors.Is(err, errNoSegmentsFound) {
+			return nil, err
+		}
+
+		entry = &segmentCacheEntry{
+			generation: generation,
+			created:    now,
+			segments:   segs,
+			err:        err,
+		}
+
+		c.mutex.Lock()
+		c.prune(now)
+		c.entries[key] = entry
+		c.mutex.Unlock()
+	}
+
+	if entry.err != nil {
+		return nil, entry.err
+	}
+
+	// callers are allowed to modify the returned slice
+	return append([]*Segment(nil), entry.segments...), nil
+}
+
+// prune removes expired entries, in order not to keep entries of paths that are not requested anymore.
+func (c *segmentCache) prune(now time.Time) {
+	for key, entry := range c.entries {
+		if now.Sub(entry.created) >= segmentCacheTTL {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package playback
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentCache(t *testing.T) {
+	registry := &record.Registry{}
+	registry.Initialize()
+
+	c := &segmentCache{
+		registry: registry,
+	}
+	c.initialize()
+
+	pathConf := &conf.Path{
+		RecordPath:   "/tmp/cachetest/%path/%Y-%m-%d_%H-%M-%S-%f",
+		RecordFormat: conf.RecordFormatFMP4,
+	}
+
+	loads := 0
+	load := func() ([]*Segment, error) {
+		loads++
+		return []*Segment{{Start: time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC)}}, nil
+	}
+
+	segs, err := c.find(pathConf, "cachepath", load)
+	require.NoError(t, err)
+	require.Len(t, segs, 1)
+
+	// returned slices can be modified without affecting the cache
+	segs[0] = nil
+
+	segs, err = c.find(pathConf, "cachepath", load)
+	require.NoError(t, err)
+	require.NotNil(t, segs[0])
+	require.Equal(t, 1, loads)
+
+	registry.SegmentsChanged("cachepath")
+
+	_, err = c.find(pathConf, "cachepath", load)
+	require.NoError(t, err)
+	require.Equal(t, 2, loads)
+
+	// lists of other paths are not affected
+	registry.SegmentsChanged("otherpath")
+
+	_, err = c.find(pathConf, "cachepath", load)
+	require.NoError(t, err)
+	require.Equal(t, 2, loads)
+}
@@ -0,0 +1,89 @@
+package playback
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// fmp4CodecName returns the name of a codec, with the same names used by stream formats.
+func fmp4CodecName(codec fmp4.Codec) string {
+	switch codec.(type) {
+	case *fmp4.CodecAV1:
+		return "AV1"
+	case *fmp4.CodecVP9:
+		return "VP9"
+	case *fmp4.CodecH265:
+		return "H265"
+	case *fmp4.CodecH264:
+		return "H264"
+	case *fmp4.CodecMPEG4Video:
+		return "MPEG-4 Video"
+	case *fmp4.CodecMPEG1Video:
+		return "MPEG-1/2 Video"
+	case *fmp4.CodecMJPEG:
+		return "M-JPEG"
+	case *fmp4.CodecOpus:
+		return "Opus"
+	case *fmp4.CodecMPEG4Audio:
+		return "MPEG-4 Audio"
+	case *fmp4.CodecMPEG1Audio:
+		return "MPEG-1/2 Audio"
+	case *fmp4.CodecAC3:
+		return "AC-3"
+	case *fmp4.CodecLPCM:
+		return "LPCM"
+	}
+	return "unknown"
+}
+
+// SegmentDetails contains details of a segment that are read from its content.
+type SegmentDetails struct {
+	Duration time.Duration
+	Codecs   []string
+}
+
+// ReadSegmentDetails reads duration and codecs of a segment, with the default parsing limits.
+func ReadSegmentDetails(recordFormat conf.RecordFormat, seg *Segment) (*SegmentDetails, error) {
+	return readSegmentDetails(recordFormat, defaultBoxLimits, seg)
+}
+
+func readSegmentDetails(recordFormat conf.RecordFormat, limits boxLimits, seg *Segment) (*SegmentDetails, error) {
+	if recordFormat != conf.RecordFormatFMP4 {
+		return nil, fmt.Errorf("MPEG-TS format is not supported yet")
+	}
+
+	f, err := seg.open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	init, err := segmentFMP4ReadInit(f, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := segmentFMP4ReadMaxDuration(f, limits, init)
+	if err != nil {
+		return nil, err
+	}
+
+	codecs := make([]string, len(init.Tracks))
+	for i, track := range init.Tracks {
+		codecs[i] = fmp4CodecName(track.Codec)
+	}
+
+	return &SegmentDetails{
+		Duration: duration,
+		Codecs:   codecs,
+	}, nil
+}
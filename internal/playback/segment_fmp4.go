@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 	"time"
 
 	"github.com/abema/go-mp4"
@@ -59,7 +60,7 @@ func segmentFMP4CanBeConcatenated(
 		!curStart.After(prevEnd.Add(concatenationTolerance))
 }
 
-func segmentFMP4ReadInit(r io.ReadSeeker) (*fmp4.Init, error) {
+func segmentFMP4ReadInit(r io.ReadSeeker, limits boxLimits) (*fmp4.Init, error) {
 	buf := make([]byte, 8)
 	_, err := io.ReadFull(r, buf)
 	if err != nil {
@@ -72,7 +73,10 @@ func segmentFMP4ReadInit(r io.ReadSeeker) (*fmp4.Init, error) {
 		return nil, fmt.Errorf("ftyp box not found")
 	}
 
-	ftypSize := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+	ftypSize, err := headerBoxSize(r, limits, buf)
+	if err != nil {
+		return nil, err
+	}
 
 	_, err = r.Seek(int64(ftypSize), io.SeekStart)
 	if err != nil {
@@ -90,7 +94,10 @@ func segmentFMP4ReadInit(r io.ReadSeeker) (*fmp4.Init, error) {
 		return nil, fmt.Errorf("moov box not found")
 	}
 
-	moovSize := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+	moovSize, err := headerBoxSize(r, limits, buf)
+	if err != nil {
+		return nil, err
+	}
 
 	_, err = r.Seek(0, io.SeekStart)
 	if err != nil {
@@ -110,11 +117,18 @@ func segmentFMP4ReadInit(r io.ReadSeeker) (*fmp4.Init, error) {
 		return nil, err
 	}
 
+	// sort tracks by ID, in order to generate the same output
+	// regardless of the order in which tracks were written.
+	sort.SliceStable(init.Tracks, func(i, j int) bool {
+		return init.Tracks[i].ID < init.Tracks[j].ID
+	})
+
 	return &init, nil
 }
 
 func segmentFMP4ReadMaxDuration(
 	r io.ReadSeeker,
+	limits boxLimits,
 	init *fmp4.Init,
 ) (time.Duration, error) {
 	// find and skip ftyp
@@ -129,7 +143,10 @@ func segmentFMP4ReadMaxDuration(
 		return 0, fmt.Errorf("ftyp box not found")
 	}
 
-	ftypSize := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+	ftypSize, err := headerBoxSize(r, limits, buf)
+	if err != nil {
+		return 0, err
+	}
 
 	_, err = r.Seek(int64(ftypSize), io.SeekStart)
 	if err != nil {
@@ -147,7 +164,10 @@ func segmentFMP4ReadMaxDuration(
 		return 0, fmt.Errorf("moov box not found")
 	}
 
-	moovSize := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+	moovSize, err := headerBoxSize(r, limits, buf)
+	if err != nil {
+		return 0, err
+	}
 
 	_, err = r.Seek(int64(moovSize)-8, io.SeekCurrent)
 	if err != nil {
@@ -174,7 +194,11 @@ func segmentFMP4ReadMaxDuration(
 			return 0, fmt.Errorf("moof box not found")
 		}
 
-		moofSize := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+		var moofSize uint32
+		moofSize, err = headerBoxSize(r, limits, buf)
+		if err != nil {
+			return 0, err
+		}
 
 		_, err = r.Seek(int64(moofSize)-8, io.SeekCurrent)
 		if err != nil {
@@ -190,7 +214,11 @@ func segmentFMP4ReadMaxDuration(
 			return 0, fmt.Errorf("mdat box not found")
 		}
 
-		mdatSize := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+		var mdatSize uint32
+		mdatSize, err = headerBoxSize(r, limits, buf)
+		if err != nil {
+			return 0, err
+		}
 
 		_, err = r.Seek(int64(mdatSize)-8, io.SeekCurrent)
 		if err != nil {
@@ -255,7 +283,10 @@ func segmentFMP4ReadMaxDuration(
 			return 0, fmt.Errorf("tfhd box not found")
 		}
 
-		tfhdSize := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+		tfhdSize, err := headerBoxSize(r, limits, buf)
+		if err != nil {
+			return 0, err
+		}
 
 		buf2 := make([]byte, tfhdSize-8)
 
@@ -286,7 +317,10 @@ func segmentFMP4ReadMaxDuration(
 			return 0, fmt.Errorf("tfdt box not found")
 		}
 
-		tfdtSize := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+		tfdtSize, err := headerBoxSize(r, limits, buf)
+		if err != nil {
+			return 0, err
+		}
 
 		buf2 = make([]byte, tfdtSize-8)
 
@@ -312,7 +346,10 @@ func segmentFMP4ReadMaxDuration(
 			return 0, fmt.Errorf("trun box not found")
 		}
 
-		trunSize := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+		trunSize, err := headerBoxSize(r, limits, buf)
+		if err != nil {
+			return 0, err
+		}
 
 		buf2 = make([]byte, trunSize-8)
 
@@ -345,6 +382,7 @@ func segmentFMP4ReadMaxDuration(
 
 func segmentFMP4SeekAndMuxParts(
 	r readSeekerAt,
+	limits boxLimits,
 	segmentStartOffset time.Duration,
 	duration time.Duration,
 	init *fmp4.Init,
@@ -360,7 +398,7 @@ func segmentFMP4SeekAndMuxParts(
 	var maxMuxerDTS time.Duration
 	breakAtNextMdat := false
 
-	_, err := mp4.ReadBoxStructure(r, func(h *mp4.ReadHandle) (interface{}, error) {
+	err := readBoxStructure(r, limits, func(h *mp4.ReadHandle) (interface{}, error) {
 		switch h.BoxInfo.Type.String() {
 		case "moof":
 			moofOffset = h.BoxInfo.Offset
@@ -423,6 +461,11 @@ func segmentFMP4SeekAndMuxParts(
 					(e.SampleFlags&sampleFlagIsNonSyncSample) != 0,
 					e.SampleSize,
 					func() ([]byte, error) {
+						err2 := checkBoxSize(limits, "sample size", uint64(sampleSize), sampleOffset)
+						if err2 != nil {
+							return nil, err2
+						}
+
 						payload := make([]byte, sampleSize)
 						n, err2 := r.ReadAt(payload, int64(sampleOffset))
 						if err2 != nil {
@@ -474,6 +517,7 @@ func segmentFMP4SeekAndMuxParts(
 
 func segmentFMP4MuxParts(
 	r readSeekerAt,
+	limits boxLimits,
 	segmentStartOffset time.Duration,
 	duration time.Duration,
 	init *fmp4.Init,
@@ -488,7 +532,7 @@ func segmentFMP4MuxParts(
 	var maxMuxerDTS time.Duration
 	breakAtNextMdat := false
 
-	_, err := mp4.ReadBoxStructure(r, func(h *mp4.ReadHandle) (interface{}, error) {
+	err := readBoxStructure(r, limits, func(h *mp4.ReadHandle) (interface{}, error) {
 		switch h.BoxInfo.Type.String() {
 		case "moof":
 			moofOffset = h.BoxInfo.Offset
@@ -547,6 +591,11 @@ func segmentFMP4MuxParts(
 					(e.SampleFlags&sampleFlagIsNonSyncSample) != 0,
 					e.SampleSize,
 					func() ([]byte, error) {
+						err2 := checkBoxSize(limits, "sample size", uint64(sampleSize), sampleOffset)
+						if err2 != nil {
+							return nil, err2
+						}
+
 						payload := make([]byte, sampleSize)
 						n, err2 := r.ReadAt(payload, int64(sampleOffset))
 						if err2 != nil {
@@ -591,3 +640,219 @@ func segmentFMP4MuxParts(
 
 	return maxMuxerDTS, nil
 }
+
+// segmentFMP4Fragment is a moof box and its mdat box.
+type segmentFMP4Fragment struct {
+	offset int64
+	size   int64
+	// minimum decode timestamp of tracks, relative to the start of the segment
+	dts time.Duration
+}
+
+// segmentFMP4ReadFragments returns position and timestamp of all fragments of a segment.
+func segmentFMP4ReadFragments(
+	r io.ReadSeeker,
+	limits boxLimits,
+	init *fmp4.Init,
+) ([]segmentFMP4Fragment, error) {
+	var fragments []segmentFMP4Fragment
+	var cur *segmentFMP4Fragment
+	var curTrack *fmp4.InitTrack
+
+	err := readBoxStructure(r, limits, func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moof":
+			cur = &segmentFMP4Fragment{
+				offset: int64(h.BoxInfo.Offset),
+				dts:    -1,
+			}
+			return h.Expand()
+
+		case "traf":
+			if cur == nil {
+				return nil, fmt.Errorf("unexpected traf box")
+			}
+			return h.Expand()
+
+		case "tfhd":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			tfhd := box.(*mp4.Tfhd)
+
+			curTrack = findInitTrack(init.Tracks, int(tfhd.TrackID))
+			if curTrack == nil {
+				return nil, fmt.Errorf("invalid track ID: %v", tfhd.TrackID)
+			}
+
+		case "tfdt":
+			if curTrack == nil {
+				return nil, fmt.Errorf("unexpected tfdt box")
+			}
+
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			tfdt := box.(*mp4.Tfdt)
+
+			dts := durationMp4ToGo(int64(tfdt.BaseMediaDecodeTimeV1), curTrack.TimeScale)
+			if cur.dts < 0 || dts < cur.dts {
+				cur.dts = dts
+			}
+
+		case "mdat":
+			if cur == nil {
+				return nil, fmt.Errorf("unexpected mdat box")
+			}
+
+			cur.size = int64(h.BoxInfo.Offset+h.BoxInfo.Size) - cur.offset
+			if cur.dts >= 0 {
+				fragments = append(fragments, *cur)
+			}
+			cur = nil
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fragments, nil
+}
+
+// segmentFMP4ReadSampleSizes calls cb with decode timestamp and size of every sample of a segment.
+// Timestamps are relative to the start of the segment.
+func segmentFMP4ReadSampleSizes(
+	r io.ReadSeeker,
+	limits boxLimits,
+	init *fmp4.Init,
+	cb func(dts time.Duration, size uint32),
+) error {
+	var tfhd *mp4.Tfhd
+	var track *fmp4.InitTrack
+	var baseTime int64
+
+	err := readBoxStructure(r, limits, func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moof", "traf":
+			return h.Expand()
+
+		case "tfhd":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			tfhd = box.(*mp4.Tfhd)
+
+			track = findInitTrack(init.Tracks, int(tfhd.TrackID))
+			if track == nil {
+				return nil, fmt.Errorf("invalid track ID: %v", tfhd.TrackID)
+			}
+
+		case "tfdt":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			baseTime = int64(box.(*mp4.Tfdt).BaseMediaDecodeTimeV1)
+
+		case "trun":
+			if track == nil {
+				return nil, fmt.Errorf("unexpected trun box")
+			}
+
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			trun := box.(*mp4.Trun)
+
+			flags := trun.GetFlags()
+			dts := baseTime
+
+			for _, entry := range trun.Entries {
+				size := entry.SampleSize
+				if (flags & 0x200) == 0 {
+					size = tfhd.DefaultSampleSize
+				}
+
+				duration := entry.SampleDuration
+				if (flags & 0x100) == 0 {
+					duration = tfhd.DefaultSampleDuration
+				}
+
+				cb(durationMp4ToGo(dts, track.TimeScale), size)
+				dts += int64(duration)
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// segmentFMP4ReadKeyframes calls cb with the decode timestamp of every sync sample of a track.
+// Timestamps are relative to the start of the segment.
+func segmentFMP4ReadKeyframes(
+	r io.ReadSeeker,
+	limits boxLimits,
+	init *fmp4.Init,
+	trackID int,
+	cb func(dts time.Duration),
+) error {
+	var track *fmp4.InitTrack
+	var baseTime int64
+
+	err := readBoxStructure(r, limits, func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moof", "traf":
+			return h.Expand()
+
+		case "tfhd":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			tfhd := box.(*mp4.Tfhd)
+
+			track = findInitTrack(init.Tracks, int(tfhd.TrackID))
+			if track == nil {
+				return nil, fmt.Errorf("invalid track ID: %v", tfhd.TrackID)
+			}
+
+		case "tfdt":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			baseTime = int64(box.(*mp4.Tfdt).BaseMediaDecodeTimeV1)
+
+		case "trun":
+			if track == nil {
+				return nil, fmt.Errorf("unexpected trun box")
+			}
+
+			if track.ID != trackID {
+				return nil, nil
+			}
+
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			trun := box.(*mp4.Trun)
+
+			dts := baseTime
+
+			for _, entry := range trun.Entries {
+				if (entry.SampleFlags & sampleFlagIsNonSyncSample) == 0 {
+					cb(durationMp4ToGo(dts, track.TimeScale))
+				}
+				dts += int64(entry.SampleDuration)
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
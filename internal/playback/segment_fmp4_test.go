@@ -1,13 +1,17 @@
 package playback
 
 import (
+	"bytes"
 	"io"
 	"os"
+	"strconv"
 	"testing"
 
 	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
 	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
 	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
 )
 
 func writeBenchInit(f io.WriteSeeker) {
@@ -66,10 +70,68 @@ func BenchmarkFMP4ReadInit(b *testing.B) {
 			}
 			defer f.Close()
 
-			_, err = segmentFMP4ReadInit(f)
+			_, err = segmentFMP4ReadInit(f, defaultBoxLimits)
 			if err != nil {
 				panic(err)
 			}
 		}()
 	}
 }
+
+func TestSegmentFMP4Limits(t *testing.T) {
+	init := &fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec: &fmp4.CodecH264{
+				SPS: test.FormatH264.SPS,
+				PPS: test.FormatH264.PPS,
+			},
+		}},
+	}
+
+	var buf seekablebuffer.Buffer
+	err := init.Marshal(&buf)
+	require.NoError(t, err)
+
+	parts := fmp4.Parts{{
+		SequenceNumber: 1,
+		Tracks: []*fmp4.PartTrack{{
+			ID: 1,
+			Samples: []*fmp4.PartSample{{
+				Duration: 90000,
+				Payload:  []byte{1, 2},
+			}},
+		}},
+	}}
+	err = parts.Marshal(&buf)
+	require.NoError(t, err)
+
+	valid := buf.Bytes()
+
+	t.Run("invalid size", func(t *testing.T) {
+		corrupted := append(append([]byte{}, valid...), 0x00, 0x00, 0x00, 0x00, 'm', 'o', 'o', 'f')
+
+		_, err2 := segmentFMP4ReadMaxDuration(bytes.NewReader(corrupted), defaultBoxLimits, init)
+		require.EqualError(t, err2, "invalid size of box moof at offset "+
+			strconv.Itoa(len(valid))+": 0")
+	})
+
+	for _, ca := range []struct {
+		name   string
+		limits boxLimits
+		limit  string
+	}{
+		{"size", boxLimits{maxSize: 100}, "box size"},
+		{"count", boxLimits{maxCount: 2}, "box count"},
+		{"depth", boxLimits{maxDepth: 1}, "box depth"},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err2 := segmentFMP4ReadFragments(bytes.NewReader(valid), ca.limits, init)
+
+			var limitErr *boxLimitError
+			require.ErrorAs(t, err2, &limitErr)
+			require.Equal(t, ca.limit, limitErr.Limit)
+		})
+	}
+}
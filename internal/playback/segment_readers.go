@@ -0,0 +1,17 @@
+package playback
+
+import (
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// acquireReader waits until the recordings of a path can be read.
+// Slots are shared with maintenance routines and replays through the registry.
+// It fails when the request is canceled while waiting.
+func (p *Server) acquireReader(ctx *gin.Context, pathConf *conf.Path, pathName string) (func(), bool) {
+	release, err := p.Registry.AcquireReader(ctx.Request.Context(), pathName, pathConf.PlaybackMaxReaders)
+	if err != nil {
+		return nil, false
+	}
+	return release, true
+}
@@ -0,0 +1,78 @@
+package playback
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderLimit(t *testing.T) {
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.Local)
+
+	tr := newHarnessTree(t, "mypath", []harnessSegment{{
+		Start:           start,
+		Codecs:          []string{"H264"},
+		Fragments:       5,
+		FragmentSamples: 2,
+	}})
+	tr.conf.PlaybackMaxReaders = 1
+	tr.serve(t)
+
+	for _, ca := range []struct {
+		name   string
+		method string
+		path   string
+		query  map[string]string
+	}{
+		{"dry run", http.MethodGet, "/get", map[string]string{
+			"start": start.Format(time.RFC3339Nano), "duration": "2", "dryRun": "true",
+		}},
+		{"head", http.MethodHead, "/get", map[string]string{
+			"start": start.Format(time.RFC3339Nano), "duration": "2",
+		}},
+		{"timeline", http.MethodGet, "/timeline", map[string]string{
+			"start": start.Format(time.RFC3339), "end": start.Add(10 * time.Second).Format(time.RFC3339),
+		}},
+		{"map", http.MethodGet, "/map", map[string]string{
+			"time": start.Add(500 * time.Millisecond).Format(time.RFC3339Nano),
+		}},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			release, err := tr.registry.AcquireReader(context.Background(), "mypath", 1)
+			require.NoError(t, err)
+
+			v := url.Values{}
+			v.Set("path", "mypath")
+			for k, val := range ca.query {
+				v.Set(k, val)
+			}
+
+			done := make(chan int)
+
+			go func() {
+				req, err2 := http.NewRequest(ca.method, "http://localhost:9996"+ca.path+"?"+v.Encode(), nil)
+				require.NoError(t, err2)
+
+				res, err2 := http.DefaultClient.Do(req)
+				require.NoError(t, err2)
+				res.Body.Close()
+
+				done <- res.StatusCode
+			}()
+
+			select {
+			case <-done:
+				t.Fatal("should not happen")
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			release()
+
+			require.Equal(t, http.StatusOK, <-done)
+		})
+	}
+}
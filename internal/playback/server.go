@@ -3,52 +3,206 @@ package playback
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/auth"
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
 	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
 	"github.com/gin-gonic/gin"
 )
 
 var errNoSegmentsFound = errors.New("no recording segments found")
 
+var errMaintenanceMode = errors.New("server is in maintenance mode")
+
 type serverAuthManager interface {
 	Authenticate(req *auth.Request) error
 }
 
 // Server is the playback server.
 type Server struct {
-	Address        string
-	Encryption     bool
-	ServerKey      string
-	ServerCert     string
-	AllowOrigin    string
-	TrustedProxies conf.IPNetworks
-	ReadTimeout    conf.StringDuration
-	PathConfs      map[string]*conf.Path
-	AuthManager    serverAuthManager
-	Parent         logger.Writer
+	Address                string
+	Encryption             bool
+	ServerKey              string
+	ServerCert             string
+	AllowOrigin            string
+	TrustedProxies         conf.IPNetworks
+	Peers                  []string
+	ExportPath             string
+	ExportSigningKey       string
+	ShareLinksFile         string
+	PrivacyFile            string
+	AnnotationsFile        string
+	DailyQuota             conf.StringSize
+	MonthlyQuota           conf.StringSize
+	HLSEncryption          bool
+	Headers                conf.HTTPHeaders
+	TempDir                string
+	MemoryLimit            conf.StringSize
+	MaxImportSize          conf.StringSize
+	MaxConcurrentDownloads int
+	MaxConcurrentMuxers    int
+	MaxBoxDepth            int
+	MaxBoxCount            int
+	MaxBoxSize             conf.StringSize
+	Priorities             conf.PlaybackPriorities
+	ExportSchedules        conf.PlaybackExportSchedules
+	AccessLogLevel         conf.LogLevel
+	ReadTimeout            conf.StringDuration
+	MaintenanceMode        bool
+	PathConfs              map[string]*conf.Path
+	AuthManager            serverAuthManager
+	Registry               *record.Registry
+	Notifier               *notify.Notifier
+	Parent                 logger.Writer
 
-	httpServer *httpp.WrappedServer
-	mutex      sync.RWMutex
+	httpServer   *httpp.WrappedServer
+	peerClient   *http.Client
+	exports      *exportManager
+	boxLimits    boxLimits
+	segmentCache *segmentCache
+	sizeCache    *sizeCache
+	shareLinks   *shareLinkManager
+	quotas       *quotaManager
+	privacy      *privacyManager
+	annotations  *annotationManager
+	hlsSessions  *hlsSessionManager
+	progress     *progressManager
+	stats        *serverStats
+	limiter      *downloadLimiter
+	muxers       *muxLimiter
+	mutex        sync.RWMutex
 }
 
 // Initialize initializes Server.
 func (s *Server) Initialize() error {
+	s.boxLimits = boxLimits{
+		maxDepth: s.MaxBoxDepth,
+		maxCount: s.MaxBoxCount,
+		maxSize:  uint64(s.MaxBoxSize),
+	}
+
+	s.segmentCache = &segmentCache{
+		registry: s.Registry,
+	}
+	s.segmentCache.initialize()
+
+	s.sizeCache = &sizeCache{}
+	s.sizeCache.initialize()
+
+	checkIndexLocations(s.PathConfs, s)
+
+	if s.DailyQuota != 0 || s.MonthlyQuota != 0 {
+		s.quotas = &quotaManager{
+			daily:   uint64(s.DailyQuota),
+			monthly: uint64(s.MonthlyQuota),
+		}
+		s.quotas.initialize()
+	}
+
+	if s.MaxConcurrentDownloads != 0 {
+		s.limiter = &downloadLimiter{
+			max: s.MaxConcurrentDownloads,
+		}
+	}
+
+	s.muxers = &muxLimiter{
+		max: s.MaxConcurrentMuxers,
+	}
+	s.muxers.initialize()
+
+	if s.PrivacyFile != "" {
+		s.privacy = &privacyManager{
+			filePath: s.PrivacyFile,
+			registry: s.Registry,
+		}
+		err := s.privacy.initialize()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.AnnotationsFile != "" {
+		s.annotations = &annotationManager{
+			filePath: s.AnnotationsFile,
+		}
+		err := s.annotations.initialize()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.hlsSessions = &hlsSessionManager{}
+	s.hlsSessions.initialize()
+
+	s.progress = &progressManager{}
+	s.progress.initialize()
+
+	s.stats = &serverStats{}
+	s.stats.initialize()
+
+	if s.ExportPath != "" {
+		s.exports = &exportManager{
+			path:      s.ExportPath,
+			schedules: s.ExportSchedules,
+			parent:    s,
+		}
+
+		if s.ExportSigningKey != "" {
+			var err error
+			s.exports.signingKey, err = loadExportSigningKey(s.ExportSigningKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := s.exports.initialize()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.ShareLinksFile != "" {
+		s.shareLinks = &shareLinkManager{
+			filePath: s.ShareLinksFile,
+		}
+		err := s.shareLinks.initialize()
+		if err != nil {
+			if s.exports != nil {
+				s.exports.close()
+			}
+			return err
+		}
+	}
+
 	router := gin.New()
 	router.SetTrustedProxies(s.TrustedProxies.ToTrustedProxies()) //nolint:errcheck
 
 	router.NoRoute(s.middlewareOrigin)
-	group := router.Group("/", s.middlewareOrigin)
 
-	group.GET("/list", s.onList)
-	group.GET("/get", s.onGet)
+	// versioned routes have a stable contract.
+	// unversioned routes are kept for compatibility.
+	s.registerRoutes(router.Group("/v1", s.middlewareAccessLog, s.middlewareOrigin, s.middlewareStats,
+		s.middlewareCompress, setAPIVersion))
+	s.registerRoutes(router.Group("/", s.middlewareAccessLog, s.middlewareOrigin, s.middlewareStats,
+		s.middlewareCompress))
+
+	s.peerClient = &http.Client{
+		Transport: &http.Transport{
+			ResponseHeaderTimeout: time.Duration(s.ReadTimeout),
+		},
+	}
 
 	network, address := restrictnetwork.Restrict("tcp", s.Address)
 
@@ -64,6 +218,9 @@ func (s *Server) Initialize() error {
 	}
 	err := s.httpServer.Initialize()
 	if err != nil {
+		if s.exports != nil {
+			s.exports.close()
+		}
 		return err
 	}
 
@@ -72,10 +229,90 @@ func (s *Server) Initialize() error {
 	return nil
 }
 
+func (s *Server) registerRoutes(group *gin.RouterGroup) {
+	// routes that download recordings
+	downloads := group.Group("/")
+
+	if s.quotas != nil {
+		downloads.Use(s.middlewareQuota)
+		group.GET("/usage", s.onUsage)
+	}
+
+	if s.limiter != nil {
+		downloads.Use(s.middlewareLimiter)
+	}
+
+	if s.privacy != nil {
+		group.POST("/privacy", s.onPrivacyAdd)
+		group.GET("/privacy", s.onPrivacyList)
+		group.DELETE("/privacy/:id", s.onPrivacyDelete)
+	}
+
+	if s.annotations != nil {
+		group.POST("/annotations", s.onAnnotationsAdd)
+		group.GET("/annotations", s.onAnnotationsList)
+		group.POST("/annotations/import", s.onAnnotationsImport)
+		group.DELETE("/annotations/:id", s.onAnnotationsDelete)
+	}
+
+	group.GET("/list", s.onList)
+	group.GET("/timeline", s.onTimeline)
+	group.GET("/url", s.onURL)
+	downloads.GET("/get", s.onGet)
+	downloads.HEAD("/get", s.onGet)
+	group.GET("/get/progress", s.onGetProgress)
+	group.POST("/import", s.onImport)
+	group.DELETE("/delete", s.onDelete)
+	group.GET("/paths", s.onPaths)
+	group.GET("/browse", s.onBrowse)
+	group.GET("/ui", s.onUI)
+	group.POST("/motion", s.onMotionAdd)
+	group.GET("/motion", s.onMotionList)
+	group.GET("/motion/next", s.onMotionNext)
+	group.GET("/map", s.onMap)
+	group.GET("/keyframe", s.onKeyframe)
+	group.GET("/bitrate", s.onBitrate)
+	downloads.GET("/archive", s.onArchive)
+
+	group.GET("/hls/index.m3u8", s.onHLSPlaylist)
+	group.GET("/hls/iframes.m3u8", s.onHLSIFramesPlaylist)
+	group.GET("/hls/key", s.onHLSKey)
+	downloads.GET("/hls/init.mp4", s.onHLSInit)
+	downloads.GET("/hls/segment.m4s", s.onHLSSegment)
+	downloads.GET("/hls/iframe.m4s", s.onHLSIFrame)
+
+	if s.exports != nil {
+		group.POST("/exports", s.onExportsAdd)
+		group.GET("/exports/:id", s.onExportsGet)
+		downloads.GET("/exports/:id/download", s.onExportsDownload)
+		group.GET("/exports/:id/signature", s.onExportsSignature)
+		group.GET("/exports/:id/custody", s.onExportsCustody)
+		group.GET("/exports/:id/key", s.onExportsKey)
+		group.POST("/exports/:id/key", s.onExportsKey)
+	}
+
+	if s.shareLinks != nil {
+		group.POST("/sharelinks", s.onShareLinksAdd)
+		group.GET("/sharelinks", s.onShareLinksList)
+		group.GET("/sharelinks/:id", s.onShareLinksGet)
+		group.PATCH("/sharelinks/:id", s.onShareLinksPatch)
+		group.DELETE("/sharelinks/:id", s.onShareLinksDelete)
+		downloads.GET("/share/:id", s.onShare)
+	}
+}
+
 // Close closes Server.
 func (s *Server) Close() {
 	s.Log(logger.Info, "listener is closing")
 	s.httpServer.Close()
+	s.peerClient.CloseIdleConnections()
+
+	if s.exports != nil {
+		s.exports.close()
+	}
+
+	// privacy intervals are not available anymore
+	s.Registry.SetHiddenTimespans(nil)
 }
 
 // Log implements logger.Writer.
@@ -90,12 +327,45 @@ func (s *Server) ReloadPathConfs(pathConfs map[string]*conf.Path) {
 	s.PathConfs = pathConfs
 }
 
+// ReloadMaintenanceMode is called by core.Core.
+func (s *Server) ReloadMaintenanceMode(maintenanceMode bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.MaintenanceMode = maintenanceMode
+}
+
+// inMaintenanceMode checks whether operations that write or delete files must be rejected.
+func (s *Server) inMaintenanceMode() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.MaintenanceMode
+}
+
+func setAPIVersion(ctx *gin.Context) {
+	ctx.Set("apiVersion", "v1")
+}
+
+// routePrefix returns the prefix of the route in use,
+// in order to generate URLs that use the same API version of the request.
+func routePrefix(ctx *gin.Context) string {
+	if ctx.GetString("apiVersion") == "v1" {
+		return "/v1"
+	}
+	return ""
+}
+
 func (s *Server) writeError(ctx *gin.Context, status int, err error) {
 	// show error in logs
 	s.Log(logger.Error, err.Error())
 
 	// add error to response
-	ctx.String(status, err.Error())
+	if ctx.GetString("apiVersion") == "v1" {
+		ctx.JSON(status, &defs.APIError{
+			Error: err.Error(),
+		})
+	} else {
+		ctx.String(status, err.Error())
+	}
 }
 
 func (s *Server) safeFindPathConf(name string) (*conf.Path, error) {
@@ -106,31 +376,156 @@ func (s *Server) safeFindPathConf(name string) (*conf.Path, error) {
 	return pathConf, err
 }
 
+// playbackFormat returns the name of a download format in the playbackFormats parameter.
+func playbackFormat(format string) string {
+	if format == "" {
+		return "fmp4"
+	}
+	return format
+}
+
+// formatContentType returns the MIME type of a download format.
+func formatContentType(format string) string {
+	switch format {
+	case "ts":
+		return "video/mp2t"
+
+	case "mkv":
+		return "video/x-matroska"
+	}
+	return "video/mp4"
+}
+
+// NotAllowedError is returned when a request is not allowed by the playback settings of a path.
+type NotAllowedError struct {
+	Message string
+}
+
+// Error implements the error interface.
+func (e NotAllowedError) Error() string {
+	return e.Message
+}
+
+// checkPlayback checks whether recordings of a path can be served in the given format and timespan.
+// An empty format only checks whether playback is enabled.
+func checkPlayback(pathConf *conf.Path, format string, duration time.Duration) error {
+	if !pathConf.PlaybackEnable {
+		return NotAllowedError{"playback is disabled on this path"}
+	}
+
+	if format != "" && !pathConf.PlaybackFormats.Contains(format) {
+		return NotAllowedError{fmt.Sprintf("format '%s' is not allowed on this path", format)}
+	}
+
+	if pathConf.PlaybackMaxDuration != 0 && duration > time.Duration(pathConf.PlaybackMaxDuration) {
+		return NotAllowedError{fmt.Sprintf("duration exceeds the maximum of %v", time.Duration(pathConf.PlaybackMaxDuration))}
+	}
+
+	return nil
+}
+
 func (s *Server) middlewareOrigin(ctx *gin.Context) {
+	for k, v := range s.Headers {
+		ctx.Writer.Header().Set(k, v)
+	}
+
 	ctx.Writer.Header().Set("Access-Control-Allow-Origin", s.AllowOrigin)
 	ctx.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
 	// preflight requests
 	if ctx.Request.Method == http.MethodOptions &&
 		ctx.Request.Header.Get("Access-Control-Request-Method") != "" {
-		ctx.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET")
-		ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization")
+		ctx.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PATCH, DELETE")
+		ctx.Writer.Header().Set("Access-Control-Allow-Headers",
+			"Authorization, Idempotency-Key, Range, If-Range, If-None-Match, If-Modified-Since")
 		ctx.AbortWithStatus(http.StatusNoContent)
 		return
 	}
 }
 
-func (s *Server) doAuth(ctx *gin.Context, pathName string) bool {
+// windowFinished checks whether a window is entirely in the past.
+// end is the end of the window, or zero when the response is not bound to a window.
+func windowFinished(pathConf *conf.Path, end time.Time) bool {
+	// the window may still change until the part that contains its end has been written
+	return !end.IsZero() && time.Since(end) >= time.Duration(pathConf.RecordPartDuration)
+}
+
+// pathHeaders returns the additional headers of responses that contain recordings of a path.
+// end is the end of the requested window, or zero when the response is not bound to a window.
+func pathHeaders(pathConf *conf.Path, end time.Time) map[string]string {
+	out := make(map[string]string)
+
+	for k, v := range pathConf.PlaybackHeaders {
+		out[k] = v
+	}
+
+	if !windowFinished(pathConf, end) {
+		for k, v := range pathConf.PlaybackRecentHeaders {
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+func hasHeader(headers map[string]string, key string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeHeaders(ctx *gin.Context, headers map[string]string) {
+	for k, v := range headers {
+		ctx.Header(k, v)
+	}
+}
+
+func addJWTFromAuthorization(rawQuery string, auth string) string {
+	jwt := strings.TrimPrefix(auth, "Bearer ")
+	if rawQuery != "" {
+		if v, err := url.ParseQuery(rawQuery); err == nil && v.Get("jwt") == "" {
+			v.Set("jwt", jwt)
+			return v.Encode()
+		}
+	}
+	return url.Values{"jwt": []string{jwt}}.Encode()
+}
+
+// authRequest fills the authentication request of a HTTP request in the same way of the HLS and WebRTC servers,
+// and returns whether the request contains basic credentials.
+// All authorization checks of the playback server must use it, in order not to diverge from other servers.
+func authRequest(ctx *gin.Context, pathName string, action conf.AuthAction) (*auth.Request, bool) {
+	q := ctx.Request.URL.RawQuery
+
+	if h := ctx.Request.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		// JWT in authorization bearer -> JWT in query parameters
+		q = addJWTFromAuthorization(q, h)
+
+		// credentials in authorization bearer -> credentials in authorization basic
+		if parts := strings.Split(strings.TrimPrefix(h, "Bearer "), ":"); len(parts) == 2 {
+			ctx.Request.SetBasicAuth(parts[0], parts[1])
+		}
+	}
+
 	user, pass, hasCredentials := ctx.Request.BasicAuth()
 
-	err := s.AuthManager.Authenticate(&auth.Request{
+	return &auth.Request{
 		User:   user,
 		Pass:   pass,
-		Query:  ctx.Request.URL.RawQuery,
+		Query:  q,
 		IP:     net.ParseIP(ctx.ClientIP()),
-		Action: conf.AuthActionPlayback,
+		Action: action,
 		Path:   pathName,
-	})
+	}, hasCredentials
+}
+
+func (s *Server) doAuth(ctx *gin.Context, pathName string, action conf.AuthAction) bool {
+	req, hasCredentials := authRequest(ctx, pathName, action)
+
+	err := s.AuthManager.Authenticate(req)
 	if err != nil {
 		if !hasCredentials {
 			ctx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
@@ -150,5 +545,47 @@ func (s *Server) doAuth(ctx *gin.Context, pathName string) bool {
 		return false
 	}
 
-	return true
+	// timespans are restricted by handlers
+	if req.MaxLookback != 0 {
+		ctx.Set("lookbackLimit", time.Now().Add(-req.MaxLookback))
+	}
+
+	return s.applyQuota(ctx, quotaIdentity(ctx))
+}
+
+// lookbackLimit returns the oldest date of recordings that the user is allowed to access,
+// or the zero time if there's no limit.
+func lookbackLimit(ctx *gin.Context) time.Time {
+	if v, ok := ctx.Get("lookbackLimit"); ok {
+		return v.(time.Time)
+	}
+	return time.Time{}
+}
+
+var errLookback = NotAllowedError{"recordings older than the lookback limit cannot be accessed"}
+
+// clampLookback restricts a timespan to the recordings that the user is allowed to access.
+// A zero duration means that the timespan has no end.
+func clampLookback(limit time.Time, start time.Time, duration time.Duration) (time.Time, time.Duration, error) {
+	if limit.IsZero() || !start.Before(limit) {
+		return start, duration, nil
+	}
+
+	if duration != 0 {
+		end := start.Add(duration)
+		if !end.After(limit) {
+			return time.Time{}, 0, errLookback
+		}
+		duration = end.Sub(limit)
+	}
+
+	return limit, duration, nil
+}
+
+// checkLookback checks whether the user is allowed to access recordings at the given date.
+func checkLookback(limit time.Time, t time.Time) error {
+	if !limit.IsZero() && t.Before(limit) {
+		return errLookback
+	}
+	return nil
 }
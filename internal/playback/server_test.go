@@ -1,12 +1,27 @@
 package playback
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/bluenviron/mediamtx/internal/auth"
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/test"
 	"github.com/stretchr/testify/require"
 )
@@ -42,7 +57,676 @@ func TestPreflightRequest(t *testing.T) {
 
 	require.Equal(t, "*", res.Header.Get("Access-Control-Allow-Origin"))
 	require.Equal(t, "true", res.Header.Get("Access-Control-Allow-Credentials"))
-	require.Equal(t, "OPTIONS, GET", res.Header.Get("Access-Control-Allow-Methods"))
-	require.Equal(t, "Authorization", res.Header.Get("Access-Control-Allow-Headers"))
+	require.Equal(t, "OPTIONS, GET, POST, PATCH, DELETE", res.Header.Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "Authorization, Idempotency-Key, Range, If-Range, If-None-Match, If-Modified-Since",
+		res.Header.Get("Access-Control-Allow-Headers"))
 	require.Equal(t, byts, []byte{})
 }
+
+func TestHeaders(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	writeSegment2(t, filepath.Join(dir, "mypath", "2008-11-07_11-23-02-500000.mp4"))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		Headers:     conf.HTTPHeaders{"X-Robots-Tag": "noindex"},
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:            filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable:        true,
+				RecordPartDuration:    conf.StringDuration(1 * time.Second),
+				PlaybackHeaders:       conf.HTTPHeaders{"Cache-Control": "public, max-age=86400", "X-Custom": "a"},
+				PlaybackRecentHeaders: conf.HTTPHeaders{"Cache-Control": "no-store"},
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	get := func(u string) *http.Response {
+		res, err2 := http.Get("http://localhost:9996" + u)
+		require.NoError(t, err2)
+		res.Body.Close()
+		return res
+	}
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 1, 500000000, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "3")
+
+	// finished window
+	res := get("/get?" + v.Encode())
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "noindex", res.Header.Get("X-Robots-Tag"))
+	require.Equal(t, "public, max-age=86400", res.Header.Get("Cache-Control"))
+	require.Equal(t, "a", res.Header.Get("X-Custom"))
+
+	// recordings may be added
+	res = get("/list?path=mypath")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+	require.Equal(t, "a", res.Header.Get("X-Custom"))
+
+	// errors have global headers only
+	res = get("/get?path=mypath")
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	require.Equal(t, "noindex", res.Header.Get("X-Robots-Tag"))
+	require.Equal(t, "", res.Header.Get("Cache-Control"))
+}
+
+func TestServerCompression(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	tr := &http.Transport{DisableCompression: true}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	get := func(u string, acceptEncoding string) (*http.Response, []byte) {
+		req, err2 := http.NewRequest(http.MethodGet, "http://localhost:9996"+u, nil)
+		require.NoError(t, err2)
+
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+
+		res, err2 := hc.Do(req)
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		buf, err2 := io.ReadAll(res.Body)
+		require.NoError(t, err2)
+
+		return res, buf
+	}
+
+	res, plain := get("/list?path=mypath", "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "", res.Header.Get("Content-Encoding"))
+	require.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+
+	res, buf := get("/list?path=mypath", "br, gzip;q=0.8")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+
+	gr, err := gzip.NewReader(bytes.NewReader(buf))
+	require.NoError(t, err)
+	dec, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	require.Equal(t, plain, dec)
+
+	res, _ = get("/list?path=mypath", "gzip;q=0")
+	require.Equal(t, "", res.Header.Get("Content-Encoding"))
+
+	// explicit codings take precedence over the wildcard
+	res, _ = get("/list?path=mypath", "*;q=0, gzip")
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+
+	res, _ = get("/list?path=mypath", "*, gzip;q=0")
+	require.Equal(t, "", res.Header.Get("Content-Encoding"))
+
+	// recordings are not compressed
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 22, 30, 500000000, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "1")
+	res, _ = get("/get?"+v.Encode(), "gzip")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "", res.Header.Get("Content-Encoding"))
+}
+
+func TestServerAPIVersion(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	get := func(u string) (*http.Response, []byte) {
+		res, err2 := http.Get("http://localhost:9996" + u)
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		buf, err2 := io.ReadAll(res.Body)
+		require.NoError(t, err2)
+
+		return res, buf
+	}
+
+	res, legacy := get("/list?path=mypath")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, v1 := get("/v1/list?path=mypath")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, legacy, v1)
+
+	// legacy errors are plain text
+	res, buf := get("/get?path=mypath")
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	require.Equal(t, `invalid start: parsing time "" as "2006-01-02T15:04:05Z07:00": cannot parse "" as "2006"`,
+		string(buf))
+
+	// versioned errors are JSON
+	res, buf = get("/v1/get?path=mypath")
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	require.Equal(t, "application/json; charset=utf-8", res.Header.Get("Content-Type"))
+
+	var apiErr defs.APIError
+	err = json.Unmarshal(buf, &apiErr)
+	require.NoError(t, err)
+	require.Equal(t, `invalid start: parsing time "" as "2006-01-02T15:04:05Z07:00": cannot parse "" as "2006"`,
+		apiErr.Error)
+
+	// generated URLs use the same version
+	res, buf = get("/v1/browse?path=mypath")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var item browseItem
+	err = json.Unmarshal(buf, &item)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:9996/v1/browse?path=mypath", item.MediaContentID)
+}
+
+func TestServerPathRestrictions(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"disabled", "restricted"} {
+		err = os.Mkdir(filepath.Join(dir, name), 0o755)
+		require.NoError(t, err)
+
+		writeSegment1(t, filepath.Join(dir, name, "2008-11-07_11-22-00-500000.mp4"))
+		writeSegment2(t, filepath.Join(dir, name, "2008-11-07_11-23-02-500000.mp4"))
+	}
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"disabled": {
+				Name:       "disabled",
+				RecordPath: filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			},
+			"restricted": {
+				Name:                "restricted",
+				RecordPath:          filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable:      true,
+				PlaybackFormats:     conf.PlaybackFormats{"mp4"},
+				PlaybackMaxDuration: conf.StringDuration(2 * time.Second),
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	for _, ca := range []struct {
+		name     string
+		endpoint string
+		path     string
+		format   string
+		duration string
+		status   int
+	}{
+		{"disabled list", "list", "disabled", "", "", http.StatusForbidden},
+		{"disabled get", "get", "disabled", "mp4", "1", http.StatusForbidden},
+		{"restricted list", "list", "restricted", "", "", http.StatusOK},
+		{"restricted format", "get", "restricted", "fmp4", "1", http.StatusForbidden},
+		{"restricted archive", "archive", "restricted", "", "1", http.StatusForbidden},
+		{"restricted duration", "get", "restricted", "mp4", "3", http.StatusForbidden},
+		{"restricted allowed", "get", "restricted", "mp4", "1", http.StatusOK},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			v := url.Values{}
+			v.Set("path", ca.path)
+			if ca.endpoint != "list" {
+				v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 1, 500000000, time.Local).Format(time.RFC3339Nano))
+				v.Set("duration", ca.duration)
+			}
+			if ca.format != "" {
+				v.Set("format", ca.format)
+			}
+
+			res, err2 := http.Get("http://localhost:9996/" + ca.endpoint + "?" + v.Encode())
+			require.NoError(t, err2)
+			defer res.Body.Close()
+
+			_, err2 = io.ReadAll(res.Body)
+			require.NoError(t, err2)
+
+			require.Equal(t, ca.status, res.StatusCode)
+		})
+	}
+
+	res, err := http.Get("http://localhost:9996/paths")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var paths []string
+	err = json.NewDecoder(res.Body).Decode(&paths)
+	require.NoError(t, err)
+	require.Equal(t, []string{"restricted"}, paths)
+}
+
+func TestServerMaintenanceMode(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+
+	s := &Server{
+		Address:         "127.0.0.1:9996",
+		ReadTimeout:     conf.StringDuration(10 * time.Second),
+		MaintenanceMode: true,
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "3600")
+
+	doDelete := func() int {
+		req, err2 := http.NewRequest(http.MethodDelete, "http://localhost:9996/delete?"+v.Encode(), nil)
+		require.NoError(t, err2)
+
+		res, err2 := hc.Do(req)
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	require.Equal(t, http.StatusServiceUnavailable, doDelete())
+
+	// recordings can still be downloaded
+	res, err := hc.Get("http://localhost:9996/get?" + v.Encode())
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	s.ReloadMaintenanceMode(false)
+
+	require.Equal(t, http.StatusOK, doDelete())
+}
+
+func TestServerStats(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+
+	err = record.IndexAdd(filepath.Join(dir, "index"), "mypath", record.IndexEntry{
+		Start:    time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local),
+		Duration: 62 * time.Second,
+		Path:     filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"),
+	})
+	require.NoError(t, err)
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordIndexPath: filepath.Join(dir, "index"),
+				PlaybackEnable:  true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", time.Date(2008, 11, 0o7, 11, 23, 1, 500000000, time.Local).Format(time.RFC3339Nano))
+	v.Set("duration", "3")
+	v.Set("format", "mp4")
+
+	res, err := http.Get("http://localhost:9996/v1/get?" + v.Encode())
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = http.Get("http://localhost:9996/list?path=otherpath")
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	stats, err := s.APIStats()
+	require.NoError(t, err)
+
+	require.Equal(t, []*defs.APIPlaybackRequests{
+		{
+			Route:  "/get",
+			Format: "mp4",
+			Status: http.StatusOK,
+			Count:  1,
+		},
+		{
+			Route:  "/list",
+			Status: http.StatusBadRequest,
+			Count:  1,
+		},
+	}, stats.Requests)
+	require.GreaterOrEqual(t, stats.BytesSent, uint64(len(body)))
+	require.Equal(t, []*defs.APIPlaybackIndex{{Path: "mypath", Entries: 1}}, stats.Indexes)
+}
+
+func TestServerMaxLookback(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tr := newHarnessTree(t, "mypath", []harnessSegment{
+		{
+			Start:           now.Add(-2 * time.Hour),
+			Codecs:          []string{"H264"},
+			Fragments:       2,
+			FragmentSamples: 2,
+		},
+		{
+			Start:           now.Add(-1*time.Hour - 10*time.Second),
+			Codecs:          []string{"H264"},
+			Fragments:       20,
+			FragmentSamples: 1,
+		},
+		{
+			Start:           now.Add(-10 * time.Minute),
+			Codecs:          []string{"H264"},
+			Fragments:       2,
+			FragmentSamples: 2,
+		},
+	})
+	tr.authManager = &test.AuthManager{
+		Func: func(req *auth.Request) error {
+			req.MaxLookback = 1 * time.Hour
+			return nil
+		},
+	}
+	tr.serve(t)
+
+	require.Equal(t, []listEntry{
+		{Start: now.Add(-10 * time.Minute), Duration: listEntryDuration(4 * time.Second)},
+	}, harnessList(t, tr))
+
+	code, _ := tr.get(t, "/get?path=mypath&start="+
+		url.QueryEscape(now.Add(-10*time.Minute).Format(time.RFC3339Nano))+"&duration=4")
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = tr.get(t, "/get?path=mypath&start="+
+		url.QueryEscape(now.Add(-2*time.Hour).Format(time.RFC3339Nano))+"&duration=4")
+	require.Equal(t, http.StatusForbidden, code)
+
+	// timespans that end after the limit are restricted to the allowed part
+	code, _ = tr.get(t, "/get?path=mypath&start="+
+		url.QueryEscape(now.Add(-1*time.Hour-10*time.Second).Format(time.RFC3339Nano))+"&duration=20")
+	require.Equal(t, http.StatusOK, code)
+
+	code, body := tr.get(t, "/url?path=mypath&start="+
+		url.QueryEscape(now.Add(-1*time.Hour-10*time.Second).Format(time.RFC3339Nano))+"&duration=20")
+	require.Equal(t, http.StatusOK, code)
+
+	var res struct {
+		URL string `json:"url"`
+	}
+	err := json.Unmarshal(body, &res)
+	require.NoError(t, err)
+
+	u, err := url.Parse(res.URL)
+	require.NoError(t, err)
+	start, err := time.Parse(time.RFC3339, u.Query().Get("start"))
+	require.NoError(t, err)
+	require.False(t, start.Before(now.Add(-1*time.Hour)))
+
+	code, _ = tr.get(t, "/keyframe?path=mypath&time="+
+		url.QueryEscape(now.Add(-2*time.Hour).Format(time.RFC3339Nano)))
+	require.Equal(t, http.StatusForbidden, code)
+}
+
+func TestServerAuthBearer(t *testing.T) {
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.Local)
+
+	tr := newHarnessTree(t, "mypath", []harnessSegment{
+		{
+			Start:           start,
+			Codecs:          []string{"H264"},
+			Fragments:       2,
+			FragmentSamples: 2,
+		},
+	})
+	tr.authManager = &test.AuthManager{
+		Func: func(req *auth.Request) error {
+			q, _ := url.ParseQuery(req.Query)
+			if q.Get("jwt") == "mytoken" || (req.User == "myuser" && req.Pass == "mypass") {
+				return nil
+			}
+			return auth.Error{Message: "wrong token"}
+		},
+	}
+	tr.serve(t)
+
+	for _, ca := range []struct {
+		name      string
+		header    string
+		code      int
+		challenge bool
+	}{
+		{"jwt", "Bearer mytoken", http.StatusOK, false},
+		{"credentials", "Bearer myuser:mypass", http.StatusOK, false},
+		{"wrong", "Bearer othertoken", http.StatusUnauthorized, true},
+		{"wrong credentials", "Bearer myuser:otherpass", http.StatusUnauthorized, false},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:9996/list?path=mypath", nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", ca.header)
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, ca.code, res.StatusCode)
+			require.Equal(t, ca.challenge, res.Header.Get("WWW-Authenticate") != "")
+		})
+	}
+}
+
+type testAccessLogger struct {
+	mutex   sync.Mutex
+	entries []string
+}
+
+func (l *testAccessLogger) Log(level logger.Level, format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if line := fmt.Sprintf(format, args...); level == logger.Info && strings.HasPrefix(line, "[playback] access ") {
+		l.entries = append(l.entries, strings.TrimPrefix(line, "[playback] access "))
+	}
+}
+
+func TestServerAccessLog(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+
+	l := &testAccessLogger{}
+
+	s := &Server{
+		Address:        "127.0.0.1:9996",
+		ReadTimeout:    conf.StringDuration(10 * time.Second),
+		AccessLogLevel: conf.LogLevel(logger.Info),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: true,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      l,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	start := time.Date(2008, 11, 0o7, 11, 22, 30, 500000000, time.Local).Format(time.RFC3339Nano)
+
+	res, err := hc.Get("http://localhost:9996/get?path=mypath&start=" + url.QueryEscape(start) +
+		"&duration=2&format=fmp4")
+	require.NoError(t, err)
+	n, err := io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = hc.Get("http://localhost:9996/v1/list?path=missing")
+	require.NoError(t, err)
+	res.Body.Close()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	require.Len(t, l.entries, 2)
+	require.Regexp(t, `^method=GET route=/get status=200 path=mypath start=`+regexp.QuoteMeta(start)+` duration=2 `+
+		`format=fmp4 bytes=`+strconv.FormatInt(n, 10)+` muxTime=\S+ elapsed=\S+ ip=127.0.0.1$`, l.entries[0])
+	require.Regexp(t, `^method=GET route=/list status=400 path=missing bytes=\d+ elapsed=\S+ ip=127.0.0.1$`,
+		l.entries[1])
+}
+
+type testWarnLogger struct {
+	entries []string
+}
+
+func (l *testWarnLogger) Log(level logger.Level, format string, args ...interface{}) {
+	if level == logger.Warn {
+		l.entries = append(l.entries, fmt.Sprintf(format, args...))
+	}
+}
+
+func TestCheckIndexLocations(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+
+	indexPath := filepath.Join(dir, "index")
+
+	err = record.IndexAdd(indexPath, "mypath", record.IndexEntry{
+		Start: time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local),
+		Path:  filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"),
+	})
+	require.NoError(t, err)
+
+	// segment written by an instance that mounts recordings in another location
+	err = record.IndexAdd(indexPath, "otherpath", record.IndexEntry{
+		Start: time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local),
+		Path:  "/mnt/other/otherpath/2008-11-07_11-22-00-500000.mp4",
+	})
+	require.NoError(t, err)
+
+	l := &testWarnLogger{}
+
+	checkIndexLocations(map[string]*conf.Path{
+		"~^.*$": {
+			RecordPath:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			RecordIndexPath: indexPath,
+		},
+	}, l)
+
+	require.Len(t, l.entries, 1)
+	require.Contains(t, l.entries[0], "/mnt/other/otherpath/2008-11-07_11-22-00-500000.mp4")
+}
@@ -0,0 +1,238 @@
+package playback
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errShareLinkNotFound = errors.New("share link not found")
+	errShareLinkExpired  = errors.New("share link is expired")
+)
+
+type shareLink struct {
+	ID           uuid.UUID         `json:"id"`
+	Name         string            `json:"name"`
+	Created      time.Time         `json:"created"`
+	Path         string            `json:"path"`
+	Start        time.Time         `json:"start"`
+	Duration     listEntryDuration `json:"duration"`
+	Format       string            `json:"format"`
+	Expires      *time.Time        `json:"expires"`
+	MaxDownloads int               `json:"maxDownloads"`
+	Downloads    int               `json:"downloads"`
+}
+
+func (l *shareLink) active(now time.Time) bool {
+	return (l.Expires == nil || now.Before(*l.Expires)) &&
+		(l.MaxDownloads == 0 || l.Downloads < l.MaxDownloads)
+}
+
+// shareLinkManager stores share links into a file.
+type shareLinkManager struct {
+	filePath string
+
+	mutex sync.Mutex
+	links map[uuid.UUID]*shareLink
+}
+
+func (m *shareLinkManager) initialize() error {
+	m.links = make(map[uuid.UUID]*shareLink)
+
+	buf, err := os.ReadFile(m.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var links []*shareLink
+	err = json.Unmarshal(buf, &links)
+	if err != nil {
+		return fmt.Errorf("unable to load share links: %w", err)
+	}
+
+	for _, link := range links {
+		m.links[link.ID] = link
+	}
+
+	return nil
+}
+
+// save writes links to disk atomically. It must be called with the mutex locked.
+func (m *shareLinkManager) save() error {
+	links := make([]*shareLink, 0, len(m.links))
+	for _, link := range m.links {
+		links = append(links, link)
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Created.Before(links[j].Created)
+	})
+
+	buf, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := m.filePath + ".tmp"
+
+	err = os.WriteFile(tmp, buf, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.filePath)
+}
+
+func (m *shareLinkManager) add(link *shareLink) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link.ID = uuid.New()
+	link.Created = time.Now()
+
+	m.links[link.ID] = link
+
+	err := m.save()
+	if err != nil {
+		delete(m.links, link.ID)
+		return err
+	}
+
+	return nil
+}
+
+func (m *shareLinkManager) get(id uuid.UUID) (shareLink, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, ok := m.links[id]
+	if !ok {
+		return shareLink{}, errShareLinkNotFound
+	}
+
+	return *link, nil
+}
+
+// list returns active links of a path, or of all paths if pathName is empty.
+func (m *shareLinkManager) list(pathName string) []shareLink {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	out := []shareLink{}
+
+	for _, link := range m.links {
+		if (pathName == "" || link.Path == pathName) && link.active(now) {
+			out = append(out, *link)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Created.Before(out[j].Created)
+	})
+
+	return out
+}
+
+func (m *shareLinkManager) update(id uuid.UUID, cb func(link *shareLink) error) (shareLink, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, ok := m.links[id]
+	if !ok {
+		return shareLink{}, errShareLinkNotFound
+	}
+
+	newLink := *link
+
+	err := cb(&newLink)
+	if err != nil {
+		return shareLink{}, err
+	}
+
+	m.links[id] = &newLink
+
+	err = m.save()
+	if err != nil {
+		m.links[id] = link
+		return shareLink{}, err
+	}
+
+	return newLink, nil
+}
+
+func (m *shareLinkManager) remove(id uuid.UUID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, ok := m.links[id]
+	if !ok {
+		return errShareLinkNotFound
+	}
+
+	delete(m.links, id)
+
+	err := m.save()
+	if err != nil {
+		m.links[id] = link
+		return err
+	}
+
+	return nil
+}
+
+// use increases the download counter of a link, if the link is still active.
+func (m *shareLinkManager) use(id uuid.UUID) (shareLink, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, ok := m.links[id]
+	if !ok {
+		return shareLink{}, errShareLinkNotFound
+	}
+
+	if !link.active(time.Now()) {
+		return shareLink{}, errShareLinkExpired
+	}
+
+	link.Downloads++
+
+	err := m.save()
+	if err != nil {
+		link.Downloads--
+		return shareLink{}, err
+	}
+
+	return *link, nil
+}
+
+// refund decreases the download counter of a link, when a download has failed.
+func (m *shareLinkManager) refund(id uuid.UUID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, ok := m.links[id]
+	if !ok || link.Downloads == 0 {
+		return nil
+	}
+
+	link.Downloads--
+
+	err := m.save()
+	if err != nil {
+		link.Downloads++
+		return err
+	}
+
+	return nil
+}
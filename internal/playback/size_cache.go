@@ -0,0 +1,47 @@
+package playback
+
+import (
+	"sync"
+)
+
+// maximum number of sizes stored by sizeCache.
+const sizeCacheMaxEntries = 1024
+
+// sizeCache stores the size of responses of /get, keyed by their ETag,
+// in order to answer HEAD and range requests without computing it again.
+// Since the ETag changes when recordings or privacy intervals change, entries are never outdated.
+type sizeCache struct {
+	mutex   sync.Mutex
+	entries map[string]int64
+	order   []string
+}
+
+func (c *sizeCache) initialize() {
+	c.entries = make(map[string]int64)
+}
+
+func (c *sizeCache) get(etag string) (int64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	size, ok := c.entries[etag]
+	return size, ok
+}
+
+func (c *sizeCache) set(etag string, size int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.entries[etag]; ok {
+		return
+	}
+
+	// remove the oldest entry
+	if len(c.order) >= sizeCacheMaxEntries {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+
+	c.entries[etag] = size
+	c.order = append(c.order, etag)
+}
@@ -0,0 +1,34 @@
+package playback
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeCache(t *testing.T) {
+	c := &sizeCache{}
+	c.initialize()
+
+	_, ok := c.get(`"a"`)
+	require.False(t, ok)
+
+	c.set(`"a"`, 123)
+	size, ok := c.get(`"a"`)
+	require.True(t, ok)
+	require.Equal(t, int64(123), size)
+
+	for i := 0; i < sizeCacheMaxEntries; i++ {
+		c.set(strconv.Itoa(i), int64(i))
+	}
+
+	// the oldest entry has been removed
+	_, ok = c.get(`"a"`)
+	require.False(t, ok)
+	require.Len(t, c.entries, sizeCacheMaxEntries)
+
+	size, ok = c.get(strconv.Itoa(sizeCacheMaxEntries - 1))
+	require.True(t, ok)
+	require.Equal(t, int64(sizeCacheMaxEntries-1), size)
+}
@@ -0,0 +1,220 @@
+package playback
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/gin-gonic/gin"
+)
+
+type statsRequestKey struct {
+	route  string
+	format string
+	status int
+}
+
+// formats that are reported by statistics. Other values are grouped together,
+// in order not to let clients create an arbitrary number of metrics.
+var statsFormats = map[string]struct{}{
+	"":       {},
+	"fmp4":   {},
+	"mp4":    {},
+	"ts":     {},
+	"mkv":    {},
+	"hls":    {},
+	"clone":  {},
+	"static": {},
+	"tar":    {},
+	"zip":    {},
+	"json":   {},
+	"csv":    {},
+}
+
+func statsFormat(format string) string {
+	if _, ok := statsFormats[format]; ok {
+		return format
+	}
+	return "other"
+}
+
+type indexStatsKey struct {
+	indexPath string
+	pathName  string
+}
+
+type indexStatsEntry struct {
+	generation uint64
+	created    time.Time
+	entries    int
+}
+
+// serverStats contains statistics about requests, that are exposed by the metrics server.
+type serverStats struct {
+	mutex           sync.Mutex
+	requests        map[statsRequestKey]uint64
+	bytesSent       uint64
+	requestDuration time.Duration
+
+	// number of indexed segments of each path, that are cached like segment lists
+	// in order not to read all indexes on every scrape.
+	indexesMutex sync.Mutex
+	indexes      map[indexStatsKey]*indexStatsEntry
+}
+
+func (s *serverStats) initialize() {
+	s.requests = make(map[statsRequestKey]uint64)
+	s.indexes = make(map[indexStatsKey]*indexStatsEntry)
+}
+
+func (s *serverStats) add(key statsRequestKey, size int, duration time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests[key]++
+	if size > 0 {
+		s.bytesSent += uint64(size)
+	}
+	s.requestDuration += duration
+}
+
+func (s *Server) middlewareStats(ctx *gin.Context) {
+	start := time.Now()
+
+	ctx.Next()
+
+	// skip unknown routes, in order not to fill statistics with arbitrary paths
+	route := ctx.FullPath()
+	if route == "" {
+		return
+	}
+
+	s.stats.add(statsRequestKey{
+		route:  strings.TrimPrefix(route, "/v1"),
+		format: statsFormat(ctx.Query("format")),
+		status: ctx.Writer.Status(),
+	}, ctx.Writer.Size(), time.Since(start))
+}
+
+func (s *Server) indexStats() []*defs.APIPlaybackIndex {
+	s.mutex.RLock()
+	indexPaths := make(map[string]struct{})
+	for _, pathConf := range s.PathConfs {
+		if pathConf.RecordIndexPath != "" {
+			indexPaths[pathConf.RecordIndexPath] = struct{}{}
+		}
+	}
+	s.mutex.RUnlock()
+
+	out := []*defs.APIPlaybackIndex{}
+
+	for indexPath := range indexPaths {
+		pathNames, err := record.IndexPathNames(indexPath)
+		if err != nil {
+			continue
+		}
+
+		for _, pathName := range pathNames {
+			entries, err := s.indexEntries(indexPath, pathName)
+			if err != nil {
+				continue
+			}
+
+			out = append(out, &defs.APIPlaybackIndex{
+				Path:    pathName,
+				Entries: entries,
+			})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+
+	return out
+}
+
+// indexEntries returns the number of segments in the index of a path.
+// Counts are read again when segments of the path change, or when they expire.
+func (s *Server) indexEntries(indexPath string, pathName string) (int, error) {
+	key := indexStatsKey{indexPath: indexPath, pathName: pathName}
+
+	// the generation is read before reading the index, in order not to store counts that miss concurrent changes.
+	generation := s.Registry.SegmentsGeneration(pathName)
+	now := time.Now()
+
+	s.stats.indexesMutex.Lock()
+	entry, ok := s.stats.indexes[key]
+	s.stats.indexesMutex.Unlock()
+
+	if ok && entry.generation == generation && now.Sub(entry.created) < segmentCacheTTL {
+		return entry.entries, nil
+	}
+
+	entries, err := record.IndexRead(indexPath, pathName)
+	if err != nil {
+		return 0, err
+	}
+
+	// segments with multiple entries are counted once
+	segments := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		segments[entry.Path] = struct{}{}
+	}
+
+	s.stats.indexesMutex.Lock()
+	defer s.stats.indexesMutex.Unlock()
+
+	// remove counts of paths that are not indexed anymore
+	for k, e := range s.stats.indexes {
+		if now.Sub(e.created) >= segmentCacheTTL {
+			delete(s.stats.indexes, k)
+		}
+	}
+
+	s.stats.indexes[key] = &indexStatsEntry{
+		generation: generation,
+		created:    now,
+		entries:    len(segments),
+	}
+
+	return len(segments), nil
+}
+
+// APIStats is called by metrics.
+func (s *Server) APIStats() (*defs.APIPlaybackStats, error) {
+	out := &defs.APIPlaybackStats{
+		Requests: []*defs.APIPlaybackRequests{},
+	}
+
+	s.stats.mutex.Lock()
+	for key, count := range s.stats.requests {
+		out.Requests = append(out.Requests, &defs.APIPlaybackRequests{
+			Route:  key.route,
+			Format: key.format,
+			Status: key.status,
+			Count:  count,
+		})
+	}
+	out.BytesSent = s.stats.bytesSent
+	out.RequestDuration = s.stats.requestDuration.Seconds()
+	s.stats.mutex.Unlock()
+
+	sort.Slice(out.Requests, func(i, j int) bool {
+		a, b := out.Requests[i], out.Requests[j]
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		if a.Format != b.Format {
+			return a.Format < b.Format
+		}
+		return a.Status < b.Status
+	})
+
+	out.Indexes = s.indexStats()
+
+	return out, nil
+}
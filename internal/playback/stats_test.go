@@ -0,0 +1,62 @@
+package playback
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsFormat(t *testing.T) {
+	require.Equal(t, "", statsFormat(""))
+	require.Equal(t, "mkv", statsFormat("mkv"))
+	require.Equal(t, "other", statsFormat("x\"} 1\nfoo{a=\""))
+}
+
+func TestIndexStatsCache(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	indexPath := filepath.Join(dir, "index")
+
+	registry := &record.Registry{}
+	registry.Initialize()
+
+	s := &Server{
+		Registry: registry,
+		stats:    &serverStats{},
+	}
+	s.stats.initialize()
+
+	add := func(n int) {
+		err2 := record.IndexAdd(indexPath, "mypath", record.IndexEntry{
+			Start:    time.Date(2008, 11, 7, 11, 22, n, 0, time.UTC),
+			Duration: time.Second,
+			Path:     filepath.Join(dir, "mypath", time.Duration(n).String()+".mp4"),
+		})
+		require.NoError(t, err2)
+	}
+
+	add(1)
+
+	entries, err := s.indexEntries(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, 1, entries)
+
+	// the index is not read again until segments change
+	add(2)
+
+	entries, err = s.indexEntries(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, 1, entries)
+
+	registry.SegmentsChanged("mypath")
+
+	entries, err = s.indexEntries(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, 2, entries)
+}
@@ -0,0 +1,221 @@
+package playback
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
+)
+
+// segmentFile is an open segment.
+type segmentFile interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+}
+
+// segmentStorage is a place in which segments are stored.
+type segmentStorage interface {
+	Open(name string) (segmentFile, error)
+	Stat(name string) (fs.FileInfo, error)
+
+	// List calls cb with all files inside root and its subdirectories.
+	List(root string, cb func(name string, info fs.FileInfo) error) error
+}
+
+// localStorage is the local file system.
+type localStorage struct{}
+
+func (localStorage) Open(name string) (segmentFile, error) {
+	return os.Open(name)
+}
+
+func (localStorage) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (localStorage) List(root string, cb func(name string, info fs.FileInfo) error) error {
+	return filepath.Walk(root, func(fpath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return cb(fpath, info)
+		}
+
+		return nil
+	})
+}
+
+// s3Storage is a bucket of a S3-compatible object storage.
+// Names are URLs of objects, in the format s3://bucket/key.
+type s3Storage struct {
+	client *s3.Client
+}
+
+func (s *s3Storage) key(name string) (string, error) {
+	key, ok := s.client.KeyFromURL(name)
+	if !ok {
+		return "", fs.ErrNotExist
+	}
+	return key, nil
+}
+
+func (s *s3Storage) Open(name string) (segmentFile, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	size, _, err := s.client.Head(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3File{
+		client: s.client,
+		key:    key,
+		size:   size,
+	}, nil
+}
+
+func (s *s3Storage) Stat(name string) (fs.FileInfo, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	size, modTime, err := s.client.Head(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3FileInfo{name: filepath.Base(key), size: size, modTime: modTime}, nil
+}
+
+func (s *s3Storage) List(root string, cb func(name string, info fs.FileInfo) error) error {
+	prefix, err := s.key(root)
+	if err != nil {
+		return err
+	}
+
+	return s.client.List(prefix, func(obj s3.Object) error {
+		return cb(s.client.URL(obj.Key), &s3FileInfo{
+			name:    filepath.Base(obj.Key),
+			size:    obj.Size,
+			modTime: obj.LastModified,
+		})
+	})
+}
+
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *s3FileInfo) Name() string       { return i.name }
+func (i *s3FileInfo) Size() int64        { return i.size }
+func (i *s3FileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i *s3FileInfo) ModTime() time.Time { return i.modTime }
+func (i *s3FileInfo) IsDir() bool        { return false }
+func (i *s3FileInfo) Sys() interface{}   { return nil }
+
+// size of the chunks that are downloaded when reading objects sequentially.
+// Segments are parsed with many small reads, that would otherwise be performed with a request each.
+const s3FileChunkSize = 1024 * 1024
+
+// s3File is an object that is read with range requests.
+type s3File struct {
+	client *s3.Client
+	key    string
+	size   int64
+
+	pos      int64
+	buf      []byte
+	bufStart int64
+}
+
+func (f *s3File) Close() error {
+	return nil
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.size
+	}
+
+	if offset < 0 {
+		return 0, fs.ErrInvalid
+	}
+
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *s3File) Read(p []byte) (int, error) {
+	if f.pos >= f.size {
+		return 0, io.EOF
+	}
+
+	if f.pos < f.bufStart || f.pos >= f.bufStart+int64(len(f.buf)) {
+		buf, err := f.download(f.pos, min(max(int64(len(p)), s3FileChunkSize), f.size-f.pos))
+		if err != nil {
+			return 0, err
+		}
+		f.buf = buf
+		f.bufStart = f.pos
+	}
+
+	n := copy(p, f.buf[f.pos-f.bufStart:])
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *s3File) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+
+	n := min(int64(len(p)), f.size-off)
+
+	// serve the request from the buffer when possible
+	if off >= f.bufStart && off+n <= f.bufStart+int64(len(f.buf)) {
+		copy(p, f.buf[off-f.bufStart:off-f.bufStart+n])
+	} else {
+		buf, err := f.download(off, n)
+		if err != nil {
+			return 0, err
+		}
+		copy(p, buf)
+	}
+
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+func (f *s3File) download(offset int64, length int64) ([]byte, error) {
+	r, err := f.client.GetRange(f.key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	buf := make([]byte, length)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,144 @@
+package playback
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageArchive(t *testing.T) {
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.Local)
+
+	tr := newHarnessTree(t, "mypath", []harnessSegment{
+		{
+			Start:           start,
+			Codecs:          []string{"H264"},
+			Fragments:       5,
+			FragmentSamples: 2,
+		},
+		{
+			Start:           start.Add(10 * time.Second),
+			Codecs:          []string{"H264"},
+			Fragments:       5,
+			FragmentSamples: 2,
+		},
+	})
+
+	// move the first segment into the archive, like the cleaner does
+	tr.conf.RecordArchiveTo = filepath.Join(tr.dir, "archive")
+
+	err := os.MkdirAll(filepath.Join(tr.dir, "archive", "mypath"), 0o755)
+	require.NoError(t, err)
+
+	name := start.Format("2006-01-02_15-04-05-000000") + ".mp4"
+	err = os.Rename(filepath.Join(tr.dir, "mypath", name), filepath.Join(tr.dir, "archive", "mypath", name))
+	require.NoError(t, err)
+	tr.registry.SegmentsChanged("mypath")
+
+	tr.serve(t)
+
+	require.Equal(t, []listEntry{
+		{Start: start, Duration: listEntryDuration(20 * time.Second)},
+	}, harnessList(t, tr))
+
+	code, byts := tr.get(t, "/get?path=mypath&start="+url.QueryEscape(start.Format(time.RFC3339))+"&duration=20")
+	require.Equal(t, http.StatusOK, code, string(byts))
+	require.NotEmpty(t, byts)
+
+	// archived segments are not deleted
+	req, err := http.NewRequest(http.MethodDelete, "http://localhost:9996/delete?path=mypath&start="+
+		url.QueryEscape(start.Format(time.RFC3339))+"&duration=10", nil)
+	require.NoError(t, err)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	_, err = os.Stat(filepath.Join(tr.dir, "archive", "mypath", name))
+	require.NoError(t, err)
+}
+
+func TestS3Storage(t *testing.T) {
+	content := make([]byte, s3FileChunkSize*2+100)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	gets := 0
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/mybucket":
+			require.Equal(t, "myprefix/mypath", r.URL.Query().Get("prefix"))
+			io.WriteString(w, `<ListBucketResult><IsTruncated>false</IsTruncated>`+ //nolint:errcheck
+				`<Contents><Key>myprefix/mypath/seg.mp4</Key><Size>`+strconv.Itoa(len(content))+`</Size>`+
+				`<LastModified>2009-05-20T22:15:25.000Z</LastModified></Contents>`+
+				`</ListBucketResult>`)
+
+		case r.URL.Path == "/mybucket/myprefix/mypath/seg.mp4":
+			if r.Method == http.MethodGet {
+				gets++
+			}
+			http.ServeContent(w, r, "seg.mp4", time.Time{}, bytes.NewReader(content))
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	client, err := s3.ParseURL("s3+http://" + strings.TrimPrefix(s.URL, "http://") + "/mybucket/myprefix")
+	require.NoError(t, err)
+
+	storage := &s3Storage{client: client}
+
+	var names []string
+	err = storage.List("s3://mybucket/myprefix/mypath", func(name string, info fs.FileInfo) error {
+		names = append(names, name)
+		require.Equal(t, int64(len(content)), info.Size())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"s3://mybucket/myprefix/mypath/seg.mp4"}, names)
+
+	_, err = storage.Stat("s3://mybucket/myprefix/mypath/missing.mp4")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	f, err := storage.Open("s3://mybucket/myprefix/mypath/seg.mp4")
+	require.NoError(t, err)
+	defer f.Close()
+
+	// small sequential reads are served by a single request
+	buf := make([]byte, 8)
+	for i := 0; i < 10; i++ {
+		_, err = io.ReadFull(f, buf)
+		require.NoError(t, err)
+		require.Equal(t, content[i*8:i*8+8], buf)
+	}
+	require.Equal(t, 1, gets)
+
+	_, err = f.Seek(-50, io.SeekEnd)
+	require.NoError(t, err)
+
+	rest, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, content[len(content)-50:], rest)
+
+	n, err := f.ReadAt(buf, int64(s3FileChunkSize))
+	require.NoError(t, err)
+	require.Equal(t, 8, n)
+	require.Equal(t, content[s3FileChunkSize:s3FileChunkSize+8], buf)
+}
@@ -0,0 +1,195 @@
+// Package onvif contains ONVIF utilities.
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+var (
+	// timeout of each PullMessages request, that is performed with long polling.
+	pullTimeout = 10 * time.Second
+
+	// pause between a failure and the next subscription attempt.
+	retryPause = 5 * time.Second
+)
+
+const (
+	subscriptionDuration = 60 * time.Second
+)
+
+type pullMessagesResponse struct {
+	NotificationMessages []struct {
+		Topic     string `xml:"Topic"`
+		DataItems []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:"Value,attr"`
+		} `xml:"Message>Message>Data>SimpleItem"`
+	} `xml:"NotificationMessage"`
+}
+
+// motionFromResponse returns the motion state contained into a PullMessages response.
+func motionFromResponse(res *pullMessagesResponse) (bool, bool) {
+	found := false
+	active := false
+
+	for _, msg := range res.NotificationMessages {
+		if !strings.Contains(strings.ToLower(msg.Topic), "motion") {
+			continue
+		}
+
+		for _, item := range msg.DataItems {
+			switch item.Name {
+			case "IsMotion", "State", "Motion", "MotionActive":
+				switch strings.ToLower(item.Value) {
+				case "true", "1":
+					found = true
+					active = true
+				case "false", "0":
+					found = true
+					active = false
+				}
+			}
+		}
+	}
+
+	return active, found
+}
+
+// EventClient receives motion events from the event service of an ONVIF device,
+// through a pull-point subscription.
+type EventClient struct {
+	// URL of the event service. Credentials are sent with WS-Security.
+	URL      string
+	OnMotion func(bool)
+	Parent   logger.Writer
+
+	ctx        context.Context
+	ctxCancel  func()
+	address    *url.URL
+	httpClient *http.Client
+
+	done chan struct{}
+}
+
+// Initialize initializes EventClient.
+func (c *EventClient) Initialize() error {
+	var err error
+	c.address, err = url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+
+	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
+
+	c.httpClient = &http.Client{
+		Timeout: pullTimeout + 10*time.Second,
+	}
+
+	c.done = make(chan struct{})
+
+	go c.run()
+
+	return nil
+}
+
+// Close closes EventClient.
+func (c *EventClient) Close() {
+	c.ctxCancel()
+	<-c.done
+}
+
+// Log implements logger.Writer.
+func (c *EventClient) Log(level logger.Level, format string, args ...interface{}) {
+	c.Parent.Log(level, "[ONVIF events] "+format, args...)
+}
+
+func (c *EventClient) run() {
+	defer close(c.done)
+
+	for {
+		err := c.runInner()
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		c.Log(logger.Warn, "%v", err)
+
+		select {
+		case <-time.After(retryPause):
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *EventClient) runInner() error {
+	var subRes struct {
+		Address string `xml:"SubscriptionReference>Address"`
+	}
+	err := soapCall(c.ctx, c.httpClient, c.address, actionCreatePullPointSubscription,
+		`<CreatePullPointSubscription xmlns="http://www.onvif.org/ver10/events/wsdl">`+
+			`<InitialTerminationTime>`+formatDuration(subscriptionDuration)+`</InitialTerminationTime>`+
+			`</CreatePullPointSubscription>`,
+		&subRes)
+	if err != nil {
+		return fmt.Errorf("unable to create subscription: %w", err)
+	}
+
+	subAddress, err := url.Parse(strings.TrimSpace(subRes.Address))
+	if err != nil || subAddress.Host == "" {
+		return fmt.Errorf("invalid subscription address: '%s'", subRes.Address)
+	}
+	subAddress.User = c.address.User
+
+	c.Log(logger.Debug, "subscribed")
+
+	defer func() {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer ctxCancel()
+		soapCall(ctx, c.httpClient, subAddress, actionUnsubscribe, //nolint:errcheck
+			`<Unsubscribe xmlns="http://docs.oasis-open.org/wsn/b-2"/>`, nil)
+	}()
+
+	lastRenew := time.Now()
+
+	for {
+		var pullRes pullMessagesResponse
+		err = soapCall(c.ctx, c.httpClient, subAddress, actionPullMessages,
+			`<PullMessages xmlns="http://www.onvif.org/ver10/events/wsdl">`+
+				`<Timeout>`+formatDuration(pullTimeout)+`</Timeout>`+
+				`<MessageLimit>32</MessageLimit>`+
+				`</PullMessages>`,
+			&pullRes)
+		if err != nil {
+			return fmt.Errorf("unable to pull messages: %w", err)
+		}
+
+		if active, ok := motionFromResponse(&pullRes); ok {
+			c.OnMotion(active)
+		}
+
+		if time.Since(lastRenew) >= subscriptionDuration/2 {
+			err = soapCall(c.ctx, c.httpClient, subAddress, actionRenew,
+				`<Renew xmlns="http://docs.oasis-open.org/wsn/b-2">`+
+					`<TerminationTime>`+formatDuration(subscriptionDuration)+`</TerminationTime>`+
+					`</Renew>`,
+				nil)
+			if err != nil {
+				return fmt.Errorf("unable to renew subscription: %w", err)
+			}
+			lastRenew = time.Now()
+		}
+	}
+}
+
+// formatDuration formats a duration in the xs:duration format.
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%dS", int64(d.Seconds()))
+}
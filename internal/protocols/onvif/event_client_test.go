@@ -0,0 +1,107 @@
+package onvif
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func notificationResponse(value string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" ` +
+		`xmlns:tev="http://www.onvif.org/ver10/events/wsdl" ` +
+		`xmlns:wsnt="http://docs.oasis-open.org/wsn/b-2" ` +
+		`xmlns:tt="http://www.onvif.org/ver10/schema">` +
+		`<env:Body><tev:PullMessagesResponse>` +
+		`<wsnt:NotificationMessage>` +
+		`<wsnt:Topic Dialect="http://www.onvif.org/ver10/tev/topicExpression/ConcreteSet">` +
+		`tns1:RuleEngine/CellMotionDetector/Motion</wsnt:Topic>` +
+		`<wsnt:Message><tt:Message UtcTime="2008-11-16T15:00:00Z">` +
+		`<tt:Source><tt:SimpleItem Name="VideoSourceConfigurationToken" Value="1"/></tt:Source>` +
+		`<tt:Data><tt:SimpleItem Name="IsMotion" Value="` + value + `"/></tt:Data>` +
+		`</tt:Message></wsnt:Message>` +
+		`</wsnt:NotificationMessage>` +
+		`</tev:PullMessagesResponse></env:Body></env:Envelope>`
+}
+
+func TestEventClient(t *testing.T) {
+	pullCount := 0
+	unsubscribed := make(chan struct{})
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body := string(buf)
+
+		require.Contains(t, body, "<Username>myuser</Username>")
+		require.Contains(t, body, "#PasswordDigest")
+		require.NotContains(t, body, "mypass")
+
+		w.Header().Set("Content-Type", "application/soap+xml")
+
+		switch {
+		case strings.Contains(body, "<CreatePullPointSubscription"):
+			require.Equal(t, "/onvif/Events", r.URL.Path)
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>`+ //nolint:errcheck
+				`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" `+
+				`xmlns:tev="http://www.onvif.org/ver10/events/wsdl" `+
+				`xmlns:wsa5="http://www.w3.org/2005/08/addressing">`+
+				`<env:Body><tev:CreatePullPointSubscriptionResponse>`+
+				`<tev:SubscriptionReference><wsa5:Address>`+srv.URL+`/onvif/Subscription?Idx=0</wsa5:Address>`+
+				`</tev:SubscriptionReference>`+
+				`</tev:CreatePullPointSubscriptionResponse></env:Body></env:Envelope>`)
+
+		case strings.Contains(body, "<PullMessages"):
+			require.Equal(t, "/onvif/Subscription", r.URL.Path)
+			pullCount++
+			switch pullCount {
+			case 1:
+				io.WriteString(w, notificationResponse("true")) //nolint:errcheck
+			case 2:
+				io.WriteString(w, notificationResponse("false")) //nolint:errcheck
+			default:
+				// simulate long polling without events
+				select {
+				case <-time.After(500 * time.Millisecond):
+				case <-r.Context().Done():
+				}
+				io.WriteString(w, `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">`+ //nolint:errcheck
+					`<env:Body><PullMessagesResponse/></env:Body></env:Envelope>`)
+			}
+
+		case strings.Contains(body, "<Unsubscribe"):
+			close(unsubscribed)
+			io.WriteString(w, `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">`+ //nolint:errcheck
+				`<env:Body><UnsubscribeResponse/></env:Body></env:Envelope>`)
+
+		default:
+			t.Errorf("unexpected request: %s", body)
+		}
+	}))
+	defer srv.Close()
+
+	motion := make(chan bool, 10)
+
+	c := &EventClient{
+		URL: "http://myuser:mypass@" + strings.TrimPrefix(srv.URL, "http://") + "/onvif/Events",
+		OnMotion: func(v bool) {
+			motion <- v
+		},
+		Parent: test.NilLogger,
+	}
+	err := c.Initialize()
+	require.NoError(t, err)
+
+	require.Equal(t, true, <-motion)
+	require.Equal(t, false, <-motion)
+
+	c.Close()
+	<-unsubscribed
+}
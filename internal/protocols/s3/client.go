@@ -0,0 +1,336 @@
+// Package s3 contains a client for S3-compatible object storages.
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Minute
+
+// IsURL checks whether a string is the URL of a bucket.
+func IsURL(v string) bool {
+	return strings.HasPrefix(v, "s3://") || strings.HasPrefix(v, "s3+http://")
+}
+
+// Client is a client of a bucket of a S3-compatible object storage.
+// Requests are path-style and are signed with AWS Signature Version 4.
+type Client struct {
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	HTTPClient *http.Client
+}
+
+// ParseURL allocates a Client from a URL in the format
+// s3://[access_key:secret_key@]host/bucket[/prefix][?region=region].
+// s3+http:// can be used to reach buckets without TLS.
+// When credentials are not in the URL, they are read from the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+func ParseURL(v string) (*Client, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "s3" && u.Scheme != "s3+http" {
+		return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+
+	parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)
+	if u.Host == "" || parts[0] == "" {
+		return nil, fmt.Errorf("host and bucket are required")
+	}
+
+	c := &Client{
+		Bucket:     parts[0],
+		Region:     u.Query().Get("region"),
+		HTTPClient: &http.Client{Timeout: defaultTimeout},
+	}
+
+	if u.Scheme == "s3+http" {
+		c.Endpoint = "http://" + u.Host
+	} else {
+		c.Endpoint = "https://" + u.Host
+	}
+
+	if len(parts) == 2 {
+		c.Prefix = parts[1]
+	}
+
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+
+	if u.User != nil {
+		c.AccessKey = u.User.Username()
+		c.SecretKey, _ = u.User.Password()
+	} else {
+		c.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		c.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+
+	return c, nil
+}
+
+// Key returns the key of an object, given its path relative to the prefix.
+func (c *Client) Key(rel string) string {
+	return path.Join(c.Prefix, rel)
+}
+
+// URL returns the URL of an object, that doesn't contain the host nor credentials.
+func (c *Client) URL(key string) string {
+	return "s3://" + c.Bucket + "/" + key
+}
+
+// KeyFromURL returns the key of an object given its URL.
+func (c *Client) KeyFromURL(v string) (string, bool) {
+	return strings.CutPrefix(v, "s3://"+c.Bucket+"/")
+}
+
+// Put uploads an object.
+func (c *Client) Put(key string, r io.Reader, size int64) error {
+	req, err := c.newRequest(http.MethodPut, key, nil, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// Head returns size and modification time of an object.
+// It returns fs.ErrNotExist when the object doesn't exist.
+func (c *Client) Head(key string) (int64, time.Time, error) {
+	req, err := c.newRequest(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	res.Body.Close()
+
+	modTime, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+
+	return res.ContentLength, modTime, nil
+}
+
+// GetRange downloads a part of an object.
+func (c *Client) GetRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	req, err := c.newRequest(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+length-1, 10))
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// Object is an object returned by List.
+type Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type listResult struct {
+	Contents              []Object `xml:"Contents"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// List calls cb with all objects whose key starts with prefix.
+func (c *Client) List(prefix string, cb func(Object) error) error {
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := c.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+
+		res, err := c.do(req)
+		if err != nil {
+			return err
+		}
+
+		var lr listResult
+		err = xml.NewDecoder(io.LimitReader(res.Body, 64*1024*1024)).Decode(&lr)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range lr.Contents {
+			err = cb(obj)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !lr.IsTruncated || lr.NextContinuationToken == "" {
+			return nil
+		}
+		token = lr.NextContinuationToken
+	}
+}
+
+func (c *Client) newRequest(method string, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = "/" + c.Bucket
+	u.RawPath = "/" + uriEncode(c.Bucket, false)
+
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + uriEncode(key, false)
+	}
+
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.sign(req, u.RawPath, u.RawQuery, time.Now().UTC())
+
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, fs.ErrNotExist
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		buf, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		res.Body.Close()
+		return nil, fmt.Errorf("bad status code: %d (%s)", res.StatusCode, strings.TrimSpace(string(buf)))
+	}
+
+	return res, nil
+}
+
+// sign signs a request with AWS Signature Version 4.
+// The payload is not hashed, in order not to read files twice.
+func (c *Client) sign(req *http.Request, rawPath string, rawQuery string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := "UNSIGNED-PAYLOAD"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := req.Method + "\n" +
+		rawPath + "\n" +
+		rawQuery + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n" +
+		"\n" +
+		signedHeaders + "\n" +
+		payloadHash
+
+	scope := date + "/" + c.Region + "/s3/aws4_request"
+
+	h := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+hex.EncodeToString(hmacSHA256(key, stringToSign)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes a query as required by AWS Signature Version 4.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, uriEncode(k, true)+"="+uriEncode(query.Get(k), true))
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes all characters except unreserved ones,
+// as required by AWS Signature Version 4.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package s3
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURL(t *testing.T) {
+	c, err := ParseURL("s3://mykey:mysecret@myhost:9000/mybucket/my/prefix?region=eu-west-1")
+	require.NoError(t, err)
+	require.Equal(t, "https://myhost:9000", c.Endpoint)
+	require.Equal(t, "mybucket", c.Bucket)
+	require.Equal(t, "my/prefix", c.Prefix)
+	require.Equal(t, "eu-west-1", c.Region)
+	require.Equal(t, "mykey", c.AccessKey)
+	require.Equal(t, "mysecret", c.SecretKey)
+
+	require.Equal(t, "my/prefix/a/b.mp4", c.Key("a/b.mp4"))
+	require.Equal(t, "s3://mybucket/my/prefix/a/b.mp4", c.URL(c.Key("a/b.mp4")))
+
+	key, ok := c.KeyFromURL("s3://mybucket/my/prefix/a/b.mp4")
+	require.True(t, ok)
+	require.Equal(t, "my/prefix/a/b.mp4", key)
+
+	_, err = ParseURL("s3://myhost")
+	require.Error(t, err)
+
+	_, err = ParseURL("http://myhost/mybucket")
+	require.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 "))
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/mybucket":
+			require.Equal(t, "2", r.URL.Query().Get("list-type"))
+			require.Equal(t, "myprefix/", r.URL.Query().Get("prefix"))
+
+			// objects are returned in two pages
+			if r.URL.Query().Get("continuation-token") == "" {
+				io.WriteString(w, `<ListBucketResult><IsTruncated>true</IsTruncated>`+ //nolint:errcheck
+					`<NextContinuationToken>tok</NextContinuationToken>`+
+					`<Contents><Key>myprefix/a.mp4</Key><Size>3</Size>`+
+					`<LastModified>2009-05-20T22:15:25.000Z</LastModified></Contents>`+
+					`</ListBucketResult>`)
+			} else {
+				require.Equal(t, "tok", r.URL.Query().Get("continuation-token"))
+				io.WriteString(w, `<ListBucketResult><IsTruncated>false</IsTruncated>`+ //nolint:errcheck
+					`<Contents><Key>myprefix/b.mp4</Key><Size>5</Size>`+
+					`<LastModified>2009-05-20T22:15:26.000Z</LastModified></Contents>`+
+					`</ListBucketResult>`)
+			}
+
+		case r.Method == http.MethodHead && r.URL.Path == "/mybucket/myprefix/a.mp4":
+			w.Header().Set("Content-Length", "3")
+			w.Header().Set("Last-Modified", "Wed, 20 May 2009 22:15:25 GMT")
+
+		case r.Method == http.MethodGet && r.URL.Path == "/mybucket/myprefix/a.mp4":
+			require.Equal(t, "bytes=1-2", r.Header.Get("Range"))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte{2, 3}) //nolint:errcheck
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	c, err := ParseURL("s3+http://mykey:mysecret@" + strings.TrimPrefix(s.URL, "http://") + "/mybucket/myprefix")
+	require.NoError(t, err)
+
+	var objects []Object
+	err = c.List("myprefix/", func(obj Object) error {
+		objects = append(objects, obj)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	require.Equal(t, "myprefix/a.mp4", objects[0].Key)
+	require.Equal(t, int64(3), objects[0].Size)
+	require.Equal(t, "myprefix/b.mp4", objects[1].Key)
+
+	size, modTime, err := c.Head("myprefix/a.mp4")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), size)
+	require.Equal(t, 2009, modTime.Year())
+
+	r, err := c.GetRange("myprefix/a.mp4", 1, 2)
+	require.NoError(t, err)
+	buf, err := io.ReadAll(r)
+	r.Close()
+	require.NoError(t, err)
+	require.Equal(t, []byte{2, 3}, buf)
+
+	_, _, err = c.Head("myprefix/missing.mp4")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -1,18 +1,63 @@
 package record
 
 import (
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
+// segments whose distance is lower than this are considered contiguous,
+// like in playback.
+const gapTolerance = 500 * time.Millisecond
+
+// maximum distance between timestamps of consecutive samples
+// before a timestamp jump is detected.
+const timestampJumpTolerance = 5 * time.Second
+
+// number of segments that are used to compute the average bitrate.
+const bitrateWindow = 5
+
 // OnSegmentCreateFunc is the prototype of the function passed as OnSegmentCreate
 type OnSegmentCreateFunc = func(path string)
 
+// SegmentInfo contains informations about a completed segment.
+type SegmentInfo struct {
+	Start         time.Time
+	Duration      time.Duration
+	Size          int64
+	KeyframeCount int
+	FirstKeyframe time.Time
+	LastKeyframe  time.Time
+	Codecs        []string
+	Discontinuity Discontinuity
+	Fingerprints  []uint64
+}
+
+func (i *SegmentInfo) addKeyframe(t time.Time) {
+	if i.KeyframeCount == 0 {
+		i.FirstKeyframe = t
+	}
+	i.LastKeyframe = t
+	i.KeyframeCount++
+}
+
+func (i *SegmentInfo) addFingerprint(payload []byte) {
+	if len(i.Fingerprints) >= fingerprintMaxCount {
+		return
+	}
+
+	if v, ok := fingerprint(payload); ok {
+		i.Fingerprints = append(i.Fingerprints, v)
+	}
+}
+
 // OnSegmentCompleteFunc is the prototype of the function passed as OnSegmentComplete
-type OnSegmentCompleteFunc = func(path string, duration time.Duration)
+type OnSegmentCompleteFunc = func(path string, info SegmentInfo)
 
 // Agent writes recordings to disk.
 type Agent struct {
@@ -22,14 +67,28 @@ type Agent struct {
 	PartDuration      time.Duration
 	SegmentDuration   time.Duration
 	PathName          string
+	IndexPath         string
+	Checksum          bool
+	MinBitrate        int
+	MaxBitrate        int
+	MirrorPath        string
+	MaxReaders        int
 	Stream            *stream.Stream
 	OnSegmentCreate   OnSegmentCreateFunc
 	OnSegmentComplete OnSegmentCompleteFunc
+	Registry          *Registry
+	Notifier          *notify.Notifier
 	Parent            logger.Writer
 
 	restartPause time.Duration
 
 	currentInstance *agentInstance
+	lastSegmentEnd  time.Time
+
+	recentSegments   []SegmentInfo
+	bitrateOutOfBand bool
+
+	mirror *mirror
 
 	terminate chan struct{}
 	done      chan struct{}
@@ -42,7 +101,70 @@ func (w *Agent) Initialize() {
 		}
 	}
 	if w.OnSegmentComplete == nil {
-		w.OnSegmentComplete = func(string, time.Duration) {
+		w.OnSegmentComplete = func(string, SegmentInfo) {
+		}
+	}
+	if w.Notifier != nil {
+		onSegmentCreate := w.OnSegmentCreate
+		w.OnSegmentCreate = func(path string) {
+			w.Notifier.Publish(notify.Event{
+				Type:   notify.EventSegmentCreate,
+				Path:   w.PathName,
+				Fields: map[string]string{"segmentPath": path},
+			})
+			onSegmentCreate(path)
+		}
+
+		onSegmentComplete := w.OnSegmentComplete
+		w.OnSegmentComplete = func(path string, info SegmentInfo) {
+			w.detectGap(info)
+			w.Notifier.Publish(notify.Event{
+				Type: notify.EventSegmentComplete,
+				Path: w.PathName,
+				Fields: map[string]string{
+					"segmentPath": path,
+					"duration":    strconv.FormatFloat(info.Duration.Seconds(), 'f', -1, 64),
+					"size":        strconv.FormatInt(info.Size, 10),
+				},
+			})
+			onSegmentComplete(path, info)
+		}
+	}
+	if w.MirrorPath != "" {
+		w.mirror = &mirror{
+			agent: w,
+		}
+		w.mirror.initialize()
+
+		// segments are mirrored after their checksum has been written
+		onSegmentComplete := w.OnSegmentComplete
+		w.OnSegmentComplete = func(path string, info SegmentInfo) {
+			w.mirror.push(path)
+			onSegmentComplete(path, info)
+		}
+	}
+	if w.Checksum {
+		onSegmentComplete := w.OnSegmentComplete
+		w.OnSegmentComplete = func(path string, info SegmentInfo) {
+			err := ChecksumWrite(path)
+			if err != nil {
+				w.Log(logger.Warn, "unable to write checksum: %v", err)
+			}
+			onSegmentComplete(path, info)
+		}
+	}
+	if w.MinBitrate != 0 || w.MaxBitrate != 0 {
+		onSegmentComplete := w.OnSegmentComplete
+		w.OnSegmentComplete = func(path string, info SegmentInfo) {
+			w.checkBitrate(info)
+			onSegmentComplete(path, info)
+		}
+	}
+	if w.IndexPath != "" {
+		onSegmentComplete := w.OnSegmentComplete
+		w.OnSegmentComplete = func(path string, info SegmentInfo) {
+			w.addToIndex(path, info)
+			onSegmentComplete(path, info)
 		}
 	}
 	if w.restartPause == 0 {
@@ -57,6 +179,11 @@ func (w *Agent) Initialize() {
 	}
 	w.currentInstance.initialize()
 
+	w.Notifier.Publish(notify.Event{
+		Type: notify.EventRecordingStart,
+		Path: w.PathName,
+	})
+
 	go w.run()
 }
 
@@ -70,6 +197,15 @@ func (w *Agent) Close() {
 	w.Log(logger.Info, "recording stopped")
 	close(w.terminate)
 	<-w.done
+
+	if w.mirror != nil {
+		w.mirror.close()
+	}
+
+	w.Notifier.Publish(notify.Event{
+		Type: notify.EventRecordingStop,
+		Path: w.PathName,
+	})
 }
 
 func (w *Agent) run() {
@@ -96,3 +232,103 @@ func (w *Agent) run() {
 		w.currentInstance.initialize()
 	}
 }
+
+// detectGap publishes an event when a segment doesn't start
+// where the previous one ended, since the stream was interrupted.
+func (w *Agent) detectGap(info SegmentInfo) {
+	if !w.lastSegmentEnd.IsZero() {
+		gap := info.Start.Sub(w.lastSegmentEnd)
+
+		if gap > gapTolerance {
+			w.Notifier.Publish(notify.Event{
+				Type: notify.EventGapDetected,
+				Path: w.PathName,
+				Fields: map[string]string{
+					"start":    w.lastSegmentEnd.Format(time.RFC3339Nano),
+					"duration": strconv.FormatFloat(gap.Seconds(), 'f', -1, 64),
+				},
+			})
+		}
+	}
+
+	w.lastSegmentEnd = info.Start.Add(info.Duration)
+}
+
+// timestampJumped checks whether timestamps jumped between two consecutive samples.
+func timestampJumped(prevDTS time.Duration, dts time.Duration) bool {
+	d := dts - prevDTS
+	return d > timestampJumpTolerance || d < -timestampJumpTolerance
+}
+
+// checkBitrate publishes an event when the average bitrate of the last segments
+// leaves the band delimited by MinBitrate and MaxBitrate,
+// since the source may have changed its settings.
+func (w *Agent) checkBitrate(info SegmentInfo) {
+	if info.Duration <= 0 {
+		return
+	}
+
+	w.recentSegments = append(w.recentSegments, info)
+	if len(w.recentSegments) > bitrateWindow {
+		w.recentSegments = w.recentSegments[1:]
+	}
+
+	var size int64
+	var duration time.Duration
+
+	for _, seg := range w.recentSegments {
+		size += seg.Size
+		duration += seg.Duration
+	}
+
+	bitrate := int(float64(size*8) / duration.Seconds())
+
+	outOfBand := (w.MinBitrate != 0 && bitrate < w.MinBitrate) ||
+		(w.MaxBitrate != 0 && bitrate > w.MaxBitrate)
+
+	// publish an event when the bitrate leaves the band, not for every segment
+	if outOfBand && !w.bitrateOutOfBand {
+		w.Log(logger.Warn, "average bitrate (%d bit/s) is outside of the configured band", bitrate)
+
+		w.Notifier.Publish(notify.Event{
+			Type: notify.EventBitrateDeviation,
+			Path: w.PathName,
+			Fields: map[string]string{
+				"bitrate":    strconv.Itoa(bitrate),
+				"minBitrate": strconv.Itoa(w.MinBitrate),
+				"maxBitrate": strconv.Itoa(w.MaxBitrate),
+			},
+		})
+	}
+
+	w.bitrateOutOfBand = outOfBand
+}
+
+func (w *Agent) addToIndex(path string, info SegmentInfo) {
+	// other instances may have a different working directory
+	path, _ = filepath.Abs(path)
+
+	format := w.Format
+
+	err := IndexAdd(w.IndexPath, w.PathName, IndexEntry{
+		Start:         info.Start,
+		Duration:      info.Duration,
+		Path:          path,
+		Format:        &format,
+		Codecs:        info.Codecs,
+		Discontinuity: info.Discontinuity,
+		Fingerprints:  info.Fingerprints,
+	})
+	if err != nil {
+		w.Log(logger.Warn, "unable to update index: %v", err)
+		return
+	}
+
+	w.Registry.SegmentsChanged(w.PathName)
+
+	w.Notifier.Publish(notify.Event{
+		Type:   notify.EventIndexAdd,
+		Path:   w.PathName,
+		Fields: map[string]string{"segmentPath": path},
+	})
+}
@@ -156,6 +156,9 @@ func TestAgent(t *testing.T) {
 
 			n := 0
 
+			registry := &Registry{}
+			registry.Initialize()
+
 			w := &Agent{
 				WriteQueueSize:  1024,
 				PathFormat:      recordPath,
@@ -164,6 +167,7 @@ func TestAgent(t *testing.T) {
 				SegmentDuration: 1 * time.Second,
 				PathName:        "mypath",
 				Stream:          stream,
+				Registry:        registry,
 				OnSegmentCreate: func(segPath string) {
 					switch n {
 					case 0:
@@ -173,20 +177,29 @@ func TestAgent(t *testing.T) {
 					default:
 						require.Equal(t, filepath.Join(dir, "mypath", "2010-05-20_22-15-25-000000."+ext), segPath)
 					}
+					require.True(t, registry.SegmentIsCreating(segPath))
 					segCreated <- struct{}{}
 				},
-				OnSegmentComplete: func(segPath string, du time.Duration) {
+				OnSegmentComplete: func(segPath string, info SegmentInfo) {
 					switch n {
 					case 0:
 						require.Equal(t, filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000."+ext), segPath)
-						require.Equal(t, 2*time.Second, du)
+						require.Equal(t, 2*time.Second, info.Duration)
+						require.NotZero(t, info.Size)
+						require.NotZero(t, info.KeyframeCount)
+						require.Equal(t, time.Date(2008, 0o5, 20, 22, 15, 25, 0, time.UTC), info.FirstKeyframe.UTC())
+						require.Contains(t, info.Codecs, "H264")
 					case 1:
 						require.Equal(t, filepath.Join(dir, "mypath", "2008-05-20_22-16-25-000000."+ext), segPath)
-						require.Equal(t, 100*time.Millisecond, du)
+						require.Equal(t, 100*time.Millisecond, info.Duration)
 					default:
 						require.Equal(t, filepath.Join(dir, "mypath", "2010-05-20_22-15-25-000000."+ext), segPath)
-						require.Equal(t, 100*time.Millisecond, du)
+						require.Equal(t, 100*time.Millisecond, info.Duration)
 					}
+					openSegs := registry.OpenSegments("mypath")
+					require.Len(t, openSegs, 1)
+					require.Equal(t, segPath, openSegs[0].Path)
+					require.Equal(t, f, openSegs[0].Format)
 					n++
 					segDone <- struct{}{}
 				},
@@ -306,6 +319,8 @@ func TestAgent(t *testing.T) {
 
 			_, err = os.Stat(filepath.Join(dir, "mypath", "2010-05-20_22-15-25-000000."+ext))
 			require.NoError(t, err)
+
+			require.Empty(t, registry.OpenSegments("mypath"))
 		})
 	}
 }
@@ -407,3 +422,152 @@ func TestAgentFMP4NegativeDTS(t *testing.T) {
 
 	require.Equal(t, true, found)
 }
+
+func TestAgentTimestampJump(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{{
+		Type: description.MediaTypeVideo,
+		Formats: []rtspformat.Format{&rtspformat.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+		}},
+	}}}
+
+	for _, ca := range []string{"fmp4", "mpegts"} {
+		t.Run(ca, func(t *testing.T) {
+			stream, err := stream.New(
+				1460,
+				desc,
+				true,
+				test.NilLogger,
+			)
+			require.NoError(t, err)
+			defer stream.Close()
+
+			dir, err := os.MkdirTemp("", "mediamtx-agent")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			var f conf.RecordFormat
+			if ca == "fmp4" {
+				f = conf.RecordFormatFMP4
+			} else {
+				f = conf.RecordFormatMPEGTS
+			}
+
+			segDone := make(chan SegmentInfo, 2)
+
+			w := &Agent{
+				WriteQueueSize:  1024,
+				PathFormat:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				Format:          f,
+				PartDuration:    100 * time.Millisecond,
+				SegmentDuration: 10 * time.Second,
+				PathName:        "mypath",
+				Stream:          stream,
+				OnSegmentComplete: func(_ string, info SegmentInfo) {
+					segDone <- info
+				},
+				Parent: test.NilLogger,
+			}
+			w.Initialize()
+
+			for i, pts := range []time.Duration{
+				0,
+				100 * time.Millisecond,
+				200 * time.Millisecond,
+				60 * time.Second,
+				60*time.Second + 100*time.Millisecond,
+			} {
+				stream.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+					Base: unit.Base{
+						PTS: pts,
+						NTP: time.Date(2008, 0o5, 20, 22, 15, 25+i, 0, time.UTC),
+					},
+					AU: [][]byte{
+						test.FormatH264.SPS,
+						test.FormatH264.PPS,
+						{5}, // IDR
+					},
+				})
+			}
+
+			info := <-segDone
+			require.Equal(t, DiscontinuityStart, info.Discontinuity)
+			require.Equal(t, 200*time.Millisecond, info.Duration)
+
+			w.Close()
+
+			info = <-segDone
+			require.Equal(t, DiscontinuityTimestampJump, info.Discontinuity)
+			require.Equal(t, time.Date(2008, 0o5, 20, 22, 15, 28, 0, time.UTC), info.Start.UTC())
+		})
+	}
+}
+
+func TestAgentBitrate(t *testing.T) {
+	w := &Agent{
+		PathName:   "mypath",
+		MinBitrate: 500000,
+		MaxBitrate: 4000000,
+		Parent:     test.NilLogger,
+	}
+
+	// 2 Mbit/s
+	for i := 0; i < bitrateWindow; i++ {
+		w.checkBitrate(SegmentInfo{Duration: 10 * time.Second, Size: 2500000})
+		require.False(t, w.bitrateOutOfBand)
+	}
+
+	// 16 Mbit/s, that moves the average to 4.8 Mbit/s
+	w.checkBitrate(SegmentInfo{Duration: 10 * time.Second, Size: 20000000})
+	require.True(t, w.bitrateOutOfBand)
+
+	// the first segment leaves the window
+	for i := 0; i < bitrateWindow; i++ {
+		w.checkBitrate(SegmentInfo{Duration: 10 * time.Second, Size: 2500000})
+	}
+	require.False(t, w.bitrateOutOfBand)
+
+	// segments without duration are ignored
+	w.checkBitrate(SegmentInfo{Size: 20000000})
+	require.False(t, w.bitrateOutOfBand)
+	require.Len(t, w.recentSegments, bitrateWindow)
+}
+
+func TestAgentMirror(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	segPath := filepath.Join(dir, "recordings", "mypath", "2008-05-20_22-15-25-000000.mp4")
+
+	err = os.MkdirAll(filepath.Dir(segPath), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(segPath, []byte{1, 2, 3, 4}, 0o644)
+	require.NoError(t, err)
+
+	err = ChecksumWrite(segPath)
+	require.NoError(t, err)
+
+	w := &Agent{
+		PathFormat: filepath.Join(dir, "recordings", "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		PathName:   "mypath",
+		MirrorPath: filepath.Join(dir, "mirror"),
+		Parent:     test.NilLogger,
+	}
+
+	m := &mirror{agent: w}
+	m.initialize()
+	m.push(segPath)
+	m.close()
+
+	require.Equal(t, 0, m.backlogSize())
+
+	buf, err := os.ReadFile(filepath.Join(dir, "mirror", "mypath", "2008-05-20_22-15-25-000000.mp4"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3, 4}, buf)
+
+	err = ChecksumVerify(filepath.Join(dir, "mirror", "mypath", "2008-05-20_22-15-25-000000.mp4"))
+	require.NoError(t, err)
+}
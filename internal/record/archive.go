@@ -0,0 +1,83 @@
+package record
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bluenviron/mediamtx/internal/protocols/s3"
+)
+
+// archiveTarget stores expired segments in cold storage.
+type archiveTarget interface {
+	// store copies a file into the target, with the given path relative to the root of the target,
+	// and returns a description of the destination.
+	store(fpath string, rel string) (string, error)
+}
+
+// newArchiveTarget allocates the target of an archive destination,
+// that is a local directory or a S3-compatible bucket.
+func newArchiveTarget(dest string) (archiveTarget, error) {
+	if !s3.IsURL(dest) {
+		return &archiveDir{path: dest}, nil
+	}
+
+	client, err := s3.ParseURL(dest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 destination: %w", err)
+	}
+
+	return &archiveS3{client: client}, nil
+}
+
+// archiveDir is a local directory, that can be on a different file system.
+type archiveDir struct {
+	path string
+}
+
+func (t *archiveDir) store(fpath string, rel string) (string, error) {
+	dest := filepath.Join(t.path, rel)
+
+	err := os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(fpath, dest)
+	if err != nil {
+		// renaming fails when the directory is on a different file system
+		err = mirrorCopyFile(fpath, dest)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return dest, nil
+}
+
+// archiveS3 is a bucket of a S3-compatible object storage.
+type archiveS3 struct {
+	client *s3.Client
+}
+
+func (t *archiveS3) store(fpath string, rel string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	key := t.client.Key(filepath.ToSlash(rel))
+
+	err = t.client.Put(key, f, fi.Size())
+	if err != nil {
+		return "", err
+	}
+
+	return t.client.URL(key), nil
+}
@@ -0,0 +1,48 @@
+package record
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveS3(t *testing.T) {
+	var gotPath string
+	var gotAuth string
+	var gotBody []byte
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization")
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer s.Close()
+
+	dir, err := os.MkdirTemp("", "mediamtx-archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "seg.mp4")
+	err = os.WriteFile(fpath, []byte{1, 2, 3}, 0o644)
+	require.NoError(t, err)
+
+	target, err := newArchiveTarget("s3+http://mykey:mysecret@" + strings.TrimPrefix(s.URL, "http://") +
+		"/mybucket/myprefix?region=eu-west-1")
+	require.NoError(t, err)
+
+	dest, err := target.store(fpath, filepath.Join("my path", "seg.mp4"))
+	require.NoError(t, err)
+	require.Equal(t, "s3://mybucket/myprefix/my path/seg.mp4", dest)
+
+	require.Equal(t, "/mybucket/myprefix/my%20path/seg.mp4", gotPath)
+	require.Equal(t, []byte{1, 2, 3}, gotBody)
+	require.True(t, strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=mykey/"))
+	require.Contains(t, gotAuth, "/eu-west-1/s3/aws4_request, SignedHeaders=")
+}
@@ -0,0 +1,184 @@
+package record
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrChecksumNotFound is returned when a segment doesn't have a checksum.
+var ErrChecksumNotFound = errors.New("checksum not found")
+
+// ErrChecksumMismatch is returned when the content of a segment doesn't match its checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrChecksumRepaired is returned when the content of a segment doesn't match its checksum,
+// but matches the checksum written after the segment was repaired.
+var ErrChecksumRepaired = errors.New("segment has been repaired")
+
+// ChecksumPath returns the path of the checksum sidecar of a segment.
+func ChecksumPath(segmentPath string) string {
+	return segmentPath + ".sha256"
+}
+
+func openFile(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func checksumCompute(segmentPath string, open func(string) (io.ReadCloser, error)) ([]byte, error) {
+	f, err := open(segmentPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// ChecksumWrite computes the checksum of a segment and writes it into a sidecar,
+// in the same format of the sha256sum utility.
+func ChecksumWrite(segmentPath string) error {
+	sum, err := checksumCompute(segmentPath, openFile)
+	if err != nil {
+		return err
+	}
+
+	content := hex.EncodeToString(sum) + "  " + filepath.Base(segmentPath) + "\n"
+
+	return checksumWriteFile(segmentPath, []byte(content))
+}
+
+// ChecksumRepair adds the checksum of a repaired segment to its sidecar.
+// The original checksum is kept, in order not to legitimate a segment that failed verification;
+// the new one is appended as a second line, that allows to tell repaired segments from altered ones.
+func ChecksumRepair(segmentPath string) error {
+	buf, err := os.ReadFile(ChecksumPath(segmentPath))
+	if err != nil {
+		return err
+	}
+
+	lines := bytes.SplitN(buf, []byte{'\n'}, 2)
+	original := bytes.TrimSpace(lines[0])
+	if len(original) == 0 {
+		return fmt.Errorf("invalid checksum file")
+	}
+
+	sum, err := checksumCompute(segmentPath, openFile)
+	if err != nil {
+		return err
+	}
+
+	content := string(original) + "\n" + hex.EncodeToString(sum) + "  " + filepath.Base(segmentPath) + "\n"
+
+	return checksumWriteFile(segmentPath, []byte(content))
+}
+
+func checksumWriteFile(segmentPath string, content []byte) error {
+	tmp := ChecksumPath(segmentPath) + ".tmp"
+
+	err := os.WriteFile(tmp, content, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, ChecksumPath(segmentPath))
+}
+
+// ChecksumVerify checks that the content of a segment matches its checksum sidecar.
+// ErrChecksumRepaired is returned when the segment matches the checksum of its repaired version only.
+func ChecksumVerify(segmentPath string) error {
+	return ChecksumVerifyWith(segmentPath, openFile)
+}
+
+// ChecksumVerifyWith is like ChecksumVerify, but reads files with the given function,
+// in order to verify segments that are not in the local file system.
+func ChecksumVerifyWith(segmentPath string, open func(string) (io.ReadCloser, error)) error {
+	expected, err := checksumReadExpected(segmentPath, open)
+	if err != nil {
+		return err
+	}
+
+	sum, err := checksumCompute(segmentPath, open)
+	if err != nil {
+		return err
+	}
+
+	return checksumCompare(sum, expected)
+}
+
+// ChecksumMatchWith checks that a checksum, computed by the caller while reading a segment,
+// matches the checksum sidecar of the segment. Errors are the same of ChecksumVerify.
+func ChecksumMatchWith(segmentPath string, sum []byte, open func(string) (io.ReadCloser, error)) error {
+	expected, err := checksumReadExpected(segmentPath, open)
+	if err != nil {
+		return err
+	}
+
+	return checksumCompare(sum, expected)
+}
+
+func checksumReadExpected(segmentPath string, open func(string) (io.ReadCloser, error)) ([][]byte, error) {
+	buf, err := readAll(open, ChecksumPath(segmentPath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrChecksumNotFound
+		}
+		return nil, err
+	}
+
+	var expected [][]byte
+
+	for _, line := range bytes.Split(buf, []byte{'\n'}) {
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		sum, err2 := hex.DecodeString(string(fields[0]))
+		if err2 != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid checksum file")
+		}
+
+		expected = append(expected, sum)
+	}
+
+	if len(expected) == 0 {
+		return nil, fmt.Errorf("invalid checksum file")
+	}
+
+	return expected, nil
+}
+
+func checksumCompare(sum []byte, expected [][]byte) error {
+	if bytes.Equal(sum, expected[0]) {
+		return nil
+	}
+
+	if len(expected) > 1 && bytes.Equal(sum, expected[len(expected)-1]) {
+		return ErrChecksumRepaired
+	}
+
+	return ErrChecksumMismatch
+}
+
+func readAll(open func(string) (io.ReadCloser, error), name string) ([]byte, error) {
+	f, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, 1024))
+}
@@ -0,0 +1,76 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-checksum")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "2008-05-20_22-15-25-000125.mp4")
+
+	err = os.WriteFile(fpath, []byte{1, 2, 3, 4}, 0o644)
+	require.NoError(t, err)
+
+	err = ChecksumVerify(fpath)
+	require.ErrorIs(t, err, ErrChecksumNotFound)
+
+	err = ChecksumWrite(fpath)
+	require.NoError(t, err)
+
+	buf, err := os.ReadFile(ChecksumPath(fpath))
+	require.NoError(t, err)
+	require.Equal(t, "9f64a747e1b97f131fabb6b447296c9b6f0201e79fb3c5356e6c77e89b6a806a"+
+		"  2008-05-20_22-15-25-000125.mp4\n", string(buf))
+
+	err = ChecksumVerify(fpath)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, []byte{1, 2, 3, 5}, 0o644)
+	require.NoError(t, err)
+
+	err = ChecksumVerify(fpath)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+}
+
+func TestChecksumRepair(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-checksum")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "2008-05-20_22-15-25-000125.mp4")
+
+	err = os.WriteFile(fpath, []byte{1, 2, 3, 4}, 0o644)
+	require.NoError(t, err)
+
+	err = ChecksumWrite(fpath)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, []byte{1, 2}, 0o644)
+	require.NoError(t, err)
+
+	err = ChecksumRepair(fpath)
+	require.NoError(t, err)
+
+	buf, err := os.ReadFile(ChecksumPath(fpath))
+	require.NoError(t, err)
+	require.Equal(t, "9f64a747e1b97f131fabb6b447296c9b6f0201e79fb3c5356e6c77e89b6a806a"+
+		"  2008-05-20_22-15-25-000125.mp4\n"+
+		"a12871fee210fb8619291eaea194581cbd2531e4b23759d225f6806923f63222"+
+		"  2008-05-20_22-15-25-000125.mp4\n", string(buf))
+
+	err = ChecksumVerify(fpath)
+	require.ErrorIs(t, err, ErrChecksumRepaired)
+
+	err = os.WriteFile(fpath, []byte{1, 3}, 0o644)
+	require.NoError(t, err)
+
+	err = ChecksumVerify(fpath)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+}
@@ -2,28 +2,100 @@ package record
 
 import (
 	"context"
+	"errors"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
 )
 
 var timeNow = time.Now
 
+// runs of the periodic cleaner and on-demand runs are not allowed to overlap.
+var cleanerMutex sync.Mutex
+
 // CleanerEntry is a cleaner entry.
 type CleanerEntry struct {
-	Path        string
-	Format      conf.RecordFormat
-	DeleteAfter time.Duration
+	Path             string
+	Format           conf.RecordFormat
+	DeleteAfter      time.Duration
+	DeleteQuietAfter time.Duration
+	SegmentDuration  time.Duration
+	IndexPath        string
+	AnnotationsFile  string
+	ArchiveTo        string
+	// when set, the entry is cleaned at scheduled times instead of periodically
+	Schedule conf.CronSchedule
+}
+
+// NewCleanerEntry returns the cleaner entry of a path configuration,
+// and whether recordings of the path expire.
+func NewCleanerEntry(pathConf *conf.Path, annotationsFile string) (CleanerEntry, bool) {
+	if !pathConf.Record || (pathConf.RecordDeleteAfter == 0 && pathConf.RecordDeleteQuietAfter == 0) {
+		return CleanerEntry{}, false
+	}
+
+	entry := CleanerEntry{
+		Path:        pathConf.RecordPath,
+		Format:      pathConf.RecordFormat,
+		DeleteAfter: time.Duration(pathConf.RecordDeleteAfter),
+		IndexPath:   pathConf.RecordIndexPath,
+		ArchiveTo:   pathConf.RecordArchiveTo,
+		Schedule:    pathConf.RecordDeleteSchedule,
+	}
+
+	if pathConf.RecordDeleteQuietAfter != 0 {
+		entry.DeleteQuietAfter = time.Duration(pathConf.RecordDeleteQuietAfter)
+		entry.SegmentDuration = time.Duration(pathConf.RecordSegmentDuration)
+		entry.AnnotationsFile = annotationsFile
+	}
+
+	return entry, true
+}
+
+// CleanedSegment is a segment that has been removed or archived by the cleaner.
+type CleanedSegment struct {
+	Path  string
+	Start time.Time
+	File  string
 }
 
-// Cleaner removes expired recording segments from disk.
+// Cleanup cleans an entry immediately, limiting the cleanup to segments of a path when pathName is not empty.
+// When dryRun is true, expired segments are returned without being removed or archived.
+func Cleanup(
+	e CleanerEntry,
+	pathName string,
+	dryRun bool,
+	registry *Registry,
+	notifier *notify.Notifier,
+	parent logger.Writer,
+) ([]CleanedSegment, error) {
+	c := &Cleaner{
+		Registry: registry,
+		Notifier: notifier,
+		Parent:   parent,
+	}
+	return c.doRunEntry(&e, pathName, dryRun)
+}
+
+type cleanerSegment struct {
+	fpath string
+	pa    Path
+}
+
+// Cleaner removes expired recording segments from disk,
+// or moves them into an archive.
 type Cleaner struct {
-	Entries []CleanerEntry
-	Parent  logger.Writer
+	Entries  []CleanerEntry
+	Notifier *notify.Notifier
+	Registry *Registry
+	Parent   logger.Writer
 
 	ctx       context.Context
 	ctxCancel func()
@@ -55,17 +127,48 @@ func (c *Cleaner) run() {
 
 	interval := 30 * 60 * time.Second
 	for _, e := range c.Entries {
-		if interval > (e.DeleteAfter / 2) {
+		if e.DeleteAfter != 0 && interval > (e.DeleteAfter/2) {
 			interval = e.DeleteAfter / 2
 		}
+		if e.DeleteQuietAfter != 0 && interval > (e.DeleteQuietAfter/2) {
+			interval = e.DeleteQuietAfter / 2
+		}
 	}
 
-	c.doRun() //nolint:errcheck
+	// entries without a schedule are cleaned immediately and then periodically
+	now := time.Now()
+	nextRuns := make([]time.Time, len(c.Entries))
+	for i, e := range c.Entries {
+		nextRuns[i] = e.Schedule.Next(now)
+	}
 
 	for {
+		now = time.Now()
+		var next time.Time
+
+		for i, e := range c.Entries {
+			if e.Schedule == (conf.CronSchedule{}) {
+				if !nextRuns[i].After(now) {
+					c.doRunEntry(&e, "", false) //nolint:errcheck
+					nextRuns[i] = now.Add(interval)
+				}
+			} else if !nextRuns[i].IsZero() && !nextRuns[i].After(now) {
+				c.doRunEntry(&e, "", false) //nolint:errcheck
+				nextRuns[i] = e.Schedule.Next(now)
+			}
+
+			if !nextRuns[i].IsZero() && (next.IsZero() || nextRuns[i].Before(next)) {
+				next = nextRuns[i]
+			}
+		}
+
+		if next.IsZero() {
+			<-c.ctx.Done()
+			return
+		}
+
 		select {
-		case <-time.After(interval):
-			c.doRun()
+		case <-time.After(time.Until(next)):
 
 		case <-c.ctx.Done():
 			return
@@ -73,13 +176,10 @@ func (c *Cleaner) run() {
 	}
 }
 
-func (c *Cleaner) doRun() {
-	for _, e := range c.Entries {
-		c.doRunEntry(&e) //nolint:errcheck
-	}
-}
+func (c *Cleaner) doRunEntry(e *CleanerEntry, pathName string, dryRun bool) ([]CleanedSegment, error) {
+	cleanerMutex.Lock()
+	defer cleanerMutex.Unlock()
 
-func (c *Cleaner) doRunEntry(e *CleanerEntry) error {
 	entryPath := PathAddExtension(e.Path, e.Format)
 
 	// we have to convert to absolute paths
@@ -89,25 +189,138 @@ func (c *Cleaner) doRunEntry(e *CleanerEntry) error {
 	commonPath := CommonPath(entryPath)
 	now := timeNow()
 
+	var archive archiveTarget
+	if e.ArchiveTo != "" {
+		var err error
+		archive, err = newArchiveTarget(e.ArchiveTo)
+		if err != nil {
+			c.Log(logger.Warn, "unable to archive segments: %v", err)
+			return nil, err
+		}
+	}
+
+	// segments, grouped by path name
+	segments := make(map[string][]cleanerSegment)
+
 	filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
 		if err != nil {
 			return err
 		}
 
+		// archives can be placed inside the recording directory
+		if dir, ok := archive.(*archiveDir); ok && info.IsDir() && isSamePath(fpath, dir.path) {
+			return filepath.SkipDir
+		}
+
 		if !info.IsDir() {
 			var pa Path
 			ok := pa.Decode(entryPath, fpath)
-			if ok {
-				if now.Sub(pa.Start) > e.DeleteAfter {
-					c.Log(logger.Debug, "removing %s", fpath)
-					os.Remove(fpath)
-				}
+			if ok && (pathName == "" || pa.Path == pathName) {
+				segments[pa.Path] = append(segments[pa.Path], cleanerSegment{fpath: fpath, pa: pa})
 			}
 		}
 
 		return nil
 	})
 
+	// deleted segments, grouped by path name
+	deleted := make(map[string]map[string]struct{})
+
+	var cleaned []CleanedSegment
+
+	for pathName, segs := range segments {
+		sort.Slice(segs, func(i, j int) bool {
+			return segs[i].pa.Start.Before(segs[j].pa.Start)
+		})
+
+		deleteQuietAfter := e.DeleteQuietAfter
+
+		// events are loaded only when there are quiet segments to delete
+		var events []cleanerEvent
+		eventsLoaded := false
+
+		for i, seg := range segs {
+			pa := seg.pa
+			fpath := seg.fpath
+			age := now.Sub(pa.Start)
+
+			del := e.DeleteAfter != 0 && age > e.DeleteAfter
+
+			// segments that are being written may still receive events
+			if !del && deleteQuietAfter != 0 && age > deleteQuietAfter && !c.Registry.SegmentIsOpen(fpath) {
+				if !eventsLoaded {
+					var err error
+					events, err = cleanerLoadEvents(e, pathName)
+					if err != nil {
+						// in order not to delete relevant segments, quiet segments are kept
+						c.Log(logger.Warn, "unable to load events of path '%s': %v", pathName, err)
+						deleteQuietAfter = 0
+						continue
+					}
+					eventsLoaded = true
+				}
+
+				// the end of a segment is the start of the next one
+				var end time.Time
+				if i != (len(segs) - 1) {
+					end = segs[i+1].pa.Start
+				} else {
+					end = pa.Start.Add(e.SegmentDuration)
+				}
+
+				del = !cleanerHasEvents(events, pa.Start, end)
+			}
+
+			if !del {
+				continue
+			}
+
+			if dryRun {
+				cleaned = append(cleaned, CleanedSegment{Path: pa.Path, Start: pa.Start, File: fpath})
+				continue
+			}
+
+			fields := map[string]string{"segmentPath": fpath}
+			var err error
+
+			if archive != nil {
+				var dest string
+				dest, err = archiveSegment(archive, commonPath, fpath)
+				if err != nil {
+					// segments that cannot be archived are kept, and archived again at the next run
+					c.Log(logger.Warn, "unable to archive %s: %v", fpath, err)
+					continue
+				}
+				c.Log(logger.Debug, "archived %s to %s", fpath, dest)
+				fields["archivePath"] = dest
+			} else {
+				c.Log(logger.Debug, "removing %s", fpath)
+				err = os.Remove(fpath)
+				os.Remove(ChecksumPath(fpath))
+			}
+
+			if err == nil {
+				cleaned = append(cleaned, CleanedSegment{Path: pa.Path, Start: pa.Start, File: fpath})
+
+				if deleted[pa.Path] == nil {
+					deleted[pa.Path] = make(map[string]struct{})
+				}
+				deleted[pa.Path][fpath] = struct{}{}
+				c.Registry.SegmentsChanged(pa.Path)
+
+				c.Notifier.Publish(notify.Event{
+					Type:   notify.EventSegmentDelete,
+					Path:   pa.Path,
+					Fields: fields,
+				})
+			}
+		}
+	}
+
+	if dryRun {
+		return cleaned, nil
+	}
+
 	filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
 		if err != nil {
 			return err
@@ -120,5 +333,57 @@ func (c *Cleaner) doRunEntry(e *CleanerEntry) error {
 		return nil
 	})
 
-	return nil
+	if e.IndexPath != "" {
+		for pathName, fpaths := range deleted {
+			err := IndexPrune(e.IndexPath, pathName, func(entry IndexEntry) bool {
+				_, ok := fpaths[entry.Path]
+				return !ok
+			})
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				c.Log(logger.Warn, "unable to prune index: %v", err)
+			}
+
+			c.Registry.SegmentsChanged(pathName)
+		}
+	}
+
+	return cleaned, nil
+}
+
+// archiveSegment moves a segment and its checksum into an archive,
+// with the same path they have relative to the fixed part of recordPath.
+func archiveSegment(archive archiveTarget, commonPath string, fpath string) (string, error) {
+	rel, err := filepath.Rel(commonPath, fpath)
+	if err != nil {
+		return "", err
+	}
+
+	// the checksum is archived first, in order not to lose it when the segment is moved
+	checksumPath := ChecksumPath(fpath)
+	if _, err = os.Stat(checksumPath); err == nil {
+		_, err = archive.store(checksumPath, ChecksumPath(rel))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	dest, err := archive.store(fpath, rel)
+	if err != nil {
+		return "", err
+	}
+
+	// segments moved into local directories don't exist anymore
+	err = os.Remove(fpath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	os.Remove(checksumPath)
+
+	return dest, nil
+}
+
+func isSamePath(a string, b string) bool {
+	a, _ = filepath.Abs(a)
+	b, _ = filepath.Abs(b)
+	return a == b
 }
@@ -0,0 +1,81 @@
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// cleanerEvent is an interval of a path in which something relevant happened.
+type cleanerEvent struct {
+	start time.Time
+	end   time.Time
+}
+
+// cleanerAnnotation is the part of an annotation, as stored by the playback server, used by the cleaner.
+type cleanerAnnotation struct {
+	Path     string    `json:"path"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+}
+
+// cleanerLoadEvents reads the motion intervals and the annotations of a path.
+func cleanerLoadEvents(e *CleanerEntry, pathName string) ([]cleanerEvent, error) {
+	var out []cleanerEvent
+
+	if e.IndexPath != "" {
+		entries, err := MotionRead(e.IndexPath, pathName)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.Score <= 0 {
+				continue
+			}
+
+			out = append(out, cleanerEvent{
+				start: entry.Start,
+				end:   entry.Start.Add(entry.Duration),
+			})
+		}
+	}
+
+	if e.AnnotationsFile != "" {
+		buf, err := os.ReadFile(e.AnnotationsFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		if buf != nil {
+			var annotations []cleanerAnnotation
+			err = json.Unmarshal(buf, &annotations)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, a := range annotations {
+				if a.Path == pathName {
+					out = append(out, cleanerEvent{
+						start: a.Start,
+						end:   a.Start.Add(time.Duration(a.Duration * float64(time.Second))),
+					})
+				}
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// cleanerHasEvents checks whether an interval overlaps one or more events.
+// Instantaneous events are taken into account too.
+func cleanerHasEvents(events []cleanerEvent, start time.Time, end time.Time) bool {
+	for _, ev := range events {
+		if !ev.start.After(end) && !ev.end.Before(start) {
+			return true
+		}
+	}
+	return false
+}
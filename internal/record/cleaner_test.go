@@ -28,6 +28,9 @@ func TestCleaner(t *testing.T) {
 	err = os.WriteFile(filepath.Join(dir, specialChars+"_mypath", "2008-05-20_22-15-25-000125.mp4"), []byte{1}, 0o644)
 	require.NoError(t, err)
 
+	err = os.WriteFile(filepath.Join(dir, specialChars+"_mypath", "2008-05-20_22-15-25-000125.mp4.sha256"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
 	err = os.WriteFile(filepath.Join(dir, specialChars+"_mypath", "2009-05-20_22-15-25-000427.mp4"), []byte{1}, 0o644)
 	require.NoError(t, err)
 
@@ -47,6 +50,189 @@ func TestCleaner(t *testing.T) {
 	_, err = os.Stat(filepath.Join(dir, specialChars+"_mypath", "2008-05-20_22-15-25-000125.mp4"))
 	require.Error(t, err)
 
+	_, err = os.Stat(filepath.Join(dir, specialChars+"_mypath", "2008-05-20_22-15-25-000125.mp4.sha256"))
+	require.Error(t, err)
+
 	_, err = os.Stat(filepath.Join(dir, specialChars+"_mypath", "2009-05-20_22-15-25-000427.mp4"))
 	require.NoError(t, err)
 }
+
+func TestCleanerDeleteQuiet(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 0o5, 20, 22, 15, 25, 427000, time.Local)
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"2009-05-20_10-00-00-000000.mp4",
+		"2009-05-20_11-00-00-000000.mp4",
+		"2009-05-20_12-00-00-000000.mp4",
+		"2009-05-20_22-00-00-000000.mp4",
+	} {
+		err = os.WriteFile(filepath.Join(dir, "mypath", name), []byte{1}, 0o644)
+		require.NoError(t, err)
+	}
+
+	indexPath := filepath.Join(dir, "index")
+
+	err = MotionAdd(indexPath, "mypath", []MotionEntry{{
+		Start:    time.Date(2009, 0o5, 20, 10, 30, 0, 0, time.Local),
+		Duration: 10 * time.Second,
+		Score:    1,
+	}})
+	require.NoError(t, err)
+
+	annotationsFile := filepath.Join(dir, "annotations.json")
+
+	err = os.WriteFile(annotationsFile, []byte(`[{"path":"mypath","start":"`+
+		time.Date(2009, 0o5, 20, 12, 15, 0, 0, time.Local).Format(time.RFC3339)+`","duration":0}]`), 0o644)
+	require.NoError(t, err)
+
+	c := &Cleaner{
+		Entries: []CleanerEntry{{
+			Path:             filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			Format:           conf.RecordFormatFMP4,
+			DeleteAfter:      24 * time.Hour,
+			DeleteQuietAfter: 2 * time.Hour,
+			SegmentDuration:  time.Hour,
+			IndexPath:        indexPath,
+			AnnotationsFile:  annotationsFile,
+		}},
+		Parent: test.NilLogger,
+	}
+	c.Initialize()
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	// contains a motion interval
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_10-00-00-000000.mp4"))
+	require.NoError(t, err)
+
+	// quiet
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_11-00-00-000000.mp4"))
+	require.Error(t, err)
+
+	// contains an annotation
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_12-00-00-000000.mp4"))
+	require.NoError(t, err)
+
+	// recent
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_22-00-00-000000.mp4"))
+	require.NoError(t, err)
+}
+
+func TestCleanerArchive(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 0o5, 20, 22, 15, 25, 427000, time.Local)
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000125.mp4"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000125.mp4.sha256"), []byte{2}, 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath", "2009-05-20_22-15-25-000427.mp4"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
+	// archive inside the recording directory
+	archiveDir := filepath.Join(dir, "archive")
+
+	c := &Cleaner{
+		Entries: []CleanerEntry{{
+			Path:        filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			Format:      conf.RecordFormatFMP4,
+			DeleteAfter: 10 * time.Second,
+			ArchiveTo:   archiveDir,
+		}},
+		Parent: test.NilLogger,
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = c.doRunEntry(&c.Entries[0], "", false)
+		require.NoError(t, err)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000125.mp4"))
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000125.mp4.sha256"))
+	require.Error(t, err)
+
+	buf, err := os.ReadFile(filepath.Join(archiveDir, "mypath", "2008-05-20_22-15-25-000125.mp4"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, buf)
+
+	buf, err = os.ReadFile(filepath.Join(archiveDir, "mypath", "2008-05-20_22-15-25-000125.mp4.sha256"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{2}, buf)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_22-15-25-000427.mp4"))
+	require.NoError(t, err)
+}
+
+func TestCleanup(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 0o5, 20, 22, 15, 25, 427000, time.Local)
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, pathName := range []string{"mypath", "otherpath"} {
+		err = os.Mkdir(filepath.Join(dir, pathName), 0o755)
+		require.NoError(t, err)
+
+		for _, name := range []string{
+			"2008-05-20_22-15-25-000125.mp4",
+			"2009-05-20_22-15-25-000427.mp4",
+		} {
+			err = os.WriteFile(filepath.Join(dir, pathName, name), []byte{1}, 0o644)
+			require.NoError(t, err)
+		}
+	}
+
+	e := CleanerEntry{
+		Path:        filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		Format:      conf.RecordFormatFMP4,
+		DeleteAfter: 10 * time.Second,
+	}
+
+	expired := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000125.mp4")
+
+	segments, err := Cleanup(e, "mypath", true, nil, nil, test.NilLogger)
+	require.NoError(t, err)
+	require.Equal(t, []CleanedSegment{{
+		Path:  "mypath",
+		Start: time.Date(2008, 0o5, 20, 22, 15, 25, 125000, time.Local),
+		File:  expired,
+	}}, segments)
+
+	_, err = os.Stat(expired)
+	require.NoError(t, err)
+
+	segments, err = Cleanup(e, "mypath", false, nil, nil, test.NilLogger)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	_, err = os.Stat(expired)
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "otherpath", "2008-05-20_22-15-25-000125.mp4"))
+	require.NoError(t, err)
+}
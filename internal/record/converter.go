@@ -0,0 +1,183 @@
+package record
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
+)
+
+// ConverterEntry is a converter entry.
+type ConverterEntry struct {
+	Path      string
+	IndexPath string
+	// maximum number of operations that read the recordings of a path at the same time
+	MaxReaders int
+}
+
+// Converter converts MPEG-TS recording segments into fMP4 segments.
+type Converter struct {
+	Entries  []ConverterEntry
+	Notifier *notify.Notifier
+	Registry *Registry
+	Parent   logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+
+	done chan struct{}
+}
+
+// Initialize initializes a Converter.
+func (c *Converter) Initialize() {
+	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
+	c.done = make(chan struct{})
+
+	go c.run()
+}
+
+// Close closes the Converter.
+func (c *Converter) Close() {
+	c.ctxCancel()
+	<-c.done
+}
+
+// Log implements logger.Writer.
+func (c *Converter) Log(level logger.Level, format string, args ...interface{}) {
+	c.Parent.Log(level, "[record converter] "+format, args...)
+}
+
+func (c *Converter) run() {
+	defer close(c.done)
+
+	for _, e := range c.Entries {
+		c.doRunEntry(&e)
+
+		if c.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (c *Converter) doRunEntry(e *ConverterEntry) {
+	// we have to convert to absolute paths
+	// otherwise, entryPath and fpath inside Walk() won't have common elements
+	tsPath, _ := filepath.Abs(PathAddExtension(e.Path, conf.RecordFormatMPEGTS))
+	mp4Path, _ := filepath.Abs(PathAddExtension(e.Path, conf.RecordFormatFMP4))
+
+	var fpaths []string
+
+	filepath.Walk(CommonPath(tsPath), func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			var pa Path
+			if pa.Decode(tsPath, fpath) {
+				fpaths = append(fpaths, fpath)
+			}
+		}
+
+		return nil
+	})
+
+	for _, fpath := range fpaths {
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		var pa Path
+		pa.Decode(tsPath, fpath)
+
+		release, err := c.Registry.AcquireReader(c.ctx, pa.Path, e.MaxReaders)
+		if err != nil {
+			return
+		}
+
+		err = c.convertSegment(e, tsPath, mp4Path, fpath)
+		release()
+		if err != nil {
+			c.Log(logger.Warn, "unable to convert %s: %v", fpath, err)
+		}
+	}
+}
+
+func (c *Converter) convertSegment(e *ConverterEntry, tsPath string, mp4Path string, fpath string) error {
+	var pa Path
+	pa.Decode(tsPath, fpath)
+	dest := pa.Encode(mp4Path)
+
+	if _, err := os.Stat(dest); err == nil {
+		c.Log(logger.Debug, "skipping %s since %s already exists", fpath, dest)
+		return nil
+	}
+
+	src, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	err = os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return err
+	}
+
+	// write into a temporary file, in order not to expose partial segments to the playback server
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".convert-*")
+	if err != nil {
+		return err
+	}
+
+	duration, err := convertMPEGTSToFMP4(c.ctx, src, tmp)
+
+	err2 := tmp.Close()
+	if err == nil {
+		err = err2
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), dest)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	src.Close()
+	os.Remove(fpath)
+
+	if e.IndexPath != "" && pa.Path != "" {
+		format := conf.RecordFormatFMP4
+
+		err = IndexAdd(e.IndexPath, pa.Path, IndexEntry{
+			Start:    pa.Start,
+			Duration: duration,
+			Path:     dest,
+			Format:   &format,
+		})
+		if err != nil {
+			c.Log(logger.Warn, "unable to update index: %v", err)
+		} else {
+			c.Notifier.Publish(notify.Event{
+				Type:   notify.EventIndexAdd,
+				Path:   pa.Path,
+				Fields: map[string]string{"segmentPath": dest},
+			})
+		}
+	}
+
+	if pa.Path != "" {
+		c.Registry.SegmentsChanged(pa.Path)
+	}
+
+	c.Log(logger.Info, "converted %s into %s", fpath, dest)
+
+	return nil
+}
@@ -0,0 +1,375 @@
+package record
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/codecs/opus"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/bluenviron/mediacommon/pkg/formats/mpegts"
+)
+
+const (
+	convertedPartDuration = 1 * time.Second
+)
+
+// mpegtsFindCodecs reads a MPEG-TS segment and finds parameters of supported codecs.
+func mpegtsFindCodecs(r io.Reader) (map[uint16]fmp4.Codec, error) {
+	mr, err := mpegts.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+
+	codecs := make(map[uint16]fmp4.Codec)
+	pending := 0
+
+	for _, track := range mr.Tracks() {
+		pid := track.PID
+
+		switch codec := track.Codec.(type) {
+		case *mpegts.CodecH265:
+			pending++
+
+			mr.OnDataH265(track, func(_ int64, _ int64, au [][]byte) error {
+				if _, ok := codecs[pid]; ok {
+					return nil
+				}
+
+				var vps, sps, pps []byte
+				for _, nalu := range au {
+					switch h265.NALUType((nalu[0] >> 1) & 0b111111) {
+					case h265.NALUType_VPS_NUT:
+						vps = nalu
+					case h265.NALUType_SPS_NUT:
+						sps = nalu
+					case h265.NALUType_PPS_NUT:
+						pps = nalu
+					}
+				}
+
+				if vps != nil && sps != nil && pps != nil {
+					codecs[pid] = &fmp4.CodecH265{VPS: vps, SPS: sps, PPS: pps}
+					pending--
+				}
+				return nil
+			})
+
+		case *mpegts.CodecH264:
+			pending++
+
+			mr.OnDataH264(track, func(_ int64, _ int64, au [][]byte) error {
+				if _, ok := codecs[pid]; ok {
+					return nil
+				}
+
+				var sps, pps []byte
+				for _, nalu := range au {
+					switch h264.NALUType(nalu[0] & 0x1F) {
+					case h264.NALUTypeSPS:
+						sps = nalu
+					case h264.NALUTypePPS:
+						pps = nalu
+					}
+				}
+
+				if sps != nil && pps != nil {
+					codecs[pid] = &fmp4.CodecH264{SPS: sps, PPS: pps}
+					pending--
+				}
+				return nil
+			})
+
+		case *mpegts.CodecMPEG4Audio:
+			codecs[pid] = &fmp4.CodecMPEG4Audio{Config: codec.Config}
+
+		case *mpegts.CodecOpus:
+			codecs[pid] = &fmp4.CodecOpus{ChannelCount: codec.ChannelCount}
+		}
+	}
+
+	// segments of crashed recordings can be truncated,
+	// therefore any error is considered the end of the segment.
+	for pending != 0 {
+		err = mr.Read()
+		if err != nil {
+			break
+		}
+	}
+
+	if len(codecs) == 0 {
+		return nil, fmt.Errorf("no tracks with supported codecs found")
+	}
+
+	return codecs, nil
+}
+
+type mpegtsConverterTrack struct {
+	initTrack *fmp4.InitTrack
+
+	nextSample *sample
+	lastDur    uint32
+	part       *fmp4.PartTrack
+	end        time.Duration
+}
+
+type mpegtsConverter struct {
+	w io.Writer
+
+	tracks    []*mpegtsConverterTrack
+	partStart time.Duration
+	seqNum    uint32
+	buf       seekablebuffer.Buffer
+}
+
+func (c *mpegtsConverter) write(track *mpegtsConverterTrack, s *sample) error {
+	s, track.nextSample = track.nextSample, s
+	if s == nil {
+		return nil
+	}
+
+	s.Duration = uint32(durationGoToMp4(track.nextSample.dts-s.dts, track.initTrack.TimeScale))
+
+	return c.push(track, s)
+}
+
+func (c *mpegtsConverter) push(track *mpegtsConverterTrack, s *sample) error {
+	// BaseTime is negative, this is not supported by fMP4.
+	if s.dts < 0 {
+		return nil
+	}
+
+	if track.part == nil {
+		track.part = &fmp4.PartTrack{
+			ID:       track.initTrack.ID,
+			BaseTime: durationGoToMp4(s.dts, track.initTrack.TimeScale),
+		}
+	}
+
+	track.part.Samples = append(track.part.Samples, s.PartSample)
+	track.lastDur = s.Duration
+	track.end = s.dts + time.Duration(s.Duration)*time.Second/time.Duration(track.initTrack.TimeScale)
+
+	if (s.dts - c.partStart) >= convertedPartDuration {
+		c.partStart = s.dts
+		return c.flush()
+	}
+
+	return nil
+}
+
+func (c *mpegtsConverter) flush() error {
+	part := &fmp4.Part{
+		SequenceNumber: c.seqNum,
+	}
+
+	for _, track := range c.tracks {
+		if track.part != nil {
+			part.Tracks = append(part.Tracks, track.part)
+			track.part = nil
+		}
+	}
+
+	if part.Tracks == nil {
+		return nil
+	}
+
+	c.seqNum++
+
+	c.buf.Reset()
+	err := part.Marshal(&c.buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.w.Write(c.buf.Bytes())
+	return err
+}
+
+// convertMPEGTSToFMP4 converts a MPEG-TS segment into a fMP4 segment, preserving timestamps.
+// It returns the duration of the segment.
+func convertMPEGTSToFMP4(ctx context.Context, r io.ReadSeeker, w io.Writer) (time.Duration, error) {
+	codecs, err := mpegtsFindCodecs(r)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	mr, err := mpegts.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return 0, err
+	}
+
+	c := &mpegtsConverter{
+		w:      w,
+		seqNum: 1,
+	}
+
+	var init fmp4.Init
+
+	var td *mpegts.TimeDecoder
+	decodeTime := func(t int64) time.Duration {
+		if td == nil {
+			td = mpegts.NewTimeDecoder(t)
+		}
+		return td.Decode(t)
+	}
+
+	for _, mtrack := range mr.Tracks() {
+		codec, ok := codecs[mtrack.PID]
+		if !ok {
+			continue
+		}
+
+		track := &mpegtsConverterTrack{
+			initTrack: &fmp4.InitTrack{
+				ID:    len(init.Tracks) + 1,
+				Codec: codec,
+			},
+		}
+		init.Tracks = append(init.Tracks, track.initTrack)
+		c.tracks = append(c.tracks, track)
+
+		switch codec := codec.(type) {
+		case *fmp4.CodecH265:
+			track.initTrack.TimeScale = 90000
+
+			mr.OnDataH265(mtrack, func(pts int64, dts int64, au [][]byte) error {
+				dtsDur := decodeTime(dts)
+				ptsDur := decodeTime(pts)
+
+				sampl, err := fmp4.NewPartSampleH26x(
+					int32(durationGoToMp4(ptsDur-dtsDur, 90000)),
+					h265.IsRandomAccess(au),
+					au)
+				if err != nil {
+					return err
+				}
+
+				return c.write(track, &sample{
+					PartSample: sampl,
+					dts:        dtsDur,
+				})
+			})
+
+		case *fmp4.CodecH264:
+			track.initTrack.TimeScale = 90000
+
+			mr.OnDataH264(mtrack, func(pts int64, dts int64, au [][]byte) error {
+				dtsDur := decodeTime(dts)
+				ptsDur := decodeTime(pts)
+
+				sampl, err := fmp4.NewPartSampleH26x(
+					int32(durationGoToMp4(ptsDur-dtsDur, 90000)),
+					h264.IDRPresent(au),
+					au)
+				if err != nil {
+					return err
+				}
+
+				return c.write(track, &sample{
+					PartSample: sampl,
+					dts:        dtsDur,
+				})
+			})
+
+		case *fmp4.CodecMPEG4Audio:
+			track.initTrack.TimeScale = uint32(codec.SampleRate)
+
+			mr.OnDataMPEG4Audio(mtrack, func(pts int64, aus [][]byte) error {
+				ptsDur := decodeTime(pts)
+
+				for i, au := range aus {
+					err := c.write(track, &sample{
+						PartSample: &fmp4.PartSample{
+							Payload: au,
+						},
+						dts: ptsDur + time.Duration(i)*mpeg4audio.SamplesPerAccessUnit*
+							time.Second/time.Duration(codec.SampleRate),
+					})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+
+		case *fmp4.CodecOpus:
+			track.initTrack.TimeScale = 48000
+
+			mr.OnDataOpus(mtrack, func(pts int64, packets [][]byte) error {
+				ptsDur := decodeTime(pts)
+
+				for _, packet := range packets {
+					err := c.write(track, &sample{
+						PartSample: &fmp4.PartSample{
+							Payload: packet,
+						},
+						dts: ptsDur,
+					})
+					if err != nil {
+						return err
+					}
+					ptsDur += opus.PacketDuration(packet)
+				}
+				return nil
+			})
+		}
+	}
+
+	err = init.Marshal(&c.buf)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = w.Write(c.buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		// segments of crashed recordings can be truncated,
+		// therefore any error is considered the end of the segment.
+		if mr.Read() != nil {
+			break
+		}
+	}
+
+	// the duration of the last sample is unknown, use the one of the previous sample.
+	var duration time.Duration
+
+	for _, track := range c.tracks {
+		if track.nextSample != nil {
+			track.nextSample.Duration = track.lastDur
+			err = c.push(track, track.nextSample)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if track.end > duration {
+			duration = track.end
+		}
+	}
+
+	err = c.flush()
+	if err != nil {
+		return 0, err
+	}
+
+	return duration, nil
+}
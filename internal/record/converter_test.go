@@ -0,0 +1,89 @@
+package record
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/mpegts"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestConverter(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-converter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	recordPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+	tsPath := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.ts")
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	func() {
+		f, err2 := os.Create(tsPath)
+		require.NoError(t, err2)
+		defer f.Close()
+
+		bw := bufio.NewWriter(f)
+		defer bw.Flush()
+
+		videoTrack := &mpegts.Track{Codec: &mpegts.CodecH264{}}
+		audioTrack := &mpegts.Track{Codec: &mpegts.CodecMPEG4Audio{Config: *test.FormatMPEG4Audio.Config}}
+
+		w := mpegts.NewWriter(bw, []*mpegts.Track{videoTrack, audioTrack})
+
+		for i := 0; i < 4; i++ {
+			au := [][]byte{{1}}
+			if i%2 == 0 {
+				au = [][]byte{
+					test.FormatH264.SPS,
+					test.FormatH264.PPS,
+					{5},
+				}
+			}
+
+			err2 = w.WriteH264(videoTrack, int64(i)*90000, int64(i)*90000, i%2 == 0, au)
+			require.NoError(t, err2)
+
+			err2 = w.WriteMPEG4Audio(audioTrack, int64(i)*90000, [][]byte{{1, 2}})
+			require.NoError(t, err2)
+		}
+	}()
+
+	c := &Converter{
+		Entries: []ConverterEntry{{
+			Path:      recordPath,
+			IndexPath: filepath.Join(dir, "index"),
+		}},
+		Parent: test.NilLogger,
+	}
+	c.Initialize()
+	<-c.done
+	c.Close()
+
+	_, err = os.Stat(tsPath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	mp4Path := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4")
+
+	buf, err := os.ReadFile(mp4Path)
+	require.NoError(t, err)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(buf)
+	require.NoError(t, err)
+	require.NotEmpty(t, parts)
+
+	entries, err := IndexRead(filepath.Join(dir, "index"), "mypath")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.True(t, time.Date(2008, 5, 20, 22, 15, 25, 0, time.Local).Equal(entries[0].Start))
+	require.Equal(t, 4*time.Second, entries[0].Duration)
+	require.Equal(t, mp4Path, entries[0].Path)
+}
@@ -0,0 +1,95 @@
+package record
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+const (
+	// only a fraction of fingerprints is stored, chosen by their value, therefore
+	// recordings of the same stream store the same fingerprints regardless of
+	// where their segments and parts begin.
+	fingerprintSampling = 16
+
+	// limits the size of index entries of long segments.
+	fingerprintMaxCount = 1024
+)
+
+// fingerprint computes the fingerprint of the payload of a video keyframe,
+// and returns whether it has to be stored.
+func fingerprint(payload []byte) (uint64, bool) {
+	h := fnv.New64a()
+	h.Write(payload)
+	v := h.Sum64()
+	return v, v%fingerprintSampling == 0
+}
+
+// Duplicate is a segment whose content has been recorded into another path too.
+type Duplicate struct {
+	Path        string
+	Entry       IndexEntry
+	DuplicateOf string
+	// fraction of fingerprints of the segment that are found in the other path
+	Similarity float64
+}
+
+// FindDuplicates compares the fingerprints in the indexes of multiple paths,
+// and returns the segments whose fingerprints are mostly found in another path.
+// Entries without fingerprints are ignored.
+func FindDuplicates(entries map[string][]IndexEntry) []Duplicate {
+	owners := make(map[uint64]map[string]struct{})
+
+	for pathName, pathEntries := range entries {
+		for _, entry := range pathEntries {
+			for _, fp := range entry.Fingerprints {
+				if owners[fp] == nil {
+					owners[fp] = make(map[string]struct{})
+				}
+				owners[fp][pathName] = struct{}{}
+			}
+		}
+	}
+
+	var out []Duplicate
+
+	for pathName, pathEntries := range entries {
+		for _, entry := range pathEntries {
+			if len(entry.Fingerprints) == 0 {
+				continue
+			}
+
+			matched := make(map[string]int)
+
+			for _, fp := range entry.Fingerprints {
+				for other := range owners[fp] {
+					if other != pathName {
+						matched[other]++
+					}
+				}
+			}
+
+			for other, n := range matched {
+				if n*2 >= len(entry.Fingerprints) {
+					out = append(out, Duplicate{
+						Path:        pathName,
+						Entry:       entry,
+						DuplicateOf: other,
+						Similarity:  float64(n) / float64(len(entry.Fingerprints)),
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		if !out[i].Entry.Start.Equal(out[j].Entry.Start) {
+			return out[i].Entry.Start.Before(out[j].Entry.Start)
+		}
+		return out[i].DuplicateOf < out[j].DuplicateOf
+	})
+
+	return out
+}
@@ -0,0 +1,74 @@
+package record
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprintSampling(t *testing.T) {
+	stored := 0
+
+	for i := 0; i < 1000; i++ {
+		payload := []byte{byte(i), byte(i >> 8), 1, 2, 3}
+
+		v1, ok1 := fingerprint(payload)
+		v2, ok2 := fingerprint(payload)
+		require.Equal(t, v1, v2)
+		require.Equal(t, ok1, ok2)
+
+		if ok1 {
+			stored++
+		}
+	}
+
+	require.Greater(t, stored, 0)
+	require.Less(t, stored, 200)
+}
+
+func TestFindDuplicates(t *testing.T) {
+	start := time.Date(2009, 0o5, 20, 22, 15, 25, 0, time.UTC)
+
+	entries := map[string][]IndexEntry{
+		"cam1": {
+			{Start: start, Duration: time.Hour, Path: "/rec/cam1/1.mp4", Fingerprints: []uint64{1, 2, 3, 4}},
+			{Start: start.Add(time.Hour), Duration: time.Hour, Path: "/rec/cam1/2.mp4", Fingerprints: []uint64{5, 6}},
+			{Start: start.Add(2 * time.Hour), Duration: time.Hour, Path: "/rec/cam1/3.mp4"},
+		},
+		// same camera, published with a delay and split into different segments
+		"cam1copy": {
+			{Start: start.Add(time.Minute), Duration: time.Hour, Path: "/rec/cam1copy/1.mp4", Fingerprints: []uint64{2, 3, 4, 5}},
+		},
+		"cam2": {
+			{Start: start, Duration: time.Hour, Path: "/rec/cam2/1.mp4", Fingerprints: []uint64{6, 7, 8, 9}},
+		},
+	}
+
+	require.Equal(t, []Duplicate{
+		{
+			Path:        "cam1",
+			Entry:       entries["cam1"][0],
+			DuplicateOf: "cam1copy",
+			Similarity:  0.75,
+		},
+		{
+			Path:        "cam1",
+			Entry:       entries["cam1"][1],
+			DuplicateOf: "cam1copy",
+			Similarity:  0.5,
+		},
+		{
+			Path:        "cam1",
+			Entry:       entries["cam1"][1],
+			DuplicateOf: "cam2",
+			Similarity:  0.5,
+		},
+		{
+			Path:        "cam1copy",
+			Entry:       entries["cam1copy"][0],
+			DuplicateOf: "cam1",
+			Similarity:  1,
+		},
+	}, FindDuplicates(entries))
+}
@@ -103,9 +103,11 @@ type formatFMP4 struct {
 	a *agentInstance
 
 	tracks             []*formatFMP4Track
+	codecs             []string
 	hasVideo           bool
 	currentSegment     *formatFMP4Segment
 	nextSequenceNumber uint32
+	started            bool
 }
 
 func (f *formatFMP4) initialize() {
@@ -832,6 +834,8 @@ func (f *formatFMP4) initialize() {
 		}
 	}
 
+	f.codecs = defs.FormatsToCodecs(formats)
+
 	f.a.agent.Log(logger.Info, "recording %s",
 		defs.FormatsInfo(formats))
 }
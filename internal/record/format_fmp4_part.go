@@ -67,14 +67,19 @@ func (p *formatFMP4Part) close() error {
 			return err
 		}
 
+		p.s.f.a.agent.Registry.openSegmentAdd(p.s.f.a.agent.PathName, p.s.path, p.s.startNTP, p.s.f.a.agent.Format)
+
 		p.s.f.a.agent.OnSegmentCreate(p.s.path)
 
 		err = writeInit(fi, p.s.f.tracks)
 		if err != nil {
 			fi.Close()
+			p.s.f.a.agent.Registry.openSegmentRemove(p.s.path)
 			return err
 		}
 
+		p.s.f.a.agent.Registry.openSegmentSetReady(p.s.path)
+
 		p.s.fi = fi
 	}
 
@@ -91,6 +96,11 @@ func (p *formatFMP4Part) write(track *formatFMP4Track, sample *sample) error {
 		p.partTracks[track] = partTrack
 	}
 
+	// keyframes are fingerprinted while they are written into the part
+	if track.initTrack.Codec.IsVideo() && !sample.IsNonSyncSample {
+		p.s.info.addFingerprint(sample.Payload)
+	}
+
 	partTrack.Samples = append(partTrack.Samples, sample.PartSample)
 	p.endDTS = sample.dts
 
@@ -40,6 +40,10 @@ type formatFMP4Segment struct {
 	fi      *os.File
 	curPart *formatFMP4Part
 	lastDTS time.Duration
+	info    SegmentInfo
+
+	// timestamps jumped after lastDTS
+	jumped bool
 }
 
 func (s *formatFMP4Segment) initialize() {
@@ -55,15 +59,25 @@ func (s *formatFMP4Segment) close() error {
 
 	if s.fi != nil {
 		s.f.a.agent.Log(logger.Debug, "closing segment %s", s.path)
+
+		if st, err2 := s.fi.Stat(); err2 == nil {
+			s.info.Size = st.Size()
+		}
+
 		err2 := s.fi.Close()
 		if err == nil {
 			err = err2
 		}
 
 		if err2 == nil {
-			duration := s.lastDTS - s.startDTS
-			s.f.a.agent.OnSegmentComplete(s.path, duration)
+			s.info.Start = s.startNTP
+			s.info.Duration = s.lastDTS - s.startDTS
+			s.info.Codecs = s.f.codecs
+			s.f.a.agent.OnSegmentComplete(s.path, s.info)
 		}
+
+		// the segment is removed after being indexed, in order not to hide it from playback
+		s.f.a.agent.Registry.openSegmentRemove(s.path)
 	}
 
 	return err
@@ -72,6 +86,10 @@ func (s *formatFMP4Segment) close() error {
 func (s *formatFMP4Segment) write(track *formatFMP4Track, sample *sample) error {
 	s.lastDTS = sample.dts
 
+	if track.initTrack.Codec.IsVideo() && !sample.IsNonSyncSample {
+		s.info.addKeyframe(s.startNTP.Add(sample.dts - s.startDTS))
+	}
+
 	if s.curPart == nil {
 		s.curPart = &formatFMP4Part{
 			s:              s,
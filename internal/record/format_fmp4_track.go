@@ -2,6 +2,8 @@ package record
 
 import (
 	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
 )
 
 type formatFMP4Track struct {
@@ -21,7 +23,12 @@ func (t *formatFMP4Track) write(sample *sample) error {
 	if sample == nil {
 		return nil
 	}
-	sample.Duration = uint32(durationGoToMp4(t.nextSample.dts-sample.dts, t.initTrack.TimeScale))
+
+	// when timestamps jump, the duration of the sample is unknown and is left empty
+	jumped := timestampJumped(sample.dts, t.nextSample.dts)
+	if !jumped {
+		sample.Duration = uint32(durationGoToMp4(t.nextSample.dts-sample.dts, t.initTrack.TimeScale))
+	}
 
 	if t.f.currentSegment == nil {
 		t.f.currentSegment = &formatFMP4Segment{
@@ -30,20 +37,38 @@ func (t *formatFMP4Track) write(sample *sample) error {
 			startNTP: sample.ntp,
 		}
 		t.f.currentSegment.initialize()
-		// BaseTime is negative, this is not supported by fMP4. Reject the sample silently.
-	} else if (sample.dts - t.f.currentSegment.startDTS) < 0 {
-		return nil
+
+		// segments are also closed when codec parameters change, therefore the first one is tracked separately
+		if !t.f.started {
+			t.f.currentSegment.info.Discontinuity = DiscontinuityStart
+			t.f.started = true
+		}
 	}
 
-	err := t.f.currentSegment.write(t, sample)
-	if err != nil {
-		return err
+	// BaseTime is negative, this is not supported by fMP4. Reject the sample silently.
+	if (sample.dts - t.f.currentSegment.startDTS) >= 0 {
+		err := t.f.currentSegment.write(t, sample)
+		if err != nil {
+			return err
+		}
+
+		// the segment ends with the last sample before the jump
+		if jumped && !t.f.currentSegment.jumped {
+			t.f.currentSegment.jumped = true
+			t.f.currentSegment.lastDTS = sample.dts
+		}
 	}
 
+	// after a timestamp jump, a new segment is started as soon as possible
 	if (!t.f.hasVideo || t.initTrack.Codec.IsVideo()) &&
 		!t.nextSample.IsNonSyncSample &&
-		(t.nextSample.dts-t.f.currentSegment.startDTS) >= t.f.a.agent.SegmentDuration {
-		t.f.currentSegment.lastDTS = t.nextSample.dts
+		(t.f.currentSegment.jumped || (t.nextSample.dts-t.f.currentSegment.startDTS) >= t.f.a.agent.SegmentDuration) {
+		segmentJumped := t.f.currentSegment.jumped
+
+		if !segmentJumped {
+			t.f.currentSegment.lastDTS = t.nextSample.dts
+		}
+
 		err := t.f.currentSegment.close()
 		if err != nil {
 			return err
@@ -55,6 +80,11 @@ func (t *formatFMP4Track) write(sample *sample) error {
 			startNTP: t.nextSample.ntp,
 		}
 		t.f.currentSegment.initialize()
+
+		if segmentJumped {
+			t.f.a.agent.Log(logger.Warn, "timestamps jumped, starting a new segment")
+			t.f.currentSegment.info.Discontinuity = DiscontinuityTimestampJump
+		}
 	}
 
 	return nil
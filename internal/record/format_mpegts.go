@@ -46,6 +46,7 @@ type formatMPEGTS struct {
 	bw             *bufio.Writer
 	mw             *mpegts.Writer
 	hasVideo       bool
+	codecs         []string
 	currentSegment *formatMPEGTSSegment
 }
 
@@ -305,6 +306,8 @@ func (f *formatMPEGTS) initialize() {
 	f.bw = bufio.NewWriterSize(f.dw, mpegtsMaxBufferSize)
 	f.mw = mpegts.NewWriter(f.bw, tracks)
 
+	f.codecs = defs.FormatsToCodecs(formats)
+
 	f.a.agent.Log(logger.Info, "recording %s",
 		defs.FormatsInfo(formats))
 }
@@ -326,6 +329,10 @@ func (f *formatMPEGTS) write(
 		f.hasVideo = true
 	}
 
+	if f.currentSegment != nil && !f.currentSegment.jumped && timestampJumped(f.currentSegment.lastDTS, dts) {
+		f.currentSegment.jumped = true
+	}
+
 	switch {
 	case f.currentSegment == nil:
 		f.currentSegment = &formatMPEGTSSegment{
@@ -334,10 +341,18 @@ func (f *formatMPEGTS) write(
 			startNTP: ntp,
 		}
 		f.currentSegment.initialize()
+		f.currentSegment.info.Discontinuity = DiscontinuityStart
+
+	// after a timestamp jump, a new segment is started as soon as possible
 	case (!f.hasVideo || isVideo) &&
 		randomAccess &&
-		(dts-f.currentSegment.startDTS) >= f.a.agent.SegmentDuration:
-		f.currentSegment.lastDTS = dts
+		(f.currentSegment.jumped || (dts-f.currentSegment.startDTS) >= f.a.agent.SegmentDuration):
+		jumped := f.currentSegment.jumped
+
+		if !jumped {
+			f.currentSegment.lastDTS = dts
+		}
+
 		err := f.currentSegment.close()
 		if err != nil {
 			return err
@@ -350,6 +365,11 @@ func (f *formatMPEGTS) write(
 		}
 		f.currentSegment.initialize()
 
+		if jumped {
+			f.a.agent.Log(logger.Warn, "timestamps jumped, starting a new segment")
+			f.currentSegment.info.Discontinuity = DiscontinuityTimestampJump
+		}
+
 	case (dts - f.currentSegment.lastFlush) >= f.a.agent.PartDuration:
 		err := f.bw.Flush()
 		if err != nil {
@@ -359,7 +379,14 @@ func (f *formatMPEGTS) write(
 		f.currentSegment.lastFlush = dts
 	}
 
-	f.currentSegment.lastDTS = dts
+	// the segment ends with the last sample before the jump
+	if !f.currentSegment.jumped {
+		f.currentSegment.lastDTS = dts
+	}
+
+	if isVideo && randomAccess {
+		f.currentSegment.info.addKeyframe(f.currentSegment.startNTP.Add(dts - f.currentSegment.startDTS))
+	}
 
 	return writeCB()
 }
@@ -17,6 +17,10 @@ type formatMPEGTSSegment struct {
 	fi        *os.File
 	lastFlush time.Duration
 	lastDTS   time.Duration
+	info      SegmentInfo
+
+	// timestamps jumped after lastDTS
+	jumped bool
 }
 
 func (s *formatMPEGTSSegment) initialize() {
@@ -30,15 +34,25 @@ func (s *formatMPEGTSSegment) close() error {
 
 	if s.fi != nil {
 		s.f.a.agent.Log(logger.Debug, "closing segment %s", s.path)
+
+		if st, err2 := s.fi.Stat(); err2 == nil {
+			s.info.Size = st.Size()
+		}
+
 		err2 := s.fi.Close()
 		if err == nil {
 			err = err2
 		}
 
 		if err2 == nil {
-			duration := s.lastDTS - s.startDTS
-			s.f.a.agent.OnSegmentComplete(s.path, duration)
+			s.info.Start = s.startNTP
+			s.info.Duration = s.lastDTS - s.startDTS
+			s.info.Codecs = s.f.codecs
+			s.f.a.agent.OnSegmentComplete(s.path, s.info)
 		}
+
+		// the segment is removed after being indexed, in order not to hide it from playback
+		s.f.a.agent.Registry.openSegmentRemove(s.path)
 	}
 
 	return err
@@ -59,9 +73,17 @@ func (s *formatMPEGTSSegment) Write(p []byte) (int, error) {
 			return 0, err
 		}
 
+		s.f.a.agent.Registry.openSegmentAdd(s.f.a.agent.PathName, s.path, s.startNTP, s.f.a.agent.Format)
+
 		s.f.a.agent.OnSegmentCreate(s.path)
 
 		s.fi = fi
+
+		n, err := s.fi.Write(p)
+		if err == nil {
+			s.f.a.agent.Registry.openSegmentSetReady(s.path)
+		}
+		return n, err
 	}
 
 	return s.fi.Write(p)
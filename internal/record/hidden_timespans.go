@@ -0,0 +1,37 @@
+package record
+
+import (
+	"time"
+)
+
+// HiddenTimespan is a timespan of the recordings of a path that must not be shown to non-privileged readers.
+type HiddenTimespan struct {
+	Start    time.Time
+	Duration time.Duration
+}
+
+// SetHiddenTimespans replaces the hidden timespans of all paths.
+// They are published by the playback server, that stores them,
+// in order to apply them to replays too.
+func (r *Registry) SetHiddenTimespans(spans map[string][]HiddenTimespan) {
+	if r == nil {
+		return
+	}
+
+	r.hiddenMutex.Lock()
+	defer r.hiddenMutex.Unlock()
+
+	r.hidden = spans
+}
+
+// HiddenTimespans returns the hidden timespans of a path.
+func (r *Registry) HiddenTimespans(pathName string) []HiddenTimespan {
+	if r == nil {
+		return nil
+	}
+
+	r.hiddenMutex.RLock()
+	defer r.hiddenMutex.RUnlock()
+
+	return r.hidden[pathName]
+}
@@ -0,0 +1,566 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// serializes writes to indexes, in order to prevent pruning from discarding new entries.
+var indexMutex sync.Mutex
+
+// tombstones of removed entries are kept for this time,
+// then mirrors that didn't read them have to read the whole index again.
+const indexTombstoneMaxAge = 7 * 24 * time.Hour
+
+// maximum size of a line of an index.
+// Entries can be longer than the default limit of bufio.Scanner, since fingerprints grow with the segment duration.
+const indexMaxLineSize = 16 * 1024 * 1024
+
+// Discontinuity is the reason why a segment is not the continuation of the previous one,
+// even if it may start right after it.
+type Discontinuity string
+
+// discontinuities.
+const (
+	// the segment is the first one written after the stream started,
+	// or started again after the source reconnected.
+	DiscontinuityStart Discontinuity = "start"
+
+	// timestamps of the stream jumped with respect to the wall clock.
+	DiscontinuityTimestampJump Discontinuity = "timestampJump"
+)
+
+// IndexEntry is an entry of the index of a path.
+// Each entry describes a single segment, that is identified by its absolute path.
+// Entries contain the format and the codecs of the segment too,
+// therefore they can be interpreted without opening the segment.
+// The format and the codecs are empty in entries written by previous versions.
+// Thinned is true when non-sync video samples have been removed from the segment.
+// Discontinuity is set when the recorder detected a discontinuity at the start of the segment.
+// Fingerprints are computed from a sample of the video keyframes of fMP4 segments
+// and allow to find footage that has been recorded into multiple paths.
+// Seq is the time the entry was added to the index, in microseconds, and increases with each entry,
+// therefore it allows to read the entries that have been added after a certain one.
+// Seq is zero in entries written by previous versions.
+// Entries are stored in the order of their sequence number.
+// Removed is true in tombstones, that replace the entries of removed segments
+// and are returned by IndexSince only.
+type IndexEntry struct {
+	Start         time.Time          `json:"start"`
+	Duration      time.Duration      `json:"duration"`
+	Path          string             `json:"path"`
+	Format        *conf.RecordFormat `json:"format,omitempty"`
+	Codecs        []string           `json:"codecs,omitempty"`
+	Thinned       bool               `json:"thinned,omitempty"`
+	Discontinuity Discontinuity      `json:"discontinuity,omitempty"`
+	Fingerprints  []uint64           `json:"fingerprints,omitempty"`
+	Seq           int64              `json:"seq,omitempty"`
+	Removed       bool               `json:"removed,omitempty"`
+}
+
+// indexLine is an entry as it is stored in the index,
+// followed by the CRC32 of the entry, that allows to detect corrupted entries.
+// The CRC32 is zero in entries written by previous versions.
+type indexLine struct {
+	IndexEntry
+	CRC uint32 `json:"crc,omitempty"`
+}
+
+func indexEntryCRC(entry IndexEntry) (uint32, error) {
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
+
+func indexMarshal(entry IndexEntry) ([]byte, error) {
+	crc, err := indexEntryCRC(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(indexLine{
+		IndexEntry: entry,
+		CRC:        crc,
+	})
+}
+
+func indexUnmarshal(buf []byte) (IndexEntry, bool) {
+	var line indexLine
+	err := json.Unmarshal(buf, &line)
+	if err != nil {
+		return IndexEntry{}, false
+	}
+
+	if line.CRC != 0 {
+		crc, err := indexEntryCRC(line.IndexEntry)
+		if err != nil || crc != line.CRC {
+			return IndexEntry{}, false
+		}
+	}
+
+	return line.IndexEntry, true
+}
+
+// the index of each path is stored in a dedicated file,
+// therefore multiple instances can share the same index directory
+// as long as they record different paths.
+func indexFilePath(indexPath string, pathName string) string {
+	return filepath.Join(indexPath, url.PathEscape(pathName)+".jsonl")
+}
+
+// IndexAdd appends an entry to the index of a path.
+// The sequence number of the entry is assigned automatically.
+func IndexAdd(indexPath string, pathName string, entry IndexEntry) error {
+	err := os.MkdirAll(indexPath, 0o755)
+	if err != nil {
+		return err
+	}
+
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+
+	entry.Seq, err = indexNextSeq(indexPath, pathName)
+	if err != nil {
+		return err
+	}
+
+	return indexAppend(indexPath, pathName, entry)
+}
+
+func indexAppend(indexPath string, pathName string, entry IndexEntry) error {
+	buf, err := indexMarshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if len(buf) >= indexMaxLineSize {
+		return fmt.Errorf("index entry is too big (%d bytes)", len(buf))
+	}
+
+	f, err := os.OpenFile(indexFilePath(indexPath, pathName), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// a previous write may have been interrupted, leaving a truncated entry.
+	// Terminate it, in order to prevent it from corrupting the new entry.
+	truncated, err := indexTruncated(f)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		buf = append([]byte{'\n'}, buf...)
+	}
+
+	_, err = f.Write(append(buf, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// indexNextSeq returns the sequence number of a new entry of an index.
+// Sequence numbers are derived from the current time, in order not to reuse the numbers
+// of entries that have been pruned, and are increased when the clock didn't advance
+// or when the index has been written by an instance with a faster clock.
+func indexNextSeq(indexPath string, pathName string) (int64, error) {
+	last, _, err := indexLast(indexFilePath(indexPath, pathName))
+	if err != nil {
+		return 0, err
+	}
+
+	return max(time.Now().UnixMicro(), last.Seq+1), nil
+}
+
+// IndexLast reads the last valid entry of the index of a path, that may be a tombstone.
+// It returns false when the index doesn't contain any valid entry.
+func IndexLast(indexPath string, pathName string) (IndexEntry, bool, error) {
+	return indexLast(indexFilePath(indexPath, pathName))
+}
+
+// indexLast reads the last valid entry of an index.
+// Entries are stored in the order of their sequence number,
+// therefore only the tail of the index is read.
+func indexLast(fpath string) (IndexEntry, bool, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return IndexEntry{}, false, nil
+		}
+		return IndexEntry{}, false, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return IndexEntry{}, false, err
+	}
+
+	for chunk := int64(4096); ; chunk *= 4 {
+		offset := max(0, fi.Size()-chunk)
+
+		buf := make([]byte, fi.Size()-offset)
+		_, err = f.ReadAt(buf, offset)
+		if err != nil {
+			return IndexEntry{}, false, err
+		}
+
+		lines := bytes.Split(buf, []byte{'\n'})
+
+		// the first line may be incomplete
+		first := 1
+		if offset == 0 {
+			first = 0
+		}
+
+		for i := len(lines) - 1; i >= first; i-- {
+			if entry, ok := indexUnmarshal(lines[i]); ok {
+				return entry, true, nil
+			}
+		}
+
+		if offset == 0 {
+			return IndexEntry{}, false, nil
+		}
+	}
+}
+
+// indexTruncated checks whether the last entry of an index is not terminated.
+func indexTruncated(f *os.File) (bool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if fi.Size() == 0 {
+		return false, nil
+	}
+
+	last := make([]byte, 1)
+	_, err = f.ReadAt(last, fi.Size()-1)
+	if err != nil {
+		return false, err
+	}
+
+	return last[0] != '\n', nil
+}
+
+// IndexSince reads the entries of the index of a path whose sequence number is greater than since,
+// in the order they were added, including tombstones of removed entries.
+func IndexSince(indexPath string, pathName string, since int64) ([]IndexEntry, error) {
+	entries, err := indexReadAll(indexPath, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []IndexEntry{}
+
+	for _, entry := range entries {
+		if entry.Seq > since {
+			out = append(out, entry)
+		}
+	}
+
+	// entries written by previous versions may not be sorted
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Seq < out[j].Seq
+	})
+
+	return out, nil
+}
+
+// IndexRead reads all entries of the index of a path.
+// Malformed and corrupted entries and tombstones are skipped.
+func IndexRead(indexPath string, pathName string) ([]IndexEntry, error) {
+	entries, err := indexReadAll(indexPath, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	out := entries[:0]
+	for _, entry := range entries {
+		if !entry.Removed {
+			out = append(out, entry)
+		}
+	}
+
+	return out, nil
+}
+
+func indexReadAll(indexPath string, pathName string) ([]IndexEntry, error) {
+	f, err := os.Open(indexFilePath(indexPath, pathName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []IndexEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), indexMaxLineSize)
+
+	for scanner.Scan() {
+		entry, ok := indexUnmarshal(scanner.Bytes())
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// temporary files are named after the index they replace,
+// in order to find leftovers of interrupted writes.
+func indexTempPattern(indexPath string, pathName string) string {
+	return "." + filepath.Base(indexFilePath(indexPath, pathName)) + ".tmp*"
+}
+
+// syncDir flushes a directory to disk, in order to persist renames.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// indexWrite replaces the index of a path with the given entries.
+// The index is written into a temporary file that is flushed to disk and then renamed,
+// in order not to leave a partial index in case of errors or power loss.
+func indexWrite(indexPath string, pathName string, entries []IndexEntry) error {
+	fpath := indexFilePath(indexPath, pathName)
+	pattern := indexTempPattern(indexPath, pathName)
+
+	// remove leftovers of interrupted writes. They were never renamed,
+	// therefore the index they were meant to replace is still intact.
+	leftovers, _ := filepath.Glob(filepath.Join(indexPath, pattern))
+	for _, leftover := range leftovers {
+		os.Remove(leftover)
+	}
+
+	f, err := os.CreateTemp(indexPath, pattern)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		w := bufio.NewWriter(f)
+
+		for _, entry := range entries {
+			buf, err2 := indexMarshal(entry)
+			if err2 != nil {
+				return err2
+			}
+
+			_, err2 = w.Write(append(buf, '\n'))
+			if err2 != nil {
+				return err2
+			}
+		}
+
+		err2 := w.Flush()
+		if err2 != nil {
+			return err2
+		}
+
+		return f.Sync()
+	}()
+
+	err2 := f.Close()
+	if err == nil {
+		err = err2
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	err = os.Rename(f.Name(), fpath)
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	// directories cannot be flushed on some platforms, therefore errors are ignored
+	syncDir(indexPath) //nolint:errcheck
+
+	return nil
+}
+
+// IndexPrune removes from the index of a path the entries whose segment
+// is not accepted by keep. When a segment has multiple entries, only the last one is kept.
+// Removed entries are replaced by tombstones, in order to allow mirrors to remove them too.
+func IndexPrune(indexPath string, pathName string, keep func(IndexEntry) bool) error {
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+
+	entries, err := indexReadAll(indexPath, pathName)
+	if err != nil {
+		return err
+	}
+
+	last := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		last[entry.Path] = i
+	}
+
+	var out []IndexEntry
+	var tombstones []IndexEntry
+	expiredTombstones := false
+	minTombstoneSeq := time.Now().Add(-indexTombstoneMaxAge).UnixMicro()
+
+	for i, entry := range entries {
+		switch {
+		// superseded by a following entry
+		case last[entry.Path] != i:
+
+		case entry.Removed:
+			if entry.Seq >= minTombstoneSeq {
+				out = append(out, entry)
+			} else {
+				expiredTombstones = true
+			}
+
+		case keep(entry):
+			out = append(out, entry)
+
+		default:
+			tombstones = append(tombstones, IndexEntry{
+				Start:   entry.Start,
+				Path:    entry.Path,
+				Removed: true,
+			})
+		}
+	}
+
+	if len(out) == len(entries) && !expiredTombstones {
+		return nil
+	}
+
+	err = indexAssignSeqs(indexPath, pathName, tombstones)
+	if err != nil {
+		return err
+	}
+
+	return indexWrite(indexPath, pathName, append(out, tombstones...))
+}
+
+// indexAssignSeqs assigns increasing sequence numbers to entries that are going to be
+// written at the end of an index.
+func indexAssignSeqs(indexPath string, pathName string, entries []IndexEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	seq, err := indexNextSeq(indexPath, pathName)
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		entries[i].Seq = seq
+		seq++
+	}
+
+	return nil
+}
+
+// IndexRelocate replaces, in the index of a path, the segment paths
+// that are keys of renames with the corresponding values.
+// Relocated entries receive a new sequence number and are moved to the end of the index,
+// after tombstones of their previous paths, in order to allow mirrors to remove them.
+func IndexRelocate(indexPath string, pathName string, renames map[string]string) error {
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+
+	entries, err := indexReadAll(indexPath, pathName)
+	if err != nil {
+		return err
+	}
+
+	var out []IndexEntry
+	var tombstones []IndexEntry
+	var relocated []IndexEntry
+	tombstoned := make(map[string]struct{})
+
+	for _, entry := range entries {
+		if dest, ok := renames[entry.Path]; ok {
+			if _, done := tombstoned[entry.Path]; !done && !entry.Removed {
+				tombstoned[entry.Path] = struct{}{}
+				tombstones = append(tombstones, IndexEntry{
+					Start:   entry.Start,
+					Path:    entry.Path,
+					Removed: true,
+				})
+			}
+
+			entry.Path = dest
+			relocated = append(relocated, entry)
+		} else {
+			out = append(out, entry)
+		}
+	}
+
+	if len(relocated) == 0 {
+		return nil
+	}
+
+	relocated = append(tombstones, relocated...)
+
+	err = indexAssignSeqs(indexPath, pathName, relocated)
+	if err != nil {
+		return err
+	}
+
+	return indexWrite(indexPath, pathName, append(out, relocated...))
+}
+
+// IndexPathNames returns the names of the paths that have an index.
+func IndexPathNames(indexPath string) ([]string, error) {
+	files, err := os.ReadDir(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".jsonl") || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		pathName, err := url.PathUnescape(strings.TrimSuffix(name, ".jsonl"))
+		if err != nil {
+			continue
+		}
+
+		out = append(out, pathName)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,346 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// withoutSeq removes sequence numbers, that depend on the time entries were added.
+func withoutSeq(entries []IndexEntry) []IndexEntry {
+	out := make([]IndexEntry, len(entries))
+	for i, entry := range entries {
+		entry.Seq = 0
+		out[i] = entry
+	}
+	return out
+}
+
+func TestIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	indexPath := filepath.Join(dir, "index")
+
+	entry1 := IndexEntry{
+		Start:    time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC),
+		Duration: 60 * time.Second,
+		Path:     "/recordings/my/path/1.mp4",
+	}
+	entry2 := IndexEntry{
+		Start:    time.Date(2008, 11, 7, 11, 23, 0, 0, time.UTC),
+		Duration: 30 * time.Second,
+		Path:     "/recordings/my/path/2.mp4",
+	}
+
+	err = IndexAdd(indexPath, "my/path", entry1)
+	require.NoError(t, err)
+
+	err = IndexAdd(indexPath, "my/path", entry2)
+	require.NoError(t, err)
+
+	err = IndexAdd(indexPath, "otherpath", entry1)
+	require.NoError(t, err)
+
+	entries, err := IndexRead(indexPath, "my/path")
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{entry1, entry2}, withoutSeq(entries))
+
+	_, err = IndexRead(indexPath, "missing")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestIndexPrune(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	indexPath := filepath.Join(dir, "index")
+
+	entry1 := IndexEntry{
+		Start:    time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC),
+		Duration: 60 * time.Second,
+		Path:     "/recordings/mypath/1.mp4",
+	}
+	entry2 := IndexEntry{
+		Start:    time.Date(2008, 11, 7, 11, 23, 0, 0, time.UTC),
+		Duration: 30 * time.Second,
+		Path:     "/recordings/mypath/2.mp4",
+	}
+	entry2b := entry2
+	entry2b.Duration = 45 * time.Second
+
+	for _, entry := range []IndexEntry{entry1, entry2, entry2b} {
+		err = IndexAdd(indexPath, "mypath", entry)
+		require.NoError(t, err)
+	}
+
+	// duplicate entries of the same segment are merged
+	err = IndexPrune(indexPath, "mypath", func(IndexEntry) bool { return true })
+	require.NoError(t, err)
+
+	entries, err := IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{entry1, entry2b}, withoutSeq(entries))
+
+	err = IndexPrune(indexPath, "mypath", func(entry IndexEntry) bool {
+		return entry.Path != entry1.Path
+	})
+	require.NoError(t, err)
+
+	entries, err = IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{entry2b}, withoutSeq(entries))
+
+	err = IndexPrune(indexPath, "missing", func(IndexEntry) bool { return true })
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestIndexSince(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	indexPath := filepath.Join(dir, "index")
+
+	entry1 := IndexEntry{
+		Start:    time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC),
+		Duration: 60 * time.Second,
+		Path:     "/recordings/mypath/1.mp4",
+	}
+	entry2 := IndexEntry{
+		Start:    time.Date(2008, 11, 7, 11, 23, 0, 0, time.UTC),
+		Duration: 30 * time.Second,
+		Path:     "/recordings/mypath/2.mp4",
+	}
+	entry3 := IndexEntry{
+		Start:    time.Date(2008, 11, 7, 11, 24, 0, 0, time.UTC),
+		Duration: 30 * time.Second,
+		Path:     "/recordings/mypath/3.mp4",
+	}
+
+	for _, entry := range []IndexEntry{entry1, entry2} {
+		err = IndexAdd(indexPath, "mypath", entry)
+		require.NoError(t, err)
+	}
+
+	entries, err := IndexSince(indexPath, "mypath", 0)
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{entry1, entry2}, withoutSeq(entries))
+	require.Less(t, entries[0].Seq, entries[1].Seq)
+
+	last := entries[1].Seq
+
+	// pruned entries are returned as tombstones and their sequence numbers are not reused
+	err = IndexPrune(indexPath, "mypath", func(entry IndexEntry) bool {
+		return entry.Path != entry2.Path
+	})
+	require.NoError(t, err)
+
+	err = IndexAdd(indexPath, "mypath", entry3)
+	require.NoError(t, err)
+
+	entries, err = IndexSince(indexPath, "mypath", last)
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{
+		{
+			Start:   entry2.Start,
+			Path:    entry2.Path,
+			Removed: true,
+		},
+		entry3,
+	}, withoutSeq(entries))
+	require.Less(t, last, entries[0].Seq)
+
+	entries, err = IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{entry1, entry3}, withoutSeq(entries))
+
+	last = entries[1].Seq
+
+	// relocated entries are returned again, after tombstones of their previous paths
+	err = IndexRelocate(indexPath, "mypath", map[string]string{entry1.Path: "/archive/mypath/1.mp4"})
+	require.NoError(t, err)
+
+	relocated := entry1
+	relocated.Path = "/archive/mypath/1.mp4"
+
+	entries, err = IndexSince(indexPath, "mypath", last)
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{
+		{
+			Start:   entry1.Start,
+			Path:    entry1.Path,
+			Removed: true,
+		},
+		relocated,
+	}, withoutSeq(entries))
+	require.Less(t, last, entries[0].Seq)
+	require.Less(t, entries[0].Seq, entries[1].Seq)
+
+	entries, err = IndexSince(indexPath, "mypath", entries[1].Seq)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	entries, err = IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{entry3, relocated}, withoutSeq(entries))
+}
+
+func TestIndexSeqExternalWriter(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	indexPath := filepath.Join(dir, "index")
+
+	err = IndexAdd(indexPath, "mypath", IndexEntry{
+		Start: time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC),
+		Path:  "/recordings/mypath/1.mp4",
+	})
+	require.NoError(t, err)
+
+	// entry written by another instance, with a clock that is ahead
+	external := time.Now().Add(time.Hour).UnixMicro()
+
+	buf, err := indexMarshal(IndexEntry{
+		Start: time.Date(2008, 11, 7, 11, 23, 0, 0, time.UTC),
+		Path:  "/recordings/mypath/2.mp4",
+		Seq:   external,
+	})
+	require.NoError(t, err)
+
+	f, err := os.OpenFile(filepath.Join(indexPath, "mypath.jsonl"), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write(append(buf, '\n'))
+	require.NoError(t, err)
+	f.Close()
+
+	err = IndexAdd(indexPath, "mypath", IndexEntry{
+		Start: time.Date(2008, 11, 7, 11, 24, 0, 0, time.UTC),
+		Path:  "/recordings/mypath/3.mp4",
+	})
+	require.NoError(t, err)
+
+	entries, err := IndexSince(indexPath, "mypath", external)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "/recordings/mypath/3.mp4", entries[0].Path)
+}
+
+func TestIndexRecovery(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	indexPath := filepath.Join(dir, "index")
+
+	err = os.MkdirAll(indexPath, 0o755)
+	require.NoError(t, err)
+
+	// entry truncated by a power loss
+	err = os.WriteFile(filepath.Join(indexPath, "mypath.jsonl"), []byte(`{"start":"2008-11-07T11:22:00Z","dur`), 0o644)
+	require.NoError(t, err)
+
+	// leftover of an interrupted rewrite
+	leftover := filepath.Join(indexPath, ".mypath.jsonl.tmp123")
+	err = os.WriteFile(leftover, []byte(`{"start":`), 0o644)
+	require.NoError(t, err)
+
+	entry := IndexEntry{
+		Start:    time.Date(2008, 11, 7, 11, 23, 0, 0, time.UTC),
+		Duration: 30 * time.Second,
+		Path:     "/recordings/mypath/2.mp4",
+	}
+
+	err = IndexAdd(indexPath, "mypath", entry)
+	require.NoError(t, err)
+
+	entries, err := IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{entry}, withoutSeq(entries))
+
+	err = IndexPrune(indexPath, "mypath", func(IndexEntry) bool { return false })
+	require.NoError(t, err)
+
+	_, err = os.Stat(leftover)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	matches, err := filepath.Glob(filepath.Join(indexPath, ".*"))
+	require.NoError(t, err)
+	require.Empty(t, matches)
+
+	entries, err = IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestIndexChecksum(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	indexPath := filepath.Join(dir, "index")
+
+	entry := IndexEntry{
+		Start:    time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC),
+		Duration: 60 * time.Second,
+		Path:     "/recordings/mypath/1.mp4",
+		Codecs:   []string{"H264", "MPEG-4 Audio"},
+	}
+
+	err = IndexAdd(indexPath, "mypath", entry)
+	require.NoError(t, err)
+
+	buf, err := os.ReadFile(filepath.Join(indexPath, "mypath.jsonl"))
+	require.NoError(t, err)
+	require.Contains(t, string(buf), `"crc":`)
+
+	// entry whose content does not match its checksum
+	corrupted := strings.Replace(string(buf), "1.mp4", "9.mp4", 1)
+
+	// entry written by a previous version, without checksum
+	legacy := `{"start":"2008-11-07T11:23:00Z","duration":30000000000,"path":"/recordings/mypath/2.mp4"}` + "\n"
+
+	err = os.WriteFile(filepath.Join(indexPath, "mypath.jsonl"), []byte(corrupted+legacy), 0o644)
+	require.NoError(t, err)
+
+	entries, err := IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{{
+		Start:    time.Date(2008, 11, 7, 11, 23, 0, 0, time.UTC),
+		Duration: 30 * time.Second,
+		Path:     "/recordings/mypath/2.mp4",
+	}}, entries)
+}
+
+func TestIndexLongEntry(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	indexPath := filepath.Join(dir, "index")
+
+	// entry longer than the default limit of bufio.Scanner
+	entry := IndexEntry{
+		Start:        time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC),
+		Duration:     24 * time.Hour,
+		Path:         "/recordings/mypath/1.mp4",
+		Fingerprints: make([]uint64, 20000),
+	}
+	for i := range entry.Fingerprints {
+		entry.Fingerprints[i] = uint64(i) * 0x9e3779b97f4a7c15
+	}
+
+	err = IndexAdd(indexPath, "mypath", entry)
+	require.NoError(t, err)
+
+	entries, err := IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, []IndexEntry{entry}, withoutSeq(entries))
+}
@@ -0,0 +1,207 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// MigratorEntry is a migrator entry.
+type MigratorEntry struct {
+	From      string
+	To        string
+	Format    conf.RecordFormat
+	IndexPath string
+	// maximum number of operations that read the recordings of a path at the same time
+	MaxReaders int
+}
+
+// Migrator moves recording segments written with a previous record path template
+// to the current one, and updates the index accordingly.
+type Migrator struct {
+	Entries  []MigratorEntry
+	Registry *Registry
+	Parent   logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+
+	done chan struct{}
+}
+
+// Initialize initializes a Migrator.
+func (m *Migrator) Initialize() {
+	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
+	m.done = make(chan struct{})
+
+	go m.run()
+}
+
+// Close closes the Migrator.
+func (m *Migrator) Close() {
+	m.ctxCancel()
+	<-m.done
+}
+
+// Log implements logger.Writer.
+func (m *Migrator) Log(level logger.Level, format string, args ...interface{}) {
+	m.Parent.Log(level, "[record migrator] "+format, args...)
+}
+
+func (m *Migrator) run() {
+	defer close(m.done)
+
+	for _, e := range m.Entries {
+		m.doRunEntry(&e)
+
+		if m.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (m *Migrator) doRunEntry(e *MigratorEntry) {
+	// we have to convert to absolute paths
+	// otherwise, entryPath and fpath inside Walk() won't have common elements
+	fromPath, _ := filepath.Abs(PathAddExtension(e.From, e.Format))
+	toPath, _ := filepath.Abs(PathAddExtension(e.To, e.Format))
+
+	var fpaths []string
+
+	filepath.Walk(CommonPath(fromPath), func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			var pa Path
+			if pa.Decode(fromPath, fpath) {
+				fpaths = append(fpaths, fpath)
+			}
+		}
+
+		return nil
+	})
+
+	// index entries are updated once per path, since each update rewrites the whole index
+	renames := make(map[string]map[string]string)
+
+	for _, fpath := range fpaths {
+		if m.ctx.Err() != nil {
+			break
+		}
+
+		var pa Path
+		pa.Decode(fromPath, fpath)
+		dest := pa.Encode(toPath)
+
+		// segments can match both templates
+		if dest == fpath {
+			continue
+		}
+
+		if _, err := os.Stat(dest); err == nil {
+			m.Log(logger.Debug, "skipping %s since %s already exists", fpath, dest)
+			continue
+		}
+
+		// segments are copied when templates point to different file systems
+		release, err := m.Registry.AcquireReader(m.ctx, pa.Path, e.MaxReaders)
+		if err != nil {
+			break
+		}
+
+		err = migrateSegment(fpath, dest)
+		release()
+		if err != nil {
+			m.Log(logger.Warn, "unable to move %s: %v", fpath, err)
+			continue
+		}
+
+		m.Log(logger.Info, "moved %s to %s", fpath, dest)
+
+		if pa.Path != "" {
+			m.Registry.SegmentsChanged(pa.Path)
+		}
+
+		if e.IndexPath != "" && pa.Path != "" {
+			if renames[pa.Path] == nil {
+				renames[pa.Path] = make(map[string]string)
+			}
+			renames[pa.Path][fpath] = dest
+		}
+	}
+
+	for pathName, pathRenames := range renames {
+		err := IndexRelocate(e.IndexPath, pathName, pathRenames)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			m.Log(logger.Warn, "unable to update index: %v", err)
+		}
+
+		m.Registry.SegmentsChanged(pathName)
+	}
+}
+
+func migrateSegment(fpath string, dest string) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(fpath, dest)
+	if err != nil {
+		// renaming fails when the templates point to different file systems
+		err = mirrorCopyFile(fpath, dest)
+		if err != nil {
+			return err
+		}
+		os.Remove(fpath)
+	}
+
+	return migrateChecksum(fpath, dest)
+}
+
+// checksum sidecars contain the file name of the segment, that has to be replaced.
+func migrateChecksum(fpath string, dest string) error {
+	buf, err := os.ReadFile(ChecksumPath(fpath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	// sidecars of repaired segments contain an additional line
+	content := ""
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 0 {
+			content += fields[0] + "  " + filepath.Base(dest) + "\n"
+		}
+	}
+
+	if content == "" {
+		return nil
+	}
+
+	tmp := ChecksumPath(dest) + ".tmp"
+
+	err = os.WriteFile(tmp, []byte(content), 0o644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, ChecksumPath(dest))
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(ChecksumPath(fpath))
+}
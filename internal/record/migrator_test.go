@@ -0,0 +1,78 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestMigrator(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-migrator")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fromPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+	toPath := filepath.Join(dir, "new", "%path/%Y/%m/%d/%H-%M-%S-%f")
+	indexPath := filepath.Join(dir, "index")
+
+	segPath := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4")
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(segPath, []byte{1, 2, 3, 4}, 0o644)
+	require.NoError(t, err)
+
+	err = ChecksumWrite(segPath)
+	require.NoError(t, err)
+
+	format := conf.RecordFormatFMP4
+
+	err = IndexAdd(indexPath, "mypath", IndexEntry{
+		Start:    time.Date(2008, 5, 20, 22, 15, 25, 0, time.Local),
+		Duration: 4 * time.Second,
+		Path:     segPath,
+		Format:   &format,
+	})
+	require.NoError(t, err)
+
+	m := &Migrator{
+		Entries: []MigratorEntry{{
+			From:      fromPath,
+			To:        toPath,
+			Format:    conf.RecordFormatFMP4,
+			IndexPath: indexPath,
+		}},
+		Parent: test.NilLogger,
+	}
+	m.Initialize()
+	<-m.done
+	m.Close()
+
+	_, err = os.Stat(segPath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = os.Stat(ChecksumPath(segPath))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	dest := filepath.Join(dir, "new", "mypath", "2008", "05", "20", "22-15-25-000000.mp4")
+
+	buf, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3, 4}, buf)
+
+	err = ChecksumVerify(dest)
+	require.NoError(t, err)
+
+	entries, err := IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, dest, entries[0].Path)
+	require.Equal(t, 4*time.Second, entries[0].Duration)
+}
@@ -0,0 +1,194 @@
+package record
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const mirrorRetryPause = 10 * time.Second
+
+func mirrorCopyFile(src string, dest string) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return err
+	}
+
+	// files are renamed into place once they are complete,
+	// in order not to leave truncated copies in the target.
+	tmp := dest + ".tmp"
+
+	err = func() error {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		_, err = io.Copy(out, in)
+		if err != nil {
+			return err
+		}
+
+		return out.Sync()
+	}()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dest)
+}
+
+// mirror copies completed segments, together with their checksums, into a second directory.
+// Segments that cannot be copied are kept in a backlog and copied again after a pause.
+type mirror struct {
+	agent *Agent
+
+	commonPath string
+	ctx        context.Context
+	ctxCancel  func()
+	mutex      sync.Mutex
+	backlog    []string
+	wake       chan struct{}
+	done       chan struct{}
+}
+
+func (m *mirror) initialize() {
+	// segments are placed in the target with the same path they have
+	// relative to the fixed part of recordPath.
+	m.commonPath, _ = filepath.Abs(CommonPath(m.agent.PathFormat))
+
+	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
+	m.wake = make(chan struct{}, 1)
+	m.done = make(chan struct{})
+
+	go m.run()
+}
+
+func (m *mirror) close() {
+	m.ctxCancel()
+	<-m.done
+
+	if n := m.backlogSize(); n != 0 {
+		m.agent.Log(logger.Warn, "%d segments have not been mirrored", n)
+	}
+}
+
+func (m *mirror) backlogSize() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.backlog)
+}
+
+func (m *mirror) push(segPath string) {
+	segPath, _ = filepath.Abs(segPath)
+
+	m.mutex.Lock()
+	m.backlog = append(m.backlog, segPath)
+	m.mutex.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *mirror) copySegment(segPath string) error {
+	rel, err := filepath.Rel(m.commonPath, segPath)
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(m.agent.MirrorPath, rel)
+
+	err = mirrorCopyFile(segPath, dest)
+	if err != nil {
+		return err
+	}
+
+	checksumPath := ChecksumPath(segPath)
+	if _, err = os.Stat(checksumPath); err == nil {
+		err = mirrorCopyFile(checksumPath, ChecksumPath(dest))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *mirror) run() {
+	defer close(m.done)
+
+	for {
+		m.mutex.Lock()
+		var segPath string
+		if len(m.backlog) != 0 {
+			segPath = m.backlog[0]
+		}
+		m.mutex.Unlock()
+
+		if segPath == "" {
+			select {
+			case <-m.wake:
+			case <-m.ctx.Done():
+				// segments that are pushed before closing are still copied
+				if m.backlogSize() == 0 {
+					return
+				}
+			}
+			continue
+		}
+
+		release, err := m.agent.Registry.AcquireReader(m.ctx, m.agent.PathName, m.agent.MaxReaders)
+		if err != nil {
+			// the mirror is closing, remaining segments are copied without waiting
+			release = func() {}
+		}
+
+		err = m.copySegment(segPath)
+		release()
+
+		switch {
+		case err == nil:
+			m.agent.Log(logger.Debug, "mirrored segment %s", segPath)
+
+			m.mutex.Lock()
+			m.backlog = m.backlog[1:]
+			m.mutex.Unlock()
+
+		case os.IsNotExist(err) && !fileExists(segPath):
+			// segment has been deleted in the meanwhile
+			m.mutex.Lock()
+			m.backlog = m.backlog[1:]
+			m.mutex.Unlock()
+
+		default:
+			m.agent.Log(logger.Warn, "unable to mirror segment %s (%d segments in backlog): %v",
+				segPath, m.backlogSize(), err)
+
+			select {
+			case <-time.After(mirrorRetryPause):
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func fileExists(fpath string) bool {
+	_, err := os.Stat(fpath)
+	return err == nil
+}
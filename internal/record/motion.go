@@ -0,0 +1,87 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// MotionEntry is the motion or activity score of a path in a time bucket.
+type MotionEntry struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Score    float64       `json:"score"`
+}
+
+// motion scores are stored in a subdirectory of the index directory,
+// in order not to be confused with index files.
+func motionFilePath(indexPath string, pathName string) string {
+	return filepath.Join(indexPath, "motion", url.PathEscape(pathName)+".jsonl")
+}
+
+// MotionAdd appends entries to the motion scores of a path.
+func MotionAdd(indexPath string, pathName string, entries []MotionEntry) error {
+	fpath := motionFilePath(indexPath, pathName)
+
+	err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	for _, entry := range entries {
+		var line []byte
+		line, err = json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	f, err := os.OpenFile(fpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// entries are written at once, in order not to interleave them with the ones of other writers
+	_, err = f.Write(buf)
+	return err
+}
+
+// MotionRead reads all motion scores of a path, sorted by start date.
+// Malformed entries are skipped.
+func MotionRead(indexPath string, pathName string) ([]MotionEntry, error) {
+	f, err := os.Open(motionFilePath(indexPath, pathName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []MotionEntry
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		var entry MotionEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err == nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Start.Before(entries[j].Start)
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,124 @@
+package record
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// OpenSegment is a segment that is currently being written.
+// It is not part of the index until it is completed.
+type OpenSegment struct {
+	PathName string
+	// absolute path of the segment
+	Path   string
+	Start  time.Time
+	Format conf.RecordFormat
+
+	// the header of the segment has been written, therefore the segment can be read.
+	ready bool
+}
+
+func (r *Registry) openSegmentAdd(pathName string, segPath string, start time.Time, format conf.RecordFormat) {
+	if r == nil {
+		return
+	}
+
+	segPath, _ = filepath.Abs(segPath)
+
+	r.openSegmentsMutex.Lock()
+	defer r.openSegmentsMutex.Unlock()
+
+	r.openSegments[segPath] = &OpenSegment{
+		PathName: pathName,
+		Path:     segPath,
+		Start:    start,
+		Format:   format,
+	}
+}
+
+func (r *Registry) openSegmentSetReady(segPath string) {
+	if r == nil {
+		return
+	}
+
+	segPath, _ = filepath.Abs(segPath)
+
+	r.openSegmentsMutex.Lock()
+	defer r.openSegmentsMutex.Unlock()
+
+	if seg, ok := r.openSegments[segPath]; ok {
+		seg.ready = true
+		r.SegmentsChanged(seg.PathName)
+	}
+}
+
+func (r *Registry) openSegmentRemove(segPath string) {
+	if r == nil {
+		return
+	}
+
+	segPath, _ = filepath.Abs(segPath)
+
+	r.openSegmentsMutex.Lock()
+	defer r.openSegmentsMutex.Unlock()
+
+	if seg, ok := r.openSegments[segPath]; ok {
+		delete(r.openSegments, segPath)
+		r.SegmentsChanged(seg.PathName)
+	}
+}
+
+// OpenSegments returns the segments of a path that are being written and can be read,
+// sorted by start.
+func (r *Registry) OpenSegments(pathName string) []OpenSegment {
+	if r == nil {
+		return nil
+	}
+
+	r.openSegmentsMutex.RLock()
+	defer r.openSegmentsMutex.RUnlock()
+
+	var out []OpenSegment
+
+	for _, seg := range r.openSegments {
+		if seg.PathName == pathName && seg.ready {
+			out = append(out, *seg)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Start.Before(out[j].Start)
+	})
+
+	return out
+}
+
+// SegmentIsCreating checks whether a segment has been created
+// but its header has not been written yet, therefore it cannot be read.
+func (r *Registry) SegmentIsCreating(segPath string) bool {
+	if r == nil {
+		return false
+	}
+
+	r.openSegmentsMutex.RLock()
+	defer r.openSegmentsMutex.RUnlock()
+
+	seg, ok := r.openSegments[segPath]
+	return ok && !seg.ready
+}
+
+// SegmentIsOpen checks whether a segment is being written.
+func (r *Registry) SegmentIsOpen(segPath string) bool {
+	if r == nil {
+		return false
+	}
+
+	r.openSegmentsMutex.RLock()
+	defer r.openSegmentsMutex.RUnlock()
+
+	_, ok := r.openSegments[segPath]
+	return ok
+}
@@ -100,7 +100,9 @@ func (p *Path) Decode(format string, v string) bool {
 	re = strings.ReplaceAll(re, "%S", "([0-9]{2})")
 	re = strings.ReplaceAll(re, "%f", "([0-9]{6})")
 	re = strings.ReplaceAll(re, "%s", "([0-9]{10})")
-	r := regexp.MustCompile(re)
+
+	// do not match files that are placed next to segments, like checksums
+	r := regexp.MustCompile(re + "$")
 
 	var groupMapping []string
 	cur := format
@@ -0,0 +1,81 @@
+package record
+
+import (
+	"context"
+)
+
+type readersPath struct {
+	running int
+	queue   []chan struct{}
+}
+
+// AcquireReader waits until the recordings of a path can be read, and returns a function that releases the slot.
+// At most max operations read the recordings of each path at the same time,
+// in order to leave bandwidth to the agent on slow storage.
+// Operations that exceed the limit wait in a queue and are served in order of arrival.
+// Slots are shared by the playback server and maintenance routines. A zero max doesn't limit operations.
+func (r *Registry) AcquireReader(ctx context.Context, pathName string, max int) (func(), error) {
+	if r == nil || max == 0 {
+		return func() {}, nil
+	}
+
+	r.readersMutex.Lock()
+
+	pa, ok := r.readers[pathName]
+	if !ok {
+		pa = &readersPath{}
+		r.readers[pathName] = pa
+	}
+
+	if pa.running < max {
+		pa.running++
+		r.readersMutex.Unlock()
+		return func() { r.releaseReader(pathName) }, nil
+	}
+
+	ch := make(chan struct{})
+	pa.queue = append(pa.queue, ch)
+	r.readersMutex.Unlock()
+
+	select {
+	case <-ch:
+		return func() { r.releaseReader(pathName) }, nil
+
+	case <-ctx.Done():
+		r.readersMutex.Lock()
+		defer r.readersMutex.Unlock()
+
+		for i, c := range pa.queue {
+			if c == ch {
+				pa.queue = append(pa.queue[:i], pa.queue[i+1:]...)
+				return nil, ctx.Err()
+			}
+		}
+
+		// the slot has been assigned in the meanwhile, pass it to the next operation
+		r.releaseReaderLocked(pathName)
+		return nil, ctx.Err()
+	}
+}
+
+func (r *Registry) releaseReader(pathName string) {
+	r.readersMutex.Lock()
+	defer r.readersMutex.Unlock()
+	r.releaseReaderLocked(pathName)
+}
+
+func (r *Registry) releaseReaderLocked(pathName string) {
+	pa := r.readers[pathName]
+
+	if len(pa.queue) != 0 {
+		close(pa.queue[0])
+		pa.queue = pa.queue[1:]
+		return
+	}
+
+	pa.running--
+
+	if pa.running == 0 {
+		delete(r.readers, pathName)
+	}
+}
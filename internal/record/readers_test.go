@@ -0,0 +1,192 @@
+package record
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestRegistryAcquireReader(t *testing.T) {
+	r := &Registry{}
+	r.Initialize()
+
+	release1, err := r.AcquireReader(context.Background(), "mypath", 1)
+	require.NoError(t, err)
+
+	// other paths are not affected
+	release2, err := r.AcquireReader(context.Background(), "otherpath", 1)
+	require.NoError(t, err)
+	release2()
+
+	acquired := make(chan func())
+
+	go func() {
+		release, err2 := r.AcquireReader(context.Background(), "mypath", 1)
+		require.NoError(t, err2)
+		acquired <- release
+	}()
+
+	// wait until the operation is queued
+	for {
+		r.readersMutex.Lock()
+		queued := len(r.readers["mypath"].queue)
+		r.readersMutex.Unlock()
+		if queued != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a canceled operation leaves the queue
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer ctxCancel()
+	_, err = r.AcquireReader(ctx, "mypath", 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	select {
+	case <-acquired:
+		t.Fatal("should not happen")
+	default:
+	}
+
+	release1()
+	release3 := <-acquired
+	release3()
+
+	require.Empty(t, r.readers)
+
+	// no limit
+	release4, err := r.AcquireReader(context.Background(), "mypath", 0)
+	require.NoError(t, err)
+	release4()
+
+	// nil registries don't limit operations
+	release5, err := (*Registry)(nil).AcquireReader(context.Background(), "mypath", 1)
+	require.NoError(t, err)
+	release5()
+}
+
+// waitReaders waits until the slots of a path are in the given state.
+func waitReaders(t *testing.T, r *Registry, pathName string, queued int) {
+	for i := 0; ; i++ {
+		r.readersMutex.Lock()
+		n := -1
+		if pa, ok := r.readers[pathName]; ok {
+			n = len(pa.queue)
+		}
+		r.readersMutex.Unlock()
+
+		if n == queued {
+			return
+		}
+
+		require.Less(t, i, 200, "timed out")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMaintenanceReaderLimit(t *testing.T) {
+	for _, ca := range []string{"thinner", "converter", "repairer", "migrator", "mirror"} {
+		t.Run(ca, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "mediamtx-readers")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			recordPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+
+			ext := ".mp4"
+			if ca == "converter" {
+				ext = ".ts"
+			}
+
+			segPath := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000"+ext)
+
+			err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+			require.NoError(t, err)
+
+			err = os.WriteFile(segPath, []byte{1, 2, 3, 4}, 0o644)
+			require.NoError(t, err)
+
+			r := &Registry{}
+			r.Initialize()
+
+			release, err := r.AcquireReader(context.Background(), "mypath", 1)
+			require.NoError(t, err)
+
+			var closeRoutine func()
+
+			switch ca {
+			case "thinner":
+				th := &Thinner{
+					Entries:  []ThinnerEntry{{Path: recordPath, ThinAfter: time.Hour, MaxReaders: 1}},
+					Registry: r,
+					Parent:   test.NilLogger,
+				}
+				th.Initialize()
+				closeRoutine = th.Close
+
+			case "converter":
+				c := &Converter{
+					Entries:  []ConverterEntry{{Path: recordPath, MaxReaders: 1}},
+					Registry: r,
+					Parent:   test.NilLogger,
+				}
+				c.Initialize()
+				closeRoutine = c.Close
+
+			case "repairer":
+				rp := &Repairer{
+					Entries:  []RepairerEntry{{Path: recordPath, MaxReaders: 1}},
+					Registry: r,
+					Parent:   test.NilLogger,
+				}
+				rp.Initialize()
+				closeRoutine = rp.Close
+
+			case "migrator":
+				m := &Migrator{
+					Entries: []MigratorEntry{{
+						From:       recordPath,
+						To:         filepath.Join(dir, "new", "%path/%Y-%m-%d_%H-%M-%S-%f"),
+						Format:     conf.RecordFormatFMP4,
+						MaxReaders: 1,
+					}},
+					Registry: r,
+					Parent:   test.NilLogger,
+				}
+				m.Initialize()
+				closeRoutine = m.Close
+
+			case "mirror":
+				m := &mirror{agent: &Agent{
+					PathFormat: recordPath,
+					PathName:   "mypath",
+					MirrorPath: filepath.Join(dir, "mirror"),
+					MaxReaders: 1,
+					Registry:   r,
+					Parent:     test.NilLogger,
+				}}
+				m.initialize()
+				m.push(segPath)
+				closeRoutine = m.close
+			}
+
+			defer closeRoutine()
+
+			// the routine waits for the slot
+			waitReaders(t, r, "mypath", 1)
+
+			release()
+
+			// the routine has read the segment and released the slot
+			waitReaders(t, r, "mypath", -1)
+		})
+	}
+}
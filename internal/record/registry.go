@@ -0,0 +1,46 @@
+package record
+
+import (
+	"sync"
+	"time"
+)
+
+// Registry tracks the segments that are being written by agents of this process,
+// the changes of segments of each path, the operations that read them and the timespans that are hidden.
+// It is shared by agents, maintenance routines and the playback server of the same process.
+// Segments written by other processes, even on a shared storage, are not tracked.
+// A nil Registry tracks nothing.
+type Registry struct {
+	created time.Time
+
+	openSegmentsMutex sync.RWMutex
+	openSegments      map[string]*OpenSegment
+
+	changesMutex sync.Mutex
+	changes      map[string]uint64
+
+	readersMutex sync.Mutex
+	readers      map[string]*readersPath
+
+	hiddenMutex sync.RWMutex
+	hidden      map[string][]HiddenTimespan
+}
+
+// Initialize initializes Registry.
+func (r *Registry) Initialize() {
+	r.created = time.Now()
+	r.openSegments = make(map[string]*OpenSegment)
+	r.changes = make(map[string]uint64)
+	r.readers = make(map[string]*readersPath)
+}
+
+// modifiedSinceCreation checks whether a segment has been modified after the registry has been created.
+// Segments of this process that have been modified since then are either open or complete,
+// while other segments may be being written by other processes that share the same storage.
+func (r *Registry) modifiedSinceCreation(modTime time.Time) bool {
+	if r == nil {
+		return false
+	}
+
+	return modTime.After(r.created)
+}
@@ -0,0 +1,382 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
+)
+
+// runs of the repairer at startup and on-demand runs are not allowed to overlap.
+var repairerMutex sync.Mutex
+
+// RepairerEntry is a repairer entry.
+type RepairerEntry struct {
+	Path      string
+	IndexPath string
+	// maximum number of operations that read the recordings of a path at the same time
+	MaxReaders int
+}
+
+// RepairedSegment is a fMP4 segment whose last fragment was truncated, usually by a power loss.
+// Segments without complete fragments are removed.
+type RepairedSegment struct {
+	Path         string
+	Start        time.Time
+	File         string
+	Size         int64
+	RepairedSize int64
+	Duration     time.Duration
+	Removed      bool
+}
+
+// Repair verifies the fMP4 segments of an entry immediately, limiting the verification
+// to segments of a path when pathName is not empty.
+// Truncated segments are trimmed to their last complete fragment and their index entry is updated.
+// When dryRun is true, truncated segments are returned without being modified.
+func Repair(
+	e RepairerEntry,
+	pathName string,
+	dryRun bool,
+	registry *Registry,
+	notifier *notify.Notifier,
+	parent logger.Writer,
+) ([]RepairedSegment, error) {
+	r := &Repairer{
+		Registry: registry,
+		Notifier: notifier,
+		Parent:   parent,
+		ctx:      context.Background(),
+	}
+	_, repaired, err := r.doRunEntry(&e, pathName, dryRun)
+	return repaired, err
+}
+
+// Repairer verifies fMP4 segments when the server starts,
+// and repairs segments that were left truncated by a crash or a power loss.
+// Segments that have been modified after Registry has been created are not verified,
+// since they may be being written by other instances that share the recording directory.
+type Repairer struct {
+	Entries  []RepairerEntry
+	Notifier *notify.Notifier
+	Registry *Registry
+	Parent   logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+
+	done chan struct{}
+}
+
+// Initialize initializes a Repairer.
+func (r *Repairer) Initialize() {
+	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
+	r.done = make(chan struct{})
+
+	go r.run()
+}
+
+// Close closes the Repairer.
+func (r *Repairer) Close() {
+	r.ctxCancel()
+	<-r.done
+}
+
+// Log implements logger.Writer.
+func (r *Repairer) Log(level logger.Level, format string, args ...interface{}) {
+	r.Parent.Log(level, "[record repairer] "+format, args...)
+}
+
+func (r *Repairer) run() {
+	defer close(r.done)
+
+	checked := 0
+	repaired := 0
+
+	for _, e := range r.Entries {
+		n, segments, _ := r.doRunEntry(&e, "", false)
+		checked += n
+		repaired += len(segments)
+
+		if r.ctx.Err() != nil {
+			return
+		}
+	}
+
+	r.Log(logger.Info, "verified %d segments, repaired %d", checked, repaired)
+}
+
+// doRunEntry returns the number of verified segments and the truncated ones.
+func (r *Repairer) doRunEntry(e *RepairerEntry, pathName string, dryRun bool) (int, []RepairedSegment, error) {
+	repairerMutex.Lock()
+	defer repairerMutex.Unlock()
+
+	// we have to convert to absolute paths
+	// otherwise, entryPath and fpath inside Walk() won't have common elements
+	entryPath, _ := filepath.Abs(PathAddExtension(e.Path, conf.RecordFormatFMP4))
+
+	var paths []Path
+	var fpaths []string
+	var modTimes []time.Time
+
+	err := filepath.Walk(CommonPath(entryPath), func(fpath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			var pa Path
+			if pa.Decode(entryPath, fpath) && (pathName == "" || pa.Path == pathName) {
+				paths = append(paths, pa)
+				fpaths = append(fpaths, fpath)
+				modTimes = append(modTimes, info.ModTime())
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, nil, err
+	}
+
+	checked := 0
+	var repaired []RepairedSegment
+
+	// index entries, grouped by path name. When a segment has multiple entries, the last one is used.
+	indexes := make(map[string]map[string]IndexEntry)
+
+	for i, fpath := range fpaths {
+		if r.ctx.Err() != nil {
+			break
+		}
+
+		// segments that are being written are incomplete by design
+		if r.Registry.SegmentIsOpen(fpath) {
+			continue
+		}
+
+		// the registry doesn't track segments of other instances that share the recording directory,
+		// and their segments that are being written can't be told apart from truncated ones.
+		// Segments truncated by a crash of this instance have been modified before it started.
+		if r.Registry.modifiedSinceCreation(modTimes[i]) {
+			continue
+		}
+
+		release, err := r.Registry.AcquireReader(r.ctx, paths[i].Path, e.MaxReaders)
+		if err != nil {
+			break
+		}
+
+		checked++
+
+		seg, err := r.verifySegment(fpath, paths[i])
+		if err != nil {
+			release()
+			r.Log(logger.Warn, "unable to verify %s: %v", fpath, err)
+			continue
+		}
+
+		if seg == nil {
+			release()
+			continue
+		}
+
+		repaired = append(repaired, *seg)
+
+		if dryRun {
+			release()
+			continue
+		}
+
+		err = r.repairSegment(seg)
+		release()
+		if err != nil {
+			r.Log(logger.Warn, "unable to repair %s: %v", fpath, err)
+			continue
+		}
+
+		if seg.Removed {
+			r.Log(logger.Warn, "removed %s, since it doesn't contain complete fragments", fpath)
+		} else {
+			r.Log(logger.Warn, "trimmed %s from %d to %d bytes", fpath, seg.Size, seg.RepairedSize)
+		}
+
+		if seg.Path == "" {
+			continue
+		}
+
+		r.Registry.SegmentsChanged(seg.Path)
+
+		if e.IndexPath != "" {
+			r.updateIndex(e.IndexPath, indexes, seg)
+		}
+	}
+
+	return checked, repaired, nil
+}
+
+// verifySegment returns the repair of a segment, or nil if the segment is complete.
+func (r *Repairer) verifySegment(fpath string, pa Path) (*RepairedSegment, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := fmp4ReadLayout(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	if l.completeSize == fi.Size() {
+		return nil, nil
+	}
+
+	seg := &RepairedSegment{
+		Path:         pa.Path,
+		Start:        pa.Start,
+		File:         fpath,
+		Size:         fi.Size(),
+		RepairedSize: l.completeSize,
+		Removed:      l.lastFragment == 0,
+	}
+
+	if !seg.Removed {
+		seg.Duration, err = fmp4ReadEnd(f, l)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		seg.RepairedSize = 0
+	}
+
+	return seg, nil
+}
+
+func (r *Repairer) repairSegment(seg *RepairedSegment) error {
+	if seg.Removed {
+		err := os.Remove(seg.File)
+		if err != nil {
+			return err
+		}
+
+		os.Remove(ChecksumPath(seg.File))
+		return nil
+	}
+
+	// the segment is not truncated in place, since it may share its content
+	// with hard links, like exports that have been cloned from it.
+	// A trimmed copy replaces it, in the same way as the thinner does.
+	src, err := os.Open(seg.File)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(seg.File), ".repair-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmp, io.LimitReader(src, seg.RepairedSize))
+
+	// flush the copy to disk before replacing the original segment,
+	// in order not to lose both in case of power loss
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	err2 := tmp.Close()
+	if err == nil {
+		err = err2
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), seg.File)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// directories cannot be flushed on some platforms, therefore errors are ignored
+	syncDir(filepath.Dir(seg.File)) //nolint:errcheck
+
+	// the original checksum isn't valid anymore, but it is kept in order to prove
+	// that the segment has been modified
+	if _, err = os.Stat(ChecksumPath(seg.File)); err == nil {
+		err = ChecksumRepair(seg.File)
+		if err != nil {
+			r.Log(logger.Warn, "unable to write checksum: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// updateIndex updates the duration of a repaired segment in the index,
+// or adds the segment to the index, since segments interrupted by a crash are never indexed.
+func (r *Repairer) updateIndex(indexPath string, indexes map[string]map[string]IndexEntry, seg *RepairedSegment) {
+	if seg.Removed {
+		err := IndexPrune(indexPath, seg.Path, func(entry IndexEntry) bool {
+			return entry.Path != seg.File
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.Log(logger.Warn, "unable to update index: %v", err)
+		}
+		r.Registry.SegmentsChanged(seg.Path)
+		return
+	}
+
+	index, ok := indexes[seg.Path]
+	if !ok {
+		index = make(map[string]IndexEntry)
+		entries, err := IndexRead(indexPath, seg.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.Log(logger.Warn, "unable to read index: %v", err)
+		}
+		for _, entry := range entries {
+			index[entry.Path] = entry
+		}
+		indexes[seg.Path] = index
+	}
+
+	entry, indexed := index[seg.File]
+	if !indexed {
+		format := conf.RecordFormatFMP4
+		entry = IndexEntry{
+			Start:  seg.Start,
+			Path:   seg.File,
+			Format: &format,
+		}
+	}
+	entry.Duration = seg.Duration
+
+	err := IndexAdd(indexPath, seg.Path, entry)
+	if err != nil {
+		r.Log(logger.Warn, "unable to update index: %v", err)
+		return
+	}
+
+	r.Registry.SegmentsChanged(seg.Path)
+
+	r.Notifier.Publish(notify.Event{
+		Type:   notify.EventIndexAdd,
+		Path:   seg.Path,
+		Fields: map[string]string{"segmentPath": seg.File},
+	})
+}
@@ -0,0 +1,172 @@
+package record
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+// errRepairInitTruncated is returned when the initialization of a segment is truncated,
+// therefore the segment cannot be repaired.
+var errRepairInitTruncated = errors.New("initialization is truncated")
+
+// fmp4Layout describes the complete part of a fMP4 segment.
+type fmp4Layout struct {
+	// size of boxes that precede the first fragment
+	initSize int64
+
+	// size of the segment until the end of the last complete fragment
+	completeSize int64
+
+	// offset of the last complete fragment, or zero when there are no fragments
+	lastFragment int64
+}
+
+// repairReadBoxHeader reads the type and the size of the box that starts at offset.
+// It returns false when the header is incomplete or when the box exceeds fileSize.
+func repairReadBoxHeader(r io.ReaderAt, offset int64, fileSize int64) (string, int64, bool) {
+	header := make([]byte, 16)
+
+	n, _ := r.ReadAt(header, offset)
+	if n < 8 {
+		return "", 0, false
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	typ := string(header[4:8])
+	headerSize := int64(8)
+
+	if size == 1 {
+		if n < 16 {
+			return "", 0, false
+		}
+		size = int64(binary.BigEndian.Uint64(header[8:]))
+		headerSize = 16
+	}
+
+	// zero-sized boxes are never written by the recorder, and zeroes are usually
+	// left by file systems that lost the content of the file after a power loss.
+	if size < headerSize || size > fileSize-offset {
+		return "", 0, false
+	}
+
+	return typ, size, true
+}
+
+// fmp4ReadLayout finds the end of the last complete fragment of a fMP4 segment.
+// A fragment is complete when both its moof and its mdat boxes are complete.
+func fmp4ReadLayout(r io.ReaderAt, fileSize int64) (*fmp4Layout, error) {
+	var l fmp4Layout
+	var offset int64
+	var moof int64 = -1
+	hasMoov := false
+
+	for offset < fileSize {
+		typ, size, ok := repairReadBoxHeader(r, offset, fileSize)
+		if !ok {
+			break
+		}
+
+		switch typ {
+		case "moof":
+			if moof >= 0 {
+				return nil, fmt.Errorf("unexpected box 'moof' at offset %d", offset)
+			}
+			moof = offset
+
+			if l.initSize == 0 {
+				l.initSize = offset
+			}
+
+		case "mdat":
+			if moof < 0 {
+				return nil, fmt.Errorf("unexpected box 'mdat' at offset %d", offset)
+			}
+			l.lastFragment = moof
+			l.completeSize = offset + size
+			moof = -1
+
+		default:
+			if l.initSize != 0 {
+				return nil, fmt.Errorf("unexpected box '%s' at offset %d", typ, offset)
+			}
+			if typ == "moov" {
+				hasMoov = true
+			}
+		}
+
+		offset += size
+	}
+
+	if l.initSize == 0 {
+		if !hasMoov {
+			return nil, errRepairInitTruncated
+		}
+		l.initSize = offset
+	}
+
+	if l.completeSize == 0 {
+		l.completeSize = l.initSize
+	}
+
+	return &l, nil
+}
+
+// fmp4ReadEnd returns the end of the last complete fragment of a fMP4 segment,
+// relative to the start of the segment.
+func fmp4ReadEnd(r io.ReaderAt, l *fmp4Layout) (time.Duration, error) {
+	if l.lastFragment == 0 {
+		return 0, nil
+	}
+
+	var init fmp4.Init
+	err := init.Unmarshal(io.NewSectionReader(r, 0, l.initSize))
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, l.completeSize-l.lastFragment)
+	_, err = r.ReadAt(buf, l.lastFragment)
+	if err != nil {
+		return 0, err
+	}
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	timeScales := make(map[int]uint32)
+	for _, track := range init.Tracks {
+		timeScales[track.ID] = track.TimeScale
+	}
+
+	var end time.Duration
+
+	for _, part := range parts {
+		for _, track := range part.Tracks {
+			timeScale, ok := timeScales[track.ID]
+			if !ok || timeScale == 0 {
+				continue
+			}
+
+			v := track.BaseTime
+			for _, s := range track.Samples {
+				v += uint64(s.Duration)
+			}
+
+			d := time.Duration(v/uint64(timeScale))*time.Second +
+				time.Duration(v%uint64(timeScale))*time.Second/time.Duration(timeScale)
+			if d > end {
+				end = d
+			}
+		}
+	}
+
+	return end, nil
+}
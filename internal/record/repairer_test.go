@@ -0,0 +1,205 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestRepairer(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-repairer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	var buf seekablebuffer.Buffer
+
+	init := fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec: &fmp4.CodecH264{
+				SPS: test.FormatH264.SPS,
+				PPS: test.FormatH264.PPS,
+			},
+		}},
+	}
+	err = init.Marshal(&buf)
+	require.NoError(t, err)
+
+	initSize := len(buf.Bytes())
+
+	err = (&fmp4.Part{
+		SequenceNumber: 1,
+		Tracks: []*fmp4.PartTrack{{
+			ID: 1,
+			Samples: []*fmp4.PartSample{
+				{Duration: 90000, Payload: []byte{5}},
+				{Duration: 90000, IsNonSyncSample: true, Payload: []byte{1}},
+			},
+		}},
+	}).Marshal(&buf)
+	require.NoError(t, err)
+
+	completeSize := len(buf.Bytes())
+
+	err = (&fmp4.Part{
+		SequenceNumber: 2,
+		Tracks: []*fmp4.PartTrack{{
+			ID:       1,
+			BaseTime: 180000,
+			Samples: []*fmp4.PartSample{
+				{Duration: 90000, Payload: []byte{5, 6, 7, 8}},
+			},
+		}},
+	}).Marshal(&buf)
+	require.NoError(t, err)
+
+	complete := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4")
+	err = os.WriteFile(complete, buf.Bytes(), 0o644)
+	require.NoError(t, err)
+
+	// the mdat of the second fragment is truncated
+	truncated := filepath.Join(dir, "mypath", "2008-05-20_23-15-25-000000.mp4")
+	err = os.WriteFile(truncated, buf.Bytes()[:len(buf.Bytes())-2], 0o644)
+	require.NoError(t, err)
+
+	// the moof of the first fragment is truncated
+	empty := filepath.Join(dir, "mypath", "2008-05-21_00-15-25-000000.mp4")
+	err = os.WriteFile(empty, buf.Bytes()[:initSize+4], 0o644)
+	require.NoError(t, err)
+
+	e := RepairerEntry{
+		Path:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		IndexPath: filepath.Join(dir, "index"),
+	}
+
+	expected := []RepairedSegment{
+		{
+			Path:         "mypath",
+			Start:        time.Date(2008, 0o5, 20, 23, 15, 25, 0, time.Local),
+			File:         truncated,
+			Size:         int64(len(buf.Bytes()) - 2),
+			RepairedSize: int64(completeSize),
+			Duration:     2 * time.Second,
+		},
+		{
+			Path:    "mypath",
+			Start:   time.Date(2008, 0o5, 21, 0, 15, 25, 0, time.Local),
+			File:    empty,
+			Size:    int64(initSize + 4),
+			Removed: true,
+		},
+	}
+
+	repaired, err := Repair(e, "mypath", true, nil, nil, test.NilLogger)
+	require.NoError(t, err)
+	require.Equal(t, expected, repaired)
+
+	fi, err := os.Stat(truncated)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(buf.Bytes())-2), fi.Size())
+
+	// hard links, like cloned exports, are not modified
+	clone := filepath.Join(dir, "clone.mp4")
+	err = os.Link(truncated, clone)
+	require.NoError(t, err)
+
+	repaired, err = Repair(e, "mypath", false, nil, nil, test.NilLogger)
+	require.NoError(t, err)
+	require.Equal(t, expected, repaired)
+
+	cloneBuf, err := os.ReadFile(clone)
+	require.NoError(t, err)
+	require.Equal(t, buf.Bytes()[:len(buf.Bytes())-2], cloneBuf)
+
+	tmpFiles, err := filepath.Glob(filepath.Join(dir, "mypath", ".repair-*"))
+	require.NoError(t, err)
+	require.Empty(t, tmpFiles)
+
+	fi, err = os.Stat(complete)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(buf.Bytes())), fi.Size())
+
+	fi, err = os.Stat(truncated)
+	require.NoError(t, err)
+	require.Equal(t, int64(completeSize), fi.Size())
+
+	_, err = os.Stat(empty)
+	require.Error(t, err)
+
+	entries, err := IndexRead(e.IndexPath, "mypath")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, truncated, entries[0].Path)
+	require.Equal(t, 2*time.Second, entries[0].Duration)
+
+	repaired, err = Repair(e, "mypath", false, nil, nil, test.NilLogger)
+	require.NoError(t, err)
+	require.Empty(t, repaired)
+}
+
+func TestRepairerModifiedSegments(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-repairer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	registry := &Registry{}
+	registry.Initialize()
+
+	var buf seekablebuffer.Buffer
+
+	init := fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec: &fmp4.CodecH264{
+				SPS: test.FormatH264.SPS,
+				PPS: test.FormatH264.PPS,
+			},
+		}},
+	}
+	err = init.Marshal(&buf)
+	require.NoError(t, err)
+
+	// a segment that is being written by another instance, that is not tracked by the registry
+	fpath := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4")
+	err = os.WriteFile(fpath, append(buf.Bytes(), 0, 0, 0, 100), 0o644)
+	require.NoError(t, err)
+
+	// the resolution of modification times may be lower than the one of the clock
+	err = os.Chtimes(fpath, time.Now(), time.Now())
+	require.NoError(t, err)
+
+	e := RepairerEntry{
+		Path: filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+	}
+
+	repaired, err := Repair(e, "mypath", false, registry, nil, test.NilLogger)
+	require.NoError(t, err)
+	require.Empty(t, repaired)
+
+	_, err = os.Stat(fpath)
+	require.NoError(t, err)
+
+	// the segment has been left truncated by a crash that happened before the registry was created
+	err = os.Chtimes(fpath, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	repaired, err = Repair(e, "mypath", false, registry, nil, test.NilLogger)
+	require.NoError(t, err)
+	require.Len(t, repaired, 1)
+	require.True(t, repaired[0].Removed)
+}
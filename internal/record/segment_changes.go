@@ -0,0 +1,26 @@
+package record
+
+// SegmentsChanged signals that segments of a path have been added, completed, moved or removed.
+func (r *Registry) SegmentsChanged(pathName string) {
+	if r == nil {
+		return
+	}
+
+	r.changesMutex.Lock()
+	defer r.changesMutex.Unlock()
+
+	r.changes[pathName]++
+}
+
+// SegmentsGeneration returns a counter that is incremented every time segments of a path change.
+// It allows to cache the list of segments of a path.
+func (r *Registry) SegmentsGeneration(pathName string) uint64 {
+	if r == nil {
+		return 0
+	}
+
+	r.changesMutex.Lock()
+	defer r.changesMutex.Unlock()
+
+	return r.changes[pathName]
+}
@@ -0,0 +1,249 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/notify"
+)
+
+// ThinnerEntry is a thinner entry.
+type ThinnerEntry struct {
+	Path      string
+	ThinAfter time.Duration
+	IndexPath string
+	// maximum number of operations that read the recordings of a path at the same time
+	MaxReaders int
+}
+
+// Thinner removes non-sync video samples from old fMP4 segments,
+// in order to reduce their size while keeping them seekable.
+type Thinner struct {
+	Entries  []ThinnerEntry
+	Notifier *notify.Notifier
+	Registry *Registry
+	Parent   logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+
+	// segments that have already been checked.
+	// It allows to skip segments that are not in the index.
+	checked map[string]struct{}
+
+	done chan struct{}
+}
+
+// Initialize initializes a Thinner.
+func (t *Thinner) Initialize() {
+	t.ctx, t.ctxCancel = context.WithCancel(context.Background())
+	t.checked = make(map[string]struct{})
+	t.done = make(chan struct{})
+
+	go t.run()
+}
+
+// Close closes the Thinner.
+func (t *Thinner) Close() {
+	t.ctxCancel()
+	<-t.done
+}
+
+// Log implements logger.Writer.
+func (t *Thinner) Log(level logger.Level, format string, args ...interface{}) {
+	t.Parent.Log(level, "[record thinner] "+format, args...)
+}
+
+func (t *Thinner) run() {
+	defer close(t.done)
+
+	interval := 30 * 60 * time.Second
+	for _, e := range t.Entries {
+		if interval > (e.ThinAfter / 2) {
+			interval = e.ThinAfter / 2
+		}
+	}
+
+	t.doRun()
+
+	for {
+		select {
+		case <-time.After(interval):
+			t.doRun()
+
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *Thinner) doRun() {
+	for _, e := range t.Entries {
+		t.doRunEntry(&e)
+
+		if t.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (t *Thinner) doRunEntry(e *ThinnerEntry) {
+	// we have to convert to absolute paths
+	// otherwise, entryPath and fpath inside Walk() won't have common elements
+	entryPath, _ := filepath.Abs(PathAddExtension(e.Path, conf.RecordFormatFMP4))
+	now := timeNow()
+
+	var fpaths []string
+
+	filepath.Walk(CommonPath(entryPath), func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			var pa Path
+			if pa.Decode(entryPath, fpath) && now.Sub(pa.Start) > e.ThinAfter {
+				if _, ok := t.checked[fpath]; !ok {
+					fpaths = append(fpaths, fpath)
+				}
+			}
+		}
+
+		return nil
+	})
+
+	// index entries, grouped by path name. When a segment has multiple entries, the last one is used.
+	indexes := make(map[string]map[string]IndexEntry)
+
+	for _, fpath := range fpaths {
+		if t.ctx.Err() != nil {
+			return
+		}
+
+		// segments that are being written can't be rewritten
+		if t.Registry.SegmentIsOpen(fpath) {
+			continue
+		}
+
+		var pa Path
+		pa.Decode(entryPath, fpath)
+
+		var entry IndexEntry
+		var indexed bool
+
+		if e.IndexPath != "" && pa.Path != "" {
+			index, ok := indexes[pa.Path]
+			if !ok {
+				index = make(map[string]IndexEntry)
+				entries, err := IndexRead(e.IndexPath, pa.Path)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					t.Log(logger.Warn, "unable to read index: %v", err)
+				}
+				for _, entry := range entries {
+					index[entry.Path] = entry
+				}
+				indexes[pa.Path] = index
+			}
+
+			entry, indexed = index[fpath]
+			if indexed && entry.Thinned {
+				t.checked[fpath] = struct{}{}
+				continue
+			}
+		}
+
+		release, err := t.Registry.AcquireReader(t.ctx, pa.Path, e.MaxReaders)
+		if err != nil {
+			return
+		}
+
+		thinned, err := t.thinSegment(fpath)
+		release()
+		if err != nil {
+			t.Log(logger.Warn, "unable to thin %s: %v", fpath, err)
+			continue
+		}
+
+		t.checked[fpath] = struct{}{}
+
+		if !thinned {
+			continue
+		}
+
+		if indexed {
+			entry.Thinned = true
+
+			err = IndexAdd(e.IndexPath, pa.Path, entry)
+			if err != nil {
+				t.Log(logger.Warn, "unable to update index: %v", err)
+			} else {
+				t.Notifier.Publish(notify.Event{
+					Type:   notify.EventIndexAdd,
+					Path:   pa.Path,
+					Fields: map[string]string{"segmentPath": fpath},
+				})
+			}
+		}
+
+		t.Registry.SegmentsChanged(pa.Path)
+
+		t.Log(logger.Info, "thinned %s", fpath)
+	}
+}
+
+// thinSegment replaces a segment with a thinned copy.
+// It returns false when the segment doesn't need to be thinned.
+func (t *Thinner) thinSegment(fpath string) (bool, error) {
+	src, err := os.Open(fpath)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	// write into a temporary file, in order not to expose partial segments to the playback server
+	tmp, err := os.CreateTemp(filepath.Dir(fpath), ".thin-*")
+	if err != nil {
+		return false, err
+	}
+
+	thinned, err := thinFMP4(src, tmp)
+
+	// flush the copy to disk before replacing the original segment,
+	// in order not to lose both in case of power loss
+	if err == nil && thinned {
+		err = tmp.Sync()
+	}
+
+	err2 := tmp.Close()
+	if err == nil {
+		err = err2
+	}
+
+	if err == nil && thinned {
+		err = os.Rename(tmp.Name(), fpath)
+	}
+
+	if err != nil || !thinned {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+
+	// directories cannot be flushed on some platforms, therefore errors are ignored
+	syncDir(filepath.Dir(fpath)) //nolint:errcheck
+
+	// the checksum of the original segment isn't valid anymore
+	if _, err = os.Stat(ChecksumPath(fpath)); err == nil {
+		err = ChecksumWrite(fpath)
+		if err != nil {
+			t.Log(logger.Warn, "unable to write checksum: %v", err)
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,239 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+)
+
+// boxes bigger than this are not read into memory.
+const thinnerMaxBoxSize = 256 * 1024 * 1024
+
+// thinnerReadBox reads a top-level box, header included.
+func thinnerReadBox(r io.Reader) (string, []byte, error) {
+	header := make([]byte, 8)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return "", nil, err
+	}
+
+	size := uint64(binary.BigEndian.Uint32(header[:4]))
+	typ := string(header[4:])
+
+	if size == 1 {
+		ext := make([]byte, 8)
+		_, err = io.ReadFull(r, ext)
+		if err != nil {
+			return "", nil, err
+		}
+
+		header = append(header, ext...)
+		size = binary.BigEndian.Uint64(ext)
+	}
+
+	if size < uint64(len(header)) || size > thinnerMaxBoxSize {
+		return "", nil, fmt.Errorf("invalid size of box '%s'", typ)
+	}
+
+	buf := make([]byte, size)
+	copy(buf, header)
+
+	_, err = io.ReadFull(r, buf[len(header):])
+	if err != nil {
+		return "", nil, err
+	}
+
+	return typ, buf, nil
+}
+
+type thinnerTrack struct {
+	pending    *fmp4.PartSample
+	pendingDTS uint64
+	end        uint64
+}
+
+// fmp4Thinner removes non-sync samples from the video tracks of a fMP4 segment.
+// Each remaining sample lasts until the next one, in order to preserve the timeline.
+type fmp4Thinner struct {
+	w io.Writer
+
+	tracks     map[int]*thinnerTrack
+	trackIDs   []int
+	nextSeqNum uint32
+	dropped    bool
+}
+
+func (t *fmp4Thinner) writePart(part *fmp4.Part) error {
+	var buf seekablebuffer.Buffer
+	err := part.Marshal(&buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.w.Write(buf.Bytes())
+	return err
+}
+
+func (t *fmp4Thinner) processPart(part *fmp4.Part) error {
+	out := &fmp4.Part{
+		SequenceNumber: part.SequenceNumber,
+	}
+
+	for _, pt := range part.Tracks {
+		track, ok := t.tracks[pt.ID]
+		if !ok {
+			out.Tracks = append(out.Tracks, pt)
+			continue
+		}
+
+		var completed *fmp4.PartTrack
+		dts := pt.BaseTime
+
+		for _, s := range pt.Samples {
+			if s.IsNonSyncSample {
+				t.dropped = true
+			} else {
+				if track.pending != nil {
+					track.pending.Duration = uint32(dts - track.pendingDTS)
+
+					if completed == nil {
+						completed = &fmp4.PartTrack{
+							ID:       pt.ID,
+							BaseTime: track.pendingDTS,
+						}
+					}
+					completed.Samples = append(completed.Samples, track.pending)
+				}
+
+				track.pending = s
+				track.pendingDTS = dts
+			}
+
+			dts += uint64(s.Duration)
+		}
+
+		track.end = dts
+
+		if completed != nil {
+			out.Tracks = append(out.Tracks, completed)
+		}
+	}
+
+	t.nextSeqNum = part.SequenceNumber + 1
+
+	if out.Tracks == nil {
+		return nil
+	}
+
+	return t.writePart(out)
+}
+
+func (t *fmp4Thinner) flush() error {
+	out := &fmp4.Part{
+		SequenceNumber: t.nextSeqNum,
+	}
+
+	for _, id := range t.trackIDs {
+		track := t.tracks[id]
+		if track.pending == nil {
+			continue
+		}
+
+		track.pending.Duration = uint32(track.end - track.pendingDTS)
+
+		out.Tracks = append(out.Tracks, &fmp4.PartTrack{
+			ID:       id,
+			BaseTime: track.pendingDTS,
+			Samples:  []*fmp4.PartSample{track.pending},
+		})
+	}
+
+	if out.Tracks == nil {
+		return nil
+	}
+
+	return t.writePart(out)
+}
+
+// thinFMP4 writes a copy of a fMP4 segment that contains only the sync samples of video tracks.
+// It returns false when the segment doesn't contain any non-sync video sample.
+func thinFMP4(r io.Reader, w io.Writer) (bool, error) {
+	br := bufio.NewReader(r)
+	t := &fmp4Thinner{w: w}
+
+	// boxes that precede the first fragment are copied as they are
+	var initBuf []byte
+
+	for {
+		typ, buf, err := thinnerReadBox(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return false, err
+		}
+
+		if typ != "moof" {
+			if t.tracks == nil {
+				initBuf = append(initBuf, buf...)
+			}
+			continue
+		}
+
+		if t.tracks == nil {
+			var init fmp4.Init
+			err = init.Unmarshal(bytes.NewReader(initBuf))
+			if err != nil {
+				return false, err
+			}
+
+			t.tracks = make(map[int]*thinnerTrack)
+
+			for _, track := range init.Tracks {
+				if track.Codec.IsVideo() {
+					t.tracks[track.ID] = &thinnerTrack{}
+					t.trackIDs = append(t.trackIDs, track.ID)
+				}
+			}
+
+			_, err = w.Write(initBuf)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		typ, mdat, err := thinnerReadBox(br)
+		if err != nil {
+			return false, err
+		}
+		if typ != "mdat" {
+			return false, fmt.Errorf("unexpected box '%s'", typ)
+		}
+
+		var parts fmp4.Parts
+		err = parts.Unmarshal(append(buf, mdat...))
+		if err != nil {
+			return false, err
+		}
+
+		for _, part := range parts {
+			err = t.processPart(part)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	err := t.flush()
+	if err != nil {
+		return false, err
+	}
+
+	return t.dropped, nil
+}
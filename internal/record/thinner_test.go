@@ -0,0 +1,174 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestThinner(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 0o5, 20, 22, 15, 25, 427000, time.Local)
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-thinner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	segPath := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4")
+
+	var buf seekablebuffer.Buffer
+
+	init := fmp4.Init{
+		Tracks: []*fmp4.InitTrack{
+			{
+				ID:        1,
+				TimeScale: 90000,
+				Codec: &fmp4.CodecH264{
+					SPS: test.FormatH264.SPS,
+					PPS: test.FormatH264.PPS,
+				},
+			},
+			{
+				ID:        2,
+				TimeScale: 44100,
+				Codec: &fmp4.CodecMPEG4Audio{
+					Config: *test.FormatMPEG4Audio.Config,
+				},
+			},
+		},
+	}
+	err = init.Marshal(&buf)
+	require.NoError(t, err)
+
+	audioSamples := []*fmp4.PartSample{
+		{Duration: 1024, Payload: []byte{1, 2}},
+		{Duration: 1024, Payload: []byte{3, 4}},
+	}
+
+	err = (&fmp4.Part{
+		SequenceNumber: 1,
+		Tracks: []*fmp4.PartTrack{
+			{
+				ID: 1,
+				Samples: []*fmp4.PartSample{
+					{Duration: 30000, Payload: []byte{5}},
+					{Duration: 30000, IsNonSyncSample: true, Payload: []byte{1}},
+					{Duration: 30000, IsNonSyncSample: true, Payload: []byte{1}},
+				},
+			},
+			{
+				ID:      2,
+				Samples: audioSamples,
+			},
+		},
+	}).Marshal(&buf)
+	require.NoError(t, err)
+
+	err = (&fmp4.Part{
+		SequenceNumber: 2,
+		Tracks: []*fmp4.PartTrack{
+			{
+				ID:       1,
+				BaseTime: 90000,
+				Samples: []*fmp4.PartSample{
+					{Duration: 30000, Payload: []byte{5, 5}},
+					{Duration: 30000, IsNonSyncSample: true, Payload: []byte{1}},
+				},
+			},
+		},
+	}).Marshal(&buf)
+	require.NoError(t, err)
+
+	err = os.WriteFile(segPath, buf.Bytes(), 0o644)
+	require.NoError(t, err)
+
+	err = ChecksumWrite(segPath)
+	require.NoError(t, err)
+
+	indexPath := filepath.Join(dir, "index")
+	format := conf.RecordFormatFMP4
+
+	err = IndexAdd(indexPath, "mypath", IndexEntry{
+		Start:    time.Date(2008, 5, 20, 22, 15, 25, 0, time.Local),
+		Duration: 2 * time.Second,
+		Path:     segPath,
+		Format:   &format,
+	})
+	require.NoError(t, err)
+
+	th := &Thinner{
+		Entries: []ThinnerEntry{{
+			Path:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			ThinAfter: 24 * time.Hour,
+			IndexPath: indexPath,
+		}},
+		Parent: test.NilLogger,
+	}
+	th.Initialize()
+	defer th.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	byts, err := os.ReadFile(segPath)
+	require.NoError(t, err)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(byts)
+	require.NoError(t, err)
+
+	require.Equal(t, fmp4.Parts{
+		{
+			SequenceNumber: 1,
+			Tracks: []*fmp4.PartTrack{
+				{
+					ID:      2,
+					Samples: audioSamples,
+				},
+			},
+		},
+		{
+			SequenceNumber: 2,
+			Tracks: []*fmp4.PartTrack{
+				{
+					ID: 1,
+					Samples: []*fmp4.PartSample{
+						{Duration: 90000, Payload: []byte{5}},
+					},
+				},
+			},
+		},
+		{
+			SequenceNumber: 3,
+			Tracks: []*fmp4.PartTrack{
+				{
+					ID:       1,
+					BaseTime: 90000,
+					Samples: []*fmp4.PartSample{
+						{Duration: 60000, Payload: []byte{5, 5}},
+					},
+				},
+			},
+		},
+	}, parts)
+
+	err = ChecksumVerify(segPath)
+	require.NoError(t, err)
+
+	entries, err := IndexRead(indexPath, "mypath")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.True(t, entries[1].Thinned)
+	require.Equal(t, 2*time.Second, entries[1].Duration)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4"
@@ -17,21 +18,39 @@ import (
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/hooks"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/record"
 )
 
 const (
 	rtspAuthRealm = "IPCAM"
 )
 
+// isReplayRequest checks whether the client is asking for recordings instead of the live stream,
+// as described in the ONVIF streaming specification.
+func isReplayRequest(req *base.Request) bool {
+	for _, v := range req.Header["Require"] {
+		for _, feature := range strings.Split(v, ",") {
+			if strings.TrimSpace(feature) == "onvif-replay" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type conn struct {
 	isTLS               bool
 	rtspAddress         string
 	authMethods         []rtspauth.ValidateMethod
 	readTimeout         conf.StringDuration
+	udpMaxPayloadSize   int
 	runOnConnect        string
 	runOnConnectRestart bool
 	runOnDisconnect     string
 	externalCmdPool     *externalcmd.Pool
+	recordRegistry      *record.Registry
+	playbackBoxLimits   playback.BoxLimits
 	pathManager         serverPathManager
 	rconn               *gortsplib.ServerConn
 	rserver             *gortsplib.Server
@@ -42,6 +61,8 @@ type conn struct {
 	onDisconnectHook func()
 	authNonce        string
 	authFailures     int
+	replay           *playback.Replay
+	replayPath       string
 }
 
 func (c *conn) initialize() {
@@ -93,6 +114,10 @@ func (c *conn) ip() net.IP {
 func (c *conn) onClose(err error) {
 	c.Log(logger.Info, "closed: %v", err)
 
+	if c.replay != nil {
+		c.replay.Close()
+	}
+
 	c.onDisconnectHook()
 }
 
@@ -126,6 +151,10 @@ func (c *conn) onDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 		}
 	}
 
+	if isReplayRequest(ctx.Request) {
+		return c.describeReplay(ctx)
+	}
+
 	res := c.pathManager.Describe(defs.PathDescribeReq{
 		AccessRequest: defs.PathAccessRequest{
 			Name:        ctx.Path,
@@ -178,6 +207,93 @@ func (c *conn) onDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 	}, stream, nil
 }
 
+func (c *conn) describeReplay(ctx *gortsplib.ServerHandlerOnDescribeCtx,
+) (*base.Response, *gortsplib.ServerStream, error) {
+	replay, res, err := c.newReplay(ctx.Path, ctx.Query, ctx.Request)
+	if replay == nil {
+		return res, nil, err
+	}
+
+	if c.replay != nil {
+		c.replay.Close()
+	}
+	c.replay = replay
+	c.replayPath = ctx.Path
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, c.replayStream(replay), nil
+}
+
+// newReplay creates a Replay of the recordings of a path.
+// the returned response is meaningful only when the Replay is nil.
+func (c *conn) newReplay(pathName string, query string, req *base.Request,
+) (*playback.Replay, *base.Response, error) {
+	var maxLookback time.Duration
+	var privileged bool
+
+	pathConf, err := c.pathManager.FindPathConf(defs.PathFindPathConfReq{
+		AccessRequest: defs.PathAccessRequest{
+			Name:        pathName,
+			Query:       query,
+			Playback:    true,
+			IP:          c.ip(),
+			Proto:       auth.ProtocolRTSP,
+			ID:          &c.uuid,
+			RTSPRequest: req,
+			RTSPNonce:   c.authNonce,
+		},
+		MaxLookback: &maxLookback,
+		Privileged:  &privileged,
+	})
+	if err != nil {
+		var terr auth.Error
+		if errors.As(err, &terr) {
+			res, err2 := c.handleAuthError(terr)
+			return nil, res, err2
+		}
+
+		return nil, &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, err
+	}
+
+	replay := &playback.Replay{
+		PathConf:          pathConf,
+		PathName:          pathName,
+		MaxLookback:       maxLookback,
+		Privileged:        privileged,
+		UDPMaxPayloadSize: c.udpMaxPayloadSize,
+		BoxLimits:         c.playbackBoxLimits,
+		Registry:          c.recordRegistry,
+		Parent:            c,
+	}
+	err = replay.Initialize()
+	if err != nil {
+		return nil, &base.Response{
+			StatusCode: replayErrorStatus(err),
+		}, err
+	}
+
+	return replay, nil, nil
+}
+
+// replayErrorStatus returns the status code of a response to a failed replay.
+func replayErrorStatus(err error) base.StatusCode {
+	var nerr playback.NotAllowedError
+	if errors.As(err, &nerr) {
+		return base.StatusForbidden
+	}
+	return base.StatusNotFound
+}
+
+func (c *conn) replayStream(replay *playback.Replay) *gortsplib.ServerStream {
+	if !c.isTLS {
+		return replay.Stream().RTSPStream(c.rserver)
+	}
+	return replay.Stream().RTSPSStream(c.rserver)
+}
+
 func (c *conn) handleAuthError(authErr error) (*base.Response, error) {
 	c.authFailures++
 
@@ -21,6 +21,8 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
@@ -50,6 +52,7 @@ type serverPathManager interface {
 	Describe(req defs.PathDescribeReq) defs.PathDescribeRes
 	AddPublisher(_ defs.PathAddPublisherReq) (defs.Path, error)
 	AddReader(_ defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+	FindPathConf(req defs.PathFindPathConfReq) (*conf.Path, error)
 }
 
 type serverParent interface {
@@ -63,6 +66,7 @@ type Server struct {
 	ReadTimeout         conf.StringDuration
 	WriteTimeout        conf.StringDuration
 	WriteQueueSize      int
+	UDPMaxPayloadSize   int
 	UseUDP              bool
 	UseMulticast        bool
 	RTPAddress          string
@@ -79,6 +83,8 @@ type Server struct {
 	RunOnConnectRestart bool
 	RunOnDisconnect     string
 	ExternalCmdPool     *externalcmd.Pool
+	RecordRegistry      *record.Registry
+	PlaybackBoxLimits   playback.BoxLimits
 	PathManager         serverPathManager
 	Parent              serverParent
 
@@ -187,10 +193,13 @@ func (s *Server) OnConnOpen(ctx *gortsplib.ServerHandlerOnConnOpenCtx) {
 		rtspAddress:         s.RTSPAddress,
 		authMethods:         s.AuthMethods,
 		readTimeout:         s.ReadTimeout,
+		udpMaxPayloadSize:   s.UDPMaxPayloadSize,
 		runOnConnect:        s.RunOnConnect,
 		runOnConnectRestart: s.RunOnConnectRestart,
 		runOnDisconnect:     s.RunOnDisconnect,
 		externalCmdPool:     s.ExternalCmdPool,
+		recordRegistry:      s.RecordRegistry,
+		playbackBoxLimits:   s.PlaybackBoxLimits,
 		pathManager:         s.PathManager,
 		rconn:               ctx.Conn,
 		rserver:             s.srv,
@@ -1,12 +1,16 @@
 package rtsp
 
 import (
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4"
 	"github.com/bluenviron/gortsplib/v4/pkg/auth"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	rtspconn "github.com/bluenviron/gortsplib/v4/pkg/conn"
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
 	"github.com/bluenviron/gortsplib/v4/pkg/format"
 	"github.com/bluenviron/mediamtx/internal/asyncwriter"
@@ -23,6 +27,7 @@ import (
 type dummyPath struct {
 	stream        *stream.Stream
 	streamCreated chan struct{}
+	conf          *conf.Path
 }
 
 func (p *dummyPath) Name() string {
@@ -30,6 +35,9 @@ func (p *dummyPath) Name() string {
 }
 
 func (p *dummyPath) SafeConf() *conf.Path {
+	if p.conf != nil {
+		return p.conf
+	}
 	return &conf.Path{}
 }
 
@@ -84,6 +92,10 @@ func (pm *dummyPathManager) AddReader(_ defs.PathAddReaderReq) (defs.Path, *stre
 	return pm.path, pm.path.stream, nil
 }
 
+func (pm *dummyPathManager) FindPathConf(_ defs.PathFindPathConfReq) (*conf.Path, error) {
+	return pm.path.SafeConf(), nil
+}
+
 func TestServerPublish(t *testing.T) {
 	path := &dummyPath{
 		streamCreated: make(chan struct{}),
@@ -264,3 +276,68 @@ func TestServerRead(t *testing.T) {
 
 	<-recv
 }
+
+func TestServerReplay(t *testing.T) {
+	for _, ca := range []string{"enabled", "disabled"} {
+		t.Run(ca, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "mediamtx-rtsp-replay")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			err = os.Mkdir(filepath.Join(dir, "teststream"), 0o755)
+			require.NoError(t, err)
+
+			err = test.CreateRecording(filepath.Join(dir, "teststream", "2008-11-07_11-22-00-500000.mp4"))
+			require.NoError(t, err)
+
+			path := &dummyPath{
+				conf: &conf.Path{
+					RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+					RecordFormat:   conf.RecordFormatFMP4,
+					PlaybackEnable: ca == "enabled",
+				},
+			}
+
+			s := &Server{
+				Address:        "127.0.0.1:8557",
+				AuthMethods:    []auth.ValidateMethod{auth.ValidateMethodBasic},
+				ReadTimeout:    conf.StringDuration(10 * time.Second),
+				WriteTimeout:   conf.StringDuration(10 * time.Second),
+				WriteQueueSize: 512,
+				Protocols:      map[conf.Protocol]struct{}{conf.Protocol(gortsplib.TransportTCP): {}},
+				PathManager:    &dummyPathManager{path: path},
+				Parent:         test.NilLogger,
+			}
+			err = s.Initialize()
+			require.NoError(t, err)
+			defer s.Close()
+
+			nconn, err := net.Dial("tcp", "127.0.0.1:8557")
+			require.NoError(t, err)
+			defer nconn.Close()
+			conn := rtspconn.NewConn(nconn)
+
+			u, err := base.ParseURL("rtsp://127.0.0.1:8557/teststream")
+			require.NoError(t, err)
+
+			err = conn.WriteRequest(&base.Request{
+				Method: base.Describe,
+				URL:    u,
+				Header: base.Header{
+					"CSeq":    base.HeaderValue{"1"},
+					"Require": base.HeaderValue{"onvif-replay"},
+				},
+			})
+			require.NoError(t, err)
+
+			res, err := conn.ReadResponse()
+			require.NoError(t, err)
+
+			if ca == "enabled" {
+				require.Equal(t, base.StatusOK, res.StatusCode)
+			} else {
+				require.Equal(t, base.StatusForbidden, res.StatusCode)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/bluenviron/gortsplib/v4"
 	rtspauth "github.com/bluenviron/gortsplib/v4/pkg/auth"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
 	"github.com/google/uuid"
 	"github.com/pion/rtp"
 
@@ -20,6 +21,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/hooks"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/playback"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
@@ -37,6 +39,7 @@ type session struct {
 	created         time.Time
 	path            defs.Path
 	stream          *stream.Stream
+	replay          *playback.Replay
 	onUnreadHook    func()
 	mutex           sync.Mutex
 	state           gortsplib.ServerSessionState
@@ -74,6 +77,13 @@ func (s *session) Log(level logger.Level, format string, args ...interface{}) {
 
 // onClose is called by rtspServer.
 func (s *session) onClose(err error) {
+	if s.replay != nil {
+		s.replay.Close()
+		s.replay = nil
+		s.Log(logger.Info, "destroyed: %v", err)
+		return
+	}
+
 	if s.rsession.State() == gortsplib.ServerSessionStatePlay {
 		s.onUnreadHook()
 	}
@@ -182,6 +192,10 @@ func (s *session) onSetup(c *conn, ctx *gortsplib.ServerHandlerOnSetupCtx,
 			}
 		}
 
+		if isReplayRequest(ctx.Request) {
+			return s.setupReplay(c, ctx)
+		}
+
 		path, stream, err := s.pathManager.AddReader(defs.PathAddReaderReq{
 			Author: s,
 			AccessRequest: defs.PathAccessRequest{
@@ -240,8 +254,39 @@ func (s *session) onSetup(c *conn, ctx *gortsplib.ServerHandlerOnSetupCtx,
 	}
 }
 
+func (s *session) setupReplay(c *conn, ctx *gortsplib.ServerHandlerOnSetupCtx,
+) (*base.Response, *gortsplib.ServerStream, error) {
+	if s.replay == nil {
+		// reuse the replay created during DESCRIBE
+		if c.replay != nil && c.replayPath == ctx.Path {
+			s.replay = c.replay
+			c.replay = nil
+		} else {
+			replay, res, err := c.newReplay(ctx.Path, ctx.Query, ctx.Request)
+			if replay == nil {
+				return res, nil, err
+			}
+			s.replay = replay
+		}
+	}
+
+	s.mutex.Lock()
+	s.state = gortsplib.ServerSessionStatePrePlay
+	s.pathName = ctx.Path
+	s.query = ctx.Query
+	s.mutex.Unlock()
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, c.replayStream(s.replay), nil
+}
+
 // onPlay is called by rtspServer.
-func (s *session) onPlay(_ *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+func (s *session) onPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	if s.replay != nil {
+		return s.playReplay(ctx)
+	}
+
 	h := make(base.Header)
 
 	if s.rsession.State() == gortsplib.ServerSessionStatePrePlay {
@@ -271,6 +316,76 @@ func (s *session) onPlay(_ *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, e
 	}, nil
 }
 
+func (s *session) playReplay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	var rng headers.Range
+	var rngUTC *headers.RangeUTC
+
+	if _, ok := ctx.Request.Header["Range"]; ok {
+		err := rng.Unmarshal(ctx.Request.Header["Range"])
+		if err != nil {
+			return &base.Response{
+				StatusCode: base.StatusBadRequest,
+			}, fmt.Errorf("invalid Range header: %w", err)
+		}
+
+		rngUTC, ok = rng.Value.(*headers.RangeUTC)
+		if !ok {
+			return &base.Response{
+				StatusCode: base.StatusNotImplemented,
+			}, fmt.Errorf("only absolute (clock) ranges are supported")
+		}
+	} else if s.rsession.State() == gortsplib.ServerSessionStatePlay {
+		// nothing to do
+		return &base.Response{
+			StatusCode: base.StatusOK,
+		}, nil
+	}
+
+	var start time.Time
+	var duration time.Duration
+
+	if rngUTC != nil {
+		start = rngUTC.Start
+		if rngUTC.End != nil {
+			duration = rngUTC.End.Sub(rngUTC.Start)
+			if duration <= 0 {
+				return &base.Response{
+					StatusCode: base.StatusBadRequest,
+				}, fmt.Errorf("invalid Range header: end is before start")
+			}
+		}
+	}
+
+	err := s.replay.Play(start, duration)
+	if err != nil {
+		return &base.Response{
+			StatusCode: replayErrorStatus(err),
+		}, err
+	}
+
+	if s.rsession.State() == gortsplib.ServerSessionStatePrePlay {
+		s.Log(logger.Info, "is reading recordings of path '%s', with %s, %s",
+			s.pathName,
+			s.rsession.SetuppedTransport(),
+			defs.MediasInfo(s.rsession.SetuppedMedias()))
+
+		s.mutex.Lock()
+		s.state = gortsplib.ServerSessionStatePlay
+		s.transport = s.rsession.SetuppedTransport()
+		s.mutex.Unlock()
+	}
+
+	h := make(base.Header)
+	if rngUTC != nil {
+		h["Range"] = rng.Marshal()
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+		Header:     h,
+	}, nil
+}
+
 // onRecord is called by rtspServer.
 func (s *session) onRecord(_ *gortsplib.ServerHandlerOnRecordCtx) (*base.Response, error) {
 	stream, err := s.path.StartPublisher(defs.PathStartPublisherReq{
@@ -286,6 +401,8 @@ func (s *session) onRecord(_ *gortsplib.ServerHandlerOnRecordCtx) (*base.Respons
 
 	s.stream = stream
 
+	useAbsoluteTimestamp := s.path.SafeConf().UseAbsoluteTimestamp
+
 	for _, medi := range s.rsession.AnnouncedDescription().Medias {
 		for _, forma := range medi.Formats {
 			cmedi := medi
@@ -297,7 +414,14 @@ func (s *session) onRecord(_ *gortsplib.ServerHandlerOnRecordCtx) (*base.Respons
 					return
 				}
 
-				stream.WriteRTPPacket(cmedi, cforma, pkt, time.Now(), pts)
+				ntp := time.Now()
+				if useAbsoluteTimestamp {
+					if v, ok := s.rsession.PacketNTP(cmedi, pkt); ok {
+						ntp = v
+					}
+				}
+
+				stream.WriteRTPPacket(cmedi, cforma, pkt, ntp, pts)
 			})
 		}
 	}
@@ -316,7 +440,11 @@ func (s *session) onRecord(_ *gortsplib.ServerHandlerOnRecordCtx) (*base.Respons
 func (s *session) onPause(_ *gortsplib.ServerHandlerOnPauseCtx) (*base.Response, error) {
 	switch s.rsession.State() {
 	case gortsplib.ServerSessionStatePlay:
-		s.onUnreadHook()
+		if s.replay != nil {
+			s.replay.Stop()
+		} else {
+			s.onUnreadHook()
+		}
 
 		s.mutex.Lock()
 		s.state = gortsplib.ServerSessionStatePrePlay
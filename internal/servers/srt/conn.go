@@ -21,7 +21,9 @@ import (
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/hooks"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/playback"
 	"github.com/bluenviron/mediamtx/internal/protocols/mpegts"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
@@ -62,6 +64,8 @@ type conn struct {
 	runOnDisconnect     string
 	wg                  *sync.WaitGroup
 	externalCmdPool     *externalcmd.Pool
+	recordRegistry      *record.Registry
+	playbackBoxLimits   playback.BoxLimits
 	pathManager         serverPathManager
 	parent              *Server
 
@@ -132,8 +136,12 @@ func (c *conn) runInner() error {
 		return fmt.Errorf("invalid stream ID '%s': %w", c.connReq.StreamId(), err)
 	}
 
-	if streamID.mode == streamIDModePublish {
+	switch streamID.mode {
+	case streamIDModePublish:
 		return c.runPublish(&streamID)
+
+	case streamIDModePlayback:
+		return c.runPlayback(&streamID)
 	}
 	return c.runRead(&streamID)
 }
@@ -323,6 +331,115 @@ func (c *conn) runRead(streamID *streamID) error {
 	}
 }
 
+func (c *conn) runPlayback(streamID *streamID) error {
+	var maxLookback time.Duration
+	var privileged bool
+
+	pathConf, err := c.pathManager.FindPathConf(defs.PathFindPathConfReq{
+		AccessRequest: defs.PathAccessRequest{
+			Name:     streamID.path,
+			IP:       c.ip(),
+			User:     streamID.user,
+			Pass:     streamID.pass,
+			Proto:    auth.ProtocolSRT,
+			ID:       &c.uuid,
+			Query:    streamID.query,
+			Playback: true,
+		},
+		MaxLookback: &maxLookback,
+		Privileged:  &privileged,
+	})
+	if err != nil {
+		var terr auth.Error
+		if errors.As(err, &terr) {
+			// wait some seconds to mitigate brute force attacks
+			<-time.After(auth.PauseAfterError)
+			c.connReq.Reject(srt.REJ_PEER)
+			return terr
+		}
+		c.connReq.Reject(srt.REJ_PEER)
+		return err
+	}
+
+	start, duration, err := playback.ParseReplayQuery(streamID.query)
+	if err != nil {
+		c.connReq.Reject(srt.REJ_PEER)
+		return err
+	}
+
+	err = srtCheckPassphrase(c.connReq, pathConf.SRTReadPassphrase)
+	if err != nil {
+		c.connReq.Reject(srt.REJ_PEER)
+		return err
+	}
+
+	replay := &playback.Replay{
+		PathConf:          pathConf,
+		PathName:          streamID.path,
+		MaxLookback:       maxLookback,
+		Privileged:        privileged,
+		UDPMaxPayloadSize: c.udpMaxPayloadSize,
+		BoxLimits:         c.playbackBoxLimits,
+		Registry:          c.recordRegistry,
+		Parent:            c,
+	}
+	err = replay.Initialize()
+	if err != nil {
+		c.connReq.Reject(srt.REJ_PEER)
+		return err
+	}
+	defer replay.Close()
+
+	sconn, err := c.connReq.Accept()
+	if err != nil {
+		return err
+	}
+	defer sconn.Close()
+
+	c.mutex.Lock()
+	c.state = connStateRead
+	c.pathName = streamID.path
+	c.query = streamID.query
+	c.sconn = sconn
+	c.mutex.Unlock()
+
+	writer := asyncwriter.New(c.writeQueueSize, c)
+
+	defer replay.Stream().RemoveReader(writer)
+
+	bw := bufio.NewWriterSize(sconn, srtMaxPayloadSize(c.udpMaxPayloadSize))
+
+	err = mpegts.FromStream(replay.Stream(), writer, bw, sconn, time.Duration(c.writeTimeout))
+	if err != nil {
+		return err
+	}
+
+	c.Log(logger.Info, "is reading recordings of path '%s', %s",
+		streamID.path, defs.FormatsInfo(replay.Stream().FormatsForReader(writer)))
+
+	// disable read deadline
+	sconn.SetReadDeadline(time.Time{})
+
+	writer.Start()
+	defer writer.Stop()
+
+	err = replay.Play(start, duration)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-c.ctx.Done():
+		return fmt.Errorf("terminated")
+
+	case err := <-writer.Error():
+		return err
+
+	case <-replay.Done():
+		return fmt.Errorf("playback finished")
+	}
+}
+
 // APIReaderDescribe implements reader.
 func (c *conn) APIReaderDescribe() defs.APIPathSourceOrReader {
 	return defs.APIPathSourceOrReader{
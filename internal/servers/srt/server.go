@@ -16,6 +16,8 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/record"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
@@ -57,6 +59,7 @@ type serverAPIConnsKickReq struct {
 type serverPathManager interface {
 	AddPublisher(req defs.PathAddPublisherReq) (defs.Path, error)
 	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+	FindPathConf(req defs.PathFindPathConfReq) (*conf.Path, error)
 }
 
 type serverParent interface {
@@ -75,6 +78,8 @@ type Server struct {
 	RunOnConnectRestart bool
 	RunOnDisconnect     string
 	ExternalCmdPool     *externalcmd.Pool
+	RecordRegistry      *record.Registry
+	PlaybackBoxLimits   playback.BoxLimits
 	PathManager         serverPathManager
 	Parent              serverParent
 
@@ -166,6 +171,8 @@ outer:
 				runOnDisconnect:     s.RunOnDisconnect,
 				wg:                  &s.wg,
 				externalCmdPool:     s.ExternalCmdPool,
+				recordRegistry:      s.RecordRegistry,
+				playbackBoxLimits:   s.PlaybackBoxLimits,
 				pathManager:         s.PathManager,
 				parent:              s,
 			}
@@ -2,6 +2,8 @@ package srt
 
 import (
 	"bufio"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -22,6 +24,7 @@ import (
 type dummyPath struct {
 	stream        *stream.Stream
 	streamCreated chan struct{}
+	conf          *conf.Path
 }
 
 func (p *dummyPath) Name() string {
@@ -29,6 +32,9 @@ func (p *dummyPath) Name() string {
 }
 
 func (p *dummyPath) SafeConf() *conf.Path {
+	if p.conf != nil {
+		return p.conf
+	}
 	return &conf.Path{}
 }
 
@@ -78,6 +84,13 @@ func (pm *dummyPathManager) AddReader(req defs.PathAddReaderReq) (defs.Path, *st
 	return pm.path, pm.path.stream, nil
 }
 
+func (pm *dummyPathManager) FindPathConf(req defs.PathFindPathConfReq) (*conf.Path, error) {
+	if req.AccessRequest.User != "myuser" || req.AccessRequest.Pass != "mypass" {
+		return nil, auth.Error{}
+	}
+	return pm.path.SafeConf(), nil
+}
+
 func TestServerPublish(t *testing.T) {
 	externalCmdPool := externalcmd.NewPool()
 	defer externalCmdPool.Close()
@@ -266,3 +279,60 @@ func TestServerRead(t *testing.T) {
 		}
 	}
 }
+
+func TestServerPlayback(t *testing.T) {
+	for _, ca := range []string{"enabled", "disabled"} {
+		t.Run(ca, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "mediamtx-srt-playback")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+			require.NoError(t, err)
+
+			err = test.CreateRecording(filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+			require.NoError(t, err)
+
+			externalCmdPool := externalcmd.NewPool()
+			defer externalCmdPool.Close()
+
+			path := &dummyPath{
+				conf: &conf.Path{
+					RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+					RecordFormat:   conf.RecordFormatFMP4,
+					PlaybackEnable: ca == "enabled",
+				},
+			}
+
+			s := &Server{
+				Address:           "127.0.0.1:8890",
+				ReadTimeout:       conf.StringDuration(10 * time.Second),
+				WriteTimeout:      conf.StringDuration(10 * time.Second),
+				WriteQueueSize:    512,
+				UDPMaxPayloadSize: 1472,
+				ExternalCmdPool:   externalCmdPool,
+				PathManager:       &dummyPathManager{path: path},
+				Parent:            test.NilLogger,
+			}
+			err = s.Initialize()
+			require.NoError(t, err)
+			defer s.Close()
+
+			srtConf := srt.DefaultConfig()
+			address, err := srtConf.UnmarshalURL("srt://127.0.0.1:8890?streamid=playback:mypath:myuser:mypass")
+			require.NoError(t, err)
+
+			err = srtConf.Validate()
+			require.NoError(t, err)
+
+			reader, err := srt.Dial("srt", address, srtConf)
+
+			if ca == "enabled" {
+				require.NoError(t, err)
+				reader.Close()
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
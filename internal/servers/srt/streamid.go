@@ -10,6 +10,7 @@ type streamIDMode int
 const (
 	streamIDModeRead streamIDMode = iota
 	streamIDModePublish
+	streamIDModePlayback
 )
 
 type streamID struct {
@@ -66,7 +67,7 @@ func (s *streamID) unmarshal(raw string) error {
 		parts := strings.Split(raw, ":")
 		if len(parts) < 2 || len(parts) > 5 {
 			return fmt.Errorf("stream ID must be 'action:pathname[:query]' or 'action:pathname:user:pass[:query]', " +
-				"where action is either read or publish, pathname is the path name, user and pass are the credentials, " +
+				"where action is either read, publish or playback, pathname is the path name, user and pass are the credentials, " +
 				"query is an optional token containing additional information")
 		}
 
@@ -77,9 +78,12 @@ func (s *streamID) unmarshal(raw string) error {
 		case "publish":
 			s.mode = streamIDModePublish
 
+		case "playback":
+			s.mode = streamIDModePlayback
+
 		default:
 			return fmt.Errorf("stream ID must be 'action:pathname[:query]' or 'action:pathname:user:pass[:query]', " +
-				"where action is either read or publish, pathname is the path name, user and pass are the credentials, " +
+				"where action is either read, publish or playback, pathname is the path name, user and pass are the credentials, " +
 				"query is an optional token containing additional information")
 		}
 
@@ -40,6 +40,15 @@ func TestStreamIDUnmarshal(t *testing.T) {
 				query: "myquery",
 			},
 		},
+		{
+			"mediamtx syntax playback",
+			"playback:mypath:start=2024-01-14T16%3A33%3A17Z&duration=60",
+			streamID{
+				mode:  streamIDModePlayback,
+				path:  "mypath",
+				query: "start=2024-01-14T16%3A33%3A17Z&duration=60",
+			},
+		},
 		{
 			"standard syntax",
 			"#!::u=johnny,t=file,m=publish,r=results.csv,s=mypass,h=myhost.com",
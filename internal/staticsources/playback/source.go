@@ -0,0 +1,111 @@
+// Package playback contains the playback static source.
+package playback
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	mtxplayback "github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/record"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+type sourcePathManager interface {
+	FindPathConf(req defs.PathFindPathConfReq) (*conf.Path, error)
+}
+
+// Source is a static source that plays recordings of another path in a loop.
+type Source struct {
+	PathManager sourcePathManager
+	Registry    *record.Registry
+	BoxLimits   mtxplayback.BoxLimits
+	Parent      defs.StaticSourceParent
+}
+
+// Log implements logger.Writer.
+func (s *Source) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[playback source] "+format, args...)
+}
+
+// Run implements StaticSource.
+func (s *Source) Run(params defs.StaticSourceRunParams) error {
+	pathName, query, _ := strings.Cut(params.ResolvedSource[len("playback://"):], "?")
+
+	start, duration, err := mtxplayback.ParseReplayQuery(query)
+	if err != nil {
+		return err
+	}
+
+	// recordings are stored with the settings of the recorded path
+	pathConf, err := s.PathManager.FindPathConf(defs.PathFindPathConfReq{
+		AccessRequest: defs.PathAccessRequest{
+			Name:     pathName,
+			Playback: true,
+			SkipAuth: true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// readers of the path are not authenticated against the recorded path,
+	// therefore recordings hidden by privacy intervals are never shown.
+	r := &mtxplayback.Replay{
+		PathConf:  pathConf,
+		PathName:  pathName,
+		Registry:  s.Registry,
+		BoxLimits: s.BoxLimits,
+		LiveNTP:   true,
+		OnDescription: func(desc *description.Session) (*stream.Stream, error) {
+			res := s.Parent.SetReady(defs.PathSourceStaticSetReadyReq{
+				Desc:               desc,
+				GenerateRTPPackets: true,
+			})
+			return res.Stream, res.Err
+		},
+		Parent: s,
+	}
+	err = r.Initialize()
+	if err != nil {
+		return err
+	}
+
+	defer s.Parent.SetNotReady(defs.PathSourceStaticSetNotReadyReq{})
+	defer r.Close()
+
+	for {
+		err = r.Play(start, duration)
+		if err != nil {
+			return err
+		}
+
+	outer:
+		for {
+			select {
+			case <-r.Done():
+				if err = r.Err(); err != nil {
+					return err
+				}
+				break outer
+
+			case <-params.ReloadConf:
+
+			case <-params.Context.Done():
+				return fmt.Errorf("terminated")
+			}
+		}
+	}
+}
+
+// APISourceDescribe implements StaticSource.
+func (*Source) APISourceDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "playbackSource",
+		ID:   "",
+	}
+}
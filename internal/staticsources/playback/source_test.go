@@ -0,0 +1,131 @@
+package playback
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	mtxplayback "github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+type dummyPathManager struct {
+	pathConf *conf.Path
+}
+
+func (pm *dummyPathManager) FindPathConf(req defs.PathFindPathConfReq) (*conf.Path, error) {
+	if req.AccessRequest.Name != "mypath" {
+		return nil, fmt.Errorf("path not found")
+	}
+	return pm.pathConf, nil
+}
+
+func TestSource(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback-source")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	init := fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec: &fmp4.CodecH264{
+				SPS: test.FormatH264.SPS,
+				PPS: test.FormatH264.PPS,
+			},
+		}},
+	}
+
+	var buf1 seekablebuffer.Buffer
+	err = init.Marshal(&buf1)
+	require.NoError(t, err)
+
+	var buf2 seekablebuffer.Buffer
+	parts := fmp4.Parts{{
+		SequenceNumber: 1,
+		Tracks: []*fmp4.PartTrack{{
+			ID:       1,
+			BaseTime: 0,
+			Samples: []*fmp4.PartSample{{
+				Duration: 90000,
+				Payload:  []byte{0, 0, 0, 2, 5, 1},
+			}},
+		}},
+	}}
+	err = parts.Marshal(&buf2)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"),
+		append(buf1.Bytes(), buf2.Bytes()...), 0o644)
+	require.NoError(t, err)
+
+	te := test.NewSourceTester(
+		func(p defs.StaticSourceParent) defs.StaticSource {
+			return &Source{
+				PathManager: &dummyPathManager{
+					pathConf: &conf.Path{
+						RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+						PlaybackEnable: true,
+						RecordFormat:   conf.RecordFormatFMP4,
+					},
+				},
+				Parent: p,
+			}
+		},
+		"playback://mypath",
+		&conf.Path{},
+	)
+	defer te.Close()
+
+	u := <-te.Unit
+	require.Equal(t, []byte{5, 1}, u.(*unit.H264).AU[len(u.(*unit.H264).AU)-1])
+	require.WithinDuration(t, time.Now(), u.GetNTP(), 5*time.Second)
+}
+
+func TestSourcePlaybackDisabled(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback-source")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = test.CreateRecording(filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	require.NoError(t, err)
+
+	s := &Source{
+		PathManager: &dummyPathManager{
+			pathConf: &conf.Path{
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				PlaybackEnable: false,
+				RecordFormat:   conf.RecordFormatFMP4,
+			},
+		},
+		Parent: &test.SourceTester{},
+	}
+
+	// playback is enabled on the looping path, but not on the recorded one
+	err = s.Run(defs.StaticSourceRunParams{
+		Context:        context.Background(),
+		ResolvedSource: "playback://mypath",
+		Conf: &conf.Path{
+			PlaybackEnable: true,
+		},
+	})
+
+	var nerr mtxplayback.NotAllowedError
+	require.ErrorAs(t, err, &nerr)
+}
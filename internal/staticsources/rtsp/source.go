@@ -148,7 +148,14 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 							return
 						}
 
-						res.Stream.WriteRTPPacket(cmedi, cforma, pkt, time.Now(), pts)
+						ntp := time.Now()
+						if params.Conf.UseAbsoluteTimestamp {
+							if v, ok := c.PacketNTP(cmedi, pkt); ok {
+								ntp = v
+							}
+						}
+
+						res.Stream.WriteRTPPacket(cmedi, cforma, pkt, ntp, pts)
 					})
 				}
 			}
@@ -0,0 +1,54 @@
+package test
+
+import (
+	"os"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+)
+
+// CreateRecording writes a fMP4 recording segment with a H264 track and two samples of 100ms.
+func CreateRecording(fpath string) error {
+	init := fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec: &fmp4.CodecH264{
+				SPS: FormatH264.SPS,
+				PPS: FormatH264.PPS,
+			},
+		}},
+	}
+
+	var buf1 seekablebuffer.Buffer
+	err := init.Marshal(&buf1)
+	if err != nil {
+		return err
+	}
+
+	var buf2 seekablebuffer.Buffer
+	parts := fmp4.Parts{{
+		SequenceNumber: 1,
+		Tracks: []*fmp4.PartTrack{{
+			ID:       1,
+			BaseTime: 0,
+			Samples: []*fmp4.PartSample{
+				{
+					Duration: 9000,
+					Payload:  []byte{0, 0, 0, 1, 5},
+				},
+				{
+					Duration:        9000,
+					IsNonSyncSample: true,
+					Payload:         []byte{0, 0, 0, 1, 1},
+				},
+			},
+		}},
+	}}
+	err = parts.Marshal(&buf2)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fpath, append(buf1.Bytes(), buf2.Bytes()...), 0o644)
+}